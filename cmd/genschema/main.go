@@ -0,0 +1,111 @@
+// Command genschema generates JSON Schema and TypeScript definitions of the WebSocket protocol from
+// the Go types, for the web and mobile clients.
+//
+//	go run ./cmd/genschema [-out docs/schema] [-check]
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"coin-futures-websocket/internal/kafka"
+	"coin-futures-websocket/internal/schema"
+	"coin-futures-websocket/internal/types"
+	"coin-futures-websocket/internal/websocket/protocol"
+	"coin-futures-websocket/internal/websocket/server"
+)
+
+// protocolDir holds the error code constants, relative to the repository root
+const protocolDir = "internal/websocket/protocol"
+
+// messages are the payloads clients receive or send, in output order, keyed by a name overriding
+// Go names that clash with TypeScript globals
+var messages = []struct {
+	name  string
+	value any
+}{
+	{value: types.UserMargin{}},
+	{value: types.UserPosition{}},
+	{name: "ProtocolError", value: protocol.Error{}},
+	{value: server.ConnectRequest{}},
+	{value: server.ConnectReplyData{}},
+	{value: server.RateMessage{}},
+	{value: server.StatusMessage{}},
+	{value: server.PresenceMessage{}},
+	{value: server.AnnouncementMessage{}},
+	{value: server.ReauthMessage{}},
+	{value: kafka.QuotaEvent{}},
+	{value: server.BulkSubscribeRequest{}},
+	{value: server.BulkSubscribeResponse{}},
+	{value: server.PingRequest{}},
+	{value: server.PongResponse{}},
+	{value: server.AckRequest{}},
+	{value: server.AckResponse{}},
+	{value: server.CriticalMessage{}},
+	{value: server.Snapshot{}},
+}
+
+func main() {
+	out := flag.String("out", "docs/schema", "output directory")
+	check := flag.Bool("check", false, "fail if the files in -out are not up to date instead of writing them")
+	flag.Parse()
+
+	files, err := generate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "genschema:", err)
+		os.Exit(1)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		data := files[name]
+		path := filepath.Join(*out, name)
+		if *check {
+			current, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(current, data) {
+				fmt.Fprintf(os.Stderr, "genschema: %s is out of date, run go run ./cmd/genschema\n", path)
+				os.Exit(1)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(*out, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, "genschema:", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "genschema:", err)
+			os.Exit(1)
+		}
+		fmt.Println("wrote", path)
+	}
+}
+
+// generate renders the protocol definitions, keyed by file name
+func generate() (map[string][]byte, error) {
+	codes, err := schema.ParseConstants(protocolDir, "Code")
+	if err != nil {
+		return nil, err
+	}
+
+	g := schema.NewGenerator()
+	g.AddEnum(schema.Enum{Name: "ErrorCode", Values: codes})
+	for _, m := range messages {
+		if err := g.AddAs(m.name, m.value); err != nil {
+			return nil, err
+		}
+	}
+
+	jsonSchema, err := g.JSONSchema()
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		"protocol.schema.json": jsonSchema,
+		"protocol.ts":          g.TypeScript(),
+	}, nil
+}
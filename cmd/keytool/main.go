@@ -0,0 +1,164 @@
+// Command keytool generates and checks the Ed25519 keys used to sign publications.
+//
+//	keytool generate -out signing.key [-comment partner-1] [-force]
+//	keytool fingerprint -key signing.key
+//	keytool verify -key signing.key
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"coin-futures-websocket/internal/signing"
+)
+
+const usage = `usage: keytool <command> [flags]
+
+commands:
+  generate     generate an OpenSSH Ed25519 keypair (-out, -comment, -force)
+  fingerprint  print the public key and fingerprint of a key (-key)
+  verify       check that a key parses and signs correctly (-key)
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err := run(os.Args[1], os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "keytool:", err)
+		os.Exit(1)
+	}
+}
+
+// run executes a subcommand, writing its report to out
+func run(command string, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	switch command {
+	case "generate":
+		path := flags.String("out", "", "private key file; the public key is written to <out>.pub")
+		comment := flags.String("comment", "", "key comment, e.g. the key id registered with CFX")
+		force := flags.Bool("force", false, "overwrite existing key files")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		return generate(*path, *comment, *force, out)
+	case "fingerprint":
+		path := flags.String("key", "", "private key file")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		return fingerprint(*path, out)
+	case "verify":
+		path := flags.String("key", "", "private key file")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		return verify(*path, out)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", command, usage)
+	}
+}
+
+// generate writes a new keypair and prints the public key for registration
+func generate(path, comment string, force bool, out io.Writer) error {
+	if path == "" {
+		return errors.New("-out is required")
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := signing.MarshalOpenSSHPrivateKey(private, comment)
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	if err := writeFile(path, encoded, flags, 0o600); err != nil {
+		return err
+	}
+	if err := writeFile(path+".pub", []byte(signing.AuthorizedKey(public, comment)+"\n"), flags, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "private key: %s\npublic key:  %s.pub\n", path, path)
+	printPublicKey(out, public, comment)
+	return nil
+}
+
+// fingerprint prints the public key and fingerprint of a key file
+func fingerprint(path string, out io.Writer) error {
+	key, comment, err := load(path)
+	if err != nil {
+		return err
+	}
+	printPublicKey(out, key.Public().(ed25519.PublicKey), comment)
+	return nil
+}
+
+// verify checks that a key file parses and that its signatures verify with its public key
+func verify(path string, out io.Writer) error {
+	key, comment, err := load(path)
+	if err != nil {
+		return err
+	}
+
+	signer := signing.NewPublicationSigner(signing.NewEd25519Signer(comment, key), []string{""})
+	data := []byte(`{"keytool":"verify"}`)
+	tags, _ := signer.Tags("keytool", data)
+	if err := signing.VerifyEd25519(key.Public().(ed25519.PublicKey), "keytool", tags, data); err != nil {
+		return fmt.Errorf("key %s signs incorrectly: %w", path, err)
+	}
+
+	fmt.Fprintf(out, "ok: %s parses and signs correctly\n", path)
+	printPublicKey(out, key.Public().(ed25519.PublicKey), comment)
+	return nil
+}
+
+// load reads a key in OpenSSH format, falling back to PKCS#8 PEM
+func load(path string) (ed25519.PrivateKey, string, error) {
+	if path == "" {
+		return nil, "", errors.New("-key is required")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if key, comment, err := signing.ParseOpenSSHPrivateKey(data); err == nil {
+		return key, comment, nil
+	}
+
+	key, err := signing.LoadEd25519PrivateKey(path)
+	return key, "", err
+}
+
+// printPublicKey prints a public key in authorized_keys format and its fingerprint
+func printPublicKey(out io.Writer, key ed25519.PublicKey, comment string) {
+	fmt.Fprintf(out, "%s\nfingerprint: %s\n", signing.AuthorizedKey(key, comment), signing.Fingerprint(key))
+}
+
+// writeFile writes data to a new file, or truncates it when flags allow
+func writeFile(path string, data []byte, flags int, perm os.FileMode) error {
+	f, err := os.OpenFile(path, flags, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
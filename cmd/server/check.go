@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"coin-futures-websocket/config"
+	"coin-futures-websocket/internal/cache"
+	"coin-futures-websocket/internal/kafka"
+	"coin-futures-websocket/internal/service"
+)
+
+// checkTimeout bounds each startup self-check
+const checkTimeout = 10 * time.Second
+
+// startupCheck is a single step of the startup self-check
+type startupCheck struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// runStartupChecks loads and validates the configuration, then checks every dependency the service needs,
+// writes a report to w and returns the process exit code.
+func runStartupChecks(w io.Writer) int {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(w, "FAIL  config: %v\n", err)
+		return 1
+	}
+
+	httpClient := &http.Client{Timeout: checkTimeout}
+	checks := []startupCheck{
+		{name: "config", run: func(context.Context) error { return cfg.Validate() }},
+		{name: "channel policies", run: func(context.Context) error {
+			_, err := channelPolicies(cfg)
+			return err
+		}},
+		{name: "kafka brokers", run: func(ctx context.Context) error {
+			return kafka.CheckBrokers(ctx, cfg.Kafka.Brokers, kafkaSecurityConfig(cfg))
+		}},
+		{name: "coin-data", run: func(ctx context.Context) error {
+			return service.PingUpstream(ctx, httpClient, cfg.CoinData.Host)
+		}},
+		{name: "coin-cfx-adapter", run: func(ctx context.Context) error {
+			return service.PingUpstream(ctx, httpClient, cfg.CoinCfxAdapter.Host)
+		}},
+	}
+	if cfg.CoinData.SecondaryHost != "" {
+		checks = append(checks, startupCheck{name: "coin-data secondary", run: func(ctx context.Context) error {
+			return service.PingUpstream(ctx, httpClient, cfg.CoinData.SecondaryHost)
+		}})
+	}
+	if backend, _ := cache.ParseBackend(cfg.Cache.Backend); backend != cache.BackendMemory {
+		checks = append(checks, startupCheck{name: "cache store", run: func(ctx context.Context) error {
+			store, err := initCacheStore(cfg)
+			if err != nil {
+				return err
+			}
+			defer store.(*cache.RedisStore).Close()
+
+			_, _, err = store.Get(ctx, "startup-check")
+			return err
+		}})
+	}
+	if cfg.Signing.Enabled {
+		checks = append(checks, startupCheck{name: "signing key", run: func(context.Context) error {
+			_, err := initSigner(cfg)
+			return err
+		}})
+	}
+
+	failed := 0
+	for _, check := range checks {
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		start := time.Now()
+		err := check.run(ctx)
+		cancel()
+
+		elapsed := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			failed++
+			// Joined errors list one failure per line; indent them under the check
+			fmt.Fprintf(w, "FAIL  %s (%s): %s\n", check.name, elapsed, strings.ReplaceAll(err.Error(), "\n", "\n      "))
+			continue
+		}
+		fmt.Fprintf(w, "OK    %s (%s)\n", check.name, elapsed)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "%d of %d checks failed\n", failed, len(checks))
+		return 1
+	}
+	fmt.Fprintf(w, "all %d checks passed\n", len(checks))
+	return 0
+}
@@ -2,37 +2,113 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"coin-futures-websocket/config"
+	"coin-futures-websocket/internal/admin"
+	"coin-futures-websocket/internal/announcement"
+	"coin-futures-websocket/internal/auth"
+	"coin-futures-websocket/internal/cache"
+	"coin-futures-websocket/internal/certs"
+	"coin-futures-websocket/internal/clientip"
+	"coin-futures-websocket/internal/featureflag"
 	"coin-futures-websocket/internal/kafka"
+	"coin-futures-websocket/internal/kafka/producer"
+	"coin-futures-websocket/internal/leader"
+	"coin-futures-websocket/internal/logging"
+	"coin-futures-websocket/internal/receipt"
 	"coin-futures-websocket/internal/service"
+	"coin-futures-websocket/internal/signing"
+	"coin-futures-websocket/internal/version"
+	"coin-futures-websocket/internal/webhook"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/policy"
 	"coin-futures-websocket/internal/websocket/server"
 
 	"github.com/centrifugal/centrifuge"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func main() {
+	check := flag.Bool("check", false, "check the configuration and dependencies, then exit")
+	flag.Parse()
+
+	// Pre-deploy gate: report every failing check and exit non-zero instead of starting
+	if *check {
+		os.Exit(runStartupChecks(os.Stdout))
+	}
+
 	cfg := config.Get()
 
-	logger := initLogger(cfg)
+	logger, logManager := initLogger(cfg)
+
+	flags := featureflag.NewService(cfg.App.Env, featureFlags(cfg), logger)
+
+	// Apply logging and feature flag changes from the config file without a restart
+	config.Watch(func(reloaded *config.Configuration) {
+		logManager.Apply(logging.ParseLevel(reloaded.App.LogLevel), reloaded.Logging.Levels, logSamplingConfig(reloaded))
+		logManager.SetRedaction(logRedactConfig(reloaded))
+		logger.Info("logging configuration reloaded",
+			"log_level", reloaded.App.LogLevel,
+			"levels", reloaded.Logging.Levels)
+		flags.Update(featureFlags(reloaded))
+	})
+	build := version.Get()
 	logger.Info("starting WebSocket service",
+		"version", build.Version,
+		"commit", build.Commit,
+		"build_date", build.Date,
 		"env", cfg.App.Env,
 		"ws_server_enabled", cfg.WebSocketServer.Enabled)
 
-	transformer, currencyService := initTransformer(cfg, logger)
-	wsServer := initCentrifugeServer(cfg, logger)
+	// Every metric registered from here on carries the deployment region, so regions share dashboards
+	if cfg.App.Region != "" {
+		prometheus.DefaultRegisterer = prometheus.WrapRegistererWith(prometheus.Labels{"region": cfg.App.Region}, prometheus.DefaultRegisterer)
+	}
+
+	// Admin endpoints profile, publish and revoke, so they are never served without a token
+	if cfg.Admin.Enabled && cfg.Admin.Token == "" {
+		logger.Error("admin.token is required when the admin server is enabled")
+		os.Exit(1)
+	}
+
+	transformer, currencyService := initTransformer(cfg, logManager)
+
+	// With the redis backend, caches are shared so a client reconnecting to another replica keeps its snapshots
+	cacheStore, err := initCacheStore(cfg)
+	if err != nil {
+		logger.Error("failed to initialize cache store", "error", err)
+		os.Exit(1)
+	}
+
+	// The server and the broadcaster share the channel policies, so an overload degrades both
+	policies, err := channelPolicies(cfg)
+	if err != nil {
+		logger.Error("invalid channel policies", "error", err)
+		os.Exit(1)
+	}
+
+	wsServer, err := initCentrifugeServer(cfg, policies, cacheStore, logManager)
+	if err != nil {
+		logger.Error("invalid websocket server configuration", "error", err)
+		os.Exit(1)
+	}
 
 	// Initialize metrics
 	metrics := server.NewMetrics(wsServer.Node())
 	if err := metrics.Register(); err != nil {
 		logger.Warn("failed to register metrics", "error", err)
+		metrics = nil
 	} else {
 		wsServer.SetMetrics(metrics)
 		// Start background metrics collector
@@ -40,18 +116,264 @@ func main() {
 		logger.Info("metrics endpoint available", "path", "/metrics")
 	}
 
-	kafkaConsumer, broadcaster, err := initKafkaConsumer(cfg, transformer, wsServer.Node(), logger)
+	// Initialize metrics shared by all Kafka producers
+	producerMetrics := producer.NewMetrics()
+	if err := producerMetrics.Register(); err != nil {
+		logger.Warn("failed to register kafka producer metrics", "error", err)
+		producerMetrics = nil
+	}
+
+	// Decide what happens to payloads of assets and symbols without conversion rules
+	unknownPolicy, err := service.ParseUnknownPolicy(cfg.Transformer.UnknownPolicy)
+	if err != nil {
+		logger.Error("invalid transformer configuration", "error", err)
+		os.Exit(1)
+	}
+	transformer.SetUnknownPolicy(unknownPolicy)
+
+	var quarantineProducer *producer.KafkaWriterProducer
+	if unknownPolicy == service.UnknownQuarantine {
+		if cfg.Transformer.QuarantineTopic == "" {
+			logger.Error("transformer.quarantine_topic is required by the quarantine policy")
+			os.Exit(1)
+		}
+		quarantineProducer, err = initProducer(cfg, cfg.Transformer.QuarantineTopic, true, producerMetrics, logManager.Module(logging.ModuleKafka))
+		if err != nil {
+			logger.Error("failed to initialize quarantine producer", "error", err)
+			os.Exit(1)
+		}
+		transformer.SetQuarantine(quarantineProducer)
+	}
+
+	kafkaConsumer, broadcaster, err := initKafkaConsumer(cfg, policies, transformer, wsServer.Node(), logManager.Module(logging.ModuleKafka))
 	if err != nil {
 		logger.Error("failed to initialize Kafka consumer", "error", err)
 		os.Exit(1)
 	}
 
-	// Set the broadcaster on the WebSocket server for subscription tracking
+	// Count publications dropped past the TTL of their channel policy
+	expiryMetrics := policy.NewExpiryMetrics()
+	if err := expiryMetrics.Register(); err != nil {
+		logger.Warn("failed to register publication expiry metrics", "error", err)
+	} else {
+		broadcaster.SetExpiryMetrics(expiryMetrics)
+		wsServer.SetExpiryMetrics(expiryMetrics)
+	}
+
+	// Forward messages of topics without a route, e.g. discovered by the topic pattern, to the dead-letter topic
+	var deadLetterProducer *producer.KafkaWriterProducer
+	if cfg.Kafka.DeadLetterTopic != "" {
+		deadLetterProducer, err = initProducer(cfg, cfg.Kafka.DeadLetterTopic, true, producerMetrics, logManager.Module(logging.ModuleKafka))
+		if err != nil {
+			logger.Error("failed to initialize dead-letter producer", "error", err)
+			os.Exit(1)
+		}
+		broadcaster.SetDeadLetter(deadLetterProducer)
+	}
+
+	// Downgrade users over their daily delivery quota to conflated low-frequency delivery
+	quotaCtx, quotaCancel := context.WithCancel(context.Background())
+	defer quotaCancel()
+	quota := cfg.Kafka.UserQuota
+	quotaLimits := kafka.QuotaLimits{
+		MessagesPerDay: quota.MessagesPerDay,
+		BytesPerDay:    quota.BytesPerDay,
+		DowngradedRate: quota.DowngradedRate,
+	}
+	if quotaLimits.Enabled() {
+		quotas := kafka.NewQuotas(quotaLimits, cacheStore, logManager.Module(logging.ModuleKafka))
+		quotaMetrics := kafka.NewQuotaMetrics()
+		if err := quotaMetrics.Register(); err != nil {
+			logger.Warn("failed to register quota metrics", "error", err)
+		} else {
+			quotas.SetMetrics(quotaMetrics)
+		}
+		broadcaster.SetQuotas(quotas)
+		channel.RegisterUserChannel(kafka.QuotaChannelType)
+
+		flushInterval := 30 * time.Second
+		if quota.FlushIntervalSeconds > 0 {
+			flushInterval = time.Duration(quota.FlushIntervalSeconds) * time.Second
+		}
+		quotas.Start(quotaCtx, flushInterval)
+	}
+
+	// Set the broadcaster on the WebSocket server for subscription tracking, and its throttle for pong stats
 	wsServer.SetBroadcaster(broadcaster)
+	wsServer.SetThrottle(broadcaster.Throttle())
+
+	// Channel policies exempting a connection profile lift their rates for users connected in its lane
+	broadcaster.SetClientTypeChecker(wsServer)
+
+	wsServer.SetFeatureFlags(flags)
+	broadcaster.SetFeatureFlags(flags)
+
+	// Sign publications of partner channels so partners can verify their integrity
+	if cfg.Signing.Enabled {
+		signer, err := initSigner(cfg)
+		if err != nil {
+			logger.Error("failed to initialize publication signing", "error", err)
+			os.Exit(1)
+		}
+		broadcaster.SetSigner(signer)
+		logger.Info("publication signing enabled",
+			"algorithm", cfg.Signing.Algorithm,
+			"key_id", cfg.Signing.KeyID,
+			"channels", cfg.Signing.Channels)
+	}
+
+	// Serve snapshots of channels this replica never published from the last-value cache
+	if cfg.Cache.LastValueTTLSeconds > 0 {
+		lastValueStore, err := initLastValueStore(cfg, cacheStore, logger)
+		if err != nil {
+			logger.Error("invalid cache compression configuration", "error", err)
+			os.Exit(1)
+		}
+		lastValues := cache.NewLastValues(lastValueStore, time.Duration(cfg.Cache.LastValueTTLSeconds)*time.Second)
+		broadcaster.SetLastValues(lastValues)
+		wsServer.SetLastValues(lastValues)
+	}
+
+	// Stop delivering to users whose futures entitlement was revoked mid-session
+	if cfg.CoinCfxAdapter.Entitlement.Enabled {
+		entitlementTTL := time.Duration(cfg.CoinCfxAdapter.Entitlement.CacheTTLSeconds) * time.Second
+		entitlements := service.NewHTTPEntitlementClient(cfg.CoinCfxAdapter.Host, entitlementTTL, logManager.Module(logging.ModuleService))
+		wsServer.SetEntitlementProvider(entitlements)
+		broadcaster.SetEntitlementChecker(entitlements)
+	}
+
+	// Periodically reclaim broadcaster subscriptions of clients that are no longer connected
+	janitorCtx, janitorCancel := context.WithCancel(context.Background())
+	defer janitorCancel()
+	if cfg.WebSocketServer.JanitorIntervalMs > 0 {
+		wsServer.StartJanitor(janitorCtx, time.Duration(cfg.WebSocketServer.JanitorIntervalMs)*time.Millisecond)
+	}
+
+	// Soak tests replace the Kafka consumer with generated messages
+	var upstream server.UpstreamSource = kafkaConsumer
+	var generator *kafka.SyntheticGenerator
+	if cfg.Kafka.Synthetic.Enabled {
+		generator, err = initSyntheticGenerator(cfg, broadcaster, logManager.Module(logging.ModuleKafka))
+		if err != nil {
+			logger.Error("failed to initialize synthetic kafka generator", "error", err)
+			os.Exit(1)
+		}
+		upstream = generator
+	}
+
+	// Report the CFX data feed in /readyz and metrics, flagging it and forcing a reconnect when messages stop arriving
+	wsServer.SetUpstream(upstream, time.Duration(cfg.Kafka.StallAfterSeconds)*time.Second)
+	wsServer.SetUpstreamReconnect(time.Duration(cfg.Kafka.ReconnectAfterSeconds) * time.Second)
+	upstreamCtx, upstreamCancel := context.WithCancel(context.Background())
+	defer upstreamCancel()
+	wsServer.StartUpstreamMonitor(upstreamCtx, 10*time.Second)
+
+	// Conflate channels to their overload rate while the consumer falls behind its delay budget
+	if overload := cfg.WebSocketServer.Overload; generator == nil && overload.DelayBudgetMs > 0 {
+		wsServer.SetOverload(kafkaConsumer, server.OverloadLimits{
+			DelayBudget:  time.Duration(overload.DelayBudgetMs) * time.Millisecond,
+			RecoverBelow: time.Duration(overload.RecoverBelowMs) * time.Millisecond,
+		})
+		checkInterval := time.Second
+		if overload.CheckIntervalMs > 0 {
+			checkInterval = time.Duration(overload.CheckIntervalMs) * time.Millisecond
+		}
+		wsServer.StartOverloadMonitor(upstreamCtx, checkInterval)
+	}
+
+	// Score connection responsiveness and disconnect clients whose writes stall
+	if liveness := cfg.WebSocketServer.Liveness; liveness.Enabled {
+		wsServer.SetLiveness(server.LivenessLimits{
+			SlowWrite:     time.Duration(liveness.SlowWriteMs) * time.Millisecond,
+			MaxWriteStall: time.Duration(liveness.MaxWriteStallMs) * time.Millisecond,
+			CheckInterval: time.Duration(liveness.CheckIntervalMs) * time.Millisecond,
+		})
+		wsServer.StartLivenessMonitor(upstreamCtx)
+	}
+
+	// Hold readiness until the consumer joined its group, so a rolling deploy waits for each rebalance
+	if cfg.Kafka.Handoff.Enabled && generator == nil {
+		wsServer.SetJoinGate(kafkaConsumer)
+	}
+
+	// Scheduled announcements are replicated to every node and delivered by each to its own clients
+	announcements := announcement.NewScheduler(wsServer, wsServer.Node(), logManager.Module(logging.ModuleHandler))
+	wsServer.SetAnnouncements(announcements)
+	announcementsCtx, announcementsCancel := context.WithCancel(context.Background())
+	defer announcementsCancel()
+	announcements.Start(announcementsCtx, time.Second)
+
+	// Critical publications are tracked on every node until acknowledged and redelivered on reconnect
+	var receipts *receipt.Tracker
+	if cfg.WebSocketServer.Receipts.Enabled {
+		receipts = receipt.NewTracker(wsServer.Node(),
+			time.Duration(cfg.WebSocketServer.Receipts.RetentionSeconds)*time.Second,
+			cfg.WebSocketServer.Receipts.MaxPerUser,
+			logManager.Module(logging.ModuleHandler))
+		wsServer.SetReceipts(receipts)
+		receiptsCtx, receiptsCancel := context.WithCancel(context.Background())
+		defer receiptsCancel()
+		receipts.Start(receiptsCtx, time.Minute)
+	}
+
+	// Count publications per channel type; full channel names would explode label cardinality
+	if metrics != nil {
+		broadcaster.AddInterceptor(func(ch string, payload []byte) ([]byte, bool) {
+			metrics.RecordPublication(cfg.Centrifuge.NodeName, channel.ChannelType(ch))
+			return payload, true
+		})
+	}
+
+	// Publish connection lifecycle events to Kafka for analytics
+	var eventProducer *producer.KafkaWriterProducer
+	if cfg.Kafka.ConnectionEvents.Enabled {
+		eventProducer, err = initEventProducer(cfg, producerMetrics, logManager.Module(logging.ModuleKafka))
+		if err != nil {
+			logger.Error("failed to initialize connection event producer", "error", err)
+			os.Exit(1)
+		}
+		wsServer.SetEventPublisher(eventProducer)
+	}
+
+	// Tell downstream services (presence, push suppression) when a user starts or stops watching
+	var webhooks *webhook.Notifier
+	if cfg.Webhooks.Enabled {
+		webhooks, err = initWebhooks(cfg, logManager.Module(logging.ModuleHandler))
+		if err != nil {
+			logger.Error("failed to initialize webhooks", "error", err)
+			os.Exit(1)
+		}
+		webhooks.Start(context.Background())
+		wsServer.SetPresenceListener(webhooks)
+	}
 
-	// Start Kafka consumer
+	// Singleton background jobs run on the elected leader only and move to another replica on failover
+	leaders, err := initLeader(cfg, wsServer.Instance().InstanceID, logManager.Module(logging.ModuleService))
+	if err != nil {
+		logger.Error("failed to initialize leader election", "error", err)
+		os.Exit(1)
+	}
+	leaderCtx, leaderCancel := context.WithCancel(context.Background())
+	defer leaderCancel()
+	leaders.Start(leaderCtx)
+
+	// Start Kafka consumer, or the synthetic generator standing in for it. The handoff cancels consumerCtx,
+	// so a consumer still held back by the startup gate never joins the group it just handed over.
+	generatorCtx, generatorCancel := context.WithCancel(context.Background())
+	defer generatorCancel()
+	consumerCtx, consumerCancel := context.WithCancel(context.Background())
+	defer consumerCancel()
 	go func() {
-		if err := kafkaConsumer.Start(context.Background()); err != nil && err != context.Canceled {
+		if generator != nil {
+			_ = generator.Start(generatorCtx)
+			return
+		}
+		waitForRate(consumerCtx, cfg, currencyService, logger)
+		if consumerCtx.Err() != nil {
+			logger.Info("shutdown began before the kafka consumer started, not starting it")
+			return
+		}
+		if err := kafkaConsumer.Start(consumerCtx); err != nil && !errors.Is(err, context.Canceled) {
 			logger.Error("Kafka consumer error", "error", err)
 		}
 	}()
@@ -62,6 +384,9 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Push the exchange rate used for conversion to the public rate channel on every refresh
+	currencyService.AddRefreshListener(wsServer.PublishRate)
+
 	// Setup HTTP routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -69,26 +394,106 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		fmt.Fprintf(w, `{"status":"ok","connections":%d}`, wsServer.GetClientCount())
 	})
-	mux.HandleFunc("/connection", wsServer.ServeHTTP)
-	wsServer.SetupMetricsHandler(mux, "/metrics")
+
+	// Resolve the real client IP from X-Forwarded-For when behind a trusted load balancer
+	clientIPResolver, err := clientip.NewResolver(cfg.WebSocketServer.TrustedProxies)
+	if err != nil {
+		logger.Error("invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+	mux.Handle("/readyz", wsServer.ReadyHandler())
+	mux.Handle("/version", version.Handler())
+
+	// Make the upgrade request's JWT (header, query param, subprotocol or cookie) available to the connect handler
+	authMiddleware := auth.NewMiddleware(logManager.Module(logging.ModuleHandler))
+	if cookieAuth := cfg.WebSocketServer.CookieAuth; cookieAuth.Enabled {
+		authMiddleware.SetCookieAuth(auth.CookieConfig{
+			Name:            cookieAuth.Name,
+			RequireSecure:   cookieAuth.RequireSecure,
+			RequireSameSite: cookieAuth.RequireSameSite,
+			AllowedOrigins:  cookieAuth.AllowedOrigins,
+		})
+		if len(cookieAuth.AllowedOrigins) == 0 {
+			logger.Warn("cookie auth enabled without allowed origins, every cookie will be rejected")
+		}
+		logger.Info("cookie auth enabled", "cookie", cookieAuth.Name, "allowed_origins", cookieAuth.AllowedOrigins)
+	}
+	mux.Handle("/connection", clientIPResolver.Wrap(wsServer.LoadSheddingMiddleware(authMiddleware.Wrap(wsServer))))
+
+	// Snapshots are served from channel history or the last-value cache, so they need one of them enabled
+	snapshots := cfg.Centrifuge.HistorySize > 0 || cfg.Cache.LastValueTTLSeconds > 0
+	if cfg.WebSocketServer.SubscribeSnapshot {
+		if snapshots {
+			wsServer.SetSubscribeSnapshot(true)
+		} else {
+			logger.Warn("subscribe_snapshot ignored, centrifuge.history_size and cache.last_value_ttl_seconds are 0")
+		}
+	}
+
+	if snapshots {
+		mux.Handle(server.SnapshotPath, wsServer.SnapshotHandler())
+		logger.Info("snapshot endpoint available", "path", server.SnapshotPath)
+	} else {
+		logger.Info("snapshot endpoint disabled, centrifuge.history_size and cache.last_value_ttl_seconds are 0")
+	}
+
+	// Keep /metrics off the public listener when the admin listener serves it
+	if !cfg.Admin.Enabled || !cfg.Admin.ServeMetrics {
+		wsServer.SetupMetricsHandler(mux, "/metrics")
+	}
 
 	// Create HTTP server (accessible for graceful shutdown)
 	httpServer := &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.WebSocketServer.Port),
+		Addr:         listenAddr(cfg.WebSocketServer.BindHost, cfg.WebSocketServer.Port),
 		Handler:      mux,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	wsServer.ApplyHandshakeLimits(httpServer)
+
+	// Reload TLS certificates from disk on rotation without dropping existing connections
+	tlsWatchCtx, tlsWatchCancel := context.WithCancel(context.Background())
+	defer tlsWatchCancel()
+	tlsReloadInterval := time.Duration(cfg.WebSocketServer.TLSReloadIntervalMs) * time.Millisecond
+
+	if err := configureTLS(tlsWatchCtx, httpServer, cfg.WebSocketServer.TLSCertPath, cfg.WebSocketServer.TLSKeyPath, tlsReloadInterval, logger); err != nil {
+		logger.Error("failed to configure TLS for HTTP server", "error", err)
+		os.Exit(1)
+	}
 
 	// Start HTTP server in background
 	go func() {
-		logger.Info("HTTP server listening", "port", cfg.WebSocketServer.Port)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("HTTP server listening",
+			"addr", httpServer.Addr,
+			"tls", httpServer.TLSConfig != nil)
+		if err := serve(httpServer); err != nil && err != http.ErrServerClosed {
 			logger.Error("HTTP server error", "error", err)
 		}
 	}()
 
+	// Start internal admin server (pprof, expvar, connection dump) on a separate port
+	var adminServer *http.Server
+	if cfg.Admin.Enabled {
+		adminServer, err = initAdminServer(cfg, wsServer, kafkaConsumer, broadcaster, flags, announcements, receipts, leaders, logger)
+		if err != nil {
+			logger.Error("invalid admin server configuration", "error", err)
+			os.Exit(1)
+		}
+		if err := configureTLS(tlsWatchCtx, adminServer, cfg.Admin.TLSCertPath, cfg.Admin.TLSKeyPath, tlsReloadInterval, logger); err != nil {
+			logger.Error("failed to configure TLS for admin server", "error", err)
+			os.Exit(1)
+		}
+		go func() {
+			logger.Info("admin server listening",
+				"addr", adminServer.Addr,
+				"tls", adminServer.TLSConfig != nil)
+			if err := serve(adminServer); err != nil && err != http.ErrServerClosed {
+				logger.Error("admin server error", "error", err)
+			}
+		}()
+	}
+
 	logger.Info("service running. Press Ctrl+C to exit.")
 
 	// Wait for shutdown signal
@@ -98,6 +503,13 @@ func main() {
 	sig := <-sigChan
 	logger.Info("received shutdown signal", "signal", sig)
 
+	// Leave the consumer group before draining, so the other replicas take over the partitions
+	// instead of both broadcasting while the connections drain
+	handedOff := cfg.Kafka.Handoff.Enabled && kafkaConsumer != nil
+	if handedOff {
+		handOff(wsServer, kafkaConsumer, consumerCancel, time.Duration(cfg.Kafka.Handoff.DrainSeconds)*time.Second, sigChan, logger)
+	}
+
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Duration(cfg.WebSocketServer.ShutdownTimeoutMs)*time.Millisecond)
 	defer shutdownCancel()
 
@@ -106,15 +518,48 @@ func main() {
 		logger.Error("error shutting down HTTP server", "error", err)
 	}
 
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("error shutting down admin server", "error", err)
+		}
+	}
+
 	// Shutdown Centrifuge WebSocket server
 	if err := wsServer.Shutdown(shutdownCtx); err != nil {
 		logger.Error("error shutting down WebSocket server", "error", err)
 	}
 
+	// Deliver the offline webhooks of clients disconnected by the shutdown
+	if webhooks != nil {
+		if err := webhooks.Close(shutdownCtx); err != nil {
+			logger.Error("error flushing webhooks", "error", err)
+		}
+	}
+
+	// Flush connection events emitted during client disconnects
+	if eventProducer != nil {
+		if err := eventProducer.Close(); err != nil {
+			logger.Error("error closing connection event producer", "error", err)
+		}
+	}
+
+	if quarantineProducer != nil {
+		if err := quarantineProducer.Close(); err != nil {
+			logger.Error("error closing quarantine producer", "error", err)
+		}
+	}
+
+	if deadLetterProducer != nil {
+		if err := deadLetterProducer.Close(); err != nil {
+			logger.Error("error closing dead-letter producer", "error", err)
+		}
+	}
+
 	// Stop currency service
 	currencyService.Stop()
 
-	if kafkaConsumer != nil {
+	if kafkaConsumer != nil && !handedOff {
+		consumerCancel()
 		if err := kafkaConsumer.Close(); err != nil {
 			logger.Error("error closing Kafka consumer", "error", err)
 		}
@@ -123,47 +568,358 @@ func main() {
 	logger.Info("shutdown complete")
 }
 
+// handOff fails readiness, stops consuming and broadcasting, and keeps the connections open for drain or
+// until a second signal. stopConsumer cancels the consumer's start, which may still be waiting for a rate.
+func handOff(wsServer *server.CentrifugeServer, consumer kafka.ManagedConsumer, stopConsumer context.CancelFunc, drain time.Duration, sigChan <-chan os.Signal, logger *slog.Logger) {
+	wsServer.Drain()
+	stopConsumer()
+	if err := consumer.Close(); err != nil {
+		logger.Error("error closing Kafka consumer", "error", err)
+	}
+
+	logger.Info("handed consumer group over, draining", "drain", drain.String())
+	timer := time.NewTimer(drain)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case sig := <-sigChan:
+		logger.Info("received second shutdown signal, skipping drain", "signal", sig)
+	}
+}
+
+// initRateProvider builds the exchange rate failover chain: coin-data, the secondary endpoint, then the emergency rate
+func initRateProvider(cfg *config.Configuration, logger *slog.Logger) service.RateProvider {
+	sources := []service.RateSource{
+		{Name: "coin_data", Provider: service.NewHTTPRateProvider(cfg.CoinData.Host, logger)},
+	}
+	if cfg.CoinData.SecondaryHost != "" {
+		sources = append(sources, service.RateSource{
+			Name:     "secondary",
+			Provider: service.NewHTTPRateProvider(cfg.CoinData.SecondaryHost, logger),
+		})
+	}
+	if cfg.CoinData.EmergencyRate > 0 {
+		sources = append(sources, service.RateSource{
+			Name:     "emergency",
+			Provider: service.NewStaticRateProvider(cfg.CoinData.EmergencyRate),
+		})
+	}
+
+	provider := service.NewFailoverRateProvider(sources, logger)
+	rateMetrics := service.NewRateMetrics()
+	if err := rateMetrics.Register(); err != nil {
+		logger.Warn("failed to register exchange rate metrics", "error", err)
+	} else {
+		provider.SetMetrics(rateMetrics)
+	}
+	return provider
+}
+
 // initTransformer creates the currency transformer with the coin-data rate provider.
-func initTransformer(cfg *config.Configuration, logger *slog.Logger) (service.TransformerInterface, *service.CachedCurrencyService) {
-	rateProvider := service.NewHTTPRateProvider(cfg.CoinData.Host, logger)
+func initTransformer(cfg *config.Configuration, logManager *logging.Manager) (*service.Transformer, *service.CachedCurrencyService) {
+	serviceLogger := logManager.Module(logging.ModuleService)
+	rateProvider := initRateProvider(cfg, serviceLogger)
 	currencyService := service.NewCachedCurrencyService(
 		rateProvider,
 		time.Duration(cfg.CoinData.CacheTTLSeconds)*time.Second,
-		logger,
+		serviceLogger,
 	)
-	return service.NewTransformer(currencyService, cfg.CoinData.CfxUsdtAsset, logger), currencyService
+	transformer := service.NewTransformer(currencyService, cfg.CoinData.CfxUsdtAsset, logManager.Module(logging.ModuleTransformer))
+	if len(cfg.Transformer.Convert) > 0 || len(cfg.Transformer.SymbolOverrides) > 0 {
+		transformer.SetConversionRules(service.NewConversionRules(cfg.Transformer.Convert, cfg.Transformer.SymbolOverrides))
+	}
+	transformer.SetEmbedding(cfg.Transformer.EmbedFxRate, cfg.Transformer.EmbedOriginalValues)
+
+	transformerMetrics := service.NewTransformerMetrics()
+	if err := transformerMetrics.Register(); err != nil {
+		serviceLogger.Warn("failed to register transformer metrics", "error", err)
+	} else {
+		transformer.SetMetrics(transformerMetrics)
+	}
+	return transformer, currencyService
+}
+
+// waitForRate holds Kafka consumption until an exchange rate is cached, coin_data.startup_gate_seconds
+// elapse or ctx is done; messages consumed without a rate then follow the transformer's stale-rate fallback.
+func waitForRate(ctx context.Context, cfg *config.Configuration, currencyService *service.CachedCurrencyService, logger *slog.Logger) {
+	if cfg.CoinData.StartupGateSeconds <= 0 {
+		return
+	}
+
+	gate := time.Duration(cfg.CoinData.StartupGateSeconds) * time.Second
+	gateCtx, cancel := context.WithTimeout(ctx, gate)
+	defer cancel()
+
+	start := time.Now()
+	if !currencyService.WaitForRate(gateCtx) {
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("starting kafka consumer without an exchange rate, IDR conversions fail until one is fetched",
+			"startup_gate", gate.String())
+		return
+	}
+	if waited := time.Since(start); waited > time.Second {
+		logger.Info("exchange rate fetched, starting kafka consumer", "waited", waited.String())
+	}
 }
 
 // initCentrifugeServer creates the Centrifuge WebSocket server.
-func initCentrifugeServer(cfg *config.Configuration, logger *slog.Logger) *server.CentrifugeServer {
-	wsServer := server.NewCentrifugeServer(&cfg.Centrifuge, logger)
+func initCentrifugeServer(cfg *config.Configuration, policies *policy.Set, cacheStore cache.Store, logManager *logging.Manager) (*server.CentrifugeServer, error) {
+	wsServer := server.NewCentrifugeServer(&cfg.Centrifuge, logManager.Module(logging.ModuleHandler))
+	if err := wsServer.SetConnectionProfiles(connectionProfiles(cfg)); err != nil {
+		return nil, err
+	}
+	wsServer.SetChannelPolicies(policies)
+	wsServer.SetAuditLogger(logManager.Module(logging.ModuleAudit))
+	serviceLogger := logManager.Module(logging.ModuleService)
 	wsServer.SetMaxConnectionsPerUser(cfg.WebSocketServer.MaxConnectionsPerUser)
+	limitPolicy, err := server.ParseConnectionLimitPolicy(cfg.WebSocketServer.ConnectionLimitPolicy)
+	if err != nil {
+		return nil, err
+	}
+	wsServer.SetConnectionLimitPolicy(limitPolicy)
+	wsServer.SetMaxConnections(cfg.WebSocketServer.MaxConnections, time.Duration(cfg.WebSocketServer.ShedRetryAfterSeconds)*time.Second)
+	wsServer.SetSubChannelsEnabled(cfg.WebSocketServer.SubChannelsEnabled)
+	wsServer.SetClientSessionIDs(cfg.WebSocketServer.ClientSessionIDs)
+	if err := wsServer.SetSendDedupe(cfg.WebSocketServer.SendDedupe); err != nil {
+		return nil, err
+	}
+	wsServer.SetHandshakeLimits(server.HandshakeLimits{
+		ReadHeaderTimeout: time.Duration(cfg.WebSocketServer.ReadHeaderTimeoutMs) * time.Millisecond,
+		HandshakeTimeout:  time.Duration(cfg.WebSocketServer.HandshakeTimeoutMs) * time.Millisecond,
+		MaxHeaderBytes:    cfg.WebSocketServer.MaxHeaderBytes,
+	})
+	wsServer.SetFanOutWorkers(cfg.WebSocketServer.FanOutWorkers)
+	wsServer.SetInstanceMetadata(cfg.App.PodName, cfg.App.Region)
 
 	cfxCacheTTL := time.Duration(cfg.CoinCfxAdapter.CacheTTLSeconds) * time.Second
-	cfxUserMappingClient := service.NewHTTPCfxUserMappingClient(cfg.CoinCfxAdapter.Host, cfxCacheTTL, logger)
+	cfxUserMappingClient := service.NewHTTPCfxUserMappingClient(cfg.CoinCfxAdapter.Host, cfxCacheTTL, serviceLogger)
+	cfxUserMappingClient.SetCache(cacheStore)
 	wsServer.SetCfxUserMapper(cfxUserMappingClient)
+	if len(cfg.App.RegionEndpoints) > 0 {
+		wsServer.SetRegionAffinity(cfxUserMappingClient, cfg.App.RegionEndpoints)
+	}
 
 	prefCacheTTL := time.Duration(cfg.CoinSetting.CacheTTLSeconds) * time.Second
-	userPrefClient := service.NewHTTPUserPreferenceClient(cfg.CoinSetting.Host, prefCacheTTL, logger)
+	userPrefClient := service.NewHTTPUserPreferenceClient(cfg.CoinSetting.Host, prefCacheTTL, serviceLogger)
+	userPrefClient.SetCache(cacheStore)
 	wsServer.SetUserPreferenceProvider(userPrefClient)
 
-	return wsServer
+	return wsServer, nil
+}
+
+// initCacheStore creates the store backing the mapping, preference and last-value caches.
+func initCacheStore(cfg *config.Configuration) (cache.Store, error) {
+	backend, err := cache.ParseBackend(cfg.Cache.Backend)
+	if err != nil {
+		return nil, err
+	}
+
+	if backend == cache.BackendMemory {
+		return cache.NewMemoryStore(), nil
+	}
+	return cache.NewRedisStore(cache.RedisConfig{
+		Address:  cfg.Cache.Redis.Address,
+		Password: cfg.Cache.Redis.Password,
+		DB:       cfg.Cache.Redis.DB,
+		Prefix:   cfg.Cache.Redis.Prefix,
+		Timeout:  time.Duration(cfg.Cache.Redis.TimeoutMs) * time.Millisecond,
+	})
+}
+
+// initSigner creates the publication signer from the configured algorithm and key.
+func initSigner(cfg *config.Configuration) (*signing.PublicationSigner, error) {
+	if len(cfg.Signing.Channels) == 0 {
+		return nil, fmt.Errorf("signing.channels cannot be empty")
+	}
+
+	algorithm, err := signing.ParseAlgorithm(cfg.Signing.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var signer signing.Signer
+	switch algorithm {
+	case signing.AlgorithmHMACSHA256:
+		signer, err = signing.NewHMACSigner(cfg.Signing.KeyID, []byte(cfg.Signing.HMACSecret))
+		if err != nil {
+			return nil, err
+		}
+	case signing.AlgorithmEd25519:
+		key, err := signing.LoadEd25519PrivateKey(cfg.Signing.Ed25519KeyPath)
+		if err != nil {
+			return nil, err
+		}
+		signer = signing.NewEd25519Signer(cfg.Signing.KeyID, key)
+	}
+	return signing.NewPublicationSigner(signer, cfg.Signing.Channels), nil
+}
+
+// initLastValueStore wraps the cache store to compress large last values when a codec is configured.
+func initLastValueStore(cfg *config.Configuration, cacheStore cache.Store, logger *slog.Logger) (cache.Store, error) {
+	codec, err := cache.ParseCodec(cfg.Cache.Compression.Codec)
+	if err != nil || codec == cache.CodecNone {
+		return cacheStore, err
+	}
+
+	metrics := cache.NewCompressionMetrics()
+	if err := metrics.Register(); err != nil {
+		logger.Warn("failed to register cache compression metrics", "error", err)
+		metrics = nil
+	}
+	return cache.NewCompressedStore(cacheStore, codec, cfg.Cache.Compression.ThresholdBytes, metrics)
+}
+
+// connectionProfiles builds the default and scoped WebSocket connection profiles from configuration.
+func connectionProfiles(cfg *config.Configuration) (server.ConnectionProfile, []server.ConnectionProfile) {
+	ws := cfg.WebSocketServer
+	def := server.ConnectionProfile{
+		Name:             "default",
+		ReadBufferSize:   ws.ReadBufferSize,
+		WriteBufferSize:  ws.WriteBufferSize,
+		MessageSizeLimit: ws.MessageSizeLimit,
+		WriteTimeout:     time.Duration(ws.WriteTimeoutMs) * time.Millisecond,
+		KeepaliveMode:    ws.KeepaliveMode,
+		PingInterval:     time.Duration(ws.PingIntervalMs) * time.Millisecond,
+		PongTimeout:      time.Duration(ws.PingTimeoutMs) * time.Millisecond,
+
+		WriteDelay:         time.Duration(ws.WriteDelayMs) * time.Millisecond,
+		MaxMessagesInFrame: ws.MaxMessagesInFrame,
+	}
+
+	profiles := make([]server.ConnectionProfile, 0, len(ws.ConnectionProfiles))
+	for _, p := range ws.ConnectionProfiles {
+		profile := server.ConnectionProfile{
+			Name:             p.Name,
+			Scope:            p.Scope,
+			ReadBufferSize:   p.ReadBufferSize,
+			WriteBufferSize:  p.WriteBufferSize,
+			MessageSizeLimit: p.MessageSizeLimit,
+			WriteTimeout:     time.Duration(p.WriteTimeoutMs) * time.Millisecond,
+			KeepaliveMode:    def.KeepaliveMode,
+			PingInterval:     def.PingInterval,
+			PongTimeout:      def.PongTimeout,
+
+			QueueInitialCap:    p.QueueInitialCap,
+			WriteDelay:         time.Duration(p.WriteDelayMs) * time.Millisecond,
+			MaxMessagesInFrame: p.MaxMessagesInFrame,
+			LowLatency:         p.LowLatency,
+		}
+
+		// Profiles keep the default keepalive unless they override it
+		if p.KeepaliveMode != "" {
+			profile.KeepaliveMode = p.KeepaliveMode
+		}
+		if p.PingIntervalMs > 0 {
+			profile.PingInterval = time.Duration(p.PingIntervalMs) * time.Millisecond
+		}
+		if p.PingTimeoutMs > 0 {
+			profile.PongTimeout = time.Duration(p.PingTimeoutMs) * time.Millisecond
+		}
+		profiles = append(profiles, profile)
+	}
+	return def, profiles
+}
+
+// channelPolicies builds the channel policies from configuration.
+func channelPolicies(cfg *config.Configuration) (*policy.Set, error) {
+	policies := make([]policy.Policy, 0, len(cfg.WebSocketServer.ChannelPolicies))
+	for _, p := range cfg.WebSocketServer.ChannelPolicies {
+		policies = append(policies, policy.Policy{
+			Pattern:      p.Pattern,
+			Scopes:       p.Scopes,
+			ClientTypes:  p.ClientTypes,
+			MaxRate:      p.MaxRate,
+			Conflate:     p.Conflate,
+			TTL:          time.Duration(p.TTLSeconds) * time.Second,
+			OverloadRate: p.OverloadMaxRate,
+
+			ExemptClientTypes: p.ExemptClientTypes,
+		})
+	}
+	return policy.NewSet(policies)
 }
 
 // initKafkaConsumer creates the Broadcaster and Kafka consumer, wiring the broadcaster to the Centrifuge node.
-func initKafkaConsumer(cfg *config.Configuration, transformer service.TransformerInterface, node interface{}, logger *slog.Logger) (*kafka.KafkaReaderConsumer, *kafka.Broadcaster, error) {
+func initKafkaConsumer(cfg *config.Configuration, policies *policy.Set, transformer service.TransformerInterface, node interface{}, logger *slog.Logger) (kafka.ManagedConsumer, *kafka.Broadcaster, error) {
 	// Create the Kafka broadcaster with the Centrifuge node
 	broadcaster := kafka.NewBroadcaster(node.(*centrifuge.Node), transformer, logger)
+	broadcaster.SetSubChannels(cfg.WebSocketServer.SubChannelsEnabled)
+	broadcaster.SetHistory(cfg.Centrifuge.HistorySize, time.Duration(cfg.Centrifuge.HistoryTTL)*time.Second)
+
+	broadcaster.SetChannelPolicies(policies)
+
+	for _, route := range cfg.Kafka.Routes {
+		errorPolicy, err := kafka.ParseRouteErrorPolicy(route.ErrorPolicy)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := broadcaster.SetRouteErrorPolicy(route.Topic, errorPolicy); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	routeMetrics := kafka.NewRouteMetrics()
+	if err := routeMetrics.Register(); err != nil {
+		logger.Warn("failed to register kafka route metrics", "error", err)
+	} else {
+		broadcaster.SetRouteMetrics(routeMetrics)
+	}
+
+	// Measure how far message timestamps lag and flag delayed data to frontends
+	broadcaster.SetStaleThreshold(time.Duration(cfg.Kafka.StaleThresholdMs) * time.Millisecond)
+	skewMetrics := kafka.NewSkewMetrics()
+	if err := skewMetrics.Register(); err != nil {
+		logger.Warn("failed to register kafka skew metrics", "error", err)
+	} else {
+		broadcaster.SetSkewMetrics(skewMetrics)
+	}
+
+	keyDecoder, err := kafka.NewKeyDecoder(cfg.Kafka.KeyFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+	broadcaster.SetKeyDecoder(keyDecoder)
+	broadcaster.SetTransformTimeout(time.Duration(cfg.Transformer.TimeoutMs) * time.Millisecond)
 
 	kafkaConfig := &kafka.ConsumerConfig{
 		Brokers:           cfg.Kafka.Brokers,
 		GroupID:           cfg.Kafka.ConsumerGroup,
 		Topics:            cfg.Kafka.Topics,
+		TopicPattern:      cfg.Kafka.TopicPattern,
+		TopicRefresh:      time.Duration(cfg.Kafka.TopicRefreshSeconds) * time.Second,
 		InitialOffset:     cfg.Kafka.InitialOffset,
 		SessionTimeout:    time.Duration(cfg.Kafka.SessionTimeout) * time.Millisecond,
 		HeartbeatInterval: time.Duration(cfg.Kafka.HeartbeatInterval) * time.Millisecond,
 		Handler:           broadcaster.HandleMessage,
 		MaxMessageAge:     time.Duration(cfg.Kafka.MaxMessageAgeMs) * time.Millisecond,
+		Security:          kafkaSecurityConfig(cfg),
+
+		RestartAfterErrors: cfg.Kafka.RestartAfterErrors,
+		RestartBackoffMin:  time.Duration(cfg.Kafka.RestartBackoffMinMs) * time.Millisecond,
+		RestartBackoffMax:  time.Duration(cfg.Kafka.RestartBackoffMaxMs) * time.Millisecond,
+
+		HandlerAttempts:   cfg.Kafka.HandlerAttempts,
+		HandlerBackoffMin: time.Duration(cfg.Kafka.HandlerBackoffMinMs) * time.Millisecond,
+		HandlerBackoffMax: time.Duration(cfg.Kafka.HandlerBackoffMaxMs) * time.Millisecond,
+		GlobalErrorBudget: kafka.NewErrorBudget(
+			cfg.Kafka.ErrorBudget,
+			time.Duration(cfg.Kafka.ErrorBudgetWindowSeconds)*time.Second,
+			time.Duration(cfg.Kafka.ErrorBudgetPauseSeconds)*time.Second,
+			logger),
+	}
+
+	if cfg.Kafka.PerTopic.Enabled {
+		kafkaConfig.ErrorBudget = cfg.Kafka.PerTopic.ErrorBudget
+		kafkaConfig.ErrorBudgetWindow = time.Duration(cfg.Kafka.PerTopic.ErrorBudgetWindowSeconds) * time.Second
+		kafkaConfig.ErrorBudgetPause = time.Duration(cfg.Kafka.PerTopic.ErrorBudgetPauseSeconds) * time.Second
+
+		consumers, err := kafka.NewTopicConsumers(kafkaConfig, cfg.Kafka.PerTopic.SeparateGroups, logger)
+		if err != nil {
+			return nil, nil, err
+		}
+		return consumers, broadcaster, nil
 	}
 
 	consumer, err := kafka.NewKafkaReaderConsumer(kafkaConfig, logger)
@@ -174,24 +930,205 @@ func initKafkaConsumer(cfg *config.Configuration, transformer service.Transforme
 	return consumer, broadcaster, nil
 }
 
-// initLogger initializes the structured logger with configuration.
-func initLogger(cfg *config.Configuration) *slog.Logger {
-	var level slog.Level
-	switch cfg.App.LogLevel {
-	case "debug":
-		level = slog.LevelDebug
-	case "info":
-		level = slog.LevelInfo
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	default:
-		level = slog.LevelInfo
+// initSyntheticGenerator creates the soak-test generator feeding the broadcaster instead of Kafka.
+// It is refused in production so generated balances never reach real users.
+func initSyntheticGenerator(cfg *config.Configuration, broadcaster *kafka.Broadcaster, logger *slog.Logger) (*kafka.SyntheticGenerator, error) {
+	if cfg.App.Env == "production" {
+		return nil, fmt.Errorf("kafka.synthetic must not be enabled in production")
+	}
+
+	return kafka.NewSyntheticGenerator(broadcaster, kafka.SyntheticConfig{
+		Rate:          cfg.Kafka.Synthetic.RatePerSecond,
+		Users:         cfg.Kafka.Synthetic.Users,
+		PositionRatio: cfg.Kafka.Synthetic.PositionRatio,
+	}, logger)
+}
+
+// initWebhooks creates the notifier posting user presence webhooks
+func initWebhooks(cfg *config.Configuration, logger *slog.Logger) (*webhook.Notifier, error) {
+	return webhook.NewNotifier(webhook.Config{
+		URLs:        cfg.Webhooks.URLs,
+		Secret:      cfg.Webhooks.Secret,
+		Node:        cfg.Centrifuge.NodeName,
+		Timeout:     time.Duration(cfg.Webhooks.TimeoutMs) * time.Millisecond,
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     time.Duration(cfg.Webhooks.BackoffMs) * time.Millisecond,
+		QueueSize:   cfg.Webhooks.QueueSize,
+		Workers:     cfg.Webhooks.Workers,
+	}, logger)
+}
+
+// initEventProducer creates the Kafka producer for client connection lifecycle events.
+func initEventProducer(cfg *config.Configuration, metrics *producer.Metrics, logger *slog.Logger) (*producer.KafkaWriterProducer, error) {
+	// Connection events must never block client handlers, so they are produced asynchronously
+	return initProducer(cfg, cfg.Kafka.ConnectionEvents.Topic, true, metrics, logger)
+}
+
+// initProducer creates a Kafka producer for a topic using the shared producer and security settings.
+func initProducer(cfg *config.Configuration, topic string, async bool, metrics *producer.Metrics, logger *slog.Logger) (*producer.KafkaWriterProducer, error) {
+	p, err := producer.NewKafkaWriterProducer(&producer.Config{
+		Brokers:      cfg.Kafka.Brokers,
+		Topic:        topic,
+		BatchSize:    cfg.Kafka.Producer.BatchSize,
+		BatchBytes:   cfg.Kafka.Producer.BatchBytes,
+		BatchTimeout: time.Duration(cfg.Kafka.Producer.BatchTimeoutMs) * time.Millisecond,
+		MaxAttempts:  cfg.Kafka.Producer.MaxAttempts,
+		BackoffMin:   time.Duration(cfg.Kafka.Producer.BackoffMinMs) * time.Millisecond,
+		BackoffMax:   time.Duration(cfg.Kafka.Producer.BackoffMaxMs) * time.Millisecond,
+		RequiredAcks: cfg.Kafka.Producer.RequiredAcks,
+		Compression:  cfg.Kafka.Producer.Compression,
+		Async:        async,
+		Security:     kafkaSecurityConfig(cfg),
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	if metrics != nil {
+		p.SetMetrics(metrics)
+	}
+	return p, nil
+}
+
+// initLeader creates the leader election manager for singleton background jobs.
+func initLeader(cfg *config.Configuration, instanceID string, logger *slog.Logger) (*leader.Manager, error) {
+	mode, err := leader.ParseMode(cfg.Leader.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	elector := leader.NewStandaloneElector()
+	if mode == leader.ModeKafka {
+		groupID := cfg.Leader.GroupID
+		if groupID == "" {
+			groupID = cfg.Kafka.ConsumerGroup + "-leader"
+		}
+		elector, err = kafka.NewLeaderElector(kafka.LeaderConfig{
+			Brokers:           cfg.Kafka.Brokers,
+			Topic:             cfg.Leader.Topic,
+			GroupID:           groupID,
+			SessionTimeout:    time.Duration(cfg.Kafka.SessionTimeout) * time.Millisecond,
+			HeartbeatInterval: time.Duration(cfg.Kafka.HeartbeatInterval) * time.Millisecond,
+			Security:          kafkaSecurityConfig(cfg),
+		}, logger)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	manager := leader.NewManager(elector, mode, instanceID, logger)
+	manager.SetRestartDelay(time.Duration(cfg.Leader.TaskRestartDelayMs) * time.Millisecond)
+	logger.Info("leader election configured", "mode", mode)
+	return manager, nil
+}
+
+// kafkaSecurityConfig maps the shared Kafka TLS/SASL settings used by consumers and producers.
+func kafkaSecurityConfig(cfg *config.Configuration) kafka.SecurityConfig {
+	return kafka.SecurityConfig{
+		TLSEnabled:            cfg.Kafka.Security.TLSEnabled,
+		TLSCAPath:             cfg.Kafka.Security.TLSCAPath,
+		TLSInsecureSkipVerify: cfg.Kafka.Security.TLSInsecureSkipVerify,
+		SASLMechanism:         cfg.Kafka.Security.SASLMechanism,
+		SASLUsername:          cfg.Kafka.Security.SASLUsername,
+		SASLPassword:          cfg.Kafka.Security.SASLPassword,
+	}
+}
+
+// initAdminServer creates the internal admin HTTP server with debug endpoints.
+func initAdminServer(cfg *config.Configuration, wsServer *server.CentrifugeServer, consumer kafka.ManagedConsumer, broadcaster *kafka.Broadcaster, flags *featureflag.Service, announcements *announcement.Scheduler, receipts *receipt.Tracker, leaders *leader.Manager, logger *slog.Logger) (*http.Server, error) {
+	adminSrv := admin.NewServer(cfg.Admin.Token, logger)
+	adminSrv.Handle("/debug/connections", wsServer.ConnectionsHandler())
+	adminSrv.Handle("/debug/hub", wsServer.HubStatsHandler())
+	adminSrv.Handle("/debug/overflows", wsServer.OverflowsHandler())
+	adminSrv.Handle("/debug/liveness", wsServer.LivenessHandler())
+	adminSrv.Handle("/debug/captures", wsServer.CapturesHandler())
+	adminSrv.Handle("/debug/routing", broadcaster.RoutingHandler())
+	adminSrv.Handle("/impersonations", wsServer.ImpersonationsHandler())
+	adminSrv.Handle("/version", version.Handler())
+	adminSrv.Handle("/presence", wsServer.PresenceHandler())
+	adminSrv.Handle("/entitlements", wsServer.EntitlementsHandler())
+	adminSrv.Handle("/flags", flags.Handler())
+	publish, err := initPublishAuth(cfg, wsServer.PublishHandler(), logger)
+	if err != nil {
+		return nil, err
+	}
+	adminSrv.Handle(server.PublishPath, publish)
+	adminSrv.Handle("/announcements", announcements.Handler())
+	if receipts != nil {
+		adminSrv.Handle("/receipts", receipts.Handler())
+	}
+	adminSrv.Handle("/leader", leaders.Handler())
+	adminSrv.Handle(kafka.CheckpointPath, consumer.CheckpointHandler())
+	if topics, ok := consumer.(*kafka.TopicConsumers); ok {
+		adminSrv.Handle(kafka.TopicsPath, topics.TopicsHandler())
+	}
+	if cfg.Admin.ServeMetrics {
+		adminSrv.Handle("/metrics", wsServer.MetricsHandler())
+	}
+
+	// No write timeout so that CPU profiles and traces can run for their full duration
+	return &http.Server{
+		Addr:        listenAddr(cfg.Admin.BindHost, cfg.Admin.Port),
+		Handler:     adminSrv.Handler(),
+		ReadTimeout: 30 * time.Second,
+		IdleTimeout: 60 * time.Second,
+	}, nil
+}
+
+// initPublishAuth guards internal publish, which reaches any user channel, with the admin token and, when a signing
+// secret is configured, with signed, non-replayed requests. It fails when neither is configured.
+func initPublishAuth(cfg *config.Configuration, handler http.Handler, logger *slog.Logger) (http.Handler, error) {
+	signing := cfg.Admin.RequestSigning
+	if cfg.Admin.Token == "" && signing.Secret == "" {
+		return nil, errors.New("internal publish requires admin.token or admin.request_signing.secret")
+	}
+	if signing.Secret == "" {
+		return handler, nil
+	}
+
+	guard := auth.NewReplayGuard(time.Duration(signing.MaxSkewSeconds)*time.Second, signing.NonceCacheSize)
+	return auth.NewRequestVerifier(signing.Secret, guard, logger).Wrap(handler), nil
+}
+
+// listenAddr builds a listen address from an optional bind host and a port.
+func listenAddr(host string, port int) string {
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// configureTLS enables TLS on the server with a certificate that is reloaded when rotated on disk.
+func configureTLS(ctx context.Context, srv *http.Server, certPath, keyPath string, interval time.Duration, logger *slog.Logger) error {
+	if certPath == "" || keyPath == "" {
+		return nil
 	}
 
+	reloader, err := certs.NewReloader(certPath, keyPath, logger)
+	if err != nil {
+		return err
+	}
+
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	go reloader.Watch(ctx, interval)
+
+	srv.TLSConfig = reloader.TLSConfig()
+	return nil
+}
+
+// serve starts the HTTP server with TLS when configured.
+func serve(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		// Certificates come from TLSConfig.GetCertificate
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// initLogger initializes the structured logger and the per-module log manager with configuration.
+func initLogger(cfg *config.Configuration) (*slog.Logger, *logging.Manager) {
+	// The base handler accepts every level; the manager filters per module
 	opts := &slog.HandlerOptions{
-		Level: level,
+		Level: slog.LevelDebug,
 	}
 
 	var handler slog.Handler
@@ -201,8 +1138,45 @@ func initLogger(cfg *config.Configuration) *slog.Logger {
 		handler = slog.NewTextHandler(os.Stdout, opts)
 	}
 
-	logger := slog.New(handler)
+	logManager := logging.NewManager(handler)
+	logManager.Apply(logging.ParseLevel(cfg.App.LogLevel), cfg.Logging.Levels, logSamplingConfig(cfg))
+	logManager.SetRedaction(logRedactConfig(cfg))
+
+	logger := logManager.Logger()
 	slog.SetDefault(logger)
 
-	return logger
+	return logger, logManager
+}
+
+// logSamplingConfig maps the debug log sampling settings.
+func logSamplingConfig(cfg *config.Configuration) logging.SamplingConfig {
+	return logging.SamplingConfig{
+		Enabled:    cfg.Logging.Sampling.Enabled,
+		Initial:    cfg.Logging.Sampling.Initial,
+		Thereafter: cfg.Logging.Sampling.Thereafter,
+		Interval:   time.Duration(cfg.Logging.Sampling.IntervalMs) * time.Millisecond,
+	}
+}
+
+// featureFlags converts the feature flag configuration for the flag service.
+func featureFlags(cfg *config.Configuration) map[string]featureflag.Flag {
+	flags := make(map[string]featureflag.Flag, len(cfg.FeatureFlags))
+	for name, flag := range cfg.FeatureFlags {
+		flags[name] = featureflag.Flag{
+			Enabled:      flag.Enabled,
+			Environments: flag.Environments,
+			Users:        flag.Users,
+			Percentage:   flag.Percentage,
+		}
+	}
+	return flags
+}
+
+// logRedactConfig maps the sensitive field names scrubbed from all logs.
+func logRedactConfig(cfg *config.Configuration) logging.RedactConfig {
+	return logging.RedactConfig{
+		Fields:         cfg.Logging.RedactFields,
+		TokenFields:    cfg.Logging.TokenFields,
+		TokenPrefixLen: cfg.Logging.TokenPrefixLen,
+	}
 }
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"os"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
@@ -16,12 +19,32 @@ type (
 		Centrifuge      CentrifugeConfiguration      `mapstructure:"centrifuge"`
 		CoinCfxAdapter  CoinCfxAdapterConfiguration  `mapstructure:"coin_cfx_adapter"`
 		CoinData        CoinDataConfiguration        `mapstructure:"coin_data"`
+		Transformer     TransformerConfiguration     `mapstructure:"transformer"`
 		CoinSetting     CoinSettingConfiguration     `mapstructure:"coin_setting"`
+		Admin           AdminConfiguration           `mapstructure:"admin"`
+		Logging         LoggingConfiguration         `mapstructure:"logging"`
+		Webhooks        WebhookConfiguration         `mapstructure:"webhooks"`
+		Leader          LeaderConfiguration          `mapstructure:"leader"`
+		Cache           CacheConfiguration           `mapstructure:"cache"`
+		Signing         SigningConfiguration         `mapstructure:"signing"`
+
+		// FeatureFlags gates new features per environment or user cohort, keyed by flag name
+		FeatureFlags map[string]FeatureFlagConfiguration `mapstructure:"feature_flags"`
 	}
 
 	AppConfiguration struct {
 		Env      string `mapstructure:"env"`
 		LogLevel string `mapstructure:"log_level"`
+
+		// PodName identifies this replica; defaults to the POD_NAME env var, then the hostname
+		PodName string `mapstructure:"pod_name"`
+
+		// Region is the deployment region reported to clients, admin listings and as the region label of metrics
+		Region string `mapstructure:"region"`
+
+		// RegionEndpoints are the WebSocket endpoints of the other regions, keyed by region. Users whose CFX
+		// account is held by one of them are redirected there at connect.
+		RegionEndpoints map[string]string `mapstructure:"region_endpoints"`
 	}
 
 	KafkaConfiguration struct {
@@ -32,19 +55,327 @@ type (
 		SessionTimeout    int      `mapstructure:"session_timeout"`
 		HeartbeatInterval int      `mapstructure:"heartbeat_interval"`
 		MaxMessageAgeMs   int      `mapstructure:"max_message_age_ms"`
+
+		// StaleThresholdMs tags publications "stale" when the Kafka or payload timestamp of their message
+		// lags server time by more than this; zero disables the tag
+		StaleThresholdMs int `mapstructure:"stale_threshold_ms"`
+
+		// TopicPattern additionally consumes every topic matching this regular expression, rediscovered
+		// every TopicRefreshSeconds, so new streamer message types flow without a redeploy
+		TopicPattern        string `mapstructure:"topic_pattern"`
+		TopicRefreshSeconds int    `mapstructure:"topic_refresh_seconds"`
+
+		// DeadLetterTopic receives messages of consumed topics without a route and malformed messages of routed
+		// topics; without it, the former are dropped and the latter fail
+		DeadLetterTopic string `mapstructure:"dead_letter_topic"`
+
+		// Routes override the error policy of the broadcaster's topic routes
+		Routes []KafkaRouteConfiguration `mapstructure:"routes"`
+
+		// KeyFormat is none, string or json; with a key format, messages keyed by users without
+		// subscribers are skipped without decoding their payload
+		KeyFormat string `mapstructure:"key_format"`
+
+		// StallAfterSeconds flags the feed as stalled when no message arrives for this long; zero disables it
+		StallAfterSeconds int `mapstructure:"stall_after_seconds"`
+
+		// ReconnectAfterSeconds forces the consumer to reconnect when no message arrives for this long; zero disables it
+		ReconnectAfterSeconds int `mapstructure:"reconnect_after_seconds"`
+
+		// RestartAfterErrors recreates the consumer's reader after this many consecutive fetch errors; zero disables it
+		RestartAfterErrors int `mapstructure:"restart_after_errors"`
+
+		// RestartBackoffMinMs and RestartBackoffMaxMs bound the exponential backoff between restarts
+		RestartBackoffMinMs int `mapstructure:"restart_backoff_min_ms"`
+		RestartBackoffMaxMs int `mapstructure:"restart_backoff_max_ms"`
+
+		// HandlerAttempts is how many times a message whose handler fails is tried before it is skipped,
+		// backing off exponentially between HandlerBackoffMinMs and HandlerBackoffMaxMs
+		HandlerAttempts     int `mapstructure:"handler_attempts"`
+		HandlerBackoffMinMs int `mapstructure:"handler_backoff_min_ms"`
+		HandlerBackoffMaxMs int `mapstructure:"handler_backoff_max_ms"`
+
+		// ErrorBudget pauses all consumption for ErrorBudgetPauseSeconds once handlers fail this many
+		// messages within ErrorBudgetWindowSeconds; zero disables the budget
+		ErrorBudget              int `mapstructure:"error_budget"`
+		ErrorBudgetWindowSeconds int `mapstructure:"error_budget_window_seconds"`
+		ErrorBudgetPauseSeconds  int `mapstructure:"error_budget_pause_seconds"`
+
+		// Security configures TLS and SASL for both the consumer and producers
+		Security KafkaSecurityConfiguration `mapstructure:"security"`
+
+		// Producer configures batching and retries for all Kafka producers
+		Producer KafkaProducerConfiguration `mapstructure:"producer"`
+
+		// ConnectionEvents publishes client connection lifecycle events for analytics
+		ConnectionEvents ConnectionEventsConfiguration `mapstructure:"connection_events"`
+
+		// Synthetic replaces the consumer with generated messages for soak tests; refused in production
+		Synthetic SyntheticKafkaConfiguration `mapstructure:"synthetic"`
+
+		// PerTopic consumes each topic with its own reader, so a failing topic doesn't hold up the others
+		PerTopic KafkaPerTopicConfiguration `mapstructure:"per_topic"`
+
+		// Handoff hands the consumer group share of an instance over to the other replicas on deploys
+		Handoff KafkaHandoffConfiguration `mapstructure:"handoff"`
+
+		// UserQuota downgrades the delivery of users exceeding a daily quota of publications to their channels
+		UserQuota KafkaUserQuotaConfiguration `mapstructure:"user_quota"`
+	}
+
+	KafkaRouteConfiguration struct {
+		Topic string `mapstructure:"topic"`
+
+		// ErrorPolicy is retry (the default), returning failures to the consumer's retries and error
+		// budget, or skip, counting and skipping them
+		ErrorPolicy string `mapstructure:"error_policy"`
+	}
+
+	KafkaUserQuotaConfiguration struct {
+		// MessagesPerDay and BytesPerDay cap the publications and payload bytes to a user's channels per UTC
+		// day; zero leaves a unit unlimited and both zero disables quotas. Users with the unlimited_delivery
+		// feature flag are exempt.
+		MessagesPerDay int64 `mapstructure:"messages_per_day"`
+		BytesPerDay    int64 `mapstructure:"bytes_per_day"`
+
+		// DowngradedRate is the publications per second each channel of a user over quota is conflated to
+		DowngradedRate float64 `mapstructure:"downgraded_rate"`
+
+		// FlushIntervalSeconds is how often usage is written to the cache store shared by the replicas
+		FlushIntervalSeconds int `mapstructure:"flush_interval_seconds"`
+	}
+
+	KafkaHandoffConfiguration struct {
+		// Enabled holds readiness until the consumer joined its group, and on SIGTERM leaves the group
+		// before draining connections
+		Enabled bool `mapstructure:"enabled"`
+
+		// DrainSeconds keeps the connections open after leaving the group, while the other replicas
+		// broadcast to them through the Redis broker
+		DrainSeconds int `mapstructure:"drain_seconds"`
+	}
+
+	KafkaPerTopicConfiguration struct {
+		Enabled bool `mapstructure:"enabled"`
+
+		// SeparateGroups suffixes the consumer group with the topic, e.g. {consumer_group}-{topic}
+		SeparateGroups bool `mapstructure:"separate_groups"`
+
+		// ErrorBudget pauses a topic for ErrorBudgetPauseSeconds (until resumed when zero) once its handlers
+		// fail this many messages within ErrorBudgetWindowSeconds; zero disables the budget
+		ErrorBudget              int `mapstructure:"error_budget"`
+		ErrorBudgetWindowSeconds int `mapstructure:"error_budget_window_seconds"`
+		ErrorBudgetPauseSeconds  int `mapstructure:"error_budget_pause_seconds"`
+	}
+
+	KafkaSecurityConfiguration struct {
+		TLSEnabled            bool   `mapstructure:"tls_enabled"`
+		TLSCAPath             string `mapstructure:"tls_ca_path"`
+		TLSInsecureSkipVerify bool   `mapstructure:"tls_insecure_skip_verify"`
+
+		// SASLMechanism is one of plain, scram-sha-256, scram-sha-512 (empty disables SASL)
+		SASLMechanism string `mapstructure:"sasl_mechanism"`
+		SASLUsername  string `mapstructure:"sasl_username"`
+		SASLPassword  string `mapstructure:"sasl_password"`
+	}
+
+	KafkaProducerConfiguration struct {
+		BatchSize      int    `mapstructure:"batch_size"`
+		BatchBytes     int64  `mapstructure:"batch_bytes"`
+		BatchTimeoutMs int    `mapstructure:"batch_timeout_ms"`
+		MaxAttempts    int    `mapstructure:"max_attempts"`
+		BackoffMinMs   int    `mapstructure:"backoff_min_ms"`
+		BackoffMaxMs   int    `mapstructure:"backoff_max_ms"`
+		RequiredAcks   string `mapstructure:"required_acks"`
+		Compression    string `mapstructure:"compression"`
+	}
+
+	ConnectionEventsConfiguration struct {
+		Enabled bool   `mapstructure:"enabled"`
+		Topic   string `mapstructure:"topic"`
+	}
+
+	SyntheticKafkaConfiguration struct {
+		Enabled       bool `mapstructure:"enabled"`
+		RatePerSecond int  `mapstructure:"rate_per_second"`
+
+		// Users is the number of generated users without subscribers, on top of the subscribed users
+		Users int `mapstructure:"users"`
+
+		// PositionRatio is the share of UserPosition messages, 0 to 1
+		PositionRatio float64 `mapstructure:"position_ratio"`
 	}
 
 	WebSocketServerConfiguration struct {
 		Enabled               bool   `mapstructure:"enabled"`
+		BindHost              string `mapstructure:"bind_host"`
 		Port                  int    `mapstructure:"port"`
 		TLSCertPath           string `mapstructure:"tls_cert_path"`
 		TLSKeyPath            string `mapstructure:"tls_key_path"`
+		TLSReloadIntervalMs   int    `mapstructure:"tls_reload_interval_ms"`
 		PingIntervalMs        int    `mapstructure:"ping_interval_ms"`
 		PingTimeoutMs         int    `mapstructure:"ping_timeout_ms"`
 		MaxConnectionsPerUser int    `mapstructure:"max_connections_per_user"`
 		ReadBufferSize        int    `mapstructure:"read_buffer_size"`
 		WriteBufferSize       int    `mapstructure:"write_buffer_size"`
 		ShutdownTimeoutMs     int    `mapstructure:"shutdown_timeout_ms"`
+
+		// KeepaliveMode is server (protocol pings answered by the client), client (ping RPCs sent by the client)
+		// or hybrid (control-frame pings plus ping RPCs) for default profile connections. PingIntervalMs is
+		// the ping interval and PingTimeoutMs the control-frame pong timeout of hybrid mode.
+		KeepaliveMode string `mapstructure:"keepalive_mode"`
+
+		// ConnectionLimitPolicy is reject or supersede for connections beyond max_connections_per_user
+		ConnectionLimitPolicy string `mapstructure:"connection_limit_policy"`
+
+		// MessageSizeLimit is the largest client frame accepted on default profile connections (0 keeps 64KB)
+		MessageSizeLimit int `mapstructure:"message_size_limit"`
+
+		// WriteTimeoutMs bounds a single write to a default profile connection (0 keeps 1s)
+		WriteTimeoutMs int `mapstructure:"write_timeout_ms"`
+
+		// WriteDelayMs batches the writes to default profile connections, up to MaxMessagesInFrame messages
+		// (0 keeps 16) per write, throttling free-tier delivery; zero writes without delay
+		WriteDelayMs       int `mapstructure:"write_delay_ms"`
+		MaxMessagesInFrame int `mapstructure:"max_messages_in_frame"`
+
+		// ReadHeaderTimeoutMs bounds reading upgrade request headers (0 keeps 5s), HandshakeTimeoutMs the time
+		// from the upgrade request to the client's connect command (0 keeps 10s), and MaxHeaderBytes the
+		// request line and headers (0 keeps 16KB), so slow-loris clients cannot hold connections open
+		ReadHeaderTimeoutMs int `mapstructure:"read_header_timeout_ms"`
+		HandshakeTimeoutMs  int `mapstructure:"handshake_timeout_ms"`
+		MaxHeaderBytes      int `mapstructure:"max_header_bytes"`
+
+		// ConnectionProfiles size the transport of clients whose upgrade token carries the profile scope,
+		// e.g. internal firehose consumers; other clients use the default sizes above
+		ConnectionProfiles []ConnectionProfileConfiguration `mapstructure:"connection_profiles"`
+
+		// ChannelPolicies require scopes and client types to subscribe to matching channels and cap their
+		// publication rate; every matching policy applies
+		ChannelPolicies []ChannelPolicyConfiguration `mapstructure:"channel_policies"`
+
+		// SubChannelsEnabled allows per-instrument channels user:{ajaib_id}:position:{symbol} and user:{ajaib_id}:margin:{asset}
+		SubChannelsEnabled bool `mapstructure:"sub_channels_enabled"`
+
+		// ClientSessionIDs accepts a session_id in the connect data, correlating a client's connections across
+		// reconnects in logs and connection events; clients sending none are assigned one
+		ClientSessionIDs bool `mapstructure:"client_session_ids"`
+
+		// SubscribeSnapshot attaches the latest channel state to subscribe acknowledgments (requires centrifuge.history_size > 0)
+		SubscribeSnapshot bool `mapstructure:"subscribe_snapshot"`
+
+		// MaxConnections sheds new upgrades with 503 once this instance holds this many connections (0 disables)
+		MaxConnections int `mapstructure:"max_connections"`
+
+		// ShedRetryAfterSeconds is the Retry-After sent with shed upgrades
+		ShedRetryAfterSeconds int `mapstructure:"shed_retry_after_seconds"`
+
+		// FanOutWorkers delivers announcements and shutdown disconnects to large client lists concurrently (0 or 1 is serial)
+		FanOutWorkers int `mapstructure:"fan_out_workers"`
+
+		// JanitorIntervalMs is how often stale broadcaster subscriptions are reclaimed (0 disables the janitor)
+		JanitorIntervalMs int `mapstructure:"janitor_interval_ms"`
+
+		// TrustedProxies lists CIDRs of load balancers whose X-Forwarded-For header is trusted
+		TrustedProxies []string `mapstructure:"trusted_proxies"`
+
+		// CookieAuth lets the web frontend authenticate with its session cookie
+		CookieAuth CookieAuthConfiguration `mapstructure:"cookie_auth"`
+
+		// Receipts tracks critical publications until clients acknowledge them
+		Receipts ReceiptsConfiguration `mapstructure:"receipts"`
+
+		// SendDedupe is the number of recent sends remembered per client by class (announcement, or a channel
+		// type such as margin, rate or raw), so a message reaching a client through two paths is sent once;
+		// 0 disables a class
+		SendDedupe map[string]int `mapstructure:"send_dedupe"`
+
+		// Overload conflates channels with an overload_max_rate policy while the Kafka consumer falls behind
+		Overload OverloadConfiguration `mapstructure:"overload"`
+
+		// Liveness scores the responsiveness of each connection and disconnects clients with stalled writes
+		Liveness LivenessConfiguration `mapstructure:"liveness"`
+	}
+
+	LivenessConfiguration struct {
+		// Enabled times the socket writes of every connection and serves /debug/liveness
+		Enabled bool `mapstructure:"enabled"`
+
+		// SlowWriteMs is the duration from which a socket write counts as a stall (0 keeps 100ms)
+		SlowWriteMs int `mapstructure:"slow_write_ms"`
+
+		// MaxWriteStallMs disconnects clients whose writes stalled for longer within one check interval
+		// (0 never disconnects); CheckIntervalMs is that interval (0 keeps 10s)
+		MaxWriteStallMs int `mapstructure:"max_write_stall_ms"`
+		CheckIntervalMs int `mapstructure:"check_interval_ms"`
+	}
+
+	OverloadConfiguration struct {
+		// DelayBudgetMs degrades delivery once fetched messages are older than it (0 disables degrading);
+		// RecoverBelowMs restores it once they are younger than it (0 keeps half the budget)
+		DelayBudgetMs  int `mapstructure:"delay_budget_ms"`
+		RecoverBelowMs int `mapstructure:"recover_below_ms"`
+
+		// CheckIntervalMs is how often the consumer delay is checked
+		CheckIntervalMs int `mapstructure:"check_interval_ms"`
+	}
+
+	ReceiptsConfiguration struct {
+		// Enabled accepts critical publications on the publish endpoint and the ack RPC
+		Enabled bool `mapstructure:"enabled"`
+
+		// RetentionSeconds and MaxPerUser bound how long and how many unacknowledged publications are
+		// redelivered to each user on reconnect
+		RetentionSeconds int `mapstructure:"retention_seconds"`
+		MaxPerUser       int `mapstructure:"max_per_user"`
+	}
+
+	ConnectionProfileConfiguration struct {
+		Name             string `mapstructure:"name"`
+		Scope            string `mapstructure:"scope"`
+		ReadBufferSize   int    `mapstructure:"read_buffer_size"`
+		WriteBufferSize  int    `mapstructure:"write_buffer_size"`
+		MessageSizeLimit int    `mapstructure:"message_size_limit"`
+		WriteTimeoutMs   int    `mapstructure:"write_timeout_ms"`
+
+		// KeepaliveMode, PingIntervalMs and PingTimeoutMs override the websocket_server keepalive when set
+		KeepaliveMode  string `mapstructure:"keepalive_mode"`
+		PingIntervalMs int    `mapstructure:"ping_interval_ms"`
+		PingTimeoutMs  int    `mapstructure:"ping_timeout_ms"`
+
+		// QueueInitialCap presizes each connection's send queue; WriteDelayMs and MaxMessagesInFrame batch
+		// writes like the websocket_server defaults, which profiles don't inherit
+		QueueInitialCap    int `mapstructure:"queue_initial_cap"`
+		WriteDelayMs       int `mapstructure:"write_delay_ms"`
+		MaxMessagesInFrame int `mapstructure:"max_messages_in_frame"`
+
+		// LowLatency writes command replies without queueing and serves the profile's clients first in
+		// server-side fan-outs; it cannot be combined with a write delay
+		LowLatency bool `mapstructure:"low_latency"`
+	}
+
+	ChannelPolicyConfiguration struct {
+		Pattern     string   `mapstructure:"pattern"`
+		Scopes      []string `mapstructure:"scopes"`
+		ClientTypes []string `mapstructure:"client_types"`
+		MaxRate     float64  `mapstructure:"max_rate"`
+		Conflate    bool     `mapstructure:"conflate"`
+		TTLSeconds  int      `mapstructure:"ttl_seconds"`
+
+		// ExemptClientTypes lifts max_rate and conflation from the channels of users connected with one of
+		// these connection profiles, e.g. a premium lane; overload_max_rate still applies
+		ExemptClientTypes []string `mapstructure:"exempt_client_types"`
+
+		// OverloadMaxRate conflates matching channels to this rate while delivery is degraded by an overload
+		OverloadMaxRate float64 `mapstructure:"overload_max_rate"`
+	}
+
+	CookieAuthConfiguration struct {
+		Enabled         bool     `mapstructure:"enabled"`
+		Name            string   `mapstructure:"name"`
+		RequireSecure   bool     `mapstructure:"require_secure"`
+		RequireSameSite bool     `mapstructure:"require_same_site"`
+		AllowedOrigins  []string `mapstructure:"allowed_origins"`
 	}
 
 	RedisBrokerConfiguration struct {
@@ -88,6 +419,16 @@ type (
 		// ForceRecovery enables position recovery for clients
 		ForceRecovery bool `mapstructure:"force_recovery"`
 
+		// ClientQueueMaxSize bounds the bytes queued for one client before it is disconnected as slow (default 1MB).
+		// Centrifuge applies it to every connection of the node regardless of connection profile.
+		ClientQueueMaxSize int `mapstructure:"client_queue_max_size"`
+
+		// MaxSessionSeconds bounds how long a connection lives on one token; zero leaves sessions unlimited
+		MaxSessionSeconds int `mapstructure:"max_session_seconds"`
+
+		// ReauthGraceSeconds is how long a session past its maximum duration may still refresh its token
+		ReauthGraceSeconds int `mapstructure:"reauth_grace_seconds"`
+
 		// RedisBroker configures Redis-based broker for cross-pod message delivery
 		RedisBroker RedisBrokerConfiguration `mapstructure:"redis_broker"`
 	}
@@ -95,18 +436,215 @@ type (
 	CoinCfxAdapterConfiguration struct {
 		Host            string `mapstructure:"host"`
 		CacheTTLSeconds int    `mapstructure:"cache_ttl_seconds"`
+
+		// Entitlement stops delivery to users whose futures entitlement was revoked mid-session
+		Entitlement EntitlementConfiguration `mapstructure:"entitlement"`
+	}
+
+	EntitlementConfiguration struct {
+		Enabled         bool `mapstructure:"enabled"`
+		CacheTTLSeconds int  `mapstructure:"cache_ttl_seconds"`
 	}
 
 	CoinDataConfiguration struct {
 		Host            string `mapstructure:"host"`
 		CacheTTLSeconds int    `mapstructure:"cache_ttl_seconds"`
 		CfxUsdtAsset    string `mapstructure:"cfx_usdt_asset"`
+
+		// SecondaryHost serves the rate when coin-data fails; empty disables it
+		SecondaryHost string `mapstructure:"secondary_host"`
+
+		// EmergencyRate is the static rate used when every endpoint fails; zero disables it
+		EmergencyRate float64 `mapstructure:"emergency_rate"`
+
+		// StartupGateSeconds delays Kafka consumption until a rate is cached, for at most this long, so a
+		// coin-data outage at startup doesn't fail every IDR conversion; zero consumes at once
+		StartupGateSeconds int `mapstructure:"startup_gate_seconds"`
+	}
+
+	TransformerConfiguration struct {
+		// Convert selects the field classes (value, price) converted to IDR for IDR-quoted users
+		Convert map[string]bool `mapstructure:"convert"`
+
+		// SymbolOverrides overrides Convert per position symbol
+		SymbolOverrides map[string]map[string]bool `mapstructure:"symbol_overrides"`
+
+		// EmbedFxRate adds the applied rate as fx_rate to converted payloads
+		EmbedFxRate bool `mapstructure:"embed_fx_rate"`
+
+		// EmbedOriginalValues adds the converted fields' USDT values as original_values to converted payloads
+		EmbedOriginalValues bool `mapstructure:"embed_original_values"`
+
+		// UnknownPolicy is pass, drop, quarantine or reject for assets and symbols without conversion rules
+		UnknownPolicy string `mapstructure:"unknown_policy"`
+
+		// QuarantineTopic receives payloads quarantined by the unknown policy
+		QuarantineTopic string `mapstructure:"quarantine_topic"`
+
+		// TimeoutMs bounds the handling of each Kafka message; a rate lookup missing it falls back to the
+		// last applied rate. Zero disables the deadline.
+		TimeoutMs int `mapstructure:"timeout_ms"`
 	}
 
 	CoinSettingConfiguration struct {
 		Host            string `mapstructure:"host"`
 		CacheTTLSeconds int    `mapstructure:"cache_ttl_seconds"`
 	}
+
+	LoggingConfiguration struct {
+		// Levels overrides app.log_level per module (kafka, handler, transformer, service)
+		Levels map[string]string `mapstructure:"levels"`
+
+		// Sampling limits high-volume debug lines
+		Sampling LogSamplingConfiguration `mapstructure:"sampling"`
+
+		// RedactFields are log attribute and JSON field names replaced with [REDACTED]
+		RedactFields []string `mapstructure:"redact_fields"`
+
+		// TokenFields are log attribute and JSON field names truncated to TokenPrefixLen characters
+		TokenFields    []string `mapstructure:"token_fields"`
+		TokenPrefixLen int      `mapstructure:"token_prefix_len"`
+	}
+
+	LogSamplingConfiguration struct {
+		Enabled bool `mapstructure:"enabled"`
+
+		// Initial is the number of identical debug lines logged per interval before sampling starts
+		Initial uint64 `mapstructure:"initial"`
+
+		// Thereafter logs every Nth identical debug line once Initial is exceeded
+		Thereafter uint64 `mapstructure:"thereafter"`
+
+		IntervalMs int `mapstructure:"interval_ms"`
+	}
+
+	FeatureFlagConfiguration struct {
+		// Enabled turns the flag on for every user
+		Enabled bool `mapstructure:"enabled"`
+
+		// Environments limits the flag to these app.env values; empty means all environments
+		Environments []string `mapstructure:"environments"`
+
+		// Users turns the flag on for these ajaib IDs even when Enabled is false
+		Users []string `mapstructure:"users"`
+
+		// Percentage turns the flag on for a stable cohort of this percentage of users (0-100)
+		Percentage int `mapstructure:"percentage"`
+	}
+
+	WebhookConfiguration struct {
+		// Enabled posts user.online and user.offline events to URLs
+		Enabled bool     `mapstructure:"enabled"`
+		URLs    []string `mapstructure:"urls"`
+
+		// Secret signs request bodies with HMAC-SHA256 in X-Webhook-Signature; empty disables signing
+		Secret string `mapstructure:"secret"`
+
+		TimeoutMs   int `mapstructure:"timeout_ms"`
+		MaxAttempts int `mapstructure:"max_attempts"`
+		BackoffMs   int `mapstructure:"backoff_ms"`
+		QueueSize   int `mapstructure:"queue_size"`
+		Workers     int `mapstructure:"workers"`
+	}
+
+	LeaderConfiguration struct {
+		// Mode is standalone (every replica leads) or kafka (one replica leads, elected by a consumer group)
+		Mode string `mapstructure:"mode"`
+
+		// Topic is the single-partition topic whose assignment elects the leader in kafka mode
+		Topic string `mapstructure:"topic"`
+
+		// GroupID is the election group; defaults to {kafka.consumer_group}-leader
+		GroupID string `mapstructure:"group_id"`
+
+		// TaskRestartDelayMs is how long a failed singleton task waits before it runs again
+		TaskRestartDelayMs int `mapstructure:"task_restart_delay_ms"`
+	}
+
+	CacheConfiguration struct {
+		// Backend is memory (per replica) or redis (shared by every replica) for the user mapping,
+		// quote preference and last-value caches
+		Backend string `mapstructure:"backend"`
+
+		// LastValueTTLSeconds keeps the latest publication of each channel for snapshots when channel
+		// history has none; zero disables the last-value cache
+		LastValueTTLSeconds int `mapstructure:"last_value_ttl_seconds"`
+
+		// Compression compresses large last values before they are stored
+		Compression CacheCompressionConfiguration `mapstructure:"compression"`
+
+		Redis CacheRedisConfiguration `mapstructure:"redis"`
+	}
+
+	CacheCompressionConfiguration struct {
+		// Codec is none, snappy or zstd
+		Codec string `mapstructure:"codec"`
+
+		// ThresholdBytes is the smallest value compressed; smaller values are stored as-is
+		ThresholdBytes int `mapstructure:"threshold_bytes"`
+	}
+
+	CacheRedisConfiguration struct {
+		Address   string `mapstructure:"address"`
+		Password  string `mapstructure:"password"`
+		DB        int    `mapstructure:"db"`
+		Prefix    string `mapstructure:"prefix"`
+		TimeoutMs int    `mapstructure:"timeout_ms"`
+	}
+
+	SigningConfiguration struct {
+		Enabled bool `mapstructure:"enabled"`
+
+		// Algorithm is hmac-sha256 or ed25519
+		Algorithm string `mapstructure:"algorithm"`
+
+		// KeyID is sent with every signature so partners can rotate keys
+		KeyID string `mapstructure:"key_id"`
+
+		// HMACSecret is the shared secret of hmac-sha256, at least 32 bytes
+		HMACSecret string `mapstructure:"hmac_secret"`
+
+		// Ed25519KeyPath is the ed25519 private key, in OpenSSH (see cmd/keytool) or PEM PKCS#8 format
+		Ed25519KeyPath string `mapstructure:"ed25519_key_path"`
+
+		// Channels lists the channel prefixes whose publications are signed, e.g. raw:user:
+		Channels []string `mapstructure:"channels"`
+	}
+
+	AdminConfiguration struct {
+		// Enabled starts the internal admin HTTP server
+		Enabled bool `mapstructure:"enabled"`
+
+		// BindHost is the interface the admin listener binds to (e.g. 127.0.0.1 or a pod-internal IP)
+		BindHost string `mapstructure:"bind_host"`
+
+		// Port is the internal port for pprof, expvar and debug endpoints
+		Port int `mapstructure:"port"`
+
+		// TLSCertPath and TLSKeyPath enable TLS on the admin listener, independent of the public listener
+		TLSCertPath string `mapstructure:"tls_cert_path"`
+		TLSKeyPath  string `mapstructure:"tls_key_path"`
+
+		// ServeMetrics moves /metrics from the public listener to the admin listener
+		ServeMetrics bool `mapstructure:"serve_metrics"`
+
+		// Token is the bearer token required on every admin request; the admin server does not start without one
+		Token string `mapstructure:"token"`
+
+		// RequestSigning additionally requires signed, non-replayed requests on internal endpoints
+		RequestSigning RequestSigningConfiguration `mapstructure:"request_signing"`
+	}
+
+	RequestSigningConfiguration struct {
+		// Secret is the HMAC-SHA256 key shared with callers; empty disables request signing
+		Secret string `mapstructure:"secret"`
+
+		// MaxSkewSeconds is how far a request timestamp may be from the server clock
+		MaxSkewSeconds int `mapstructure:"max_skew_seconds"`
+
+		// NonceCacheSize bounds the nonces remembered to reject replays
+		NonceCacheSize int `mapstructure:"nonce_cache_size"`
+	}
 )
 
 var configuration Configuration
@@ -117,6 +655,14 @@ func Get() *Configuration {
 		return &configuration
 	}
 
+	if _, err := Load(); err != nil {
+		log.Fatalf("%s", err)
+	}
+	return &configuration
+}
+
+// Load reads the config file selected by ENV into the configuration instance
+func Load() (*Configuration, error) {
 	configPath := "config/config.yml"
 	env := os.Getenv("ENV")
 	if env == "development" {
@@ -126,13 +672,70 @@ func Get() *Configuration {
 	viper.SetConfigFile(configPath)
 
 	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Error reading config file. %s", err)
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	if err := viper.Unmarshal(&configuration); err != nil {
-		log.Fatalf("Unable to decode into struct. %v", err)
+		return nil, fmt.Errorf("failed to decode config: %w", err)
 	}
 
 	configuration.IsLoaded = true
-	return &configuration
+	return &configuration, nil
+}
+
+// Validate reports the settings the service cannot start without
+func (c *Configuration) Validate() error {
+	var errs []error
+	if len(c.Kafka.Brokers) == 0 {
+		errs = append(errs, errors.New("kafka.brokers cannot be empty"))
+	}
+	if len(c.Kafka.Topics) == 0 {
+		errs = append(errs, errors.New("kafka.topics cannot be empty"))
+	}
+	if c.Kafka.ConsumerGroup == "" {
+		errs = append(errs, errors.New("kafka.consumer_group cannot be empty"))
+	}
+	if c.CoinData.Host == "" {
+		errs = append(errs, errors.New("coin_data.host cannot be empty"))
+	}
+	if c.CoinCfxAdapter.Host == "" {
+		errs = append(errs, errors.New("coin_cfx_adapter.host cannot be empty"))
+	}
+	if len(c.App.RegionEndpoints) > 0 && c.App.Region == "" {
+		errs = append(errs, errors.New("app.region is required with app.region_endpoints"))
+	}
+	if c.WebSocketServer.Enabled && (c.WebSocketServer.Port <= 0 || c.WebSocketServer.Port > 65535) {
+		errs = append(errs, fmt.Errorf("websocket_server.port %d is out of range", c.WebSocketServer.Port))
+	}
+	if c.Admin.Enabled && (c.Admin.Port <= 0 || c.Admin.Port > 65535) {
+		errs = append(errs, fmt.Errorf("admin.port %d is out of range", c.Admin.Port))
+	}
+	if c.Admin.Enabled && c.Admin.Token == "" {
+		errs = append(errs, errors.New("admin.token cannot be empty when the admin server is enabled"))
+	}
+	if c.Admin.Enabled && c.WebSocketServer.Enabled && c.Admin.Port == c.WebSocketServer.Port {
+		errs = append(errs, errors.New("admin.port must differ from websocket_server.port"))
+	}
+	if quota := c.Kafka.UserQuota; (quota.MessagesPerDay > 0 || quota.BytesPerDay > 0) && quota.DowngradedRate <= 0 {
+		errs = append(errs, errors.New("kafka.user_quota.downgraded_rate must be positive with a quota"))
+	}
+	if c.Signing.Enabled && len(c.Signing.Channels) == 0 {
+		errs = append(errs, errors.New("signing.channels cannot be empty"))
+	}
+	return errors.Join(errs...)
+}
+
+// Watch reloads the config file when it changes and passes the new values to onChange.
+// Only settings read at runtime (such as logging) take effect without a restart.
+func Watch(onChange func(*Configuration)) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		var reloaded Configuration
+		if err := viper.Unmarshal(&reloaded); err != nil {
+			log.Printf("Unable to decode reloaded config. %v", err)
+			return
+		}
+		reloaded.IsLoaded = true
+		onChange(&reloaded)
+	})
+	viper.WatchConfig()
 }
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"log/slog"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// Server exposes internal debugging endpoints (pprof, expvar, connection dumps)
+// on a separate listener so they are never reachable from the public load balancer.
+type Server struct {
+	mux    *http.ServeMux
+	token  string
+	logger *slog.Logger
+}
+
+// NewServer creates a new admin server with pprof and expvar handlers registered
+func NewServer(token string, logger *slog.Logger) *Server {
+	s := &Server{
+		mux:    http.NewServeMux(),
+		token:  token,
+		logger: logger,
+	}
+
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	s.mux.Handle("/debug/vars", expvar.Handler())
+
+	if token == "" {
+		logger.Warn("admin token is not configured, every admin request is rejected")
+	}
+
+	return s
+}
+
+// Handle registers an additional admin handler for the given pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Handler returns the admin HTTP handler wrapped with bearer token authentication
+func (s *Server) Handler() http.Handler {
+	return s.requireToken(s.mux)
+}
+
+// requireToken rejects requests that don't carry the configured admin token, and every request when none is configured
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			s.logger.Warn("unauthorized admin request",
+				"path", r.URL.Path,
+				"remote_addr", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,274 @@
+package announcement
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Notification operations replicating announcements to every node
+const (
+	OpSchedule = "announcement.schedule"
+	OpCancel   = "announcement.cancel"
+)
+
+// Announcement is a message broadcast to connected clients between StartAt and ExpiresAt
+type Announcement struct {
+	ID        string          `json:"id"`
+	Message   json.RawMessage `json:"message"`
+	StartAt   time.Time       `json:"start_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+
+	// Channels targets the owners of these user channels; ignored when AllUsers is set
+	Channels []string `json:"channels,omitempty"`
+
+	// AllUsers targets every connected client
+	AllUsers bool `json:"all_users"`
+}
+
+// Validate checks that the announcement can be scheduled
+func (a Announcement) Validate() error {
+	if len(a.Message) == 0 || string(a.Message) == "null" {
+		return fmt.Errorf("message is required")
+	}
+	if !a.ExpiresAt.After(a.StartAt) {
+		return fmt.Errorf("expires_at must be after start_at")
+	}
+	if !a.AllUsers && len(a.Channels) == 0 {
+		return fmt.Errorf("channels are required unless all_users is set")
+	}
+	return nil
+}
+
+// Active reports whether the announcement should be shown at the given time
+func (a Announcement) Active(now time.Time) bool {
+	return !now.Before(a.StartAt) && now.Before(a.ExpiresAt)
+}
+
+// Sender delivers a started announcement to the clients connected to this node
+type Sender interface {
+	DeliverAnnouncement(a Announcement)
+}
+
+// Notifier replicates an operation to every node, including the local one (implemented by centrifuge.Node)
+type Notifier interface {
+	Notify(op string, data []byte, toNodeID string) error
+}
+
+// scheduled is an announcement and whether it was already delivered on this node
+type scheduled struct {
+	announcement Announcement
+	delivered    bool
+}
+
+// Scheduler holds announcements replicated to this node and delivers them when they start
+type Scheduler struct {
+	sender        Sender
+	notifier      Notifier
+	announcements map[string]*scheduled
+	mu            sync.Mutex
+	logger        *slog.Logger
+}
+
+// NewScheduler creates a scheduler delivering through sender and replicating through notifier
+func NewScheduler(sender Sender, notifier Notifier, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		sender:        sender,
+		notifier:      notifier,
+		announcements: make(map[string]*scheduled),
+		logger:        logger,
+	}
+}
+
+// Schedule replicates the announcement to every node, assigning an ID when missing
+func (s *Scheduler) Schedule(a Announcement) (Announcement, error) {
+	if err := a.Validate(); err != nil {
+		return a, err
+	}
+
+	if a.ID == "" {
+		a.ID = newID()
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return a, err
+	}
+	return a, s.notifier.Notify(OpSchedule, data, "")
+}
+
+// Cancel replicates the removal of an announcement to every node
+func (s *Scheduler) Cancel(id string) error {
+	return s.notifier.Notify(OpCancel, []byte(id), "")
+}
+
+// HandleNotification applies a replicated operation to this node's announcements
+func (s *Scheduler) HandleNotification(op string, data []byte) {
+	switch op {
+	case OpSchedule:
+		var a Announcement
+		if err := json.Unmarshal(data, &a); err != nil {
+			s.logger.Error("invalid announcement notification", "error", err)
+			return
+		}
+
+		s.mu.Lock()
+		s.announcements[a.ID] = &scheduled{announcement: a}
+		s.mu.Unlock()
+
+		s.logger.Info("announcement scheduled",
+			"id", a.ID,
+			"start_at", a.StartAt,
+			"expires_at", a.ExpiresAt,
+			"all_users", a.AllUsers,
+			"channels", a.Channels)
+	case OpCancel:
+		s.mu.Lock()
+		delete(s.announcements, string(data))
+		s.mu.Unlock()
+
+		s.logger.Info("announcement cancelled", "id", string(data))
+	}
+}
+
+// Active returns the announcements shown at the given time, ordered by start time
+func (s *Scheduler) Active(now time.Time) []Announcement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var active []Announcement
+	for _, sched := range s.announcements {
+		if sched.announcement.Active(now) {
+			active = append(active, sched.announcement)
+		}
+	}
+
+	slices.SortFunc(active, func(a, b Announcement) int {
+		return a.StartAt.Compare(b.StartAt)
+	})
+	return active
+}
+
+// List returns all announcements held by this node, ordered by start time
+func (s *Scheduler) List() []Announcement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Announcement, 0, len(s.announcements))
+	for _, sched := range s.announcements {
+		list = append(list, sched.announcement)
+	}
+
+	slices.SortFunc(list, func(a, b Announcement) int {
+		return a.StartAt.Compare(b.StartAt)
+	})
+	return list
+}
+
+// Start delivers announcements as they start and drops expired ones until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.tick(now)
+			}
+		}
+	}()
+}
+
+// tick delivers started announcements once and removes expired ones
+func (s *Scheduler) tick(now time.Time) {
+	var due []Announcement
+
+	s.mu.Lock()
+	for id, sched := range s.announcements {
+		if !now.Before(sched.announcement.ExpiresAt) {
+			delete(s.announcements, id)
+			continue
+		}
+		if !sched.delivered && sched.announcement.Active(now) {
+			sched.delivered = true
+			due = append(due, sched.announcement)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, a := range due {
+		s.logger.Info("delivering announcement", "id", a.ID, "all_users", a.AllUsers)
+		s.sender.DeliverAnnouncement(a)
+	}
+}
+
+// Handler returns the admin HTTP handler listing (GET), scheduling (POST) and cancelling (DELETE ?id=) announcements
+func (s *Scheduler) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.writeJSON(w, http.StatusOK, s.List())
+		case http.MethodPost:
+			var a Announcement
+			if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+				http.Error(w, "invalid announcement", http.StatusBadRequest)
+				return
+			}
+
+			if err := a.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			a, err := s.Schedule(a)
+			if err != nil {
+				s.logger.Error("failed to schedule announcement", "error", err)
+				http.Error(w, "failed to schedule announcement", http.StatusServiceUnavailable)
+				return
+			}
+			s.writeJSON(w, http.StatusCreated, a)
+		case http.MethodDelete:
+			id := r.URL.Query().Get("id")
+			if id == "" {
+				http.Error(w, "id is required", http.StatusBadRequest)
+				return
+			}
+
+			if err := s.Cancel(id); err != nil {
+				s.logger.Error("failed to cancel announcement", "id", id, "error", err)
+				http.Error(w, "failed to cancel announcement", http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// writeJSON writes v as the JSON response body
+func (s *Scheduler) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Error("failed to encode announcements response", "error", err)
+	}
+}
+
+// newID returns a random announcement ID
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,127 @@
+package announcement
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loopbackNotifier applies notifications to a scheduler, as a single node would
+type loopbackNotifier struct {
+	scheduler *Scheduler
+}
+
+func (n *loopbackNotifier) Notify(op string, data []byte, toNodeID string) error {
+	n.scheduler.HandleNotification(op, data)
+	return nil
+}
+
+// recordingSender records delivered announcement IDs
+type recordingSender struct {
+	delivered []string
+}
+
+func (s *recordingSender) DeliverAnnouncement(a Announcement) {
+	s.delivered = append(s.delivered, a.ID)
+}
+
+func newTestScheduler() (*Scheduler, *recordingSender) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	sender := &recordingSender{}
+	notifier := &loopbackNotifier{}
+	scheduler := NewScheduler(sender, notifier, logger)
+	notifier.scheduler = scheduler
+	return scheduler, sender
+}
+
+// TestValidate tests rejecting announcements that cannot be scheduled
+func TestValidate(t *testing.T) {
+	now := time.Now()
+	valid := Announcement{
+		Message:   json.RawMessage(`{"text":"maintenance"}`),
+		StartAt:   now,
+		ExpiresAt: now.Add(time.Hour),
+		AllUsers:  true,
+	}
+	assert.NoError(t, valid.Validate())
+
+	noMessage := valid
+	noMessage.Message = nil
+	assert.Error(t, noMessage.Validate())
+
+	expired := valid
+	expired.ExpiresAt = now.Add(-time.Hour)
+	assert.Error(t, expired.Validate())
+
+	noTarget := valid
+	noTarget.AllUsers = false
+	assert.Error(t, noTarget.Validate())
+}
+
+// TestSchedulerTick tests delivering announcements once when they start and dropping them when they expire
+func TestSchedulerTick(t *testing.T) {
+	scheduler, sender := newTestScheduler()
+	now := time.Now()
+
+	scheduled, err := scheduler.Schedule(Announcement{
+		Message:   json.RawMessage(`{"text":"maintenance"}`),
+		StartAt:   now.Add(time.Minute),
+		ExpiresAt: now.Add(time.Hour),
+		Channels:  []string{"user:12345:margin"},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, scheduled.ID)
+	assert.Len(t, scheduler.List(), 1)
+
+	// Not started yet
+	scheduler.tick(now)
+	assert.Empty(t, sender.delivered)
+	assert.Empty(t, scheduler.Active(now))
+
+	// Started: delivered once and active for replay
+	scheduler.tick(now.Add(2 * time.Minute))
+	scheduler.tick(now.Add(3 * time.Minute))
+	assert.Equal(t, []string{scheduled.ID}, sender.delivered)
+	assert.Len(t, scheduler.Active(now.Add(3*time.Minute)), 1)
+
+	// Expired: removed
+	scheduler.tick(now.Add(2 * time.Hour))
+	assert.Empty(t, scheduler.List())
+}
+
+// TestHandler tests scheduling, listing and cancelling announcements over HTTP
+func TestHandler(t *testing.T) {
+	scheduler, _ := newTestScheduler()
+	handler := scheduler.Handler()
+
+	body := `{"id":"maint-1","message":{"text":"maintenance"},"start_at":"2030-01-01T00:00:00Z","expires_at":"2030-01-01T02:00:00Z","all_users":true}`
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/announcements", strings.NewReader(body)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/announcements", strings.NewReader(`{"message":{"text":"x"},"all_users":true}`)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/announcements", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var list []Announcement
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "maint-1", list[0].ID)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/announcements?id=maint-1", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, scheduler.List())
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// CookieConfig configures reading the JWT from the web frontend's session cookie.
+// Browsers attach cookies to cross-site WebSocket upgrades too, so a cookie is only
+// trusted when the request comes from an allowed origin.
+type CookieConfig struct {
+	// Name is the session cookie carrying the JWT
+	Name string
+
+	// RequireSecure accepts the cookie only on HTTPS requests (TLS or X-Forwarded-Proto: https)
+	RequireSecure bool
+
+	// RequireSameSite rejects the cookie when the browser reports a cross-site request (Sec-Fetch-Site)
+	RequireSameSite bool
+
+	// AllowedOrigins lists the exact Origin values allowed to authenticate with the cookie
+	AllowedOrigins []string
+}
+
+// SetCookieAuth enables the session cookie as the last token source
+func (m *Middleware) SetCookieAuth(cfg CookieConfig) {
+	m.cookie = &cfg
+}
+
+// cookieToken returns the JWT from the session cookie when the request meets the cookie requirements
+func (m *Middleware) cookieToken(r *http.Request) (string, error) {
+	if m.cookie == nil {
+		return "", fmt.Errorf("cookie auth is disabled")
+	}
+
+	cookie, err := r.Cookie(m.cookie.Name)
+	if err != nil || cookie.Value == "" {
+		return "", fmt.Errorf("no %s cookie in request", m.cookie.Name)
+	}
+
+	origin := r.Header.Get("Origin")
+	if !slices.Contains(m.cookie.AllowedOrigins, origin) {
+		return "", fmt.Errorf("origin %q is not allowed to use cookie auth", origin)
+	}
+
+	if m.cookie.RequireSecure && r.TLS == nil && r.Header.Get("X-Forwarded-Proto") != "https" {
+		return "", fmt.Errorf("cookie auth requires https")
+	}
+
+	if m.cookie.RequireSameSite && r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return "", fmt.Errorf("cookie auth rejected for cross-site request")
+	}
+
+	return cookie.Value, nil
+}
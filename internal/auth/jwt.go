@@ -4,6 +4,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // Parser handles JWT parsing and claim extraction.
@@ -18,7 +19,22 @@ func NewParser() *Parser {
 
 // Claims represents the standard JWT claims we need.
 type Claims struct {
-	Sub string `json:"sub"` // Subject - user identifier
+	Sub      string `json:"sub"`                 // Subject - user identifier
+	DeviceID string `json:"device_id,omitempty"` // Optional stable identifier of the user's device
+	Scope    string `json:"scope,omitempty"`     // Optional space-separated scopes granted to the token
+
+	// Impersonate is the ajaib_id whose channels a support agent's token reads; requires the impersonate scope
+	Impersonate string `json:"impersonate,omitempty"`
+}
+
+// HasScope reports whether the token was granted the given scope.
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
 
 // Parse extracts the subject (sub) claim from a JWT token.
@@ -175,3 +191,28 @@ func (e *TokenExtractor) Extract(authorizationHeader, tokenQueryParam string) (s
 
 	return "", fmt.Errorf("no token found in Authorization header or token query parameter")
 }
+
+// SubprotocolTokenPrefix marks a Sec-WebSocket-Protocol entry carrying the JWT, e.g. "auth.bearer.<token>".
+// Browsers cannot set custom headers on WebSocket upgrades, and query params leak into access logs.
+const SubprotocolTokenPrefix = "auth.bearer."
+
+// ExtractSubprotocol extracts a JWT from a Sec-WebSocket-Protocol header.
+// It returns the token and the remaining requested subprotocols with the token entry removed.
+func (e *TokenExtractor) ExtractSubprotocol(header string) (string, []string) {
+	var token string
+	var protocols []string
+
+	for _, proto := range splitString(header, ",") {
+		proto = strings.TrimSpace(proto)
+		if proto == "" {
+			continue
+		}
+		if strings.HasPrefix(proto, SubprotocolTokenPrefix) {
+			token = proto[len(SubprotocolTokenPrefix):]
+			continue
+		}
+		protocols = append(protocols, proto)
+	}
+
+	return token, protocols
+}
@@ -193,3 +193,34 @@ func BenchmarkParseSubject(b *testing.B) {
 		_, _ = parser.ParseSubject(token)
 	}
 }
+
+// TestParseDeviceID tests parsing the optional device_id claim
+func TestParseDeviceID(t *testing.T) {
+	parser := NewParser()
+
+	claims, err := parser.Parse("eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiIxMjM0NSIsImRldmljZV9pZCI6Imlvcy1hYmMifQ.sig")
+	require.NoError(t, err)
+	assert.Equal(t, "12345", claims.Sub)
+	assert.Equal(t, "ios-abc", claims.DeviceID)
+}
+
+// TestParseImpersonate tests parsing the optional impersonate claim of support agent tokens
+func TestParseImpersonate(t *testing.T) {
+	parser := NewParser()
+
+	claims, err := parser.Parse("eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJhZ2VudC03IiwiaW1wZXJzb25hdGUiOiIxMjM0NSIsInNjb3BlIjoiaW50ZXJuYWw6aW1wZXJzb25hdGUifQ.sig")
+	require.NoError(t, err)
+	assert.Equal(t, "agent-7", claims.Sub)
+	assert.Equal(t, "12345", claims.Impersonate)
+	assert.True(t, claims.HasScope("internal:impersonate"))
+}
+
+// TestClaimsHasScope tests matching the space-separated scope claim
+func TestClaimsHasScope(t *testing.T) {
+	claims := &Claims{Sub: "12345", Scope: "read:positions internal:firehose"}
+
+	assert.True(t, claims.HasScope("internal:firehose"))
+	assert.True(t, claims.HasScope("read:positions"))
+	assert.False(t, claims.HasScope("internal"))
+	assert.False(t, (&Claims{Sub: "12345"}).HasScope("internal:firehose"))
+}
@@ -4,19 +4,25 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"strings"
 )
 
 // Context key for storing the JWT token in the request context.
 type contextKey string
 
 const (
-	TokenContextKey contextKey = "jwt_token"
+	TokenContextKey    contextKey = "jwt_token"
+	DeviceIDContextKey contextKey = "device_id"
 )
 
+// DeviceIDHeader carries a stable device identifier when the token has no device_id claim
+const DeviceIDHeader = "X-Device-ID"
+
 // Middleware extracts JWT from HTTP requests and stores it in the request context.
 // This middleware works with Centrifuge's WebSocket upgrade flow.
 type Middleware struct {
 	tokenExtractor *TokenExtractor
+	cookie         *CookieConfig
 	logger         *slog.Logger
 }
 
@@ -31,11 +37,33 @@ func NewMiddleware(logger *slog.Logger) *Middleware {
 // Wrap returns an HTTP middleware that extracts JWT tokens and stores them in context.
 func (m *Middleware) Wrap(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract token from Authorization header or query param
+		// Take the token out of the requested subprotocols so the upgrader only negotiates,
+		// and echoes back, the Centrifuge protocol and the token never reaches the response
+		subprotocolToken, protocols := m.tokenExtractor.ExtractSubprotocol(
+			strings.Join(r.Header.Values("Sec-WebSocket-Protocol"), ","),
+		)
+		if subprotocolToken != "" {
+			r.Header.Del("Sec-WebSocket-Protocol")
+			if len(protocols) > 0 {
+				r.Header.Set("Sec-WebSocket-Protocol", strings.Join(protocols, ", "))
+			}
+		}
+
+		// Extract token from Authorization header or query param, then the subprotocol and session cookie
 		token, err := m.tokenExtractor.Extract(
 			r.Header.Get("X-Socket-Authorization"),
 			r.URL.Query().Get("token"),
 		)
+		if err != nil && subprotocolToken != "" {
+			token, err = subprotocolToken, nil
+		}
+		if err != nil && m.cookie != nil {
+			token, err = m.cookieToken(r)
+		}
+		if deviceID := r.Header.Get(DeviceIDHeader); deviceID != "" {
+			r = r.WithContext(WithDeviceID(r.Context(), deviceID))
+		}
+
 		if err != nil {
 			// Don't reject the request here - Centrifuge will handle auth
 			// Just log the error for debugging
@@ -57,6 +85,17 @@ func WithToken(ctx context.Context, token string) context.Context {
 	return context.WithValue(ctx, TokenContextKey, token)
 }
 
+// WithDeviceID adds a device identifier to the request context.
+func WithDeviceID(ctx context.Context, deviceID string) context.Context {
+	return context.WithValue(ctx, DeviceIDContextKey, deviceID)
+}
+
+// DeviceIDFrom extracts the device identifier from the request context.
+func DeviceIDFrom(ctx context.Context) (string, bool) {
+	deviceID, ok := ctx.Value(DeviceIDContextKey).(string)
+	return deviceID, ok
+}
+
 // TokenFrom extracts the JWT token from the request context.
 func TokenFrom(ctx context.Context) (string, bool) {
 	token, ok := ctx.Value(TokenContextKey).(string)
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMiddlewareSubprotocolToken tests extracting the JWT from the Sec-WebSocket-Protocol header
+func TestMiddlewareSubprotocolToken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	middleware := NewMiddleware(logger)
+
+	tests := []struct {
+		name              string
+		authHeader        string
+		protocolHeader    string
+		expectedToken     string
+		expectedProtocols string
+	}{
+		{
+			name:              "token alongside centrifuge protocol",
+			protocolHeader:    "centrifuge-json, auth.bearer.header.payload.signature",
+			expectedToken:     "header.payload.signature",
+			expectedProtocols: "centrifuge-json",
+		},
+		{
+			name:              "token as only subprotocol",
+			protocolHeader:    "auth.bearer.header.payload.signature",
+			expectedToken:     "header.payload.signature",
+			expectedProtocols: "",
+		},
+		{
+			name:              "header takes precedence over subprotocol",
+			authHeader:        "Bearer from.auth.header",
+			protocolHeader:    "centrifuge-protobuf,auth.bearer.from.sub.protocol",
+			expectedToken:     "from.auth.header",
+			expectedProtocols: "centrifuge-protobuf",
+		},
+		{
+			name:              "no token leaves protocols untouched",
+			protocolHeader:    "centrifuge-json",
+			expectedToken:     "",
+			expectedProtocols: "centrifuge-json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var token, protocols string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token, _ = TokenFrom(r.Context())
+				protocols = r.Header.Get("Sec-WebSocket-Protocol")
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/connection", nil)
+			if tt.authHeader != "" {
+				req.Header.Set("X-Socket-Authorization", tt.authHeader)
+			}
+			req.Header.Set("Sec-WebSocket-Protocol", tt.protocolHeader)
+
+			middleware.Wrap(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.expectedToken, token)
+			assert.Equal(t, tt.expectedProtocols, protocols)
+		})
+	}
+}
+
+// TestMiddlewareCookieToken tests the session cookie source and its origin, secure and same-site requirements
+func TestMiddlewareCookieToken(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	middleware := NewMiddleware(logger)
+	middleware.SetCookieAuth(CookieConfig{
+		Name:            "session",
+		RequireSecure:   true,
+		RequireSameSite: true,
+		AllowedOrigins:  []string{"https://app.ajaib.co.id"},
+	})
+
+	tests := []struct {
+		name          string
+		origin        string
+		proto         string
+		fetchSite     string
+		authHeader    string
+		expectedToken string
+	}{
+		{
+			name:          "allowed origin over https",
+			origin:        "https://app.ajaib.co.id",
+			proto:         "https",
+			fetchSite:     "same-site",
+			expectedToken: "cookie.jwt.token",
+		},
+		{
+			name:   "origin not allowed",
+			origin: "https://evil.example.com",
+			proto:  "https",
+		},
+		{
+			name:   "plain http",
+			origin: "https://app.ajaib.co.id",
+			proto:  "http",
+		},
+		{
+			name:      "cross-site request",
+			origin:    "https://app.ajaib.co.id",
+			proto:     "https",
+			fetchSite: "cross-site",
+		},
+		{
+			name:          "explicit header takes precedence",
+			origin:        "https://evil.example.com",
+			authHeader:    "header.jwt.token",
+			expectedToken: "header.jwt.token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var token string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				token, _ = TokenFrom(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/connection", nil)
+			req.AddCookie(&http.Cookie{Name: "session", Value: "cookie.jwt.token"})
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+			if tt.fetchSite != "" {
+				req.Header.Set("Sec-Fetch-Site", tt.fetchSite)
+			}
+			if tt.authHeader != "" {
+				req.Header.Set("X-Socket-Authorization", tt.authHeader)
+			}
+
+			middleware.Wrap(next).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.expectedToken, token)
+		})
+	}
+}
+
+// TestMiddlewareDeviceID tests storing the device identifier header in the request context
+func TestMiddlewareDeviceID(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	middleware := NewMiddleware(logger)
+
+	var deviceID string
+	var found bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deviceID, found = DeviceIDFrom(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/connection?token=header.payload.signature", nil)
+	req.Header.Set(DeviceIDHeader, "android-123")
+	middleware.Wrap(next).ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, found)
+	assert.Equal(t, "android-123", deviceID)
+
+	middleware.Wrap(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/connection", nil))
+	assert.False(t, found)
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReplayGuard tests rejecting stale timestamps and reused nonces
+func TestReplayGuard(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	guard := NewReplayGuard(30*time.Second, 2)
+	guard.now = func() time.Time { return now }
+
+	require.NoError(t, guard.Check(now.Add(-time.Second), "a"))
+	assert.ErrorIs(t, guard.Check(now, "a"), ErrReplayedRequest)
+	assert.ErrorIs(t, guard.Check(now.Add(-time.Minute), "b"), ErrStaleRequest)
+	assert.ErrorIs(t, guard.Check(now.Add(time.Minute), "b"), ErrStaleRequest)
+	assert.ErrorIs(t, guard.Check(now, ""), ErrReplayedRequest)
+
+	// A full cache drops the oldest nonce and rejects timestamps up to its own
+	require.NoError(t, guard.Check(now, "b"))
+	require.NoError(t, guard.Check(now.Add(time.Second), "c"))
+	assert.Len(t, guard.nonces, 2)
+	assert.ErrorIs(t, guard.Check(now.Add(-time.Second), "a"), ErrStaleRequest)
+	assert.ErrorIs(t, guard.Check(now.Add(time.Second), "c"), ErrReplayedRequest)
+
+	// Nonces are forgotten once their timestamp leaves the window
+	now = now.Add(time.Minute)
+	require.NoError(t, guard.Check(now, "b"))
+	assert.Len(t, guard.nonces, 1)
+}
+
+// TestRequestVerifier tests accepting signed requests once and rejecting unsigned or tampered ones
+func TestRequestVerifier(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	verifier := NewRequestVerifier("secret", NewReplayGuard(30*time.Second, 100), logger)
+
+	var received []byte
+	handler := verifier.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+
+	body := []byte(`{"channel":"user:130010505:margin","payload":{}}`)
+	signed := httptest.NewRequest(http.MethodPost, "/internal/publish", bytes.NewReader(body))
+	require.NoError(t, SignRequest(signed, "secret", body))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, signed)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, body, received)
+
+	replayed := httptest.NewRequest(http.MethodPost, "/internal/publish", bytes.NewReader(body))
+	replayed.Header = signed.Header.Clone()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, replayed)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	tampered := httptest.NewRequest(http.MethodPost, "/internal/publish", bytes.NewReader([]byte(`{}`)))
+	require.NoError(t, SignRequest(tampered, "secret", body))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, tampered)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	wrongKey := httptest.NewRequest(http.MethodPost, "/internal/publish", bytes.NewReader(body))
+	require.NoError(t, SignRequest(wrongKey, "other", body))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, wrongKey)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/publish", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
@@ -0,0 +1,239 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Compression codecs
+const (
+	CodecNone   = "none"
+	CodecSnappy = "snappy"
+	CodecZstd   = "zstd"
+)
+
+// Markers prefixing compressed values. Uncompressed values are stored as-is; they are JSON or plain
+// text and never start with these bytes, so values written before compression was enabled still read.
+const (
+	markerSnappy byte = 0x01
+	markerZstd   byte = 0x02
+)
+
+// maxDecodedBytes bounds the memory a corrupt zstd value can make the decoder allocate
+const maxDecodedBytes = 16 << 20
+
+// ParseCodec validates a compression codec, defaulting to none
+func ParseCodec(codec string) (string, error) {
+	switch strings.ToLower(codec) {
+	case "", CodecNone:
+		return CodecNone, nil
+	case CodecSnappy:
+		return CodecSnappy, nil
+	case CodecZstd:
+		return CodecZstd, nil
+	default:
+		return "", fmt.Errorf("unknown cache compression codec %q, want none, snappy or zstd", codec)
+	}
+}
+
+// CompressedStore compresses values of at least threshold bytes before storing them in another store
+type CompressedStore struct {
+	store     Store
+	codec     string
+	threshold int
+	metrics   *CompressionMetrics
+
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+// NewCompressedStore wraps store, compressing values of at least threshold bytes with codec
+func NewCompressedStore(store Store, codec string, threshold int, metrics *CompressionMetrics) (*CompressedStore, error) {
+	codec, err := ParseCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &CompressedStore{store: store, codec: codec, threshold: threshold, metrics: metrics}
+
+	// zstd values are always decodable, so switching the codec back to snappy or none keeps them readable
+	s.decoder, err = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0), zstd.WithDecoderMaxMemory(maxDecodedBytes))
+	if err != nil {
+		return nil, err
+	}
+	if codec == CodecZstd {
+		s.encoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Get returns the decompressed value of key
+func (s *CompressedStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, ok, err := s.store.Get(ctx, key)
+	if err != nil || !ok {
+		return value, ok, err
+	}
+
+	value, err = s.decompress(value)
+	if err != nil {
+		s.metrics.recordDecompressError()
+		return nil, false, fmt.Errorf("failed to decompress %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+// Set compresses the value when it reaches the threshold and stores it for ttl
+func (s *CompressedStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.store.Set(ctx, key, s.compress(value), ttl)
+}
+
+// IncrBy adds delta to the counter of key, which is never compressed
+func (s *CompressedStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return s.store.IncrBy(ctx, key, delta, ttl)
+}
+
+// Delete removes key
+func (s *CompressedStore) Delete(ctx context.Context, key string) error {
+	return s.store.Delete(ctx, key)
+}
+
+// compress encodes value with the codec, keeping it as-is when it is below the threshold or doesn't shrink
+func (s *CompressedStore) compress(value []byte) []byte {
+	if s.codec == CodecNone {
+		return value
+	}
+	if len(value) < s.threshold {
+		s.metrics.recordSkip("below_threshold")
+		return value
+	}
+
+	var compressed []byte
+	switch s.codec {
+	case CodecSnappy:
+		compressed = append([]byte{markerSnappy}, snappy.Encode(nil, value)...)
+	case CodecZstd:
+		compressed = s.encoder.EncodeAll(value, []byte{markerZstd})
+	}
+
+	if len(compressed) >= len(value) {
+		s.metrics.recordSkip("incompressible")
+		return value
+	}
+	s.metrics.recordCompress(s.codec, len(value), len(compressed))
+	return compressed
+}
+
+// decompress decodes a value according to its marker; unmarked values are returned as-is
+func (s *CompressedStore) decompress(value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+
+	switch value[0] {
+	case markerSnappy:
+		return snappy.Decode(nil, value[1:])
+	case markerZstd:
+		return s.decoder.DecodeAll(value[1:], nil)
+	default:
+		return value, nil
+	}
+}
+
+// CompressionMetrics holds Prometheus metrics for cache compression
+type CompressionMetrics struct {
+	compressed         *prometheus.CounterVec
+	inputBytes         *prometheus.CounterVec
+	outputBytes        *prometheus.CounterVec
+	skipped            *prometheus.CounterVec
+	decompressFailures prometheus.Counter
+}
+
+// NewCompressionMetrics creates a new CompressionMetrics instance with Prometheus collectors
+func NewCompressionMetrics() *CompressionMetrics {
+	return &CompressionMetrics{
+		compressed: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_compressed_total",
+				Help: "Total number of cache values stored compressed, by codec",
+			},
+			[]string{"codec"},
+		),
+		inputBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_compression_input_bytes_total",
+				Help: "Total size of cache values before compression, by codec",
+			},
+			[]string{"codec"},
+		),
+		outputBytes: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_compression_output_bytes_total",
+				Help: "Total size of cache values after compression, by codec",
+			},
+			[]string{"codec"},
+		),
+		skipped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "cache_compression_skipped_total",
+				Help: "Total number of cache values stored uncompressed, by reason (below_threshold, incompressible)",
+			},
+			[]string{"reason"},
+		),
+		decompressFailures: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "cache_decompression_errors_total",
+				Help: "Total number of cache values that failed to decompress",
+			},
+		),
+	}
+}
+
+// Register registers all metrics with the default Prometheus registry
+func (m *CompressionMetrics) Register() error {
+	registry := prometheus.DefaultRegisterer
+
+	registry.MustRegister(
+		m.compressed,
+		m.inputBytes,
+		m.outputBytes,
+		m.skipped,
+		m.decompressFailures,
+	)
+
+	return nil
+}
+
+// recordCompress records a value stored compressed
+func (m *CompressionMetrics) recordCompress(codec string, in, out int) {
+	if m == nil {
+		return
+	}
+	m.compressed.WithLabelValues(codec).Inc()
+	m.inputBytes.WithLabelValues(codec).Add(float64(in))
+	m.outputBytes.WithLabelValues(codec).Add(float64(out))
+}
+
+// recordSkip records a value stored uncompressed
+func (m *CompressionMetrics) recordSkip(reason string) {
+	if m == nil {
+		return
+	}
+	m.skipped.WithLabelValues(reason).Inc()
+}
+
+// recordDecompressError records a value that failed to decompress
+func (m *CompressionMetrics) recordDecompressError() {
+	if m == nil {
+		return
+	}
+	m.decompressFailures.Inc()
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// lastValuePrefix namespaces last values in the store
+const lastValuePrefix = "last_value:"
+
+// LastValue is the latest publication of a channel
+type LastValue struct {
+	Offset uint64          `json:"offset"`
+	Epoch  string          `json:"epoch"`
+	Time   int64           `json:"time"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// LastValues keeps the latest publication of each channel in a store, so snapshots survive a
+// reconnect to a replica that never published the channel
+type LastValues struct {
+	store Store
+	ttl   time.Duration
+}
+
+// NewLastValues creates a last-value cache keeping each publication for ttl
+func NewLastValues(store Store, ttl time.Duration) *LastValues {
+	return &LastValues{store: store, ttl: ttl}
+}
+
+// Put stores the latest publication of a channel
+func (l *LastValues) Put(ctx context.Context, ch string, value LastValue) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return l.store.Set(ctx, lastValuePrefix+ch, data, l.ttl)
+}
+
+// Get returns the latest publication of a channel, or nil when none is stored
+func (l *LastValues) Get(ctx context.Context, ch string) (*LastValue, error) {
+	data, ok, err := l.store.Get(ctx, lastValuePrefix+ch)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var value LastValue
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/rueidis"
+)
+
+// RedisConfig configures the Redis store
+type RedisConfig struct {
+	Address  string
+	Password string
+	DB       int
+
+	// Prefix namespaces the keys of this service in a shared Redis
+	Prefix string
+
+	// Timeout bounds each command
+	Timeout time.Duration
+}
+
+// incrByScript adds to a counter and sets its expiry when it has none, i.e. when the increment created it
+var incrByScript = rueidis.NewLuaScript(`
+local count = redis.call('INCRBY', KEYS[1], ARGV[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return count
+`)
+
+// RedisStore is a Store shared by every replica connected to the same Redis
+type RedisStore struct {
+	client  rueidis.Client
+	prefix  string
+	timeout time.Duration
+}
+
+// NewRedisStore connects to Redis
+func NewRedisStore(config RedisConfig) (*RedisStore, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("redis address cannot be empty")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 500 * time.Millisecond
+	}
+
+	client, err := rueidis.NewClient(rueidis.ClientOption{
+		InitAddress:      []string{config.Address},
+		Password:         config.Password,
+		SelectDB:         config.DB,
+		ConnWriteTimeout: config.Timeout,
+		DisableCache:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+
+	return &RedisStore{client: client, prefix: config.Prefix, timeout: config.Timeout}, nil
+}
+
+// Get returns the value of key
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	value, err := s.client.Do(ctx, s.client.B().Get().Key(s.prefix+key).Build()).AsBytes()
+	if rueidis.IsRedisNil(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set stores the value of key for ttl
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	cmd := s.client.B().Set().Key(s.prefix + key).Value(rueidis.BinaryString(value)).Px(ttl).Build()
+	return s.client.Do(ctx, cmd).Error()
+}
+
+// IncrBy adds delta to the counter of key
+func (s *RedisStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	args := []string{strconv.FormatInt(delta, 10), strconv.FormatInt(ttl.Milliseconds(), 10)}
+	return incrByScript.Exec(ctx, s.client, []string{s.prefix + key}, args).AsInt64()
+}
+
+// Delete removes key
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	return s.client.Do(ctx, s.client.B().Del().Key(s.prefix+key).Build()).Error()
+}
+
+// Close disconnects from Redis
+func (s *RedisStore) Close() {
+	s.client.Close()
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Store backends
+const (
+	// BackendMemory keeps entries in this replica only; they are lost when a client reconnects elsewhere
+	BackendMemory = "memory"
+
+	// BackendRedis shares entries between replicas
+	BackendRedis = "redis"
+)
+
+// memorySweepInterval is how often the memory store drops expired entries
+const memorySweepInterval = time.Minute
+
+// Store is a key-value store for caches that can be shared between replicas.
+// Get reports false for missing and expired keys.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+
+	// IncrBy atomically adds delta to the decimal counter of key and returns its new value, so replicas add
+	// to a shared count. A missing counter starts at zero and expires after ttl; increments keep its expiry.
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+}
+
+// ParseBackend validates a store backend, defaulting to memory
+func ParseBackend(backend string) (string, error) {
+	switch strings.ToLower(backend) {
+	case "", BackendMemory:
+		return BackendMemory, nil
+	case BackendRedis:
+		return BackendRedis, nil
+	default:
+		return "", fmt.Errorf("unknown cache backend %q, want memory or redis", backend)
+	}
+}
+
+// MemoryStore is a Store local to this replica
+type MemoryStore struct {
+	entries   *TTLCache[[]byte]
+	lastSweep atomic.Int64
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{entries: NewTTLCache[[]byte](0)}
+	s.lastSweep.Store(time.Now().UnixNano())
+	return s
+}
+
+// Get returns the value of key
+func (s *MemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	value, ok := s.entries.Get(key)
+	return value, ok, nil
+}
+
+// Set stores the value of key for ttl, dropping expired entries at most once per sweep interval
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	now := time.Now()
+	if last := s.lastSweep.Load(); now.UnixNano()-last > int64(memorySweepInterval) && s.lastSweep.CompareAndSwap(last, now.UnixNano()) {
+		s.entries.Sweep(now)
+	}
+
+	s.entries.SetWithTTL(key, value, ttl)
+	return nil
+}
+
+// IncrBy adds delta to the counter of key
+func (s *MemoryStore) IncrBy(_ context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var count int64
+	var err error
+	s.entries.Update(key, ttl, func(value []byte) []byte {
+		if value != nil {
+			if count, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+				return value
+			}
+		}
+		count += delta
+		return strconv.AppendInt(nil, count, 10)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("value of %s is not a counter: %w", key, err)
+	}
+	return count, nil
+}
+
+// Delete removes key
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.entries.Delete(key)
+	return nil
+}
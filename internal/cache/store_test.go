@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseBackend tests store backend parsing
+func TestParseBackend(t *testing.T) {
+	backend, err := ParseBackend("")
+	require.NoError(t, err)
+	assert.Equal(t, BackendMemory, backend)
+
+	backend, err = ParseBackend("Redis")
+	require.NoError(t, err)
+	assert.Equal(t, BackendRedis, backend)
+
+	_, err = ParseBackend("memcached")
+	assert.ErrorContains(t, err, "memcached")
+}
+
+// TestMemoryStore tests per-entry expiration, deletion and sweeping of expired entries
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	require.NoError(t, store.Set(ctx, "a", []byte("1"), time.Minute))
+	require.NoError(t, store.Set(ctx, "b", []byte("2"), time.Millisecond))
+
+	value, ok, err := store.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("1"), value)
+
+	time.Sleep(5 * time.Millisecond)
+	_, ok, _ = store.Get(ctx, "b")
+	assert.False(t, ok, "expired")
+
+	require.NoError(t, store.Delete(ctx, "a"))
+	_, ok, _ = store.Get(ctx, "a")
+	assert.False(t, ok, "deleted")
+
+	// A set after the sweep interval drops expired entries
+	store.lastSweep.Store(time.Now().Add(-2 * memorySweepInterval).UnixNano())
+	require.NoError(t, store.Set(ctx, "c", []byte("3"), time.Minute))
+	assert.Len(t, store.entries.entries, 1)
+
+	// Counters are decimal values keeping the expiry set when they were created
+	count, err := store.IncrBy(ctx, "n", 2, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	count, err = store.IncrBy(ctx, "n", 3, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+	value, _, _ = store.Get(ctx, "n")
+	assert.Equal(t, []byte("5"), value)
+	time.Sleep(5 * time.Millisecond)
+	count, _ = store.IncrBy(ctx, "n", 0, time.Minute)
+	assert.Equal(t, int64(0), count, "expired counter restarts")
+
+	require.NoError(t, store.Set(ctx, "s", []byte("text"), time.Minute))
+	_, err = store.IncrBy(ctx, "s", 1, time.Minute)
+	assert.Error(t, err, "not a counter")
+}
+
+// TestLastValues tests storing and reading the latest publication of a channel
+func TestLastValues(t *testing.T) {
+	ctx := context.Background()
+	lastValues := NewLastValues(NewMemoryStore(), time.Minute)
+
+	value, err := lastValues.Get(ctx, "user:12345:margin")
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	require.NoError(t, lastValues.Put(ctx, "user:12345:margin", LastValue{Offset: 3, Epoch: "e", Time: 42, Data: []byte(`{"a":1}`)}))
+
+	value, err = lastValues.Get(ctx, "user:12345:margin")
+	require.NoError(t, err)
+	require.NotNil(t, value)
+	assert.Equal(t, uint64(3), value.Offset)
+	assert.Equal(t, "e", value.Epoch)
+	assert.Equal(t, int64(42), value.Time)
+	assert.JSONEq(t, `{"a":1}`, string(value.Data))
+}
+
+// TestCompressedStore tests compressing values above the threshold and reading values of every codec
+func TestCompressedStore(t *testing.T) {
+	ctx := context.Background()
+	large := []byte(strings.Repeat(`{"asset":"USDT","balance":"1000.00"},`, 50))
+	small := []byte(`{"asset":"USDT"}`)
+
+	backing := NewMemoryStore()
+	stores := make(map[string]*CompressedStore)
+	for _, codec := range []string{CodecSnappy, CodecZstd} {
+		store, err := NewCompressedStore(backing, codec, 256, NewCompressionMetrics())
+		require.NoError(t, err)
+		stores[codec] = store
+
+		require.NoError(t, store.Set(ctx, codec+":large", large, time.Minute))
+		require.NoError(t, store.Set(ctx, codec+":small", small, time.Minute))
+
+		raw, _, _ := backing.Get(ctx, codec+":large")
+		assert.Less(t, len(raw), len(large), "%s compresses large values", codec)
+		raw, _, _ = backing.Get(ctx, codec+":small")
+		assert.Equal(t, small, raw, "%s stores small values as-is", codec)
+	}
+
+	// Any store reads every codec and values written before compression was enabled
+	require.NoError(t, backing.Set(ctx, "plain", large, time.Minute))
+	for _, store := range stores {
+		for _, key := range []string{"snappy:large", "zstd:large", "plain"} {
+			value, ok, err := store.Get(ctx, key)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, large, value, key)
+		}
+		value, _, err := store.Get(ctx, "zstd:small")
+		require.NoError(t, err)
+		assert.Equal(t, small, value)
+	}
+
+	require.NoError(t, backing.Set(ctx, "corrupt", []byte{markerZstd, 0xff, 0xff}, time.Minute))
+	_, ok, err := stores[CodecZstd].Get(ctx, "corrupt")
+	assert.Error(t, err)
+	assert.False(t, ok)
+
+	_, err = NewCompressedStore(backing, "lz4", 0, nil)
+	assert.ErrorContains(t, err, "lz4")
+}
@@ -40,7 +40,46 @@ func (c *TTLCache[V]) Get(key string) (V, bool) {
 
 // Set stores a value in the cache with the configured TTL.
 func (c *TTLCache[V]) Set(key string, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores a value in the cache with its own TTL.
+func (c *TTLCache[V]) SetWithTTL(key string, value V, ttl time.Duration) {
 	c.mu.Lock()
-	c.entries[key] = entry[V]{value: value, expiresAt: time.Now().Add(c.ttl)}
+	c.entries[key] = entry[V]{value: value, expiresAt: time.Now().Add(ttl)}
+	c.mu.Unlock()
+}
+
+// Update replaces the value of key with fn of its current value, keeping its expiration, and returns the
+// new value. A missing or expired key is passed as the zero value and expires after ttl.
+func (c *TTLCache[V]) Update(key string, ttl time.Duration, fn func(V) V) V {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	e, ok := c.entries[key]
+	if !ok || now.After(e.expiresAt) {
+		e = entry[V]{expiresAt: now.Add(ttl)}
+	}
+	e.value = fn(e.value)
+	c.entries[key] = e
+	return e.value
+}
+
+// Delete removes key from the cache.
+func (c *TTLCache[V]) Delete(key string) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.mu.Unlock()
+}
+
+// Sweep removes the entries expired at now.
+func (c *TTLCache[V]) Sweep(now time.Time) {
+	c.mu.Lock()
+	for key, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
 	c.mu.Unlock()
 }
@@ -0,0 +1,110 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestKeyPair writes a self-signed certificate and key for the given common name
+func writeTestKeyPair(t *testing.T, certPath, keyPath, commonName string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.Chtimes(certPath, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyPath, modTime, modTime))
+}
+
+// commonName returns the subject common name of the reloader's current certificate
+func commonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+// TestReloaderHotSwap tests that a rotated certificate is picked up without recreating the reloader
+func TestReloaderHotSwap(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+
+	writeTestKeyPair(t, certPath, keyPath, "first", time.Now().Add(-time.Minute))
+
+	r, err := NewReloader(certPath, keyPath, logger)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, r))
+
+	// No change on disk, nothing to reload
+	reloaded, err := r.Reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded)
+
+	writeTestKeyPair(t, certPath, keyPath, "second", time.Now())
+
+	reloaded, err = r.Reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "second", commonName(t, r))
+}
+
+// TestReloaderKeepsCertificateOnError tests that a broken rotation keeps serving the previous certificate
+func TestReloaderKeepsCertificateOnError(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "tls.crt")
+	keyPath := filepath.Join(dir, "tls.key")
+
+	writeTestKeyPair(t, certPath, keyPath, "first", time.Now().Add(-time.Minute))
+
+	r, err := NewReloader(certPath, keyPath, logger)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certPath, []byte("not a certificate"), 0o600))
+
+	_, err = r.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, "first", commonName(t, r))
+}
+
+// TestNewReloaderInvalidPaths tests that missing files fail at startup
+func TestNewReloaderInvalidPaths(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	_, err := NewReloader("", "", logger)
+	assert.Error(t, err)
+
+	_, err = NewReloader("/nonexistent/tls.crt", "/nonexistent/tls.key", logger)
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Context key for storing the resolved client IP in the request context.
+type contextKey string
+
+const (
+	ClientIPContextKey contextKey = "client_ip"
+)
+
+// Resolver determines the real client IP of a request. X-Forwarded-For is only
+// honoured when the request arrives from a trusted proxy, so clients cannot spoof
+// their address by sending the header themselves.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver creates a resolver trusting proxies in the given CIDRs (single IPs are allowed)
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, cidr := range trustedProxies {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+	return r, nil
+}
+
+// ClientIP returns the client IP for the request.
+// X-Forwarded-For is walked right to left, skipping trusted proxies; the first
+// untrusted address is the client.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	remote := remoteIP(req.RemoteAddr)
+	remoteAddr, err := netip.ParseAddr(remote)
+	if err != nil || !r.isTrusted(remoteAddr) {
+		return remote
+	}
+
+	var hops []string
+	for _, header := range req.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			// A malformed hop can't be attributed; stop at the last valid address
+			break
+		}
+		client = addr.Unmap().String()
+		if !r.isTrusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// Wrap returns an HTTP middleware that resolves the client IP and stores it in context.
+func (r *Resolver) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := WithClientIP(req.Context(), r.ClientIP(req))
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// isTrusted reports whether the address belongs to a trusted proxy
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP strips the port from a RemoteAddr
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// WithClientIP adds the client IP to the request context.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ClientIPContextKey, ip)
+}
+
+// ClientIPFrom extracts the client IP from the request context.
+func ClientIPFrom(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(ClientIPContextKey).(string)
+	return ip, ok
+}
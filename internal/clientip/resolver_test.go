@@ -0,0 +1,101 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestClientIP tests client IP resolution with and without trusted proxies
+func TestClientIP(t *testing.T) {
+	resolver, err := NewResolver([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		expected   string
+	}{
+		{
+			name:       "direct connection without header",
+			remoteAddr: "203.0.113.7:51000",
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "untrusted peer cannot spoof header",
+			remoteAddr: "203.0.113.7:51000",
+			xff:        []string{"1.2.3.4"},
+			expected:   "203.0.113.7",
+		},
+		{
+			name:       "trusted load balancer",
+			remoteAddr: "10.1.2.3:51000",
+			xff:        []string{"198.51.100.9"},
+			expected:   "198.51.100.9",
+		},
+		{
+			name:       "spoofed leftmost entry is ignored",
+			remoteAddr: "10.1.2.3:51000",
+			xff:        []string{"1.2.3.4, 198.51.100.9"},
+			expected:   "198.51.100.9",
+		},
+		{
+			name:       "chain of trusted proxies across headers",
+			remoteAddr: "10.1.2.3:51000",
+			xff:        []string{"198.51.100.9, 192.168.1.1", "10.9.9.9"},
+			expected:   "198.51.100.9",
+		},
+		{
+			name:       "trusted peer without header",
+			remoteAddr: "10.1.2.3:51000",
+			expected:   "10.1.2.3",
+		},
+		{
+			name:       "malformed hop stops the walk",
+			remoteAddr: "10.1.2.3:51000",
+			xff:        []string{"198.51.100.9, garbage"},
+			expected:   "10.1.2.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/connection", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.xff {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			assert.Equal(t, tt.expected, resolver.ClientIP(req))
+		})
+	}
+}
+
+// TestNewResolverInvalidCIDR tests rejecting malformed trusted proxy entries
+func TestNewResolverInvalidCIDR(t *testing.T) {
+	_, err := NewResolver([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+
+	_, err = NewResolver([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
+
+// TestWrap tests that the middleware stores the client IP in the request context
+func TestWrap(t *testing.T) {
+	resolver, err := NewResolver(nil)
+	require.NoError(t, err)
+
+	var got string
+	handler := resolver.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = ClientIPFrom(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/connection", nil)
+	req.RemoteAddr = "203.0.113.7:51000"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "203.0.113.7", got)
+}
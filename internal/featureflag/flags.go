@@ -0,0 +1,145 @@
+package featureflag
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// Known feature flags
+const (
+	// FlagSubChannels allows per-symbol and per-asset sub-channels
+	FlagSubChannels = "sub_channels"
+
+	// FlagDeltaMode publishes with Fossil delta compression and lets subscribers negotiate it
+	FlagDeltaMode = "delta_mode"
+
+	// FlagBinaryProtocol allows clients to connect with the Centrifuge protobuf protocol
+	FlagBinaryProtocol = "binary_protocol"
+
+	// FlagUnlimitedDelivery exempts users from the daily delivery quota, e.g. on premium data plans
+	FlagUnlimitedDelivery = "unlimited_delivery"
+)
+
+// Flag is the rollout rule of a single feature flag
+type Flag struct {
+	// Enabled turns the flag on for every user
+	Enabled bool `json:"enabled"`
+
+	// Environments limits the flag to these app.env values; empty means all environments
+	Environments []string `json:"environments,omitempty"`
+
+	// Users turns the flag on for these ajaib IDs even when Enabled is false
+	Users []string `json:"users,omitempty"`
+
+	// Percentage turns the flag on for a stable cohort of this percentage of users (0-100)
+	Percentage int `json:"percentage,omitempty"`
+}
+
+// Provider answers whether a feature flag is on for a user
+type Provider interface {
+	Enabled(name, ajaibID string) bool
+}
+
+// Service is a config-backed Provider whose flags can be replaced at runtime
+type Service struct {
+	env    string
+	flags  map[string]Flag
+	mu     sync.RWMutex
+	logger *slog.Logger
+}
+
+// NewService creates a flag service for the given environment
+func NewService(env string, flags map[string]Flag, logger *slog.Logger) *Service {
+	s := &Service{
+		env:    env,
+		logger: logger,
+	}
+	s.Update(flags)
+	return s
+}
+
+// Update replaces all flags, e.g. after a config reload
+func (s *Service) Update(flags map[string]Flag) {
+	copied := make(map[string]Flag, len(flags))
+	for name, flag := range flags {
+		copied[name] = flag
+	}
+
+	s.mu.Lock()
+	s.flags = copied
+	s.mu.Unlock()
+
+	s.logger.Info("feature flags updated", "env", s.env, "flags", len(copied))
+}
+
+// Enabled reports whether the flag is on for the user. Unknown flags are off.
+func (s *Service) Enabled(name, ajaibID string) bool {
+	s.mu.RLock()
+	flag, ok := s.flags[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	if len(flag.Environments) > 0 && !slices.Contains(flag.Environments, s.env) {
+		return false
+	}
+
+	if flag.Enabled {
+		return true
+	}
+
+	if ajaibID == "" {
+		return false
+	}
+
+	if slices.Contains(flag.Users, ajaibID) {
+		return true
+	}
+
+	return flag.Percentage > 0 && bucket(name, ajaibID) < flag.Percentage
+}
+
+// Flags returns a copy of all configured flags
+func (s *Service) Flags() map[string]Flag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	flags := make(map[string]Flag, len(s.flags))
+	for name, flag := range s.flags {
+		flags[name] = flag
+	}
+	return flags
+}
+
+// Handler returns an HTTP handler listing the environment and configured flags
+func (s *Service) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Env   string          `json:"env"`
+			Flags map[string]Flag `json:"flags"`
+		}{
+			Env:   s.env,
+			Flags: s.Flags(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			s.logger.Error("failed to encode feature flags", "error", err)
+		}
+	})
+}
+
+// bucket maps a user to a stable bucket in [0, 100) per flag, so cohorts differ between flags
+func bucket(name, ajaibID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{':'})
+	h.Write([]byte(ajaibID))
+	return int(h.Sum32() % 100)
+}
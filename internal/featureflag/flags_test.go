@@ -0,0 +1,84 @@
+package featureflag
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEnabled tests flag evaluation by environment, user list and global switch
+func TestEnabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	service := NewService("staging", map[string]Flag{
+		FlagSubChannels:    {Enabled: true},
+		FlagDeltaMode:      {Users: []string{"12345"}},
+		FlagBinaryProtocol: {Enabled: true, Environments: []string{"production"}},
+	}, logger)
+
+	assert.True(t, service.Enabled(FlagSubChannels, "99999"))
+	assert.True(t, service.Enabled(FlagSubChannels, ""))
+
+	assert.True(t, service.Enabled(FlagDeltaMode, "12345"))
+	assert.False(t, service.Enabled(FlagDeltaMode, "99999"))
+
+	assert.False(t, service.Enabled(FlagBinaryProtocol, "12345"))
+	assert.False(t, service.Enabled("unknown", "12345"))
+}
+
+// TestEnabledPercentage tests that percentage rollouts select a stable cohort
+func TestEnabledPercentage(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	service := NewService("production", map[string]Flag{
+		FlagDeltaMode: {Percentage: 20},
+	}, logger)
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		id := strconv.Itoa(100000 + i)
+		if service.Enabled(FlagDeltaMode, id) {
+			enabled++
+			// Evaluation is stable for the same user
+			assert.True(t, service.Enabled(FlagDeltaMode, id))
+		}
+	}
+
+	assert.InDelta(t, 200, enabled, 60)
+}
+
+// TestUpdate tests replacing flags at runtime
+func TestUpdate(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	service := NewService("production", nil, logger)
+	assert.False(t, service.Enabled(FlagSubChannels, "12345"))
+
+	service.Update(map[string]Flag{FlagSubChannels: {Enabled: true}})
+	assert.True(t, service.Enabled(FlagSubChannels, "12345"))
+}
+
+// TestHandler tests listing flags over HTTP
+func TestHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	service := NewService("production", map[string]Flag{
+		FlagSubChannels: {Enabled: true},
+	}, logger)
+
+	rec := httptest.NewRecorder()
+	service.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/flags", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Env   string          `json:"env"`
+		Flags map[string]Flag `json:"flags"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "production", body.Env)
+	assert.True(t, body.Flags[FlagSubChannels].Enabled)
+}
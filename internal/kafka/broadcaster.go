@@ -1,182 +1,677 @@
 package kafka
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
+	"coin-futures-websocket/internal/cache"
+	"coin-futures-websocket/internal/featureflag"
+	"coin-futures-websocket/internal/signing"
 	"coin-futures-websocket/internal/types"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/policy"
 
 	"github.com/centrifugal/centrifuge"
 )
 
-// Transformer defines the interface for transforming Kafka message data
+// Transformer defines the interface for transforming Kafka message data.
+// Messages are decoded once by the broadcaster; the transformer receives the decoded payload with the raw
+// data and must not modify the payload, which the broadcaster still reads to route sub-channels.
+// A nil payload without error means the message is dropped. The context carries the message's deadline.
 type Transformer interface {
-	TransformUserMargin(data []byte, cfxUserID string, quotePreference string) ([]byte, error)
-	TransformUserPosition(data []byte, cfxUserID string, quotePreference string) ([]byte, error)
+	TransformUserMargin(ctx context.Context, margin *types.UserMargin, data []byte, quotePreference string) ([]byte, error)
+	TransformUserPosition(ctx context.Context, position *types.UserPosition, data []byte, quotePreference string) ([]byte, error)
+}
+
+// Publisher publishes data to a channel (implemented by *centrifuge.Node)
+type Publisher interface {
+	Publish(channel string, data []byte, opts ...centrifuge.PublishOption) (centrifuge.PublishResult, error)
+}
+
+// FeatureFlags answers whether a feature flag is on for a user
+type FeatureFlags interface {
+	Enabled(name, ajaibID string) bool
+}
+
+// EntitlementChecker answers whether a user may still receive futures data. It is called for every
+// message, so it must answer from a cache without blocking.
+type EntitlementChecker interface {
+	Entitled(ajaibID string) bool
+}
+
+// ClientTypeChecker answers whether a user is connected with a client type (connection profile), for
+// the channel policies exempting it. It is called for every message, so it must answer without blocking.
+type ClientTypeChecker interface {
+	UserConnectedAs(ajaibID, clientType string) bool
+}
+
+// DeadLetterPublisher produces messages of topics without a route and malformed messages (implemented by the
+// Kafka producer)
+type DeadLetterPublisher interface {
+	Publish(ctx context.Context, key []byte, value []byte) error
+}
+
+// DeadLetter is the record produced to the dead-letter topic for a message of a topic without a route
+type DeadLetter struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+
+	// Error is why a routed message was dead-lettered; empty for topics without a route
+	Error string `json:"error,omitempty"`
+}
+
+// Interceptor inspects or rewrites a payload before it is published to a channel.
+// Returning false drops the publication.
+type Interceptor func(channel string, payload []byte) ([]byte, bool)
+
+// subscriber identifies a single client subscription to a user channel
+type subscriber struct {
+	clientID string
+	channel  string
 }
 
 // subscribedUser holds the details of a user with an active WebSocket subscription.
 type subscribedUser struct {
 	ajaibID         string
 	quotePreference string
+	// subscribers references the client subscriptions of each channel type (margin, position) with the
+	// time they were registered
+	subscribers map[string]map[subscriber]time.Time
+	// raw counts the subscriptions of each channel type to its raw variant
+	raw map[string]int
+	// projected counts the subscriptions of each channel type to its projected variants by projection spec
+	projected map[string]map[string]int
+
+	// wantsRaw and wantsTransformed are set on lookups: whether raw and transformed (regular or projected)
+	// subscribers exist. wantsFull is set when regular subscribers want the whole payload, and projections
+	// lists the specs of the projected subscribers.
+	wantsRaw         bool
+	wantsTransformed bool
+	wantsFull        bool
+	projections      []string
+}
+
+// countProjection adds n to the subscriptions of a projected channel. Must be called with the
+// broadcaster's mu held.
+func (u *subscribedUser) countProjection(channelType, ch string, n int) {
+	spec, _, err := channel.ParseProjected(ch)
+	if err != nil {
+		return
+	}
+	specs, ok := u.projected[channelType]
+	if !ok {
+		specs = make(map[string]int)
+		u.projected[channelType] = specs
+	}
+	specs[spec] += n
+	if specs[spec] <= 0 {
+		delete(specs, spec)
+	}
 }
 
 // Broadcaster handles broadcasting Kafka messages to WebSocket clients via Centrifuge
 type Broadcaster struct {
-	node        *centrifuge.Node
+	node        Publisher
 	transformer Transformer
 	logger      *slog.Logger
-	activeUsers map[string]subscribedUser // Map cfx_user_id -> subscribedUser
+	activeUsers map[string]*subscribedUser // Map cfx_user_id -> subscribedUser
 	mu          sync.RWMutex
+
+	// subChannels additionally publishes to per-symbol and per-asset sub-channels
+	subChannels bool
+
+	// historySize and historyTTL keep recent publications in channel history for snapshots
+	historySize int
+	historyTTL  time.Duration
+
+	// lastValues keeps the latest publication of each channel for snapshots on every replica
+	lastValues *cache.LastValues
+
+	// signer adds signature tags to publications of designated channels
+	signer *signing.PublicationSigner
+
+	// interceptors run in registration order on every publication
+	interceptors []Interceptor
+
+	// throttle caps the publication rate of channels with a rate-limited policy and of users over quota
+	throttle *policy.Throttle
+
+	// quotas downgrade the delivery of users exceeding their daily quota
+	quotas *Quotas
+
+	// policies expire publications of channels with a TTL; expiryMetrics counts the expired ones
+	policies      *policy.Set
+	expiryMetrics *policy.ExpiryMetrics
+
+	featureFlags FeatureFlags
+
+	entitlements EntitlementChecker
+
+	// clientTypes lifts the rates of channel policies exempting the client types a user is connected with
+	clientTypes ClientTypeChecker
+
+	// keyDecoder reads the user from message keys to skip unsubscribed users without decoding payloads
+	keyDecoder KeyDecoder
+
+	// transformTimeout bounds the handling of a single message; zero leaves it to the caller's context
+	transformTimeout time.Duration
+
+	// staleThreshold tags publications of messages lagging server time by more than it; skewMetrics
+	// measures the lag
+	staleThreshold time.Duration
+	skewMetrics    *SkewMetrics
+
+	// routes handle the messages of each topic; they are registered before consuming starts
+	routes       map[string]*Route
+	routeMetrics *RouteMetrics
+
+	// projector projects payloads for subscribers of projected channel variants
+	projector projector
+
+	// deadLetter receives messages of topics without a route, e.g. discovered by a topic pattern;
+	// unknownTopics remembers the topics already warned about
+	deadLetter    DeadLetterPublisher
+	unknownTopics sync.Map
 }
 
 // NewBroadcaster creates a new Kafka broadcaster
-func NewBroadcaster(node *centrifuge.Node, transformer Transformer, logger *slog.Logger) *Broadcaster {
-	return &Broadcaster{
+func NewBroadcaster(node Publisher, transformer Transformer, logger *slog.Logger) *Broadcaster {
+	b := &Broadcaster{
 		node:        node,
 		transformer: transformer,
 		logger:      logger,
-		activeUsers: make(map[string]subscribedUser),
+		activeUsers: make(map[string]*subscribedUser),
+		routes:      make(map[string]*Route),
 	}
+	b.registerBuiltinRoutes()
+	return b
 }
 
-// HandleMessage is the Kafka message handler that routes messages to WebSocket clients
-func (b *Broadcaster) HandleMessage(topic string, key []byte, value []byte) error {
-	b.logger.Debug("kafka message received",
-		"topic", topic,
-		"key", string(key),
-		"value", json.RawMessage(value))
-
-	switch topic {
-	case types.TopicUserMargin:
-		return b.handleUserMargin(value)
-	case types.TopicUserPosition:
-		return b.handleUserPosition(value)
-	default:
-		b.logger.Warn("unknown kafka topic", "topic", topic)
-		return nil
+// SetSubChannels enables publishing to user:{ajaib_id}:position:{symbol} and user:{ajaib_id}:margin:{asset}
+func (b *Broadcaster) SetSubChannels(enabled bool) {
+	b.subChannels = enabled
+}
+
+// SetSigner signs publications of the signer's channels, carrying the signature in publication tags
+func (b *Broadcaster) SetSigner(signer *signing.PublicationSigner) {
+	b.signer = signer
+}
+
+// SetLastValues keeps the latest publication of each channel in a last-value cache
+func (b *Broadcaster) SetLastValues(lastValues *cache.LastValues) {
+	b.lastValues = lastValues
+}
+
+// SetHistory keeps the last size publications of each channel in history for ttl.
+// A size of zero disables history.
+func (b *Broadcaster) SetHistory(size int, ttl time.Duration) {
+	b.historySize = size
+	b.historyTTL = ttl
+}
+
+// SetChannelPolicies applies the publication rate, conflation and TTL of the channel policies
+func (b *Broadcaster) SetChannelPolicies(policies *policy.Set) {
+	b.policies = policies
+	b.throttle = nil
+	if policies.Limited() || b.quotas != nil {
+		b.throttle = policy.NewThrottle(policies)
 	}
 }
 
-// handleUserMargin processes UserMargin messages and broadcasts to relevant WebSocket clients
-func (b *Broadcaster) handleUserMargin(data []byte) error {
-	var margin types.UserMargin
-	if err := json.Unmarshal(data, &margin); err != nil {
-		b.logger.Error("failed to unmarshal UserMargin", "error", err)
-		return err
+// SetExpiryMetrics sets the metrics counting publications dropped past their TTL
+func (b *Broadcaster) SetExpiryMetrics(metrics *policy.ExpiryMetrics) {
+	b.expiryMetrics = metrics
+}
+
+// Throttle returns the channel policy throttle, nil without rate-limited policies and quotas
+func (b *Broadcaster) Throttle() *policy.Throttle {
+	return b.throttle
+}
+
+// SetFeatureFlags sets the provider used to roll out sub-channels and delta mode per user
+func (b *Broadcaster) SetFeatureFlags(flags FeatureFlags) {
+	b.featureFlags = flags
+}
+
+// SetKeyDecoder routes by message key: messages keyed by a user without subscribers are skipped before
+// their payload is decoded. Keys must carry the same cfx_user_id as the payload.
+func (b *Broadcaster) SetKeyDecoder(decoder KeyDecoder) {
+	b.keyDecoder = decoder
+}
+
+// SetEntitlementChecker sets the checker that stops delivery to users who lost futures entitlement
+func (b *Broadcaster) SetEntitlementChecker(checker EntitlementChecker) {
+	b.entitlements = checker
+}
+
+// SetClientTypeChecker sets the checker telling which client types a user is connected with, so channel
+// policies can exempt users of a lane (e.g. premium) from their rates
+func (b *Broadcaster) SetClientTypeChecker(checker ClientTypeChecker) {
+	b.clientTypes = checker
+}
+
+// entitled reports whether the user may receive data; every user is entitled without a checker
+func (b *Broadcaster) entitled(cfxUserID, ajaibID string) bool {
+	if b.entitlements == nil || b.entitlements.Entitled(ajaibID) {
+		return true
 	}
+	if b.debugEnabled() {
+		b.logger.Debug("skipping broadcast, user not entitled",
+			"cfx_user_id", cfxUserID,
+			"ajaib_id", ajaibID)
+	}
+	return false
+}
 
-	b.logger.Debug("received user margin", "margin", margin)
+// featureEnabled reports whether a feature flag is on for the user; all flags are off without a provider
+func (b *Broadcaster) featureEnabled(name, ajaibID string) bool {
+	return b.featureFlags != nil && b.featureFlags.Enabled(name, ajaibID)
+}
 
-	cfxUserID := margin.GetCFXUserID()
-	user, ok := b.getSubscribedUser(cfxUserID)
-	if !ok {
-		// No active subscribers, skip broadcast
-		return nil
+// AddInterceptor appends an interceptor to the publish chain. Interceptors must be added before consuming starts.
+func (b *Broadcaster) AddInterceptor(interceptor Interceptor) {
+	b.interceptors = append(b.interceptors, interceptor)
+}
+
+// SetTransformTimeout bounds the handling of each message, so a hung rate lookup fails the transformation
+// instead of stalling the consumer. Zero disables the deadline.
+func (b *Broadcaster) SetTransformTimeout(timeout time.Duration) {
+	b.transformTimeout = timeout
+}
+
+// HandleMessage is the Kafka message handler that routes messages to WebSocket clients
+func (b *Broadcaster) HandleMessage(ctx context.Context, topic string, key []byte, value []byte) error {
+	if b.transformTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.transformTimeout)
+		defer cancel()
 	}
 
-	var dataToBroadcast []byte = data
-	if b.transformer != nil {
-		transformedData, err := b.transformer.TransformUserMargin(data, cfxUserID, user.quotePreference)
-		if err != nil {
-			b.logger.Error("failed to transform user margin", "error", err)
-			return nil
-		}
-		dataToBroadcast = transformedData
+	if b.debugEnabled() {
+		b.logger.Debug("kafka message received",
+			"topic", topic,
+			"key", string(key),
+			"value", json.RawMessage(value))
+	}
+
+	route, ok := b.routes[topic]
+	if !ok {
+		return b.handleUnknownTopic(ctx, topic, key, value)
 	}
+	return b.handleRoute(ctx, topic, route, key, value)
+}
+
+// SetDeadLetter forwards messages of topics without a route to a dead-letter topic instead of dropping them
+func (b *Broadcaster) SetDeadLetter(deadLetter DeadLetterPublisher) {
+	b.deadLetter = deadLetter
+}
 
-	channel := "user:" + user.ajaibID + ":" + types.ChannelMarginSuffix
+// handleUnknownTopic drops or dead-letters a message of a topic without a route, warning once per topic
+func (b *Broadcaster) handleUnknownTopic(ctx context.Context, topic string, key []byte, value []byte) error {
+	if _, warned := b.unknownTopics.LoadOrStore(topic, struct{}{}); !warned {
+		b.logger.Warn("unknown kafka topic", "topic", topic, "dead_letter", b.deadLetter != nil)
+	}
+	if b.deadLetter == nil {
+		return nil
+	}
+	return b.deadLetterMessage(ctx, DeadLetter{Topic: topic}, key, value)
+}
 
-	// Publish to Centrifuge channel
-	_, err := b.node.Publish(channel, dataToBroadcast)
+// deadLetterMessage produces a message to the dead-letter topic
+func (b *Broadcaster) deadLetterMessage(ctx context.Context, record DeadLetter, key []byte, value []byte) error {
+	record.Payload = json.RawMessage(value)
+	if !json.Valid(value) {
+		// Non-JSON payloads are kept as a string
+		record.Payload, _ = json.Marshal(string(value))
+	}
+	data, err := json.Marshal(record)
 	if err != nil {
-		b.logger.Error("failed to publish to centrifuge",
-			"channel", channel,
-			"cfx_user_id", cfxUserID,
-			"error", err)
-		return err
+		return fmt.Errorf("failed to encode dead letter: %w", err)
+	}
+	if err := b.deadLetter.Publish(ctx, key, data); err != nil {
+		return fmt.Errorf("failed to dead-letter message of topic %s: %w", record.Topic, err)
 	}
+	return nil
+}
 
-	b.logger.Debug("broadcasted user margin",
-		"cfx_user_id", cfxUserID,
-		"ajaib_id", user.ajaibID,
-		"channel", channel,
-		"asset", margin.Asset,
-		"margin_balance", margin.MarginBalance)
+// unsubscribedKey reports whether the message key names a user without subscribers of the channel type
+func (b *Broadcaster) unsubscribedKey(key []byte, channelType string) bool {
+	if b.keyDecoder == nil {
+		return false
+	}
+	cfxUserID, ok := b.keyDecoder(key)
+	if !ok {
+		return false
+	}
+	_, subscribed := b.getSubscribedUser(cfxUserID, channelType)
+	return !subscribed
+}
 
-	return nil
+// debugEnabled reports whether per-message debug logs are on; checking first avoids
+// boxing log arguments for every Kafka message when they are off
+func (b *Broadcaster) debugEnabled() bool {
+	return b.logger.Enabled(context.Background(), slog.LevelDebug)
 }
 
-// handleUserPosition processes UserPosition messages and broadcasts to relevant WebSocket clients
-func (b *Broadcaster) handleUserPosition(data []byte) error {
-	var position types.UserPosition
-	if err := json.Unmarshal(data, &position); err != nil {
-		b.logger.Error("failed to unmarshal UserPosition", "error", err)
-		return err
+// subChannelsEnabled reports whether sub-channels are published for the user
+func (b *Broadcaster) subChannelsEnabled(ajaibID string) bool {
+	return b.subChannels || b.featureEnabled(featureflag.FlagSubChannels, ajaibID)
+}
+
+// delivery describes a publication to a user's channel
+type delivery struct {
+	cfxUserID string
+	ajaibID   string
+
+	// delta publishes with Fossil delta compression; stale publications carry the stale tag
+	delta bool
+	stale bool
+
+	// quota counts the publication against the user's daily quota; downgraded conflates it to the
+	// downgraded rate of a user over quota
+	quota      bool
+	downgraded bool
+
+	// connected reports the client types the user is connected with, nil when unknown
+	connected func(clientType string) bool
+}
+
+// newDelivery returns the delivery of a user's publications, checking whether the user is over quota
+func (b *Broadcaster) newDelivery(cfxUserID, ajaibID string, delta, stale bool) delivery {
+	d := delivery{cfxUserID: cfxUserID, ajaibID: ajaibID, delta: delta, stale: stale}
+	if b.clientTypes != nil {
+		d.connected = func(clientType string) bool { return b.clientTypes.UserConnectedAs(ajaibID, clientType) }
+	}
+	if b.quotaLimited(ajaibID) {
+		d.quota = true
+		d.downgraded = b.quotas.Exceeded(ajaibID)
 	}
+	return d
+}
 
-	b.logger.Debug("received user position", "position", position)
+// publish runs the interceptor chain and the channel policy throttle, and publishes data to a Centrifuge
+// channel. Channels of users over quota are conflated to the downgraded rate, and the user's client types
+// may exempt them from policy rates.
+func (b *Broadcaster) publish(ch string, data []byte, d delivery) error {
+	for _, interceptor := range b.interceptors {
+		var ok bool
+		if data, ok = interceptor(ch, data); !ok {
+			if b.debugEnabled() {
+				b.logger.Debug("publication dropped by interceptor", "channel", ch, "cfx_user_id", d.cfxUserID)
+			}
+			return nil
+		}
+	}
 
-	cfxUserID := position.GetCFXUserID()
-	user, ok := b.getSubscribedUser(cfxUserID)
-	if !ok {
-		// No active subscribers, skip broadcast
+	var limit float64
+	if d.downgraded {
+		limit = b.quotas.Limits().DowngradedRate
+	}
+	if b.throttle != nil && !b.throttle.AdmitFor(ch, data, d.connected, limit, b.deliverConflated(ch, d)) {
+		if b.debugEnabled() {
+			b.logger.Debug("publication throttled by channel policy", "channel", ch, "cfx_user_id", d.cfxUserID)
+		}
 		return nil
 	}
+	return b.send(ch, data, d)
+}
 
-	var dataToBroadcast []byte = data
-	if b.transformer != nil {
-		transformedData, err := b.transformer.TransformUserPosition(data, cfxUserID, user.quotePreference)
-		if err != nil {
-			b.logger.Error("failed to transform user position", "error", err)
-			return nil
+// deliverConflated returns the delivery of a publication held back by the throttle, which drops it
+// instead when it was held past the channel's TTL
+func (b *Broadcaster) deliverConflated(ch string, d delivery) func([]byte) {
+	heldAt := time.Now()
+	return func(data []byte) {
+		if b.policies != nil && b.policies.Expired(ch, heldAt, time.Now()) {
+			b.logger.Debug("conflated publication expired", "channel", ch, "cfx_user_id", d.cfxUserID)
+			b.expiryMetrics.Record(ch, policy.StageConflation)
+			return
 		}
-		dataToBroadcast = transformedData
+		_ = b.send(ch, data, d)
 	}
+}
 
-	channel := "user:" + user.ajaibID + ":" + types.ChannelPositionSuffix
+// send publishes data to a Centrifuge channel and stores it as the channel's last value.
+// Publications of channels with a TTL carry their expiry and leave history once expired, and publications
+// counting against a quota are recorded once published.
+func (b *Broadcaster) send(ch string, data []byte, d delivery) error {
+	var ttl time.Duration
+	if b.policies != nil {
+		ttl = b.policies.TTL(ch)
+	}
 
-	// Publish to Centrifuge channel
-	_, err := b.node.Publish(channel, dataToBroadcast)
+	var opts []centrifuge.PublishOption
+	if b.historySize > 0 {
+		historyTTL := b.historyTTL
+		if ttl > 0 && (historyTTL == 0 || ttl < historyTTL) {
+			historyTTL = ttl
+		}
+		opts = append(opts, centrifuge.WithHistory(b.historySize, historyTTL))
+	}
+	if d.delta {
+		opts = append(opts, centrifuge.WithDelta(true))
+	}
+
+	var tags map[string]string
+	if b.signer != nil {
+		tags, _ = b.signer.Tags(ch, data)
+	}
+	if ttl > 0 {
+		if tags == nil {
+			tags = make(map[string]string, 1)
+		}
+		tags[policy.TagExpiresAt] = strconv.FormatInt(time.Now().Add(ttl).UnixMilli(), 10)
+	}
+	if d.stale {
+		if tags == nil {
+			tags = make(map[string]string, 1)
+		}
+		tags[TagStale] = "true"
+	}
+	if tags != nil {
+		opts = append(opts, centrifuge.WithTags(tags))
+	}
+
+	result, err := b.node.Publish(ch, data, opts...)
 	if err != nil {
 		b.logger.Error("failed to publish to centrifuge",
-			"channel", channel,
-			"cfx_user_id", cfxUserID,
+			"channel", ch,
+			"cfx_user_id", d.cfxUserID,
 			"error", err)
 		return err
 	}
 
-	b.logger.Debug("broadcasted user position",
-		"cfx_user_id", cfxUserID,
-		"ajaib_id", user.ajaibID,
-		"channel", channel,
-		"symbol", position.Symbol,
-		"size", position.Size)
+	if b.lastValues != nil {
+		value := cache.LastValue{Offset: result.Offset, Epoch: result.Epoch, Time: time.Now().UnixMilli(), Data: data}
+		if err := b.lastValues.Put(context.Background(), ch, value); err != nil {
+			b.logger.Warn("failed to store last value", "channel", ch, "cfx_user_id", d.cfxUserID, "error", err)
+		}
+	}
 
+	if d.quota {
+		b.recordQuota(d.ajaibID, len(data))
+	}
 	return nil
 }
 
-// RegisterSubscription registers that a WebSocket client has subscribed to a user channel
-func (b *Broadcaster) RegisterSubscription(cfxUserID, ajaibID, quotePreference string) {
+// RegisterSubscription registers that a WebSocket client has subscribed to a user channel.
+// Registrations are reference counted per channel type and idempotent per client and channel;
+// it reports whether the subscription was newly registered.
+func (b *Broadcaster) RegisterSubscription(cfxUserID, clientID, ch, ajaibID, quotePreference string) bool {
+	channelType := channel.ChannelType(ch)
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.activeUsers[cfxUserID] = subscribedUser{ajaibID: ajaibID, quotePreference: quotePreference}
-	b.logger.Debug("registered kafka subscription", "cfx_user_id", cfxUserID, "ajaib_id", ajaibID, "quote_preference", quotePreference)
+
+	user, ok := b.activeUsers[cfxUserID]
+	if !ok {
+		user = &subscribedUser{
+			subscribers: make(map[string]map[subscriber]time.Time),
+			raw:         make(map[string]int),
+			projected:   make(map[string]map[string]int),
+		}
+		b.activeUsers[cfxUserID] = user
+	}
+	user.ajaibID = ajaibID
+	user.quotePreference = quotePreference
+
+	refs, ok := user.subscribers[channelType]
+	if !ok {
+		refs = make(map[subscriber]time.Time)
+		user.subscribers[channelType] = refs
+	}
+
+	key := subscriber{clientID: clientID, channel: ch}
+	if _, exists := refs[key]; exists {
+		return false
+	}
+	refs[key] = time.Now()
+	if channel.IsRaw(ch) {
+		user.raw[channelType]++
+	}
+	user.countProjection(channelType, ch, 1)
+
+	b.logger.Debug("registered kafka subscription",
+		"cfx_user_id", cfxUserID,
+		"client_id", clientID,
+		"channel", ch,
+		"ajaib_id", ajaibID,
+		"quote_preference", quotePreference,
+		"refs", len(refs))
+	return true
+}
+
+// UnregisterSubscription removes a WebSocket client's subscription to a user channel.
+// Messages of a channel type keep being routed while other subscriptions to it remain.
+func (b *Broadcaster) UnregisterSubscription(cfxUserID, clientID, ch string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	user, ok := b.activeUsers[cfxUserID]
+	if !ok {
+		return
+	}
+
+	channelType := channel.ChannelType(ch)
+	if refs, ok := user.subscribers[channelType]; ok {
+		key := subscriber{clientID: clientID, channel: ch}
+		if _, exists := refs[key]; exists {
+			if channel.IsRaw(ch) {
+				user.raw[channelType]--
+			}
+			user.countProjection(channelType, ch, -1)
+		}
+		delete(refs, key)
+		if len(refs) == 0 {
+			b.releaseChannelType(user, channelType)
+		}
+	}
+	b.removeIfIdle(cfxUserID, user)
+
+	b.logger.Debug("unregistered kafka subscription",
+		"cfx_user_id", cfxUserID,
+		"client_id", clientID,
+		"channel", ch)
 }
 
-// UnregisterSubscription removes a WebSocket client's subscription
-func (b *Broadcaster) UnregisterSubscription(cfxUserID string) {
+// UnregisterClient removes all subscriptions of a disconnected WebSocket client
+func (b *Broadcaster) UnregisterClient(cfxUserID, clientID string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	delete(b.activeUsers, cfxUserID)
-	b.logger.Debug("unregistered kafka subscription", "cfx_user_id", cfxUserID)
+
+	user, ok := b.activeUsers[cfxUserID]
+	if !ok {
+		return
+	}
+
+	for channelType, refs := range user.subscribers {
+		for key := range refs {
+			if key.clientID == clientID {
+				if channel.IsRaw(key.channel) {
+					user.raw[channelType]--
+				}
+				user.countProjection(channelType, key.channel, -1)
+				delete(refs, key)
+			}
+		}
+		if len(refs) == 0 {
+			b.releaseChannelType(user, channelType)
+		}
+	}
+	b.removeIfIdle(cfxUserID, user)
+
+	b.logger.Debug("unregistered kafka client", "cfx_user_id", cfxUserID, "client_id", clientID)
+}
+
+// Subscribers returns the IDs of all clients with a registered subscription, mapped to their cfx_user_id
+func (b *Broadcaster) Subscribers() map[string]string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	clients := make(map[string]string)
+	for cfxUserID, user := range b.activeUsers {
+		for _, refs := range user.subscribers {
+			for key := range refs {
+				clients[key.clientID] = cfxUserID
+			}
+		}
+	}
+	return clients
+}
+
+// subscribedUserIDs returns the CFX user IDs with at least one subscriber
+func (b *Broadcaster) subscribedUserIDs() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	ids := make([]string, 0, len(b.activeUsers))
+	for cfxUserID := range b.activeUsers {
+		ids = append(ids, cfxUserID)
+	}
+	return ids
+}
+
+// releaseChannelType drops a channel type without subscribers. Must be called with mu held.
+func (b *Broadcaster) releaseChannelType(user *subscribedUser, channelType string) {
+	delete(user.subscribers, channelType)
+	delete(user.raw, channelType)
+	delete(user.projected, channelType)
+}
+
+// removeIfIdle drops a user without any remaining subscriptions. Must be called with mu held.
+func (b *Broadcaster) removeIfIdle(cfxUserID string, user *subscribedUser) {
+	if len(user.subscribers) == 0 {
+		delete(b.activeUsers, cfxUserID)
+	}
 }
 
-// getSubscribedUser returns the subscribed user for the given cfx_user_id, or false if not found
-func (b *Broadcaster) getSubscribedUser(cfxUserID string) (subscribedUser, bool) {
+// getSubscribedUser returns the user subscribed to the channel type for the given cfx_user_id, or false if not found
+func (b *Broadcaster) getSubscribedUser(cfxUserID, channelType string) (subscribedUser, bool) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	user, ok := b.activeUsers[cfxUserID]
-	return user, ok
+	if !ok || len(user.subscribers[channelType]) == 0 {
+		return subscribedUser{}, false
+	}
+	raw := user.raw[channelType]
+	var projected int
+	var projections []string
+	for spec, n := range user.projected[channelType] {
+		projected += n
+		projections = append(projections, spec)
+	}
+	slices.Sort(projections)
+	return subscribedUser{
+		ajaibID:          user.ajaibID,
+		quotePreference:  user.quotePreference,
+		wantsRaw:         raw > 0,
+		wantsTransformed: len(user.subscribers[channelType]) > raw,
+		wantsFull:        len(user.subscribers[channelType]) > raw+projected,
+		projections:      projections,
+	}, true
 }
@@ -3,11 +3,23 @@ package kafka
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"coin-futures-websocket/internal/cache"
+	"coin-futures-websocket/internal/featureflag"
+	"coin-futures-websocket/internal/service"
+	"coin-futures-websocket/internal/signing"
 	"coin-futures-websocket/internal/types"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/policy"
 
 	"github.com/centrifugal/centrifuge"
 	"github.com/stretchr/testify/assert"
@@ -33,17 +45,17 @@ type mockTransformer struct {
 	transformPositionFunc func([]byte, string, string) ([]byte, error)
 }
 
-func (m *mockTransformer) TransformUserMargin(data []byte, cfxUserID string, quotePreference string) ([]byte, error) {
+func (m *mockTransformer) TransformUserMargin(ctx context.Context, margin *types.UserMargin, data []byte, quotePreference string) ([]byte, error) {
 	if m.transformMarginFunc != nil {
-		return m.transformMarginFunc(data, cfxUserID, quotePreference)
+		return m.transformMarginFunc(data, margin.CFXUserID, quotePreference)
 	}
 	// Default: return data unchanged
 	return data, nil
 }
 
-func (m *mockTransformer) TransformUserPosition(data []byte, cfxUserID string, quotePreference string) ([]byte, error) {
+func (m *mockTransformer) TransformUserPosition(ctx context.Context, position *types.UserPosition, data []byte, quotePreference string) ([]byte, error) {
 	if m.transformPositionFunc != nil {
-		return m.transformPositionFunc(data, cfxUserID, quotePreference)
+		return m.transformPositionFunc(data, position.CFXUserID, quotePreference)
 	}
 	// Default: return data unchanged
 	return data, nil
@@ -64,6 +76,12 @@ func TestNewBroadcaster(t *testing.T) {
 	assert.NotNil(t, broadcaster.activeUsers)
 }
 
+// registerUser subscribes a single client to both the margin and position channels of a user
+func registerUser(b *Broadcaster, cfxUserID, ajaibID, quotePreference string) {
+	b.RegisterSubscription(cfxUserID, "client_1", channel.UserChannel(ajaibID, types.ChannelMarginSuffix), ajaibID, quotePreference)
+	b.RegisterSubscription(cfxUserID, "client_1", channel.UserChannel(ajaibID, types.ChannelPositionSuffix), ajaibID, quotePreference)
+}
+
 // TestRegisterSubscription tests registering a subscription
 func TestRegisterSubscription(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
@@ -73,13 +91,16 @@ func TestRegisterSubscription(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register a subscription
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
+	broadcaster.RegisterSubscription("cfx_123", "client_1", "user:ajaib_456:margin", "ajaib_456", "USD")
 
-	// Verify it's registered
-	user, ok := broadcaster.getSubscribedUser("cfx_123")
+	// Verify it's registered for margin only
+	user, ok := broadcaster.getSubscribedUser("cfx_123", types.ChannelMarginSuffix)
 	assert.True(t, ok)
 	assert.Equal(t, "ajaib_456", user.ajaibID)
 	assert.Equal(t, "USD", user.quotePreference)
+
+	_, ok = broadcaster.getSubscribedUser("cfx_123", types.ChannelPositionSuffix)
+	assert.False(t, ok)
 }
 
 // TestUnregisterSubscription tests unregistering a subscription
@@ -91,12 +112,88 @@ func TestUnregisterSubscription(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register then unregister
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
-	broadcaster.UnregisterSubscription("cfx_123")
+	broadcaster.RegisterSubscription("cfx_123", "client_1", "user:ajaib_456:margin", "ajaib_456", "USD")
+	broadcaster.UnregisterSubscription("cfx_123", "client_1", "user:ajaib_456:margin")
 
 	// Verify it's unregistered
-	_, ok := broadcaster.getSubscribedUser("cfx_123")
+	_, ok := broadcaster.getSubscribedUser("cfx_123", types.ChannelMarginSuffix)
 	assert.False(t, ok)
+	assert.Empty(t, broadcaster.activeUsers)
+}
+
+// TestRegisterSubscriptionIdempotent tests that duplicate registrations are ignored
+func TestRegisterSubscriptionIdempotent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	broadcaster := NewBroadcaster(&recordingPublisher{}, nil, logger)
+
+	assert.True(t, broadcaster.RegisterSubscription("cfx_123", "client_1", "user:ajaib_456:margin", "ajaib_456", "USD"))
+	assert.False(t, broadcaster.RegisterSubscription("cfx_123", "client_1", "user:ajaib_456:margin", "ajaib_456", "USD"))
+	assert.True(t, broadcaster.RegisterSubscription("cfx_123", "client_2", "user:ajaib_456:margin", "ajaib_456", "USD"))
+
+	// The user stays routed until the last client unregisters
+	broadcaster.UnregisterSubscription("cfx_123", "client_1", "user:ajaib_456:margin")
+	_, ok := broadcaster.getSubscribedUser("cfx_123", types.ChannelMarginSuffix)
+	assert.True(t, ok)
+
+	broadcaster.UnregisterSubscription("cfx_123", "client_2", "user:ajaib_456:margin")
+	_, ok = broadcaster.getSubscribedUser("cfx_123", types.ChannelMarginSuffix)
+	assert.False(t, ok)
+}
+
+// TestUnregisterSubscriptionKeepsOtherChannels tests that unsubscribing one channel keeps routing the others
+func TestUnregisterSubscriptionKeepsOtherChannels(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:margin", "12345", "USDT")
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:position", "12345", "USDT")
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:position:BTCUSDT", "12345", "USDT")
+
+	// Dropping margin keeps position routed
+	broadcaster.UnregisterSubscription("cfx_1", "client_1", "user:12345:margin")
+
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT"})
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	assert.Equal(t, []string{"user:12345:position"}, publisher.channels)
+
+	// Dropping a position sub-channel keeps the full position stream routed
+	broadcaster.UnregisterSubscription("cfx_1", "client_1", "user:12345:position:BTCUSDT")
+	_, ok := broadcaster.getSubscribedUser("cfx_1", types.ChannelPositionSuffix)
+	assert.True(t, ok)
+
+	// Disconnect removes every remaining subscription of the client
+	broadcaster.UnregisterClient("cfx_1", "client_1")
+	assert.Empty(t, broadcaster.activeUsers)
+}
+
+// TestReconnectRouting tests that routing survives reconnects, including a disconnect arriving after the reconnect
+func TestReconnectRouting(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	broadcaster := NewBroadcaster(&recordingPublisher{}, nil, logger)
+
+	// Clean reconnect: the old client disconnects before the new one subscribes
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:margin", "12345", "USDT")
+	broadcaster.UnregisterClient("cfx_1", "client_1")
+	assert.Empty(t, broadcaster.activeUsers)
+
+	broadcaster.RegisterSubscription("cfx_1", "client_2", "user:12345:margin", "12345", "USDT")
+	_, ok := broadcaster.getSubscribedUser("cfx_1", types.ChannelMarginSuffix)
+	assert.True(t, ok)
+
+	// Overlapping reconnect: the new client subscribes before the old client's disconnect is processed
+	broadcaster.RegisterSubscription("cfx_1", "client_3", "user:12345:margin", "12345", "USDT")
+	broadcaster.UnregisterClient("cfx_1", "client_2")
+	_, ok = broadcaster.getSubscribedUser("cfx_1", types.ChannelMarginSuffix)
+	assert.True(t, ok)
+
+	// Repeated disconnects of an already removed client are harmless
+	broadcaster.UnregisterClient("cfx_1", "client_2")
+	broadcaster.UnregisterClient("cfx_1", "client_3")
+	assert.Empty(t, broadcaster.activeUsers)
 }
 
 // TestHandleUserMargin tests handling user margin messages
@@ -108,7 +205,7 @@ func TestHandleUserMargin(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register a subscription
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
+	registerUser(broadcaster, "cfx_123", "ajaib_456", "USD")
 
 	// Create a user margin message
 	margin := types.UserMargin{
@@ -121,7 +218,7 @@ func TestHandleUserMargin(t *testing.T) {
 	require.NoError(t, err)
 
 	// Handle the message
-	err = broadcaster.handleUserMargin(data)
+	err = broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, data)
 	assert.NoError(t, err)
 }
 
@@ -134,7 +231,7 @@ func TestHandleUserPosition(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register a subscription
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
+	registerUser(broadcaster, "cfx_123", "ajaib_456", "USD")
 
 	// Create a user position message
 	position := types.UserPosition{
@@ -147,7 +244,7 @@ func TestHandleUserPosition(t *testing.T) {
 	require.NoError(t, err)
 
 	// Handle the message
-	err = broadcaster.handleUserPosition(data)
+	err = broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, data)
 	assert.NoError(t, err)
 }
 
@@ -170,7 +267,7 @@ func TestHandleUserMarginNoSubscriber(t *testing.T) {
 	require.NoError(t, err)
 
 	// Handle the message - should not error
-	err = broadcaster.handleUserMargin(data)
+	err = broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, data)
 	assert.NoError(t, err)
 }
 
@@ -193,7 +290,7 @@ func TestHandleUserPositionNoSubscriber(t *testing.T) {
 	require.NoError(t, err)
 
 	// Handle the message - should not error
-	err = broadcaster.handleUserPosition(data)
+	err = broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, data)
 	assert.NoError(t, err)
 }
 
@@ -214,7 +311,7 @@ func TestHandleUserMarginWithTransformer(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register a subscription
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
+	registerUser(broadcaster, "cfx_123", "ajaib_456", "USD")
 
 	// Create a user margin message
 	margin := types.UserMargin{
@@ -227,7 +324,7 @@ func TestHandleUserMarginWithTransformer(t *testing.T) {
 	require.NoError(t, err)
 
 	// Handle the message
-	err = broadcaster.handleUserMargin(data)
+	err = broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, data)
 	assert.NoError(t, err)
 	assert.True(t, transformerCalled, "Transformer should have been called")
 }
@@ -249,7 +346,7 @@ func TestHandleUserPositionWithTransformer(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register a subscription
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
+	registerUser(broadcaster, "cfx_123", "ajaib_456", "USD")
 
 	// Create a user position message
 	position := types.UserPosition{
@@ -262,7 +359,7 @@ func TestHandleUserPositionWithTransformer(t *testing.T) {
 	require.NoError(t, err)
 
 	// Handle the message
-	err = broadcaster.handleUserPosition(data)
+	err = broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, data)
 	assert.NoError(t, err)
 	assert.True(t, transformerCalled, "Transformer should have been called")
 }
@@ -276,11 +373,11 @@ func TestHandleUserMarginInvalidJSON(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register a subscription
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
+	registerUser(broadcaster, "cfx_123", "ajaib_456", "USD")
 
 	// Invalid JSON
-	err := broadcaster.handleUserMargin([]byte("invalid json"))
-	assert.Error(t, err)
+	err := broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, []byte("invalid json"))
+	assert.ErrorIs(t, err, ErrMalformedMessage)
 }
 
 // TestHandleUserPositionInvalidJSON tests handling position messages with invalid JSON
@@ -292,11 +389,11 @@ func TestHandleUserPositionInvalidJSON(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register a subscription
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
+	registerUser(broadcaster, "cfx_123", "ajaib_456", "USD")
 
 	// Invalid JSON
-	err := broadcaster.handleUserPosition([]byte("invalid json"))
-	assert.Error(t, err)
+	err := broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, []byte("invalid json"))
+	assert.ErrorIs(t, err, ErrMalformedMessage)
 }
 
 // TestHandleMessage tests the HandleMessage router
@@ -308,7 +405,7 @@ func TestHandleMessage(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Register a subscription
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
+	registerUser(broadcaster, "cfx_123", "ajaib_456", "USD")
 
 	t.Run("handle UserMargin topic", func(t *testing.T) {
 		margin := types.UserMargin{
@@ -319,7 +416,7 @@ func TestHandleMessage(t *testing.T) {
 		}
 		data, _ := json.Marshal(margin)
 
-		err := broadcaster.HandleMessage(types.TopicUserMargin, []byte("key"), data)
+		err := broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, []byte("key"), data)
 		assert.NoError(t, err)
 	})
 
@@ -332,16 +429,85 @@ func TestHandleMessage(t *testing.T) {
 		}
 		data, _ := json.Marshal(position)
 
-		err := broadcaster.HandleMessage(types.TopicUserPosition, []byte("key"), data)
+		err := broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, []byte("key"), data)
 		assert.NoError(t, err)
 	})
 
 	t.Run("handle unknown topic", func(t *testing.T) {
-		err := broadcaster.HandleMessage("unknown.topic", []byte("key"), []byte("data"))
+		err := broadcaster.HandleMessage(context.Background(), "unknown.topic", []byte("key"), []byte("data"))
 		assert.NoError(t, err) // Unknown topics are ignored, not errored
 	})
 }
 
+// deadLetterRecorder records the messages produced to the dead-letter topic
+type deadLetterRecorder struct {
+	keys   [][]byte
+	values [][]byte
+}
+
+func (p *deadLetterRecorder) Publish(ctx context.Context, key []byte, value []byte) error {
+	p.keys = append(p.keys, key)
+	p.values = append(p.values, value)
+	return nil
+}
+
+// TestDeadLetter tests that messages of topics without a route are forwarded with their topic
+func TestDeadLetter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	broadcaster := NewBroadcaster(createTestNode(t), &mockTransformer{}, logger)
+	deadLetter := &deadLetterRecorder{}
+	broadcaster.SetDeadLetter(deadLetter)
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), "futures.UserOrder", []byte("cfx_123"), []byte(`{"order_id":1}`)))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), "futures.UserOrder", nil, []byte("not json")))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, []byte(`{"cfx_user_id":"cfx_123"}`)))
+
+	require.Len(t, deadLetter.values, 2)
+	assert.Equal(t, []byte("cfx_123"), deadLetter.keys[0])
+	assert.JSONEq(t, `{"topic":"futures.UserOrder","payload":{"order_id":1}}`, string(deadLetter.values[0]))
+	assert.JSONEq(t, `{"topic":"futures.UserOrder","payload":"not json"}`, string(deadLetter.values[1]))
+}
+
+// TestTransformErrorCategories tests that unavailable rates are retried, invalid payloads dead-lettered and
+// unsupported assets skipped
+func TestTransformErrorCategories(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var transformErr error
+	transformer := &mockTransformer{
+		transformMarginFunc: func(data []byte, cfxUserID string, quotePreference string) ([]byte, error) {
+			return nil, transformErr
+		},
+	}
+	broadcaster := NewBroadcaster(&recordingPublisher{}, transformer, logger)
+	registerUser(broadcaster, "cfx_1", "12345", "IDR")
+	margin := []byte(`{"cfx_user_id":"cfx_1","asset":"USDT"}`)
+
+	transformErr = fmt.Errorf("%w: no exchange rate available", service.ErrRateUnavailable)
+	err := broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin)
+	assert.ErrorIs(t, err, service.ErrRateUnavailable)
+	assert.NotErrorIs(t, err, ErrMalformedMessage)
+
+	// Invalid payloads are not retried, and dead-lettered once a dead-letter topic is set
+	transformErr = fmt.Errorf("%w: non-finite value", service.ErrInvalidPayload)
+	err = broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin)
+	assert.ErrorIs(t, err, ErrMalformedMessage)
+
+	deadLetter := &deadLetterRecorder{}
+	broadcaster.SetDeadLetter(deadLetter)
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, []byte("cfx_1"), margin))
+	require.Len(t, deadLetter.values, 1)
+
+	var record DeadLetter
+	require.NoError(t, json.Unmarshal(deadLetter.values[0], &record))
+	assert.Equal(t, types.TopicUserMargin, record.Topic)
+	assert.Contains(t, record.Error, "non-finite value")
+	assert.JSONEq(t, string(margin), string(record.Payload))
+
+	transformErr = fmt.Errorf("%w: margin BTC", service.ErrUnsupportedAsset)
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	assert.Len(t, deadLetter.values, 1)
+}
+
 // TestGetSubscribedUser tests retrieving subscribed users
 func TestGetSubscribedUser(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
@@ -351,13 +517,13 @@ func TestGetSubscribedUser(t *testing.T) {
 	broadcaster := NewBroadcaster(node, transformer, logger)
 
 	// Test non-existent user
-	user, ok := broadcaster.getSubscribedUser("cfx_999")
+	user, ok := broadcaster.getSubscribedUser("cfx_999", types.ChannelMarginSuffix)
 	assert.False(t, ok)
 	assert.Empty(t, user.ajaibID)
 
 	// Test existing user
-	broadcaster.RegisterSubscription("cfx_123", "ajaib_456", "USD")
-	user, ok = broadcaster.getSubscribedUser("cfx_123")
+	registerUser(broadcaster, "cfx_123", "ajaib_456", "USD")
+	user, ok = broadcaster.getSubscribedUser("cfx_123", types.ChannelMarginSuffix)
 	assert.True(t, ok)
 	assert.Equal(t, "ajaib_456", user.ajaibID)
 	assert.Equal(t, "USD", user.quotePreference)
@@ -378,7 +544,7 @@ func TestConcurrentSubscriptionTests(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		go func(index int) {
 			cfxID := string(rune('a' + index))
-			broadcaster.RegisterSubscription(cfxID, "ajaib_456", "USD")
+			registerUser(broadcaster, cfxID, "ajaib_456", "USD")
 			done <- true
 		}(i)
 	}
@@ -391,3 +557,634 @@ func TestConcurrentSubscriptionTests(t *testing.T) {
 	// Verify all subscriptions were registered
 	assert.Equal(t, 10, len(broadcaster.activeUsers))
 }
+
+// recordingPublisher records channels published to, their payloads and the options used
+type recordingPublisher struct {
+	channels []string
+	payloads [][]byte
+	options  []centrifuge.PublishOptions
+}
+
+func (p *recordingPublisher) Publish(channel string, data []byte, opts ...centrifuge.PublishOption) (centrifuge.PublishResult, error) {
+	var options centrifuge.PublishOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	p.channels = append(p.channels, channel)
+	p.payloads = append(p.payloads, data)
+	p.options = append(p.options, options)
+	return centrifuge.PublishResult{}, nil
+}
+
+// TestBroadcasterSubChannels tests publishing to per-symbol and per-asset sub-channels
+func TestBroadcasterSubChannels(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT"})
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+
+	// Disabled by default: only the full stream is published
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	assert.Equal(t, []string{"user:12345:position"}, publisher.channels)
+
+	publisher.channels = nil
+	broadcaster.SetSubChannels(true)
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	assert.Equal(t, []string{
+		"user:12345:position",
+		"user:12345:position:BTCUSDT",
+		"user:12345:margin",
+		"user:12345:margin:USDT",
+	}, publisher.channels)
+}
+
+// TestBroadcasterHistory tests that publications are saved to history when enabled
+func TestBroadcasterHistory(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	require.Len(t, publisher.options, 1)
+	assert.Equal(t, 0, publisher.options[0].HistorySize)
+
+	broadcaster.SetHistory(1, 5*time.Minute)
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	require.Len(t, publisher.options, 2)
+	assert.Equal(t, 1, publisher.options[1].HistorySize)
+	assert.Equal(t, 5*time.Minute, publisher.options[1].HistoryTTL)
+}
+
+// TestBroadcasterLastValues tests that publications are kept in the last-value cache when set
+func TestBroadcasterLastValues(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	lastValues := cache.NewLastValues(cache.NewMemoryStore(), time.Minute)
+	broadcaster.SetLastValues(lastValues)
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+
+	value, err := lastValues.Get(context.Background(), "user:12345:margin")
+	require.NoError(t, err)
+	require.NotNil(t, value)
+	assert.JSONEq(t, string(publisher.payloads[0]), string(value.Data))
+	assert.NotZero(t, value.Time)
+}
+
+// TestBroadcasterSigner tests that publications of designated channels carry signature tags
+func TestBroadcasterSigner(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	secret := []byte(strings.Repeat("s", 32))
+	signer, err := signing.NewHMACSigner("partner-1", secret)
+	require.NoError(t, err)
+	broadcaster.SetSigner(signing.NewPublicationSigner(signer, []string{"user:12345:margin"}))
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT"})
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+
+	require.Len(t, publisher.options, 2)
+	assert.NoError(t, signing.VerifyHMAC(secret, "user:12345:margin", publisher.options[0].Tags, publisher.payloads[0]))
+	assert.Empty(t, publisher.options[1].Tags, "position channel not designated")
+}
+
+// TestBroadcasterInterceptors tests that interceptors run in order and can rewrite or drop publications
+func TestBroadcasterInterceptors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	var seen []string
+	broadcaster.AddInterceptor(func(ch string, payload []byte) ([]byte, bool) {
+		seen = append(seen, ch)
+		return payload, true
+	})
+	broadcaster.AddInterceptor(func(ch string, payload []byte) ([]byte, bool) {
+		return payload, ch != "user:12345:position"
+	})
+
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT"})
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+
+	assert.Equal(t, []string{"user:12345:margin", "user:12345:position"}, seen)
+	assert.Equal(t, []string{"user:12345:margin"}, publisher.channels)
+}
+
+// TestBroadcasterChannelPolicies tests that publications over a channel policy's rate are dropped
+func TestBroadcasterChannelPolicies(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	policies, err := policy.NewSet([]policy.Policy{{Pattern: "user:*:margin", MaxRate: 0.1}})
+	require.NoError(t, err)
+	broadcaster.SetChannelPolicies(policies)
+
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT"})
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+		require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	}
+
+	assert.Equal(t, []string{"user:12345:margin", "user:12345:position", "user:12345:position"}, publisher.channels)
+}
+
+// TestBroadcasterTTL tests that publications of channels with a TTL carry their expiry and leave history once expired
+func TestBroadcasterTTL(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	broadcaster.SetHistory(10, 5*time.Minute)
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	policies, err := policy.NewSet([]policy.Policy{{Pattern: "user:*:margin", TTL: 5 * time.Second}})
+	require.NoError(t, err)
+	broadcaster.SetChannelPolicies(policies)
+
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT"})
+	before := time.Now()
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+
+	require.Len(t, publisher.options, 2)
+	assert.Equal(t, 5*time.Second, publisher.options[0].HistoryTTL)
+	expiresAt, err := strconv.ParseInt(publisher.options[0].Tags[policy.TagExpiresAt], 10, 64)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, expiresAt, before.Add(5*time.Second).UnixMilli())
+
+	assert.Equal(t, 5*time.Minute, publisher.options[1].HistoryTTL)
+	assert.Empty(t, publisher.options[1].Tags)
+}
+
+// TestBroadcasterStale tests that publications of messages whose Kafka or payload timestamp lags past the
+// stale threshold carry the stale tag
+func TestBroadcasterStale(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	broadcaster.SetStaleThreshold(5 * time.Second)
+	broadcaster.SetSkewMetrics(NewSkewMetrics())
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	now := time.Now()
+	fresh, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT", Timestamp: now.UnixMilli()})
+	delayed, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT", Timestamp: now.Add(-time.Minute).UnixMilli()})
+
+	require.NoError(t, broadcaster.HandleMessage(withMessageTime(context.Background(), now), types.TopicUserMargin, nil, fresh))
+	require.NoError(t, broadcaster.HandleMessage(withMessageTime(context.Background(), now), types.TopicUserMargin, nil, delayed))
+	require.NoError(t, broadcaster.HandleMessage(withMessageTime(context.Background(), now.Add(-time.Minute)), types.TopicUserMargin, nil, fresh))
+
+	require.Len(t, publisher.options, 3)
+	assert.Empty(t, publisher.options[0].Tags)
+	assert.Equal(t, "true", publisher.options[1].Tags[TagStale])
+	assert.Equal(t, "true", publisher.options[2].Tags[TagStale])
+
+	// Without a threshold, skew is measured but nothing is tagged
+	broadcaster.SetStaleThreshold(0)
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, delayed))
+	require.Len(t, publisher.options, 4)
+	assert.Empty(t, publisher.options[3].Tags)
+}
+
+// TestBroadcasterConflatedExpiry tests that a conflated publication held past its TTL is dropped
+func TestBroadcasterConflatedExpiry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	policies, err := policy.NewSet([]policy.Policy{{Pattern: "user:*:margin", MaxRate: 1, Conflate: true, TTL: 20 * time.Millisecond}})
+	require.NoError(t, err)
+	broadcaster.SetChannelPolicies(policies)
+
+	deliver := broadcaster.deliverConflated("user:12345:margin", delivery{cfxUserID: "cfx_1", ajaibID: "12345"})
+	deliver([]byte(`{"held":"briefly"}`))
+	assert.Equal(t, []string{"user:12345:margin"}, publisher.channels)
+
+	expired := broadcaster.deliverConflated("user:12345:margin", delivery{cfxUserID: "cfx_1", ajaibID: "12345"})
+	time.Sleep(30 * time.Millisecond)
+	expired([]byte(`{"held":"too long"}`))
+	assert.Equal(t, []string{"user:12345:margin"}, publisher.channels)
+}
+
+// staticFlags enables a fixed set of feature flags for every user
+type staticFlags map[string]bool
+
+func (f staticFlags) Enabled(name, ajaibID string) bool {
+	return f[name]
+}
+
+// TestBroadcasterFeatureFlags tests that sub-channels and delta mode follow the feature flags
+func TestBroadcasterFeatureFlags(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	broadcaster.SetFeatureFlags(staticFlags{featureflag.FlagSubChannels: true, featureflag.FlagDeltaMode: true})
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT"})
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+
+	assert.Equal(t, []string{"user:12345:position", "user:12345:position:BTCUSDT"}, publisher.channels)
+	for _, options := range publisher.options {
+		assert.True(t, options.UseDelta)
+	}
+}
+
+// TestSubscribers tests listing subscribed clients with their cfx_user_id
+func TestSubscribers(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	broadcaster := NewBroadcaster(&recordingPublisher{}, nil, logger)
+	assert.Empty(t, broadcaster.Subscribers())
+
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:margin", "12345", "USDT")
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:position", "12345", "USDT")
+	broadcaster.RegisterSubscription("cfx_2", "client_2", "user:67890:margin", "67890", "USDT")
+
+	assert.Equal(t, map[string]string{"client_1": "cfx_1", "client_2": "cfx_2"}, broadcaster.Subscribers())
+}
+
+// discardPublisher drops every publication
+type discardPublisher struct{}
+
+func (discardPublisher) Publish(channel string, data []byte, opts ...centrifuge.PublishOption) (centrifuge.PublishResult, error) {
+	return centrifuge.PublishResult{}, nil
+}
+
+// registerClients subscribes n clients to the margin channel of a user
+func registerClients(b *Broadcaster, n int, cfxUserID, ajaibID string) {
+	ch := channel.UserChannel(ajaibID, types.ChannelMarginSuffix)
+	for i := 0; i < n; i++ {
+		b.RegisterSubscription(cfxUserID, "client_"+strconv.Itoa(i), ch, ajaibID, "IDR")
+	}
+}
+
+// TestBroadcasterEncodesOnce tests that a Kafka message is transformed once and the same
+// payload is published to every channel, however many clients are subscribed
+func TestBroadcasterEncodesOnce(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	transforms := 0
+	transformer := &mockTransformer{
+		transformMarginFunc: func(data []byte, cfxUserID, quotePreference string) ([]byte, error) {
+			transforms++
+			return []byte(`{"transformed":true}`), nil
+		},
+	}
+
+	broadcaster := NewBroadcaster(publisher, transformer, logger)
+	broadcaster.SetSubChannels(true)
+	registerClients(broadcaster, 10000, "cfx_1", "12345")
+
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+
+	assert.Equal(t, 1, transforms)
+	require.Len(t, publisher.payloads, 2)
+	assert.Same(t, &publisher.payloads[0][0], &publisher.payloads[1][0])
+}
+
+// TestBroadcasterDropsTransformedNil tests that a message dropped by the transformer is not published
+func TestBroadcasterDropsTransformedNil(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+	transformer := &mockTransformer{
+		transformPositionFunc: func(data []byte, cfxUserID, quotePreference string) ([]byte, error) {
+			return nil, nil
+		},
+	}
+
+	broadcaster := NewBroadcaster(publisher, transformer, logger)
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:position", "12345", "IDR")
+
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSD"})
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	assert.Empty(t, publisher.payloads)
+}
+
+// BenchmarkHandleUserMargin measures per-message cost with 1, 100 and 10k subscribed clients; Centrifuge
+// fans the single publication out to subscribers, so allocations should not grow with subscribers
+func BenchmarkHandleUserMargin(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT", MarginBalance: 1000})
+
+	for _, clients := range []int{1, 100, 10000} {
+		b.Run(strconv.Itoa(clients)+"_clients", func(b *testing.B) {
+			broadcaster := NewBroadcaster(discardPublisher{}, &mockTransformer{}, logger)
+			registerClients(broadcaster, clients, "cfx_1", "12345")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin)
+			}
+		})
+	}
+}
+
+// fixedRate is a currency service returning a constant USDT to IDR rate
+type fixedRate float64
+
+func (r fixedRate) GetCurrentRate(ctx context.Context) (float64, error) {
+	return float64(r), nil
+}
+
+// BenchmarkHandleMessageTransform measures per-message cost when the payload is published as received
+// and when it is converted to IDR, which decodes and re-encodes it
+func BenchmarkHandleMessageTransform(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT", MarginBalance: 1000, WalletBalance: 1200})
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT", Size: 2, Value: 100, Leverage: 10,
+		EntryPrice: 50, MarkPrice: 51, LiquidationPrice: 40, MaintenanceMargin: 1, UnrealisedPnl: 2, OrderMargin: 3})
+
+	for _, bc := range []struct {
+		name        string
+		topic       string
+		data        []byte
+		transformer Transformer
+	}{
+		{"passthrough", types.TopicUserMargin, margin, nil},
+		{"transformed", types.TopicUserMargin, margin, service.NewTransformer(fixedRate(16000), "USDT", logger)},
+		{"transformed_position", types.TopicUserPosition, position, service.NewTransformer(fixedRate(16000), "USDT", logger)},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			broadcaster := NewBroadcaster(discardPublisher{}, bc.transformer, logger)
+			registerClients(broadcaster, 1, "cfx_1", "12345")
+			broadcaster.RegisterSubscription("cfx_1", "client_0", channel.UserChannel("12345", types.ChannelPositionSuffix), "12345", "IDR")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = broadcaster.HandleMessage(context.Background(), bc.topic, nil, bc.data)
+			}
+		})
+	}
+}
+
+// fixedEntitlements entitles every user except the revoked ones
+type fixedEntitlements map[string]bool
+
+func (f fixedEntitlements) Entitled(ajaibID string) bool { return !f[ajaibID] }
+
+// TestEntitlementChecker tests that users without entitlement stop receiving margin and position data
+func TestEntitlementChecker(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	broadcaster.SetEntitlementChecker(fixedEntitlements{"67890": true})
+
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:margin", "12345", "USDT")
+	broadcaster.RegisterSubscription("cfx_2", "client_2", "user:67890:margin", "67890", "USDT")
+	broadcaster.RegisterSubscription("cfx_2", "client_2", "user:67890:position", "67890", "USDT")
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, []byte(`{"cfx_user_id":"cfx_1","asset":"USDT"}`)))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, []byte(`{"cfx_user_id":"cfx_2","asset":"USDT"}`)))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, []byte(`{"cfx_user_id":"cfx_2","symbol":"BTCUSDT"}`)))
+
+	assert.Equal(t, []string{"user:12345:margin"}, publisher.channels)
+}
+
+// TestNewKeyDecoder tests the built-in key formats
+func TestNewKeyDecoder(t *testing.T) {
+	decoder, err := NewKeyDecoder("")
+	require.NoError(t, err)
+	assert.Nil(t, decoder)
+
+	_, err = NewKeyDecoder("avro")
+	assert.Error(t, err)
+
+	decoder, err = NewKeyDecoder(KeyFormatString)
+	require.NoError(t, err)
+	cfxUserID, ok := decoder([]byte("cfx_1"))
+	assert.True(t, ok)
+	assert.Equal(t, "cfx_1", cfxUserID)
+	_, ok = decoder(nil)
+	assert.False(t, ok)
+
+	decoder, err = NewKeyDecoder("JSON")
+	require.NoError(t, err)
+	cfxUserID, ok = decoder([]byte(`{"cfx_user_id":"cfx_1"}`))
+	assert.True(t, ok)
+	assert.Equal(t, "cfx_1", cfxUserID)
+	for _, key := range []string{"", "cfx_1", `{"user":"cfx_1"}`} {
+		_, ok = decoder([]byte(key))
+		assert.False(t, ok, key)
+	}
+}
+
+// TestKeyedRouting tests that messages keyed by unsubscribed users are skipped before decoding
+func TestKeyedRouting(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	decoder, err := NewKeyDecoder(KeyFormatString)
+	require.NoError(t, err)
+	broadcaster.SetKeyDecoder(decoder)
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:margin", "12345", "USDT")
+
+	// Invalid payloads would fail to decode, so no error means they were skipped by key
+	assert.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, []byte("cfx_2"), []byte("invalid json")))
+	assert.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, []byte("cfx_1"), []byte("invalid json")))
+
+	// Subscribed users and unkeyed messages are decoded
+	assert.Error(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, []byte("cfx_1"), []byte("invalid json")))
+	assert.Error(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, []byte("invalid json")))
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, []byte("cfx_1"), []byte(`{"cfx_user_id":"cfx_1","asset":"USDT"}`)))
+	assert.Equal(t, []string{"user:12345:margin"}, publisher.channels)
+}
+
+// BenchmarkHandleUnsubscribed measures the cost of skipping a message for a user without subscribers,
+// by payload and by key
+func BenchmarkHandleUnsubscribed(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_2", Symbol: "BTCUSDT", Size: 1, EntryPrice: 60000})
+	key := []byte("cfx_2")
+
+	for _, format := range []string{KeyFormatNone, KeyFormatString} {
+		b.Run(format, func(b *testing.B) {
+			broadcaster := NewBroadcaster(discardPublisher{}, nil, logger)
+			decoder, _ := NewKeyDecoder(format)
+			broadcaster.SetKeyDecoder(decoder)
+			registerClients(broadcaster, 100, "cfx_1", "12345")
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_ = broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, key, position)
+			}
+		})
+	}
+}
+
+// TestRawVariants tests that raw subscribers receive the untransformed payload alongside transformed subscribers
+func TestRawVariants(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+	transforms := 0
+	transformer := &mockTransformer{
+		transformPositionFunc: func(data []byte, cfxUserID string, quotePreference string) ([]byte, error) {
+			transforms++
+			return []byte(`{"transformed":true}`), nil
+		},
+	}
+	broadcaster := NewBroadcaster(publisher, transformer, logger)
+	position := []byte(`{"cfx_user_id":"cfx_1","symbol":"BTCUSDT"}`)
+
+	// Only raw subscribers: the transformation is skipped
+	assert.True(t, broadcaster.RegisterSubscription("cfx_1", "risk_1", "raw:user:12345:position", "12345", "IDR"))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	assert.Equal(t, []string{"raw:user:12345:position"}, publisher.channels)
+	assert.Equal(t, position, publisher.payloads[0])
+	assert.Zero(t, transforms)
+
+	// Both variants
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:position", "12345", "IDR")
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	assert.Equal(t, []string{"raw:user:12345:position", "raw:user:12345:position", "user:12345:position"}, publisher.channels)
+	assert.JSONEq(t, `{"transformed":true}`, string(publisher.payloads[2]))
+	assert.Equal(t, 1, transforms)
+
+	// The raw variant stops once its subscriber leaves
+	broadcaster.UnregisterClient("cfx_1", "risk_1")
+	user, ok := broadcaster.getSubscribedUser("cfx_1", types.ChannelPositionSuffix)
+	require.True(t, ok)
+	assert.False(t, user.wantsRaw)
+	assert.True(t, user.wantsTransformed)
+}
+
+// TestProjectedVariants tests that projected subscribers receive only their fields of the transformed payload
+func TestProjectedVariants(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+	transformer := &mockTransformer{
+		transformPositionFunc: func(data []byte, cfxUserID string, quotePreference string) ([]byte, error) {
+			return []byte(`{"symbol":"BTCUSDT","mark_price":1600000000,"unrealised_pnl":1500,"leverage":10}`), nil
+		},
+	}
+	broadcaster := NewBroadcaster(publisher, transformer, logger)
+	broadcaster.SetSubChannels(true)
+	position := []byte(`{"cfx_user_id":"cfx_1","symbol":"BTCUSDT"}`)
+	projected := "fields:mark_price.unrealised_pnl:user:12345:position"
+
+	// Only projected subscribers: the full channel is not published
+	assert.True(t, broadcaster.RegisterSubscription("cfx_1", "widget_1", projected, "12345", "IDR"))
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	assert.Equal(t, []string{projected, projected + ":BTCUSDT"}, publisher.channels)
+	assert.JSONEq(t, `{"mark_price":1600000000,"unrealised_pnl":1500}`, string(publisher.payloads[0]))
+	assert.Equal(t, publisher.payloads[0], publisher.payloads[1])
+
+	// A regular subscriber adds the full payload
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:position", "12345", "IDR")
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	assert.Equal(t, []string{"user:12345:position", "user:12345:position:BTCUSDT", projected, projected + ":BTCUSDT"}, publisher.channels[2:])
+
+	// The projection stops once its subscriber leaves
+	broadcaster.UnregisterSubscription("cfx_1", "widget_1", projected)
+	user, ok := broadcaster.getSubscribedUser("cfx_1", types.ChannelPositionSuffix)
+	require.True(t, ok)
+	assert.Empty(t, user.projections)
+	assert.True(t, user.wantsFull)
+}
+
+// TestProjectorCache tests that projection fields are cached up to the bound
+func TestProjectorCache(t *testing.T) {
+	var p projector
+	assert.Equal(t, []string{"a", "b"}, p.fieldsOf("a.b"))
+	assert.Equal(t, []string{"a", "b"}, p.fieldsOf("a.b"))
+	assert.EqualValues(t, 1, p.cached.Load())
+
+	p.cached.Store(maxCachedProjections)
+	assert.Equal(t, []string{"c"}, p.fieldsOf("c"))
+	_, ok := p.fields.Load("c")
+	assert.False(t, ok)
+
+	_, err := p.project([]byte(`[1,2]`), []string{"a"})
+	assert.Error(t, err)
+}
+
+// deadlineTransformer records the deadline of the context it transforms under
+type deadlineTransformer struct {
+	deadline time.Time
+	ok       bool
+}
+
+func (d *deadlineTransformer) TransformUserMargin(ctx context.Context, margin *types.UserMargin, data []byte, quotePreference string) ([]byte, error) {
+	d.deadline, d.ok = ctx.Deadline()
+	return data, nil
+}
+
+func (d *deadlineTransformer) TransformUserPosition(ctx context.Context, position *types.UserPosition, data []byte, quotePreference string) ([]byte, error) {
+	d.deadline, d.ok = ctx.Deadline()
+	return data, nil
+}
+
+// TestTransformTimeout tests that each message is transformed under the configured deadline
+func TestTransformTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	transformer := &deadlineTransformer{}
+	broadcaster := NewBroadcaster(&recordingPublisher{}, transformer, logger)
+	registerUser(broadcaster, "cfx_1", "12345", "IDR")
+	margin := []byte(`{"cfx_user_id":"cfx_1","asset":"USDT"}`)
+
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	assert.False(t, transformer.ok)
+
+	broadcaster.SetTransformTimeout(500 * time.Millisecond)
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	require.True(t, transformer.ok)
+	assert.WithinDuration(t, time.Now().Add(500*time.Millisecond), transformer.deadline, 100*time.Millisecond)
+}
+
+// TestTransformErrorsReturned tests that failed transformations are reported to the consumer for retries,
+// before the raw variant is published
+func TestTransformErrorsReturned(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+	transformer := &mockTransformer{
+		transformMarginFunc: func(data []byte, cfxUserID string, quotePreference string) ([]byte, error) {
+			return nil, errors.New("no exchange rate available")
+		},
+	}
+	broadcaster := NewBroadcaster(publisher, transformer, logger)
+	registerUser(broadcaster, "cfx_1", "12345", "IDR")
+	broadcaster.RegisterSubscription("cfx_1", "risk_1", "raw:user:12345:margin", "12345", "IDR")
+
+	err := broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, []byte(`{"cfx_user_id":"cfx_1","asset":"USDT"}`))
+	assert.ErrorContains(t, err, "no exchange rate available")
+	assert.NotErrorIs(t, err, ErrMalformedMessage)
+	assert.Empty(t, publisher.channels)
+}
@@ -0,0 +1,234 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// CheckpointPath is the admin route exporting (GET) and importing (POST) the consumer group offsets
+const CheckpointPath = "/kafka/checkpoint"
+
+// maxCheckpointBodyBytes bounds the request body of a checkpoint import
+const maxCheckpointBodyBytes = 1 << 20
+
+// checkpointTimeout bounds a checkpoint export or import, including leaving the consumer group
+const checkpointTimeout = 30 * time.Second
+
+// errInvalidCheckpoint marks checkpoints rejected before anything is committed
+var errInvalidCheckpoint = errors.New("invalid checkpoint")
+
+// PartitionOffset is the committed offset of one partition, i.e. the next message the group consumes
+type PartitionOffset struct {
+	Partition int   `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+// Checkpoint is the committed offsets of the consumer group, exported for disaster recovery
+type Checkpoint struct {
+	GroupID    string                       `json:"group_id"`
+	ExportedAt time.Time                    `json:"exported_at"`
+	Topics     map[string][]PartitionOffset `json:"topics"`
+}
+
+// checkpointHold pauses the consume loop between closing and recreating its reader while offsets are imported
+type checkpointHold struct {
+	// closed is closed by the consume loop once its reader has left the group
+	closed chan struct{}
+
+	// release is closed by the import once offsets are committed
+	release chan struct{}
+}
+
+// ExportCheckpoint returns the offsets committed by the consumer group for the consumed topics.
+// Partitions without a committed offset are left out.
+func (c *KafkaReaderConsumer) ExportCheckpoint(ctx context.Context) (Checkpoint, error) {
+	resp, err := c.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: c.groupID})
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if resp.Error != nil {
+		return Checkpoint{}, resp.Error
+	}
+
+	checkpoint := Checkpoint{
+		GroupID:    c.groupID,
+		ExportedAt: time.Now().UTC(),
+		Topics:     make(map[string][]PartitionOffset),
+	}
+	for topic, partitions := range resp.Topics {
+		if !slices.Contains(c.Topics(), topic) {
+			continue
+		}
+		for _, p := range partitions {
+			if p.Error != nil {
+				return Checkpoint{}, fmt.Errorf("topic %s partition %d: %w", topic, p.Partition, p.Error)
+			}
+			if p.CommittedOffset < 0 {
+				continue
+			}
+			checkpoint.Topics[topic] = append(checkpoint.Topics[topic], PartitionOffset{
+				Partition: p.Partition,
+				Offset:    p.CommittedOffset,
+			})
+		}
+		slices.SortFunc(checkpoint.Topics[topic], func(a, b PartitionOffset) int {
+			return a.Partition - b.Partition
+		})
+	}
+
+	return checkpoint, nil
+}
+
+// ImportCheckpoint commits the checkpoint offsets for the consumer group. This consumer leaves the group
+// while committing and resumes from the imported offsets. Kafka only accepts the commit when the group
+// has no other members, so other replicas must be scaled down first.
+func (c *KafkaReaderConsumer) ImportCheckpoint(ctx context.Context, checkpoint Checkpoint) error {
+	commits, err := c.checkpointCommits(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	hold := &checkpointHold{closed: make(chan struct{}), release: make(chan struct{})}
+	c.reconnectMu.Lock()
+	if c.reconnect == nil {
+		c.reconnectMu.Unlock()
+		return fmt.Errorf("consumer is not running")
+	}
+	if c.hold != nil {
+		c.reconnectMu.Unlock()
+		return fmt.Errorf("checkpoint import already in progress")
+	}
+	c.hold = hold
+	c.reconnect()
+	c.reconnectMu.Unlock()
+
+	defer func() {
+		c.reconnectMu.Lock()
+		c.hold = nil
+		c.reconnectMu.Unlock()
+		close(hold.release)
+	}()
+
+	select {
+	case <-hold.closed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// Generation -1 without a member ID is a standalone commit, accepted only by an empty group
+	resp, err := c.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      c.groupID,
+		GenerationID: -1,
+		Topics:       commits,
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for topic, partitions := range resp.Topics {
+		for _, p := range partitions {
+			if p.Error != nil {
+				errs = append(errs, fmt.Errorf("topic %s partition %d: %w", topic, p.Partition, p.Error))
+			}
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	c.logger.Warn("imported kafka offset checkpoint",
+		"group_id", c.groupID,
+		"checkpoint_group_id", checkpoint.GroupID,
+		"exported_at", checkpoint.ExportedAt,
+		"topics", len(commits))
+	return nil
+}
+
+// checkpointCommits validates the checkpoint against the consumed topics and converts it to offset commits
+func (c *KafkaReaderConsumer) checkpointCommits(checkpoint Checkpoint) (map[string][]kafka.OffsetCommit, error) {
+	if len(checkpoint.Topics) == 0 {
+		return nil, fmt.Errorf("%w: no topics", errInvalidCheckpoint)
+	}
+
+	commits := make(map[string][]kafka.OffsetCommit, len(checkpoint.Topics))
+	for topic, partitions := range checkpoint.Topics {
+		if !slices.Contains(c.Topics(), topic) {
+			return nil, fmt.Errorf("%w: topic %s is not consumed", errInvalidCheckpoint, topic)
+		}
+		for _, p := range partitions {
+			if p.Partition < 0 || p.Offset < 0 {
+				return nil, fmt.Errorf("%w: topic %s has a negative partition or offset", errInvalidCheckpoint, topic)
+			}
+			commits[topic] = append(commits[topic], kafka.OffsetCommit{Partition: p.Partition, Offset: p.Offset})
+		}
+	}
+	return commits, nil
+}
+
+// waitForImport blocks a reader replacement while a checkpoint import commits offsets
+func (c *KafkaReaderConsumer) waitForImport(ctx context.Context) {
+	c.reconnectMu.Lock()
+	hold := c.hold
+	c.reconnectMu.Unlock()
+
+	if hold == nil {
+		return
+	}
+	close(hold.closed)
+
+	select {
+	case <-hold.release:
+	case <-ctx.Done():
+	}
+}
+
+// CheckpointHandler returns the admin HTTP handler exporting (GET) and importing (POST) a checkpoint
+func (c *KafkaReaderConsumer) CheckpointHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkpointTimeout)
+		defer cancel()
+
+		switch r.Method {
+		case http.MethodGet:
+			checkpoint, err := c.ExportCheckpoint(ctx)
+			if err != nil {
+				c.logger.Error("failed to export kafka checkpoint", "group_id", c.groupID, "error", err)
+				http.Error(w, "failed to export checkpoint", http.StatusBadGateway)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(checkpoint); err != nil {
+				c.logger.Error("failed to encode kafka checkpoint", "error", err)
+			}
+		case http.MethodPost:
+			var checkpoint Checkpoint
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCheckpointBodyBytes)).Decode(&checkpoint); err != nil {
+				http.Error(w, "invalid checkpoint", http.StatusBadRequest)
+				return
+			}
+
+			if err := c.ImportCheckpoint(ctx, checkpoint); err != nil {
+				if errors.Is(err, errInvalidCheckpoint) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				c.logger.Error("failed to import kafka checkpoint", "group_id", c.groupID, "error", err)
+				http.Error(w, "failed to import checkpoint: "+err.Error(), http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestConsumer creates a consumer that is never started
+func newTestConsumer(t *testing.T) *KafkaReaderConsumer {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewKafkaReaderConsumer(&ConsumerConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: "test-group",
+		Topics:  []string{"margin", "position"},
+		Handler: func(ctx context.Context, topic string, key []byte, value []byte) error { return nil },
+	}, logger)
+	require.NoError(t, err)
+	return consumer
+}
+
+// TestCheckpointCommits tests validation of imported checkpoints against the consumed topics
+func TestCheckpointCommits(t *testing.T) {
+	consumer := newTestConsumer(t)
+
+	commits, err := consumer.checkpointCommits(Checkpoint{Topics: map[string][]PartitionOffset{
+		"margin": {{Partition: 0, Offset: 42}, {Partition: 1, Offset: 7}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, commits["margin"], 2)
+	assert.Equal(t, int64(42), commits["margin"][0].Offset)
+
+	for _, checkpoint := range []Checkpoint{
+		{},
+		{Topics: map[string][]PartitionOffset{"other": {{Partition: 0, Offset: 1}}}},
+		{Topics: map[string][]PartitionOffset{"margin": {{Partition: 0, Offset: -1}}}},
+	} {
+		_, err := consumer.checkpointCommits(checkpoint)
+		assert.ErrorIs(t, err, errInvalidCheckpoint)
+	}
+}
+
+// TestCheckpointHandler tests rejected imports and methods of the checkpoint endpoint
+func TestCheckpointHandler(t *testing.T) {
+	consumer := newTestConsumer(t)
+	handler := consumer.CheckpointHandler()
+
+	post := func(body string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, CheckpointPath, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post("not json"))
+	assert.Equal(t, http.StatusBadRequest, post(`{"topics":{"other":[{"partition":0,"offset":1}]}}`))
+
+	// A consumer that is not consuming has no reader to pause
+	assert.Equal(t, http.StatusConflict, post(`{"topics":{"margin":[{"partition":0,"offset":1}]}}`))
+	assert.Error(t, consumer.ImportCheckpoint(context.Background(), Checkpoint{
+		Topics: map[string][]PartitionOffset{"margin": {{Partition: 0, Offset: 1}}},
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, CheckpointPath, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
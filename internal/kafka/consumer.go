@@ -4,12 +4,17 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"regexp"
 	"sync"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// joinPollInterval is how often a starting consumer checks whether its group has assigned it partitions
+const joinPollInterval = 250 * time.Millisecond
+
 // Consumer defines the interface for Kafka consumption
 type Consumer interface {
 	Start(ctx context.Context) error
@@ -18,6 +23,21 @@ type Consumer interface {
 	Stats() ConsumerStats
 }
 
+// ManagedConsumer is a Consumer supervised by the service: watched for stalls, reconnected, and
+// checkpointed through the admin server (implemented by KafkaReaderConsumer and TopicConsumers)
+type ManagedConsumer interface {
+	Consumer
+	LastActivity() time.Time
+	Reconnect()
+	CheckpointHandler() http.Handler
+
+	// FetchDelay reports how old the last fetched message was when it was fetched
+	FetchDelay() time.Duration
+
+	// Joined reports whether the consumer has joined its group and been assigned partitions
+	Joined() bool
+}
+
 // ConsumerStats holds statistics about the consumer
 type ConsumerStats struct {
 	MessagesConsumed int64
@@ -25,21 +45,72 @@ type ConsumerStats struct {
 	MessagesStale    int64
 	LastMessageTime  time.Time
 	Connected        bool
+
+	// LastFetchTime is when the consumer started or last fetched a message, whether or not it was handled
+	LastFetchTime time.Time
+
+	// FetchDelay is how old the last fetched message was by its Kafka timestamp, the consumer's lag in time
+	FetchDelay time.Duration
+
+	// Restarts counts readers recreated after repeated fetch errors; Recoveries counts restarts
+	// followed by a successful fetch
+	Restarts        int64
+	Recoveries      int64
+	LastRestartTime time.Time
+
+	// Paused is set while fetching is paused by an operator or an exhausted error budget;
+	// BudgetExhaustions counts the pauses caused by the error budget
+	Paused            bool
+	BudgetExhaustions int64
+
+	// Joined is set once the consumer has joined its group and been assigned partitions; it stays set
+	// across reconnects
+	Joined bool
 }
 
-// MessageHandler is a function that processes Kafka messages
-type MessageHandler func(topic string, key []byte, value []byte) error
+// MessageHandler is a function that processes Kafka messages; ctx is canceled when the consumer stops
+type MessageHandler func(ctx context.Context, topic string, key []byte, value []byte) error
 
 // KafkaReaderConsumer implements the Consumer interface using segmentio/kafka-go
 type KafkaReaderConsumer struct {
 	brokers       []string
 	groupID       string
-	topics        []string
 	handler       MessageHandler
 	reader        *kafka.Reader
+	readerConfig  kafka.ReaderConfig
+	client        *kafka.Client
 	logger        *slog.Logger
 	maxMessageAge time.Duration
 
+	// topics are the consumed topics, the explicit ones plus those matching topicPattern, rediscovered
+	// every topicRefresh; topicsMu guards them with the reader configuration's topics
+	topics         []string
+	explicitTopics []string
+	topicPattern   *regexp.Regexp
+	topicRefresh   time.Duration
+	topicsMu       sync.RWMutex
+
+	// reconnect cancels the current reader's fetch so the consume loop replaces the reader
+	reconnect   context.CancelFunc
+	reconnectMu sync.Mutex
+
+	// hold is set while a checkpoint import waits for the reader to leave the group
+	hold *checkpointHold
+
+	// restarter replaces the reader after repeated fetch errors; only used by the consume loop
+	restarter fetchRestarter
+
+	// budget pauses the consume loop for budgetPause when handlers fail too many messages
+	budget      *errorBudget
+	budgetPause time.Duration
+	pause       pauseGate
+
+	// globalBudget pauses every consumer sharing it when their handlers together fail too many messages
+	globalBudget *ErrorBudget
+
+	// retry retries a failed message with backoff before moving on
+	retry handlerRetry
+
 	stats   ConsumerStats
 	statsMu sync.RWMutex
 	cancel  context.CancelFunc
@@ -61,6 +132,33 @@ type ConsumerConfig struct {
 	FetchMax          int32
 	FetchDefault      int32
 	MaxMessageAge     time.Duration
+	Security          SecurityConfig
+
+	// RestartAfterErrors recreates the reader after this many consecutive fetch errors (0 disables restarts),
+	// backing off exponentially between RestartBackoffMin and RestartBackoffMax until a fetch succeeds
+	RestartAfterErrors int
+	RestartBackoffMin  time.Duration
+	RestartBackoffMax  time.Duration
+
+	// ErrorBudget pauses the consumer for ErrorBudgetPause (until resumed when zero) once handlers fail
+	// this many messages within ErrorBudgetWindow; zero disables the budget
+	ErrorBudget       int
+	ErrorBudgetWindow time.Duration
+	ErrorBudgetPause  time.Duration
+
+	// GlobalErrorBudget is shared by every consumer of the service, pausing them all when exhausted
+	GlobalErrorBudget *ErrorBudget
+
+	// HandlerAttempts is the number of times a failed message is handled before it is skipped (1 or less
+	// disables retries), backing off exponentially between HandlerBackoffMin and HandlerBackoffMax
+	HandlerAttempts   int
+	HandlerBackoffMin time.Duration
+	HandlerBackoffMax time.Duration
+
+	// TopicPattern additionally consumes every topic whose whole name matches this regular expression,
+	// rediscovered every TopicRefresh (a minute when zero)
+	TopicPattern string
+	TopicRefresh time.Duration
 }
 
 // NewKafkaReaderConsumer creates a new Kafka consumer using kafka-go
@@ -77,7 +175,12 @@ func NewKafkaReaderConsumer(config *ConsumerConfig, logger *slog.Logger) (*Kafka
 		return nil, fmt.Errorf("group_id cannot be empty")
 	}
 
-	if len(config.Topics) == 0 {
+	topicPattern, err := compileTopicPattern(config.TopicPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.Topics) == 0 && topicPattern == nil {
 		return nil, fmt.Errorf("topics cannot be empty")
 	}
 
@@ -89,15 +192,37 @@ func NewKafkaReaderConsumer(config *ConsumerConfig, logger *slog.Logger) (*Kafka
 		config.InitialOffset = "latest"
 	}
 
+	if config.TopicRefresh <= 0 {
+		config.TopicRefresh = defaultTopicRefresh
+	}
+
 	startOffset := getInitialOffset(config.InitialOffset)
 
+	dialer, err := config.Security.NewDialer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka dialer: %w", err)
+	}
+
+	transport, err := config.Security.NewTransport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka transport: %w", err)
+	}
+
 	consumer := &KafkaReaderConsumer{
-		brokers:       config.Brokers,
-		groupID:       config.GroupID,
-		topics:        config.Topics,
-		handler:       config.Handler,
-		logger:        logger,
-		maxMessageAge: config.MaxMessageAge,
+		brokers:        config.Brokers,
+		groupID:        config.GroupID,
+		topics:         config.Topics,
+		explicitTopics: config.Topics,
+		topicPattern:   topicPattern,
+		topicRefresh:   config.TopicRefresh,
+		handler:        config.Handler,
+		logger:         logger,
+		maxMessageAge:  config.MaxMessageAge,
+		restarter:      newFetchRestarter(config.RestartAfterErrors, config.RestartBackoffMin, config.RestartBackoffMax),
+		budget:         newErrorBudget(config.ErrorBudget, config.ErrorBudgetWindow),
+		budgetPause:    config.ErrorBudgetPause,
+		globalBudget:   config.GlobalErrorBudget,
+		retry:          newHandlerRetry(config.HandlerAttempts, config.HandlerBackoffMin, config.HandlerBackoffMax),
 		stats: ConsumerStats{
 			Connected: false,
 		},
@@ -108,6 +233,7 @@ func NewKafkaReaderConsumer(config *ConsumerConfig, logger *slog.Logger) (*Kafka
 		Brokers:           config.Brokers,
 		GroupID:           config.GroupID,
 		GroupTopics:       config.Topics,
+		Dialer:            dialer,
 		StartOffset:       startOffset,
 		SessionTimeout:    config.SessionTimeout,
 		HeartbeatInterval: config.HeartbeatInterval,
@@ -121,41 +247,95 @@ func NewKafkaReaderConsumer(config *ConsumerConfig, logger *slog.Logger) (*Kafka
 		CommitInterval: time.Second,
 	}
 
-	consumer.reader = kafka.NewReader(readerConfig)
+	consumer.readerConfig = readerConfig
+
+	// With a topic pattern, the reader is created once Start discovered the topics
+	if topicPattern == nil {
+		consumer.reader = kafka.NewReader(readerConfig)
+	}
+
+	// The admin client exports and imports offset checkpoints of the group
+	consumer.client = &kafka.Client{
+		Addr:      kafka.TCP(config.Brokers...),
+		Timeout:   10 * time.Second,
+		Transport: transport,
+	}
 
 	return consumer, nil
 }
 
 func (c *KafkaReaderConsumer) Start(ctx context.Context) error {
+	if c.topicPattern != nil {
+		topics, err := c.discoverTopics(ctx)
+		if err != nil {
+			return err
+		}
+		if len(topics) == 0 {
+			return fmt.Errorf("no kafka topics match pattern %s", c.topicPattern)
+		}
+		c.setTopics(topics)
+		c.reader = c.newReader()
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	c.cancel = cancel
 
 	c.setConnected(true)
+	c.touchFetch()
 	c.logger.Info("kafka consumer started",
 		"brokers", c.brokers,
 		"group_id", c.groupID,
-		"topics", c.topics)
+		"topics", c.Topics())
+
+	go c.watchJoin(ctx, c.reader.Stats)
+	if c.topicPattern != nil {
+		go c.watchTopics(ctx)
+	}
 
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
+		fetchCtx := c.newFetchContext(ctx)
 		for {
 			select {
 			case <-ctx.Done():
 				c.logger.Info("kafka consumer context cancelled, stopping")
 				return
 			default:
-				msg, err := c.reader.FetchMessage(ctx)
+				if !c.waitWhilePaused(ctx) {
+					return
+				}
+
+				msg, err := c.reader.FetchMessage(fetchCtx)
 				if err != nil {
 					if ctx.Err() != nil {
 						// Context was cancelled, exit
 						return
 					}
 
+					if fetchCtx.Err() != nil {
+						// Reconnect was requested: replace the reader and resume fetching
+						c.replaceReader(ctx)
+						fetchCtx = c.newFetchContext(ctx)
+						continue
+					}
+
 					c.logger.Error("error fetching message", "error", err)
 					c.incrementMessagesErrors()
+
+					if restart, backoff := c.restarter.failed(); restart {
+						if !c.restart(ctx, backoff) {
+							return
+						}
+						fetchCtx = c.newFetchContext(ctx)
+					}
 					continue
 				}
+				c.touchFetch()
+				c.recordFetchDelay(msg.Time)
+				if c.restarter.succeeded() {
+					c.recovered()
+				}
 
 				// Skip stale messages when max age is configured
 				if c.maxMessageAge > 0 && !msg.Time.IsZero() && time.Since(msg.Time) > c.maxMessageAge {
@@ -177,13 +357,17 @@ func (c *KafkaReaderConsumer) Start(ctx context.Context) error {
 					continue
 				}
 
-				if err := c.handler(msg.Topic, msg.Key, msg.Value); err != nil {
+				if err := c.handle(ctx, msg); err != nil {
 					c.logger.Error("error processing message",
 						"topic", msg.Topic,
 						"partition", msg.Partition,
 						"offset", msg.Offset,
 						"error", err)
 					c.incrementMessagesErrors()
+					if c.budget.spend(time.Now()) {
+						c.exhaustedBudget()
+					}
+					c.globalBudget.spend()
 				} else {
 					c.incrementMessagesConsumed()
 				}
@@ -202,6 +386,121 @@ func (c *KafkaReaderConsumer) Start(ctx context.Context) error {
 	return nil
 }
 
+// watchJoin marks the consumer joined once stats report the first group generation of its reader
+func (c *KafkaReaderConsumer) watchJoin(ctx context.Context, stats func() kafka.ReaderStats) {
+	ticker := time.NewTicker(joinPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if stats().Rebalances > 0 {
+			c.statsMu.Lock()
+			c.stats.Joined = true
+			c.statsMu.Unlock()
+
+			c.logger.Info("kafka consumer joined group", "group_id", c.groupID)
+			return
+		}
+	}
+}
+
+// Joined reports whether the consumer has joined its group and been assigned partitions
+func (c *KafkaReaderConsumer) Joined() bool {
+	c.statsMu.RLock()
+	defer c.statsMu.RUnlock()
+	return c.stats.Joined
+}
+
+// Reconnect drops the current broker connections and consumes through a new reader. The consumer
+// rejoins its group, so partitions are rebalanced; committed offsets are kept.
+func (c *KafkaReaderConsumer) Reconnect() {
+	c.reconnectMu.Lock()
+	defer c.reconnectMu.Unlock()
+
+	if c.reconnect != nil {
+		c.reconnect()
+	}
+}
+
+// newFetchContext derives the context of the current reader's fetches, cancelled by Reconnect
+func (c *KafkaReaderConsumer) newFetchContext(ctx context.Context) context.Context {
+	fetchCtx, cancel := context.WithCancel(ctx)
+
+	c.reconnectMu.Lock()
+	c.reconnect = cancel
+	c.reconnectMu.Unlock()
+
+	return fetchCtx
+}
+
+// replaceReader closes the current reader and creates a new one from the same configuration,
+// waiting in between for a pending checkpoint import
+func (c *KafkaReaderConsumer) replaceReader(ctx context.Context) {
+	c.logger.Warn("reconnecting kafka consumer", "group_id", c.groupID, "topics", c.Topics())
+
+	if err := c.reader.Close(); err != nil {
+		c.logger.Error("error closing reader during reconnect", "error", err)
+	}
+	c.waitForImport(ctx)
+	c.reader = c.newReader()
+	if !c.Joined() {
+		go c.watchJoin(ctx, c.reader.Stats)
+	}
+}
+
+// restart waits for the backoff and replaces the reader, which leaves and rejoins the consumer group.
+// It returns false when ctx is cancelled while waiting.
+func (c *KafkaReaderConsumer) restart(ctx context.Context, backoff time.Duration) bool {
+	c.logger.Warn("restarting kafka consumer after repeated fetch errors",
+		"group_id", c.groupID,
+		"consecutive_errors", c.restarter.threshold,
+		"backoff", backoff.String())
+
+	c.statsMu.Lock()
+	c.stats.Connected = false
+	c.stats.Restarts++
+	c.stats.LastRestartTime = time.Now()
+	c.statsMu.Unlock()
+
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+	}
+
+	c.replaceReader(ctx)
+	return true
+}
+
+// exhaustedBudget pauses the consumer after too many handler errors
+func (c *KafkaReaderConsumer) exhaustedBudget() {
+	c.statsMu.Lock()
+	c.stats.BudgetExhaustions++
+	c.statsMu.Unlock()
+
+	c.pauseFor(c.budgetPause, "error budget exhausted")
+}
+
+// recovered marks the consumer connected again after a restart
+func (c *KafkaReaderConsumer) recovered() {
+	c.statsMu.Lock()
+	c.stats.Connected = true
+	c.stats.Recoveries++
+	restartedAt := c.stats.LastRestartTime
+	c.statsMu.Unlock()
+
+	c.logger.Info("kafka consumer recovered",
+		"group_id", c.groupID,
+		"down_for", time.Since(restartedAt).String())
+}
+
 // Close gracefully shuts down the consumer
 func (c *KafkaReaderConsumer) Close() error {
 	c.logger.Info("closing kafka consumer")
@@ -231,6 +530,48 @@ func (c *KafkaReaderConsumer) IsHealthy() bool {
 	return c.stats.Connected
 }
 
+// Stats returns consumption statistics
+func (c *KafkaReaderConsumer) Stats() ConsumerStats {
+	c.statsMu.RLock()
+	defer c.statsMu.RUnlock()
+	return c.stats
+}
+
+// LastActivity returns when the consumer started or last fetched a message. A paused consumer is idle
+// on purpose and reports the current time, so it is not reconnected as stalled.
+func (c *KafkaReaderConsumer) LastActivity() time.Time {
+	c.statsMu.RLock()
+	defer c.statsMu.RUnlock()
+	if c.stats.Paused || c.globalBudget.Paused() {
+		return time.Now()
+	}
+	return c.stats.LastFetchTime
+}
+
+// touchFetch records message activity
+func (c *KafkaReaderConsumer) touchFetch() {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.LastFetchTime = time.Now()
+}
+
+// recordFetchDelay records the age of a fetched message; messages without a timestamp leave it unchanged
+func (c *KafkaReaderConsumer) recordFetchDelay(messageTime time.Time) {
+	if messageTime.IsZero() {
+		return
+	}
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.FetchDelay = max(time.Since(messageTime), 0)
+}
+
+// FetchDelay returns how old the last fetched message was when it was fetched
+func (c *KafkaReaderConsumer) FetchDelay() time.Duration {
+	c.statsMu.RLock()
+	defer c.statsMu.RUnlock()
+	return c.stats.FetchDelay
+}
+
 // incrementMessagesConsumed increments the consumed message counter
 func (c *KafkaReaderConsumer) incrementMessagesConsumed() {
 	c.statsMu.Lock()
@@ -0,0 +1,122 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// defaultTopicRefresh is how often a consumer with a topic pattern rediscovers its topics
+const defaultTopicRefresh = time.Minute
+
+// compileTopicPattern compiles a topic pattern anchored to whole topic names, nil when empty
+func compileTopicPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid topic pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// matchTopics returns the sorted topics listed explicitly or matching pattern. Internal topics and
+// topics whose metadata failed to load never match.
+func matchTopics(pattern *regexp.Regexp, explicit []string, cluster []kafka.Topic) []string {
+	topics := slices.Clone(explicit)
+	for _, t := range cluster {
+		if t.Internal || t.Error != nil || !pattern.MatchString(t.Name) {
+			continue
+		}
+		topics = append(topics, t.Name)
+	}
+	slices.Sort(topics)
+	return slices.Compact(topics)
+}
+
+// discoverTopics lists the cluster's topics and returns those the consumer should consume
+func (c *KafkaReaderConsumer) discoverTopics(ctx context.Context) ([]string, error) {
+	resp, err := c.client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list kafka topics: %w", err)
+	}
+	return matchTopics(c.topicPattern, c.explicitTopics, resp.Topics), nil
+}
+
+// Topics returns the topics currently consumed
+func (c *KafkaReaderConsumer) Topics() []string {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	return c.topics
+}
+
+// setTopics replaces the consumed topics and reports whether they changed. The current reader keeps
+// its topics until it is replaced.
+func (c *KafkaReaderConsumer) setTopics(topics []string) bool {
+	c.topicsMu.Lock()
+	defer c.topicsMu.Unlock()
+
+	if slices.Equal(c.topics, topics) {
+		return false
+	}
+	c.topics = topics
+	c.readerConfig.GroupTopics = topics
+	return true
+}
+
+// newReader creates a reader of the current topics
+func (c *KafkaReaderConsumer) newReader() *kafka.Reader {
+	c.topicsMu.RLock()
+	defer c.topicsMu.RUnlock()
+	return kafka.NewReader(c.readerConfig)
+}
+
+// watchTopics rediscovers the topics matching the pattern every refresh interval and reconnects when
+// they changed, so new topics are consumed without a restart
+func (c *KafkaReaderConsumer) watchTopics(ctx context.Context) {
+	ticker := time.NewTicker(c.topicRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		topics, err := c.discoverTopics(ctx)
+		if err != nil {
+			c.logger.Warn("kafka topic discovery failed, keeping current topics", "error", err)
+			continue
+		}
+		if len(topics) == 0 {
+			c.logger.Warn("no kafka topics match the pattern, keeping current topics", "pattern", c.topicPattern.String())
+			continue
+		}
+
+		previous := c.Topics()
+		if !c.setTopics(topics) {
+			continue
+		}
+		c.logger.Info("kafka topics changed, reconnecting",
+			"added", topicsMissing(topics, previous),
+			"removed", topicsMissing(previous, topics))
+		c.Reconnect()
+	}
+}
+
+// topicsMissing returns the topics of a missing from b
+func topicsMissing(a, b []string) []string {
+	var missing []string
+	for _, topic := range a {
+		if !slices.Contains(b, topic) {
+			missing = append(missing, topic)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,67 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMatchTopics tests that whole topic names are matched and merged with the explicit topics
+func TestMatchTopics(t *testing.T) {
+	pattern, err := compileTopicPattern(`com\.ajaib\.coin\.cfx\.streamer\.futures\.message\..*`)
+	require.NoError(t, err)
+
+	cluster := []kafka.Topic{
+		{Name: "com.ajaib.coin.cfx.streamer.futures.message.UserPosition"},
+		{Name: "com.ajaib.coin.cfx.streamer.futures.message.UserMargin"},
+		{Name: "com.ajaib.coin.cfx.streamer.futures.message.UserOrder"},
+		{Name: "dlq.com.ajaib.coin.cfx.streamer.futures.message.UserOrder"},
+		{Name: "com.ajaib.coin.cfx.streamer.futures.message.Broken", Error: errors.New("leader not available")},
+		{Name: "__consumer_offsets", Internal: true},
+	}
+	topics := matchTopics(pattern, []string{"com.ajaib.coin.cfx.streamer.futures.message.UserMargin", "rates"}, cluster)
+	assert.Equal(t, []string{
+		"com.ajaib.coin.cfx.streamer.futures.message.UserMargin",
+		"com.ajaib.coin.cfx.streamer.futures.message.UserOrder",
+		"com.ajaib.coin.cfx.streamer.futures.message.UserPosition",
+		"rates",
+	}, topics)
+
+	_, err = compileTopicPattern("(")
+	assert.ErrorContains(t, err, "invalid topic pattern")
+}
+
+// TestTopicPatternConsumer tests that a pattern replaces the topic list and that topic changes are detected
+func TestTopicPatternConsumer(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	config := &ConsumerConfig{
+		Brokers:      []string{"localhost:9092"},
+		GroupID:      "test-group",
+		TopicPattern: `futures\..*`,
+		Handler:      func(ctx context.Context, topic string, key []byte, value []byte) error { return nil },
+	}
+	consumer, err := NewKafkaReaderConsumer(config, logger)
+	require.NoError(t, err)
+	assert.Nil(t, consumer.reader)
+	assert.Equal(t, defaultTopicRefresh, consumer.topicRefresh)
+
+	assert.True(t, consumer.setTopics([]string{"futures.margin"}))
+	assert.False(t, consumer.setTopics([]string{"futures.margin"}))
+	assert.True(t, consumer.setTopics([]string{"futures.margin", "futures.order"}))
+	assert.Equal(t, []string{"futures.margin", "futures.order"}, consumer.Topics())
+	assert.Equal(t, []string{"futures.margin", "futures.order"}, consumer.readerConfig.GroupTopics)
+	assert.Equal(t, []string{"futures.order"}, topicsMissing(consumer.Topics(), []string{"futures.margin"}))
+
+	_, err = NewTopicConsumers(config, false, logger)
+	assert.Error(t, err)
+
+	config.TopicPattern = ""
+	_, err = NewKafkaReaderConsumer(config, logger)
+	assert.ErrorContains(t, err, "topics cannot be empty")
+}
@@ -0,0 +1,56 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Kafka key formats
+const (
+	// KeyFormatNone ignores keys; every message is decoded to find its user
+	KeyFormatNone = "none"
+
+	// KeyFormatString reads the key as the raw cfx_user_id
+	KeyFormatString = "string"
+
+	// KeyFormatJSON reads the cfx_user_id field of a JSON object key
+	KeyFormatJSON = "json"
+)
+
+// KeyDecoder extracts the cfx_user_id a producer keyed a message by. It reports false when the key
+// doesn't carry one, and the message is then routed by its payload.
+type KeyDecoder func(key []byte) (string, bool)
+
+// NewKeyDecoder returns the decoder of a key format, or nil for none
+func NewKeyDecoder(format string) (KeyDecoder, error) {
+	switch strings.ToLower(format) {
+	case "", KeyFormatNone:
+		return nil, nil
+	case KeyFormatString:
+		return decodeStringKey, nil
+	case KeyFormatJSON:
+		return decodeJSONKey, nil
+	default:
+		return nil, fmt.Errorf("unknown kafka key format %q, want none, string or json", format)
+	}
+}
+
+// decodeStringKey reads the key as the cfx_user_id
+func decodeStringKey(key []byte) (string, bool) {
+	if len(key) == 0 {
+		return "", false
+	}
+	return string(key), true
+}
+
+// decodeJSONKey reads the cfx_user_id field of a JSON object key
+func decodeJSONKey(key []byte) (string, bool) {
+	var k struct {
+		CFXUserID string `json:"cfx_user_id"`
+	}
+	if len(key) == 0 || json.Unmarshal(key, &k) != nil || k.CFXUserID == "" {
+		return "", false
+	}
+	return k.CFXUserID, true
+}
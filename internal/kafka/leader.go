@@ -0,0 +1,98 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// LeaderConfig configures leader election through a Kafka consumer group
+type LeaderConfig struct {
+	Brokers []string
+
+	// Topic must have exactly one partition; the group member assigned it leads
+	Topic   string
+	GroupID string
+
+	// SessionTimeout bounds how long a crashed leader holds leadership before the group rebalances
+	SessionTimeout    time.Duration
+	HeartbeatInterval time.Duration
+
+	Security SecurityConfig
+}
+
+// LeaderElector elects a leader among replicas joining the same consumer group on a single-partition
+// topic. No messages are read; the group coordinator only assigns the partition to one member at a time.
+// A replica cut off from the coordinator keeps leading until its session times out, so tasks must
+// tolerate a brief overlap.
+type LeaderElector struct {
+	config LeaderConfig
+	dialer *kafka.Dialer
+	logger *slog.Logger
+}
+
+// NewLeaderElector creates an elector for the group and topic
+func NewLeaderElector(config LeaderConfig, logger *slog.Logger) (*LeaderElector, error) {
+	if len(config.Brokers) == 0 {
+		return nil, fmt.Errorf("brokers cannot be empty")
+	}
+	if config.Topic == "" {
+		return nil, fmt.Errorf("leader topic cannot be empty")
+	}
+	if config.GroupID == "" {
+		return nil, fmt.Errorf("leader group id cannot be empty")
+	}
+
+	dialer, err := config.Security.NewDialer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka dialer: %w", err)
+	}
+
+	return &LeaderElector{config: config, dialer: dialer, logger: logger}, nil
+}
+
+// Campaign joins the group and calls lead for every generation assigning this replica the leader
+// partition, until ctx is cancelled
+func (e *LeaderElector) Campaign(ctx context.Context, lead func(ctx context.Context)) error {
+	group, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:                e.config.GroupID,
+		Brokers:           e.config.Brokers,
+		Dialer:            e.dialer,
+		Topics:            []string{e.config.Topic},
+		SessionTimeout:    e.config.SessionTimeout,
+		HeartbeatInterval: e.config.HeartbeatInterval,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to join leader group: %w", err)
+	}
+	defer group.Close()
+
+	e.logger.Info("campaigning for leadership", "group_id", e.config.GroupID, "topic", e.config.Topic)
+
+	for {
+		// Next returns once the previous generation ended and its lead call returned
+		gen, err := group.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, kafka.ErrGroupClosed) {
+				return ctx.Err()
+			}
+			e.logger.Warn("leader group rebalance failed", "group_id", e.config.GroupID, "error", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		if len(gen.Assignments[e.config.Topic]) == 0 {
+			e.logger.Debug("not elected leader", "generation", gen.ID, "member_id", gen.MemberID)
+			continue
+		}
+		gen.Start(lead)
+	}
+}
@@ -0,0 +1,250 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// errorBudget counts handler errors in fixed windows and reports when a window exceeds its budget
+type errorBudget struct {
+	max    int
+	window time.Duration
+
+	mu      sync.Mutex
+	started time.Time
+	spent   int
+}
+
+// newErrorBudget creates a budget of max errors per window, or nil when max is zero
+func newErrorBudget(max int, window time.Duration) *errorBudget {
+	if max <= 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = time.Minute
+	}
+	return &errorBudget{max: max, window: window}
+}
+
+// spend records a handler error and reports whether it exhausted the budget, which starts a new window
+func (b *errorBudget) spend(now time.Time) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.started) > b.window {
+		b.started = now
+		b.spent = 0
+	}
+	b.spent++
+	if b.spent < b.max {
+		return false
+	}
+
+	b.started = now
+	b.spent = 0
+	return true
+}
+
+// pauseGate blocks consume loops while paused and wakes them on resume
+type pauseGate struct {
+	mu       sync.Mutex
+	paused   bool
+	resumeAt time.Time
+	resumed  chan struct{}
+}
+
+// pause closes the gate for d, or until resume when d is zero
+func (g *pauseGate) pause(d time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.paused {
+		g.paused = true
+		g.resumed = make(chan struct{})
+	}
+	g.resumeAt = time.Time{}
+	if d > 0 {
+		g.resumeAt = time.Now().Add(d)
+	}
+}
+
+// resume opens the gate and reports whether it was paused
+func (g *pauseGate) resume() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.paused {
+		return false
+	}
+	g.paused = false
+	close(g.resumed)
+	return true
+}
+
+// isPaused reports whether the gate is closed
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+// wait blocks while the gate is closed, calling onResume when a timed pause ends.
+// It returns false when ctx is cancelled.
+func (g *pauseGate) wait(ctx context.Context, onResume func()) bool {
+	for {
+		g.mu.Lock()
+		if !g.paused {
+			g.mu.Unlock()
+			return true
+		}
+		resumed, resumeAt := g.resumed, g.resumeAt
+		g.mu.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if !resumeAt.IsZero() {
+			timer = time.NewTimer(time.Until(resumeAt))
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return false
+		case <-resumed:
+		case <-timeout:
+			if g.resumeIfDue(resumeAt) {
+				onResume()
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// resumeIfDue resumes a timed pause unless it was paused again meanwhile
+func (g *pauseGate) resumeIfDue(resumeAt time.Time) bool {
+	g.mu.Lock()
+	due := g.paused && g.resumeAt.Equal(resumeAt)
+	g.mu.Unlock()
+
+	return due && g.resume()
+}
+
+// ErrorBudget pauses every consumer sharing it for a while once their handlers together fail too many
+// messages, instead of failing message after message while a dependency is down
+type ErrorBudget struct {
+	budget *errorBudget
+	pause  time.Duration
+	gate   pauseGate
+	logger *slog.Logger
+
+	exhaustions atomic.Int64
+}
+
+// NewErrorBudget creates a budget of max handler errors per window pausing consumption for pause,
+// or nil when max is zero
+func NewErrorBudget(max int, window, pause time.Duration, logger *slog.Logger) *ErrorBudget {
+	budget := newErrorBudget(max, window)
+	if budget == nil {
+		return nil
+	}
+	if pause <= 0 {
+		pause = 30 * time.Second
+	}
+	return &ErrorBudget{budget: budget, pause: pause, logger: logger}
+}
+
+// spend records a handler error, pausing consumption when it exhausts the budget
+func (b *ErrorBudget) spend() {
+	if b == nil || !b.budget.spend(time.Now()) {
+		return
+	}
+
+	b.exhaustions.Add(1)
+	b.gate.pause(b.pause)
+	b.logger.Warn("kafka error budget exhausted, pausing consumption",
+		"max_errors", b.budget.max,
+		"window", b.budget.window.String(),
+		"pause", b.pause.String())
+}
+
+// wait blocks while the budget pauses consumption. It returns false when ctx is cancelled.
+func (b *ErrorBudget) wait(ctx context.Context) bool {
+	if b == nil {
+		return true
+	}
+	return b.gate.wait(ctx, func() {
+		b.logger.Info("kafka error budget pause ended, resuming consumption")
+	})
+}
+
+// Paused reports whether the budget currently pauses consumption
+func (b *ErrorBudget) Paused() bool {
+	return b != nil && b.gate.isPaused()
+}
+
+// Exhaustions returns how many times the budget paused consumption
+func (b *ErrorBudget) Exhaustions() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.exhaustions.Load()
+}
+
+// Pause stops fetching until Resume. The reader stays in its consumer group, so partitions are not
+// rebalanced and consumption continues from the committed offsets.
+func (c *KafkaReaderConsumer) Pause() {
+	c.pauseFor(0, "operator request")
+}
+
+// pauseFor stops fetching for d, or until Resume when d is zero
+func (c *KafkaReaderConsumer) pauseFor(d time.Duration, reason string) {
+	c.pause.pause(d)
+	c.setPaused(true)
+	c.logger.Warn("kafka consumer paused",
+		"group_id", c.groupID,
+		"topics", c.Topics(),
+		"reason", reason,
+		"resume_after", d.String())
+}
+
+// Resume continues fetching after a pause
+func (c *KafkaReaderConsumer) Resume() {
+	if c.pause.resume() {
+		c.resumed()
+	}
+}
+
+// resumed records the end of a pause
+func (c *KafkaReaderConsumer) resumed() {
+	c.setPaused(false)
+	c.logger.Info("kafka consumer resumed", "group_id", c.groupID, "topics", c.Topics())
+}
+
+// Paused reports whether the consumer is paused, by an operator, its own error budget or the global one
+func (c *KafkaReaderConsumer) Paused() bool {
+	return c.pause.isPaused() || c.globalBudget.Paused()
+}
+
+// waitWhilePaused blocks the consume loop while paused. It returns false when ctx is cancelled.
+func (c *KafkaReaderConsumer) waitWhilePaused(ctx context.Context) bool {
+	return c.pause.wait(ctx, c.resumed) && c.globalBudget.wait(ctx)
+}
+
+// setPaused records the paused status in the stats
+func (c *KafkaReaderConsumer) setPaused(paused bool) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.stats.Paused = paused
+}
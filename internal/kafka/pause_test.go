@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorBudget tests that a budget is exhausted by max errors within a window and refills after it
+func TestErrorBudget(t *testing.T) {
+	assert.Nil(t, newErrorBudget(0, time.Minute))
+	assert.False(t, (*errorBudget)(nil).spend(time.Now()))
+
+	b := newErrorBudget(3, time.Minute)
+	now := time.Now()
+	assert.False(t, b.spend(now))
+	assert.False(t, b.spend(now))
+	assert.True(t, b.spend(now))
+
+	// Exhausting the budget starts a new window
+	assert.False(t, b.spend(now))
+
+	// Errors of an expired window are forgotten
+	assert.False(t, b.spend(now.Add(2*time.Minute)))
+	assert.False(t, b.spend(now.Add(2*time.Minute)))
+	assert.True(t, b.spend(now.Add(2*time.Minute)))
+}
+
+// TestPauseResume tests that the consume loop waits while paused until resumed or a timed pause ends
+func TestPauseResume(t *testing.T) {
+	consumer := newTestConsumer(t)
+	ctx := context.Background()
+	assert.True(t, consumer.waitWhilePaused(ctx))
+
+	consumer.Pause()
+	assert.True(t, consumer.Paused())
+	assert.True(t, consumer.Stats().Paused)
+	assert.WithinDuration(t, time.Now(), consumer.LastActivity(), time.Second, "paused consumers are not stalled")
+
+	done := make(chan bool)
+	go func() { done <- consumer.waitWhilePaused(ctx) }()
+	select {
+	case <-done:
+		t.Fatal("loop resumed while paused")
+	case <-time.After(20 * time.Millisecond):
+	}
+	consumer.Resume()
+	require.True(t, <-done)
+	assert.False(t, consumer.Stats().Paused)
+
+	// Timed pauses, as after an exhausted error budget, resume on their own
+	consumer.pauseFor(10*time.Millisecond, "test")
+	assert.True(t, consumer.waitWhilePaused(ctx))
+	assert.False(t, consumer.Paused())
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	consumer.Pause()
+	assert.False(t, consumer.waitWhilePaused(cancelled))
+}
@@ -0,0 +1,60 @@
+package producer
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds Prometheus metrics shared by all Kafka producers
+type Metrics struct {
+	messagesTotal *prometheus.CounterVec
+	writeDuration *prometheus.HistogramVec
+}
+
+// NewMetrics creates a new Metrics instance with Prometheus collectors
+func NewMetrics() *Metrics {
+	return &Metrics{
+		messagesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_producer_messages_total",
+				Help: "Total number of messages produced to Kafka by result",
+			},
+			[]string{"topic", "result"},
+		),
+		writeDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "kafka_producer_write_duration_seconds",
+				Help:    "Duration of synchronous Kafka writes including retries",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"topic"},
+		),
+	}
+}
+
+// Register registers all metrics with the default Prometheus registry
+func (m *Metrics) Register() error {
+	registry := prometheus.DefaultRegisterer
+
+	registry.MustRegister(
+		m.messagesTotal,
+		m.writeDuration,
+	)
+
+	return nil
+}
+
+// RecordMessages records the delivery result of produced messages
+func (m *Metrics) RecordMessages(topic string, count int, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.messagesTotal.WithLabelValues(topic, result).Add(float64(count))
+}
+
+// ObserveWrite records the duration of a synchronous write
+func (m *Metrics) ObserveWrite(topic string, duration time.Duration) {
+	m.writeDuration.WithLabelValues(topic).Observe(duration.Seconds())
+}
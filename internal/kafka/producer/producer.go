@@ -0,0 +1,243 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	ikafka "coin-futures-websocket/internal/kafka"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Producer defines the interface for publishing messages to Kafka
+type Producer interface {
+	Publish(ctx context.Context, key []byte, value []byte) error
+	Close() error
+}
+
+// ProducerStats holds statistics about the producer
+type ProducerStats struct {
+	MessagesProduced int64
+	MessagesFailed   int64
+	LastMessageTime  time.Time
+}
+
+// Config holds configuration for the Kafka producer
+type Config struct {
+	Brokers      []string
+	Topic        string
+	BatchSize    int
+	BatchBytes   int64
+	BatchTimeout time.Duration
+	MaxAttempts  int
+	BackoffMin   time.Duration
+	BackoffMax   time.Duration
+	RequiredAcks string
+	Compression  string
+	// Async makes Publish return immediately; delivery failures are only logged and counted
+	Async    bool
+	Security ikafka.SecurityConfig
+}
+
+// KafkaWriterProducer implements the Producer interface using segmentio/kafka-go
+type KafkaWriterProducer struct {
+	topic   string
+	async   bool
+	writer  *kafka.Writer
+	logger  *slog.Logger
+	metrics *Metrics
+
+	stats   ProducerStats
+	statsMu sync.RWMutex
+}
+
+// NewKafkaWriterProducer creates a new batching Kafka producer for a single topic
+func NewKafkaWriterProducer(config *Config, logger *slog.Logger) (*KafkaWriterProducer, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	if len(config.Brokers) == 0 {
+		return nil, fmt.Errorf("brokers cannot be empty")
+	}
+
+	if config.Topic == "" {
+		return nil, fmt.Errorf("topic cannot be empty")
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+
+	if config.BatchTimeout <= 0 {
+		config.BatchTimeout = 100 * time.Millisecond
+	}
+
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+
+	if config.BackoffMin <= 0 {
+		config.BackoffMin = 100 * time.Millisecond
+	}
+
+	if config.BackoffMax <= 0 {
+		config.BackoffMax = time.Second
+	}
+
+	requiredAcks, err := getRequiredAcks(config.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+
+	compression, err := getCompression(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := config.Security.NewTransport()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka transport: %w", err)
+	}
+
+	p := &KafkaWriterProducer{
+		topic:  config.Topic,
+		async:  config.Async,
+		logger: logger,
+	}
+
+	p.writer = &kafka.Writer{
+		Addr:            kafka.TCP(config.Brokers...),
+		Topic:           config.Topic,
+		Balancer:        &kafka.Hash{},
+		BatchSize:       config.BatchSize,
+		BatchBytes:      config.BatchBytes,
+		BatchTimeout:    config.BatchTimeout,
+		MaxAttempts:     config.MaxAttempts,
+		WriteBackoffMin: config.BackoffMin,
+		WriteBackoffMax: config.BackoffMax,
+		RequiredAcks:    requiredAcks,
+		Compression:     compression,
+		Transport:       transport,
+		Async:           config.Async,
+	}
+
+	// Async writes report delivery results through the completion callback
+	if config.Async {
+		p.writer.Completion = p.onCompletion
+	}
+
+	return p, nil
+}
+
+// SetMetrics sets the metrics collector for the producer
+func (p *KafkaWriterProducer) SetMetrics(metrics *Metrics) {
+	p.metrics = metrics
+}
+
+// Publish writes a message to the producer's topic, retrying transient failures
+func (p *KafkaWriterProducer) Publish(ctx context.Context, key []byte, value []byte) error {
+	start := time.Now()
+	err := p.writer.WriteMessages(ctx, kafka.Message{
+		Key:   key,
+		Value: value,
+	})
+
+	// In async mode the delivery result arrives via onCompletion
+	if p.async {
+		return err
+	}
+
+	if p.metrics != nil {
+		p.metrics.ObserveWrite(p.topic, time.Since(start))
+	}
+	p.recordResult(1, err)
+
+	if err != nil {
+		return fmt.Errorf("failed to write kafka message to %s: %w", p.topic, err)
+	}
+	return nil
+}
+
+// Close flushes pending messages and closes the underlying writer
+func (p *KafkaWriterProducer) Close() error {
+	p.logger.Info("closing kafka producer", "topic", p.topic)
+
+	if err := p.writer.Close(); err != nil {
+		p.logger.Error("error closing writer", "topic", p.topic, "error", err)
+		return err
+	}
+
+	p.logger.Info("kafka producer closed", "topic", p.topic)
+	return nil
+}
+
+// Stats returns a snapshot of the producer statistics
+func (p *KafkaWriterProducer) Stats() ProducerStats {
+	p.statsMu.RLock()
+	defer p.statsMu.RUnlock()
+	return p.stats
+}
+
+// onCompletion records the delivery result of an asynchronous batch
+func (p *KafkaWriterProducer) onCompletion(messages []kafka.Message, err error) {
+	if err != nil {
+		p.logger.Error("failed to deliver kafka messages",
+			"topic", p.topic,
+			"count", len(messages),
+			"error", err)
+	}
+	p.recordResult(len(messages), err)
+}
+
+// recordResult updates stats and metrics for a delivery attempt
+func (p *KafkaWriterProducer) recordResult(count int, err error) {
+	p.statsMu.Lock()
+	if err != nil {
+		p.stats.MessagesFailed += int64(count)
+	} else {
+		p.stats.MessagesProduced += int64(count)
+		p.stats.LastMessageTime = time.Now()
+	}
+	p.statsMu.Unlock()
+
+	if p.metrics != nil {
+		p.metrics.RecordMessages(p.topic, count, err)
+	}
+}
+
+// getRequiredAcks converts string acks to kafka-go required acks
+func getRequiredAcks(acks string) (kafka.RequiredAcks, error) {
+	switch strings.ToLower(acks) {
+	case "", "one":
+		return kafka.RequireOne, nil
+	case "all":
+		return kafka.RequireAll, nil
+	case "none":
+		return kafka.RequireNone, nil
+	default:
+		return 0, fmt.Errorf("unsupported required_acks: %s", acks)
+	}
+}
+
+// getCompression converts string compression to kafka-go compression codec
+func getCompression(compression string) (kafka.Compression, error) {
+	switch strings.ToLower(compression) {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unsupported compression: %s", compression)
+	}
+}
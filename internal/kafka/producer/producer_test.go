@@ -0,0 +1,70 @@
+package producer
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewKafkaWriterProducerValidation tests config validation
+func TestNewKafkaWriterProducerValidation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+
+	tests := []struct {
+		name   string
+		config *Config
+	}{
+		{name: "nil config", config: nil},
+		{name: "empty brokers", config: &Config{Topic: "events"}},
+		{name: "empty topic", config: &Config{Brokers: []string{"localhost:9092"}}},
+		{name: "invalid acks", config: &Config{Brokers: []string{"localhost:9092"}, Topic: "events", RequiredAcks: "some"}},
+		{name: "invalid compression", config: &Config{Brokers: []string{"localhost:9092"}, Topic: "events", Compression: "brotli"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKafkaWriterProducer(tt.config, logger)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// TestNewKafkaWriterProducerDefaults tests that batching and retry defaults are applied
+func TestNewKafkaWriterProducerDefaults(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	config := &Config{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "events",
+	}
+
+	p, err := NewKafkaWriterProducer(config, logger)
+	require.NoError(t, err)
+
+	assert.Equal(t, 100, p.writer.BatchSize)
+	assert.Equal(t, 5, p.writer.MaxAttempts)
+	assert.Equal(t, kafka.RequireOne, p.writer.RequiredAcks)
+	assert.Nil(t, p.writer.Completion)
+}
+
+// TestRecordResult tests producer statistics
+func TestRecordResult(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	p, err := NewKafkaWriterProducer(&Config{
+		Brokers: []string{"localhost:9092"},
+		Topic:   "events",
+		Async:   true,
+	}, logger)
+	require.NoError(t, err)
+
+	p.recordResult(3, nil)
+	p.onCompletion(make([]kafka.Message, 2), assert.AnError)
+
+	stats := p.Stats()
+	assert.Equal(t, int64(3), stats.MessagesProduced)
+	assert.Equal(t, int64(2), stats.MessagesFailed)
+	assert.False(t, stats.LastMessageTime.IsZero())
+}
@@ -0,0 +1,58 @@
+package kafka
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"coin-futures-websocket/internal/websocket/channel"
+)
+
+// maxCachedProjections bounds the projection specs whose fields are cached
+const maxCachedProjections = 1024
+
+// projector projects JSON payloads to the fields of projection specs. The fields of common specs are
+// cached, and a payload is decoded once for all the specs of its subscribers.
+type projector struct {
+	fields sync.Map
+	cached atomic.Int64
+}
+
+// fieldsOf returns the fields of a canonical projection spec
+func (p *projector) fieldsOf(spec string) []string {
+	if fields, ok := p.fields.Load(spec); ok {
+		return fields.([]string)
+	}
+	fields := channel.ProjectionFields(spec)
+	if p.cached.Add(1) > maxCachedProjections {
+		p.cached.Add(-1)
+	} else if _, loaded := p.fields.LoadOrStore(spec, fields); loaded {
+		p.cached.Add(-1)
+	}
+	return fields
+}
+
+// project returns the JSON object data projected to each spec. Fields missing from data are omitted.
+func (p *projector) project(data []byte, specs []string) (map[string][]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	projected := make(map[string][]byte, len(specs))
+	for _, spec := range specs {
+		fields := p.fieldsOf(spec)
+		selected := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := object[field]; ok {
+				selected[field] = value
+			}
+		}
+		out, err := json.Marshal(selected)
+		if err != nil {
+			return nil, err
+		}
+		projected[spec] = out
+	}
+	return projected, nil
+}
@@ -0,0 +1,394 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"coin-futures-websocket/internal/cache"
+	"coin-futures-websocket/internal/featureflag"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/policy"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Units of the daily delivery quota, as labelled by QuotaMetrics
+const (
+	QuotaUnitMessages = "messages"
+	QuotaUnitBytes    = "bytes"
+)
+
+// QuotaChannelType is the user channel type carrying quota events, e.g. user:{ajaib_id}:quota
+const QuotaChannelType = "quota"
+
+// quotaKeyPrefix prefixes the store counters of daily usage, e.g. quota:2026-10-16:12345:messages
+const quotaKeyPrefix = "quota:"
+
+// Suffixes of a user's daily usage counters in the store
+const (
+	quotaMessagesSuffix = ":messages"
+	quotaBytesSuffix    = ":bytes"
+
+	// quotaExceededSuffix counts the replicas that published the quota event, so it isn't repeated after a
+	// restart or by another replica
+	quotaExceededSuffix = ":exceeded"
+)
+
+// quotaTTL keeps usage counters a day past their creation, which covers the rest of their day on every replica
+const quotaTTL = 25 * time.Hour
+
+// QuotaLimits cap what is published to a user's channels per UTC day
+type QuotaLimits struct {
+	// MessagesPerDay caps the publications to a user's channels; zero is unlimited
+	MessagesPerDay int64
+
+	// BytesPerDay caps the payload bytes of the publications to a user's channels; zero is unlimited
+	BytesPerDay int64
+
+	// DowngradedRate is the publications per second each channel of a user over quota is conflated to
+	DowngradedRate float64
+}
+
+// Enabled reports whether any quota is set
+func (l QuotaLimits) Enabled() bool {
+	return l.MessagesPerDay > 0 || l.BytesPerDay > 0
+}
+
+// QuotaEvent is the publication of the quota channel when a user exceeds their daily quota
+type QuotaEvent struct {
+	Type string `json:"type"`
+
+	// Unit is the exceeded quota, messages or bytes
+	Unit  string `json:"unit"`
+	Limit int64  `json:"limit"`
+	Used  int64  `json:"used"`
+
+	// DowngradedRate is the publications per second each of the user's channels is conflated to until ResetAt
+	DowngradedRate float64 `json:"downgraded_rate"`
+
+	// ResetAt is when usage resets at the start of the next UTC day, in Unix milliseconds
+	ResetAt int64 `json:"reset_at"`
+}
+
+// quotaUsage is a user's usage of one day on this replica
+type quotaUsage struct {
+	// messages and bytes are the usage of every replica as of the last flush, plus what this replica
+	// counted since
+	messages int64
+	bytes    int64
+
+	// pending is what this replica counted since the last flush
+	pending quotaDelta
+
+	// exceeded is set once any replica published the quota event
+	exceeded bool
+
+	resetAt time.Time
+}
+
+// quotaDelta is usage counted by this replica and not yet added to the store
+type quotaDelta struct {
+	messages int64
+	bytes    int64
+
+	// announced is set when this replica published the quota event
+	announced bool
+}
+
+// empty reports whether there is nothing to add to the store
+func (d quotaDelta) empty() bool {
+	return d.messages == 0 && d.bytes == 0 && !d.announced
+}
+
+// quotaTotals is a user's usage of one day across every replica, as counted in the store
+type quotaTotals struct {
+	messages int64
+	bytes    int64
+	exceeded bool
+}
+
+// Quotas tracks the daily usage of every user against the quota limits. Usage is counted in memory and
+// shared through counters in the store: they are read on a user's first publication of the day, and Start
+// adds what each replica counted to them, re-reading the totals of the users that published since.
+type Quotas struct {
+	limits  QuotaLimits
+	store   cache.Store
+	metrics *QuotaMetrics
+	logger  *slog.Logger
+	now     func() time.Time
+
+	// usage is keyed by store key, so usage of a past day is flushed and dropped without blocking the new day
+	usage map[string]*quotaUsage
+	mu    sync.Mutex
+}
+
+// NewQuotas creates a quota tracker sharing usage through store
+func NewQuotas(limits QuotaLimits, store cache.Store, logger *slog.Logger) *Quotas {
+	return &Quotas{
+		limits: limits,
+		store:  store,
+		logger: logger,
+		now:    time.Now,
+		usage:  make(map[string]*quotaUsage),
+	}
+}
+
+// SetMetrics sets the metrics counting exceeded quotas
+func (q *Quotas) SetMetrics(metrics *QuotaMetrics) {
+	q.metrics = metrics
+}
+
+// Limits returns the quota limits
+func (q *Quotas) Limits() QuotaLimits {
+	return q.limits
+}
+
+// quotaKey returns the store key of a user's usage on the day of t, and when that day ends
+func quotaKey(ajaibID string, t time.Time) (string, time.Time) {
+	day := t.UTC().Truncate(24 * time.Hour)
+	return quotaKeyPrefix + day.Format(time.DateOnly) + ":" + ajaibID, day.Add(24 * time.Hour)
+}
+
+// add adds usage counted by this replica to the counters of key and returns the totals of every replica;
+// an empty delta reads them. On error it returns the part of the delta not added.
+func (q *Quotas) add(ctx context.Context, key string, delta quotaDelta) (quotaTotals, quotaDelta, error) {
+	var totals quotaTotals
+	var err error
+	if totals.messages, err = q.store.IncrBy(ctx, key+quotaMessagesSuffix, delta.messages, quotaTTL); err != nil {
+		return totals, delta, err
+	}
+	delta.messages = 0
+	if totals.bytes, err = q.store.IncrBy(ctx, key+quotaBytesSuffix, delta.bytes, quotaTTL); err != nil {
+		return totals, delta, err
+	}
+	delta.bytes = 0
+
+	var announced int64
+	if delta.announced {
+		announced = 1
+	}
+	announcements, err := q.store.IncrBy(ctx, key+quotaExceededSuffix, announced, quotaTTL)
+	if err != nil {
+		return totals, delta, err
+	}
+	totals.exceeded = announcements > 0
+	return totals, quotaDelta{}, nil
+}
+
+// load returns a user's usage of the current day, reading it from the store on first use
+func (q *Quotas) load(ajaibID string) *quotaUsage {
+	key, resetAt := quotaKey(ajaibID, q.now())
+
+	q.mu.Lock()
+	usage, ok := q.usage[key]
+	q.mu.Unlock()
+	if ok {
+		return usage
+	}
+
+	usage = &quotaUsage{resetAt: resetAt}
+	totals, _, err := q.add(context.Background(), key, quotaDelta{})
+	if err != nil {
+		q.logger.Warn("failed to load quota usage, counting from zero", "ajaib_id", ajaibID, "error", err)
+	} else {
+		usage.messages, usage.bytes, usage.exceeded = totals.messages, totals.bytes, totals.exceeded
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if existing, ok := q.usage[key]; ok {
+		// Loaded concurrently by another publication
+		return existing
+	}
+	q.usage[key] = usage
+	return usage
+}
+
+// Exceeded reports whether a user exceeded their quota today
+func (q *Quotas) Exceeded(ajaibID string) bool {
+	usage := q.load(ajaibID)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return usage.exceeded
+}
+
+// Record counts a publication of size bytes to a user's channel. It returns the quota event when the
+// publication exceeded the user's quota, nil otherwise and for users already over quota.
+func (q *Quotas) Record(ajaibID string, size int) *QuotaEvent {
+	usage := q.load(ajaibID)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage.messages++
+	usage.bytes += int64(size)
+	usage.pending.messages++
+	usage.pending.bytes += int64(size)
+	if usage.exceeded {
+		return nil
+	}
+
+	event := &QuotaEvent{
+		Type:           "quota_exceeded",
+		DowngradedRate: q.limits.DowngradedRate,
+		ResetAt:        usage.resetAt.UnixMilli(),
+	}
+	switch {
+	case q.limits.MessagesPerDay > 0 && usage.messages > q.limits.MessagesPerDay:
+		event.Unit, event.Limit, event.Used = QuotaUnitMessages, q.limits.MessagesPerDay, usage.messages
+	case q.limits.BytesPerDay > 0 && usage.bytes > q.limits.BytesPerDay:
+		event.Unit, event.Limit, event.Used = QuotaUnitBytes, q.limits.BytesPerDay, usage.bytes
+	default:
+		return nil
+	}
+
+	usage.exceeded = true
+	usage.pending.announced = true
+	q.metrics.record(event.Unit)
+	return event
+}
+
+// Flush adds the usage counted since the last flush to the store, takes the totals of every replica for
+// those users, including whether another replica announced their quota event, and drops the usage of past
+// days. Usage that failed to be added is kept for the next flush.
+func (q *Quotas) Flush(ctx context.Context) error {
+	now := q.now()
+	pending := make(map[string]*quotaUsage)
+	deltas := make(map[string]quotaDelta)
+
+	q.mu.Lock()
+	for key, usage := range q.usage {
+		if !usage.pending.empty() {
+			pending[key] = usage
+			deltas[key] = usage.pending
+			usage.pending = quotaDelta{}
+		}
+		if !now.Before(usage.resetAt) {
+			delete(q.usage, key)
+		}
+	}
+	q.mu.Unlock()
+
+	var errs []error
+	for key, usage := range pending {
+		totals, rest, err := q.add(ctx, key, deltas[key])
+
+		q.mu.Lock()
+		if err != nil {
+			usage.pending.messages += rest.messages
+			usage.pending.bytes += rest.bytes
+			usage.pending.announced = usage.pending.announced || rest.announced
+			errs = append(errs, err)
+		} else {
+			// Publications counted during the flush are added by the next one
+			usage.messages = totals.messages + usage.pending.messages
+			usage.bytes = totals.bytes + usage.pending.bytes
+			usage.exceeded = usage.exceeded || totals.exceeded
+		}
+		q.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Start periodically writes usage to the store, and once more when ctx is done
+func (q *Quotas) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				if err := q.Flush(context.Background()); err != nil {
+					q.logger.Warn("failed to flush quota usage", "error", err)
+				}
+				return
+			case <-ticker.C:
+				if err := q.Flush(ctx); err != nil {
+					q.logger.Warn("failed to flush quota usage", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// QuotaMetrics counts users exceeding their daily quota
+type QuotaMetrics struct {
+	exceeded *prometheus.CounterVec
+}
+
+// NewQuotaMetrics creates a new QuotaMetrics instance with Prometheus collectors
+func NewQuotaMetrics() *QuotaMetrics {
+	return &QuotaMetrics{
+		exceeded: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_user_quota_exceeded_total",
+				Help: "Total number of users downgraded for exceeding their daily delivery quota, by unit",
+			},
+			[]string{"unit"},
+		),
+	}
+}
+
+// Register registers all metrics with the default Prometheus registry
+func (m *QuotaMetrics) Register() error {
+	prometheus.DefaultRegisterer.MustRegister(m.exceeded)
+	return nil
+}
+
+// record counts a user exceeding their quota; nil metrics record nothing
+func (m *QuotaMetrics) record(unit string) {
+	if m == nil {
+		return
+	}
+	m.exceeded.WithLabelValues(unit).Inc()
+}
+
+// SetQuotas enforces daily delivery quotas: users over quota have each channel conflated to the downgraded
+// rate until the end of the day, and are told on their quota channel. Users with the unlimited_delivery
+// flag are exempt.
+func (b *Broadcaster) SetQuotas(quotas *Quotas) {
+	b.quotas = quotas
+	if b.throttle == nil {
+		b.throttle = policy.NewThrottle(b.policies)
+	}
+}
+
+// quotaLimited reports whether deliveries to the user count against the quotas
+func (b *Broadcaster) quotaLimited(ajaibID string) bool {
+	return b.quotas != nil && ajaibID != "" && !b.featureEnabled(featureflag.FlagUnlimitedDelivery, ajaibID)
+}
+
+// recordQuota counts a publication to the user's channel, publishing the quota event when it exceeded
+// the user's quota
+func (b *Broadcaster) recordQuota(ajaibID string, size int) {
+	event := b.quotas.Record(ajaibID, size)
+	if event == nil {
+		return
+	}
+
+	b.logger.Info("user exceeded daily delivery quota, downgrading delivery",
+		"ajaib_id", ajaibID,
+		"unit", event.Unit,
+		"limit", event.Limit,
+		"downgraded_rate", event.DowngradedRate)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		b.logger.Error("failed to encode quota event", "error", err)
+		return
+	}
+
+	// The event stays in history until usage resets, so clients subscribing later learn they are downgraded
+	ch := channel.UserChannel(ajaibID, QuotaChannelType)
+	ttl := time.Until(time.UnixMilli(event.ResetAt))
+	if _, err := b.node.Publish(ch, data, centrifuge.WithHistory(1, ttl)); err != nil {
+		b.logger.Error("failed to publish quota event", "channel", ch, "error", err)
+	}
+}
@@ -0,0 +1,152 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"coin-futures-websocket/internal/cache"
+	"coin-futures-websocket/internal/featureflag"
+	"coin-futures-websocket/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestQuotas tests counting daily usage, sharing it through the store and resetting it the next day
+func TestQuotas(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	store := cache.NewMemoryStore()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	limits := QuotaLimits{MessagesPerDay: 2, BytesPerDay: 1000, DowngradedRate: 0.2}
+
+	quotas := NewQuotas(limits, store, logger)
+	quotas.now = func() time.Time { return now }
+
+	assert.Nil(t, quotas.Record("12345", 100))
+	assert.Nil(t, quotas.Record("12345", 100))
+	assert.False(t, quotas.Exceeded("12345"))
+
+	event := quotas.Record("12345", 100)
+	require.NotNil(t, event)
+	assert.Equal(t, QuotaEvent{
+		Type:           "quota_exceeded",
+		Unit:           QuotaUnitMessages,
+		Limit:          2,
+		Used:           3,
+		DowngradedRate: 0.2,
+		ResetAt:        time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC).UnixMilli(),
+	}, *event)
+	assert.True(t, quotas.Exceeded("12345"))
+	assert.Nil(t, quotas.Record("12345", 100), "announced once")
+
+	// Bytes count separately
+	event = quotas.Record("67890", 1001)
+	require.NotNil(t, event)
+	assert.Equal(t, QuotaUnitBytes, event.Unit)
+
+	// Another replica loads the flushed usage
+	require.NoError(t, quotas.Flush(context.Background()))
+	replica := NewQuotas(limits, store, logger)
+	replica.now = quotas.now
+	assert.True(t, replica.Exceeded("12345"))
+	assert.Nil(t, replica.Record("12345", 100))
+
+	// Usage resets at the start of the next UTC day
+	now = now.Add(12 * time.Hour)
+	assert.False(t, quotas.Exceeded("12345"))
+	require.NoError(t, quotas.Flush(context.Background()))
+	assert.Len(t, quotas.usage, 1, "past day dropped")
+}
+
+// TestQuotaReplicas tests that replicas sharing a store add up their usage and learn of a quota event
+// announced by another replica
+func TestQuotaReplicas(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	store := cache.NewMemoryStore()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	limits := QuotaLimits{MessagesPerDay: 3, DowngradedRate: 0.2}
+	newReplica := func() *Quotas {
+		quotas := NewQuotas(limits, store, logger)
+		quotas.now = func() time.Time { return now }
+		return quotas
+	}
+	first, second := newReplica(), newReplica()
+
+	// Both replicas load the user before either flushes
+	assert.Nil(t, first.Record("12345", 100))
+	assert.Nil(t, first.Record("12345", 100))
+	assert.Nil(t, second.Record("12345", 100))
+	assert.Nil(t, second.Record("12345", 100))
+
+	// Flushes add to the shared count instead of overwriting it
+	require.NoError(t, first.Flush(context.Background()))
+	require.NoError(t, second.Flush(context.Background()))
+	count, _, _ := store.Get(context.Background(), "quota:2026-10-16:12345:messages")
+	assert.Equal(t, "4", string(count))
+	count, _, _ = store.Get(context.Background(), "quota:2026-10-16:12345:bytes")
+	assert.Equal(t, "400", string(count))
+
+	// The second replica took the total on its flush, so its next publication exceeds the quota
+	event := second.Record("12345", 100)
+	require.NotNil(t, event)
+	assert.Equal(t, int64(5), event.Used)
+	require.NoError(t, second.Flush(context.Background()))
+
+	// The first replica learns of the announced event on its next flush and doesn't repeat it
+	assert.False(t, first.Exceeded("12345"))
+	assert.Nil(t, first.Record("12345", 100))
+	require.NoError(t, first.Flush(context.Background()))
+	assert.True(t, first.Exceeded("12345"))
+	assert.Nil(t, first.Record("12345", 100))
+
+	// A replica loading the user later starts from the shared usage
+	third := newReplica()
+	assert.True(t, third.Exceeded("12345"))
+	count, _, _ = store.Get(context.Background(), "quota:2026-10-16:12345:messages")
+	assert.Equal(t, "6", string(count))
+}
+
+// userFlags enables feature flags for individual users
+type userFlags map[string]string
+
+func (f userFlags) Enabled(name, ajaibID string) bool {
+	return f[ajaibID] == name
+}
+
+// TestBroadcasterQuota tests that users over quota are told on their quota channel and conflated to the
+// downgraded rate, and that exempt users are not
+func TestBroadcasterQuota(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	publisher := &recordingPublisher{}
+
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	broadcaster.SetFeatureFlags(userFlags{"67890": featureflag.FlagUnlimitedDelivery})
+	broadcaster.SetQuotas(NewQuotas(QuotaLimits{MessagesPerDay: 1, DowngradedRate: 0.001}, cache.NewMemoryStore(), logger))
+	require.NotNil(t, broadcaster.Throttle())
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+	registerUser(broadcaster, "cfx_2", "67890", "USDT")
+
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1", Asset: "USDT"})
+	exempt, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_2", Asset: "USDT"})
+	for i := 0; i < 4; i++ {
+		require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+		require.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, exempt))
+	}
+
+	assert.Equal(t, []string{
+		"user:12345:margin", "user:67890:margin",
+		"user:12345:margin", "user:12345:quota", "user:67890:margin",
+		"user:12345:margin", "user:67890:margin",
+		"user:67890:margin",
+	}, publisher.channels)
+	assert.True(t, broadcaster.Throttle().Held("user:12345:margin"))
+
+	var event QuotaEvent
+	require.NoError(t, json.Unmarshal(publisher.payloads[3], &event))
+	assert.Equal(t, QuotaUnitMessages, event.Unit)
+	assert.Equal(t, 1, publisher.options[3].HistorySize)
+}
@@ -0,0 +1,59 @@
+package kafka
+
+import "time"
+
+// fetchRestarter decides when consecutive fetch errors restart the reader and how long to back off
+type fetchRestarter struct {
+	threshold  int
+	backoffMin time.Duration
+	backoffMax time.Duration
+
+	// errors counts consecutive fetch errors since the last restart or successful fetch
+	errors int
+
+	// attempts counts restarts since the last successful fetch
+	attempts int
+}
+
+// newFetchRestarter creates a restarter; a threshold of zero disables restarts
+func newFetchRestarter(threshold int, backoffMin, backoffMax time.Duration) fetchRestarter {
+	if backoffMin <= 0 {
+		backoffMin = time.Second
+	}
+	if backoffMax < backoffMin {
+		backoffMax = max(30*time.Second, backoffMin)
+	}
+	return fetchRestarter{
+		threshold:  threshold,
+		backoffMin: backoffMin,
+		backoffMax: backoffMax,
+	}
+}
+
+// failed records a fetch error and reports whether the reader should be restarted after the backoff
+func (r *fetchRestarter) failed() (bool, time.Duration) {
+	if r.threshold <= 0 {
+		return false, 0
+	}
+
+	r.errors++
+	if r.errors < r.threshold {
+		return false, 0
+	}
+
+	backoff := r.backoffMin
+	for i := 0; i < r.attempts && backoff < r.backoffMax; i++ {
+		backoff *= 2
+	}
+	r.errors = 0
+	r.attempts++
+	return true, min(backoff, r.backoffMax)
+}
+
+// succeeded records a successful fetch and reports whether it recovers from a restart
+func (r *fetchRestarter) succeeded() bool {
+	recovered := r.attempts > 0
+	r.errors = 0
+	r.attempts = 0
+	return recovered
+}
@@ -0,0 +1,47 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFetchRestarter tests the error threshold, exponential backoff and recovery of reader restarts
+func TestFetchRestarter(t *testing.T) {
+	r := newFetchRestarter(3, time.Second, 5*time.Second)
+
+	restartAfter := func() time.Duration {
+		for i := 0; i < 2; i++ {
+			restart, _ := r.failed()
+			assert.False(t, restart)
+		}
+		restart, backoff := r.failed()
+		assert.True(t, restart)
+		return backoff
+	}
+
+	assert.Equal(t, time.Second, restartAfter())
+	assert.Equal(t, 2*time.Second, restartAfter())
+	assert.Equal(t, 4*time.Second, restartAfter())
+	assert.Equal(t, 5*time.Second, restartAfter())
+
+	// A successful fetch recovers and resets both the error count and the backoff
+	assert.True(t, r.succeeded())
+	assert.False(t, r.succeeded())
+	assert.Equal(t, time.Second, restartAfter())
+
+	// Errors separated by a successful fetch are not consecutive
+	r.succeeded()
+	r.failed()
+	r.failed()
+	r.succeeded()
+	restart, _ := r.failed()
+	assert.False(t, restart)
+
+	disabled := newFetchRestarter(0, 0, 0)
+	for i := 0; i < 100; i++ {
+		restart, _ := disabled.failed()
+		assert.False(t, restart)
+	}
+}
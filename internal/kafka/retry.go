@@ -0,0 +1,72 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrMalformedMessage marks handler errors that retrying cannot fix, such as undecodable payloads
+var ErrMalformedMessage = errors.New("malformed message")
+
+// handlerRetry decides how often a failed message is retried and how long to back off in between
+type handlerRetry struct {
+	attempts   int
+	backoffMin time.Duration
+	backoffMax time.Duration
+}
+
+// newHandlerRetry creates a retry policy of attempts in total per message; one or less disables retries
+func newHandlerRetry(attempts int, backoffMin, backoffMax time.Duration) handlerRetry {
+	if backoffMin <= 0 {
+		backoffMin = 100 * time.Millisecond
+	}
+	if backoffMax < backoffMin {
+		backoffMax = max(5*time.Second, backoffMin)
+	}
+	return handlerRetry{
+		attempts:   max(attempts, 1),
+		backoffMin: backoffMin,
+		backoffMax: backoffMax,
+	}
+}
+
+// backoff returns the wait after the given failed attempt, doubling from backoffMin up to backoffMax
+func (r handlerRetry) backoff(attempt int) time.Duration {
+	backoff := r.backoffMin
+	for i := 1; i < attempt && backoff < r.backoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, r.backoffMax)
+}
+
+// handle runs the handler on a message, retrying failures per the retry policy. Malformed messages are
+// failed at once; a cancelled ctx stops retrying and returns the last error.
+func (c *KafkaReaderConsumer) handle(ctx context.Context, msg kafka.Message) error {
+	ctx = withMessageTime(ctx, msg.Time)
+	for attempt := 1; ; attempt++ {
+		err := c.handler(ctx, msg.Topic, msg.Key, msg.Value)
+		if err == nil || attempt >= c.retry.attempts || errors.Is(err, ErrMalformedMessage) {
+			return err
+		}
+
+		backoff := c.retry.backoff(attempt)
+		c.logger.Warn("retrying kafka message",
+			"topic", msg.Topic,
+			"partition", msg.Partition,
+			"offset", msg.Offset,
+			"attempt", attempt,
+			"backoff", backoff.String(),
+			"error", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandlerRetryBackoff tests the exponential backoff between attempts
+func TestHandlerRetryBackoff(t *testing.T) {
+	r := newHandlerRetry(5, 100*time.Millisecond, 350*time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, r.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, r.backoff(2))
+	assert.Equal(t, 350*time.Millisecond, r.backoff(3))
+	assert.Equal(t, 350*time.Millisecond, r.backoff(4))
+
+	assert.Equal(t, 1, newHandlerRetry(0, 0, 0).attempts)
+}
+
+// TestHandleRetries tests that failed messages are retried up to the attempt limit, except malformed ones
+func TestHandleRetries(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	calls := 0
+	var failure error
+	consumer, err := NewKafkaReaderConsumer(&ConsumerConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: "test-group",
+		Topics:  []string{"margin"},
+		Handler: func(ctx context.Context, topic string, key []byte, value []byte) error {
+			calls++
+			if calls < 3 {
+				return failure
+			}
+			return nil
+		},
+		HandlerAttempts:   3,
+		HandlerBackoffMin: time.Millisecond,
+		HandlerBackoffMax: time.Millisecond,
+	}, logger)
+	require.NoError(t, err)
+	msg := kafka.Message{Topic: "margin"}
+
+	failure = errors.New("rate provider down")
+	assert.NoError(t, consumer.handle(context.Background(), msg))
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	failure = fmt.Errorf("%w: invalid json", ErrMalformedMessage)
+	assert.ErrorIs(t, consumer.handle(context.Background(), msg), ErrMalformedMessage)
+	assert.Equal(t, 1, calls)
+
+	// Shutdown stops retrying
+	calls = 0
+	failure = errors.New("rate provider down")
+	consumer.retry = newHandlerRetry(3, time.Hour, time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, consumer.handle(ctx, msg))
+	assert.Equal(t, 1, calls)
+}
+
+// TestGlobalErrorBudget tests that an exhausted global budget pauses every consumer sharing it
+func TestGlobalErrorBudget(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	assert.Nil(t, NewErrorBudget(0, time.Minute, time.Second, logger))
+
+	budget := NewErrorBudget(2, time.Minute, 20*time.Millisecond, logger)
+	consumers := newTestTopicConsumers(t, false)
+	for _, consumer := range consumers.consumers {
+		consumer.globalBudget = budget
+	}
+
+	budget.spend()
+	assert.False(t, consumers.consumers["position"].Paused())
+	budget.spend()
+	assert.True(t, consumers.consumers["margin"].Paused())
+	assert.True(t, consumers.consumers["position"].Paused())
+	assert.EqualValues(t, 1, budget.Exhaustions())
+
+	// The pause ends on its own
+	assert.True(t, consumers.consumers["margin"].waitWhilePaused(context.Background()))
+	assert.False(t, consumers.consumers["position"].Paused())
+}
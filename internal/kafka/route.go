@@ -0,0 +1,344 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"coin-futures-websocket/internal/featureflag"
+	"coin-futures-websocket/internal/service"
+	"coin-futures-websocket/internal/types"
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Message is a decoded Kafka payload addressed to a CFX user
+type Message interface {
+	GetCFXUserID() string
+}
+
+// Decoder decodes the payload of a Kafka message
+type Decoder func(data []byte) (Message, error)
+
+// RouteErrorPolicy decides what happens to a message its route fails to decode, transform or publish.
+// Failures retrying cannot fix are handled before it: malformed messages are dead-lettered when a
+// dead-letter topic is set, and messages rejected as unsupported assets are skipped.
+type RouteErrorPolicy string
+
+const (
+	// RouteRetry returns the error to the consumer, which retries the message and spends the error budget
+	RouteRetry RouteErrorPolicy = "retry"
+
+	// RouteSkip logs and counts the error and moves on to the next message
+	RouteSkip RouteErrorPolicy = "skip"
+)
+
+// ParseRouteErrorPolicy parses a route error policy name, defaulting to retry
+func ParseRouteErrorPolicy(name string) (RouteErrorPolicy, error) {
+	switch policy := RouteErrorPolicy(strings.ToLower(name)); policy {
+	case "", RouteRetry:
+		return RouteRetry, nil
+	case RouteSkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown route error policy %q, want retry or skip", name)
+	}
+}
+
+// Route publishes the messages of a Kafka topic to the subscribers of a user channel type
+type Route struct {
+	// ChannelType is the user channel type published to, e.g. margin for user:{ajaib_id}:margin
+	ChannelType string
+
+	// Decode decodes payloads, e.g. JSONDecoder[types.UserMargin]()
+	Decode Decoder
+
+	// Instrument returns the sub-channel instrument of a message, e.g. its symbol; nil or empty publishes
+	// no sub-channel
+	Instrument func(msg Message) string
+
+	// Transform converts the payload for a subscriber's quote preference; nil publishes payloads unchanged.
+	// A nil payload without error drops the message.
+	Transform func(ctx context.Context, msg Message, data []byte, quotePreference string) ([]byte, error)
+
+	// ErrorPolicy applies to messages the route fails; empty retries
+	ErrorPolicy RouteErrorPolicy
+}
+
+// Results of routed messages, as counted by RouteMetrics
+const (
+	routePublished    = "published"
+	routeUnsubscribed = "unsubscribed"
+	routeDropped      = "dropped"
+	routeDeadLettered = "dead_lettered"
+	routeError        = "error"
+)
+
+// JSONDecoder returns a decoder of JSON payloads into a T
+func JSONDecoder[T any, P interface {
+	*T
+	Message
+}]() Decoder {
+	return func(data []byte) (Message, error) {
+		msg := P(new(T))
+		if err := json.Unmarshal(data, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+}
+
+// RegisterRoute routes the messages of topic, replacing its route if it has one, and makes the route's
+// channel type subscribable. Routes must be registered before consuming starts.
+func (b *Broadcaster) RegisterRoute(topic string, route Route) error {
+	if topic == "" {
+		return fmt.Errorf("route requires a topic")
+	}
+	if route.ChannelType == "" || !channel.ValidName(route.ChannelType) || strings.Contains(route.ChannelType, ":") {
+		return fmt.Errorf("route of topic %s: invalid channel type %q", topic, route.ChannelType)
+	}
+	if route.Decode == nil {
+		return fmt.Errorf("route of topic %s requires a decoder", topic)
+	}
+	if _, err := ParseRouteErrorPolicy(string(route.ErrorPolicy)); err != nil {
+		return fmt.Errorf("route of topic %s: %w", topic, err)
+	}
+
+	channel.RegisterUserChannel(route.ChannelType)
+	b.routes[topic] = &route
+	return nil
+}
+
+// SetRouteErrorPolicy changes the error policy of the route of topic
+func (b *Broadcaster) SetRouteErrorPolicy(topic string, policy RouteErrorPolicy) error {
+	route, ok := b.routes[topic]
+	if !ok {
+		return fmt.Errorf("no route for topic %s", topic)
+	}
+	route.ErrorPolicy = policy
+	return nil
+}
+
+// SetRouteMetrics sets the metrics counting the messages of each route
+func (b *Broadcaster) SetRouteMetrics(metrics *RouteMetrics) {
+	b.routeMetrics = metrics
+}
+
+// registerBuiltinRoutes routes the UserMargin and UserPosition topics through the broadcaster's transformer
+func (b *Broadcaster) registerBuiltinRoutes() {
+	margin := Route{
+		ChannelType: types.ChannelMarginSuffix,
+		Decode:      JSONDecoder[types.UserMargin](),
+		Instrument:  func(msg Message) string { return msg.(*types.UserMargin).Asset },
+	}
+	position := Route{
+		ChannelType: types.ChannelPositionSuffix,
+		Decode:      JSONDecoder[types.UserPosition](),
+		Instrument:  func(msg Message) string { return msg.(*types.UserPosition).Symbol },
+	}
+	if b.transformer != nil {
+		margin.Transform = func(ctx context.Context, msg Message, data []byte, quotePreference string) ([]byte, error) {
+			return b.transformer.TransformUserMargin(ctx, msg.(*types.UserMargin), data, quotePreference)
+		}
+		position.Transform = func(ctx context.Context, msg Message, data []byte, quotePreference string) ([]byte, error) {
+			return b.transformer.TransformUserPosition(ctx, msg.(*types.UserPosition), data, quotePreference)
+		}
+	}
+
+	_ = b.RegisterRoute(types.TopicUserMargin, margin)
+	_ = b.RegisterRoute(types.TopicUserPosition, position)
+}
+
+// handleRoute handles a message through the route of its topic, applying the route's error policy
+func (b *Broadcaster) handleRoute(ctx context.Context, topic string, route *Route, key []byte, data []byte) error {
+	if b.unsubscribedKey(key, route.ChannelType) {
+		b.routeMetrics.Record(topic, routeUnsubscribed)
+		return nil
+	}
+
+	result, err := b.route(ctx, topic, route, data)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrUnsupportedAsset):
+		// The transformer already reported the instrument; retrying cannot convert it
+		result, err = routeDropped, nil
+	case errors.Is(err, ErrMalformedMessage) && b.deadLetter != nil:
+		// A failed dead-letter is retried like any transient error
+		if dlErr := b.deadLetterMessage(ctx, DeadLetter{Topic: topic, Error: err.Error()}, key, data); dlErr != nil {
+			b.routeMetrics.Record(topic, routeError)
+			return dlErr
+		}
+		b.logger.Warn("dead-lettered malformed kafka message", "topic", topic, "error", err)
+		result, err = routeDeadLettered, nil
+	}
+	if err != nil {
+		b.routeMetrics.Record(topic, routeError)
+		if route.ErrorPolicy == RouteSkip {
+			b.logger.Warn("skipping kafka message failed by its route", "topic", topic, "error", err)
+			return nil
+		}
+		return err
+	}
+	b.routeMetrics.Record(topic, result)
+	return nil
+}
+
+// route decodes a message, transforms it for its user's subscribers and publishes it to the route's channels.
+// It returns the result counted by the route metrics.
+func (b *Broadcaster) route(ctx context.Context, topic string, route *Route, data []byte) (string, error) {
+	msg, err := route.Decode(data)
+	if err != nil {
+		b.logger.Error("failed to decode kafka message", "channel_type", route.ChannelType, "error", err)
+		return "", fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+	}
+
+	if b.debugEnabled() {
+		b.logger.Debug("received kafka message", "channel_type", route.ChannelType, "message", msg)
+	}
+
+	cfxUserID := msg.GetCFXUserID()
+	user, ok := b.getSubscribedUser(cfxUserID, route.ChannelType)
+	if !ok {
+		// No active subscribers, skip broadcast
+		return routeUnsubscribed, nil
+	}
+
+	// Revoked accounts stop receiving data mid-session
+	if !b.entitled(cfxUserID, user.ajaibID) {
+		return routeDropped, nil
+	}
+
+	stale := b.stale(ctx, topic, msg)
+	d := b.newDelivery(cfxUserID, user.ajaibID, b.featureEnabled(featureflag.FlagDeltaMode, user.ajaibID), stale)
+
+	// Transform and project before publishing anything, so a failed transformation is retried without duplicates
+	dataToBroadcast := data
+	if user.wantsTransformed && route.Transform != nil {
+		transformedData, err := route.Transform(ctx, msg, data, user.quotePreference)
+		if err != nil {
+			return "", transformError(route.ChannelType, err)
+		}
+		dataToBroadcast = transformedData
+	}
+	// Only raw consumers are subscribed, or the transformer's unknown instrument policy dropped the payload
+	transformed := user.wantsTransformed && dataToBroadcast != nil
+
+	var projected map[string][]byte
+	if transformed && len(user.projections) > 0 {
+		if projected, err = b.projector.project(dataToBroadcast, user.projections); err != nil {
+			return "", fmt.Errorf("failed to project %s: %w", route.ChannelType, err)
+		}
+	}
+
+	var instrument string
+	if transformed && route.Instrument != nil && b.subChannelsEnabled(user.ajaibID) {
+		instrument = route.Instrument(msg)
+	}
+
+	ch := channel.UserChannel(user.ajaibID, route.ChannelType)
+	var targets []routeTarget
+	if user.wantsRaw {
+		// The raw variant carries the payload as consumed from Kafka, never delta-compressed
+		raw := d
+		raw.delta = false
+		targets = append(targets, routeTarget{channel: channel.RawChannel(ch), data: data, delivery: raw})
+	}
+	if transformed && user.wantsFull {
+		targets = appendStream(targets, ch, instrument, dataToBroadcast, d)
+	}
+	if transformed {
+		for _, spec := range user.projections {
+			targets = appendStream(targets, channel.ProjectedChannel(spec, ch), instrument, projected[spec], d)
+		}
+	}
+	if len(targets) == 0 {
+		return routeDropped, nil
+	}
+
+	// A retry would repeat the publications that already went out, so only a failure before the first one is retried
+	published := 0
+	for _, target := range targets {
+		if err := b.publish(target.channel, target.data, target.delivery); err != nil {
+			if published == 0 {
+				return "", err
+			}
+			b.logger.Error("failed to publish kafka message, not retried after partial delivery",
+				"channel", target.channel,
+				"cfx_user_id", cfxUserID,
+				"error", err)
+			continue
+		}
+		published++
+	}
+
+	if b.debugEnabled() {
+		b.logger.Debug("broadcasted kafka message",
+			"cfx_user_id", cfxUserID,
+			"ajaib_id", user.ajaibID,
+			"channel", ch,
+			"instrument", instrument,
+			"projections", user.projections)
+	}
+
+	return routePublished, nil
+}
+
+// transformError wraps a failed transformation. Invalid payloads are malformed messages, which are not
+// retried; unavailable rates are retried.
+func transformError(channelType string, err error) error {
+	if errors.Is(err, service.ErrInvalidPayload) {
+		return fmt.Errorf("%w: failed to transform %s: %w", ErrMalformedMessage, channelType, err)
+	}
+	return fmt.Errorf("failed to transform %s: %w", channelType, err)
+}
+
+// routeTarget is a channel a routed message is published to
+type routeTarget struct {
+	channel  string
+	data     []byte
+	delivery delivery
+}
+
+// appendStream adds a channel and, with an instrument, its sub-channel to the targets
+func appendStream(targets []routeTarget, ch, instrument string, data []byte, d delivery) []routeTarget {
+	targets = append(targets, routeTarget{channel: ch, data: data, delivery: d})
+	if instrument == "" {
+		return targets
+	}
+	return append(targets, routeTarget{channel: channel.SubChannel(ch, instrument), data: data, delivery: d})
+}
+
+// RouteMetrics counts the messages handled by each route
+type RouteMetrics struct {
+	messagesTotal *prometheus.CounterVec
+}
+
+// NewRouteMetrics creates a new RouteMetrics instance with Prometheus collectors
+func NewRouteMetrics() *RouteMetrics {
+	return &RouteMetrics{
+		messagesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_route_messages_total",
+				Help: "Total number of Kafka messages handled by each route by result",
+			},
+			[]string{"topic", "result"},
+		),
+	}
+}
+
+// Register registers all metrics with the default Prometheus registry
+func (m *RouteMetrics) Register() error {
+	prometheus.DefaultRegisterer.MustRegister(m.messagesTotal)
+	return nil
+}
+
+// Record counts a message of topic handled with result; nil metrics record nothing
+func (m *RouteMetrics) Record(topic, result string) {
+	if m == nil {
+		return
+	}
+	m.messagesTotal.WithLabelValues(topic, result).Inc()
+}
@@ -0,0 +1,120 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"coin-futures-websocket/internal/types"
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/centrifugal/centrifuge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testOrder is a message type added by a deployment route
+type testOrder struct {
+	CFXUserID string `json:"cfx_user_id"`
+	Symbol    string `json:"symbol"`
+	Status    string `json:"status"`
+}
+
+func (o *testOrder) GetCFXUserID() string {
+	return o.CFXUserID
+}
+
+// TestRegisterRoute tests that a registered route publishes its topic to its channel type and sub-channels
+func TestRegisterRoute(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	publisher := &recordingPublisher{}
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	broadcaster.SetSubChannels(true)
+
+	require.NoError(t, broadcaster.RegisterRoute("futures.UserOrder", Route{
+		ChannelType: "order",
+		Decode:      JSONDecoder[testOrder](),
+		Instrument:  func(msg Message) string { return msg.(*testOrder).Symbol },
+		Transform: func(ctx context.Context, msg Message, data []byte, quotePreference string) ([]byte, error) {
+			return []byte(`{"status":"` + msg.(*testOrder).Status + `","quote":"` + quotePreference + `"}`), nil
+		},
+	}))
+	_, err := channel.ParseChannel("user:12345:order")
+	require.NoError(t, err)
+
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:order", "12345", "IDR")
+	order, _ := json.Marshal(testOrder{CFXUserID: "cfx_1", Symbol: "BTCUSDT", Status: "filled"})
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), "futures.UserOrder", nil, order))
+
+	assert.Equal(t, []string{"user:12345:order", "user:12345:order:BTCUSDT"}, publisher.channels)
+	assert.JSONEq(t, `{"status":"filled","quote":"IDR"}`, string(publisher.payloads[0]))
+
+	// Subscribers of other channel types receive nothing
+	other, _ := json.Marshal(testOrder{CFXUserID: "cfx_2"})
+	registerUser(broadcaster, "cfx_2", "67890", "USDT")
+	require.NoError(t, broadcaster.HandleMessage(context.Background(), "futures.UserOrder", nil, other))
+	assert.Len(t, publisher.channels, 2)
+
+	assert.Error(t, broadcaster.RegisterRoute("futures.UserOrder", Route{ChannelType: "order"}))
+	assert.Error(t, broadcaster.RegisterRoute("futures.UserOrder", Route{ChannelType: "order:open", Decode: JSONDecoder[testOrder]()}))
+	assert.Error(t, broadcaster.RegisterRoute("futures.UserOrder", Route{ChannelType: "order", Decode: JSONDecoder[testOrder](), ErrorPolicy: "ignore"}))
+}
+
+// TestRouteErrorPolicy tests that skipping routes swallow their errors while retrying routes return them
+func TestRouteErrorPolicy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	transformer := &mockTransformer{
+		transformMarginFunc: func([]byte, string, string) ([]byte, error) { return nil, errors.New("rate unavailable") },
+	}
+	broadcaster := NewBroadcaster(&recordingPublisher{}, transformer, logger)
+	registerUser(broadcaster, "cfx_1", "12345", "IDR")
+	margin, _ := json.Marshal(types.UserMargin{CFXUserID: "cfx_1"})
+
+	err := broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin)
+	assert.ErrorContains(t, err, "rate unavailable")
+
+	require.NoError(t, broadcaster.SetRouteErrorPolicy(types.TopicUserMargin, RouteSkip))
+	assert.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserMargin, nil, margin))
+	assert.Error(t, broadcaster.SetRouteErrorPolicy("futures.UserOrder", RouteSkip))
+
+	policy, err := ParseRouteErrorPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, RouteRetry, policy)
+	_, err = ParseRouteErrorPolicy("ignore")
+	assert.Error(t, err)
+}
+
+// failingPublisher records publications and fails those to the given channels
+type failingPublisher struct {
+	recordingPublisher
+	fail map[string]bool
+}
+
+func (p *failingPublisher) Publish(ch string, data []byte, opts ...centrifuge.PublishOption) (centrifuge.PublishResult, error) {
+	if p.fail[ch] {
+		return centrifuge.PublishResult{}, errors.New("broker unavailable")
+	}
+	return p.recordingPublisher.Publish(ch, data, opts...)
+}
+
+// TestRoutePartialDelivery tests that a message is retried only when none of its publications went out
+func TestRoutePartialDelivery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	publisher := &failingPublisher{fail: map[string]bool{"user:12345:position": true}}
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	broadcaster.SetSubChannels(true)
+	registerUser(broadcaster, "cfx_1", "12345", "USDT")
+	position, _ := json.Marshal(types.UserPosition{CFXUserID: "cfx_1", Symbol: "BTCUSDT"})
+
+	// Nothing went out, so the message is retried
+	assert.ErrorContains(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position), "broker unavailable")
+	assert.Empty(t, publisher.channels)
+
+	// The full channel went out, so the failed sub-channel is not retried
+	publisher.fail = map[string]bool{"user:12345:position:BTCUSDT": true}
+	assert.NoError(t, broadcaster.HandleMessage(context.Background(), types.TopicUserPosition, nil, position))
+	assert.Equal(t, []string{"user:12345:position"}, publisher.channels)
+}
@@ -0,0 +1,137 @@
+package kafka
+
+import (
+	"cmp"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// RoutedSubscription is a client subscription the broadcaster routes messages to
+type RoutedSubscription struct {
+	ClientID     string    `json:"client_id"`
+	Channel      string    `json:"channel"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// RoutedChannelType lists a user's subscriptions to one channel type and the variants they want
+type RoutedChannelType struct {
+	ChannelType   string               `json:"channel_type"`
+	Raw           int                  `json:"raw"`
+	Projections   map[string]int       `json:"projections,omitempty"`
+	Subscriptions []RoutedSubscription `json:"subscriptions"`
+}
+
+// RoutedUser is an entry of the broadcaster's active users, keyed by cfx_user_id
+type RoutedUser struct {
+	CFXUserID       string              `json:"cfx_user_id"`
+	AjaibID         string              `json:"ajaib_id"`
+	QuotePreference string              `json:"quote_preference"`
+	Entitled        bool                `json:"entitled"`
+	SubChannels     bool                `json:"sub_channels"`
+	ChannelTypes    []RoutedChannelType `json:"channel_types"`
+}
+
+// RouteInfo describes the route of a Kafka topic
+type RouteInfo struct {
+	Topic       string           `json:"topic"`
+	ChannelType string           `json:"channel_type"`
+	ErrorPolicy RouteErrorPolicy `json:"error_policy"`
+	Transform   bool             `json:"transform"`
+	Instrument  bool             `json:"instrument"`
+}
+
+// RoutingTable is the response body of the routing admin endpoint
+type RoutingTable struct {
+	Users  []RoutedUser `json:"users"`
+	Routes []RouteInfo  `json:"routes"`
+}
+
+// RoutingTable returns the routes and the active users matching the filter, ordered by cfx_user_id.
+// Empty filter values match every user.
+func (b *Broadcaster) RoutingTable(cfxUserID, ajaibID string) RoutingTable {
+	table := RoutingTable{Users: []RoutedUser{}, Routes: make([]RouteInfo, 0, len(b.routes))}
+	for topic, route := range b.routes {
+		errorPolicy, _ := ParseRouteErrorPolicy(string(route.ErrorPolicy))
+		table.Routes = append(table.Routes, RouteInfo{
+			Topic:       topic,
+			ChannelType: route.ChannelType,
+			ErrorPolicy: errorPolicy,
+			Transform:   route.Transform != nil,
+			Instrument:  route.Instrument != nil,
+		})
+	}
+	slices.SortFunc(table.Routes, func(a, b RouteInfo) int { return strings.Compare(a.Topic, b.Topic) })
+
+	b.mu.RLock()
+	for id, user := range b.activeUsers {
+		if (cfxUserID != "" && id != cfxUserID) || (ajaibID != "" && user.ajaibID != ajaibID) {
+			continue
+		}
+		table.Users = append(table.Users, routedUser(id, user))
+	}
+	b.mu.RUnlock()
+
+	// Entitlements and feature flags are looked up without holding the routing table
+	for i := range table.Users {
+		user := &table.Users[i]
+		user.Entitled = b.entitlements == nil || b.entitlements.Entitled(user.AjaibID)
+		user.SubChannels = b.subChannelsEnabled(user.AjaibID)
+	}
+	slices.SortFunc(table.Users, func(a, b RoutedUser) int { return strings.Compare(a.CFXUserID, b.CFXUserID) })
+	return table
+}
+
+// routedUser copies an active user for the routing table. Must be called with mu held.
+func routedUser(cfxUserID string, user *subscribedUser) RoutedUser {
+	routed := RoutedUser{
+		CFXUserID:       cfxUserID,
+		AjaibID:         user.ajaibID,
+		QuotePreference: user.quotePreference,
+		ChannelTypes:    make([]RoutedChannelType, 0, len(user.subscribers)),
+	}
+	for channelType, refs := range user.subscribers {
+		routedType := RoutedChannelType{
+			ChannelType:   channelType,
+			Raw:           user.raw[channelType],
+			Subscriptions: make([]RoutedSubscription, 0, len(refs)),
+		}
+		if specs := user.projected[channelType]; len(specs) > 0 {
+			routedType.Projections = make(map[string]int, len(specs))
+			for spec, n := range specs {
+				routedType.Projections[spec] = n
+			}
+		}
+		for key, registeredAt := range refs {
+			routedType.Subscriptions = append(routedType.Subscriptions, RoutedSubscription{
+				ClientID:     key.clientID,
+				Channel:      key.channel,
+				RegisteredAt: registeredAt,
+			})
+		}
+		slices.SortFunc(routedType.Subscriptions, func(a, b RoutedSubscription) int {
+			return cmp.Or(a.RegisteredAt.Compare(b.RegisteredAt), strings.Compare(a.ClientID, b.ClientID), strings.Compare(a.Channel, b.Channel))
+		})
+		routed.ChannelTypes = append(routed.ChannelTypes, routedType)
+	}
+	slices.SortFunc(routed.ChannelTypes, func(a, b RoutedChannelType) int {
+		return strings.Compare(a.ChannelType, b.ChannelType)
+	})
+	return routed
+}
+
+// RoutingHandler returns the admin HTTP handler dumping the routes and the active users, filtered by
+// ?cfx_user_id= or ?ajaib_id=
+func (b *Broadcaster) RoutingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		table := b.RoutingTable(query.Get("cfx_user_id"), query.Get("ajaib_id"))
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(table); err != nil {
+			b.logger.Error("failed to encode routing table", "error", err)
+		}
+	})
+}
@@ -0,0 +1,65 @@
+package kafka
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"coin-futures-websocket/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// revokedEntitlements revokes a fixed set of users
+type revokedEntitlements map[string]bool
+
+func (r revokedEntitlements) Entitled(ajaibID string) bool {
+	return !r[ajaibID]
+}
+
+// TestRoutingTable tests that the routing table dumps routes and the subscriptions of active users
+func TestRoutingTable(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	broadcaster := NewBroadcaster(&recordingPublisher{}, nil, logger)
+	broadcaster.SetEntitlementChecker(revokedEntitlements{"67890": true})
+	require.NoError(t, broadcaster.SetRouteErrorPolicy(types.TopicUserPosition, RouteSkip))
+
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:margin", "12345", "IDR")
+	broadcaster.RegisterSubscription("cfx_1", "client_2", "raw:user:12345:margin", "12345", "IDR")
+	broadcaster.RegisterSubscription("cfx_1", "client_2", "fields:mark_price:user:12345:position", "12345", "IDR")
+	broadcaster.RegisterSubscription("cfx_2", "client_3", "user:67890:position", "67890", "USDT")
+
+	table := broadcaster.RoutingTable("", "")
+	require.Len(t, table.Routes, 2)
+	assert.Equal(t, RouteInfo{Topic: types.TopicUserMargin, ChannelType: "margin", ErrorPolicy: RouteRetry, Instrument: true}, table.Routes[0])
+	assert.Equal(t, RouteSkip, table.Routes[1].ErrorPolicy)
+
+	require.Len(t, table.Users, 2)
+	user := table.Users[0]
+	assert.Equal(t, "cfx_1", user.CFXUserID)
+	assert.Equal(t, "12345", user.AjaibID)
+	assert.True(t, user.Entitled)
+	require.Len(t, user.ChannelTypes, 2)
+	margin := user.ChannelTypes[0]
+	assert.Equal(t, "margin", margin.ChannelType)
+	assert.Equal(t, 1, margin.Raw)
+	require.Len(t, margin.Subscriptions, 2)
+	assert.Equal(t, "user:12345:margin", margin.Subscriptions[0].Channel)
+	assert.False(t, margin.Subscriptions[0].RegisteredAt.IsZero())
+	assert.Equal(t, map[string]int{"mark_price": 1}, user.ChannelTypes[1].Projections)
+	assert.False(t, table.Users[1].Entitled)
+
+	rec := httptest.NewRecorder()
+	broadcaster.RoutingHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/routing?ajaib_id=67890", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var filtered RoutingTable
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &filtered))
+	require.Len(t, filtered.Users, 1)
+	assert.Equal(t, "cfx_2", filtered.Users[0].CFXUserID)
+	assert.Len(t, filtered.Routes, 2)
+}
@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// SecurityConfig holds TLS and SASL settings shared by Kafka consumers and producers
+type SecurityConfig struct {
+	TLSEnabled            bool
+	TLSCAPath             string
+	TLSInsecureSkipVerify bool
+	SASLMechanism         string
+	SASLUsername          string
+	SASLPassword          string
+}
+
+// TLSConfig builds the TLS configuration, or returns nil when TLS is disabled
+func (c SecurityConfig) TLSConfig() (*tls.Config, error) {
+	if !c.TLSEnabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+
+	if c.TLSCAPath != "" {
+		caCert, err := os.ReadFile(c.TLSCAPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kafka CA file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to parse kafka CA file %s", c.TLSCAPath)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// Mechanism builds the SASL mechanism, or returns nil when SASL is disabled
+func (c SecurityConfig) Mechanism() (sasl.Mechanism, error) {
+	switch strings.ToLower(c.SASLMechanism) {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{
+			Username: c.SASLUsername,
+			Password: c.SASLPassword,
+		}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, c.SASLUsername, c.SASLPassword)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, c.SASLUsername, c.SASLPassword)
+	default:
+		return nil, fmt.Errorf("unsupported sasl mechanism: %s", c.SASLMechanism)
+	}
+}
+
+// NewDialer creates a kafka-go dialer for readers using the security settings
+func (c SecurityConfig) NewDialer() (*kafka.Dialer, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	mechanism, err := c.Mechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// NewTransport creates a kafka-go transport for writers using the security settings
+func (c SecurityConfig) NewTransport() (*kafka.Transport, error) {
+	tlsConfig, err := c.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	mechanism, err := c.Mechanism()
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Transport{
+		DialTimeout: 10 * time.Second,
+		TLS:         tlsConfig,
+		SASL:        mechanism,
+	}, nil
+}
+
+// CheckBrokers dials every broker with the security settings and reports the ones that cannot be reached
+func CheckBrokers(ctx context.Context, brokers []string, security SecurityConfig) error {
+	dialer, err := security.NewDialer()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, broker := range brokers {
+		conn, err := dialer.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", broker, err))
+			continue
+		}
+		conn.Close()
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sources of the message timestamps compared to server time, as labelled by SkewMetrics
+const (
+	// SkewSourceKafka is the timestamp of the Kafka record
+	SkewSourceKafka = "kafka"
+
+	// SkewSourcePayload is the timestamp embedded in the payload by the producer
+	SkewSourcePayload = "payload"
+)
+
+// TagStale is the publication tag set to "true" on publications of messages older than the stale threshold,
+// so frontends can show that data is delayed
+const TagStale = "stale"
+
+// messageTimeContextKey stores the Kafka timestamp of the message being handled in the handler context
+type messageTimeContextKey struct{}
+
+// withMessageTime returns the handler context of a message with its Kafka timestamp
+func withMessageTime(ctx context.Context, t time.Time) context.Context {
+	if t.IsZero() {
+		return ctx
+	}
+	return context.WithValue(ctx, messageTimeContextKey{}, t)
+}
+
+// messageTime returns the Kafka timestamp of the message being handled, zero when unknown
+func messageTime(ctx context.Context) time.Time {
+	t, _ := ctx.Value(messageTimeContextKey{}).(time.Time)
+	return t
+}
+
+// TimestampedMessage is a message carrying the Unix time in milliseconds it was produced at
+type TimestampedMessage interface {
+	Message
+	GetTimestamp() int64
+}
+
+// SkewMetrics measures how far message timestamps lag server time
+type SkewMetrics struct {
+	skew          *prometheus.HistogramVec
+	staleMessages *prometheus.CounterVec
+}
+
+// NewSkewMetrics creates a new SkewMetrics instance with Prometheus collectors
+func NewSkewMetrics() *SkewMetrics {
+	return &SkewMetrics{
+		skew: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "kafka_message_skew_seconds",
+				Help:    "Server time minus the message timestamp when handled, by topic and timestamp source",
+				Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+			},
+			[]string{"topic", "source"},
+		),
+		staleMessages: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "kafka_stale_messages_total",
+				Help: "Total number of Kafka messages published with the stale tag",
+			},
+			[]string{"topic"},
+		),
+	}
+}
+
+// Register registers all metrics with the default Prometheus registry
+func (m *SkewMetrics) Register() error {
+	prometheus.DefaultRegisterer.MustRegister(m.skew, m.staleMessages)
+	return nil
+}
+
+// record observes the skew of a message timestamp; nil metrics record nothing
+func (m *SkewMetrics) record(topic, source string, skew time.Duration) {
+	if m == nil {
+		return
+	}
+	m.skew.WithLabelValues(topic, source).Observe(skew.Seconds())
+}
+
+// recordStale counts a message published as stale; nil metrics record nothing
+func (m *SkewMetrics) recordStale(topic string) {
+	if m == nil {
+		return
+	}
+	m.staleMessages.WithLabelValues(topic).Inc()
+}
+
+// SetStaleThreshold tags the publications of messages whose Kafka or payload timestamp lags server time by
+// more than threshold as stale. Zero disables the tag.
+func (b *Broadcaster) SetStaleThreshold(threshold time.Duration) {
+	b.staleThreshold = threshold
+}
+
+// SetSkewMetrics sets the metrics measuring message timestamp skew
+func (b *Broadcaster) SetSkewMetrics(metrics *SkewMetrics) {
+	b.skewMetrics = metrics
+}
+
+// stale measures the skew of a message's Kafka and payload timestamps against server time, reporting
+// whether either exceeds the stale threshold
+func (b *Broadcaster) stale(ctx context.Context, topic string, msg Message) bool {
+	now := time.Now()
+	var skew time.Duration
+	if t := messageTime(ctx); !t.IsZero() {
+		skew = now.Sub(t)
+		b.skewMetrics.record(topic, SkewSourceKafka, skew)
+	}
+	if m, ok := msg.(TimestampedMessage); ok && m.GetTimestamp() > 0 {
+		payloadSkew := now.Sub(time.UnixMilli(m.GetTimestamp()))
+		b.skewMetrics.record(topic, SkewSourcePayload, payloadSkew)
+		skew = max(skew, payloadSkew)
+	}
+
+	if b.staleThreshold <= 0 || skew <= b.staleThreshold {
+		return false
+	}
+	b.skewMetrics.recordStale(topic)
+	if b.debugEnabled() {
+		b.logger.Debug("publishing stale kafka message", "topic", topic, "skew", skew.String())
+	}
+	return true
+}
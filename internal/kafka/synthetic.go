@@ -0,0 +1,221 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"coin-futures-websocket/internal/types"
+)
+
+// syntheticTick is how often the generator catches up with its target rate
+const syntheticTick = 10 * time.Millisecond
+
+// syntheticUsersRefresh is how often the generator re-reads the users subscribed on this node
+const syntheticUsersRefresh = time.Second
+
+// syntheticSymbols are the instruments of generated positions
+var syntheticSymbols = []string{"BTCUSDT", "ETHUSDT", "SOLUSDT", "BNBUSDT", "XRPUSDT", "DOGEUSDT"}
+
+// SyntheticConfig configures the synthetic message generator
+type SyntheticConfig struct {
+	// Rate is the number of messages generated per second
+	Rate int
+
+	// Users is the number of synthetic CFX users without subscribers, mimicking the share of the real
+	// feed that is consumed and skipped. Users subscribed on this node are always included.
+	Users int
+
+	// PositionRatio is the share of UserPosition messages, 0 to 1; the rest are UserMargin
+	PositionRatio float64
+}
+
+// SyntheticGenerator feeds realistic UserMargin and UserPosition streams straight into the broadcaster,
+// for soak tests of memory and GC behavior without a Kafka cluster. It stands in for the consumer
+// as the upstream data feed.
+type SyntheticGenerator struct {
+	broadcaster *Broadcaster
+	config      SyntheticConfig
+	logger      *slog.Logger
+	rng         *rand.Rand
+
+	// subscribed holds the CFX users with subscribers, refreshed periodically
+	subscribed []string
+
+	generated    atomic.Int64
+	lastActivity atomic.Int64
+	running      atomic.Bool
+}
+
+// NewSyntheticGenerator creates a generator publishing through the broadcaster
+func NewSyntheticGenerator(broadcaster *Broadcaster, config SyntheticConfig, logger *slog.Logger) (*SyntheticGenerator, error) {
+	if config.Rate <= 0 {
+		return nil, fmt.Errorf("synthetic rate must be positive")
+	}
+	if config.Users < 0 {
+		return nil, fmt.Errorf("synthetic users must not be negative")
+	}
+	if config.PositionRatio < 0 || config.PositionRatio > 1 {
+		return nil, fmt.Errorf("synthetic position ratio must be between 0 and 1")
+	}
+
+	return &SyntheticGenerator{
+		broadcaster: broadcaster,
+		config:      config,
+		logger:      logger,
+		rng:         rand.New(rand.NewPCG(uint64(time.Now().UnixNano()), 0)),
+	}, nil
+}
+
+// Start generates messages at the configured rate until ctx is cancelled
+func (g *SyntheticGenerator) Start(ctx context.Context) error {
+	g.logger.Warn("synthetic kafka generator started, messages are not from CFX",
+		"rate", g.config.Rate,
+		"users", g.config.Users,
+		"position_ratio", g.config.PositionRatio)
+
+	g.running.Store(true)
+	defer g.running.Store(false)
+
+	ticker := time.NewTicker(syntheticTick)
+	defer ticker.Stop()
+
+	started := time.Now()
+	var refreshed time.Time
+	var sent int64
+	for {
+		select {
+		case <-ctx.Done():
+			g.logger.Info("synthetic kafka generator stopped", "generated", g.generated.Load())
+			return ctx.Err()
+		case now := <-ticker.C:
+			if now.Sub(refreshed) >= syntheticUsersRefresh {
+				g.subscribed = g.broadcaster.subscribedUserIDs()
+				refreshed = now
+			}
+
+			// Catch up with the target rate so slow ticks don't lower the throughput
+			due := int64(now.Sub(started).Seconds()*float64(g.config.Rate)) - sent
+			for range due {
+				g.generate(ctx, now)
+			}
+			sent += due
+		}
+	}
+}
+
+// generate publishes one message for a random user
+func (g *SyntheticGenerator) generate(ctx context.Context, now time.Time) {
+	cfxUserID, ok := g.pickUser()
+	if !ok {
+		return
+	}
+
+	topic, value := g.margin(cfxUserID, now)
+	if g.rng.Float64() < g.config.PositionRatio {
+		topic, value = g.position(cfxUserID, now)
+	}
+
+	if err := g.broadcaster.HandleMessage(ctx, topic, []byte(cfxUserID), value); err != nil {
+		g.logger.Warn("failed to handle synthetic message", "topic", topic, "error", err)
+	}
+	g.generated.Add(1)
+	g.lastActivity.Store(now.UnixNano())
+}
+
+// pickUser returns a random user among the subscribed and synthetic users
+func (g *SyntheticGenerator) pickUser() (string, bool) {
+	total := len(g.subscribed) + g.config.Users
+	if total == 0 {
+		return "", false
+	}
+
+	i := g.rng.IntN(total)
+	if i < len(g.subscribed) {
+		return g.subscribed[i], true
+	}
+	return "synthetic_" + strconv.Itoa(i-len(g.subscribed)), true
+}
+
+// margin builds a UserMargin message with plausible balances
+func (g *SyntheticGenerator) margin(cfxUserID string, now time.Time) (string, []byte) {
+	wallet := 100 + g.rng.Float64()*100000
+	pnl := (g.rng.Float64() - 0.5) * wallet * 0.2
+	positionValue := wallet * g.rng.Float64() * 5
+	maintenance := positionValue * 0.005
+	orderMargin := wallet * g.rng.Float64() * 0.1
+
+	margin := types.UserMargin{
+		Timestamp:          now.UnixMilli(),
+		CFXUserID:          cfxUserID,
+		Asset:              "USDT",
+		TotalPositionValue: positionValue,
+		MarginBalance:      wallet + pnl,
+		OrderMargin:        orderMargin,
+		EffectiveLeverage:  positionValue / wallet,
+		MaintenanceMargin:  maintenance,
+		UnrealizedPnl:      pnl,
+		AvailableMargin:    max(wallet+pnl-orderMargin-maintenance, 0),
+		WalletBalance:      wallet,
+		MarginRatio:        maintenance / (wallet + pnl),
+		WithdrawableMargin: max(wallet-orderMargin, 0),
+	}
+	data, _ := json.Marshal(margin)
+	return types.TopicUserMargin, data
+}
+
+// position builds a UserPosition message for a random symbol
+func (g *SyntheticGenerator) position(cfxUserID string, now time.Time) (string, []byte) {
+	leverage := 1 + g.rng.IntN(50)
+	entry := 10 + g.rng.Float64()*60000
+	mark := entry * (1 + (g.rng.Float64()-0.5)*0.05)
+	size := (g.rng.Float64() - 0.5) * 10
+	value := size * mark
+
+	position := types.UserPosition{
+		Timestamp:                now.UnixMilli(),
+		CFXUserID:                cfxUserID,
+		Symbol:                   syntheticSymbols[g.rng.IntN(len(syntheticSymbols))],
+		Size:                     size,
+		Value:                    value,
+		Leverage:                 leverage,
+		EntryPrice:               entry,
+		MarkPrice:                mark,
+		LiquidationPrice:         entry * (1 - 1/float64(leverage)),
+		MaintenanceMargin:        math.Abs(value) * 0.005,
+		UnrealisedPnl:            size * (mark - entry),
+		RiskLimit:                1000000,
+		InitialMarginRequirement: 1 / float64(leverage),
+		UpdatedTime:              now.UnixMilli(),
+		OrderMargin:              math.Abs(value) / float64(leverage),
+	}
+	data, _ := json.Marshal(position)
+	return types.TopicUserPosition, data
+}
+
+// Generated returns the number of messages generated so far
+func (g *SyntheticGenerator) Generated() int64 {
+	return g.generated.Load()
+}
+
+// IsHealthy reports whether the generator is running
+func (g *SyntheticGenerator) IsHealthy() bool {
+	return g.running.Load()
+}
+
+// LastActivity returns when the last message was generated
+func (g *SyntheticGenerator) LastActivity() time.Time {
+	if ns := g.lastActivity.Load(); ns > 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
+}
+
+// Reconnect is a no-op; the generator has no connection to drop
+func (g *SyntheticGenerator) Reconnect() {}
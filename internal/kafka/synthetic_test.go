@@ -0,0 +1,72 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"coin-futures-websocket/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewSyntheticGenerator tests validation of the generator configuration
+func TestNewSyntheticGenerator(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	broadcaster := NewBroadcaster(discardPublisher{}, nil, logger)
+
+	for name, config := range map[string]SyntheticConfig{
+		"zero rate":               {Rate: 0},
+		"negative users":          {Rate: 10, Users: -1},
+		"position ratio over one": {Rate: 10, PositionRatio: 1.5},
+		"negative position ratio": {Rate: 10, PositionRatio: -0.1},
+	} {
+		_, err := NewSyntheticGenerator(broadcaster, config, logger)
+		assert.Error(t, err, name)
+	}
+
+	_, err := NewSyntheticGenerator(broadcaster, SyntheticConfig{Rate: 10, Users: 100, PositionRatio: 0.5}, logger)
+	assert.NoError(t, err)
+}
+
+// TestSyntheticGenerator tests that generated messages reach the subscribed user's channels
+func TestSyntheticGenerator(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	publisher := &recordingPublisher{}
+	broadcaster := NewBroadcaster(publisher, nil, logger)
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:margin", "12345", "USDT")
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:position", "12345", "USDT")
+
+	generator, err := NewSyntheticGenerator(broadcaster, SyntheticConfig{Rate: 1000, PositionRatio: 0.5}, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, generator.Start(ctx), context.DeadlineExceeded)
+
+	assert.False(t, generator.IsHealthy())
+	assert.False(t, generator.LastActivity().IsZero())
+	require.Positive(t, generator.Generated())
+	require.Len(t, publisher.channels, int(generator.Generated()))
+
+	for i, ch := range publisher.channels {
+		switch ch {
+		case "user:12345:margin":
+			var margin types.UserMargin
+			require.NoError(t, json.Unmarshal(publisher.payloads[i], &margin))
+			assert.Equal(t, "cfx_1", margin.CFXUserID)
+			assert.Equal(t, "USDT", margin.Asset)
+		case "user:12345:position":
+			var position types.UserPosition
+			require.NoError(t, json.Unmarshal(publisher.payloads[i], &position))
+			assert.Equal(t, "cfx_1", position.CFXUserID)
+			assert.Contains(t, syntheticSymbols, position.Symbol)
+		default:
+			t.Fatalf("unexpected channel %s", ch)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// TopicsPath is the admin route listing (GET), pausing (POST ?topic=) and resuming (DELETE ?topic=)
+// per-topic readers
+const TopicsPath = "/kafka/topics"
+
+// TopicStats is the state of one per-topic reader
+type TopicStats struct {
+	Topic   string        `json:"topic"`
+	GroupID string        `json:"group_id"`
+	Stats   ConsumerStats `json:"stats"`
+}
+
+// TopicConsumers consumes each topic with an independent reader and consume loop, so a failing
+// topic is restarted, budgeted and paused without holding up the others
+type TopicConsumers struct {
+	topics    []string
+	consumers map[string]*KafkaReaderConsumer
+	logger    *slog.Logger
+}
+
+// NewTopicConsumers creates one reader per configured topic. With separateGroups, the reader of each
+// topic joins the group {GroupID}-{topic}, so its partitions are assigned and committed independently.
+func NewTopicConsumers(config *ConsumerConfig, separateGroups bool, logger *slog.Logger) (*TopicConsumers, error) {
+	if config == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	if len(config.Topics) == 0 {
+		return nil, fmt.Errorf("topics cannot be empty")
+	}
+
+	if config.TopicPattern != "" {
+		return nil, fmt.Errorf("a topic pattern is not supported with per-topic readers")
+	}
+
+	tc := &TopicConsumers{
+		topics:    config.Topics,
+		consumers: make(map[string]*KafkaReaderConsumer, len(config.Topics)),
+		logger:    logger,
+	}
+	for _, topic := range config.Topics {
+		if _, ok := tc.consumers[topic]; ok {
+			return nil, fmt.Errorf("duplicate topic %s", topic)
+		}
+
+		topicConfig := *config
+		topicConfig.Topics = []string{topic}
+		if separateGroups && config.GroupID != "" {
+			topicConfig.GroupID = config.GroupID + "-" + topic
+		}
+
+		consumer, err := NewKafkaReaderConsumer(&topicConfig, logger.With("topic", topic))
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %w", topic, err)
+		}
+		tc.consumers[topic] = consumer
+	}
+
+	return tc, nil
+}
+
+// Start starts the consume loop of every topic
+func (tc *TopicConsumers) Start(ctx context.Context) error {
+	for _, topic := range tc.topics {
+		if err := tc.consumers[topic].Start(ctx); err != nil {
+			return fmt.Errorf("topic %s: %w", topic, err)
+		}
+	}
+	return nil
+}
+
+// Close shuts down every reader
+func (tc *TopicConsumers) Close() error {
+	var errs []error
+	for _, topic := range tc.topics {
+		if err := tc.consumers[topic].Close(); err != nil {
+			errs = append(errs, fmt.Errorf("topic %s: %w", topic, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsHealthy returns true if every reader is connected
+func (tc *TopicConsumers) IsHealthy() bool {
+	for _, consumer := range tc.consumers {
+		if !consumer.IsHealthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// Joined returns true once every reader has joined its group
+func (tc *TopicConsumers) Joined() bool {
+	for _, consumer := range tc.consumers {
+		if !consumer.Joined() {
+			return false
+		}
+	}
+	return true
+}
+
+// Stats returns the statistics of all readers combined; the consumer is connected (joined) when all readers are
+func (tc *TopicConsumers) Stats() ConsumerStats {
+	combined := ConsumerStats{Connected: true, Joined: true}
+	for _, topic := range tc.topics {
+		stats := tc.consumers[topic].Stats()
+		combined.MessagesConsumed += stats.MessagesConsumed
+		combined.MessagesErrors += stats.MessagesErrors
+		combined.MessagesStale += stats.MessagesStale
+		combined.Restarts += stats.Restarts
+		combined.Recoveries += stats.Recoveries
+		combined.BudgetExhaustions += stats.BudgetExhaustions
+		combined.Connected = combined.Connected && stats.Connected
+		combined.Paused = combined.Paused || stats.Paused
+		combined.Joined = combined.Joined && stats.Joined
+		if stats.LastMessageTime.After(combined.LastMessageTime) {
+			combined.LastMessageTime = stats.LastMessageTime
+		}
+		if stats.LastFetchTime.After(combined.LastFetchTime) {
+			combined.LastFetchTime = stats.LastFetchTime
+		}
+		combined.FetchDelay = max(combined.FetchDelay, stats.FetchDelay)
+		if stats.LastRestartTime.After(combined.LastRestartTime) {
+			combined.LastRestartTime = stats.LastRestartTime
+		}
+	}
+	return combined
+}
+
+// FetchDelay returns the largest fetch delay of the readers, as the slowest topic holds back its channels
+func (tc *TopicConsumers) FetchDelay() time.Duration {
+	var delay time.Duration
+	for _, consumer := range tc.consumers {
+		delay = max(delay, consumer.FetchDelay())
+	}
+	return delay
+}
+
+// TopicStats returns the state of each reader, in configuration order
+func (tc *TopicConsumers) TopicStats() []TopicStats {
+	stats := make([]TopicStats, 0, len(tc.topics))
+	for _, topic := range tc.topics {
+		consumer := tc.consumers[topic]
+		stats = append(stats, TopicStats{Topic: topic, GroupID: consumer.groupID, Stats: consumer.Stats()})
+	}
+	return stats
+}
+
+// LastActivity returns the oldest activity among the readers, so a single stalled topic is detected
+func (tc *TopicConsumers) LastActivity() time.Time {
+	var oldest time.Time
+	for _, consumer := range tc.consumers {
+		if activity := consumer.LastActivity(); oldest.IsZero() || activity.Before(oldest) {
+			oldest = activity
+		}
+	}
+	return oldest
+}
+
+// Reconnect reconnects every reader
+func (tc *TopicConsumers) Reconnect() {
+	for _, consumer := range tc.consumers {
+		consumer.Reconnect()
+	}
+}
+
+// Pause stops fetching the topic until Resume
+func (tc *TopicConsumers) Pause(topic string) error {
+	consumer, ok := tc.consumers[topic]
+	if !ok {
+		return fmt.Errorf("topic %s is not consumed", topic)
+	}
+	consumer.Pause()
+	return nil
+}
+
+// Resume continues fetching a paused topic
+func (tc *TopicConsumers) Resume(topic string) error {
+	consumer, ok := tc.consumers[topic]
+	if !ok {
+		return fmt.Errorf("topic %s is not consumed", topic)
+	}
+	consumer.Resume()
+	return nil
+}
+
+// CheckpointHandler returns the admin HTTP handler exporting and importing the checkpoint of the
+// reader selected by ?topic=
+func (tc *TopicConsumers) CheckpointHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		consumer, ok := tc.consumers[r.URL.Query().Get("topic")]
+		if !ok {
+			http.Error(w, "topic must name a consumed topic", http.StatusBadRequest)
+			return
+		}
+		consumer.CheckpointHandler().ServeHTTP(w, r)
+	})
+}
+
+// TopicsHandler returns the admin HTTP handler listing, pausing and resuming per-topic readers
+func (tc *TopicConsumers) TopicsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		topic := r.URL.Query().Get("topic")
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(map[string][]TopicStats{"topics": tc.TopicStats()}); err != nil {
+				tc.logger.Error("failed to encode topic stats", "error", err)
+			}
+		case http.MethodPost:
+			if err := tc.Pause(topic); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			if err := tc.Resume(topic); err != nil {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
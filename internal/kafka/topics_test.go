@@ -0,0 +1,150 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTopicConsumers creates per-topic consumers that are never started
+func newTestTopicConsumers(t *testing.T, separateGroups bool) *TopicConsumers {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumers, err := NewTopicConsumers(&ConsumerConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: "test-group",
+		Topics:  []string{"margin", "position"},
+		Handler: func(ctx context.Context, topic string, key []byte, value []byte) error { return nil },
+	}, separateGroups, logger)
+	require.NoError(t, err)
+	return consumers
+}
+
+// TestNewTopicConsumers tests that each topic gets its own reader and, optionally, its own group
+func TestNewTopicConsumers(t *testing.T) {
+	shared := newTestTopicConsumers(t, false)
+	require.Len(t, shared.consumers, 2)
+	assert.Equal(t, []string{"margin"}, shared.consumers["margin"].topics)
+	assert.Equal(t, "test-group", shared.consumers["position"].groupID)
+
+	separate := newTestTopicConsumers(t, true)
+	assert.Equal(t, "test-group-margin", separate.consumers["margin"].groupID)
+	assert.Equal(t, "test-group-position", separate.consumers["position"].groupID)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	_, err := NewTopicConsumers(&ConsumerConfig{
+		Brokers: []string{"localhost:9092"},
+		GroupID: "test-group",
+		Topics:  []string{"margin", "margin"},
+		Handler: func(ctx context.Context, topic string, key []byte, value []byte) error { return nil },
+	}, false, logger)
+	assert.ErrorContains(t, err, "duplicate topic")
+}
+
+// TestTopicConsumersIsolation tests that stats and pauses are kept per topic
+func TestTopicConsumersIsolation(t *testing.T) {
+	consumers := newTestTopicConsumers(t, false)
+	consumers.consumers["margin"].incrementMessagesErrors()
+	consumers.consumers["position"].incrementMessagesConsumed()
+
+	require.NoError(t, consumers.Pause("margin"))
+	assert.True(t, consumers.consumers["margin"].Paused())
+	assert.False(t, consumers.consumers["position"].Paused())
+	assert.Error(t, consumers.Pause("orders"))
+
+	stats := consumers.TopicStats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "margin", stats[0].Topic)
+	assert.EqualValues(t, 1, stats[0].Stats.MessagesErrors)
+	assert.True(t, stats[0].Stats.Paused)
+	assert.EqualValues(t, 1, stats[1].Stats.MessagesConsumed)
+	assert.False(t, stats[1].Stats.Paused)
+
+	combined := consumers.Stats()
+	assert.EqualValues(t, 1, combined.MessagesErrors)
+	assert.EqualValues(t, 1, combined.MessagesConsumed)
+	assert.True(t, combined.Paused)
+
+	require.NoError(t, consumers.Resume("margin"))
+	assert.False(t, consumers.Stats().Paused)
+}
+
+// TestTopicConsumersFetchDelay tests that the per-topic consumers report the delay of their slowest reader
+func TestTopicConsumersFetchDelay(t *testing.T) {
+	consumers := newTestTopicConsumers(t, false)
+	assert.Zero(t, consumers.FetchDelay())
+
+	consumers.consumers["margin"].recordFetchDelay(time.Now().Add(-5 * time.Second))
+	consumers.consumers["position"].recordFetchDelay(time.Now().Add(-time.Second))
+	consumers.consumers["position"].recordFetchDelay(time.Time{})
+
+	assert.GreaterOrEqual(t, consumers.FetchDelay(), 5*time.Second)
+	assert.Less(t, consumers.consumers["position"].FetchDelay(), 5*time.Second)
+	assert.Equal(t, consumers.FetchDelay(), consumers.Stats().FetchDelay)
+}
+
+// TestWatchJoin tests that readers are joined once their group assigns them partitions, and the
+// per-topic consumers once every reader is
+func TestWatchJoin(t *testing.T) {
+	consumers := newTestTopicConsumers(t, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var rebalances atomic.Int64
+	go consumers.consumers["margin"].watchJoin(ctx, func() kafka.ReaderStats {
+		return kafka.ReaderStats{Rebalances: rebalances.Load()}
+	})
+	assert.Never(t, consumers.consumers["margin"].Joined, 3*joinPollInterval, joinPollInterval/5)
+
+	rebalances.Store(1)
+	assert.Eventually(t, consumers.consumers["margin"].Joined, 3*joinPollInterval, joinPollInterval/5)
+	assert.False(t, consumers.Joined())
+	assert.False(t, consumers.Stats().Joined)
+
+	go consumers.consumers["position"].watchJoin(ctx, func() kafka.ReaderStats {
+		return kafka.ReaderStats{Rebalances: 1}
+	})
+	assert.Eventually(t, consumers.Joined, 3*joinPollInterval, joinPollInterval/5)
+	assert.True(t, consumers.Stats().Joined)
+}
+
+// TestTopicsHandler tests listing, pausing and resuming topics through the admin endpoint
+func TestTopicsHandler(t *testing.T) {
+	consumers := newTestTopicConsumers(t, false)
+	handler := consumers.TopicsHandler()
+
+	serve := func(method, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, TopicsPath+query, nil))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodPost, "?topic=position").Code)
+	assert.True(t, consumers.consumers["position"].Paused())
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodPost, "?topic=orders").Code)
+
+	rec := serve(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body map[string][]TopicStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	require.Len(t, body["topics"], 2)
+	assert.True(t, body["topics"][1].Stats.Paused)
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "?topic=position").Code)
+	assert.False(t, consumers.consumers["position"].Paused())
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPut, "").Code)
+
+	// Checkpoints are exported per topic
+	rec = httptest.NewRecorder()
+	consumers.CheckpointHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, CheckpointPath, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
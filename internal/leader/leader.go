@@ -0,0 +1,252 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Election modes
+const (
+	// ModeStandalone makes every replica the leader, for single-replica deployments and development
+	ModeStandalone = "standalone"
+
+	// ModeKafka elects the replica assigned the single partition of a leader topic in a consumer group
+	ModeKafka = "kafka"
+)
+
+// defaultRestartDelay is how long a failed task waits before it runs again while still leading
+const defaultRestartDelay = 5 * time.Second
+
+// Task is a background job run by the leader only. Run blocks until ctx is cancelled, which happens
+// when this replica loses leadership or shuts down; the task then starts on the new leader.
+type Task interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+// Elector campaigns for leadership until ctx is cancelled. Each time this replica is elected it calls
+// lead with a context cancelled when leadership is lost, and waits for lead to return before campaigning
+// again.
+type Elector interface {
+	Campaign(ctx context.Context, lead func(ctx context.Context)) error
+}
+
+// ParseMode validates an election mode, defaulting to standalone
+func ParseMode(mode string) (string, error) {
+	switch strings.ToLower(mode) {
+	case "", ModeStandalone:
+		return ModeStandalone, nil
+	case ModeKafka:
+		return ModeKafka, nil
+	default:
+		return "", fmt.Errorf("unknown leader election mode %q, want standalone or kafka", mode)
+	}
+}
+
+// standaloneElector leads from the start until ctx is cancelled
+type standaloneElector struct{}
+
+// NewStandaloneElector creates an elector under which this replica always leads
+func NewStandaloneElector() Elector {
+	return standaloneElector{}
+}
+
+// Campaign leads until ctx is cancelled
+func (standaloneElector) Campaign(ctx context.Context, lead func(ctx context.Context)) error {
+	lead(ctx)
+	return ctx.Err()
+}
+
+// TaskStatus is the state of a registered task on this replica
+type TaskStatus struct {
+	Name      string `json:"name"`
+	Running   bool   `json:"running"`
+	Restarts  int64  `json:"restarts"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Status is the leadership of this replica
+type Status struct {
+	InstanceID string       `json:"instance_id"`
+	Mode       string       `json:"mode"`
+	Leader     bool         `json:"leader"`
+	Since      *time.Time   `json:"since,omitempty"`
+	Terms      int64        `json:"terms"`
+	Tasks      []TaskStatus `json:"tasks"`
+}
+
+// task is a registered task and its state
+type task struct {
+	task   Task
+	status TaskStatus
+}
+
+// Manager runs registered tasks while this replica leads, stopping them when leadership moves
+type Manager struct {
+	elector      Elector
+	mode         string
+	instanceID   string
+	restartDelay time.Duration
+	logger       *slog.Logger
+
+	mu     sync.Mutex
+	tasks  []*task
+	leader bool
+	since  time.Time
+	terms  int64
+}
+
+// NewManager creates a manager campaigning through elector; register tasks before Start
+func NewManager(elector Elector, mode, instanceID string, logger *slog.Logger) *Manager {
+	return &Manager{
+		elector:      elector,
+		mode:         mode,
+		instanceID:   instanceID,
+		restartDelay: defaultRestartDelay,
+		logger:       logger,
+	}
+}
+
+// SetRestartDelay sets how long a failed task waits before it runs again while still leading
+func (m *Manager) SetRestartDelay(d time.Duration) {
+	if d > 0 {
+		m.restartDelay = d
+	}
+}
+
+// Register adds a task run by the leader. Tasks registered after Start run from the next term, as long as
+// Start campaigned.
+func (m *Manager) Register(t Task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tasks = append(m.tasks, &task{task: t, status: TaskStatus{Name: t.Name()}})
+}
+
+// Start campaigns for leadership until ctx is cancelled. Without registered tasks there is nothing to lead,
+// so it does not campaign and a Kafka elector never joins its group.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	tasks := len(m.tasks)
+	m.mu.Unlock()
+	if tasks == 0 {
+		m.logger.Info("no leader tasks registered, skipping leader election", "mode", m.mode)
+		return
+	}
+
+	go func() {
+		if err := m.elector.Campaign(ctx, m.lead); err != nil && ctx.Err() == nil {
+			m.logger.Error("leader election stopped", "error", err)
+		}
+	}()
+}
+
+// IsLeader reports whether this replica currently leads
+func (m *Manager) IsLeader() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.leader
+}
+
+// Status returns the leadership of this replica and the state of its tasks
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := Status{
+		InstanceID: m.instanceID,
+		Mode:       m.mode,
+		Leader:     m.leader,
+		Terms:      m.terms,
+		Tasks:      make([]TaskStatus, 0, len(m.tasks)),
+	}
+	if m.leader {
+		since := m.since
+		status.Since = &since
+	}
+	for _, t := range m.tasks {
+		status.Tasks = append(status.Tasks, t.status)
+	}
+	return status
+}
+
+// lead runs every task for one term, returning once they all stopped
+func (m *Manager) lead(ctx context.Context) {
+	m.mu.Lock()
+	m.leader = true
+	m.since = time.Now()
+	m.terms++
+	tasks := append([]*task(nil), m.tasks...)
+	m.mu.Unlock()
+
+	m.logger.Info("elected leader", "instance_id", m.instanceID, "tasks", len(tasks))
+
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.run(ctx, t)
+		}()
+	}
+	wg.Wait()
+
+	m.mu.Lock()
+	m.leader = false
+	m.mu.Unlock()
+
+	m.logger.Info("leadership lost, tasks stopped", "instance_id", m.instanceID)
+}
+
+// run runs a task until ctx is cancelled, restarting it after restartDelay when it fails
+func (m *Manager) run(ctx context.Context, t *task) {
+	for {
+		m.setRunning(t, true, nil)
+		err := t.task.Run(ctx)
+		m.setRunning(t, false, err)
+
+		if ctx.Err() != nil {
+			return
+		}
+		m.logger.Error("leader task stopped, restarting",
+			"task", t.status.Name,
+			"error", err,
+			"restart_delay", m.restartDelay.String())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.restartDelay):
+		}
+
+		m.mu.Lock()
+		t.status.Restarts++
+		m.mu.Unlock()
+	}
+}
+
+// setRunning records whether a task runs, and the error it stopped with
+func (m *Manager) setRunning(t *task, running bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t.status.Running = running
+	if err != nil {
+		t.status.LastError = err.Error()
+	}
+}
+
+// Handler returns the admin HTTP handler reporting the leadership of this replica
+func (m *Manager) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(m.Status()); err != nil {
+			m.logger.Error("failed to encode leader status", "error", err)
+		}
+	})
+}
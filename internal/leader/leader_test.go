@@ -0,0 +1,164 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// termElector leads for each term sent on terms until the term's context is cancelled by closing it
+type termElector struct {
+	terms chan chan struct{}
+}
+
+// Campaign leads once per term
+func (e *termElector) Campaign(ctx context.Context, lead func(ctx context.Context)) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case end := <-e.terms:
+			termCtx, cancel := context.WithCancel(ctx)
+			go func() {
+				<-end
+				cancel()
+			}()
+			lead(termCtx)
+			cancel()
+		}
+	}
+}
+
+// funcTask runs fn as a task
+type funcTask struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (t funcTask) Name() string                  { return t.name }
+func (t funcTask) Run(ctx context.Context) error { return t.fn(ctx) }
+
+// TestParseMode tests election mode parsing
+func TestParseMode(t *testing.T) {
+	mode, err := ParseMode("")
+	require.NoError(t, err)
+	assert.Equal(t, ModeStandalone, mode)
+
+	mode, err = ParseMode("Kafka")
+	require.NoError(t, err)
+	assert.Equal(t, ModeKafka, mode)
+
+	_, err = ParseMode("redis")
+	assert.ErrorContains(t, err, "redis")
+}
+
+// TestManager tests that tasks run only while leading and move with each term
+func TestManager(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	elector := &termElector{terms: make(chan chan struct{})}
+	manager := NewManager(elector, ModeKafka, "node-1", logger)
+
+	var running atomic.Int32
+	manager.Register(funcTask{name: "preloader", fn: func(ctx context.Context) error {
+		running.Add(1)
+		defer running.Add(-1)
+		<-ctx.Done()
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	assert.False(t, manager.IsLeader())
+	assert.Zero(t, running.Load())
+
+	for term := int64(1); term <= 2; term++ {
+		end := make(chan struct{})
+		elector.terms <- end
+		assert.Eventually(t, func() bool { return running.Load() == 1 }, time.Second, 5*time.Millisecond)
+		assert.True(t, manager.IsLeader())
+
+		status := manager.Status()
+		assert.Equal(t, term, status.Terms)
+		require.NotNil(t, status.Since)
+		assert.Equal(t, []TaskStatus{{Name: "preloader", Running: true}}, status.Tasks)
+
+		close(end)
+		assert.Eventually(t, func() bool { return !manager.IsLeader() }, time.Second, 5*time.Millisecond)
+		assert.Zero(t, running.Load())
+	}
+}
+
+// TestManagerRestartsFailedTasks tests that a failing task is restarted while still leading
+func TestManagerRestartsFailedTasks(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager := NewManager(NewStandaloneElector(), ModeStandalone, "node-1", logger)
+	manager.SetRestartDelay(time.Millisecond)
+
+	var runs atomic.Int32
+	manager.Register(funcTask{name: "flaky", fn: func(ctx context.Context) error {
+		if runs.Add(1) < 3 {
+			return errors.New("dependency down")
+		}
+		<-ctx.Done()
+		return nil
+	}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	assert.Eventually(t, func() bool { return runs.Load() == 3 }, time.Second, 5*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	manager.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/leader", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var status Status
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.True(t, status.Leader)
+	assert.Equal(t, "node-1", status.InstanceID)
+	require.Len(t, status.Tasks, 1)
+	assert.EqualValues(t, 2, status.Tasks[0].Restarts)
+	assert.Equal(t, "dependency down", status.Tasks[0].LastError)
+	assert.True(t, status.Tasks[0].Running)
+}
+
+// countingElector counts the campaigns started through it
+type countingElector struct {
+	campaigns atomic.Int32
+}
+
+// Campaign counts the campaign and leads until ctx is cancelled
+func (e *countingElector) Campaign(ctx context.Context, lead func(ctx context.Context)) error {
+	e.campaigns.Add(1)
+	lead(ctx)
+	return ctx.Err()
+}
+
+// TestManagerWithoutTasks tests that no election is held when no task is registered
+func TestManagerWithoutTasks(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	elector := &countingElector{}
+	manager := NewManager(elector, ModeKafka, "node-1", logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.Start(ctx)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, elector.campaigns.Load())
+	assert.False(t, manager.IsLeader())
+	assert.Empty(t, manager.Status().Tasks)
+}
@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Module names used for per-module log level overrides
+const (
+	ModuleKafka       = "kafka"
+	ModuleHandler     = "handler"
+	ModuleTransformer = "transformer"
+	ModuleService     = "service"
+	ModuleAudit       = "audit"
+)
+
+// ParseLevel converts a config level string to a slog level, defaulting to info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "info":
+		return slog.LevelInfo
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Levels holds the default log level and per-module overrides.
+// Levels can be changed at runtime and take effect on the next log call.
+type Levels struct {
+	defaultLevel slog.LevelVar
+
+	mu      sync.RWMutex
+	modules map[string]*slog.LevelVar
+}
+
+// NewLevels creates a level registry with the given default level
+func NewLevels(defaultLevel slog.Level) *Levels {
+	l := &Levels{
+		modules: make(map[string]*slog.LevelVar),
+	}
+	l.defaultLevel.Set(defaultLevel)
+	return l
+}
+
+// Apply replaces the default level and module overrides; modules missing from overrides fall back to the default
+func (l *Levels) Apply(defaultLevel slog.Level, overrides map[string]string) {
+	l.defaultLevel.Set(defaultLevel)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for module := range l.modules {
+		if _, ok := overrides[module]; !ok {
+			delete(l.modules, module)
+		}
+	}
+	for module, level := range overrides {
+		v, ok := l.modules[module]
+		if !ok {
+			v = &slog.LevelVar{}
+			l.modules[module] = v
+		}
+		v.Set(ParseLevel(level))
+	}
+}
+
+// Level returns the effective level for a module
+func (l *Levels) Level(module string) slog.Level {
+	l.mu.RLock()
+	v, ok := l.modules[module]
+	l.mu.RUnlock()
+	if ok {
+		return v.Level()
+	}
+	return l.defaultLevel.Level()
+}
+
+// moduleHandler filters records by the module's effective level
+type moduleHandler struct {
+	slog.Handler
+	module string
+	levels *Levels
+}
+
+// Enabled reports whether the module's current level allows the record
+func (h *moduleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.levels.Level(h.module) && h.Handler.Enabled(ctx, level)
+}
+
+// WithAttrs keeps module filtering on derived handlers
+func (h *moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &moduleHandler{Handler: h.Handler.WithAttrs(attrs), module: h.module, levels: h.levels}
+}
+
+// WithGroup keeps module filtering on derived handlers
+func (h *moduleHandler) WithGroup(name string) slog.Handler {
+	return &moduleHandler{Handler: h.Handler.WithGroup(name), module: h.module, levels: h.levels}
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestManager creates a manager writing JSON lines to a buffer
+func newTestManager() (*Manager, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	handler := slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	return NewManager(handler), buf
+}
+
+// TestModuleLevels tests per-module level overrides and runtime changes
+func TestModuleLevels(t *testing.T) {
+	manager, buf := newTestManager()
+	manager.Apply(slog.LevelInfo, map[string]string{ModuleKafka: "debug"}, SamplingConfig{})
+
+	kafkaLogger := manager.Module(ModuleKafka)
+	handlerLogger := manager.Module(ModuleHandler)
+
+	kafkaLogger.Debug("kafka debug")
+	handlerLogger.Debug("handler debug")
+	handlerLogger.Info("handler info")
+
+	out := buf.String()
+	assert.Contains(t, out, "kafka debug")
+	assert.Contains(t, out, `"module":"kafka"`)
+	assert.NotContains(t, out, "handler debug")
+	assert.Contains(t, out, "handler info")
+
+	// Reload: kafka override removed, default raised to warn
+	buf.Reset()
+	manager.Apply(slog.LevelWarn, nil, SamplingConfig{})
+
+	kafkaLogger.Debug("kafka debug")
+	handlerLogger.Info("handler info")
+	assert.Empty(t, buf.String())
+}
+
+// TestSampling tests that repeated debug lines are sampled while other levels pass
+func TestSampling(t *testing.T) {
+	manager, buf := newTestManager()
+	manager.Apply(slog.LevelDebug, nil, SamplingConfig{
+		Enabled:    true,
+		Initial:    2,
+		Thereafter: 5,
+		Interval:   time.Hour,
+	})
+
+	logger := manager.Module(ModuleKafka)
+	for i := 0; i < 12; i++ {
+		logger.Debug("kafka message received")
+		logger.Info("kafka info")
+	}
+
+	out := buf.String()
+	// 2 initial + the 7th and 12th occurrences
+	assert.Equal(t, 4, strings.Count(out, "kafka message received"))
+	assert.Equal(t, 12, strings.Count(out, "kafka info"))
+}
+
+// TestSamplerWindowReset tests that counts reset each interval
+func TestSamplerWindowReset(t *testing.T) {
+	s := newSampler(SamplingConfig{Enabled: true, Initial: 1, Thereafter: 100, Interval: time.Second})
+	now := time.Now()
+
+	assert.True(t, s.allow("msg", now))
+	assert.False(t, s.allow("msg", now))
+	assert.True(t, s.allow("msg", now.Add(2*time.Second)))
+}
+
+// TestRedaction tests scrubbing of sensitive attributes, structs and JSON payloads
+func TestRedaction(t *testing.T) {
+	manager, buf := newTestManager()
+	manager.Apply(slog.LevelDebug, nil, SamplingConfig{})
+	manager.SetRedaction(RedactConfig{
+		Fields:         []string{"margin_balance", "wallet_balance"},
+		TokenFields:    []string{"token"},
+		TokenPrefixLen: 4,
+	})
+
+	type margin struct {
+		Asset         string  `json:"asset"`
+		MarginBalance float64 `json:"margin_balance"`
+	}
+
+	logger := manager.Module(ModuleKafka)
+	logger.Debug("kafka message received",
+		"value", json.RawMessage(`{"asset":"USDT","wallet_balance":1234.5,"nested":{"margin_balance":987.25}}`),
+		"margin", margin{Asset: "USDT", MarginBalance: 777.75},
+		"margin_balance", 555.5,
+		"token", "eyJhbGciOiJIUzI1NiJ9.secret")
+
+	out := buf.String()
+	assert.NotContains(t, out, "1234.5")
+	assert.NotContains(t, out, "987.25")
+	assert.NotContains(t, out, "777.75")
+	assert.NotContains(t, out, "555.5")
+	assert.NotContains(t, out, "secret")
+	assert.Contains(t, out, "eyJh...")
+	assert.Contains(t, out, "USDT")
+}
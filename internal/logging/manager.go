@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"log/slog"
+	"sync/atomic"
+)
+
+// Manager builds module loggers sharing one output handler, level registry, sampler and redactor
+type Manager struct {
+	base     slog.Handler
+	levels   *Levels
+	sampler  *sampler
+	redactor atomic.Pointer[redactor]
+}
+
+// NewManager creates a logging manager at info level with sampling disabled.
+// The base handler should accept all levels; filtering happens per module.
+func NewManager(base slog.Handler) *Manager {
+	m := &Manager{
+		base:    base,
+		levels:  NewLevels(slog.LevelInfo),
+		sampler: newSampler(SamplingConfig{}),
+	}
+	m.redactor.Store(newRedactor(RedactConfig{}))
+	return m
+}
+
+// Logger returns the root logger, filtered by the default level
+func (m *Manager) Logger() *slog.Logger {
+	return m.Module("")
+}
+
+// Module returns a logger for a module, tagged with a "module" attribute and
+// filtered by the module's level override
+func (m *Manager) Module(module string) *slog.Logger {
+	var handler slog.Handler = &redactHandler{Handler: m.base, redactor: &m.redactor}
+	handler = &samplingHandler{Handler: handler, sampler: m.sampler}
+	handler = &moduleHandler{Handler: handler, module: module, levels: m.levels}
+
+	logger := slog.New(handler)
+	if module != "" {
+		logger = logger.With("module", module)
+	}
+	return logger
+}
+
+// Apply updates levels and sampling at runtime, e.g. on config reload
+func (m *Manager) Apply(defaultLevel slog.Level, overrides map[string]string, sampling SamplingConfig) {
+	m.levels.Apply(defaultLevel, overrides)
+	m.sampler.setConfig(sampling)
+}
+
+// SetRedaction replaces the redacted field lists at runtime
+func (m *Manager) SetRedaction(config RedactConfig) {
+	m.redactor.Store(newRedactor(config))
+}
@@ -0,0 +1,198 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+const redactedValue = "[REDACTED]"
+
+// RedactConfig lists attribute and JSON field names scrubbed before emission.
+// Field names are matched case-insensitively at any nesting depth, including
+// inside JSON payloads and structs logged as values.
+type RedactConfig struct {
+	// Fields are replaced entirely (e.g. balances)
+	Fields []string
+	// TokenFields are truncated to TokenPrefixLen characters (e.g. JWTs)
+	TokenFields    []string
+	TokenPrefixLen int
+}
+
+// redactor applies a RedactConfig to log attributes
+type redactor struct {
+	fields         map[string]struct{}
+	tokenFields    map[string]struct{}
+	tokenPrefixLen int
+}
+
+// newRedactor builds a redactor from config
+func newRedactor(config RedactConfig) *redactor {
+	r := &redactor{
+		fields:         make(map[string]struct{}, len(config.Fields)),
+		tokenFields:    make(map[string]struct{}, len(config.TokenFields)),
+		tokenPrefixLen: config.TokenPrefixLen,
+	}
+	for _, f := range config.Fields {
+		r.fields[strings.ToLower(f)] = struct{}{}
+	}
+	for _, f := range config.TokenFields {
+		r.tokenFields[strings.ToLower(f)] = struct{}{}
+	}
+	if r.tokenPrefixLen <= 0 {
+		r.tokenPrefixLen = 8
+	}
+	return r
+}
+
+// empty reports whether nothing is configured for redaction
+func (r *redactor) empty() bool {
+	return len(r.fields) == 0 && len(r.tokenFields) == 0
+}
+
+// attr returns the attribute with sensitive values scrubbed
+func (r *redactor) attr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+	key := strings.ToLower(a.Key)
+
+	if _, ok := r.fields[key]; ok {
+		return slog.String(a.Key, redactedValue)
+	}
+	if _, ok := r.tokenFields[key]; ok {
+		return slog.String(a.Key, r.truncate(a.Value.String()))
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		scrubbed := make([]slog.Attr, len(group))
+		for i, ga := range group {
+			scrubbed[i] = r.attr(ga)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(scrubbed...)}
+	case slog.KindAny:
+		if v, ok := r.value(a.Value.Any()); ok {
+			return slog.Any(a.Key, v)
+		}
+	}
+	return a
+}
+
+// value scrubs JSON payloads, structs and maps; it reports false when v is left as-is
+func (r *redactor) value(v any) (any, bool) {
+	switch val := v.(type) {
+	case nil, error:
+		return nil, false
+	case json.RawMessage:
+		return r.rawJSON(val)
+	case []byte:
+		return r.rawJSON(val)
+	}
+
+	kind := reflect.TypeOf(v).Kind()
+	if kind == reflect.Pointer {
+		kind = reflect.TypeOf(v).Elem().Kind()
+	}
+	if kind != reflect.Struct && kind != reflect.Map {
+		return nil, false
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, false
+	}
+	return r.walk(decoded), true
+}
+
+// rawJSON scrubs a JSON document, leaving non-JSON bytes untouched
+func (r *redactor) rawJSON(data []byte) (any, bool) {
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, false
+	}
+	scrubbed, err := json.Marshal(r.walk(decoded))
+	if err != nil {
+		return nil, false
+	}
+	return json.RawMessage(scrubbed), true
+}
+
+// walk scrubs decoded JSON values recursively
+func (r *redactor) walk(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, inner := range val {
+			key := strings.ToLower(k)
+			if _, ok := r.fields[key]; ok {
+				val[k] = redactedValue
+				continue
+			}
+			if s, ok := inner.(string); ok {
+				if _, ok := r.tokenFields[key]; ok {
+					val[k] = r.truncate(s)
+					continue
+				}
+			}
+			val[k] = r.walk(inner)
+		}
+		return val
+	case []any:
+		for i, inner := range val {
+			val[i] = r.walk(inner)
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+// truncate keeps a short token prefix for correlation
+func (r *redactor) truncate(s string) string {
+	if len(s) <= r.tokenPrefixLen {
+		return redactedValue
+	}
+	return s[:r.tokenPrefixLen] + "..." + redactedValue
+}
+
+// redactHandler scrubs record and handler attributes before passing them on
+type redactHandler struct {
+	slog.Handler
+	redactor *atomic.Pointer[redactor]
+}
+
+// Handle scrubs the record's attributes
+func (h *redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	red := h.redactor.Load()
+	if red.empty() || r.NumAttrs() == 0 {
+		return h.Handler.Handle(ctx, r)
+	}
+
+	scrubbed := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		scrubbed.AddAttrs(red.attr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, scrubbed)
+}
+
+// WithAttrs scrubs attributes bound to derived loggers
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	red := h.redactor.Load()
+	scrubbed := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		scrubbed[i] = red.attr(a)
+	}
+	return &redactHandler{Handler: h.Handler.WithAttrs(scrubbed), redactor: h.redactor}
+}
+
+// WithGroup keeps redaction on derived handlers
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{Handler: h.Handler.WithGroup(name), redactor: h.redactor}
+}
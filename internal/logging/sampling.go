@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingConfig controls sampling of high-volume debug lines.
+// Within each interval the first Initial records with a given message are
+// logged, then every Thereafter-th one.
+type SamplingConfig struct {
+	Enabled    bool
+	Initial    uint64
+	Thereafter uint64
+	Interval   time.Duration
+}
+
+// sampler counts records per message within the current interval
+type sampler struct {
+	config atomic.Pointer[SamplingConfig]
+
+	mu          sync.Mutex
+	counts      map[string]uint64
+	windowStart time.Time
+}
+
+// newSampler creates a sampler with the given config
+func newSampler(config SamplingConfig) *sampler {
+	s := &sampler{counts: make(map[string]uint64)}
+	s.setConfig(config)
+	return s
+}
+
+// setConfig swaps the sampling config, applying defaults
+func (s *sampler) setConfig(config SamplingConfig) {
+	if config.Initial == 0 {
+		config.Initial = 10
+	}
+	if config.Thereafter == 0 {
+		config.Thereafter = 100
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Second
+	}
+	s.config.Store(&config)
+}
+
+// allow reports whether a record with this message should be emitted
+func (s *sampler) allow(message string, now time.Time) bool {
+	config := s.config.Load()
+	if !config.Enabled {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.windowStart) >= config.Interval {
+		s.windowStart = now
+		clear(s.counts)
+	}
+
+	s.counts[message]++
+	n := s.counts[message]
+	if n <= config.Initial {
+		return true
+	}
+	return (n-config.Initial)%config.Thereafter == 0
+}
+
+// samplingHandler drops debug records beyond the sampling budget; other levels always pass
+type samplingHandler struct {
+	slog.Handler
+	sampler *sampler
+}
+
+// Handle applies sampling to debug records before emission
+func (h *samplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level <= slog.LevelDebug && !h.sampler.allow(r.Message, r.Time) {
+		return nil
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs keeps sampling on derived handlers
+func (h *samplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithAttrs(attrs), sampler: h.sampler}
+}
+
+// WithGroup keeps sampling on derived handlers
+func (h *samplingHandler) WithGroup(name string) slog.Handler {
+	return &samplingHandler{Handler: h.Handler.WithGroup(name), sampler: h.sampler}
+}
@@ -0,0 +1,249 @@
+package receipt
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification operations replicating delivery receipts to every node
+const (
+	OpTrack = "receipt.track"
+	OpAck   = "receipt.ack"
+)
+
+// TagAckID is the publication tag carrying the ack ID of a critical publication
+const TagAckID = "ack_id"
+
+// Retention of unacknowledged publications when none is configured
+const (
+	defaultRetention  = time.Hour
+	defaultMaxPerUser = 100
+)
+
+// Critical is a publication the owner of its channel must acknowledge
+type Critical struct {
+	AckID       string          `json:"ack_id"`
+	AjaibID     string          `json:"ajaib_id"`
+	Channel     string          `json:"channel"`
+	Payload     json.RawMessage `json:"payload"`
+	PublishedAt time.Time       `json:"published_at"`
+}
+
+// ack is the replicated acknowledgment of a user's critical publications
+type ack struct {
+	AjaibID string   `json:"ajaib_id"`
+	AckIDs  []string `json:"ack_ids"`
+}
+
+// UserCount is the number of a user's unacknowledged publications
+type UserCount struct {
+	AjaibID  string    `json:"ajaib_id"`
+	Unacked  int       `json:"unacked"`
+	OldestAt time.Time `json:"oldest_at"`
+}
+
+// Counts is the response body of the receipts admin endpoint
+type Counts struct {
+	Total int         `json:"total"`
+	Users []UserCount `json:"users"`
+}
+
+// Notifier replicates an operation to every node, including the local one (implemented by centrifuge.Node)
+type Notifier interface {
+	Notify(op string, data []byte, toNodeID string) error
+}
+
+// Tracker holds the unacknowledged critical publications replicated to this node, so the node a user
+// reconnects to can redeliver them. Each user keeps at most maxPerUser, dropping the oldest first, for
+// at most retention.
+type Tracker struct {
+	notifier   Notifier
+	retention  time.Duration
+	maxPerUser int
+
+	// unacked holds each user's publications, oldest first
+	unacked map[string][]Critical
+	mu      sync.Mutex
+	logger  *slog.Logger
+}
+
+// NewTracker creates a tracker replicating through notifier; zero retention or maxPerUser use the defaults
+func NewTracker(notifier Notifier, retention time.Duration, maxPerUser int, logger *slog.Logger) *Tracker {
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+	if maxPerUser <= 0 {
+		maxPerUser = defaultMaxPerUser
+	}
+	return &Tracker{
+		notifier:   notifier,
+		retention:  retention,
+		maxPerUser: maxPerUser,
+		unacked:    make(map[string][]Critical),
+		logger:     logger,
+	}
+}
+
+// Track replicates a critical publication to every node, assigning its ack ID and publication time
+func (t *Tracker) Track(c Critical) (Critical, error) {
+	if c.AckID == "" {
+		c.AckID = newID()
+	}
+	if c.PublishedAt.IsZero() {
+		c.PublishedAt = time.Now()
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return c, err
+	}
+	return c, t.notifier.Notify(OpTrack, data, "")
+}
+
+// Ack replicates the acknowledgment of a user's critical publications to every node
+func (t *Tracker) Ack(ajaibID string, ackIDs []string) error {
+	data, err := json.Marshal(ack{AjaibID: ajaibID, AckIDs: ackIDs})
+	if err != nil {
+		return err
+	}
+	return t.notifier.Notify(OpAck, data, "")
+}
+
+// HandleNotification applies a replicated operation to this node's receipts
+func (t *Tracker) HandleNotification(op string, data []byte) {
+	switch op {
+	case OpTrack:
+		var c Critical
+		if err := json.Unmarshal(data, &c); err != nil {
+			t.logger.Error("invalid receipt notification", "error", err)
+			return
+		}
+
+		t.mu.Lock()
+		unacked := append(t.unacked[c.AjaibID], c)
+		if dropped := len(unacked) - t.maxPerUser; dropped > 0 {
+			t.logger.Warn("dropping unacknowledged publications over the per-user limit",
+				"ajaib_id", c.AjaibID,
+				"dropped", dropped)
+			unacked = slices.Delete(unacked, 0, dropped)
+		}
+		t.unacked[c.AjaibID] = unacked
+		t.mu.Unlock()
+	case OpAck:
+		var a ack
+		if err := json.Unmarshal(data, &a); err != nil {
+			t.logger.Error("invalid receipt notification", "error", err)
+			return
+		}
+
+		t.mu.Lock()
+		unacked := slices.DeleteFunc(t.unacked[a.AjaibID], func(c Critical) bool {
+			return slices.Contains(a.AckIDs, c.AckID)
+		})
+		if len(unacked) == 0 {
+			delete(t.unacked, a.AjaibID)
+		} else {
+			t.unacked[a.AjaibID] = unacked
+		}
+		t.mu.Unlock()
+	}
+}
+
+// Unacked returns a user's unacknowledged publications retained at the given time, oldest first
+func (t *Tracker) Unacked(ajaibID string, now time.Time) []Critical {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var unacked []Critical
+	for _, c := range t.unacked[ajaibID] {
+		if t.retained(c, now) {
+			unacked = append(unacked, c)
+		}
+	}
+	return unacked
+}
+
+// Counts returns the number of unacknowledged publications of each user, ordered by ajaib ID
+func (t *Tracker) Counts() Counts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := Counts{Users: make([]UserCount, 0, len(t.unacked))}
+	for ajaibID, unacked := range t.unacked {
+		counts.Total += len(unacked)
+		counts.Users = append(counts.Users, UserCount{
+			AjaibID:  ajaibID,
+			Unacked:  len(unacked),
+			OldestAt: unacked[0].PublishedAt,
+		})
+	}
+
+	slices.SortFunc(counts.Users, func(a, b UserCount) int {
+		return strings.Compare(a.AjaibID, b.AjaibID)
+	})
+	return counts
+}
+
+// Start drops publications past their retention every interval until ctx is cancelled
+func (t *Tracker) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				t.expire(now)
+			}
+		}
+	}()
+}
+
+// expire drops publications past their retention
+func (t *Tracker) expire(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for ajaibID, unacked := range t.unacked {
+		unacked = slices.DeleteFunc(unacked, func(c Critical) bool {
+			return !t.retained(c, now)
+		})
+		if len(unacked) == 0 {
+			delete(t.unacked, ajaibID)
+		} else {
+			t.unacked[ajaibID] = unacked
+		}
+	}
+}
+
+// retained reports whether a publication is still redelivered at the given time
+func (t *Tracker) retained(c Critical, now time.Time) bool {
+	return now.Sub(c.PublishedAt) < t.retention
+}
+
+// Handler returns the admin HTTP handler listing the unacknowledged publication counts per user
+func (t *Tracker) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(t.Counts()); err != nil {
+			t.logger.Error("failed to encode receipt counts", "error", err)
+		}
+	})
+}
+
+// newID returns a random ack ID
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,109 @@
+package receipt
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loopbackNotifier applies notifications to a tracker, as a single node would
+type loopbackNotifier struct {
+	tracker *Tracker
+}
+
+func (n *loopbackNotifier) Notify(op string, data []byte, toNodeID string) error {
+	n.tracker.HandleNotification(op, data)
+	return nil
+}
+
+func newTestTracker(retention time.Duration, maxPerUser int) *Tracker {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	notifier := &loopbackNotifier{}
+	tracker := NewTracker(notifier, retention, maxPerUser, logger)
+	notifier.tracker = tracker
+	return tracker
+}
+
+// track tracks a critical publication on a user's margin channel at the given time
+func track(t *testing.T, tracker *Tracker, ajaibID string, at time.Time) Critical {
+	t.Helper()
+	c, err := tracker.Track(Critical{
+		AjaibID:     ajaibID,
+		Channel:     "user:" + ajaibID + ":margin",
+		Payload:     json.RawMessage(`{"type":"liquidation_warning"}`),
+		PublishedAt: at,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, c.AckID)
+	return c
+}
+
+// TestTrackAndAck tests that publications stay unacknowledged until their owner acknowledges them
+func TestTrackAndAck(t *testing.T) {
+	tracker := newTestTracker(time.Hour, 10)
+	now := time.Unix(1700000000, 0).UTC()
+
+	first := track(t, tracker, "12345", now)
+	second := track(t, tracker, "12345", now.Add(time.Second))
+	other := track(t, tracker, "67890", now)
+
+	assert.Equal(t, []Critical{first, second}, tracker.Unacked("12345", now))
+
+	// Another user's ack IDs are ignored
+	require.NoError(t, tracker.Ack("67890", []string{first.AckID}))
+	assert.Len(t, tracker.Unacked("12345", now), 2)
+
+	require.NoError(t, tracker.Ack("12345", []string{first.AckID}))
+	assert.Equal(t, []Critical{second}, tracker.Unacked("12345", now))
+
+	require.NoError(t, tracker.Ack("12345", []string{second.AckID}))
+	assert.Empty(t, tracker.Unacked("12345", now))
+	assert.Equal(t, Counts{Total: 1, Users: []UserCount{{AjaibID: "67890", Unacked: 1, OldestAt: other.PublishedAt}}}, tracker.Counts())
+}
+
+// TestRetention tests the per-user limit and the expiry of old publications
+func TestRetention(t *testing.T) {
+	tracker := newTestTracker(time.Minute, 2)
+	now := time.Unix(1700000000, 0).UTC()
+
+	track(t, tracker, "12345", now)
+	second := track(t, tracker, "12345", now.Add(time.Second))
+	third := track(t, tracker, "12345", now.Add(2*time.Second))
+	assert.Equal(t, []Critical{second, third}, tracker.Unacked("12345", now))
+
+	later := now.Add(time.Minute + time.Second)
+	assert.Equal(t, []Critical{third}, tracker.Unacked("12345", later))
+
+	tracker.expire(now.Add(time.Hour))
+	assert.Equal(t, 0, tracker.Counts().Total)
+	assert.Empty(t, tracker.unacked)
+}
+
+// TestHandler tests the admin listing of unacknowledged counts
+func TestHandler(t *testing.T) {
+	tracker := newTestTracker(0, 0)
+	assert.Equal(t, defaultRetention, tracker.retention)
+	assert.Equal(t, defaultMaxPerUser, tracker.maxPerUser)
+
+	track(t, tracker, "67890", time.Now())
+	track(t, tracker, "12345", time.Now())
+	track(t, tracker, "12345", time.Now())
+
+	rec := httptest.NewRecorder()
+	tracker.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/receipts", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var counts Counts
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &counts))
+	assert.Equal(t, 3, counts.Total)
+	require.Len(t, counts.Users, 2)
+	assert.Equal(t, "12345", counts.Users[0].AjaibID)
+	assert.Equal(t, 2, counts.Users[0].Unacked)
+}
@@ -0,0 +1,84 @@
+package schema
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseConstants reads the integer constants named with prefix from the Go sources in dir, in source
+// order, so enums follow the code without a hand-kept list. The prefix is stripped from the names and
+// each constant's line or doc comment becomes its description.
+func ParseConstants(dir, prefix string) ([]EnumValue, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var values []EnumValue
+	fset := token.NewFileSet()
+	for _, path := range files {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		file, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.CONST {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				values = append(values, constantValues(spec.(*ast.ValueSpec), prefix)...)
+			}
+		}
+	}
+	return values, nil
+}
+
+// constantValues returns the prefixed integer literal constants of a spec
+func constantValues(spec *ast.ValueSpec, prefix string) []EnumValue {
+	var values []EnumValue
+	for i, name := range spec.Names {
+		if !strings.HasPrefix(name.Name, prefix) || name.Name == prefix || i >= len(spec.Values) {
+			continue
+		}
+		lit, ok := spec.Values[i].(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			continue
+		}
+		value, err := strconv.ParseInt(lit.Value, 0, 64)
+		if err != nil {
+			continue
+		}
+
+		comment := spec.Comment.Text()
+		if comment == "" {
+			comment = spec.Doc.Text()
+		}
+		// Doc comments start with the constant name, which the enum already carries
+		comment = strings.Join(strings.Fields(comment), " ")
+		if rest, ok := strings.CutPrefix(comment, name.Name+" "); ok {
+			comment = strings.ToUpper(rest[:1]) + rest[1:]
+		}
+		values = append(values, EnumValue{
+			Name:    strings.TrimPrefix(name.Name, prefix),
+			Value:   value,
+			Comment: comment,
+		})
+	}
+	return values
+}
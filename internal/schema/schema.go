@@ -0,0 +1,320 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// header marks generated files
+const header = "Code generated by go run ./cmd/genschema. DO NOT EDIT."
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// Enum is a named set of integer constants, such as the protocol error codes
+type Enum struct {
+	Name   string
+	Values []EnumValue
+}
+
+// EnumValue is a single constant of an enum
+type EnumValue struct {
+	Name    string
+	Value   int64
+	Comment string
+}
+
+// definition is a struct type rendered as an object
+type definition struct {
+	name   string
+	typ    reflect.Type
+	fields []field
+}
+
+// field is a JSON-encoded struct field
+type field struct {
+	name     string
+	typ      reflect.Type
+	optional bool
+}
+
+// Generator renders Go structs and enums as JSON Schema and TypeScript definitions.
+// Struct types are named after their Go type; named structs they reference are added too.
+type Generator struct {
+	enums []Enum
+	defs  []*definition
+	names map[string]*definition
+	types map[reflect.Type]string
+}
+
+// NewGenerator creates an empty generator
+func NewGenerator() *Generator {
+	return &Generator{
+		names: make(map[string]*definition),
+		types: make(map[reflect.Type]string),
+	}
+}
+
+// AddEnum adds an enum rendered as a constant object in TypeScript and a const list in JSON Schema
+func (g *Generator) AddEnum(e Enum) {
+	g.enums = append(g.enums, e)
+}
+
+// Add adds the struct type of v and the named structs it references
+func (g *Generator) Add(v any) error {
+	return g.AddAs("", v)
+}
+
+// AddAs adds the struct type of v under name, for Go names that clash with TypeScript globals
+// such as Error. An empty name keeps the Go name.
+func (g *Generator) AddAs(name string, v any) error {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t.Name() == "" {
+		return fmt.Errorf("%s is not a named struct type", t)
+	}
+	return g.addStruct(t, name)
+}
+
+func (g *Generator) addStruct(t reflect.Type, name string) error {
+	if _, ok := g.types[t]; ok {
+		return nil
+	}
+	if name == "" {
+		name = t.Name()
+	}
+	if def, ok := g.names[name]; ok {
+		return fmt.Errorf("%s and %s share the name %s", def.typ.PkgPath(), t.PkgPath(), name)
+	}
+
+	def := &definition{name: name, typ: t}
+	g.types[t] = name
+	g.names[def.name] = def
+	g.defs = append(g.defs, def)
+
+	fields, err := structFields(t)
+	if err != nil {
+		return err
+	}
+	def.fields = fields
+
+	for _, f := range fields {
+		if err := g.addReferenced(f.typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addReferenced adds the named structs reachable from a field type
+func (g *Generator) addReferenced(t reflect.Type) error {
+	switch {
+	case t == rawMessageType || t == timeType:
+		return nil
+	case t.Kind() == reflect.Pointer, t.Kind() == reflect.Slice, t.Kind() == reflect.Array, t.Kind() == reflect.Map:
+		return g.addReferenced(t.Elem())
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		return g.addStruct(t, "")
+	}
+	return nil
+}
+
+// structFields lists the fields encoding/json writes, flattening untagged embedded structs
+func structFields(t reflect.Type) ([]field, error) {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" || (!sf.IsExported() && !sf.Anonymous) {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && sf.Type.Kind() == reflect.Struct {
+			embedded, err := structFields(sf.Type)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, embedded...)
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type.Name() == "" && sf.Type != timeType {
+			return nil, fmt.Errorf("%s.%s: anonymous struct fields are not supported", t.Name(), sf.Name)
+		}
+		fields = append(fields, field{
+			name:     name,
+			typ:      sf.Type,
+			optional: strings.Contains(opts, "omitempty"),
+		})
+	}
+	return fields, nil
+}
+
+// JSONSchema renders the enums and structs as JSON Schema $defs
+func (g *Generator) JSONSchema() ([]byte, error) {
+	defs := make(map[string]any, len(g.enums)+len(g.defs))
+	for _, e := range g.enums {
+		values := make([]any, 0, len(e.Values))
+		for _, v := range e.Values {
+			value := map[string]any{"const": v.Value, "title": v.Name}
+			if v.Comment != "" {
+				value["description"] = v.Comment
+			}
+			values = append(values, value)
+		}
+		defs[e.Name] = map[string]any{"type": "integer", "oneOf": values}
+	}
+
+	for _, def := range g.defs {
+		properties := make(map[string]any, len(def.fields))
+		required := []string{}
+		for _, f := range def.fields {
+			properties[f.name] = g.jsonSchemaType(f.typ, f.optional)
+			if !f.optional {
+				required = append(required, f.name)
+			}
+		}
+		sort.Strings(required)
+		defs[def.name] = map[string]any{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	}
+
+	doc := map[string]any{
+		"$schema":  "https://json-schema.org/draft/2020-12/schema",
+		"$comment": header,
+		"$defs":    defs,
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// jsonSchemaType renders a field type as a JSON Schema; nil pointers of required fields encode as null
+func (g *Generator) jsonSchemaType(t reflect.Type, optional bool) map[string]any {
+	switch {
+	case t == rawMessageType:
+		return map[string]any{}
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if optional {
+			return g.jsonSchemaType(t.Elem(), false)
+		}
+		return map[string]any{"anyOf": []any{g.jsonSchemaType(t.Elem(), false), map[string]any{"type": "null"}}}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.jsonSchemaType(t.Elem(), false)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.jsonSchemaType(t.Elem(), false)}
+	case reflect.Struct:
+		return map[string]any{"$ref": "#/$defs/" + g.types[t]}
+	}
+	return map[string]any{}
+}
+
+// TypeScript renders the enums as constant objects and the structs as interfaces
+func (g *Generator) TypeScript() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s\n", header)
+
+	for _, e := range g.enums {
+		fmt.Fprintf(&b, "\nexport const %s = {\n", e.Name)
+		for _, v := range e.Values {
+			if v.Comment != "" {
+				fmt.Fprintf(&b, "  /** %s */\n", v.Comment)
+			}
+			fmt.Fprintf(&b, "  %s: %d,\n", v.Name, v.Value)
+		}
+		b.WriteString("} as const;\n")
+		fmt.Fprintf(&b, "\nexport type %[1]s = (typeof %[1]s)[keyof typeof %[1]s];\n", e.Name)
+	}
+
+	for _, def := range g.defs {
+		fmt.Fprintf(&b, "\nexport interface %s {\n", def.name)
+		for _, f := range def.fields {
+			optional := ""
+			if f.optional {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", tsName(f.name), optional, g.typeScriptType(f.typ, f.optional))
+		}
+		b.WriteString("}\n")
+	}
+	return b.Bytes()
+}
+
+// typeScriptType renders a field type; nil pointers of required fields encode as null
+func (g *Generator) typeScriptType(t reflect.Type, optional bool) string {
+	switch {
+	case t == rawMessageType:
+		return "unknown"
+	case t == timeType:
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		if optional {
+			return g.typeScriptType(t.Elem(), false)
+		}
+		return g.typeScriptType(t.Elem(), false) + " | null"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		elem := g.typeScriptType(t.Elem(), false)
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return "Record<string, " + g.typeScriptType(t.Elem(), false) + ">"
+	case reflect.Struct:
+		return g.types[t]
+	}
+	return "unknown"
+}
+
+// tsName quotes property names that are not valid identifiers
+func tsName(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (i > 0 && r >= '0' && r <= '9')) {
+			return fmt.Sprintf("%q", name)
+		}
+	}
+	return name
+}
@@ -0,0 +1,104 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testError struct {
+	Code    uint32         `json:"code"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+type testResult struct {
+	Channel string     `json:"channel"`
+	Error   *testError `json:"error,omitempty"`
+	Next    *testError `json:"next"`
+}
+
+type testBase struct {
+	Timestamp int64 `json:"timestamp"`
+}
+
+type testMessage struct {
+	testBase
+	Type     string          `json:"type"`
+	Data     json.RawMessage `json:"data"`
+	Results  []testResult    `json:"results"`
+	Rates    []float64       `json:"rates,omitempty"`
+	Internal string          `json:"-"`
+	hidden   string
+}
+
+// TestGenerator tests rendering structs, the structs they reference and enums
+func TestGenerator(t *testing.T) {
+	g := NewGenerator()
+	g.AddEnum(Enum{Name: "ErrorCode", Values: []EnumValue{{Name: "BadRequest", Value: 4000, Comment: "Invalid request format"}}})
+	require.NoError(t, g.AddAs("ProtocolError", testError{}))
+	require.NoError(t, g.Add(&testMessage{}))
+	assert.Error(t, g.Add("not a struct"))
+
+	assert.Equal(t, `// Code generated by go run ./cmd/genschema. DO NOT EDIT.
+
+export const ErrorCode = {
+  /** Invalid request format */
+  BadRequest: 4000,
+} as const;
+
+export type ErrorCode = (typeof ErrorCode)[keyof typeof ErrorCode];
+
+export interface ProtocolError {
+  code: number;
+  details?: Record<string, unknown>;
+}
+
+export interface testMessage {
+  timestamp: number;
+  type: string;
+  data: unknown;
+  results: testResult[];
+  rates?: number[];
+}
+
+export interface testResult {
+  channel: string;
+  error?: ProtocolError;
+  next: ProtocolError | null;
+}
+`, string(g.TypeScript()))
+
+	data, err := g.JSONSchema()
+	require.NoError(t, err)
+
+	var doc struct {
+		Defs map[string]struct {
+			Properties map[string]map[string]any `json:"properties"`
+			Required   []string                  `json:"required"`
+			OneOf      []map[string]any          `json:"oneOf"`
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Len(t, doc.Defs, 4)
+	assert.Equal(t, []string{"data", "results", "timestamp", "type"}, doc.Defs["testMessage"].Required)
+	assert.Equal(t, map[string]any{"type": "integer"}, doc.Defs["testMessage"].Properties["timestamp"])
+	assert.Equal(t, map[string]any{"$ref": "#/$defs/ProtocolError"}, doc.Defs["testResult"].Properties["error"])
+	assert.Contains(t, doc.Defs["testResult"].Properties["next"], "anyOf")
+	assert.Equal(t, float64(4000), doc.Defs["ErrorCode"].OneOf[0]["const"])
+}
+
+// TestParseConstants tests reading the protocol error codes from source
+func TestParseConstants(t *testing.T) {
+	codes, err := ParseConstants("../websocket/protocol", "Code")
+	require.NoError(t, err)
+
+	byName := make(map[string]EnumValue, len(codes))
+	for _, c := range codes {
+		byName[c.Name] = c
+	}
+	assert.Equal(t, EnumValue{Name: "BadRequest", Value: 4000, Comment: "Invalid request format"}, byName["BadRequest"])
+	assert.Equal(t, int64(4506), byName["EntitlementRevoked"].Value)
+	assert.Equal(t, "Rejects or disconnects a user whose futures entitlement was revoked (terminal)", byName["EntitlementRevoked"].Comment)
+}
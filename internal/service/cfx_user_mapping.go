@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -22,21 +21,26 @@ type HTTPCfxUserMappingClient struct {
 	baseURL    string
 	httpClient *http.Client
 	logger     *slog.Logger
-	cache      *cache.TTLCache[string]
+	cache      cache.Store
+	cacheTTL   time.Duration
 }
 
 // NewHTTPCfxUserMappingClient creates a new CFX user mapping client
 func NewHTTPCfxUserMappingClient(baseURL string, cacheTTL time.Duration, logger *slog.Logger) *HTTPCfxUserMappingClient {
 	return &HTTPCfxUserMappingClient{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
-		},
-		logger: logger,
-		cache:  cache.NewTTLCache[string](cacheTTL),
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+		logger:     logger,
+		cache:      cache.NewMemoryStore(),
+		cacheTTL:   cacheTTL,
 	}
 }
 
+// SetCache sets the store caching mappings, e.g. a Redis store shared by every replica
+func (c *HTTPCfxUserMappingClient) SetCache(store cache.Store) {
+	c.cache = store
+}
+
 // CfxMappingResponse represents the API response from coin-cfx-adapter
 type CfxMappingResponse struct {
 	ErrCode    string           `json:"err_code"`
@@ -48,55 +52,86 @@ type CfxMappingResponse struct {
 type CfxMappingResult struct {
 	AjaibID   int64  `json:"ajaib_id"`
 	CfxUserID string `json:"cfx_user_id"`
+
+	// Region is the region of the CFX cluster holding the user's account
+	Region string `json:"region,omitempty"`
 }
 
 // GetCfxUserID retrieves the CFX user ID for a given Ajaib user ID
 func (c *HTTPCfxUserMappingClient) GetCfxUserID(ctx context.Context, ajaibID int64) (string, error) {
-	cacheKey := strconv.FormatInt(ajaibID, 10)
-	if cached, ok := c.cache.Get(cacheKey); ok {
-		c.logger.Debug("cfx user mapping cache hit", "ajaib_id", ajaibID)
+	if cached, ok := c.cached(ctx, "cfx_user_id:", ajaibID); ok {
 		return cached, nil
 	}
 
-	url := fmt.Sprintf("%s/api/v1/internal/coin-cfx-adapter/user/%d/cfx", c.baseURL, ajaibID)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	result, err := c.fetch(ctx, ajaibID)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
+	return result.CfxUserID, nil
+}
 
-	resp, err := c.httpClient.Do(req)
+// GetCfxUserRegion retrieves the region of the CFX cluster serving a given Ajaib user ID, empty when
+// coin-cfx-adapter reports none
+func (c *HTTPCfxUserMappingClient) GetCfxUserRegion(ctx context.Context, ajaibID int64) (string, error) {
+	if cached, ok := c.cached(ctx, "cfx_region:", ajaibID); ok {
+		return cached, nil
+	}
+
+	result, err := c.fetch(ctx, ajaibID)
 	if err != nil {
-		c.logger.Error("failed to fetch CFX user mapping",
-			"ajaib_id", ajaibID,
-			"error", err)
-		return "", fmt.Errorf("HTTP request failed: %w", err)
+		return "", err
 	}
-	defer resp.Body.Close()
+	return result.Region, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// cached returns the mapping value cached under the prefixed key of a user
+func (c *HTTPCfxUserMappingClient) cached(ctx context.Context, prefix string, ajaibID int64) (string, bool) {
+	cached, ok, err := c.cache.Get(ctx, prefix+strconv.FormatInt(ajaibID, 10))
+	if err != nil {
+		c.logger.Warn("failed to read cfx user mapping cache", "ajaib_id", ajaibID, "error", err)
+	}
+	if ok {
+		c.logger.Debug("cfx user mapping cache hit", "ajaib_id", ajaibID, "key", prefix)
 	}
+	return string(cached), ok
+}
 
-	var response CfxMappingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+// fetch retrieves a user's mapping from coin-cfx-adapter, caching its CFX user ID and region
+func (c *HTTPCfxUserMappingClient) fetch(ctx context.Context, ajaibID int64) (CfxMappingResult, error) {
+	response, err := callJSON[CfxMappingResponse](ctx, c.httpClient, upstreamCall{
+		Method:  http.MethodGet,
+		URL:     fmt.Sprintf("%s/api/v1/internal/coin-cfx-adapter/user/%d/cfx", c.baseURL, ajaibID),
+		Timeout: 5 * time.Second,
+		Retry:   internalAPIRetry,
+	})
+	if err != nil {
+		c.logger.Error("failed to fetch CFX user mapping",
+			"ajaib_id", ajaibID,
+			"error", err)
+		return CfxMappingResult{}, err
 	}
 
 	if response.ErrCode != "EC0000000" {
-		return "", fmt.Errorf("API error: %s - %s", response.ErrCode, response.ErrMessage)
+		return CfxMappingResult{}, fmt.Errorf("API error: %s - %s", response.ErrCode, response.ErrMessage)
 	}
 
 	if response.Result.CfxUserID == "" {
-		return "", fmt.Errorf("CFX user ID not found for ajaib_id: %d", ajaibID)
+		return CfxMappingResult{}, fmt.Errorf("CFX user ID not found for ajaib_id: %d", ajaibID)
 	}
 
-	cfxUserID := response.Result.CfxUserID
-	c.cache.Set(cacheKey, cfxUserID)
+	result := response.Result
+	id := strconv.FormatInt(ajaibID, 10)
+	if err := c.cache.Set(ctx, "cfx_user_id:"+id, []byte(result.CfxUserID), c.cacheTTL); err != nil {
+		c.logger.Warn("failed to cache cfx user mapping", "ajaib_id", ajaibID, "error", err)
+	}
+	if err := c.cache.Set(ctx, "cfx_region:"+id, []byte(result.Region), c.cacheTTL); err != nil {
+		c.logger.Warn("failed to cache cfx user region", "ajaib_id", ajaibID, "error", err)
+	}
 
 	c.logger.Debug("mapped ajaib_id to cfx_user_id",
 		"ajaib_id", ajaibID,
-		"cfx_user_id", cfxUserID)
+		"cfx_user_id", result.CfxUserID,
+		"region", result.Region)
 
-	return cfxUserID, nil
+	return result, nil
 }
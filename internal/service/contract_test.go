@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Contract tests replay the upstream responses recorded in testdata/contracts against the HTTP clients.
+// Setting CONTRACT_COIN_DATA_URL or CONTRACT_COIN_CFX_ADAPTER_URL (with CONTRACT_AJAIB_ID) also checks
+// the live service still answers in the recorded shape.
+
+// contract is the recorded interactions with one upstream service
+type contract struct {
+	Provider     string        `json:"provider"`
+	Interactions []interaction `json:"interactions"`
+}
+
+// interaction is a recorded request and the response it received
+type interaction struct {
+	Name    string `json:"name"`
+	Request struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+	} `json:"request"`
+	Response struct {
+		Status int             `json:"status"`
+		Body   json.RawMessage `json:"body"`
+	} `json:"response"`
+
+	// Required maps dotted JSON paths the client reads to their JSON type
+	Required map[string]string `json:"required"`
+}
+
+// loadContract reads the recorded interactions of a provider
+func loadContract(t *testing.T, provider string) contract {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "contracts", provider+".json"))
+	require.NoError(t, err)
+
+	var c contract
+	require.NoError(t, json.Unmarshal(data, &c))
+	require.Equal(t, provider, c.Provider)
+	return c
+}
+
+// interaction returns the recorded interaction with the given name
+func (c contract) interaction(t *testing.T, name string) interaction {
+	t.Helper()
+
+	for _, i := range c.Interactions {
+		if i.Name == name {
+			return i
+		}
+	}
+	require.Failf(t, "missing interaction", "%s has no interaction %q", c.Provider, name)
+	return interaction{}
+}
+
+// replay serves the recorded response, failing the test when the client sends a different request
+func (i interaction) replay(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		assert.Equal(t, i.Request.Method, r.Method)
+		assert.Equal(t, i.Request.Path, r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(i.Response.Status)
+		_, _ = w.Write(i.Response.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// assertShape checks that every required path of body holds a value of the recorded JSON type
+func assertShape(t *testing.T, body []byte, required map[string]string) {
+	t.Helper()
+
+	var doc any
+	require.NoError(t, json.Unmarshal(body, &doc))
+
+	for path, want := range required {
+		value := doc
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := value.(map[string]any)
+			if !assert.Truef(t, ok, "%s: parent of %q is not an object", path, key) {
+				value = nil
+				break
+			}
+			value = obj[key]
+		}
+
+		var got string
+		switch value.(type) {
+		case string:
+			got = "string"
+		case float64:
+			got = "number"
+		case bool:
+			got = "boolean"
+		case map[string]any:
+			got = "object"
+		case []any:
+			got = "array"
+		default:
+			got = "null"
+		}
+		assert.Equalf(t, want, got, "type of %s", path)
+	}
+}
+
+// liveResponse fetches a live upstream response for the recorded request, or skips without a live URL
+func liveResponse(t *testing.T, baseEnv string, i interaction) (string, []byte) {
+	t.Helper()
+
+	baseURL := os.Getenv(baseEnv)
+	if baseURL == "" {
+		t.Skipf("set %s to check the live service", baseEnv)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, i.Request.Method, baseURL+i.Request.Path, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, i.Response.Status, resp.StatusCode, "live response: %s", body)
+	return baseURL, body
+}
+
+// TestCoinDataContract tests the rate provider's request and its handling of the recorded coin-data responses
+func TestCoinDataContract(t *testing.T) {
+	c := loadContract(t, "coin-data")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		interaction string
+		rate        float64
+		err         string
+		calls       int32
+	}{
+		{interaction: "rate", rate: 16250.5, calls: 1},
+		{interaction: "rate_epoch_updated_at", rate: 16248, calls: 1},
+		{interaction: "rate_zero", err: "invalid rate received", calls: 1},
+		{interaction: "not_found", err: "unexpected status code: 404", calls: 1},
+		{interaction: "unavailable", err: "unexpected status code: 503", calls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interaction, func(t *testing.T) {
+			i := c.interaction(t, tt.interaction)
+			assertShape(t, i.Response.Body, i.Required)
+
+			srv, calls := i.replay(t)
+			rate, err := NewHTTPRateProvider(srv.URL, logger).GetUSDTToIDRRate(context.Background())
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.rate, rate)
+			}
+			assert.Equal(t, tt.calls, calls.Load(), "only 429 and 5xx responses are retried")
+		})
+	}
+
+	t.Run("live", func(t *testing.T) {
+		i := c.interaction(t, "rate")
+		baseURL, body := liveResponse(t, "CONTRACT_COIN_DATA_URL", i)
+		assertShape(t, body, i.Required)
+
+		rate, err := NewHTTPRateProvider(baseURL, logger).GetUSDTToIDRRate(context.Background())
+		require.NoError(t, err)
+		assert.Positive(t, rate)
+	})
+}
+
+// TestCfxAdapterContract tests the user mapping client's request and its handling of the recorded
+// coin-cfx-adapter responses
+func TestCfxAdapterContract(t *testing.T) {
+	c := loadContract(t, "coin-cfx-adapter")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	tests := []struct {
+		interaction string
+		cfxUserID   string
+		region      string
+		err         string
+		calls       int32
+	}{
+		{interaction: "mapping", cfxUserID: "cfx-8f2d41", calls: 1},
+		{interaction: "regional_mapping", cfxUserID: "cfx-8f2d41", region: "ap-southeast-1", calls: 1},
+		{interaction: "not_registered", err: "API error: EC0400001 - user is not registered for futures", calls: 1},
+		{interaction: "empty_mapping", err: "CFX user ID not found for ajaib_id: 130010505", calls: 1},
+		{interaction: "bad_request", err: "unexpected status code: 400", calls: 1},
+		{interaction: "internal_error", err: "unexpected status code: 500", calls: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.interaction, func(t *testing.T) {
+			i := c.interaction(t, tt.interaction)
+			assertShape(t, i.Response.Body, i.Required)
+
+			srv, calls := i.replay(t)
+			client := NewHTTPCfxUserMappingClient(srv.URL, time.Minute, logger)
+			cfxUserID, err := client.GetCfxUserID(context.Background(), 130010505)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.cfxUserID, cfxUserID)
+
+				// The region is cached with the mapping
+				region, err := client.GetCfxUserRegion(context.Background(), 130010505)
+				require.NoError(t, err)
+				assert.Equal(t, tt.region, region)
+			}
+			assert.Equal(t, tt.calls, calls.Load(), "only 429 and 5xx responses are retried")
+		})
+	}
+
+	t.Run("live", func(t *testing.T) {
+		ajaibID, err := strconv.ParseInt(os.Getenv("CONTRACT_AJAIB_ID"), 10, 64)
+		if err != nil {
+			t.Skip("set CONTRACT_AJAIB_ID to a user mapped to CFX to check the live service")
+		}
+
+		i := c.interaction(t, "mapping")
+		i.Request.Path = strings.Replace(i.Request.Path, "130010505", strconv.FormatInt(ajaibID, 10), 1)
+		baseURL, body := liveResponse(t, "CONTRACT_COIN_CFX_ADAPTER_URL", i)
+		assertShape(t, body, i.Required)
+
+		cfxUserID, err := NewHTTPCfxUserMappingClient(baseURL, time.Minute, logger).GetCfxUserID(context.Background(), ajaibID)
+		require.NoError(t, err)
+		assert.NotEmpty(t, cfxUserID)
+	})
+}
@@ -0,0 +1,71 @@
+package service
+
+import "strings"
+
+// FieldClass groups payload fields by how they relate to the quote currency
+type FieldClass string
+
+const (
+	// FieldClassValue is a quote-currency amount (position value, margin, PnL)
+	FieldClassValue FieldClass = "value"
+
+	// FieldClassPrice is a quote-currency price per contract (entry, mark, liquidation)
+	FieldClassPrice FieldClass = "price"
+
+	// FieldClassQuantity is a contract quantity; it is never converted
+	FieldClassQuantity FieldClass = "quantity"
+)
+
+// ConversionRules decides which field classes are converted to IDR, with per-symbol overrides
+type ConversionRules struct {
+	// Default applies to every symbol without an override
+	Default map[FieldClass]bool
+
+	// Symbols overrides Default per position symbol (case-insensitive)
+	Symbols map[string]map[FieldClass]bool
+}
+
+// DefaultConversionRules converts value fields only, leaving prices in USDT
+func DefaultConversionRules() ConversionRules {
+	return ConversionRules{
+		Default: map[FieldClass]bool{FieldClassValue: true},
+	}
+}
+
+// NewConversionRules builds rules from config maps keyed by field class name
+func NewConversionRules(defaults map[string]bool, symbols map[string]map[string]bool) ConversionRules {
+	rules := ConversionRules{
+		Default: make(map[FieldClass]bool, len(defaults)),
+		Symbols: make(map[string]map[FieldClass]bool, len(symbols)),
+	}
+	for class, convert := range defaults {
+		rules.Default[FieldClass(strings.ToLower(class))] = convert
+	}
+	for symbol, classes := range symbols {
+		override := make(map[FieldClass]bool, len(classes))
+		for class, convert := range classes {
+			override[FieldClass(strings.ToLower(class))] = convert
+		}
+		rules.Symbols[strings.ToUpper(symbol)] = override
+	}
+	return rules
+}
+
+// Converts reports whether fields of the class are converted for the symbol
+func (r ConversionRules) Converts(symbol string, class FieldClass) bool {
+	if class == FieldClassQuantity {
+		return false
+	}
+	if override, ok := r.Symbols[strings.ToUpper(symbol)]; ok {
+		if convert, ok := override[class]; ok {
+			return convert
+		}
+	}
+	return r.Default[class]
+}
+
+// HasOverride reports whether the symbol has its own conversion rules
+func (r ConversionRules) HasOverride(symbol string) bool {
+	_, ok := r.Symbols[strings.ToUpper(symbol)]
+	return ok
+}
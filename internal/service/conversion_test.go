@@ -0,0 +1,27 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestConversionRules tests default rules and case-insensitive symbol overrides
+func TestConversionRules(t *testing.T) {
+	defaults := DefaultConversionRules()
+	assert.True(t, defaults.Converts("BTCUSDT", FieldClassValue))
+	assert.False(t, defaults.Converts("BTCUSDT", FieldClassPrice))
+
+	// Viper lowercases map keys, so overrides arrive lowercased
+	rules := NewConversionRules(
+		map[string]bool{"value": true, "price": false},
+		map[string]map[string]bool{"btcusdt": {"price": true}, "ethusdt": {"value": false}},
+	)
+
+	assert.True(t, rules.Converts("BTCUSDT", FieldClassPrice))
+	assert.True(t, rules.Converts("BTCUSDT", FieldClassValue), "classes missing from an override fall back to the default")
+	assert.False(t, rules.Converts("ETHUSDT", FieldClassValue))
+	assert.False(t, rules.Converts("SOLUSDT", FieldClassPrice))
+	assert.False(t, rules.Converts("BTCUSDT", FieldClassQuantity))
+	assert.True(t, rules.Converts("", FieldClassValue))
+}
@@ -13,10 +13,18 @@ type CurrencyService interface {
 	GetCurrentRate(ctx context.Context) (float64, error)
 }
 
+// rateWaitRetryInterval is how often WaitForRate retries fetching a rate while none is cached
+const rateWaitRetryInterval = time.Second
+
+// RefreshListener is called with the exchange rate after every successful refresh
+type RefreshListener func(rate float64, updatedAt time.Time)
+
 // CachedCurrencyService implements CurrencyService with a background scheduler that periodically refreshes the exchange rate
 type CachedCurrencyService struct {
 	rateProvider RateProvider
 	rate         float64
+	updatedAt    time.Time
+	listeners    []RefreshListener
 	mu           sync.RWMutex
 	logger       *slog.Logger
 	stop         chan struct{}
@@ -63,15 +71,63 @@ func (s *CachedCurrencyService) refresh() {
 		return
 	}
 
+	now := time.Now()
+
 	s.mu.Lock()
 	s.rate = rate
+	s.updatedAt = now
+	listeners := s.listeners
 	s.mu.Unlock()
 
 	s.logger.Info("refreshed exchange rate", "rate", rate)
+
+	for _, listener := range listeners {
+		listener(rate, now)
+	}
+}
+
+// AddRefreshListener registers a listener for rate refreshes and calls it with the current rate, if any
+func (s *CachedCurrencyService) AddRefreshListener(listener RefreshListener) {
+	s.mu.Lock()
+	s.listeners = append(s.listeners, listener)
+	rate, updatedAt := s.rate, s.updatedAt
+	s.mu.Unlock()
+
+	if rate > 0 {
+		listener(rate, updatedAt)
+	}
+}
+
+// WaitForRate blocks until an exchange rate is cached, refreshing every rateWaitRetryInterval instead of
+// waiting for the next scheduled refresh. It returns false when ctx is done first.
+func (s *CachedCurrencyService) WaitForRate(ctx context.Context) bool {
+	ticker := time.NewTicker(rateWaitRetryInterval)
+	defer ticker.Stop()
+
+	for !s.hasRate() {
+		select {
+		case <-ctx.Done():
+			return s.hasRate()
+		case <-ticker.C:
+			s.refresh()
+		}
+	}
+	return true
+}
+
+// hasRate reports whether an exchange rate is cached
+func (s *CachedCurrencyService) hasRate() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rate > 0
 }
 
 // GetCurrentRate returns the latest cached exchange rate
 func (s *CachedCurrencyService) GetCurrentRate(ctx context.Context) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
 	s.mu.RLock()
 	rate := s.rate
 	s.mu.RUnlock()
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWaitForRate tests that waiting for a rate retries the provider until it serves one or ctx is done
+func TestWaitForRate(t *testing.T) {
+	provider := &stubRateProvider{err: errors.New("unavailable")}
+	currency := NewCachedCurrencyService(provider, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	defer currency.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.False(t, currency.WaitForRate(ctx))
+
+	provider.rate, provider.err = 16000, nil
+	ctx, cancel = context.WithTimeout(context.Background(), 3*rateWaitRetryInterval)
+	defer cancel()
+	assert.True(t, currency.WaitForRate(ctx))
+
+	rate, err := currency.GetCurrentRate(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 16000.0, rate)
+
+	// A cached rate returns at once
+	assert.True(t, currency.WaitForRate(context.Background()))
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// entitlementRefreshTimeout bounds a background refresh of a user's entitlement
+const entitlementRefreshTimeout = 10 * time.Second
+
+// EntitlementResponse represents the entitlement API response from coin-cfx-adapter
+type EntitlementResponse struct {
+	ErrCode    string            `json:"err_code"`
+	ErrMessage string            `json:"err_message"`
+	Result     EntitlementResult `json:"result"`
+}
+
+// EntitlementResult contains the entitlement data
+type EntitlementResult struct {
+	AjaibID  int64 `json:"ajaib_id"`
+	Entitled bool  `json:"entitled"`
+}
+
+// entitlement is a cached answer; revoked entries were forced by an operator and are never refreshed
+type entitlement struct {
+	entitled  bool
+	checkedAt time.Time
+	revoked   bool
+}
+
+// HTTPEntitlementClient checks whether users still have futures entitlement via coin-cfx-adapter
+type HTTPEntitlementClient struct {
+	baseURL    string
+	httpClient *http.Client
+	logger     *slog.Logger
+	ttl        time.Duration
+
+	mu         sync.Mutex
+	entries    map[string]entitlement
+	refreshing map[string]struct{}
+}
+
+// NewHTTPEntitlementClient creates a new entitlement client caching answers for cacheTTL
+func NewHTTPEntitlementClient(baseURL string, cacheTTL time.Duration, logger *slog.Logger) *HTTPEntitlementClient {
+	return &HTTPEntitlementClient{
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+		logger:     logger,
+		ttl:        cacheTTL,
+		entries:    make(map[string]entitlement),
+		refreshing: make(map[string]struct{}),
+	}
+}
+
+// CheckEntitlement returns the user's entitlement, fetching it when the cached answer is missing or stale
+func (c *HTTPEntitlementClient) CheckEntitlement(ctx context.Context, ajaibID string) (bool, error) {
+	c.mu.Lock()
+	e, ok := c.entries[ajaibID]
+	c.mu.Unlock()
+	if ok && (e.revoked || time.Since(e.checkedAt) < c.ttl) {
+		return e.entitled, nil
+	}
+
+	entitled, err := c.fetch(ctx, ajaibID)
+	if err != nil {
+		return false, err
+	}
+	c.store(ajaibID, entitled)
+	return entitled, nil
+}
+
+// Entitled returns the cached entitlement without blocking, for the message delivery path. Stale answers
+// are refreshed in the background; users not checked yet are entitled until the first answer arrives.
+func (c *HTTPEntitlementClient) Entitled(ajaibID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[ajaibID]
+	if ok && (e.revoked || time.Since(e.checkedAt) < c.ttl) {
+		return e.entitled
+	}
+
+	if _, running := c.refreshing[ajaibID]; !running {
+		c.refreshing[ajaibID] = struct{}{}
+		go c.refresh(ajaibID)
+	}
+	return !ok || e.entitled
+}
+
+// Revoke marks the user as not entitled until Restore, regardless of coin-cfx-adapter
+func (c *HTTPEntitlementClient) Revoke(ajaibID string) {
+	c.mu.Lock()
+	c.entries[ajaibID] = entitlement{entitled: false, checkedAt: time.Now(), revoked: true}
+	c.mu.Unlock()
+
+	c.logger.Warn("entitlement force-revoked", "ajaib_id", ajaibID)
+}
+
+// Restore drops a forced revocation; the next check asks coin-cfx-adapter again
+func (c *HTTPEntitlementClient) Restore(ajaibID string) {
+	c.mu.Lock()
+	delete(c.entries, ajaibID)
+	c.mu.Unlock()
+
+	c.logger.Info("entitlement revocation lifted", "ajaib_id", ajaibID)
+}
+
+// Revoked returns the force-revoked users, sorted
+func (c *HTTPEntitlementClient) Revoked() []string {
+	c.mu.Lock()
+	revoked := make([]string, 0)
+	for ajaibID, e := range c.entries {
+		if e.revoked {
+			revoked = append(revoked, ajaibID)
+		}
+	}
+	c.mu.Unlock()
+
+	sort.Strings(revoked)
+	return revoked
+}
+
+// refresh fetches the user's entitlement in the background; failures keep the previous answer
+func (c *HTTPEntitlementClient) refresh(ajaibID string) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.refreshing, ajaibID)
+		c.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), entitlementRefreshTimeout)
+	defer cancel()
+
+	entitled, err := c.fetch(ctx, ajaibID)
+	if err != nil {
+		return
+	}
+	c.store(ajaibID, entitled)
+}
+
+// store caches a fetched answer unless the user was force-revoked meanwhile
+func (c *HTTPEntitlementClient) store(ajaibID string, entitled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if previous, ok := c.entries[ajaibID]; ok {
+		if previous.revoked {
+			return
+		}
+		if previous.entitled && !entitled {
+			c.logger.Warn("futures entitlement revoked", "ajaib_id", ajaibID)
+		}
+	}
+	c.entries[ajaibID] = entitlement{entitled: entitled, checkedAt: time.Now()}
+}
+
+// fetch asks coin-cfx-adapter whether the user has futures entitlement
+func (c *HTTPEntitlementClient) fetch(ctx context.Context, ajaibID string) (bool, error) {
+	response, err := callJSON[EntitlementResponse](ctx, c.httpClient, upstreamCall{
+		Method:  http.MethodGet,
+		URL:     fmt.Sprintf("%s/api/v1/internal/coin-cfx-adapter/user/%s/futures-entitlement", c.baseURL, ajaibID),
+		Timeout: 5 * time.Second,
+		Retry:   internalAPIRetry,
+	})
+	if err != nil {
+		c.logger.Error("failed to fetch futures entitlement",
+			"ajaib_id", ajaibID,
+			"error", err)
+		return false, err
+	}
+
+	if response.ErrCode != "EC0000000" {
+		c.logger.Error("failed to fetch futures entitlement",
+			"ajaib_id", ajaibID,
+			"err_code", response.ErrCode,
+			"err_message", response.ErrMessage)
+		return false, fmt.Errorf("API error: %s - %s", response.ErrCode, response.ErrMessage)
+	}
+
+	return response.Result.Entitled, nil
+}
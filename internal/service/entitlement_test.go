@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHTTPEntitlementClient tests caching entitlement answers, background refreshes and forced revocations
+func TestHTTPEntitlementClient(t *testing.T) {
+	var entitled atomic.Bool
+	entitled.Store(true)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		assert.Equal(t, "/api/v1/internal/coin-cfx-adapter/user/12345/futures-entitlement", r.URL.Path)
+		_ = json.NewEncoder(w).Encode(EntitlementResponse{
+			ErrCode: "EC0000000",
+			Result:  EntitlementResult{AjaibID: 12345, Entitled: entitled.Load()},
+		})
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	client := NewHTTPEntitlementClient(srv.URL, 50*time.Millisecond, logger)
+
+	ok, err := client.CheckEntitlement(context.Background(), "12345")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Cached
+	assert.True(t, client.Entitled("12345"))
+	assert.EqualValues(t, 1, calls.Load())
+
+	// Revoked upstream: the stale answer is served while the refresh runs
+	entitled.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, client.Entitled("12345"))
+	assert.Eventually(t, func() bool { return !client.Entitled("12345") }, time.Second, 5*time.Millisecond)
+
+	entitled.Store(true)
+	client.Revoke("12345")
+	time.Sleep(60 * time.Millisecond)
+	ok, err = client.CheckEntitlement(context.Background(), "12345")
+	require.NoError(t, err)
+	assert.False(t, ok, "forced revocations are not refreshed")
+	assert.Equal(t, []string{"12345"}, client.Revoked())
+
+	client.Restore("12345")
+	assert.Empty(t, client.Revoked())
+	ok, err = client.CheckEntitlement(context.Background(), "12345")
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// TestHTTPEntitlementClientUnknownUser tests that users not checked yet are entitled until the first answer
+func TestHTTPEntitlementClientUnknownUser(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(EntitlementResponse{ErrCode: "EC0000000", Result: EntitlementResult{Entitled: false}})
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	client := NewHTTPEntitlementClient(srv.URL, time.Minute, logger)
+
+	assert.True(t, client.Entitled("12345"))
+	assert.Eventually(t, func() bool { return !client.Entitled("12345") }, time.Second, 5*time.Millisecond)
+}
+
+// TestHTTPEntitlementClientError tests that API errors are reported to connect-time checks
+func TestHTTPEntitlementClientError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(EntitlementResponse{ErrCode: "EC0000404", ErrMessage: "user not found"})
+	}))
+	defer srv.Close()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	client := NewHTTPEntitlementClient(srv.URL, time.Minute, logger)
+
+	_, err := client.CheckEntitlement(context.Background(), "12345")
+	assert.ErrorContains(t, err, "EC0000404")
+}
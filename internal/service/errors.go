@@ -0,0 +1,16 @@
+package service
+
+import "errors"
+
+// Categories of failed transformations, so callers can retry, dead-letter or skip the message
+var (
+	// ErrRateUnavailable fails a conversion without any exchange rate to apply; retrying later may succeed
+	ErrRateUnavailable = errors.New("exchange rate unavailable")
+
+	// ErrInvalidPayload fails a payload that cannot be converted, e.g. one with non-finite values; retrying
+	// cannot fix it
+	ErrInvalidPayload = errors.New("invalid payload")
+
+	// ErrUnsupportedAsset fails a payload whose asset or symbol has no conversion rules under the reject policy
+	ErrUnsupportedAsset = errors.New("unsupported asset")
+)
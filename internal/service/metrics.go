@@ -0,0 +1,119 @@
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RateMetrics holds Prometheus metrics for the exchange rate sources
+type RateMetrics struct {
+	fetchesTotal *prometheus.CounterVec
+	activeSource *prometheus.GaugeVec
+	fallback     prometheus.Gauge
+}
+
+// NewRateMetrics creates a new RateMetrics instance with Prometheus collectors
+func NewRateMetrics() *RateMetrics {
+	return &RateMetrics{
+		fetchesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "exchange_rate_fetches_total",
+				Help: "Total number of exchange rate fetches by source and result",
+			},
+			[]string{"source", "result"},
+		),
+		activeSource: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "exchange_rate_source_active",
+				Help: "Whether the source served the latest exchange rate (1) or not (0)",
+			},
+			[]string{"source"},
+		),
+		fallback: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "exchange_rate_fallback",
+				Help: "Whether the latest exchange rate was served by a fallback source",
+			},
+		),
+	}
+}
+
+// Register registers all metrics with the default Prometheus registry
+func (m *RateMetrics) Register() error {
+	registry := prometheus.DefaultRegisterer
+
+	registry.MustRegister(
+		m.fetchesTotal,
+		m.activeSource,
+		m.fallback,
+	)
+
+	return nil
+}
+
+// RecordFetch records the result of fetching the rate from a source
+func (m *RateMetrics) RecordFetch(source string, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.fetchesTotal.WithLabelValues(source, result).Inc()
+}
+
+// SetActiveSource marks whether the source served the latest rate
+func (m *RateMetrics) SetActiveSource(source string, active bool) {
+	m.activeSource.WithLabelValues(source).Set(boolGauge(active))
+}
+
+// SetFallback marks whether the latest rate came from a fallback source
+func (m *RateMetrics) SetFallback(fallback bool) {
+	m.fallback.Set(boolGauge(fallback))
+}
+
+// boolGauge converts a boolean to a gauge value
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// TransformerMetrics holds Prometheus metrics for the transformer
+type TransformerMetrics struct {
+	unknownTotal   *prometheus.CounterVec
+	staleRateTotal prometheus.Counter
+}
+
+// NewTransformerMetrics creates a new TransformerMetrics instance with Prometheus collectors
+func NewTransformerMetrics() *TransformerMetrics {
+	return &TransformerMetrics{
+		unknownTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "transformer_unknown_instruments_total",
+				Help: "Total number of payloads whose asset or symbol has no conversion rules, by kind, instrument and policy",
+			},
+			[]string{"kind", "instrument", "policy"},
+		),
+		staleRateTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "transformer_stale_rate_total",
+				Help: "Total number of payloads converted at the last applied rate because the rate lookup failed or timed out",
+			},
+		),
+	}
+}
+
+// Register registers all metrics with the default Prometheus registry
+func (m *TransformerMetrics) Register() error {
+	prometheus.DefaultRegisterer.MustRegister(m.unknownTotal, m.staleRateTotal)
+	return nil
+}
+
+// RecordUnknown records a payload of an instrument without conversion rules
+func (m *TransformerMetrics) RecordUnknown(kind, instrument string, policy UnknownPolicy) {
+	m.unknownTotal.WithLabelValues(kind, instrument, string(policy)).Inc()
+}
+
+// RecordStaleRate records a payload converted at the last applied rate
+func (m *TransformerMetrics) RecordStaleRate() {
+	m.staleRateTotal.Inc()
+}
@@ -37,37 +37,23 @@ type HTTPRateProvider struct {
 // NewHTTPRateProvider creates a new HTTPRateProvider
 func NewHTTPRateProvider(baseURL string, logger *slog.Logger) *HTTPRateProvider {
 	return &HTTPRateProvider{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		logger: logger,
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+		logger:     logger,
 	}
 }
 
 // GetUSDTToIDRRate fetches the current USDT to IDR exchange rate from the configured API
 func (p *HTTPRateProvider) GetUSDTToIDRRate(ctx context.Context) (float64, error) {
-	url := fmt.Sprintf("%s/api/v1/coin-data/futures-exchange-rate/USDT/IDR", p.baseURL)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	resp, err := p.httpClient.Do(req)
+	baseResp, err := callJSON[baseResponse](ctx, p.httpClient, upstreamCall{
+		Method:  http.MethodGet,
+		URL:     fmt.Sprintf("%s/api/v1/coin-data/futures-exchange-rate/USDT/IDR", p.baseURL),
+		Timeout: 10 * time.Second,
+		Retry:   internalAPIRetry,
+	})
 	if err != nil {
 		return 0, fmt.Errorf("failed to fetch rate: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	var baseResp baseResponse
-	if err := json.NewDecoder(resp.Body).Decode(&baseResp); err != nil {
-		return 0, fmt.Errorf("failed to decode response: %w", err)
-	}
 
 	rate := baseResp.Result.Amount
 	if rate <= 0 {
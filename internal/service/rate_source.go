@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// RateSource is a named rate provider in a failover chain
+type RateSource struct {
+	Name     string
+	Provider RateProvider
+}
+
+// StaticRateProvider always returns a fixed rate; used as the emergency source of last resort
+type StaticRateProvider struct {
+	rate float64
+}
+
+// NewStaticRateProvider creates a rate provider returning the given rate
+func NewStaticRateProvider(rate float64) *StaticRateProvider {
+	return &StaticRateProvider{rate: rate}
+}
+
+// GetUSDTToIDRRate returns the configured rate
+func (p *StaticRateProvider) GetUSDTToIDRRate(ctx context.Context) (float64, error) {
+	if p.rate <= 0 {
+		return 0, fmt.Errorf("invalid static rate: %f", p.rate)
+	}
+	return p.rate, nil
+}
+
+// FailoverRateProvider tries its sources in order and returns the first rate served.
+// Any source other than the first is a fallback and is reported in logs and metrics.
+type FailoverRateProvider struct {
+	sources []RateSource
+	metrics *RateMetrics
+	active  string
+	mu      sync.Mutex
+	logger  *slog.Logger
+}
+
+// NewFailoverRateProvider creates a provider trying sources in the given order
+func NewFailoverRateProvider(sources []RateSource, logger *slog.Logger) *FailoverRateProvider {
+	return &FailoverRateProvider{
+		sources: sources,
+		logger:  logger,
+	}
+}
+
+// SetMetrics sets the metrics recording which source served the rate
+func (p *FailoverRateProvider) SetMetrics(metrics *RateMetrics) {
+	p.metrics = metrics
+	for _, source := range p.sources {
+		metrics.SetActiveSource(source.Name, false)
+	}
+}
+
+// GetUSDTToIDRRate returns the rate from the first source that serves one
+func (p *FailoverRateProvider) GetUSDTToIDRRate(ctx context.Context) (float64, error) {
+	var errs []error
+	for i, source := range p.sources {
+		rate, err := source.Provider.GetUSDTToIDRRate(ctx)
+		if p.metrics != nil {
+			p.metrics.RecordFetch(source.Name, err)
+		}
+		if err != nil {
+			p.logger.Warn("exchange rate source failed", "source", source.Name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", source.Name, err))
+			continue
+		}
+
+		p.setActive(source.Name, i > 0)
+		return rate, nil
+	}
+
+	return 0, fmt.Errorf("all exchange rate sources failed: %w", errors.Join(errs...))
+}
+
+// setActive records the serving source and logs transitions onto and off fallback sources
+func (p *FailoverRateProvider) setActive(name string, fallback bool) {
+	p.mu.Lock()
+	previous := p.active
+	p.active = name
+	p.mu.Unlock()
+
+	if p.metrics != nil {
+		if previous != "" && previous != name {
+			p.metrics.SetActiveSource(previous, false)
+		}
+		p.metrics.SetActiveSource(name, true)
+		p.metrics.SetFallback(fallback)
+	}
+
+	if previous == name {
+		return
+	}
+	if fallback {
+		p.logger.Error("exchange rate served by fallback source", "source", name, "previous_source", previous)
+	} else if previous != "" {
+		p.logger.Info("exchange rate recovered to primary source", "source", name, "previous_source", previous)
+	}
+}
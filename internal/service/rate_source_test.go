@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubRateProvider returns a fixed rate or error
+type stubRateProvider struct {
+	rate float64
+	err  error
+}
+
+func (p *stubRateProvider) GetUSDTToIDRRate(ctx context.Context) (float64, error) {
+	return p.rate, p.err
+}
+
+// TestFailoverRateProvider tests that sources are tried in order until one serves a rate
+func TestFailoverRateProvider(t *testing.T) {
+	primary := &stubRateProvider{rate: 16000}
+	secondary := &stubRateProvider{rate: 16100}
+	provider := NewFailoverRateProvider([]RateSource{
+		{Name: "coin_data", Provider: primary},
+		{Name: "secondary", Provider: secondary},
+		{Name: "emergency", Provider: NewStaticRateProvider(15000)},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	rate, err := provider.GetUSDTToIDRRate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 16000.0, rate)
+
+	primary.err = errors.New("unavailable")
+	rate, err = provider.GetUSDTToIDRRate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 16100.0, rate)
+
+	secondary.err = errors.New("unavailable")
+	rate, err = provider.GetUSDTToIDRRate(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 15000.0, rate)
+
+	provider = NewFailoverRateProvider([]RateSource{
+		{Name: "coin_data", Provider: primary},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	_, err = provider.GetUSDTToIDRRate(context.Background())
+	assert.ErrorContains(t, err, "coin_data: unavailable")
+}
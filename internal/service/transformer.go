@@ -5,21 +5,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
+	"sync/atomic"
 
 	"coin-futures-websocket/internal/types"
 )
 
-// TransformerInterface defines the interface for transforming Kafka message data
+// TransformerInterface defines the interface for transforming Kafka message data.
+// The payload is decoded once by the caller and passed with the raw data it was decoded from, which is
+// returned as-is when nothing is converted. Implementations must not modify the decoded payload.
+// A nil payload without error means the message is dropped. The context carries the message's deadline.
 type TransformerInterface interface {
-	TransformUserMargin(data []byte, cfxUserID string, quotePreference string) ([]byte, error)
-	TransformUserPosition(data []byte, cfxUserID string, quotePreference string) ([]byte, error)
+	TransformUserMargin(ctx context.Context, margin *types.UserMargin, data []byte, quotePreference string) ([]byte, error)
+	TransformUserPosition(ctx context.Context, position *types.UserPosition, data []byte, quotePreference string) ([]byte, error)
 }
 
 // Transformer provides data transformation capabilities for Kafka messages
 type Transformer struct {
 	currencyService CurrencyService
 	cfxUsdtAsset    string
+	rules           ConversionRules
+	embedRate       bool
+	embedOriginals  bool
+	unknownPolicy   UnknownPolicy
+	quarantine      QuarantinePublisher
+	metrics         *TransformerMetrics
 	logger          *slog.Logger
+
+	// lastRate holds the float64 bits of the last rate applied, the fallback when a lookup fails
+	lastRate atomic.Uint64
 }
 
 // NewTransformer creates a new Transformer
@@ -27,17 +41,79 @@ func NewTransformer(currencyService CurrencyService, cfxUsdtAsset string, logger
 	return &Transformer{
 		currencyService: currencyService,
 		cfxUsdtAsset:    cfxUsdtAsset,
+		rules:           DefaultConversionRules(),
+		unknownPolicy:   UnknownPass,
 		logger:          logger,
 	}
 }
 
-// TransformUserMargin transforms UserMargin data, converting USDT to IDR when needed
-func (t *Transformer) TransformUserMargin(data []byte, cfxUserID string, quotePreference string) ([]byte, error) {
-	var margin types.UserMargin
-	if err := json.Unmarshal(data, &margin); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal UserMargin: %w", err)
+// SetConversionRules sets which field classes are converted to IDR
+func (t *Transformer) SetConversionRules(rules ConversionRules) {
+	t.rules = rules
+}
+
+// SetEmbedding sets whether converted payloads carry the applied fx_rate and the original USDT values
+func (t *Transformer) SetEmbedding(fxRate, originalValues bool) {
+	t.embedRate = fxRate
+	t.embedOriginals = originalValues
+}
+
+// converter converts fields at one rate, keeping the original values when embedding them
+type converter struct {
+	rate      float64
+	originals map[string]float64
+}
+
+// newConverter creates a converter for the rate
+func (t *Transformer) newConverter(rate float64) *converter {
+	c := &converter{rate: rate}
+	if t.embedOriginals {
+		c.originals = make(map[string]float64)
+	}
+	return c
+}
+
+// convert multiplies the field by the rate, recording its original value under the JSON field name
+func (c *converter) convert(name string, field *float64) {
+	if c.originals != nil {
+		c.originals[name] = *field
+	}
+	*field = *field * c.rate
+}
+
+// fxRate returns the rate to embed in the payload, or zero when embedding is disabled
+func (t *Transformer) fxRate(rate float64) float64 {
+	if !t.embedRate {
+		return 0
+	}
+	return rate
+}
+
+// currentRate returns the exchange rate to apply. When the lookup fails or misses the message deadline,
+// the last rate applied is used instead so a slow rate source never stalls the consumer.
+func (t *Transformer) currentRate(ctx context.Context) (float64, error) {
+	rate, err := t.currencyService.GetCurrentRate(ctx)
+	if err == nil {
+		t.lastRate.Store(math.Float64bits(rate))
+		return rate, nil
 	}
 
+	stale := math.Float64frombits(t.lastRate.Load())
+	if stale == 0 {
+		return 0, fmt.Errorf("%w: %w", ErrRateUnavailable, err)
+	}
+
+	t.logger.Warn("exchange rate unavailable, using last applied rate", "rate", stale, "error", err)
+	if t.metrics != nil {
+		t.metrics.RecordStaleRate()
+	}
+	return stale, nil
+}
+
+// TransformUserMargin transforms UserMargin data, converting USDT to IDR when needed
+func (t *Transformer) TransformUserMargin(ctx context.Context, decoded *types.UserMargin, data []byte, quotePreference string) ([]byte, error) {
+	cfxUserID := decoded.CFXUserID
+
 	// Only transform when user's quote preference is IDR
 	if quotePreference != "IDR" {
 		t.logger.Debug("skipping margin transformation, quote preference is not IDR",
@@ -46,25 +122,36 @@ func (t *Transformer) TransformUserMargin(data []byte, cfxUserID string, quotePr
 		return data, nil
 	}
 
-	ctx := context.Background()
-	rate, err := t.currencyService.GetCurrentRate(ctx)
+	if !t.knownAsset(decoded.Asset) {
+		return t.handleUnknown(ctx, "margin", decoded.Asset, data, cfxUserID)
+	}
+
+	rate, err := t.currentRate(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get exchange rate: %w", err)
+		return nil, err
 	}
 
-	// Convert the currency fields (USDT -> IDR)
-	margin.TotalPositionValue = margin.TotalPositionValue * rate
-	margin.MarginBalance = margin.MarginBalance * rate
-	margin.OrderMargin = margin.OrderMargin * rate
-	margin.MaintenanceMargin = margin.MaintenanceMargin * rate
-	margin.UnrealizedPnl = margin.UnrealizedPnl * rate
-	margin.AvailableMargin = margin.AvailableMargin * rate
-	margin.WalletBalance = margin.WalletBalance * rate
-	margin.WithdrawableMargin = margin.WithdrawableMargin * rate
+	// Convert a copy, the caller still reads the decoded payload
+	margin := *decoded
+
+	// Convert the currency fields (USDT -> IDR); margin has no symbol, so only the default rules apply
+	c := t.newConverter(rate)
+	if t.rules.Converts("", FieldClassValue) {
+		c.convert("total_position_value", &margin.TotalPositionValue)
+		c.convert("margin_balance", &margin.MarginBalance)
+		c.convert("order_margin", &margin.OrderMargin)
+		c.convert("maintenance_margin", &margin.MaintenanceMargin)
+		c.convert("unrealized_pnl", &margin.UnrealizedPnl)
+		c.convert("available_margin", &margin.AvailableMargin)
+		c.convert("wallet_balance", &margin.WalletBalance)
+		c.convert("withdrawable_margin", &margin.WithdrawableMargin)
+	}
+	margin.FxRate = t.fxRate(rate)
+	margin.OriginalValues = c.originals
 
 	transformedData, err := json.Marshal(margin)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal transformed UserMargin: %w", err)
+		return nil, fmt.Errorf("%w: failed to marshal transformed UserMargin: %w", ErrInvalidPayload, err)
 	}
 
 	t.logger.Debug("transformed user margin to IDR",
@@ -76,11 +163,8 @@ func (t *Transformer) TransformUserMargin(data []byte, cfxUserID string, quotePr
 }
 
 // TransformUserPosition transforms UserPosition data, converting USDT to IDR when needed
-func (t *Transformer) TransformUserPosition(data []byte, cfxUserID string, quotePreference string) ([]byte, error) {
-	var position types.UserPosition
-	if err := json.Unmarshal(data, &position); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal UserPosition: %w", err)
-	}
+func (t *Transformer) TransformUserPosition(ctx context.Context, decoded *types.UserPosition, data []byte, quotePreference string) ([]byte, error) {
+	cfxUserID := decoded.CFXUserID
 
 	// Only transform when user's quote preference is IDR
 	if quotePreference != "IDR" {
@@ -90,22 +174,38 @@ func (t *Transformer) TransformUserPosition(data []byte, cfxUserID string, quote
 		return data, nil
 	}
 
-	ctx := context.Background()
-	rate, err := t.currencyService.GetCurrentRate(ctx)
+	if !t.knownSymbol(decoded.Symbol) {
+		return t.handleUnknown(ctx, "position", decoded.Symbol, data, cfxUserID)
+	}
+
+	rate, err := t.currentRate(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get exchange rate: %w", err)
+		return nil, err
 	}
 
-	// Convert the currency fields (USDT -> IDR)
-	position.Value = position.Value * rate
-	position.MaintenanceMargin = position.MaintenanceMargin * rate
-	position.RealisedPnl = position.RealisedPnl * rate
-	position.UnrealisedPnl = position.UnrealisedPnl * rate
-	position.OrderMargin = position.OrderMargin * rate
+	// Convert a copy, the caller still reads the decoded payload
+	position := *decoded
+
+	// Convert the currency fields (USDT -> IDR) by class; quantities (size, open order quantities) are never converted
+	c := t.newConverter(rate)
+	if t.rules.Converts(position.Symbol, FieldClassValue) {
+		c.convert("value", &position.Value)
+		c.convert("maintenance_margin", &position.MaintenanceMargin)
+		c.convert("realised_pnl", &position.RealisedPnl)
+		c.convert("unrealised_pnl", &position.UnrealisedPnl)
+		c.convert("order_margin", &position.OrderMargin)
+	}
+	if t.rules.Converts(position.Symbol, FieldClassPrice) {
+		c.convert("entry_price", &position.EntryPrice)
+		c.convert("mark_price", &position.MarkPrice)
+		c.convert("liquidation_price", &position.LiquidationPrice)
+	}
+	position.FxRate = t.fxRate(rate)
+	position.OriginalValues = c.originals
 
 	transformedData, err := json.Marshal(position)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal transformed UserPosition: %w", err)
+		return nil, fmt.Errorf("%w: failed to marshal transformed UserPosition: %w", ErrInvalidPayload, err)
 	}
 
 	t.logger.Debug("transformed user position to IDR",
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"coin-futures-websocket/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubCurrencyService returns a fixed rate
+type stubCurrencyService struct {
+	rate float64
+}
+
+func (s *stubCurrencyService) GetCurrentRate(ctx context.Context) (float64, error) {
+	return s.rate, nil
+}
+
+// decodeMargin decodes a margin payload as the broadcaster does before transforming it
+func decodeMargin(t *testing.T, data []byte) *types.UserMargin {
+	t.Helper()
+
+	var margin types.UserMargin
+	require.NoError(t, json.Unmarshal(data, &margin))
+	return &margin
+}
+
+// decodePosition decodes a position payload as the broadcaster does before transforming it
+func decodePosition(t *testing.T, data []byte) *types.UserPosition {
+	t.Helper()
+
+	var position types.UserPosition
+	require.NoError(t, json.Unmarshal(data, &position))
+	return &position
+}
+
+// TestTransformKeepsDecodedPayload tests that converting does not modify the payload shared with the broadcaster
+func TestTransformKeepsDecodedPayload(t *testing.T) {
+	transformer := NewTransformer(&stubCurrencyService{rate: 16000}, "USDT", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	transformer.SetEmbedding(true, true)
+
+	data := []byte(`{"cfx_user_id":"cfx_1","symbol":"BTCUSDT","value":100}`)
+	position := decodePosition(t, data)
+	out, err := transformer.TransformUserPosition(context.Background(), position, data, "IDR")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"value":1600000`)
+	assert.Equal(t, 100.0, position.Value)
+	assert.Nil(t, position.OriginalValues)
+
+	data = []byte(`{"cfx_user_id":"cfx_1","asset":"USDT","margin_balance":2}`)
+	margin := decodeMargin(t, data)
+	out, err = transformer.TransformUserMargin(context.Background(), margin, data, "IDR")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"margin_balance":32000`)
+	assert.Equal(t, 2.0, margin.MarginBalance)
+	assert.Zero(t, margin.FxRate)
+}
+
+// TestTransformUserPositionEmbedding tests embedding the applied rate and the original values of converted fields
+func TestTransformUserPositionEmbedding(t *testing.T) {
+	transformer := NewTransformer(&stubCurrencyService{rate: 16000}, "USDT", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	data := []byte(`{"symbol":"BTCUSDT","size":2,"value":100,"entry_price":50,"order_margin":10}`)
+
+	out, err := transformer.TransformUserPosition(context.Background(), decodePosition(t, data), data, "IDR")
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "fx_rate")
+	assert.NotContains(t, string(out), "original_values")
+
+	transformer.SetEmbedding(true, true)
+	out, err = transformer.TransformUserPosition(context.Background(), decodePosition(t, data), data, "IDR")
+	require.NoError(t, err)
+
+	var position types.UserPosition
+	require.NoError(t, json.Unmarshal(out, &position))
+	assert.Equal(t, 1600000.0, position.Value)
+	assert.Equal(t, 16000.0, position.FxRate)
+	assert.Equal(t, 100.0, position.OriginalValues["value"])
+	assert.Equal(t, 10.0, position.OriginalValues["order_margin"])
+
+	// Unconverted fields are not reported as original values
+	assert.Equal(t, 50.0, position.EntryPrice)
+	assert.NotContains(t, position.OriginalValues, "entry_price")
+	assert.NotContains(t, position.OriginalValues, "size")
+
+	// USDT users receive the payload untouched
+	out, err = transformer.TransformUserPosition(context.Background(), decodePosition(t, data), data, "USDT")
+	require.NoError(t, err)
+	assert.Equal(t, data, out)
+}
+
+// stubQuarantine records quarantined records
+type stubQuarantine struct {
+	records [][]byte
+}
+
+func (q *stubQuarantine) Publish(ctx context.Context, key []byte, value []byte) error {
+	q.records = append(q.records, value)
+	return nil
+}
+
+// TestUnknownInstrumentPolicy tests passing, dropping and quarantining payloads without conversion rules
+func TestUnknownInstrumentPolicy(t *testing.T) {
+	transformer := NewTransformer(&stubCurrencyService{rate: 16000}, "USDT", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	margin := []byte(`{"cfx_user_id":"cfx_1","asset":"BTC","margin_balance":1}`)
+	position := []byte(`{"cfx_user_id":"cfx_1","symbol":"BTCUSD","value":1}`)
+
+	// Pass publishes the payload unconverted
+	out, err := transformer.TransformUserMargin(context.Background(), decodeMargin(t, margin), margin, "IDR")
+	require.NoError(t, err)
+	assert.Equal(t, margin, out)
+
+	transformer.SetUnknownPolicy(UnknownDrop)
+	out, err = transformer.TransformUserPosition(context.Background(), decodePosition(t, position), position, "IDR")
+	require.NoError(t, err)
+	assert.Nil(t, out)
+
+	// A symbol override makes the symbol known
+	transformer.SetConversionRules(NewConversionRules(map[string]bool{"value": true}, map[string]map[string]bool{"btcusd": {}}))
+	out, err = transformer.TransformUserPosition(context.Background(), decodePosition(t, position), position, "IDR")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"value":16000`)
+
+	quarantine := &stubQuarantine{}
+	transformer.SetUnknownPolicy(UnknownQuarantine)
+	transformer.SetQuarantine(quarantine)
+	out, err = transformer.TransformUserMargin(context.Background(), decodeMargin(t, margin), margin, "IDR")
+	require.NoError(t, err)
+	assert.Nil(t, out)
+	require.Len(t, quarantine.records, 1)
+
+	var record QuarantinedMessage
+	require.NoError(t, json.Unmarshal(quarantine.records[0], &record))
+	assert.Equal(t, "margin", record.Kind)
+	assert.Equal(t, "BTC", record.Instrument)
+	assert.JSONEq(t, string(margin), string(record.Payload))
+
+	// Reject leaves the message to the caller's policy for unsupported assets
+	transformer.SetUnknownPolicy(UnknownReject)
+	out, err = transformer.TransformUserMargin(context.Background(), decodeMargin(t, margin), margin, "IDR")
+	assert.ErrorIs(t, err, ErrUnsupportedAsset)
+	assert.Nil(t, out)
+
+	policy, err := ParseUnknownPolicy("reject")
+	require.NoError(t, err)
+	assert.Equal(t, UnknownReject, policy)
+	_, err = ParseUnknownPolicy("bounce")
+	assert.Error(t, err)
+}
+
+// TestTransformInvalidPayload tests that payloads whose converted values cannot be encoded fail as invalid
+func TestTransformInvalidPayload(t *testing.T) {
+	transformer := NewTransformer(&stubCurrencyService{rate: 16000}, "USDT", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	margin := []byte(`{"cfx_user_id":"cfx_1","asset":"USDT","margin_balance":1e308}`)
+
+	_, err := transformer.TransformUserMargin(context.Background(), decodeMargin(t, margin), margin, "IDR")
+	assert.ErrorIs(t, err, ErrInvalidPayload)
+	assert.NotErrorIs(t, err, ErrRateUnavailable)
+}
+
+// hangingCurrencyService blocks until the context is done while hang is set
+type hangingCurrencyService struct {
+	hang bool
+}
+
+func (s *hangingCurrencyService) GetCurrentRate(ctx context.Context) (float64, error) {
+	if s.hang {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	return 16000, nil
+}
+
+// TestTransformStaleRate tests that a rate lookup missing the message deadline falls back to the last applied rate
+func TestTransformStaleRate(t *testing.T) {
+	currency := &hangingCurrencyService{hang: true}
+	transformer := NewTransformer(currency, "USDT", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	margin := []byte(`{"cfx_user_id":"cfx_1","asset":"USDT","margin_balance":1}`)
+
+	// No rate applied yet: the deadline fails the transformation
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := transformer.TransformUserMargin(ctx, decodeMargin(t, margin), margin, "IDR")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, ErrRateUnavailable)
+
+	currency.hang = false
+	out, err := transformer.TransformUserMargin(context.Background(), decodeMargin(t, margin), margin, "IDR")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"margin_balance":16000`)
+
+	currency.hang = true
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	out, err = transformer.TransformUserMargin(ctx, decodeMargin(t, margin), margin, "IDR")
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `"margin_balance":16000`)
+	assert.Less(t, time.Since(started), time.Second)
+}
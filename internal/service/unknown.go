@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// UnknownPolicy decides what happens to payloads of an asset or symbol without conversion rules
+type UnknownPolicy string
+
+const (
+	// UnknownPass publishes the payload unconverted
+	UnknownPass UnknownPolicy = "pass"
+
+	// UnknownDrop discards the payload
+	UnknownDrop UnknownPolicy = "drop"
+
+	// UnknownQuarantine discards the payload and produces it to the quarantine topic
+	UnknownQuarantine UnknownPolicy = "quarantine"
+
+	// UnknownReject fails the transformation with ErrUnsupportedAsset, leaving the message to the caller
+	UnknownReject UnknownPolicy = "reject"
+)
+
+// ParseUnknownPolicy parses a policy name, defaulting to pass
+func ParseUnknownPolicy(name string) (UnknownPolicy, error) {
+	switch policy := UnknownPolicy(strings.ToLower(name)); policy {
+	case "", UnknownPass:
+		return UnknownPass, nil
+	case UnknownDrop, UnknownQuarantine, UnknownReject:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown instrument policy %q, want pass, drop, quarantine or reject", name)
+	}
+}
+
+// QuarantinePublisher produces quarantined payloads (implemented by the Kafka producer)
+type QuarantinePublisher interface {
+	Publish(ctx context.Context, key []byte, value []byte) error
+}
+
+// QuarantinedMessage is the record produced to the quarantine topic
+type QuarantinedMessage struct {
+	Kind       string          `json:"kind"`
+	Instrument string          `json:"instrument"`
+	CFXUserID  string          `json:"cfx_user_id"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// SetUnknownPolicy sets the policy for assets and symbols without conversion rules
+func (t *Transformer) SetUnknownPolicy(policy UnknownPolicy) {
+	t.unknownPolicy = policy
+}
+
+// SetQuarantine sets the publisher receiving quarantined payloads
+func (t *Transformer) SetQuarantine(quarantine QuarantinePublisher) {
+	t.quarantine = quarantine
+}
+
+// SetMetrics sets the metrics counting unknown instruments
+func (t *Transformer) SetMetrics(metrics *TransformerMetrics) {
+	t.metrics = metrics
+}
+
+// knownAsset reports whether a margin asset can be converted at the USDT rate.
+// Payloads without an asset predate multi-asset margin and are USDT.
+func (t *Transformer) knownAsset(asset string) bool {
+	return asset == "" || asset == t.cfxUsdtAsset
+}
+
+// knownSymbol reports whether a position symbol is quoted in USDT or has its own conversion rules
+func (t *Transformer) knownSymbol(symbol string) bool {
+	return symbol == "" || strings.HasSuffix(symbol, t.cfxUsdtAsset) || t.rules.HasOverride(symbol)
+}
+
+// handleUnknown applies the unknown instrument policy, returning the payload to publish or nil to drop it
+func (t *Transformer) handleUnknown(ctx context.Context, kind, instrument string, data []byte, cfxUserID string) ([]byte, error) {
+	if t.metrics != nil {
+		t.metrics.RecordUnknown(kind, instrument, t.unknownPolicy)
+	}
+	t.logger.Warn("no conversion rules for instrument",
+		"kind", kind,
+		"instrument", instrument,
+		"cfx_user_id", cfxUserID,
+		"policy", t.unknownPolicy)
+
+	switch t.unknownPolicy {
+	case UnknownDrop:
+		return nil, nil
+	case UnknownQuarantine:
+		t.quarantineMessage(ctx, kind, instrument, data, cfxUserID)
+		return nil, nil
+	case UnknownReject:
+		return nil, fmt.Errorf("%w: %s %s", ErrUnsupportedAsset, kind, instrument)
+	default:
+		return data, nil
+	}
+}
+
+// quarantineMessage produces the payload to the quarantine topic
+func (t *Transformer) quarantineMessage(ctx context.Context, kind, instrument string, data []byte, cfxUserID string) {
+	if t.quarantine == nil {
+		return
+	}
+
+	record, err := json.Marshal(QuarantinedMessage{
+		Kind:       kind,
+		Instrument: instrument,
+		CFXUserID:  cfxUserID,
+		Payload:    data,
+	})
+	if err != nil {
+		t.logger.Error("failed to encode quarantined message", "error", err)
+		return
+	}
+
+	if err := t.quarantine.Publish(ctx, []byte(instrument), record); err != nil {
+		t.logger.Error("failed to quarantine message", "kind", kind, "instrument", instrument, "error", err)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy retries failed upstream calls with exponential backoff
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry; it doubles on every further retry
+	Backoff time.Duration
+}
+
+// internalAPIRetry retries a failed internal API call once after a short delay
+var internalAPIRetry = RetryPolicy{MaxAttempts: 2, Backoff: 100 * time.Millisecond}
+
+// upstreamCall describes a JSON request to an internal service
+type upstreamCall struct {
+	Method string
+	URL    string
+	Header http.Header
+
+	// Body is encoded as the JSON request body when set
+	Body any
+
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	Retry   RetryPolicy
+}
+
+// callJSON performs the call and decodes the JSON response into a Resp, retrying transport failures,
+// 429 and 5xx responses per the call's policy
+func callJSON[Resp any](ctx context.Context, client *http.Client, call upstreamCall) (Resp, error) {
+	var zero Resp
+
+	var body []byte
+	if call.Body != nil {
+		var err error
+		if body, err = json.Marshal(call.Body); err != nil {
+			return zero, fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	attempts := max(call.Retry.MaxAttempts, 1)
+	backoff := call.Retry.Backoff
+
+	for attempt := 1; ; attempt++ {
+		resp, err := doJSON[Resp](ctx, client, call, body)
+		if err == nil {
+			return resp, nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt == attempts {
+			if attempt > 1 {
+				return zero, fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return zero, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return zero, fmt.Errorf("%w (retry cancelled: %w)", err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// permanentError wraps failures another attempt cannot fix: bad requests, 4xx responses and undecodable bodies
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// doJSON performs a single attempt of the call
+func doJSON[Resp any](ctx context.Context, client *http.Client, call upstreamCall, body []byte) (Resp, error) {
+	var resp Resp
+
+	if call.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, call.Timeout)
+		defer cancel()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, call.Method, call.URL, reader)
+	if err != nil {
+		return resp, &permanentError{fmt.Errorf("failed to create request: %w", err)}
+	}
+	for name, values := range call.Header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return resp, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		// Drain so the connection can be reused
+		_, _ = io.Copy(io.Discard, httpResp.Body)
+
+		// Only 429 and 5xx may succeed on another attempt
+		err := fmt.Errorf("unexpected status code: %d", httpResp.StatusCode)
+		if httpResp.StatusCode != http.StatusTooManyRequests && httpResp.StatusCode < http.StatusInternalServerError {
+			return resp, &permanentError{err}
+		}
+		return resp, err
+	}
+
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return resp, &permanentError{fmt.Errorf("failed to decode response: %w", err)}
+	}
+	return resp, nil
+}
+
+// PingUpstream checks that an internal service answers HTTP requests at host. Any response below 500
+// counts, since services do not share a health path.
+func PingUpstream(ctx context.Context, client *http.Client, host string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
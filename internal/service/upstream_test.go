@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCallJSON tests decoding typed responses and retrying only transient failures
+func TestCallJSON(t *testing.T) {
+	type params struct {
+		Symbol string `json:"symbol"`
+	}
+	type result struct {
+		Echo   string `json:"echo"`
+		UserID string `json:"user_id"`
+	}
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/flaky":
+			if calls == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var p params
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		_ = json.NewEncoder(w).Encode(result{Echo: p.Symbol, UserID: r.Header.Get("User-Id")})
+	}))
+	defer srv.Close()
+
+	retry := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	resp, err := callJSON[result](context.Background(), srv.Client(), upstreamCall{
+		Method: http.MethodPost,
+		URL:    srv.URL + "/flaky",
+		Header: http.Header{"User-Id": {"12345"}},
+		Body:   params{Symbol: "BTCUSDT"},
+		Retry:  retry,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, result{Echo: "BTCUSDT", UserID: "12345"}, resp)
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	_, err = callJSON[result](context.Background(), srv.Client(), upstreamCall{
+		Method: http.MethodGet,
+		URL:    srv.URL + "/missing",
+		Retry:  retry,
+	})
+	assert.ErrorContains(t, err, "unexpected status code: 404")
+	assert.Equal(t, 1, calls, "4xx responses are not retried")
+}
+
+// TestPingUpstream tests that any response below 500 counts as reachable
+func TestPingUpstream(t *testing.T) {
+	status := http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	require.NoError(t, PingUpstream(context.Background(), srv.Client(), srv.URL))
+
+	status = http.StatusBadGateway
+	assert.ErrorContains(t, PingUpstream(context.Background(), srv.Client(), srv.URL), "unexpected status code: 502")
+
+	srv.Close()
+	assert.ErrorContains(t, PingUpstream(context.Background(), srv.Client(), srv.URL), "HTTP request failed")
+}
@@ -2,7 +2,6 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
@@ -21,21 +20,26 @@ type HTTPUserPreferenceClient struct {
 	baseURL    string
 	httpClient *http.Client
 	logger     *slog.Logger
-	cache      *cache.TTLCache[string]
+	cache      cache.Store
+	cacheTTL   time.Duration
 }
 
 // NewHTTPUserPreferenceClient creates a new user preference client
 func NewHTTPUserPreferenceClient(baseURL string, cacheTTL time.Duration, logger *slog.Logger) *HTTPUserPreferenceClient {
 	return &HTTPUserPreferenceClient{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
-		},
-		logger: logger,
-		cache:  cache.NewTTLCache[string](cacheTTL),
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+		logger:     logger,
+		cache:      cache.NewMemoryStore(),
+		cacheTTL:   cacheTTL,
 	}
 }
 
+// SetCache sets the store caching preferences, e.g. a Redis store shared by every replica
+func (c *HTTPUserPreferenceClient) SetCache(store cache.Store) {
+	c.cache = store
+}
+
 // UserPreferenceResponse represents the API response from coin-setting-svc
 type UserPreferenceResponse struct {
 	ErrCode    string               `json:"err_code"`
@@ -50,36 +54,28 @@ type UserPreferenceResult struct {
 
 // GetQuotePreference retrieves the user's futures quote preference
 func (c *HTTPUserPreferenceClient) GetQuotePreference(ctx context.Context, ajaibID string) (string, error) {
-	if cached, ok := c.cache.Get(ajaibID); ok {
-		c.logger.Debug("user preference cache hit", "ajaib_id", ajaibID)
-		return cached, nil
-	}
-
-	url := fmt.Sprintf("%s/api/v1/internal/coin-setting/user-futures-preference", c.baseURL)
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	cacheKey := "quote_preference:" + ajaibID
+	cached, ok, err := c.cache.Get(ctx, cacheKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		c.logger.Warn("failed to read user preference cache", "ajaib_id", ajaibID, "error", err)
+	}
+	if ok {
+		c.logger.Debug("user preference cache hit", "ajaib_id", ajaibID)
+		return string(cached), nil
 	}
 
-	req.Header.Set("User-Id", ajaibID)
-
-	resp, err := c.httpClient.Do(req)
+	response, err := callJSON[UserPreferenceResponse](ctx, c.httpClient, upstreamCall{
+		Method:  http.MethodGet,
+		URL:     fmt.Sprintf("%s/api/v1/internal/coin-setting/user-futures-preference", c.baseURL),
+		Header:  http.Header{"User-Id": {ajaibID}},
+		Timeout: 5 * time.Second,
+		Retry:   internalAPIRetry,
+	})
 	if err != nil {
 		c.logger.Error("failed to fetch user preference",
 			"ajaib_id", ajaibID,
 			"error", err)
-		return "", fmt.Errorf("HTTP request failed: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	var response UserPreferenceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return "", err
 	}
 
 	if response.ErrCode != "EC0000000" {
@@ -91,7 +87,9 @@ func (c *HTTPUserPreferenceClient) GetQuotePreference(ctx context.Context, ajaib
 	}
 
 	pref := response.Result.QuotePreference
-	c.cache.Set(ajaibID, pref)
+	if err := c.cache.Set(ctx, cacheKey, []byte(pref), c.cacheTTL); err != nil {
+		c.logger.Warn("failed to cache user preference", "ajaib_id", ajaibID, "error", err)
+	}
 
 	c.logger.Debug("fetched user quote preference",
 		"ajaib_id", ajaibID,
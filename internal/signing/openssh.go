@@ -0,0 +1,176 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// OpenSSH key format constants (see PROTOCOL.key in the OpenSSH sources)
+const (
+	openSSHMagic      = "openssh-key-v1\x00"
+	openSSHPEMType    = "OPENSSH PRIVATE KEY"
+	openSSHKeyType    = "ssh-ed25519"
+	openSSHBlockSize  = 8
+	openSSHCipherNone = "none"
+)
+
+// ParseOpenSSHPrivateKey parses an unencrypted Ed25519 private key in OpenSSH format, as written by
+// ssh-keygen -t ed25519 or keytool generate
+func ParseOpenSSHPrivateKey(data []byte) (ed25519.PrivateKey, string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != openSSHPEMType {
+		return nil, "", fmt.Errorf("not an OpenSSH private key")
+	}
+
+	r := sshReader{data: block.Bytes}
+	if !bytes.HasPrefix(r.data, []byte(openSSHMagic)) {
+		return nil, "", fmt.Errorf("invalid OpenSSH key magic")
+	}
+	r.data = r.data[len(openSSHMagic):]
+
+	cipher, kdf := string(r.string()), string(r.string())
+	r.string() // kdf options
+	if cipher != openSSHCipherNone || kdf != openSSHCipherNone {
+		return nil, "", fmt.Errorf("encrypted OpenSSH keys are not supported, decrypt with ssh-keygen -p")
+	}
+	if n := r.uint32(); n != 1 {
+		return nil, "", fmt.Errorf("OpenSSH key file holds %d keys, want 1", n)
+	}
+	r.string() // public key, repeated in the private section
+
+	private := sshReader{data: r.string()}
+	if r.err != nil {
+		return nil, "", r.err
+	}
+
+	if private.uint32() != private.uint32() {
+		return nil, "", fmt.Errorf("OpenSSH key check bytes mismatch")
+	}
+	if keyType := string(private.string()); keyType != openSSHKeyType {
+		return nil, "", fmt.Errorf("OpenSSH key type %q, want %s", keyType, openSSHKeyType)
+	}
+	public := private.string()
+	key := private.string()
+	comment := string(private.string())
+	if private.err != nil {
+		return nil, "", private.err
+	}
+
+	if len(public) != ed25519.PublicKeySize || len(key) != ed25519.PrivateKeySize {
+		return nil, "", fmt.Errorf("invalid ed25519 key size")
+	}
+	if !bytes.Equal(key[ed25519.SeedSize:], public) {
+		return nil, "", fmt.Errorf("ed25519 private key doesn't match its public key")
+	}
+	return ed25519.PrivateKey(bytes.Clone(key)), comment, nil
+}
+
+// MarshalOpenSSHPrivateKey encodes an Ed25519 private key in unencrypted OpenSSH format
+func MarshalOpenSSHPrivateKey(key ed25519.PrivateKey, comment string) ([]byte, error) {
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return nil, err
+	}
+
+	public := key.Public().(ed25519.PublicKey)
+
+	var private sshWriter
+	private.raw(check[:])
+	private.raw(check[:])
+	private.string([]byte(openSSHKeyType))
+	private.string(public)
+	private.string(key)
+	private.string([]byte(comment))
+	for i := byte(1); private.buf.Len()%openSSHBlockSize != 0; i++ {
+		private.buf.WriteByte(i)
+	}
+
+	var w sshWriter
+	w.raw([]byte(openSSHMagic))
+	w.string([]byte(openSSHCipherNone))
+	w.string([]byte(openSSHCipherNone))
+	w.string(nil)
+	w.uint32(1)
+	w.string(publicKeyWire(public))
+	w.string(private.buf.Bytes())
+
+	return pem.EncodeToMemory(&pem.Block{Type: openSSHPEMType, Bytes: w.buf.Bytes()}), nil
+}
+
+// AuthorizedKey formats a public key as a single authorized_keys line
+func AuthorizedKey(key ed25519.PublicKey, comment string) string {
+	line := openSSHKeyType + " " + base64.StdEncoding.EncodeToString(publicKeyWire(key))
+	if comment != "" {
+		line += " " + comment
+	}
+	return line
+}
+
+// Fingerprint returns the SHA256 fingerprint of a public key, in the format printed by ssh-keygen -l
+func Fingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKeyWire(key))
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// publicKeyWire encodes a public key in the SSH wire format
+func publicKeyWire(key ed25519.PublicKey) []byte {
+	var w sshWriter
+	w.string([]byte(openSSHKeyType))
+	w.string(key)
+	return w.buf.Bytes()
+}
+
+// errShortKey is returned when an OpenSSH key ends in the middle of a field
+var errShortKey = errors.New("truncated OpenSSH key")
+
+// sshReader reads SSH wire fields, remembering the first error
+type sshReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sshReader) uint32() uint32 {
+	if r.err != nil || len(r.data) < 4 {
+		r.err = errShortKey
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+	return v
+}
+
+func (r *sshReader) string() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.data)) < n {
+		r.err = errShortKey
+		return nil
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v
+}
+
+// sshWriter writes SSH wire fields
+type sshWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *sshWriter) raw(b []byte) {
+	w.buf.Write(b)
+}
+
+func (w *sshWriter) uint32(v uint32) {
+	w.buf.Write(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (w *sshWriter) string(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.buf.Write(b)
+}
@@ -0,0 +1,230 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signing algorithms
+const (
+	AlgorithmHMACSHA256 = "hmac-sha256"
+	AlgorithmEd25519    = "ed25519"
+)
+
+// Publication tags carrying the signature in the Centrifuge publication envelope
+const (
+	TagSignature = "sig"
+	TagKeyID     = "kid"
+	TagAlgorithm = "alg"
+	TagTimestamp = "ts"
+)
+
+// ErrInvalidSignature is returned when a signature doesn't match the publication
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Signer signs messages with one key
+type Signer interface {
+	Algorithm() string
+	KeyID() string
+	Sign(message []byte) []byte
+}
+
+// ParseAlgorithm validates a signing algorithm
+func ParseAlgorithm(algorithm string) (string, error) {
+	switch strings.ToLower(algorithm) {
+	case AlgorithmHMACSHA256:
+		return AlgorithmHMACSHA256, nil
+	case AlgorithmEd25519:
+		return AlgorithmEd25519, nil
+	default:
+		return "", fmt.Errorf("unknown signing algorithm %q, want hmac-sha256 or ed25519", algorithm)
+	}
+}
+
+// HMACSigner signs with HMAC-SHA256 and a shared secret
+type HMACSigner struct {
+	keyID  string
+	secret []byte
+}
+
+// NewHMACSigner creates an HMAC-SHA256 signer
+func NewHMACSigner(keyID string, secret []byte) (*HMACSigner, error) {
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("hmac secret must be at least 32 bytes")
+	}
+	return &HMACSigner{keyID: keyID, secret: secret}, nil
+}
+
+// Algorithm returns hmac-sha256
+func (s *HMACSigner) Algorithm() string { return AlgorithmHMACSHA256 }
+
+// KeyID returns the identifier partners select the secret by
+func (s *HMACSigner) KeyID() string { return s.keyID }
+
+// Sign returns the HMAC-SHA256 of message
+func (s *HMACSigner) Sign(message []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(message)
+	return mac.Sum(nil)
+}
+
+// Ed25519Signer signs with an Ed25519 private key; partners verify with the public key
+type Ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+// NewEd25519Signer creates an Ed25519 signer
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{keyID: keyID, key: key}
+}
+
+// Algorithm returns ed25519
+func (s *Ed25519Signer) Algorithm() string { return AlgorithmEd25519 }
+
+// KeyID returns the identifier partners select the public key by
+func (s *Ed25519Signer) KeyID() string { return s.keyID }
+
+// Sign returns the Ed25519 signature of message
+func (s *Ed25519Signer) Sign(message []byte) []byte {
+	return ed25519.Sign(s.key, message)
+}
+
+// LoadEd25519PrivateKey reads an Ed25519 private key in OpenSSH or PEM-encoded PKCS#8 format
+func LoadEd25519PrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+	}
+
+	if block.Type == openSSHPEMType {
+		key, _, err := ParseOpenSSHPrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+		}
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", path, err)
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// Message is the signed form of a publication: the channel, the signing time in Unix milliseconds
+// and the payload, separated by newlines. Binding the channel and time stops a signed payload from
+// being replayed on another channel or passed off as fresh.
+func Message(channel string, timestamp int64, data []byte) []byte {
+	ts := strconv.FormatInt(timestamp, 10)
+	message := make([]byte, 0, len(channel)+len(ts)+len(data)+2)
+	message = append(message, channel...)
+	message = append(message, '\n')
+	message = append(message, ts...)
+	message = append(message, '\n')
+	return append(message, data...)
+}
+
+// PublicationSigner signs the publications of designated channels
+type PublicationSigner struct {
+	signer   Signer
+	prefixes []string
+	now      func() time.Time
+}
+
+// NewPublicationSigner signs publications of channels starting with one of prefixes
+func NewPublicationSigner(signer Signer, prefixes []string) *PublicationSigner {
+	return &PublicationSigner{signer: signer, prefixes: prefixes, now: time.Now}
+}
+
+// Tags returns the signature tags of a publication, or false when the channel isn't signed
+func (p *PublicationSigner) Tags(channel string, data []byte) (map[string]string, bool) {
+	if !p.signs(channel) {
+		return nil, false
+	}
+
+	timestamp := p.now().UnixMilli()
+	signature := p.signer.Sign(Message(channel, timestamp, data))
+	return map[string]string{
+		TagSignature: base64.RawURLEncoding.EncodeToString(signature),
+		TagKeyID:     p.signer.KeyID(),
+		TagAlgorithm: p.signer.Algorithm(),
+		TagTimestamp: strconv.FormatInt(timestamp, 10),
+	}, true
+}
+
+// signs reports whether publications of the channel are signed
+func (p *PublicationSigner) signs(channel string) bool {
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(channel, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyHMAC checks the signature tags of a publication signed with an HMAC secret
+func VerifyHMAC(secret []byte, channel string, tags map[string]string, data []byte) error {
+	signature, timestamp, err := parseTags(tags, AlgorithmHMACSHA256)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(Message(channel, timestamp, data))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyEd25519 checks the signature tags of a publication signed with an Ed25519 key
+func VerifyEd25519(key ed25519.PublicKey, channel string, tags map[string]string, data []byte) error {
+	signature, timestamp, err := parseTags(tags, AlgorithmEd25519)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(key, Message(channel, timestamp, data), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// parseTags decodes the signature and timestamp tags, checking the algorithm
+func parseTags(tags map[string]string, algorithm string) ([]byte, int64, error) {
+	if tags[TagAlgorithm] != algorithm {
+		return nil, 0, fmt.Errorf("%w: algorithm %q, want %s", ErrInvalidSignature, tags[TagAlgorithm], algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(tags[TagSignature])
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	timestamp, err := strconv.ParseInt(tags[TagTimestamp], 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: timestamp: %v", ErrInvalidSignature, err)
+	}
+	return signature, timestamp, nil
+}
@@ -0,0 +1,68 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPublicationSignerHMAC tests signing designated channels and verifying with the shared secret
+func TestPublicationSignerHMAC(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	signer, err := NewHMACSigner("partner-1", secret)
+	require.NoError(t, err)
+
+	p := NewPublicationSigner(signer, []string{"raw:user:"})
+	p.now = func() time.Time { return time.UnixMilli(1700000000000) }
+
+	_, ok := p.Tags("user:12345:margin", []byte(`{}`))
+	assert.False(t, ok, "channel not designated")
+
+	data := []byte(`{"asset":"USDT"}`)
+	tags, ok := p.Tags("raw:user:12345:margin", data)
+	require.True(t, ok)
+	assert.Equal(t, "partner-1", tags[TagKeyID])
+	assert.Equal(t, AlgorithmHMACSHA256, tags[TagAlgorithm])
+	assert.Equal(t, "1700000000000", tags[TagTimestamp])
+
+	require.NoError(t, VerifyHMAC(secret, "raw:user:12345:margin", tags, data))
+	assert.ErrorIs(t, VerifyHMAC(secret, "raw:user:99999:margin", tags, data), ErrInvalidSignature, "other channel")
+	assert.ErrorIs(t, VerifyHMAC(secret, "raw:user:12345:margin", tags, []byte(`{"asset":"BTC"}`)), ErrInvalidSignature, "tampered payload")
+
+	_, err = NewHMACSigner("short", []byte("secret"))
+	assert.Error(t, err)
+}
+
+// TestPublicationSignerEd25519 tests signing with a PKCS#8 key file and verifying with the public key
+func TestPublicationSignerEd25519(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	key, err := LoadEd25519PrivateKey(path)
+	require.NoError(t, err)
+
+	p := NewPublicationSigner(NewEd25519Signer("partner-2", key), []string{"raw:"})
+	data := []byte(`{"symbol":"BTCUSDT"}`)
+	tags, ok := p.Tags("raw:user:12345:position", data)
+	require.True(t, ok)
+
+	require.NoError(t, VerifyEd25519(public, "raw:user:12345:position", tags, data))
+	assert.ErrorIs(t, VerifyHMAC([]byte("secret"), "raw:user:12345:position", tags, data), ErrInvalidSignature, "algorithm mismatch")
+
+	tags[TagTimestamp] = "1"
+	assert.ErrorIs(t, VerifyEd25519(public, "raw:user:12345:position", tags, data), ErrInvalidSignature, "tampered timestamp")
+}
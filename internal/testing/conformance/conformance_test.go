@@ -0,0 +1,126 @@
+//go:build conformance
+
+package conformance
+
+import (
+	"context"
+	"encoding/base64"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"coin-futures-websocket/config"
+	"coin-futures-websocket/internal/auth"
+	"coin-futures-websocket/internal/testing/fakes"
+	"coin-futures-websocket/internal/websocket/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden transcripts")
+
+// scripts are the sessions replayed against the server, each compared with testdata/<name>.golden
+var scripts = []Script{
+	{
+		Name:  "session",
+		Token: testToken("12345"),
+		Steps: []Step{
+			{Send: `{"id":1,"connect":{}}`, Replies: 1},
+			{Send: `{"id":2,"subscribe":{"channel":"user:12345:margin"}}`, Replies: 1},
+			{Send: `{"id":3,"subscribe":{"channel":"user:12345:margin"}}`, Replies: 1},
+			{Send: `{"id":4,"subscribe":{"channel":"user:12345:orders"}}`, Replies: 1},
+			{Send: `{"id":5,"subscribe":{"channel":"user:99999:margin"}}`, Replies: 1},
+			{Ping: true},
+			{Send: `{"id":6,"unsubscribe":{"channel":"user:12345:margin"}}`, Replies: 1},
+			{
+				Send:  `{"id":7,"rpc":{"method":"bulk_subscribe","data":{"padding":"` + strings.Repeat("x", 70000) + `"}}}`,
+				Note:  "<rpc command of 70000+ bytes>",
+				Close: true,
+			},
+		},
+	},
+	{
+		Name: "unauthorized",
+		Steps: []Step{
+			{Send: `{"id":1,"connect":{}}`, Replies: 1},
+		},
+	},
+}
+
+// TestConformance tests the frames emitted for each scripted session against its golden transcript
+func TestConformance(t *testing.T) {
+	url := newTestServer(t)
+
+	for _, script := range scripts {
+		t.Run(script.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			transcript, err := Run(ctx, url, script)
+			require.NoError(t, err, "transcript so far:\n%s", transcript)
+
+			golden := filepath.Join("testdata", script.Name+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(golden, []byte(transcript), 0o644))
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			require.NoError(t, err, "run with -update to create the golden transcript")
+			assert.Equal(t, string(want), transcript)
+		})
+	}
+}
+
+// TestCanonical tests that frames are rendered with sorted keys, redacted IDs and expanded error details
+func TestCanonical(t *testing.T) {
+	frame := `{"id":3,"error":{"message":"{\"message\":\"too large\",\"details\":{\"size\":70042,\"limit_bytes\":65536}}","code":4006}}`
+
+	assert.Equal(t,
+		`{"error":{"code":4006,"message":{"details":{"limit_bytes":65536,"size":"<redacted>"},"message":"too large"}},"id":3}`,
+		Canonical([]byte(frame)))
+	assert.Equal(t, `{"connect":{"client":"<redacted>"},"id":1}`, Canonical([]byte(`{"id":1,"connect":{"client":"5f0c"}}`)))
+	assert.Equal(t, "not json", Canonical([]byte("not json")))
+}
+
+// newTestServer starts a server backed by fakes and returns its WebSocket URL
+func newTestServer(t *testing.T) string {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "conformance",
+		Namespace: "conformance",
+		LogLevel:  "error",
+	}
+
+	s := server.NewCentrifugeServer(cfg, logger)
+	s.SetCfxUserMapper(fakes.NewFakeCfxUserMapper(map[int64]string{12345: "cfx-12345"}))
+	s.SetUserPreferenceProvider(fakes.NewFakeUserPreferenceProvider("USDT"))
+	s.SetInstanceMetadata("conformance-0", "test")
+	require.NoError(t, s.Start())
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = s.Shutdown(ctx)
+	})
+
+	ts := httptest.NewServer(auth.NewMiddleware(logger).Wrap(s))
+	t.Cleanup(ts.Close)
+
+	return "ws" + strings.TrimPrefix(ts.URL, "http") + "/connection"
+}
+
+// testToken builds an unsigned JWT with the given subject
+func testToken(sub string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sub + `"}`))
+	return header + "." + payload + ".sig"
+}
@@ -0,0 +1,11 @@
+// Package conformance runs scripted client sessions against a live server and compares the frames
+// it emits with golden transcripts, so protocol regressions are caught before client SDKs notice.
+//
+// The suite dials real WebSocket connections and is kept out of the default test run:
+//
+//	go test -tags conformance ./internal/testing/conformance/...
+//
+// After an intended protocol change, regenerate the transcripts and review their diff:
+//
+//	go test -tags conformance ./internal/testing/conformance/... -update
+package conformance
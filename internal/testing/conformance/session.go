@@ -0,0 +1,259 @@
+//go:build conformance
+
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readTimeout bounds the wait for each expected frame
+const readTimeout = 5 * time.Second
+
+// redacted replaces values that change between runs
+const redacted = "<redacted>"
+
+// volatileKeys are the frame fields redacted from transcripts: generated IDs and measured sizes
+var volatileKeys = map[string]bool{
+	"client":      true,
+	"instance_id": true,
+	"size":        true,
+}
+
+// Step is one command of a scripted session and the frames the server must answer it with
+type Step struct {
+	// Send is the raw JSON command written to the server
+	Send string
+
+	// Note replaces the command in the transcript, for commands too large to record
+	Note string
+
+	// Replies is the number of frames expected in response
+	Replies int
+
+	// Close expects the server to close the connection after the replies
+	Close bool
+
+	// Ping sends nothing and instead waits for the server's next ping, recording it and the client's pong
+	Ping bool
+}
+
+// Script is a client session replayed against the server
+type Script struct {
+	Name string
+
+	// Token is sent in the X-Socket-Authorization header of the upgrade request; empty sends none
+	Token string
+
+	Steps []Step
+}
+
+// session is a raw Centrifuge JSON protocol client recording every frame it exchanges
+type session struct {
+	conn       *websocket.Conn
+	pending    [][]byte
+	transcript []string
+}
+
+// Run replays the script against the WebSocket endpoint at url and returns its transcript
+func Run(ctx context.Context, url string, script Script) (string, error) {
+	header := http.Header{}
+	if script.Token != "" {
+		header.Set("X-Socket-Authorization", "Bearer "+script.Token)
+	}
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		return "", fmt.Errorf("dial: %w", err)
+	}
+	defer conn.Close()
+
+	s := &session{conn: conn}
+	for i, step := range script.Steps {
+		if err := s.run(step); err != nil {
+			return s.String(), fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return s.String(), nil
+}
+
+// run sends the step's command and records the frames it expects
+func (s *session) run(step Step) error {
+	if step.Ping {
+		return s.expectPing()
+	}
+
+	sent := step.Note
+	if sent == "" {
+		sent = Canonical([]byte(step.Send))
+	}
+	s.transcript = append(s.transcript, "> "+sent)
+
+	if err := s.conn.WriteMessage(websocket.TextMessage, []byte(step.Send)); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	for range step.Replies {
+		frame, err := s.next()
+		if err != nil {
+			return err
+		}
+		s.transcript = append(s.transcript, "< "+Canonical(frame))
+	}
+
+	if step.Close {
+		return s.expectClose()
+	}
+	return nil
+}
+
+// expectPing waits for the next server ping and answers it, recording both frames
+func (s *session) expectPing() error {
+	for len(s.pending) == 0 {
+		if err := s.read(); err != nil {
+			return err
+		}
+	}
+
+	frame := s.pending[0]
+	s.pending = s.pending[1:]
+	if string(frame) != "{}" {
+		return fmt.Errorf("expected ping, got frame %s", frame)
+	}
+	s.transcript = append(s.transcript, "< {}", "> {}")
+
+	if err := s.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+		return fmt.Errorf("pong: %w", err)
+	}
+	return nil
+}
+
+// next returns the next reply or push, answering server pings without recording them
+func (s *session) next() ([]byte, error) {
+	for {
+		for len(s.pending) > 0 {
+			frame := s.pending[0]
+			s.pending = s.pending[1:]
+
+			// An empty command is a server ping; the client answers with an empty pong
+			if string(frame) == "{}" {
+				if err := s.conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+					return nil, fmt.Errorf("pong: %w", err)
+				}
+				continue
+			}
+			return frame, nil
+		}
+
+		if err := s.read(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// read receives one WebSocket message, which may batch several newline-separated frames
+func (s *session) read() error {
+	if err := s.conn.SetReadDeadline(time.Now().Add(readTimeout)); err != nil {
+		return err
+	}
+	_, data, err := s.conn.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	for _, frame := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(frame)) > 0 {
+			s.pending = append(s.pending, frame)
+		}
+	}
+	return nil
+}
+
+// expectClose records the close frame ending the session
+func (s *session) expectClose() error {
+	frame, err := s.next()
+	if err == nil {
+		return fmt.Errorf("expected close, got frame %s", frame)
+	}
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) {
+		return err
+	}
+	s.transcript = append(s.transcript, fmt.Sprintf("x %d %s", closeErr.Code, canonicalText(closeErr.Text)))
+	return nil
+}
+
+// String returns the transcript, one frame per line
+func (s *session) String() string {
+	return strings.Join(s.transcript, "\n") + "\n"
+}
+
+// Canonical renders a JSON frame with sorted keys and volatile fields redacted.
+// Error messages and close reasons carrying a JSON object are expanded so their details are compared too.
+func Canonical(frame []byte) string {
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(frame))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return string(frame)
+	}
+
+	// Keep redaction markers readable instead of escaping their angle brackets
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(normalize(v)); err != nil {
+		return string(frame)
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// canonicalText renders a close reason, expanding it when it is a JSON object
+func canonicalText(text string) string {
+	if strings.HasPrefix(text, "{") {
+		return Canonical([]byte(text))
+	}
+	return text
+}
+
+// normalize redacts volatile fields and expands strings holding a JSON object
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if volatileKeys[key] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = normalize(value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = normalize(value)
+		}
+		return v
+	case string:
+		if !strings.HasPrefix(v, "{") {
+			return v
+		}
+		var expanded map[string]any
+		decoder := json.NewDecoder(strings.NewReader(v))
+		decoder.UseNumber()
+		if err := decoder.Decode(&expanded); err != nil {
+			return v
+		}
+		return normalize(expanded)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,83 @@
+package fakes
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"coin-futures-websocket/internal/kafka"
+	"coin-futures-websocket/internal/service"
+	"coin-futures-websocket/internal/types"
+	"coin-futures-websocket/internal/websocket/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Compile-time checks that the fakes satisfy the interfaces they replace
+var (
+	_ service.RateProvider          = (*FakeRateProvider)(nil)
+	_ server.CfxUserMapper          = (*FakeCfxUserMapper)(nil)
+	_ server.UserPreferenceProvider = (*FakeUserPreferenceProvider)(nil)
+	_ server.EventPublisher         = (*FakeProducer)(nil)
+	_ kafka.Consumer                = (*FakeConsumer)(nil)
+	_ kafka.Publisher               = (*FakeHub)(nil)
+)
+
+// TestFakeConsumerReplaysIntoFakeHub tests an end-to-end replay through the broadcaster without Kafka or Centrifuge
+func TestFakeConsumerReplaysIntoFakeHub(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	hub := NewFakeHub()
+
+	broadcaster := kafka.NewBroadcaster(hub, nil, logger)
+	broadcaster.RegisterSubscription("cfx_1", "client_1", "user:12345:margin", "12345", "USDT")
+
+	fixtures := []Fixture{
+		{Topic: types.TopicUserMargin, Key: "cfx_1", Value: json.RawMessage(`{"cfx_user_id":"cfx_1","asset":"USDT"}`)},
+		{Topic: types.TopicUserMargin, Key: "cfx_2", Value: json.RawMessage(`{"cfx_user_id":"cfx_2","asset":"USDT"}`)},
+	}
+
+	consumer := NewFakeConsumer(broadcaster.HandleMessage, fixtures)
+	require.NoError(t, consumer.Start(context.Background()))
+
+	assert.True(t, consumer.IsHealthy())
+	assert.Equal(t, int64(2), consumer.Stats().MessagesConsumed)
+
+	pubs := hub.PublicationsFor("user:12345:" + types.ChannelMarginSuffix)
+	require.Len(t, pubs, 1)
+	assert.JSONEq(t, string(fixtures[0].Value), string(pubs[0].Data))
+
+	require.NoError(t, consumer.Close())
+	assert.False(t, consumer.IsHealthy())
+}
+
+// TestLoadFixtures tests loading fixtures from a JSON file
+func TestLoadFixtures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"topic":"t","key":"k","value":{"a":1}}]`), 0o600))
+
+	fixtures, err := LoadFixtures(path)
+	require.NoError(t, err)
+	require.Len(t, fixtures, 1)
+	assert.Equal(t, "t", fixtures[0].Topic)
+	assert.JSONEq(t, `{"a":1}`, string(fixtures[0].Value))
+
+	_, err = LoadFixtures(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+// TestFakeCfxUserMapper tests the mapper fake
+func TestFakeCfxUserMapper(t *testing.T) {
+	mapper := NewFakeCfxUserMapper(map[int64]string{12345: "cfx_1"})
+
+	id, err := mapper.GetCfxUserID(context.Background(), 12345)
+	require.NoError(t, err)
+	assert.Equal(t, "cfx_1", id)
+
+	_, err = mapper.GetCfxUserID(context.Background(), 99999)
+	assert.Error(t, err)
+	assert.Equal(t, 2, mapper.Calls())
+}
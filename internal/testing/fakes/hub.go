@@ -0,0 +1,70 @@
+package fakes
+
+import (
+	"sync"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Publication is a channel publication captured by FakeHub
+type Publication struct {
+	Channel string
+	Data    []byte
+}
+
+// FakeHub records channel publications in place of a Centrifuge node
+type FakeHub struct {
+	mu           sync.Mutex
+	publications []Publication
+	err          error
+}
+
+// NewFakeHub creates an empty publication recorder
+func NewFakeHub() *FakeHub {
+	return &FakeHub{}
+}
+
+// Publish records the publication or returns the configured error
+func (h *FakeHub) Publish(channel string, data []byte, opts ...centrifuge.PublishOption) (centrifuge.PublishResult, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		return centrifuge.PublishResult{}, h.err
+	}
+	h.publications = append(h.publications, Publication{Channel: channel, Data: data})
+	return centrifuge.PublishResult{}, nil
+}
+
+// SetError makes subsequent publishes fail with err (nil clears it)
+func (h *FakeHub) SetError(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.err = err
+}
+
+// Publications returns a copy of all recorded publications
+func (h *FakeHub) Publications() []Publication {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Publication(nil), h.publications...)
+}
+
+// PublicationsFor returns the recorded publications for a single channel
+func (h *FakeHub) PublicationsFor(channel string) []Publication {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var result []Publication
+	for _, pub := range h.publications {
+		if pub.Channel == channel {
+			result = append(result, pub)
+		}
+	}
+	return result
+}
+
+// Reset clears all recorded publications
+func (h *FakeHub) Reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publications = nil
+}
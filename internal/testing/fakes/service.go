@@ -0,0 +1,150 @@
+// Package fakes provides in-memory implementations of the service's external
+// dependencies so tests can run without network access, Kafka or a Centrifuge node.
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FakeRateProvider is an in-memory USDT/IDR rate provider
+type FakeRateProvider struct {
+	mu    sync.Mutex
+	rate  float64
+	err   error
+	calls int
+}
+
+// NewFakeRateProvider creates a rate provider that always returns the given rate
+func NewFakeRateProvider(rate float64) *FakeRateProvider {
+	return &FakeRateProvider{rate: rate}
+}
+
+// GetUSDTToIDRRate returns the configured rate or error
+func (f *FakeRateProvider) GetUSDTToIDRRate(ctx context.Context) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.rate, nil
+}
+
+// SetRate changes the rate returned by subsequent calls
+func (f *FakeRateProvider) SetRate(rate float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rate = rate
+}
+
+// SetError makes subsequent calls fail with err (nil clears it)
+func (f *FakeRateProvider) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Calls returns the number of rate lookups
+func (f *FakeRateProvider) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// FakeCfxUserMapper is an in-memory Ajaib ID to CFX user ID mapping
+type FakeCfxUserMapper struct {
+	mu       sync.Mutex
+	mappings map[int64]string
+	err      error
+	calls    int
+}
+
+// NewFakeCfxUserMapper creates a mapper seeded with the given mappings
+func NewFakeCfxUserMapper(mappings map[int64]string) *FakeCfxUserMapper {
+	m := make(map[int64]string, len(mappings))
+	for k, v := range mappings {
+		m[k] = v
+	}
+	return &FakeCfxUserMapper{mappings: m}
+}
+
+// GetCfxUserID returns the mapped CFX user ID, or an error for unknown users
+func (f *FakeCfxUserMapper) GetCfxUserID(ctx context.Context, ajaibID int64) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	cfxUserID, ok := f.mappings[ajaibID]
+	if !ok {
+		return "", fmt.Errorf("cfx user not found for ajaib_id %d", ajaibID)
+	}
+	return cfxUserID, nil
+}
+
+// Set adds or replaces a mapping
+func (f *FakeCfxUserMapper) Set(ajaibID int64, cfxUserID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mappings[ajaibID] = cfxUserID
+}
+
+// SetError makes subsequent calls fail with err (nil clears it)
+func (f *FakeCfxUserMapper) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
+
+// Calls returns the number of mapping lookups
+func (f *FakeCfxUserMapper) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// FakeUserPreferenceProvider is an in-memory quote preference store
+type FakeUserPreferenceProvider struct {
+	mu          sync.Mutex
+	preferences map[string]string
+	fallback    string
+	err         error
+}
+
+// NewFakeUserPreferenceProvider creates a provider returning fallback for users without a preference
+func NewFakeUserPreferenceProvider(fallback string) *FakeUserPreferenceProvider {
+	return &FakeUserPreferenceProvider{
+		preferences: make(map[string]string),
+		fallback:    fallback,
+	}
+}
+
+// GetQuotePreference returns the user's preference or the fallback
+func (f *FakeUserPreferenceProvider) GetQuotePreference(ctx context.Context, ajaibID string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return "", f.err
+	}
+	if pref, ok := f.preferences[ajaibID]; ok {
+		return pref, nil
+	}
+	return f.fallback, nil
+}
+
+// Set adds or replaces a user's preference
+func (f *FakeUserPreferenceProvider) Set(ajaibID, preference string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.preferences[ajaibID] = preference
+}
+
+// SetError makes subsequent calls fail with err (nil clears it)
+func (f *FakeUserPreferenceProvider) SetError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.err = err
+}
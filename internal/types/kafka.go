@@ -29,6 +29,10 @@ type UserMargin struct {
 	WalletBalance      float64 `json:"wallet_balance"`
 	MarginRatio        float64 `json:"margin_ratio"`
 	WithdrawableMargin float64 `json:"withdrawable_margin"`
+
+	// FxRate and OriginalValues are set by the transformer when embedding is enabled
+	FxRate         float64            `json:"fx_rate,omitempty"`
+	OriginalValues map[string]float64 `json:"original_values,omitempty"`
 }
 
 // UserPosition represents a user's futures position from Kafka
@@ -54,6 +58,10 @@ type UserPosition struct {
 	OpenOrderBuyQuantity     float64 `json:"open_order_buy_quantity"`
 	OpenOrderSellQuantity    float64 `json:"open_order_sell_quantity"`
 	OrderMargin              float64 `json:"order_margin"`
+
+	// FxRate and OriginalValues are set by the transformer when embedding is enabled
+	FxRate         float64            `json:"fx_rate,omitempty"`
+	OriginalValues map[string]float64 `json:"original_values,omitempty"`
 }
 
 // GetCFXUserID returns the CFX user ID for this margin data
@@ -65,3 +73,13 @@ func (m *UserMargin) GetCFXUserID() string {
 func (p *UserPosition) GetCFXUserID() string {
 	return p.CFXUserID
 }
+
+// GetTimestamp returns the time the margin data was produced, in Unix milliseconds
+func (m *UserMargin) GetTimestamp() int64 {
+	return m.Timestamp
+}
+
+// GetTimestamp returns the time the position data was produced, in Unix milliseconds
+func (p *UserPosition) GetTimestamp() int64 {
+	return p.Timestamp
+}
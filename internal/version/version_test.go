@@ -0,0 +1,28 @@
+package version
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHandler tests reporting the build metadata set at build time
+func TestHandler(t *testing.T) {
+	Version, Commit, Date = "v1.4.2", "0a1b2c3", "2026-10-16T08:00:00Z"
+	t.Cleanup(func() { Version, Commit, Date = "dev", "", "" })
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var info Info
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info))
+	assert.Equal(t, "v1.4.2", info.Version)
+	assert.Equal(t, "0a1b2c3", info.Commit)
+	assert.Equal(t, "2026-10-16T08:00:00Z", info.Date)
+	assert.NotEmpty(t, info.GoVersion)
+}
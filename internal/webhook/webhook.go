@@ -0,0 +1,308 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types delivered to webhook endpoints
+const (
+	EventUserOnline  = "user.online"
+	EventUserOffline = "user.offline"
+)
+
+// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the request body, keyed with the shared secret
+const SignatureHeader = "X-Webhook-Signature"
+
+// Event is the JSON body posted to webhook endpoints
+type Event struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	AjaibID string `json:"ajaib_id"`
+
+	// Node is the instance that saw the transition; presence is tracked per instance
+	Node      string `json:"node"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// Config configures webhook delivery
+type Config struct {
+	URLs   []string
+	Secret string
+
+	// Node identifies this instance in events
+	Node string
+
+	// Timeout bounds each delivery attempt
+	Timeout time.Duration
+
+	// MaxAttempts is the total number of attempts per endpoint, including the first
+	MaxAttempts int
+
+	// Backoff is the delay before the first retry; it doubles on every further retry
+	Backoff time.Duration
+
+	// QueueSize bounds the events waiting for each worker; events are dropped when it is full
+	QueueSize int
+
+	// Workers deliver events concurrently; a user's events always go through the same worker, in order
+	Workers int
+}
+
+// Notifier posts user presence events to the configured endpoints asynchronously, with retries
+type Notifier struct {
+	config Config
+	client *http.Client
+	logger *slog.Logger
+
+	queues []chan Event
+	mu     sync.RWMutex
+	closed bool
+
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+// NewNotifier creates a notifier; call Start to begin delivering
+func NewNotifier(config Config, logger *slog.Logger) (*Notifier, error) {
+	if len(config.URLs) == 0 {
+		return nil, fmt.Errorf("webhooks require at least one url")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 2 * time.Second
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 1
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = 500 * time.Millisecond
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1000
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+
+	queues := make([]chan Event, config.Workers)
+	for i := range queues {
+		queues[i] = make(chan Event, config.QueueSize)
+	}
+
+	return &Notifier{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		logger: logger,
+		queues: queues,
+	}, nil
+}
+
+// Start runs the delivery workers until Close, or until ctx is cancelled
+func (n *Notifier) Start(ctx context.Context) {
+	ctx, n.cancel = context.WithCancel(ctx)
+	for _, queue := range n.queues {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.work(ctx, queue)
+		}()
+	}
+}
+
+// Close stops accepting events and waits for queued ones to be delivered. Deliveries still
+// pending when ctx is done are abandoned.
+func (n *Notifier) Close(ctx context.Context) error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		for _, queue := range n.queues {
+			close(queue)
+		}
+	}
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if n.cancel != nil {
+			n.cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+// UserOnline queues a user.online event; it never blocks
+func (n *Notifier) UserOnline(ajaibID string) {
+	n.enqueue(EventUserOnline, ajaibID)
+}
+
+// UserOffline queues a user.offline event; it never blocks
+func (n *Notifier) UserOffline(ajaibID string) {
+	n.enqueue(EventUserOffline, ajaibID)
+}
+
+// enqueue hands the event to the user's worker, dropping it when the queue is full
+func (n *Notifier) enqueue(eventType, ajaibID string) {
+	event := Event{
+		ID:        newID(),
+		Type:      eventType,
+		AjaibID:   ajaibID,
+		Node:      n.config.Node,
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		return
+	}
+
+	select {
+	case n.queues[n.shard(ajaibID)] <- event:
+	default:
+		n.logger.Warn("webhook queue full, event dropped", "type", eventType, "ajaib_id", ajaibID)
+	}
+}
+
+// shard returns the worker owning the user's events
+func (n *Notifier) shard(ajaibID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(ajaibID))
+	return int(h.Sum32() % uint32(len(n.queues)))
+}
+
+// work delivers the queue's events in order until it is closed or ctx is cancelled
+func (n *Notifier) work(ctx context.Context, queue <-chan Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-queue:
+			if !ok {
+				return
+			}
+			n.dispatch(ctx, event)
+		}
+	}
+}
+
+// dispatch posts the event to every endpoint
+func (n *Notifier) dispatch(ctx context.Context, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.logger.Error("failed to encode webhook event", "type", event.Type, "error", err)
+		return
+	}
+
+	for _, url := range n.config.URLs {
+		if err := n.deliver(ctx, url, body); err != nil {
+			n.logger.Warn("webhook delivery failed",
+				"url", url,
+				"type", event.Type,
+				"event_id", event.ID,
+				"ajaib_id", event.AjaibID,
+				"error", err)
+		}
+	}
+}
+
+// deliver posts the body, retrying transport failures, 429 and 5xx responses with exponential backoff
+func (n *Notifier) deliver(ctx context.Context, url string, body []byte) error {
+	backoff := n.config.Backoff
+	for attempt := 1; ; attempt++ {
+		err := n.post(ctx, url, body)
+		if err == nil {
+			return nil
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt == n.config.MaxAttempts {
+			if attempt > 1 {
+				return fmt.Errorf("after %d attempts: %w", attempt, err)
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (retry cancelled: %w)", err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post performs a single delivery attempt
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.config.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(n.config.Secret, body))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	default:
+		return &permanentError{err: fmt.Errorf("unexpected status %d", resp.StatusCode)}
+	}
+}
+
+// Sign returns the signature of body sent in SignatureHeader
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// permanentError wraps failures another attempt cannot fix, such as 4xx responses
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// newID returns a random event ID receivers can use to drop duplicate deliveries
+func newID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
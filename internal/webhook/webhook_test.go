@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiver records the events posted to a test endpoint
+type receiver struct {
+	mu       sync.Mutex
+	attempts int
+	events   []Event
+	status   func(attempt int) int
+	t        *testing.T
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	require.NoError(r.t, err)
+	assert.Equal(r.t, Sign("secret", body), req.Header.Get(SignatureHeader))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempts++
+	status := http.StatusOK
+	if r.status != nil {
+		status = r.status(r.attempts)
+	}
+	if status == http.StatusOK {
+		var event Event
+		require.NoError(r.t, json.Unmarshal(body, &event))
+		r.events = append(r.events, event)
+	}
+	w.WriteHeader(status)
+}
+
+// TestNewNotifier tests that at least one url is required
+func TestNewNotifier(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	_, err := NewNotifier(Config{}, logger)
+	assert.Error(t, err)
+
+	notifier, err := NewNotifier(Config{URLs: []string{"http://localhost"}}, logger)
+	require.NoError(t, err)
+	assert.Equal(t, 1, notifier.config.MaxAttempts)
+	assert.Len(t, notifier.queues, 1)
+}
+
+// TestNotifier tests that events are signed, retried on 5xx and delivered in order per user
+func TestNotifier(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	recv := &receiver{t: t, status: func(attempt int) int {
+		if attempt == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	}}
+	endpoint := httptest.NewServer(recv)
+	defer endpoint.Close()
+
+	notifier, err := NewNotifier(Config{
+		URLs:        []string{endpoint.URL},
+		Secret:      "secret",
+		Node:        "node-1",
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Workers:     4,
+	}, logger)
+	require.NoError(t, err)
+	notifier.Start(context.Background())
+
+	notifier.UserOnline("12345")
+	notifier.UserOffline("12345")
+	notifier.UserOnline("12345")
+	require.NoError(t, notifier.Close(context.Background()))
+
+	// Events after Close are ignored
+	notifier.UserOffline("12345")
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	assert.Equal(t, 4, recv.attempts)
+	require.Len(t, recv.events, 3)
+	for i, eventType := range []string{EventUserOnline, EventUserOffline, EventUserOnline} {
+		assert.Equal(t, eventType, recv.events[i].Type)
+		assert.Equal(t, "12345", recv.events[i].AjaibID)
+		assert.Equal(t, "node-1", recv.events[i].Node)
+		assert.NotEmpty(t, recv.events[i].ID)
+	}
+	assert.NotEqual(t, recv.events[0].ID, recv.events[2].ID)
+}
+
+// TestNotifierPermanentFailure tests that 4xx responses are not retried
+func TestNotifierPermanentFailure(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	recv := &receiver{t: t, status: func(int) int { return http.StatusBadRequest }}
+	endpoint := httptest.NewServer(recv)
+	defer endpoint.Close()
+
+	notifier, err := NewNotifier(Config{
+		URLs:        []string{endpoint.URL},
+		Secret:      "secret",
+		MaxAttempts: 5,
+		Backoff:     time.Millisecond,
+	}, logger)
+	require.NoError(t, err)
+	notifier.Start(context.Background())
+
+	notifier.UserOnline("12345")
+	require.NoError(t, notifier.Close(context.Background()))
+
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	assert.Equal(t, 1, recv.attempts)
+	assert.Empty(t, recv.events)
+}
+
+// TestNotifierQueueFull tests that events are dropped instead of blocking when the queue is full
+func TestNotifierQueueFull(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	notifier, err := NewNotifier(Config{URLs: []string{"http://localhost"}, QueueSize: 1}, logger)
+	require.NoError(t, err)
+
+	// Not started, so nothing drains the queue
+	notifier.UserOnline("12345")
+	notifier.UserOffline("12345")
+	assert.Len(t, notifier.queues[0], 1)
+}
+
+// TestSign tests the webhook signature format
+func TestSign(t *testing.T) {
+	assert.Equal(t,
+		"sha256=77325902caca812dc259733aacd046b73817372c777b8d95b402647474516e13",
+		Sign("secret", []byte(`{}`)))
+	assert.NotEqual(t, Sign("secret", []byte(`{}`)), Sign("other", []byte(`{}`)))
+}
@@ -0,0 +1,180 @@
+package channel
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Family parses and builds the channels sharing a name prefix, e.g. user:{ajaib_id}:{type}
+type Family struct {
+	// Prefix selects the family by the first segment of a channel name, including its colon, e.g. "system:"
+	Prefix string
+
+	// Parse validates a channel name of the family and returns its info; ParseChannel sets Name and Prefix.
+	// Channels belonging to a user set AjaibID, so only that user may subscribe. Channels without one may
+	// be subscribed by any client the channel policies allow.
+	Parse func(name string) (*ChannelInfo, error)
+
+	// Build returns the channel name of a parsed channel, the inverse of Parse
+	Build func(info *ChannelInfo) string
+
+	// Type returns the channel type labelling a channel of the family in metrics. Families without one are
+	// labelled by their prefix, e.g. "rate".
+	Type func(name string) string
+
+	// Public families carry no user data: any connected client may subscribe, and subscriptions attach the
+	// latest publication to their acknowledgment
+	Public bool
+
+	// Scope is the token scope required to subscribe to the channels of an internal family, enforced by the
+	// built-in channel policies
+	Scope string
+}
+
+var (
+	// families holds the registered channel families by prefix
+	families   = map[string]Family{}
+	familiesMu sync.RWMutex
+)
+
+// The built-in families are registered like those added by features
+func init() {
+	RegisterFamily(Family{Prefix: PrefixUser, Parse: parseUserChannel, Build: buildUserChannel, Type: userChannelType})
+	RegisterFamily(Family{Prefix: PrefixRate, Parse: parseRateChannel, Build: buildRateChannel, Public: true})
+	RegisterFamily(Family{Prefix: PrefixStatus, Parse: parseStatusChannel, Build: buildStatusChannel, Public: true})
+	RegisterFamily(Family{Prefix: PrefixPresence, Parse: parsePresenceChannel, Build: buildPresenceChannel, Scope: ScopePresence})
+}
+
+// RegisterFamily makes the channels of a family parseable and, subject to the channel policies, subscribable,
+// e.g. a system: family added by a feature. It must be called before the channel policies are built, and
+// panics on a malformed prefix, a missing parser or builder, a public family requiring a scope, or a prefix
+// already registered or reserved by the raw and projected variants.
+func RegisterFamily(f Family) {
+	name := strings.TrimSuffix(f.Prefix, ":")
+	if name == "" || name+":" != f.Prefix || strings.Contains(name, ":") || !ValidName(f.Prefix) {
+		panic(fmt.Sprintf("channel family prefix %q must be one segment ending in a colon", f.Prefix))
+	}
+	if f.Parse == nil || f.Build == nil {
+		panic(fmt.Sprintf("channel family %q requires a parser and a builder", f.Prefix))
+	}
+	if f.Public && f.Scope != "" {
+		panic(fmt.Sprintf("public channel family %q cannot require a scope", f.Prefix))
+	}
+	if f.Prefix == PrefixRaw || f.Prefix == PrefixFields {
+		panic(fmt.Sprintf("channel family prefix %q is reserved for channel variants", f.Prefix))
+	}
+
+	familiesMu.Lock()
+	defer familiesMu.Unlock()
+	if _, ok := families[f.Prefix]; ok {
+		panic(fmt.Sprintf("channel family %q is already registered", f.Prefix))
+	}
+	families[f.Prefix] = f
+}
+
+// familyOf returns the family registered for the prefix of a channel name
+func familyOf(name string) (Family, bool) {
+	prefix, _, ok := strings.Cut(name, ":")
+	if !ok {
+		return Family{}, false
+	}
+	familiesMu.RLock()
+	defer familiesMu.RUnlock()
+	f, ok := families[prefix+":"]
+	return f, ok
+}
+
+// parsedFamily returns the family of a channel name its parser accepts
+func parsedFamily(name string) (Family, bool) {
+	f, ok := familyOf(name)
+	if !ok {
+		return Family{}, false
+	}
+	if _, err := f.Parse(name); err != nil {
+		return Family{}, false
+	}
+	return f, true
+}
+
+// FamilyScopes returns the token scope required by each internal family, by prefix
+func FamilyScopes() map[string]string {
+	familiesMu.RLock()
+	defer familiesMu.RUnlock()
+	scopes := make(map[string]string)
+	for prefix, f := range families {
+		if f.Scope != "" {
+			scopes[prefix] = f.Scope
+		}
+	}
+	return scopes
+}
+
+// IsRegistered reports whether the channel belongs to a family other than the user family. Such channels
+// are published by the server or the feature registering them, not routed from Kafka.
+func IsRegistered(name string) bool {
+	f, ok := familyOf(name)
+	return ok && f.Prefix != PrefixUser
+}
+
+// IsPublic reports whether the channel is a valid channel of a public family
+func IsPublic(channel string) bool {
+	f, ok := parsedFamily(channel)
+	return ok && f.Public
+}
+
+// IsInternal reports whether the channel is a valid channel of a family requiring a scope
+func IsInternal(channel string) bool {
+	_, ok := InternalScope(channel)
+	return ok
+}
+
+// InternalScope returns the scope required to subscribe to an internal channel, or false for other channels
+func InternalScope(channel string) (string, bool) {
+	f, ok := parsedFamily(channel)
+	if !ok || f.Scope == "" {
+		return "", false
+	}
+	return f.Scope, true
+}
+
+// ChannelType returns the channel type of a channel name or its raw or projected variant, as labelled by
+// its family (e.g. margin for user channels, rate for rate channels), or empty if no family is registered
+func ChannelType(channel string) string {
+	channel = trimVariant(channel)
+	f, ok := familyOf(channel)
+	if !ok {
+		return ""
+	}
+	if f.Type != nil {
+		return f.Type(channel)
+	}
+	return strings.TrimSuffix(f.Prefix, ":")
+}
+
+// ParseChannel parses and validates a channel name with the family registered for its prefix
+func ParseChannel(channel string) (*ChannelInfo, error) {
+	f, ok := familyOf(channel)
+	if !ok {
+		return nil, ErrUnknownChannelType
+	}
+
+	info, err := f.Parse(channel)
+	if err != nil {
+		return nil, err
+	}
+	info.Name = channel
+	info.Prefix = f.Prefix
+	return info, nil
+}
+
+// BuildChannel returns the channel name of a parsed channel with the family registered for its prefix
+func BuildChannel(info *ChannelInfo) (string, error) {
+	familiesMu.RLock()
+	f, ok := families[info.Prefix]
+	familiesMu.RUnlock()
+	if !ok {
+		return "", ErrUnknownChannelType
+	}
+	return f.Build(info), nil
+}
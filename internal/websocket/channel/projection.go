@@ -0,0 +1,78 @@
+package channel
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PrefixFields prefixes the projected variant of a user channel, e.g. fields:mark_price.unrealised_pnl:user:{ajaib_id}:position
+const PrefixFields = "fields:"
+
+// MaxProjectionFields bounds the fields of a projection
+const MaxProjectionFields = 16
+
+// projectionSeparator separates the fields of a projection spec
+const projectionSeparator = "."
+
+// ErrInvalidProjection rejects a projected channel whose fields are malformed, unsorted or repeated
+var ErrInvalidProjection = errors.New("invalid field projection")
+
+// Field name pattern: the top-level JSON keys of margin and position payloads
+var fieldPattern = regexp.MustCompile(`^[a-z0-9_]{1,64}$`)
+
+// ProjectionSpec returns the canonical spec of a field projection: its sorted unique fields joined by ".".
+// Canonical specs let clients asking for the same fields share one projected channel.
+func ProjectionSpec(fields []string) (string, error) {
+	fields = slices.Compact(slices.Sorted(slices.Values(fields)))
+	if len(fields) == 0 || len(fields) > MaxProjectionFields {
+		return "", ErrInvalidProjection
+	}
+	for _, field := range fields {
+		if !fieldPattern.MatchString(field) {
+			return "", ErrInvalidProjection
+		}
+	}
+	return strings.Join(fields, projectionSeparator), nil
+}
+
+// ProjectionFields returns the fields of a canonical projection spec
+func ProjectionFields(spec string) []string {
+	return strings.Split(spec, projectionSeparator)
+}
+
+// ProjectedChannel builds the variant of a user channel carrying only the fields of a canonical spec
+func ProjectedChannel(spec, ch string) string {
+	return PrefixFields + spec + ":" + ch
+}
+
+// IsProjected reports whether the channel is the projected variant of a user channel
+func IsProjected(channel string) bool {
+	return strings.HasPrefix(channel, PrefixFields)
+}
+
+// ParseProjected splits a projected channel into its canonical spec and underlying channel
+func ParseProjected(channel string) (string, string, error) {
+	if !IsProjected(channel) {
+		return "", "", ErrInvalidChannelFormat
+	}
+	spec, ch, ok := strings.Cut(strings.TrimPrefix(channel, PrefixFields), ":")
+	if !ok {
+		return "", "", ErrInvalidChannelFormat
+	}
+	canonical, err := ProjectionSpec(ProjectionFields(spec))
+	if err != nil || canonical != spec {
+		return "", "", ErrInvalidProjection
+	}
+	return spec, ch, nil
+}
+
+// trimVariant returns the underlying channel of a raw or projected variant
+func trimVariant(channel string) string {
+	if IsProjected(channel) {
+		_, ch, _ := strings.Cut(strings.TrimPrefix(channel, PrefixFields), ":")
+		return ch
+	}
+	return strings.TrimPrefix(channel, PrefixRaw)
+}
@@ -0,0 +1,38 @@
+package channel
+
+import (
+	"regexp"
+	"strings"
+)
+
+// RateUSDTIDR is the public channel pushing the USDT/IDR exchange rate used for conversion
+const RateUSDTIDR = PrefixRate + "USDT:IDR"
+
+// ratePairs holds the currency pairs whose rate is published, as {base}:{quote}
+var ratePairs = map[string]bool{
+	"USDT:IDR": true,
+}
+
+// Currency validation pattern for rate pairs (e.g. USDT, IDR)
+var currencyPattern = regexp.MustCompile(`^[A-Z]{2,10}$`)
+
+// parseRateChannel parses and validates a rate channel name of the rate family
+func parseRateChannel(channel string) (*ChannelInfo, error) {
+	// Format: rate:{base}:{quote}
+	pair := strings.TrimPrefix(channel, PrefixRate)
+	base, quote, ok := strings.Cut(pair, ":")
+	if !ok || !currencyPattern.MatchString(base) || !currencyPattern.MatchString(quote) {
+		return nil, ErrInvalidChannelFormat
+	}
+
+	if !ratePairs[pair] {
+		return nil, ErrUnknownChannelType
+	}
+
+	return &ChannelInfo{ChannelSub: pair}, nil
+}
+
+// buildRateChannel builds the name of a rate channel
+func buildRateChannel(info *ChannelInfo) string {
+	return PrefixRate + info.ChannelSub
+}
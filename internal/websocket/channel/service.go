@@ -0,0 +1,64 @@
+package channel
+
+import (
+	"regexp"
+	"strings"
+)
+
+// StatusFutures is the public channel announcing when delivery is degraded by an overload and when it recovers
+const StatusFutures = PrefixStatus + "futures"
+
+// PresenceFutures is the internal channel publishing users joining and leaving, for support tooling
+const PresenceFutures = PrefixPresence + "futures"
+
+// ScopePresence is the token scope required to subscribe to the presence channels
+const ScopePresence = "internal:presence"
+
+// Services with status channels
+var statusServices = map[string]bool{
+	"futures": true,
+}
+
+// Services with presence channels
+var presenceServices = map[string]bool{
+	"futures": true,
+}
+
+// Service validation pattern for status and presence channels (e.g. futures)
+var servicePattern = regexp.MustCompile(`^[a-z]{1,32}$`)
+
+// parseServiceChannel parses a {prefix}{service} channel name, accepting the given services only
+func parseServiceChannel(channel, prefix string, services map[string]bool) (*ChannelInfo, error) {
+	service := strings.TrimPrefix(channel, prefix)
+	if !servicePattern.MatchString(service) {
+		return nil, ErrInvalidChannelFormat
+	}
+
+	if !services[service] {
+		return nil, ErrUnknownChannelType
+	}
+
+	return &ChannelInfo{ChannelSub: service}, nil
+}
+
+// parseStatusChannel parses and validates a status channel name of the status family
+func parseStatusChannel(channel string) (*ChannelInfo, error) {
+	// Format: status:{service}
+	return parseServiceChannel(channel, PrefixStatus, statusServices)
+}
+
+// buildStatusChannel builds the name of a status channel
+func buildStatusChannel(info *ChannelInfo) string {
+	return PrefixStatus + info.ChannelSub
+}
+
+// parsePresenceChannel parses and validates a presence channel name of the presence family
+func parsePresenceChannel(channel string) (*ChannelInfo, error) {
+	// Format: presence:{service}
+	return parseServiceChannel(channel, PrefixPresence, presenceServices)
+}
+
+// buildPresenceChannel builds the name of a presence channel
+func buildPresenceChannel(info *ChannelInfo) string {
+	return PrefixPresence + info.ChannelSub
+}
@@ -3,48 +3,131 @@ package channel
 import (
 	"regexp"
 	"strings"
+	"sync"
 )
 
 // Channel prefixes
 const (
-	PrefixUser = "user:"
+	PrefixUser     = "user:"
+	PrefixRate     = "rate:"
+	PrefixPresence = "presence:"
+	PrefixRaw      = "raw:"
+	PrefixStatus   = "status:"
 )
 
-// Valid user channel types
-var ValidUserChannels = map[string]bool{
-	"margin":   true,
-	"position": true,
+// MaxLength bounds channel names accepted from clients
+const MaxLength = 255
+
+// ScopeRaw is the token scope required to subscribe to raw channel variants
+const ScopeRaw = "internal:raw"
+
+// ScopeImpersonate is the token scope required to read another user's channels with the impersonate claim
+const ScopeImpersonate = "internal:impersonate"
+
+var (
+	// userChannels holds the valid user channel types
+	userChannels = map[string]bool{
+		"margin":   true,
+		"position": true,
+	}
+	userChannelsMu sync.RWMutex
+)
+
+// RegisterUserChannel makes a user channel type subscribable, e.g. one published by a Kafka route added in
+// main. It must be called before the server accepts connections.
+func RegisterUserChannel(channelSub string) {
+	userChannelsMu.Lock()
+	defer userChannelsMu.Unlock()
+	userChannels[channelSub] = true
+}
+
+// ValidUserChannel reports whether the user channel type is subscribable
+func ValidUserChannel(channelSub string) bool {
+	userChannelsMu.RLock()
+	defer userChannelsMu.RUnlock()
+	return userChannels[channelSub]
 }
 
+// Channel name pattern: the characters any channel name may contain
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9:_.\-]+$`)
+
 // Ajaib ID validation pattern
 var ajaibIDPattern = regexp.MustCompile(`^[0-9]{1,10}$`)
 
+// Instrument validation pattern for sub-channels (position symbol or margin asset, e.g. BTCUSDT, USDT)
+var instrumentPattern = regexp.MustCompile(`^[A-Z0-9]{1,20}$`)
+
 // ChannelInfo contains parsed information about a channel
 type ChannelInfo struct {
-	Name       string
-	Prefix     string
-	UserID     string
-	AjaibID    string
+	Name    string
+	Prefix  string
+	UserID  string
+	AjaibID string
+	// ChannelSub is the channel type of a user channel, or the name of a channel within other families
+	// (e.g. futures for status:futures)
 	ChannelSub string
+	// Instrument is the position symbol or margin asset of a sub-channel, empty for the full stream
+	Instrument string
 }
 
-func ParseChannel(channel string) (*ChannelInfo, error) {
-	info := &ChannelInfo{
-		Name: channel,
-	}
+// UserChannel builds the channel name for a user's full stream, e.g. user:{ajaib_id}:margin
+func UserChannel(ajaibID, channelSub string) string {
+	return PrefixUser + ajaibID + ":" + channelSub
+}
 
-	if !strings.HasPrefix(channel, PrefixUser) {
-		return nil, ErrUnknownChannelType
+// UserSubChannel builds the channel name for a single instrument, e.g. user:{ajaib_id}:position:{symbol}
+func UserSubChannel(ajaibID, channelSub, instrument string) string {
+	return SubChannel(UserChannel(ajaibID, channelSub), instrument)
+}
+
+// SubChannel builds the sub-channel of a user channel or its projected variant for a single instrument
+func SubChannel(ch, instrument string) string {
+	return ch + ":" + instrument
+}
+
+// RawChannel builds the untransformed variant of a user channel, e.g. raw:user:{ajaib_id}:margin
+func RawChannel(ch string) string {
+	return PrefixRaw + ch
+}
+
+// IsRaw reports whether the channel is the untransformed variant of a user channel
+func IsRaw(channel string) bool {
+	return strings.HasPrefix(channel, PrefixRaw)
+}
+
+// ValidName reports whether a client-supplied channel name is well formed: non-empty, at most MaxLength
+// bytes and limited to letters, digits and ":_.-". A well-formed name may still be an unknown channel.
+func ValidName(name string) bool {
+	return len(name) <= MaxLength && namePattern.MatchString(name)
+}
+
+// userChannelType returns the channel type of a user channel or sub-channel name (e.g. margin), or empty if
+// there is none
+func userChannelType(channel string) string {
+	parts := strings.Split(strings.TrimPrefix(channel, PrefixUser), ":")
+	if len(parts) < 2 {
+		return ""
 	}
+	return parts[1]
+}
 
-	info.Prefix = PrefixUser
+// parseUserChannel parses and validates a user channel name of the user family
+func parseUserChannel(channel string) (*ChannelInfo, error) {
+	info := &ChannelInfo{}
 
-	// Format: user:{user_id}:{channel_type}
+	// Format: user:{user_id}:{channel_type}[:{instrument}]
 	parts := strings.Split(strings.TrimPrefix(channel, PrefixUser), ":")
-	if len(parts) != 2 {
+	if len(parts) != 2 && len(parts) != 3 {
 		return nil, ErrInvalidChannelFormat
 	}
 
+	if len(parts) == 3 {
+		if !instrumentPattern.MatchString(parts[2]) {
+			return nil, ErrInvalidChannelFormat
+		}
+		info.Instrument = parts[2]
+	}
+
 	ajaibID := parts[0]
 	channelSub := parts[1]
 
@@ -60,7 +143,7 @@ func ParseChannel(channel string) (*ChannelInfo, error) {
 		return nil, ErrInvalidCFXUserID
 	}
 
-	if !ValidUserChannels[channelSub] {
+	if !ValidUserChannel(channelSub) {
 		return nil, ErrUnknownChannelType
 	}
 
@@ -70,6 +153,14 @@ func ParseChannel(channel string) (*ChannelInfo, error) {
 	return info, nil
 }
 
+// buildUserChannel builds the name of a user channel or sub-channel
+func buildUserChannel(info *ChannelInfo) string {
+	if info.Instrument != "" {
+		return UserSubChannel(info.AjaibID, info.ChannelSub, info.Instrument)
+	}
+	return UserChannel(info.AjaibID, info.ChannelSub)
+}
+
 // isValidAjaibID validates Ajaib ID
 func isValidAjaibID(userID string) bool {
 	return ajaibIDPattern.MatchString(userID)
@@ -1,6 +1,8 @@
 package channel
 
 import (
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -149,13 +151,13 @@ func TestParseChannelInvalid(t *testing.T) {
 	}
 }
 
-// TestValidUserChannels tests the ValidUserChannels map
+// TestValidUserChannels tests the valid user channel types
 func TestValidUserChannels(t *testing.T) {
-	assert.True(t, ValidUserChannels["margin"], "margin should be a valid channel type")
-	assert.True(t, ValidUserChannels["position"], "position should be a valid channel type")
-	assert.False(t, ValidUserChannels["orders"], "orders should not be a valid channel type")
-	assert.False(t, ValidUserChannels[""], "empty string should not be a valid channel type")
-	assert.False(t, ValidUserChannels["MARGIN"], "MARGIN (uppercase) should not be valid")
+	assert.True(t, ValidUserChannel("margin"), "margin should be a valid channel type")
+	assert.True(t, ValidUserChannel("position"), "position should be a valid channel type")
+	assert.False(t, ValidUserChannel("orders"), "orders should not be a valid channel type")
+	assert.False(t, ValidUserChannel(""), "empty string should not be a valid channel type")
+	assert.False(t, ValidUserChannel("MARGIN"), "MARGIN (uppercase) should not be valid")
 }
 
 // TestChannelPrefixes tests the channel prefix constants
@@ -299,3 +301,316 @@ func BenchmarkIsValidAjaibID(b *testing.B) {
 		isValidAjaibID(ajaibID)
 	}
 }
+
+// TestParseSubChannel tests parsing per-instrument sub-channels
+func TestParseSubChannel(t *testing.T) {
+	info, err := ParseChannel("user:130010505:position:BTCUSDT")
+	require.NoError(t, err)
+	assert.Equal(t, "130010505", info.AjaibID)
+	assert.Equal(t, "position", info.ChannelSub)
+	assert.Equal(t, "BTCUSDT", info.Instrument)
+
+	info, err = ParseChannel("user:130010505:margin:USDT")
+	require.NoError(t, err)
+	assert.Equal(t, "margin", info.ChannelSub)
+	assert.Equal(t, "USDT", info.Instrument)
+
+	info, err = ParseChannel("user:130010505:margin")
+	require.NoError(t, err)
+	assert.Equal(t, "", info.Instrument)
+
+	invalid := []string{
+		"user:130010505:position:btcusdt",
+		"user:130010505:position:",
+		"user:130010505:position:BTC-USDT",
+		"user:130010505:position:BTCUSDT:extra",
+	}
+	for _, ch := range invalid {
+		_, err := ParseChannel(ch)
+		assert.ErrorIs(t, err, ErrInvalidChannelFormat, ch)
+	}
+
+	_, err = ParseChannel("user:130010505:orders:BTCUSDT")
+	assert.ErrorIs(t, err, ErrUnknownChannelType)
+}
+
+// TestChannelBuilders tests building channel names
+func TestChannelBuilders(t *testing.T) {
+	assert.Equal(t, "user:130010505:margin", UserChannel("130010505", "margin"))
+	assert.Equal(t, "user:130010505:position:BTCUSDT", UserSubChannel("130010505", "position", "BTCUSDT"))
+}
+
+// TestRateFamily tests parsing, building and recognizing rate channels
+func TestRateFamily(t *testing.T) {
+	assert.Equal(t, "rate:USDT:IDR", RateUSDTIDR)
+
+	info, err := ParseChannel(RateUSDTIDR)
+	require.NoError(t, err)
+	assert.Equal(t, &ChannelInfo{Name: RateUSDTIDR, Prefix: PrefixRate, ChannelSub: "USDT:IDR"}, info)
+	name, err := BuildChannel(info)
+	require.NoError(t, err)
+	assert.Equal(t, RateUSDTIDR, name)
+
+	assert.True(t, IsPublic(RateUSDTIDR))
+	assert.False(t, IsInternal(RateUSDTIDR))
+	assert.True(t, IsRegistered(RateUSDTIDR))
+	assert.Equal(t, "rate", ChannelType(RateUSDTIDR))
+	assert.Equal(t, "rate", ChannelType(RawChannel(RateUSDTIDR)))
+
+	tests := []struct {
+		channel     string
+		expectedErr error
+	}{
+		{"rate:USDT:EUR", ErrUnknownChannelType},
+		{"rate:IDR:USDT", ErrUnknownChannelType},
+		{"rate:USDT", ErrInvalidChannelFormat},
+		{"rate:usdt:idr", ErrInvalidChannelFormat},
+		{"rate:USDT:IDR:extra", ErrInvalidChannelFormat},
+		{"rate::IDR", ErrInvalidChannelFormat},
+		{"rate:", ErrInvalidChannelFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.channel, func(t *testing.T) {
+			_, err := ParseChannel(tt.channel)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.False(t, IsPublic(tt.channel))
+		})
+	}
+}
+
+// TestStatusFamily tests parsing, building and recognizing status channels
+func TestStatusFamily(t *testing.T) {
+	info, err := ParseChannel(StatusFutures)
+	require.NoError(t, err)
+	assert.Equal(t, &ChannelInfo{Name: StatusFutures, Prefix: PrefixStatus, ChannelSub: "futures"}, info)
+	name, err := BuildChannel(info)
+	require.NoError(t, err)
+	assert.Equal(t, StatusFutures, name)
+
+	assert.True(t, IsPublic(StatusFutures))
+	assert.False(t, IsInternal(StatusFutures))
+	assert.True(t, IsRegistered(StatusFutures))
+	assert.Equal(t, "status", ChannelType(StatusFutures))
+
+	_, err = ParseChannel("status:spot")
+	assert.ErrorIs(t, err, ErrUnknownChannelType)
+	_, err = ParseChannel("status:Futures")
+	assert.ErrorIs(t, err, ErrInvalidChannelFormat)
+	_, err = ParseChannel("status:futures:extra")
+	assert.ErrorIs(t, err, ErrInvalidChannelFormat)
+	assert.False(t, IsPublic("status:spot"))
+}
+
+// TestPresenceFamily tests parsing, building and recognizing presence channels and their scope
+func TestPresenceFamily(t *testing.T) {
+	info, err := ParseChannel(PresenceFutures)
+	require.NoError(t, err)
+	assert.Equal(t, &ChannelInfo{Name: PresenceFutures, Prefix: PrefixPresence, ChannelSub: "futures"}, info)
+	name, err := BuildChannel(info)
+	require.NoError(t, err)
+	assert.Equal(t, PresenceFutures, name)
+
+	scope, ok := InternalScope(PresenceFutures)
+	assert.True(t, ok)
+	assert.Equal(t, ScopePresence, scope)
+	assert.Equal(t, map[string]string{PrefixPresence: ScopePresence}, FamilyScopes())
+
+	_, ok = InternalScope("presence:spot")
+	assert.False(t, ok)
+	_, ok = InternalScope(RateUSDTIDR)
+	assert.False(t, ok)
+
+	assert.True(t, IsInternal(PresenceFutures))
+	assert.False(t, IsPublic(PresenceFutures))
+	assert.True(t, IsRegistered(PresenceFutures))
+	assert.Equal(t, "presence", ChannelType(PresenceFutures))
+	assert.True(t, ValidName(PresenceFutures))
+
+	_, err = ParseChannel("presence:spot")
+	assert.ErrorIs(t, err, ErrUnknownChannelType)
+	_, err = ParseChannel("presence:futures:extra")
+	assert.ErrorIs(t, err, ErrInvalidChannelFormat)
+}
+
+// TestRawChannels tests building and recognizing raw channel variants
+func TestRawChannels(t *testing.T) {
+	raw := RawChannel("user:12345:margin")
+	assert.Equal(t, "raw:user:12345:margin", raw)
+	assert.True(t, IsRaw(raw))
+	assert.False(t, IsRaw("user:12345:margin"))
+	assert.True(t, ValidName(raw))
+	assert.Equal(t, "margin", ChannelType(raw))
+	assert.Equal(t, "position", ChannelType(RawChannel("user:12345:position")))
+
+	_, err := ParseChannel(raw)
+	assert.ErrorIs(t, err, ErrUnknownChannelType)
+}
+
+// TestProjectedChannels tests building and parsing projected channel variants
+func TestProjectedChannels(t *testing.T) {
+	spec, err := ProjectionSpec([]string{"unrealised_pnl", "mark_price", "unrealised_pnl"})
+	require.NoError(t, err)
+	assert.Equal(t, "mark_price.unrealised_pnl", spec)
+	assert.Equal(t, []string{"mark_price", "unrealised_pnl"}, ProjectionFields(spec))
+
+	for _, fields := range [][]string{nil, {""}, {"Mark_Price"}, {"mark.price"}, make([]string, MaxProjectionFields+1)} {
+		_, err := ProjectionSpec(fields)
+		assert.ErrorIs(t, err, ErrInvalidProjection, fields)
+	}
+
+	projected := ProjectedChannel(spec, "user:12345:position")
+	assert.Equal(t, "fields:mark_price.unrealised_pnl:user:12345:position", projected)
+	assert.True(t, IsProjected(projected))
+	assert.False(t, IsProjected("user:12345:position"))
+	assert.True(t, ValidName(projected))
+	assert.Equal(t, "position", ChannelType(projected))
+	assert.Equal(t, "position", ChannelType(SubChannel(projected, "BTCUSDT")))
+
+	gotSpec, base, err := ParseProjected(projected)
+	require.NoError(t, err)
+	assert.Equal(t, spec, gotSpec)
+	assert.Equal(t, "user:12345:position", base)
+
+	// Specs must be canonical so the same fields share one channel
+	_, _, err = ParseProjected("fields:unrealised_pnl.mark_price:user:12345:position")
+	assert.ErrorIs(t, err, ErrInvalidProjection)
+	_, _, err = ParseProjected("fields:mark_price")
+	assert.ErrorIs(t, err, ErrInvalidChannelFormat)
+}
+
+// TestValidName tests the length and charset checks of client-supplied channel names
+func TestValidName(t *testing.T) {
+	assert.True(t, ValidName("user:130010505:margin"))
+	assert.True(t, ValidName(RateUSDTIDR))
+	assert.True(t, ValidName("user:abc:orders"))
+
+	assert.False(t, ValidName(""))
+	assert.False(t, ValidName("user:1 2:margin"))
+	assert.False(t, ValidName("user:12345:margin\n"))
+	assert.False(t, ValidName("user:12345:märgin"))
+	assert.False(t, ValidName("user:12345:"+strings.Repeat("a", MaxLength)))
+}
+
+// FuzzParseChannel checks that the parser never panics and only accepts names it can rebuild
+func FuzzParseChannel(f *testing.F) {
+	for _, seed := range []string{
+		"user:130010505:margin",
+		"user:130010505:position:BTCUSDT",
+		"user::margin",
+		"user:12345:margin:",
+		"rate:USDT:IDR",
+		"status:futures",
+		"presence:futures",
+		"user:12345:margin:btc:extra",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		info, err := ParseChannel(name)
+		if err != nil {
+			return
+		}
+
+		require.True(t, ValidName(name), "accepted channel %q is not a valid name", name)
+		rebuilt, err := BuildChannel(info)
+		require.NoError(t, err)
+		assert.Equal(t, name, rebuilt)
+	})
+}
+
+// TestChannelFamilies tests parsing and building channels of the user family and of a registered family
+func TestChannelFamilies(t *testing.T) {
+	info, err := ParseChannel("user:12345:position:BTCUSDT")
+	require.NoError(t, err)
+	name, err := BuildChannel(info)
+	require.NoError(t, err)
+	assert.Equal(t, "user:12345:position:BTCUSDT", name)
+	assert.False(t, IsRegistered("user:12345:margin"))
+
+	RegisterFamily(Family{
+		Prefix: "system:",
+		Parse: func(name string) (*ChannelInfo, error) {
+			topic := strings.TrimPrefix(name, "system:")
+			if topic != "maintenance" {
+				return nil, ErrInvalidChannelFormat
+			}
+			return &ChannelInfo{ChannelSub: topic}, nil
+		},
+		Build: func(info *ChannelInfo) string {
+			return "system:" + info.ChannelSub
+		},
+	})
+	defer func() {
+		familiesMu.Lock()
+		delete(families, "system:")
+		familiesMu.Unlock()
+	}()
+
+	info, err = ParseChannel("system:maintenance")
+	require.NoError(t, err)
+	assert.Equal(t, &ChannelInfo{Name: "system:maintenance", Prefix: "system:", ChannelSub: "maintenance"}, info)
+	name, err = BuildChannel(info)
+	require.NoError(t, err)
+	assert.Equal(t, "system:maintenance", name)
+	assert.True(t, IsRegistered("system:maintenance"))
+	assert.False(t, IsPublic("system:maintenance"))
+	assert.False(t, IsInternal("system:maintenance"))
+	assert.Equal(t, "system", ChannelType("system:maintenance"))
+
+	_, err = ParseChannel("system:other")
+	assert.ErrorIs(t, err, ErrInvalidChannelFormat)
+	_, err = ParseChannel("unknown:maintenance")
+	assert.ErrorIs(t, err, ErrUnknownChannelType)
+	_, err = BuildChannel(&ChannelInfo{Prefix: "unknown:"})
+	assert.ErrorIs(t, err, ErrUnknownChannelType)
+
+	parse := func(string) (*ChannelInfo, error) { return &ChannelInfo{}, nil }
+	build := func(*ChannelInfo) string { return "" }
+	assert.Panics(t, func() { RegisterFamily(Family{Prefix: "system", Parse: parse, Build: build}) }, "missing colon")
+	assert.Panics(t, func() { RegisterFamily(Family{Prefix: "a:b:", Parse: parse, Build: build}) }, "two segments")
+	assert.Panics(t, func() { RegisterFamily(Family{Prefix: "alerts:", Build: build}) }, "no parser")
+	assert.Panics(t, func() {
+		RegisterFamily(Family{Prefix: "alerts:", Parse: parse, Build: build, Public: true, Scope: "internal:alerts"})
+	}, "public with a scope")
+	assert.Panics(t, func() { RegisterFamily(Family{Prefix: PrefixRaw, Parse: parse, Build: build}) }, "reserved")
+	assert.Panics(t, func() { RegisterFamily(Family{Prefix: PrefixUser, Parse: parse, Build: build}) }, "duplicate")
+	assert.Panics(t, func() { RegisterFamily(Family{Prefix: PrefixRate, Parse: parse, Build: build}) }, "duplicate built-in")
+}
+
+// TestRegistryConcurrency tests registering user channel types and families while channels are parsed
+func TestRegistryConcurrency(t *testing.T) {
+	defer func() {
+		userChannelsMu.Lock()
+		delete(userChannels, "orders")
+		userChannelsMu.Unlock()
+		familiesMu.Lock()
+		delete(families, "alerts:")
+		familiesMu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		RegisterUserChannel("orders")
+		RegisterFamily(Family{
+			Prefix: "alerts:",
+			Parse:  func(string) (*ChannelInfo, error) { return &ChannelInfo{}, nil },
+			Build:  func(*ChannelInfo) string { return "alerts:" },
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		for range 100 {
+			_, _ = ParseChannel("user:12345:orders")
+			_, _ = ParseChannel("alerts:maintenance")
+			_ = FamilyScopes()
+		}
+	}()
+	wg.Wait()
+
+	_, err := ParseChannel("user:12345:orders")
+	assert.NoError(t, err)
+	assert.True(t, IsRegistered("alerts:maintenance"))
+}
@@ -0,0 +1,56 @@
+package policy
+
+import (
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Stages at which publications past their TTL are dropped, as counted by ExpiryMetrics
+const (
+	// StageConflation drops a conflated publication held back by the channel's rate for longer than its TTL
+	StageConflation = "conflation"
+
+	// StageSnapshot skips a channel's latest publication when serving a snapshot
+	StageSnapshot = "snapshot"
+)
+
+// TagExpiresAt is the publication tag carrying the Unix time in milliseconds after which the publication
+// is stale, so clients can drop it when it is delivered late from their queue
+const TagExpiresAt = "expires_at"
+
+// ExpiryMetrics counts the publications dropped for being past their TTL
+type ExpiryMetrics struct {
+	expiredTotal *prometheus.CounterVec
+}
+
+// NewExpiryMetrics creates a new ExpiryMetrics instance with Prometheus collectors
+func NewExpiryMetrics() *ExpiryMetrics {
+	return &ExpiryMetrics{
+		expiredTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "publications_expired_total",
+				Help: "Total number of publications dropped past the TTL of their channel policy by channel type and stage",
+			},
+			[]string{"channel_type", "stage"},
+		),
+	}
+}
+
+// Register registers all metrics with the default Prometheus registry
+func (m *ExpiryMetrics) Register() error {
+	prometheus.DefaultRegisterer.MustRegister(m.expiredTotal)
+	return nil
+}
+
+// Record counts a publication to ch dropped at stage; nil metrics record nothing
+func (m *ExpiryMetrics) Record(ch, stage string) {
+	if m == nil {
+		return
+	}
+	channelType := channel.ChannelType(ch)
+	if channelType == "" {
+		channelType = "other"
+	}
+	m.expiredTotal.WithLabelValues(channelType, stage).Inc()
+}
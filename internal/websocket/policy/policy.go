@@ -0,0 +1,273 @@
+package policy
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/channel"
+)
+
+// Pattern wildcards: "*" matches a single channel name segment, a trailing "**" one or more segments
+const (
+	wildcardSegment = "*"
+	wildcardRest    = "**"
+)
+
+// Policy gates access to and delivery on the channels matching its pattern.
+// Zero fields leave the corresponding aspect unrestricted.
+type Policy struct {
+	// Pattern matches channel names segment by segment, e.g. user:*:position:* or raw:**
+	Pattern string
+
+	// Scopes must all be granted to the connection token
+	Scopes []string
+
+	// ClientTypes lists the connection profiles (e.g. default, firehose) allowed to subscribe
+	ClientTypes []string
+
+	// ExemptClientTypes lifts MaxRate and its conflation from the channels of users connected with one of
+	// these connection profiles, e.g. a premium low-latency lane; OverloadRate still applies
+	ExemptClientTypes []string
+
+	// MaxRate caps the publications per second delivered to each matching channel
+	MaxRate float64
+
+	// Conflate delivers the latest publication held back by MaxRate once the channel may publish again,
+	// instead of dropping it
+	Conflate bool
+
+	// TTL drops publications to matching channels older than it instead of delivering them late
+	TTL time.Duration
+
+	// OverloadRate conflates matching channels to the latest publication at this rate while the set is
+	// degraded by an overload, however fast MaxRate allows
+	OverloadRate float64
+
+	segments []string
+}
+
+// ScopeError rejects a subscription whose token lacks a scope required by a policy
+type ScopeError struct {
+	Scope string
+}
+
+func (e *ScopeError) Error() string {
+	return "channel requires the " + e.Scope + " scope"
+}
+
+// ClientTypeError rejects a subscription from a client type no policy of the channel allows
+type ClientTypeError struct {
+	ClientType string
+}
+
+func (e *ClientTypeError) Error() string {
+	return "channel is not available to " + e.ClientType + " clients"
+}
+
+// builtin are the policies of internal and raw channels, which always apply
+func builtin() []Policy {
+	policies := []Policy{{Pattern: channel.PrefixRaw + wildcardRest, Scopes: []string{channel.ScopeRaw}}}
+	for prefix, scope := range channel.FamilyScopes() {
+		policies = append(policies, Policy{Pattern: prefix + wildcardRest, Scopes: []string{scope}})
+	}
+	return policies
+}
+
+// validate checks the policy and splits its pattern
+func (p *Policy) validate() error {
+	if p.Pattern == "" {
+		return fmt.Errorf("channel policy requires a pattern")
+	}
+	p.segments = strings.Split(p.Pattern, ":")
+	for i, segment := range p.segments {
+		if segment == "" {
+			return fmt.Errorf("channel policy %q: empty pattern segment", p.Pattern)
+		}
+		if segment == wildcardRest && i != len(p.segments)-1 {
+			return fmt.Errorf("channel policy %q: %s must be the last segment", p.Pattern, wildcardRest)
+		}
+	}
+	if p.MaxRate < 0 {
+		return fmt.Errorf("channel policy %q: max rate must not be negative", p.Pattern)
+	}
+	if p.Conflate && p.MaxRate == 0 {
+		return fmt.Errorf("channel policy %q: conflation requires a max rate", p.Pattern)
+	}
+	if p.OverloadRate < 0 {
+		return fmt.Errorf("channel policy %q: overload rate must not be negative", p.Pattern)
+	}
+	if p.TTL < 0 {
+		return fmt.Errorf("channel policy %q: ttl must not be negative", p.Pattern)
+	}
+	return nil
+}
+
+// splitChannel splits a channel name into the segments patterns match
+func splitChannel(ch string) []string {
+	return strings.Split(ch, ":")
+}
+
+// matches reports whether the split channel name matches the policy pattern
+func (p *Policy) matches(segments []string) bool {
+	for i, want := range p.segments {
+		if want == wildcardRest {
+			return len(segments) > i
+		}
+		if i >= len(segments) || (want != wildcardSegment && want != segments[i]) {
+			return false
+		}
+	}
+	return len(segments) == len(p.segments)
+}
+
+// Set holds the configured channel policies with the built-in ones. Every policy matching a channel
+// applies, so configured policies can only tighten access and delivery.
+type Set struct {
+	policies []Policy
+
+	// limited is set when a policy caps the publication rate, normally or when degraded
+	limited bool
+
+	// expiring is set when a policy has a TTL
+	expiring bool
+
+	// degraded applies the overload rates on top of the max rates
+	degraded atomic.Bool
+}
+
+// NewSet validates the configured policies and adds them to the built-in ones
+func NewSet(configured []Policy) (*Set, error) {
+	s := &Set{}
+	for _, p := range append(builtin(), configured...) {
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+		s.policies = append(s.policies, p)
+		s.limited = s.limited || p.MaxRate > 0 || p.OverloadRate > 0
+		s.expiring = s.expiring || p.TTL > 0
+	}
+	return s, nil
+}
+
+// Builtin returns the set of the built-in policies only
+func Builtin() *Set {
+	s, _ := NewSet(nil)
+	return s
+}
+
+// Authorize checks a subscription to ch against every matching policy
+func (s *Set) Authorize(ch string, hasScope func(scope string) bool, clientType string) error {
+	segments := splitChannel(ch)
+	for i := range s.policies {
+		p := &s.policies[i]
+		if !p.matches(segments) {
+			continue
+		}
+		for _, scope := range p.Scopes {
+			if !hasScope(scope) {
+				return &ScopeError{Scope: scope}
+			}
+		}
+		if len(p.ClientTypes) > 0 && !slices.Contains(p.ClientTypes, clientType) {
+			return &ClientTypeError{ClientType: clientType}
+		}
+	}
+	return nil
+}
+
+// Limited reports whether any policy caps the publication rate, including when degraded
+func (s *Set) Limited() bool {
+	return s.limited
+}
+
+// SetDegraded applies or lifts the overload rates of the policies
+func (s *Set) SetDegraded(degraded bool) {
+	s.degraded.Store(degraded)
+}
+
+// Degraded reports whether the overload rates apply
+func (s *Set) Degraded() bool {
+	return s.degraded.Load()
+}
+
+// Limit returns the lowest publication rate of the policies matching ch, 0 when unlimited, and whether
+// publications held back are conflated. While degraded, overload rates apply and always conflate. A nil set
+// limits nothing.
+func (s *Set) Limit(ch string) (float64, bool) {
+	return s.LimitFor(ch, nil)
+}
+
+// LimitFor is Limit for a channel whose user is connected with the client types connected reports. Policies
+// exempting one of them don't cap the rate; their overload rates still apply. A nil connected exempts nothing.
+func (s *Set) LimitFor(ch string, connected func(clientType string) bool) (float64, bool) {
+	if s == nil || !s.limited {
+		return 0, false
+	}
+
+	var rate float64
+	var conflate bool
+	degraded := s.degraded.Load()
+	segments := splitChannel(ch)
+	for i := range s.policies {
+		p := &s.policies[i]
+		overload := degraded && p.OverloadRate > 0
+		if (p.MaxRate == 0 && !overload) || !p.matches(segments) {
+			continue
+		}
+		if p.MaxRate > 0 && !p.exempts(connected) {
+			rate = lowerRate(rate, p.MaxRate)
+			conflate = conflate || p.Conflate
+		}
+		if overload {
+			rate = lowerRate(rate, p.OverloadRate)
+			conflate = true
+		}
+	}
+	return rate, conflate
+}
+
+// exempts reports whether the policy's max rate is lifted for a user connected with the client types
+// connected reports
+func (p *Policy) exempts(connected func(clientType string) bool) bool {
+	if connected == nil {
+		return false
+	}
+	return slices.ContainsFunc(p.ExemptClientTypes, connected)
+}
+
+// lowerRate returns the lower of two rates, where 0 is unlimited
+func lowerRate(rate, limit float64) float64 {
+	if rate == 0 || limit < rate {
+		return limit
+	}
+	return rate
+}
+
+// TTL returns the shortest TTL of the policies matching ch, 0 when publications never expire
+func (s *Set) TTL(ch string) time.Duration {
+	if !s.expiring {
+		return 0
+	}
+
+	var ttl time.Duration
+	segments := splitChannel(ch)
+	for i := range s.policies {
+		p := &s.policies[i]
+		if p.TTL == 0 || !p.matches(segments) {
+			continue
+		}
+		if ttl == 0 || p.TTL < ttl {
+			ttl = p.TTL
+		}
+	}
+	return ttl
+}
+
+// Expired reports whether a publication to ch made at publishedAt is past its TTL at now
+func (s *Set) Expired(ch string, publishedAt, now time.Time) bool {
+	ttl := s.TTL(ch)
+	return ttl > 0 && now.Sub(publishedAt) >= ttl
+}
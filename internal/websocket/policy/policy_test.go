@@ -0,0 +1,279 @@
+package policy
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scopes returns a scope check granting the given scopes
+func scopes(granted ...string) func(string) bool {
+	return func(scope string) bool { return slices.Contains(granted, scope) }
+}
+
+// TestNewSetValidation tests that invalid policies are rejected
+func TestNewSetValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+	}{
+		{"empty pattern", Policy{}},
+		{"empty segment", Policy{Pattern: "user::margin"}},
+		{"rest wildcard not last", Policy{Pattern: "user:**:margin"}},
+		{"negative rate", Policy{Pattern: "user:*:margin", MaxRate: -1}},
+		{"conflation without rate", Policy{Pattern: "user:*:margin", Conflate: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSet([]Policy{tt.policy})
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NewSet([]Policy{{Pattern: "user:*:position:*", MaxRate: 5, Conflate: true}})
+	assert.NoError(t, err)
+}
+
+// TestPatternMatching tests single-segment and trailing wildcards
+func TestPatternMatching(t *testing.T) {
+	tests := []struct {
+		pattern string
+		channel string
+		want    bool
+	}{
+		{"user:*:margin", "user:12345:margin", true},
+		{"user:*:margin", "user:12345:margin:USDT", false},
+		{"user:*:margin", "user:12345:position", false},
+		{"user:*:position:*", "user:12345:position:BTCUSDT", true},
+		{"user:*:position:*", "user:12345:position", false},
+		{"user:**", "user:12345:position:BTCUSDT", true},
+		{"user:**", "user", false},
+		{"rate:USDT:IDR", "rate:USDT:IDR", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.channel, func(t *testing.T) {
+			p := Policy{Pattern: tt.pattern}
+			require.NoError(t, p.validate())
+			assert.Equal(t, tt.want, p.matches(splitChannel(tt.channel)))
+		})
+	}
+}
+
+// TestAuthorize tests built-in and configured scope and client type requirements
+func TestAuthorize(t *testing.T) {
+	set, err := NewSet([]Policy{
+		{Pattern: "user:*:position:*", Scopes: []string{"futures:sub"}},
+		{Pattern: "user:**", ClientTypes: []string{"default", "firehose"}},
+	})
+	require.NoError(t, err)
+
+	err = set.Authorize(channel.PresenceFutures, scopes(), "default")
+	var scopeErr *ScopeError
+	require.ErrorAs(t, err, &scopeErr)
+	assert.Equal(t, channel.ScopePresence, scopeErr.Scope)
+	assert.NoError(t, set.Authorize(channel.PresenceFutures, scopes(channel.ScopePresence), "default"))
+
+	err = set.Authorize("raw:user:12345:margin", scopes(), "default")
+	require.ErrorAs(t, err, &scopeErr)
+	assert.Equal(t, "channel requires the internal:raw scope", err.Error())
+
+	assert.NoError(t, set.Authorize("user:12345:margin", scopes(), "default"))
+	assert.Error(t, set.Authorize("user:12345:position:BTCUSDT", scopes(), "default"))
+	assert.NoError(t, set.Authorize("user:12345:position:BTCUSDT", scopes("futures:sub"), "firehose"))
+
+	err = set.Authorize("user:12345:margin", scopes(), "partner")
+	var typeErr *ClientTypeError
+	require.ErrorAs(t, err, &typeErr)
+	assert.Equal(t, "partner", typeErr.ClientType)
+
+	assert.NoError(t, Builtin().Authorize(channel.RateUSDTIDR, scopes(), "partner"))
+}
+
+// TestLimit tests that the strictest matching rate applies
+func TestLimit(t *testing.T) {
+	assert.False(t, Builtin().Limited())
+
+	set, err := NewSet([]Policy{
+		{Pattern: "user:**", MaxRate: 10},
+		{Pattern: "user:*:position:*", MaxRate: 2, Conflate: true},
+	})
+	require.NoError(t, err)
+	assert.True(t, set.Limited())
+
+	rate, conflate := set.Limit("user:12345:margin")
+	assert.Equal(t, 10.0, rate)
+	assert.False(t, conflate)
+
+	rate, conflate = set.Limit("user:12345:position:BTCUSDT")
+	assert.Equal(t, 2.0, rate)
+	assert.True(t, conflate)
+
+	rate, _ = set.Limit(channel.RateUSDTIDR)
+	assert.Zero(t, rate)
+}
+
+// TestLimitDegraded tests that overload rates conflate matching channels only while the set is degraded
+func TestLimitDegraded(t *testing.T) {
+	_, err := NewSet([]Policy{{Pattern: "user:**", OverloadRate: -1}})
+	assert.Error(t, err)
+
+	set, err := NewSet([]Policy{
+		{Pattern: "user:*:margin", OverloadRate: 1},
+		{Pattern: "user:*:position:*", MaxRate: 2, OverloadRate: 5},
+	})
+	require.NoError(t, err)
+	assert.True(t, set.Limited())
+	assert.False(t, set.Degraded())
+
+	rate, conflate := set.Limit("user:12345:margin")
+	assert.Zero(t, rate)
+	assert.False(t, conflate)
+
+	set.SetDegraded(true)
+	assert.True(t, set.Degraded())
+
+	rate, conflate = set.Limit("user:12345:margin")
+	assert.Equal(t, 1.0, rate)
+	assert.True(t, conflate)
+
+	// An overload rate never raises the normal rate
+	rate, conflate = set.Limit("user:12345:position:BTCUSDT")
+	assert.Equal(t, 2.0, rate)
+	assert.True(t, conflate)
+
+	rate, _ = set.Limit("user:12345:position")
+	assert.Zero(t, rate)
+
+	set.SetDegraded(false)
+	rate, conflate = set.Limit("user:12345:margin")
+	assert.Zero(t, rate)
+	assert.False(t, conflate)
+}
+
+// TestLimitExempt tests that exempt client types lift max rates but not overload rates
+func TestLimitExempt(t *testing.T) {
+	set, err := NewSet([]Policy{
+		{Pattern: "user:**", MaxRate: 1, Conflate: true, ExemptClientTypes: []string{"premium"}},
+		{Pattern: "user:*:position", MaxRate: 5, OverloadRate: 0.5},
+	})
+	require.NoError(t, err)
+	premium := func(clientType string) bool { return clientType == "premium" }
+	free := func(clientType string) bool { return clientType == "default" }
+
+	rate, conflate := set.LimitFor("user:12345:margin", free)
+	assert.Equal(t, 1.0, rate)
+	assert.True(t, conflate)
+
+	rate, conflate = set.LimitFor("user:12345:margin", premium)
+	assert.Zero(t, rate)
+	assert.False(t, conflate)
+
+	// Policies without the exemption still apply
+	rate, conflate = set.LimitFor("user:12345:position", premium)
+	assert.Equal(t, 5.0, rate)
+	assert.False(t, conflate)
+
+	set.SetDegraded(true)
+	rate, conflate = set.LimitFor("user:12345:position", premium)
+	assert.Equal(t, 0.5, rate)
+	assert.True(t, conflate)
+}
+
+// TestTTL tests that the shortest matching TTL applies and expires older publications
+func TestTTL(t *testing.T) {
+	assert.Zero(t, Builtin().TTL("user:12345:margin"))
+
+	_, err := NewSet([]Policy{{Pattern: "user:**", TTL: -time.Second}})
+	assert.Error(t, err)
+
+	set, err := NewSet([]Policy{
+		{Pattern: "user:**", TTL: time.Minute},
+		{Pattern: "user:*:margin", TTL: 5 * time.Second},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, set.TTL("user:12345:margin"))
+	assert.Equal(t, time.Minute, set.TTL("user:12345:position"))
+	assert.Zero(t, set.TTL(channel.RateUSDTIDR))
+
+	now := time.Unix(1700000000, 0)
+	assert.False(t, set.Expired("user:12345:margin", now.Add(-4*time.Second), now))
+	assert.True(t, set.Expired("user:12345:margin", now.Add(-5*time.Second), now))
+	assert.False(t, set.Expired(channel.RateUSDTIDR, now.Add(-time.Hour), now))
+}
+
+// TestThrottleDrops tests that publications over the rate are dropped without conflation
+func TestThrottleDrops(t *testing.T) {
+	set, err := NewSet([]Policy{{Pattern: "user:*:margin", MaxRate: 1}})
+	require.NoError(t, err)
+	throttle := NewThrottle(set)
+	now := time.Unix(1700000000, 0)
+	throttle.now = func() time.Time { return now }
+	deliver := func([]byte) { t.Fatal("dropped publication delivered") }
+
+	assert.True(t, throttle.Admit("user:12345:margin", []byte("1"), deliver))
+	assert.False(t, throttle.Admit("user:12345:margin", []byte("2"), deliver))
+	assert.True(t, throttle.Admit("user:67890:margin", []byte("1"), deliver))
+	assert.True(t, throttle.Admit("user:12345:position", []byte("1"), deliver))
+
+	now = now.Add(time.Second)
+	assert.True(t, throttle.Admit("user:12345:margin", []byte("3"), deliver))
+
+	// Channels that may publish again are forgotten
+	now = now.Add(throttleSweepInterval)
+	throttle.Admit("user:12345:margin", []byte("4"), deliver)
+	assert.Len(t, throttle.channels, 1)
+}
+
+// TestThrottleAdmitFor tests conflating a channel to an explicit rate below its policies
+func TestThrottleAdmitFor(t *testing.T) {
+	throttle := NewThrottle(Builtin())
+	now := time.Unix(1700000000, 0)
+	throttle.now = func() time.Time { return now }
+	deliver := func([]byte) {}
+
+	// Unlimited channels are limited to the explicit rate and conflated
+	assert.True(t, throttle.AdmitFor("user:12345:margin", []byte("1"), nil, 0.5, deliver))
+	assert.False(t, throttle.AdmitFor("user:12345:margin", []byte("2"), nil, 0.5, deliver))
+	assert.True(t, throttle.Held("user:12345:margin"))
+	assert.True(t, throttle.Admit("user:67890:margin", []byte("1"), deliver))
+	assert.True(t, throttle.Admit("user:67890:margin", []byte("2"), deliver))
+}
+
+// TestThrottleConflates tests that the latest publication held back is delivered once the channel may publish again
+func TestThrottleConflates(t *testing.T) {
+	set, err := NewSet([]Policy{{Pattern: "user:*:position", MaxRate: 5, Conflate: true}})
+	require.NoError(t, err)
+	throttle := NewThrottle(set)
+
+	var mu sync.Mutex
+	var delivered []string
+	deliver := func(data []byte) {
+		mu.Lock()
+		delivered = append(delivered, string(data))
+		mu.Unlock()
+	}
+
+	assert.True(t, throttle.Admit("user:12345:position", []byte("1"), deliver))
+	assert.False(t, throttle.Held("user:12345:position"))
+	assert.False(t, throttle.Admit("user:12345:position", []byte("2"), deliver))
+	assert.False(t, throttle.Admit("user:12345:position", []byte("3"), deliver))
+	assert.True(t, throttle.Held("user:12345:position"))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(delivered) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"3"}, delivered)
+	assert.False(t, throttle.Held("user:12345:position"))
+	assert.False(t, (*Throttle)(nil).Held("user:12345:position"))
+
+	// The conflated delivery counts against the rate
+	assert.False(t, throttle.Admit("user:12345:position", []byte("4"), deliver))
+}
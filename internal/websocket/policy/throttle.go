@@ -0,0 +1,125 @@
+package policy
+
+import (
+	"sync"
+	"time"
+)
+
+// throttleSweepInterval is how often channels that may publish again are forgotten
+const throttleSweepInterval = time.Minute
+
+// throttled is the rate state of one channel
+type throttled struct {
+	// next is when the channel may publish again
+	next time.Time
+
+	// pending is the latest conflated publication, delivered by timer at next
+	pending []byte
+	deliver func([]byte)
+	timer   *time.Timer
+}
+
+// Throttle enforces the publication rate of the policies in a set, channel by channel
+type Throttle struct {
+	set *Set
+
+	mu        sync.Mutex
+	channels  map[string]*throttled
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewThrottle creates a throttle for the rate-limited policies of set
+func NewThrottle(set *Set) *Throttle {
+	return &Throttle{
+		set:      set,
+		channels: make(map[string]*throttled),
+		now:      time.Now,
+	}
+}
+
+// Admit reports whether data may be published to ch now. A publication over the channel's rate is
+// dropped, or with conflation kept as the channel's pending publication, replacing an older one, and
+// passed to deliver once the channel may publish again.
+func (t *Throttle) Admit(ch string, data []byte, deliver func([]byte)) bool {
+	return t.AdmitFor(ch, data, nil, 0, deliver)
+}
+
+// AdmitFor is Admit for a channel whose user is connected with the client types connected reports (see
+// Set.LimitFor), additionally conflated to limit when positive, e.g. for a user over their quota
+func (t *Throttle) AdmitFor(ch string, data []byte, connected func(clientType string) bool, limit float64, deliver func([]byte)) bool {
+	rate, conflate := t.set.LimitFor(ch, connected)
+	if limit > 0 {
+		rate, conflate = lowerRate(rate, limit), true
+	}
+	if rate == 0 {
+		return true
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+
+	state, ok := t.channels[ch]
+	if !ok {
+		state = &throttled{}
+		t.channels[ch] = state
+	}
+	if state.timer == nil && !now.Before(state.next) {
+		state.next = now.Add(interval)
+		return true
+	}
+
+	if conflate {
+		state.pending = data
+		state.deliver = deliver
+		if state.timer == nil {
+			state.timer = time.AfterFunc(state.next.Sub(now), func() { t.flush(ch, interval) })
+		}
+	}
+	return false
+}
+
+// Held reports whether a conflated publication of ch is waiting for the channel to publish again
+func (t *Throttle) Held(ch string) bool {
+	if t == nil {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.channels[ch]
+	return ok && state.timer != nil
+}
+
+// flush delivers the pending publication of a channel
+func (t *Throttle) flush(ch string, interval time.Duration) {
+	t.mu.Lock()
+	state, ok := t.channels[ch]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+	data, deliver := state.pending, state.deliver
+	state.pending, state.deliver, state.timer = nil, nil, nil
+	state.next = t.now().Add(interval)
+	t.mu.Unlock()
+
+	deliver(data)
+}
+
+// sweep forgets the channels that may publish again and hold nothing pending. Called with t.mu held.
+func (t *Throttle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < throttleSweepInterval {
+		return
+	}
+	t.lastSweep = now
+	for ch, state := range t.channels {
+		if state.timer == nil && !now.Before(state.next) {
+			delete(t.channels, ch)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Error codes for WebSocket communication.
+// These codes are compatible with Centrifuge's disconnect and error codes.
+// Centrifuge code ranges:
+//
+//	0-2999:     reserved for client-side and transport
+//	3000-3499:  non-terminal, client should reconnect
+//	3500-3999:  terminal, no auto-reconnect
+//	4000-4499:  custom disconnects, reconnect (for library users)
+//	4500-4999:  custom disconnects, terminal (for library users)
+//	>=5000:     reserved by Centrifuge
+const (
+	// Client errors (4000-4499) - non-terminal, client should reconnect
+	CodeBadRequest        = 4000 // Invalid request format
+	CodeChannelNotFound   = 4001 // Channel not found or invalid format
+	CodeAlreadySubscribed = 4002 // Already subscribed to channel
+	CodeNotSubscribed     = 4003 // Not subscribed to channel
+	CodeSubscriptionLimit = 4004 // Subscription limit exceeded
+	CodeMessageTooLarge   = 4006 // Client message exceeds the size limit
+
+	// Authorization errors (4100-4199) - non-terminal
+	CodeUnauthorized    = 4100 // Invalid or missing credentials
+	CodeReauthRequired  = 4101 // Session reached its maximum duration without re-authenticating
+	CodeConnectionLimit = 4200 // Connection limit reached
+
+	// Server lifecycle (4300-4399) - non-terminal, reconnect after the advertised backoff
+	CodeShutdown = 4300 // Instance shutting down
+
+	// Server errors (4500-4999) - terminal, no auto-reconnect
+	CodeInternalError      = 4500 // Internal server error
+	CodeServiceUnavailable = 4503 // Service unavailable (terminal)
+
+	// Specific service unavailable codes
+	CodeCfxUserResolution = 4501 // Failed to resolve CFX user ID (terminal)
+	CodeUserPreference    = 4502 // Failed to fetch user preference (terminal)
+
+	// CodeSessionReplaced disconnects a stale session replaced by a newer connection from the same device (terminal)
+	CodeSessionReplaced = 4504
+
+	// CodeSessionSuperseded disconnects a user's oldest session when a new connection exceeds the per-user limit (terminal)
+	CodeSessionSuperseded = 4505
+
+	// CodeEntitlementRevoked rejects or disconnects a user whose futures entitlement was revoked (terminal)
+	CodeEntitlementRevoked = 4506
+
+	// CodeRegionRedirect rejects a user whose CFX account is served by another region, naming its endpoint (terminal)
+	CodeRegionRedirect = 4507
+)
+
+// Human-readable messages for each error code
+const (
+	MessageUnauthorized       = "unauthorized: invalid or missing credentials"
+	MessageConnectionLimit    = "connection limit reached: too many connections for this user"
+	MessageChannelNotFound    = "channel not found: invalid or unauthorized channel"
+	MessageServiceUnavailable = "service unavailable: please try again later"
+	MessageBadRequest         = "bad request: invalid request format"
+	MessageCfxUserResolution  = "service unavailable: failed to resolve user identity"
+	MessageUserPreference     = "service unavailable: failed to fetch user preferences"
+	MessageShutdown           = "server shutting down: reconnect with backoff"
+	MessageSessionReplaced    = "session replaced by a newer connection from the same device"
+	MessageSessionSuperseded  = "session superseded by a newer connection for this user"
+	MessageEntitlementRevoked = "futures access revoked for this account"
+	MessageMessageTooLarge    = "message too large: client message exceeds the size limit"
+	MessageRegionRedirect     = "account served by another region: connect to the endpoint in details"
+	MessageReauthRequired     = "session expired: reconnect with a new token"
+)
+
+// Error is a protocol error carrying a machine-readable details object
+// so client SDKs can present actionable messages instead of parsing free text.
+type Error struct {
+	Code    uint32         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// NewError creates a protocol error with the given code and message
+func NewError(code uint32, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// WithDetail attaches a key/value pair to the error's details object
+func (e *Error) WithDetail(key string, value any) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]any)
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithBackoff attaches reconnect guidance: wait retryAfter plus a random delay within jitter,
+// so clients disconnected together don't reconnect in the same instant
+func (e *Error) WithBackoff(retryAfter, jitter time.Duration) *Error {
+	return e.WithDetail("retry_after_ms", retryAfter.Milliseconds()).
+		WithDetail("jitter_ms", jitter.Milliseconds())
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// encodeMessage returns the plain message, or a JSON object
+// {"message": ..., "details": {...}} when details are attached
+func (e *Error) encodeMessage() string {
+	if len(e.Details) == 0 {
+		return e.Message
+	}
+
+	data, err := json.Marshal(struct {
+		Message string         `json:"message"`
+		Details map[string]any `json:"details"`
+	}{
+		Message: e.Message,
+		Details: e.Details,
+	})
+	if err != nil {
+		return e.Message
+	}
+	return string(data)
+}
+
+// ToCentrifuge converts the protocol error to a Centrifuge error reply
+func (e *Error) ToCentrifuge() *centrifuge.Error {
+	return &centrifuge.Error{
+		Code:    e.Code,
+		Message: e.encodeMessage(),
+	}
+}
+
+// ToDisconnect converts the protocol error to a Centrifuge disconnect
+func (e *Error) ToDisconnect() centrifuge.Disconnect {
+	return centrifuge.Disconnect{
+		Code:   e.Code,
+		Reason: e.encodeMessage(),
+	}
+}
+
+// ErrBadRequest returns an error for malformed client requests
+func ErrBadRequest(reason string) *Error {
+	return NewError(CodeBadRequest, MessageBadRequest).WithDetail("reason", reason)
+}
+
+// ErrUnauthorized returns an error for missing or invalid credentials
+func ErrUnauthorized(reason string) *Error {
+	return NewError(CodeUnauthorized, MessageUnauthorized).WithDetail("reason", reason)
+}
+
+// ErrReauthRequired returns the disconnect sent to sessions that didn't re-authenticate within their grace window
+func ErrReauthRequired() *Error {
+	return NewError(CodeReauthRequired, MessageReauthRequired)
+}
+
+// ErrConnectionLimit returns an error for users exceeding their connection limit
+func ErrConnectionLimit(current, max int) *Error {
+	return NewError(CodeConnectionLimit, MessageConnectionLimit).
+		WithDetail("current", current).
+		WithDetail("max_connections", max)
+}
+
+// ErrChannelNotFound returns an error for invalid or unauthorized channels
+func ErrChannelNotFound(channel, reason string) *Error {
+	return NewError(CodeChannelNotFound, MessageChannelNotFound).
+		WithDetail("channel", channel).
+		WithDetail("reason", reason)
+}
+
+// ErrCfxUserResolution returns an error for failures resolving the CFX user ID
+func ErrCfxUserResolution() *Error {
+	return NewError(CodeCfxUserResolution, MessageCfxUserResolution).WithDetail("dependency", "coin-cfx-adapter")
+}
+
+// ErrUserPreference returns an error for failures fetching the user's quote preference
+func ErrUserPreference() *Error {
+	return NewError(CodeUserPreference, MessageUserPreference).WithDetail("dependency", "coin-setting")
+}
+
+// ErrShutdown returns the disconnect sent to clients when the instance shuts down
+func ErrShutdown() *Error {
+	return NewError(CodeShutdown, MessageShutdown)
+}
+
+// ErrSessionReplaced returns the disconnect sent to a session replaced by its device's reconnect
+func ErrSessionReplaced() *Error {
+	return NewError(CodeSessionReplaced, MessageSessionReplaced)
+}
+
+// ErrSessionSuperseded returns the disconnect sent to a session taken over by the user's newer connection
+func ErrSessionSuperseded() *Error {
+	return NewError(CodeSessionSuperseded, MessageSessionSuperseded)
+}
+
+// ErrEntitlementRevoked returns the error sent to users whose futures entitlement was revoked
+func ErrEntitlementRevoked() *Error {
+	return NewError(CodeEntitlementRevoked, MessageEntitlementRevoked)
+}
+
+// ErrRegionRedirect returns the error sent to users whose CFX account is served by another region's endpoint
+func ErrRegionRedirect(region, endpoint string) *Error {
+	return NewError(CodeRegionRedirect, MessageRegionRedirect).
+		WithDetail("region", region).
+		WithDetail("endpoint", endpoint)
+}
+
+// ErrMessageTooLarge returns the disconnect sent to clients whose message exceeds the size limit
+func ErrMessageTooLarge(size, limit int) *Error {
+	return NewError(CodeMessageTooLarge, MessageMessageTooLarge).
+		WithDetail("size", size).
+		WithDetail("limit_bytes", limit)
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorWithoutDetails tests that errors without details keep a plain text message
+func TestErrorWithoutDetails(t *testing.T) {
+	err := NewError(CodeBadRequest, "bad request")
+
+	centrifugeErr := err.ToCentrifuge()
+	assert.Equal(t, uint32(CodeBadRequest), centrifugeErr.Code)
+	assert.Equal(t, "bad request", centrifugeErr.Message)
+}
+
+// TestErrorWithDetails tests that details are encoded as a JSON object in the message
+func TestErrorWithDetails(t *testing.T) {
+	err := ErrConnectionLimit(3, 3)
+
+	centrifugeErr := err.ToCentrifuge()
+	assert.Equal(t, uint32(CodeConnectionLimit), centrifugeErr.Code)
+
+	var decoded struct {
+		Message string         `json:"message"`
+		Details map[string]any `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(centrifugeErr.Message), &decoded))
+	assert.Equal(t, MessageConnectionLimit, decoded.Message)
+	assert.EqualValues(t, 3, decoded.Details["current"])
+	assert.EqualValues(t, 3, decoded.Details["max_connections"])
+}
+
+// TestErrorToDisconnect tests converting a protocol error to a disconnect
+func TestErrorToDisconnect(t *testing.T) {
+	disconnect := ErrChannelNotFound("user:1:orders", "unknown channel type").ToDisconnect()
+
+	assert.Equal(t, uint32(CodeChannelNotFound), disconnect.Code)
+	assert.Contains(t, disconnect.Reason, `"channel":"user:1:orders"`)
+}
+
+// TestErrorWithBackoff tests attaching reconnect guidance to a disconnect
+func TestErrorWithBackoff(t *testing.T) {
+	disconnect := ErrShutdown().WithBackoff(1500*time.Millisecond, 10*time.Second).ToDisconnect()
+	assert.Equal(t, uint32(CodeShutdown), disconnect.Code)
+
+	var decoded struct {
+		Message string         `json:"message"`
+		Details map[string]any `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(disconnect.Reason), &decoded))
+	assert.Equal(t, MessageShutdown, decoded.Message)
+	assert.EqualValues(t, 1500, decoded.Details["retry_after_ms"])
+	assert.EqualValues(t, 10000, decoded.Details["jitter_ms"])
+
+	// WebSocket close reasons are limited to 123 bytes
+	assert.LessOrEqual(t, len(disconnect.Reason), 123)
+}
+
+// BenchmarkErrorEncoding measures encoding errors sent to clients, with and without a details object
+func BenchmarkErrorEncoding(b *testing.B) {
+	b.Run("plain", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = ErrShutdown().ToCentrifuge()
+		}
+	})
+
+	b.Run("details", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = ErrChannelNotFound("user:130010505:margin", "channel belongs to another user").ToCentrifuge()
+		}
+	})
+
+	b.Run("disconnect", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = ErrShutdown().WithBackoff(1500*time.Millisecond, 10*time.Second).ToDisconnect()
+		}
+	})
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"coin-futures-websocket/internal/announcement"
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Announcements holds the scheduled announcements replicated to this node
+type Announcements interface {
+	Active(now time.Time) []announcement.Announcement
+	HandleNotification(op string, data []byte)
+}
+
+// AnnouncementMessage is the async message pushed to clients for an announcement
+type AnnouncementMessage struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"id"`
+	Message   json.RawMessage `json:"message"`
+	ExpiresAt int64           `json:"expires_at"`
+}
+
+// SetAnnouncements enables announcement replication, delivery and replay to connecting clients
+func (s *CentrifugeServer) SetAnnouncements(announcements Announcements) {
+	s.announcements = announcements
+}
+
+// DeliverAnnouncement sends a started announcement to the targeted clients connected to this node.
+// Every node holds a replica of the announcement, so each one only delivers to its own clients.
+func (s *CentrifugeServer) DeliverAnnouncement(a announcement.Announcement) {
+	data, err := announcementData(a)
+	if err != nil {
+		s.logger.Error("failed to encode announcement", "id", a.ID, "error", err)
+		return
+	}
+
+	owners := announcementOwners(a)
+	var targets []*centrifuge.Client
+	for _, client := range s.node.Hub().Connections() {
+		if a.AllUsers || slices.Contains(owners, client.UserID()) {
+			targets = append(targets, client)
+		}
+	}
+
+	s.fanOut(targets, func(client *centrifuge.Client) {
+		s.sendAnnouncement(client, a.ID, data)
+	})
+
+	s.logger.Info("announcement delivered", "id", a.ID, "clients", len(targets))
+}
+
+// replayAnnouncements sends the unexpired announcements targeting a newly connected client
+func (s *CentrifugeServer) replayAnnouncements(client *centrifuge.Client) {
+	if s.announcements == nil {
+		return
+	}
+
+	for _, a := range s.announcements.Active(time.Now()) {
+		if !a.AllUsers && !slices.Contains(announcementOwners(a), client.UserID()) {
+			continue
+		}
+
+		data, err := announcementData(a)
+		if err != nil {
+			s.logger.Error("failed to encode announcement", "id", a.ID, "error", err)
+			continue
+		}
+		s.sendAnnouncement(client, a.ID, data)
+	}
+}
+
+// sendAnnouncement pushes an encoded announcement to a single client
+func (s *CentrifugeServer) sendAnnouncement(client *centrifuge.Client, id string, data []byte) {
+	if s.duplicateSend(client, SendClassAnnouncement, id, nil) {
+		return
+	}
+
+	if err := client.Send(data); err != nil {
+		s.logger.Warn("failed to send announcement",
+			"id", id,
+			"client_id", client.ID(),
+			"error", err)
+		s.bus.Publish(HubEvent{
+			Type:   HubMessageDropped,
+			Client: client,
+			Reason: "announcement " + id + ": " + err.Error(),
+		})
+	}
+}
+
+// announcementData encodes the client message of an announcement
+func announcementData(a announcement.Announcement) ([]byte, error) {
+	return json.Marshal(AnnouncementMessage{
+		Type:      "announcement",
+		ID:        a.ID,
+		Message:   a.Message,
+		ExpiresAt: a.ExpiresAt.UnixMilli(),
+	})
+}
+
+// announcementOwners returns the ajaib IDs owning the announcement's target channels
+func announcementOwners(a announcement.Announcement) []string {
+	owners := make([]string, 0, len(a.Channels))
+	for _, ch := range a.Channels {
+		if info, err := channel.ParseChannel(ch); err == nil && info.AjaibID != "" {
+			owners = append(owners, info.AjaibID)
+		}
+	}
+	return owners
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"time"
+
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Reconnect backoff advertised to clients in disconnects and connect rejections
+const (
+	minReconnectDelay        = time.Second
+	maxReconnectDelay        = 30 * time.Second
+	reconnectJitterPerClient = 5 * time.Millisecond
+	maxReconnectJitter       = 30 * time.Second
+)
+
+// backoffHint computes the reconnect delay and jitter window advertised to clients.
+// The delay grows with the instance's load against max_connections, and the jitter
+// window grows with the number of clients that may reconnect at the same time.
+func (s *CentrifugeServer) backoffHint() (time.Duration, time.Duration) {
+	connections := s.GetClientCount()
+
+	retryAfter := minReconnectDelay
+	if s.maxConnections > 0 {
+		load := min(float64(connections)/float64(s.maxConnections), 1)
+		retryAfter += time.Duration(load * float64(maxReconnectDelay-minReconnectDelay))
+	}
+
+	jitter := time.Duration(connections) * reconnectJitterPerClient
+	jitter = min(max(jitter, minReconnectDelay), maxReconnectJitter)
+
+	return retryAfter, jitter
+}
+
+// withBackoff attaches the current reconnect guidance to a protocol error
+func (s *CentrifugeServer) withBackoff(perr *protocol.Error) *protocol.Error {
+	retryAfter, jitter := s.backoffHint()
+	return perr.WithBackoff(retryAfter, jitter)
+}
+
+// disconnectAll disconnects every client on this node with the given error
+func (s *CentrifugeServer) disconnectAll(perr *protocol.Error) int {
+	disconnect := perr.ToDisconnect()
+
+	connections := s.node.Hub().Connections()
+	clients := make([]*centrifuge.Client, 0, len(connections))
+	for _, client := range connections {
+		clients = append(clients, client)
+	}
+
+	s.fanOut(clients, func(client *centrifuge.Client) {
+		client.Disconnect(disconnect)
+	})
+	return len(clients)
+}
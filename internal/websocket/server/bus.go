@@ -0,0 +1,215 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// HubEventType identifies an event published on the hub event bus
+type HubEventType string
+
+const (
+	HubClientRegistered   HubEventType = "client_registered"
+	HubClientUnregistered HubEventType = "client_unregistered"
+	HubSubscribed         HubEventType = "subscribed"
+	HubUnsubscribed       HubEventType = "unsubscribed"
+	HubMessageDropped     HubEventType = "message_dropped"
+)
+
+// HubEvent describes a client lifecycle transition or a message that could not be delivered
+type HubEvent struct {
+	Type   HubEventType
+	Client *centrifuge.Client
+
+	// Info is the connection info of an authenticated client, nil otherwise
+	Info *ClientInfo
+
+	// Channel is set for subscribed and unsubscribed events
+	Channel string
+
+	// DisconnectCode and DisconnectReason are set for client unregistered events
+	DisconnectCode   uint32
+	DisconnectReason string
+
+	// Reason describes why a message was dropped
+	Reason string
+
+	Time time.Time
+}
+
+// HubSubscriber consumes hub events. Subscribers run synchronously on the handler goroutine,
+// in subscription order, so they must not block.
+type HubSubscriber func(event HubEvent)
+
+// EventBus fans hub events out to internal subscribers (metrics, broadcaster, audit, connection events)
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[HubEventType][]HubSubscriber
+	all         []HubSubscriber
+}
+
+// NewEventBus creates an empty event bus
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[HubEventType][]HubSubscriber),
+	}
+}
+
+// Subscribe registers a subscriber for the given event types, or for every event when none are given
+func (b *EventBus) Subscribe(subscriber HubSubscriber, types ...HubEventType) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(types) == 0 {
+		b.all = append(b.all, subscriber)
+		return
+	}
+	for _, t := range types {
+		b.subscribers[t] = append(b.subscribers[t], subscriber)
+	}
+}
+
+// Publish delivers the event to its subscribers, stamping the time when unset
+func (b *EventBus) Publish(event HubEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	subscribers := append(append([]HubSubscriber{}, b.subscribers[event.Type]...), b.all...)
+	b.mu.RUnlock()
+
+	for _, subscriber := range subscribers {
+		subscriber(event)
+	}
+}
+
+// Events returns the hub event bus so other modules can subscribe before the server starts
+func (s *CentrifugeServer) Events() *EventBus {
+	return s.bus
+}
+
+// subscribeInternalConsumers wires the server's own modules to the event bus.
+// Order matters: subscriptions are released before disconnect listeners run.
+func (s *CentrifugeServer) subscribeInternalConsumers() {
+	s.bus.Subscribe(s.recordHubMetrics, HubClientRegistered, HubClientUnregistered, HubSubscribed)
+	s.bus.Subscribe(s.publishConnectionEvent, HubClientRegistered, HubSubscribed, HubUnsubscribed, HubClientUnregistered)
+	s.bus.Subscribe(s.routeSubscriptions, HubSubscribed, HubUnsubscribed, HubClientUnregistered)
+	s.bus.Subscribe(s.trackPresence, HubClientRegistered, HubClientUnregistered)
+	s.bus.Subscribe(s.trackLane, HubClientRegistered, HubClientUnregistered)
+	s.bus.Subscribe(s.auditImpersonation, HubClientRegistered, HubSubscribed, HubUnsubscribed, HubClientUnregistered)
+	s.bus.Subscribe(s.forgetSends, HubClientUnregistered)
+	s.bus.Subscribe(s.startSession, HubClientRegistered)
+	s.bus.Subscribe(s.endSession, HubClientUnregistered)
+	s.bus.Subscribe(func(event HubEvent) {
+		s.notifyDisconnect(event.Client.ID(), event.Info)
+	}, HubClientUnregistered)
+}
+
+// recordHubMetrics tracks connections and subscriptions in Prometheus metrics
+func (s *CentrifugeServer) recordHubMetrics(event HubEvent) {
+	if s.metrics == nil {
+		return
+	}
+
+	switch event.Type {
+	case HubClientRegistered:
+		s.metrics.RecordConnection(s.config.NodeName)
+	case HubClientUnregistered:
+		s.metrics.RecordDisconnection(s.config.NodeName)
+	case HubSubscribed:
+		s.metrics.RecordSubscription(s.config.NodeName, event.Channel)
+	}
+}
+
+// routeSubscriptions keeps the Kafka broadcaster's routing table in sync with client subscriptions
+func (s *CentrifugeServer) routeSubscriptions(event HubEvent) {
+	if s.broadcaster == nil || event.Info == nil || event.Info.CfxUserID == "" {
+		return
+	}
+	info := event.Info
+
+	// Channels of families other than the user family are published by the server itself, not routed from Kafka
+	if event.Type != HubClientUnregistered && channel.IsRegistered(event.Channel) {
+		return
+	}
+
+	switch event.Type {
+	case HubSubscribed:
+		// Registration is idempotent per client and channel
+		if !s.broadcaster.RegisterSubscription(info.CfxUserID, event.Client.ID(), event.Channel, info.AjaibID, info.QuotePreference) {
+			s.logger.Debug("client already registered with kafka broadcaster",
+				"client_id", event.Client.ID(),
+				"cfx_user_id", info.CfxUserID,
+				"channel", event.Channel)
+		}
+	case HubUnsubscribed:
+		// Only this channel stops being routed; the client's other channels keep their registration
+		s.broadcaster.UnregisterSubscription(info.CfxUserID, event.Client.ID(), event.Channel)
+	case HubClientUnregistered:
+		// Release any subscriptions left over by the client
+		s.broadcaster.UnregisterClient(info.CfxUserID, event.Client.ID())
+	}
+}
+
+// restoreSubscriptions registers the hub's current subscriptions with the broadcaster, so a broadcaster
+// set while clients are connected starts with their routes. It returns the number newly registered.
+func (s *CentrifugeServer) restoreSubscriptions() int {
+	if s.broadcaster == nil {
+		return 0
+	}
+
+	// The broadcaster is set before the snapshot, so subscriptions made meanwhile are routed by their
+	// events; a subscription ended meanwhile is released again once registered
+	var restored int
+	for _, sub := range s.SnapshotSubscriptions() {
+		if !s.broadcaster.RegisterSubscription(sub.CfxUserID, sub.ClientID, sub.Channel, sub.AjaibID, sub.QuotePreference) {
+			continue
+		}
+		if !sub.client.IsSubscribed(sub.Channel) {
+			s.broadcaster.UnregisterSubscription(sub.CfxUserID, sub.ClientID, sub.Channel)
+			continue
+		}
+		restored++
+	}
+
+	if restored > 0 {
+		s.logger.Info("restored kafka routing table from hub subscriptions", "subscriptions", restored)
+	}
+	return restored
+}
+
+// publishConnectionEvent emits the connection lifecycle event matching a hub event
+func (s *CentrifugeServer) publishConnectionEvent(event HubEvent) {
+	// Impersonation sessions are recorded in the audit log, not as the user's connection events
+	if event.Info != nil && event.Info.ImpersonatedBy != "" {
+		return
+	}
+
+	var eventType ConnectionEventType
+	switch event.Type {
+	case HubClientRegistered:
+		eventType = EventConnected
+	case HubSubscribed:
+		eventType = EventSubscribed
+	case HubUnsubscribed:
+		eventType = EventUnsubscribed
+	case HubClientUnregistered:
+		eventType = EventDisconnected
+	default:
+		return
+	}
+
+	connEvent := s.newConnectionEvent(eventType, event.Client)
+	connEvent.Channel = event.Channel
+	connEvent.DisconnectCode = event.DisconnectCode
+	connEvent.DisconnectReason = event.DisconnectReason
+	if event.Type == HubClientUnregistered && event.Info != nil && event.Info.ConnectedAt > 0 {
+		connEvent.SessionDurationMs = connEvent.Timestamp - event.Info.ConnectedAt
+	}
+	s.emitEvent(connEvent)
+}
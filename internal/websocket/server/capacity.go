@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Readiness is the response body of the readiness endpoint
+type Readiness struct {
+	Status         string `json:"status"`
+	Connections    int    `json:"connections"`
+	MaxConnections int    `json:"max_connections,omitempty"`
+	Remaining      *int   `json:"remaining,omitempty"`
+
+	// Upstream reports the CFX data feed; a stalled feed does not fail readiness because every replica shares it
+	Upstream *UpstreamHealth `json:"upstream,omitempty"`
+}
+
+// SetMaxConnections limits the total connections on this instance; upgrades beyond it are shed
+// with 503 and a Retry-After header. Zero disables the limit.
+func (s *CentrifugeServer) SetMaxConnections(max int, retryAfter time.Duration) {
+	s.maxConnections = max
+	s.shedRetryAfter = retryAfter
+}
+
+// readiness returns the current connection capacity of the instance
+func (s *CentrifugeServer) readiness() Readiness {
+	r := s.capacity(s.GetClientCount())
+	r.Upstream = s.upstreamHealth(time.Now())
+	if status := s.handoffStatus(); status != "" {
+		r.Status = status
+	}
+	return r
+}
+
+// capacity computes readiness for the given number of connections
+func (s *CentrifugeServer) capacity(connections int) Readiness {
+	r := Readiness{
+		Status:      "ready",
+		Connections: connections,
+	}
+
+	if s.maxConnections > 0 {
+		remaining := max(s.maxConnections-connections, 0)
+		r.MaxConnections = s.maxConnections
+		r.Remaining = &remaining
+		if remaining == 0 {
+			r.Status = "full"
+		}
+	}
+
+	return r
+}
+
+// LoadSheddingMiddleware rejects new WebSocket upgrades with 503 while the instance is at capacity,
+// joining its consumer group or draining
+func (s *CentrifugeServer) LoadSheddingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status := s.readiness().Status; status != "ready" {
+			if s.metrics != nil {
+				s.metrics.RecordFailedConnection(s.config.NodeName, "capacity")
+			}
+			s.logger.Warn("connection shed, instance not ready",
+				"status", status,
+				"max_connections", s.maxConnections,
+				"remote_addr", r.RemoteAddr)
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.shedRetryAfter.Seconds())))
+			http.Error(w, "instance at capacity", http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ReadyHandler returns an HTTP handler reporting remaining capacity; it fails with 503 when full,
+// joining or draining so the load balancer shifts traffic to other replicas
+func (s *CentrifugeServer) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readiness := s.readiness()
+
+		w.Header().Set("Content-Type", "application/json")
+		if readiness.Status != "ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(readiness); err != nil {
+			s.logger.Error("failed to encode readiness", "error", err)
+		}
+	})
+}
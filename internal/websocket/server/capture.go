@@ -0,0 +1,337 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Bounds of publication captures, which are held in memory
+const (
+	// maxCaptureCount is the most publications a single capture keeps
+	maxCaptureCount = 1000
+
+	// maxCaptures is the most captures kept at once, running or finished
+	maxCaptures = 10
+
+	// captureRetention is how long a capture is kept after it started, finished or not
+	captureRetention = 10 * time.Minute
+)
+
+// CapturedPublication is a publication written to a client during a capture
+type CapturedPublication struct {
+	Time     time.Time         `json:"time"`
+	ClientID string            `json:"client_id"`
+	UserID   string            `json:"user_id"`
+	Offset   uint64            `json:"offset,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+
+	// Data is the publication payload of JSON protocol clients, a patch of the previous payload when
+	// Delta is set; Raw is the encoded reply of Protobuf clients
+	Data  json.RawMessage `json:"data,omitempty"`
+	Delta bool            `json:"delta,omitempty"`
+	Raw   []byte          `json:"raw,omitempty"`
+
+	// Size is the size of the encoded reply written to the client
+	Size int `json:"size"`
+}
+
+// Capture records the next publications written to the clients of a channel on this instance
+type Capture struct {
+	ID      string `json:"id"`
+	Channel string `json:"channel"`
+
+	// ClientID restricts the capture to one client
+	ClientID string `json:"client_id,omitempty"`
+
+	// Count is the number of publications to capture, keeping one in every Sample written
+	Count  int `json:"count"`
+	Sample int `json:"sample"`
+
+	// Seen counts the publications written to matching clients, captured or skipped by sampling
+	Seen      int64     `json:"seen"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Done      bool      `json:"done"`
+
+	Publications []CapturedPublication `json:"publications"`
+}
+
+// captureReply is the part of a JSON protocol reply carrying a publication push
+type captureReply struct {
+	Push *struct {
+		Pub *struct {
+			Data   json.RawMessage   `json:"data"`
+			Offset uint64            `json:"offset"`
+			Tags   map[string]string `json:"tags"`
+			Delta  bool              `json:"delta"`
+		} `json:"pub"`
+	} `json:"push"`
+}
+
+// captures holds the publication captures of this instance by ID. active counts the running captures, so
+// transport writes skip the lock while nothing is captured.
+type captures struct {
+	mu     sync.Mutex
+	byID   map[string]*Capture
+	active atomic.Int32
+}
+
+func newCaptures() *captures {
+	return &captures{byID: make(map[string]*Capture)}
+}
+
+// start adds a capture, dropping expired ones first; it returns false when maxCaptures are kept
+func (c *captures) start(capture *Capture, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+	if len(c.byID) >= maxCaptures {
+		return false
+	}
+	c.byID[capture.ID] = capture
+	c.active.Add(1)
+	return true
+}
+
+// expire drops the captures past their retention; callers hold the lock
+func (c *captures) expire(now time.Time) {
+	for id, capture := range c.byID {
+		if now.Before(capture.ExpiresAt) {
+			continue
+		}
+		if !capture.Done {
+			c.active.Add(-1)
+		}
+		delete(c.byID, id)
+	}
+}
+
+// stop drops a capture, reporting whether it was kept
+func (c *captures) stop(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	capture, ok := c.byID[id]
+	if !ok {
+		return false
+	}
+	if !capture.Done {
+		c.active.Add(-1)
+	}
+	delete(c.byID, id)
+	return true
+}
+
+// get returns a copy of a capture
+func (c *captures) get(id string, now time.Time) (Capture, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+	capture, ok := c.byID[id]
+	if !ok {
+		return Capture{}, false
+	}
+	snapshot := *capture
+	snapshot.Publications = append([]CapturedPublication{}, capture.Publications...)
+	return snapshot, true
+}
+
+// list returns the kept captures without their publications, newest first
+func (c *captures) list(now time.Time) []Capture {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire(now)
+	list := make([]Capture, 0, len(c.byID))
+	for _, capture := range c.byID {
+		summary := *capture
+		summary.Publications = nil
+		list = append(list, summary)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.After(list[j].StartedAt)
+	})
+	return list
+}
+
+// record adds a publication written to a client to the running captures of its channel
+func (c *captures) record(client *centrifuge.Client, e centrifuge.TransportWriteEvent, now time.Time) {
+	if c.active.Load() == 0 || e.Channel == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var pub *CapturedPublication
+	for _, capture := range c.byID {
+		if capture.Done || capture.Channel != e.Channel || (capture.ClientID != "" && capture.ClientID != client.ID()) {
+			continue
+		}
+		if pub == nil {
+			if pub = decodeCapture(e.Data); pub == nil {
+				// Join, leave and unsubscribe pushes are not publications
+				return
+			}
+			pub.Time = now
+			pub.ClientID = client.ID()
+			pub.UserID = client.UserID()
+		}
+
+		capture.Seen++
+		if (capture.Seen-1)%int64(capture.Sample) != 0 {
+			continue
+		}
+		capture.Publications = append(capture.Publications, *pub)
+		if len(capture.Publications) >= capture.Count {
+			capture.Done = true
+			c.active.Add(-1)
+		}
+	}
+}
+
+// decodeCapture returns the publication carried by an encoded reply, nil for other pushes. Replies that
+// aren't JSON come from Protobuf clients and are kept encoded.
+func decodeCapture(data []byte) *CapturedPublication {
+	size := len(data)
+	var reply captureReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return &CapturedPublication{Raw: append([]byte(nil), data...), Size: size}
+	}
+	if reply.Push == nil || reply.Push.Pub == nil {
+		return nil
+	}
+	return &CapturedPublication{
+		Offset: reply.Push.Pub.Offset,
+		Tags:   reply.Push.Pub.Tags,
+		Data:   reply.Push.Pub.Data,
+		Delta:  reply.Push.Pub.Delta,
+		Size:   size,
+	}
+}
+
+// capturePublication records publications written to clients for the running captures; it never
+// holds back a write
+func (s *CentrifugeServer) capturePublication(client *centrifuge.Client, e centrifuge.TransportWriteEvent) bool {
+	s.captures.record(client, e, time.Now())
+	return true
+}
+
+// StartCapture captures the next count publications written to the clients of a channel on this
+// instance, keeping one in every sample; clientID restricts it to one client
+func (s *CentrifugeServer) StartCapture(ch, clientID string, count, sample int) (Capture, bool) {
+	now := time.Now()
+	capture := &Capture{
+		ID:           newSessionID(),
+		Channel:      ch,
+		ClientID:     clientID,
+		Count:        count,
+		Sample:       sample,
+		StartedAt:    now,
+		ExpiresAt:    now.Add(captureRetention),
+		Publications: []CapturedPublication{},
+	}
+	if !s.captures.start(capture, now) {
+		return Capture{}, false
+	}
+
+	s.logger.Info("publication capture started",
+		"capture_id", capture.ID,
+		"channel", ch,
+		"client_id", clientID,
+		"count", count,
+		"sample", sample)
+	return *capture, true
+}
+
+// CapturesHandler returns the admin HTTP handler capturing the publications written to a channel's clients.
+// POST ?channel= starts a capture of ?count= publications (10 by default), keeping one in every ?sample=
+// and only those of ?client_id= when set. GET ?id= returns a capture, GET lists them and DELETE ?id=
+// drops one.
+func (s *CentrifugeServer) CapturesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		id := query.Get("id")
+
+		switch r.Method {
+		case http.MethodGet:
+			var body any
+			if id == "" {
+				body = map[string][]Capture{"captures": s.captures.list(time.Now())}
+			} else {
+				capture, ok := s.captures.get(id, time.Now())
+				if !ok {
+					http.Error(w, "capture not found", http.StatusNotFound)
+					return
+				}
+				body = capture
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(body); err != nil {
+				s.logger.Error("failed to encode capture", "error", err)
+			}
+		case http.MethodPost:
+			ch := query.Get("channel")
+			if ch == "" || len(ch) > channel.MaxLength {
+				http.Error(w, "channel is required", http.StatusBadRequest)
+				return
+			}
+			count, ok := captureParam(query.Get("count"), 10)
+			if !ok || count > maxCaptureCount {
+				http.Error(w, "count must be 1 to "+strconv.Itoa(maxCaptureCount), http.StatusBadRequest)
+				return
+			}
+			sample, ok := captureParam(query.Get("sample"), 1)
+			if !ok {
+				http.Error(w, "sample must be a positive integer", http.StatusBadRequest)
+				return
+			}
+
+			capture, ok := s.StartCapture(ch, query.Get("client_id"), count, sample)
+			if !ok {
+				http.Error(w, "too many captures, delete one first", http.StatusTooManyRequests)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			if err := json.NewEncoder(w).Encode(capture); err != nil {
+				s.logger.Error("failed to encode capture", "error", err)
+			}
+		case http.MethodDelete:
+			if id == "" {
+				http.Error(w, "id is required", http.StatusBadRequest)
+				return
+			}
+			if !s.captures.stop(id) {
+				http.Error(w, "capture not found", http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// captureParam parses a positive integer query parameter, returning def when it is empty
+func captureParam(v string, def int) (int, bool) {
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil && n > 0
+}
@@ -5,9 +5,15 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"coin-futures-websocket/config"
+	"coin-futures-websocket/internal/cache"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/policy"
+	"coin-futures-websocket/internal/websocket/protocol"
 
 	"github.com/centrifugal/centrifuge"
 )
@@ -22,27 +28,120 @@ type UserPreferenceProvider interface {
 	GetQuotePreference(ctx context.Context, ajaibID string) (string, error)
 }
 
+// FeatureFlags answers whether a feature flag is on for a user
+type FeatureFlags interface {
+	Enabled(name, ajaibID string) bool
+}
+
 // KafkaBroadcaster is the interface for the Kafka broadcaster (used to avoid circular dependency)
 type KafkaBroadcaster interface {
-	RegisterSubscription(cfxUserID, ajaibID, quotePreference string)
-	UnregisterSubscription(cfxUserID string)
+	RegisterSubscription(cfxUserID, clientID, channel, ajaibID, quotePreference string) bool
+	UnregisterSubscription(cfxUserID, clientID, channel string)
+	UnregisterClient(cfxUserID, clientID string)
+	Subscribers() map[string]string
 }
 
 // CentrifugeServer wraps the Centrifuge library server
 type CentrifugeServer struct {
-	node      *centrifuge.Node
-	wsHandler *centrifuge.WebsocketHandler
-	config    *config.CentrifugeConfiguration
-	logger    *slog.Logger
-	metrics   *Metrics
+	node    *centrifuge.Node
+	config  *config.CentrifugeConfiguration
+	logger  *slog.Logger
+	metrics *Metrics
+
+	// defaultProfile serves upgrades not selected by any scoped connection profile
+	defaultProfile profileHandler
+	profiles       []profileHandler
 
 	// Configuration
 	maxConnectionsPerUser int
+	connectionLimitPolicy ConnectionLimitPolicy
+	maxConnections        int
+	shedRetryAfter        time.Duration
+	subChannelsEnabled    bool
+	subscribeSnapshot     bool
+	clientSessionIDs      bool
+	handshakeLimits       HandshakeLimits
+	policies              *policy.Set
+	lastValues            *cache.LastValues
+	podName               string
+	region                string
+	regionEndpoints       map[string]string
 
 	// Dependencies for handlers
 	cfxUserMapper    CfxUserMapper
 	userPrefProvider UserPreferenceProvider
+	entitlements     EntitlementProvider
+	regionResolver   RegionResolver
 	broadcaster      KafkaBroadcaster
+	eventPublisher   EventPublisher
+	featureFlags     FeatureFlags
+	announcements    Announcements
+	receipts         Receipts
+
+	bus                 *EventBus
+	disconnectListeners []DisconnectListener
+
+	// sessions holds the re-authentication schedule of each limited session by client ID
+	sessions sync.Map
+
+	// lanes counts each user's connections by connection profile
+	lanes lanes
+
+	// dedupe remembers the server-side sends recently made to each client
+	dedupe *sendDedupe
+
+	// overflows keeps the clients recently disconnected for overflowing their queue
+	overflows *overflowLog
+
+	// captures records the publications written to clients of channels under inspection
+	captures *captures
+
+	// liveness times the socket writes of connections when set; stallDisconnects counts the clients
+	// disconnected for write stalls
+	liveness         *LivenessLimits
+	stallDisconnects atomic.Int64
+
+	// throttle holds back the conflated publications reported in pongs
+	throttle *policy.Throttle
+
+	// expiryMetrics counts the snapshots skipped past the TTL of their channel policy
+	expiryMetrics *policy.ExpiryMetrics
+
+	// audit records impersonation sessions
+	audit *slog.Logger
+
+	// presence reports users' first connection and last disconnect on this instance
+	presence presence
+
+	// acceptedConns holds when each connection waiting for its first request headers was accepted
+	acceptedConns sync.Map
+
+	// fanOutWorkers bounds the goroutines delivering server-side sends to large client lists
+	fanOutWorkers int
+
+	// upstream is the CFX data feed reported by readiness and metrics
+	upstream               UpstreamSource
+	upstreamStallAfter     time.Duration
+	upstreamReconnectAfter time.Duration
+
+	// upstreamReconnectedAt is only touched by the upstream monitor goroutine
+	upstreamReconnectedAt time.Time
+
+	// overload degrades delivery to the overload rates of the channel policies while it falls behind
+	overload       OverloadSource
+	overloadLimits OverloadLimits
+
+	// joinGate holds readiness until the consumer joined its group; draining is set once the instance
+	// handed its partitions over on shutdown
+	joinGate GroupMember
+	draining atomic.Bool
+
+	// publishedRate is the last rate pushed to the rate channel by this node
+	publishedRate float64
+	rateMu        sync.Mutex
+
+	// hubStats is the hub cardinality of the last metrics collection
+	hubStats atomic.Pointer[HubStats]
 }
 
 // NewCentrifugeServer creates a new Centrifuge server instance
@@ -62,10 +161,14 @@ func NewCentrifugeServer(cfg *config.CentrifugeConfiguration, logger *slog.Logge
 		Name:               cfg.NodeName,
 		LogHandler:         logHandler,
 		LogLevel:           centrifuge.LogLevelInfo,
-		ChannelMaxLength:   255,
-		ClientQueueMaxSize: 1048576, // 1MB default
+		ChannelMaxLength:   channel.MaxLength,
+		ClientQueueMaxSize: cfg.ClientQueueMaxSize,
 	}
 
+	// Centrifuge passes the channel of a write to the transport write handler only when it labels channel
+	// metrics, which the send dedupe and captures rely on; channel types keep the labels bounded
+	centrifugeCfg.Metrics.GetChannelNamespaceLabel = hubChannelType
+
 	// Set log level based on config
 	switch cfg.LogLevel {
 	case "debug":
@@ -78,6 +181,15 @@ func NewCentrifugeServer(cfg *config.CentrifugeConfiguration, logger *slog.Logge
 		centrifugeCfg.LogLevel = centrifuge.LogLevelError
 	}
 
+	if centrifugeCfg.ClientQueueMaxSize <= 0 {
+		centrifugeCfg.ClientQueueMaxSize = 1048576 // 1MB default
+	}
+
+	// Limited sessions are closed by the reauth schedule at the end of their grace window
+	if cfg.MaxSessionSeconds > 0 {
+		centrifugeCfg.ClientExpiredCloseDelay = time.Duration(cfg.ReauthGraceSeconds)*time.Second + reauthCloseSlack
+	}
+
 	node, err := centrifuge.New(centrifugeCfg)
 	if err != nil {
 		logger.Error("failed to create centrifuge node", "error", err)
@@ -113,23 +225,31 @@ func NewCentrifugeServer(cfg *config.CentrifugeConfiguration, logger *slog.Logge
 		logger.Info("centrifuge using in-memory broker (redis broker disabled)")
 	}
 
-	// Create WebSocket handler
-	wsCfg := centrifuge.WebsocketConfig{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // Allow all origins for now
-		},
-		PingPongConfig: centrifuge.PingPongConfig{
-			PingInterval: 2 * time.Second,
-		},
-	}
-	wsHandler := centrifuge.NewWebsocketHandler(node, wsCfg)
-
-	return &CentrifugeServer{
+	// Create the WebSocket handler of the default connection profile
+	def := ConnectionProfile{Name: "default"}
+	s := &CentrifugeServer{
 		node:      node,
-		wsHandler: wsHandler,
 		config:    cfg,
 		logger:    logger,
+		audit:     logger,
+		bus:       NewEventBus(),
+		overflows: newOverflowLog(),
+		captures:  newCaptures(),
+		policies:  policy.Builtin(),
+		presence: presence{
+			connections: make(map[string]int),
+		},
+		lanes: lanes{
+			connections: make(map[string]map[string]int),
+		},
+		defaultProfile: profileHandler{
+			profile: def,
+			handler: centrifuge.NewWebsocketHandler(node, websocketConfig(def)),
+		},
 	}
+	s.subscribeInternalConsumers()
+
+	return s
 }
 
 // SetCfxUserMapper sets the mapper used to resolve Ajaib ID to CFX user ID
@@ -145,6 +265,7 @@ func (s *CentrifugeServer) SetUserPreferenceProvider(provider UserPreferenceProv
 // SetBroadcaster sets the Kafka broadcaster for subscription tracking
 func (s *CentrifugeServer) SetBroadcaster(broadcaster KafkaBroadcaster) {
 	s.broadcaster = broadcaster
+	s.restoreSubscriptions()
 }
 
 // SetMaxConnectionsPerUser sets the maximum number of concurrent connections per user
@@ -152,6 +273,42 @@ func (s *CentrifugeServer) SetMaxConnectionsPerUser(max int) {
 	s.maxConnectionsPerUser = max
 }
 
+// SetSubChannelsEnabled allows subscriptions to per-symbol and per-asset sub-channels
+func (s *CentrifugeServer) SetSubChannelsEnabled(enabled bool) {
+	s.subChannelsEnabled = enabled
+}
+
+// SetChannelPolicies sets the channel policies checked at subscribe time
+func (s *CentrifugeServer) SetChannelPolicies(policies *policy.Set) {
+	s.policies = policies
+}
+
+// SetExpiryMetrics sets the metrics counting snapshots skipped past their TTL
+func (s *CentrifugeServer) SetExpiryMetrics(metrics *policy.ExpiryMetrics) {
+	s.expiryMetrics = metrics
+}
+
+// SetFeatureFlags sets the provider used to gate features per user
+func (s *CentrifugeServer) SetFeatureFlags(flags FeatureFlags) {
+	s.featureFlags = flags
+}
+
+// featureEnabled reports whether a feature flag is on for the user; all flags are off without a provider
+func (s *CentrifugeServer) featureEnabled(name, ajaibID string) bool {
+	return s.featureFlags != nil && s.featureFlags.Enabled(name, ajaibID)
+}
+
+// SetSubscribeSnapshot attaches the latest channel state from history to subscribe acknowledgments
+func (s *CentrifugeServer) SetSubscribeSnapshot(enabled bool) {
+	s.subscribeSnapshot = enabled
+}
+
+// SetLastValues serves snapshots from the last-value cache when channel history has none, e.g. after
+// reconnecting to a replica that never published the channel
+func (s *CentrifugeServer) SetLastValues(lastValues *cache.LastValues) {
+	s.lastValues = lastValues
+}
+
 // SetMetrics sets the metrics collector for the server
 func (s *CentrifugeServer) SetMetrics(metrics *Metrics) {
 	s.metrics = metrics
@@ -182,12 +339,32 @@ func (s *CentrifugeServer) Start() error {
 // Shutdown gracefully shuts down the server
 func (s *CentrifugeServer) Shutdown(ctx context.Context) error {
 	s.logger.Info("shutting down centrifuge server")
+
+	// Spread reconnects to the remaining instances instead of letting every client stampede at once
+	retryAfter, jitter := s.backoffHint()
+	disconnected := s.disconnectAll(protocol.ErrShutdown().WithBackoff(retryAfter, jitter))
+	s.logger.Info("disconnected clients for shutdown",
+		"clients", disconnected,
+		"retry_after", retryAfter,
+		"jitter", jitter)
+
 	return s.node.Shutdown(ctx)
 }
 
 // ServeHTTP serves WebSocket connections via HTTP handler
 func (s *CentrifugeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	s.wsHandler.ServeHTTP(w, r)
+	s.serveHandshake(w, r, s.serveProfile)
+}
+
+// serveProfile serves an upgrade with the WebSocket handler of its connection profile
+func (s *CentrifugeServer) serveProfile(w http.ResponseWriter, r *http.Request) {
+	p := s.profileFor(r)
+	w, r = s.trackLiveness(w, r)
+	r = r.WithContext(withProfile(r.Context(), p.profile))
+	if p.profile.keepaliveMode() == KeepaliveHybrid {
+		r = withFramePingPong(r)
+	}
+	p.handler.ServeHTTP(w, r)
 }
 
 // GetClientCount returns the total number of connected clients
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sort"
+)
+
+// ConnectionSnapshot describes a single client connection for debug dumps
+type ConnectionSnapshot struct {
+	ClientID        string   `json:"client_id"`
+	SessionID       string   `json:"session_id,omitempty"`
+	UserID          string   `json:"user_id"`
+	CfxUserID       string   `json:"cfx_user_id,omitempty"`
+	QuotePreference string   `json:"quote_preference,omitempty"`
+	ClientIP        string   `json:"client_ip,omitempty"`
+	ImpersonatedBy  string   `json:"impersonated_by,omitempty"`
+	Profile         string   `json:"profile"`
+	ConnectedAt     int64    `json:"connected_at"`
+	Channels        []string `json:"channels"`
+}
+
+// ConnectionDump is the response body of the connection dump endpoint
+type ConnectionDump struct {
+	Instance    InstanceInfo         `json:"instance"`
+	Goroutines  int                  `json:"goroutines"`
+	Clients     int                  `json:"clients"`
+	Users       int                  `json:"users"`
+	Channels    int                  `json:"channels"`
+	Connections []ConnectionSnapshot `json:"connections"`
+}
+
+// Connections returns a snapshot of all clients connected to this node
+func (s *CentrifugeServer) Connections() []ConnectionSnapshot {
+	clients := s.node.Hub().Connections()
+	snapshots := make([]ConnectionSnapshot, 0, len(clients))
+
+	for _, client := range clients {
+		snapshot := ConnectionSnapshot{
+			ClientID:    client.ID(),
+			UserID:      client.UserID(),
+			Profile:     s.clientProfile(client.Context()).Name,
+			ConnectedAt: client.ConnectedAtMS(),
+			Channels:    client.Channels(),
+		}
+		if info := s.getClientInfo(client); info != nil {
+			snapshot.SessionID = info.SessionID
+			snapshot.CfxUserID = info.CfxUserID
+			snapshot.QuotePreference = info.QuotePreference
+			snapshot.ClientIP = info.ClientIP
+			snapshot.ImpersonatedBy = info.ImpersonatedBy
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].ConnectedAt < snapshots[j].ConnectedAt
+	})
+
+	return snapshots
+}
+
+// ConnectionsHandler returns an HTTP handler that dumps goroutine count and connected clients
+func (s *CentrifugeServer) ConnectionsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hub := s.node.Hub()
+		dump := ConnectionDump{
+			Instance:    s.Instance(),
+			Goroutines:  runtime.NumGoroutine(),
+			Clients:     hub.NumClients(),
+			Users:       hub.NumUsers(),
+			Channels:    hub.NumChannels(),
+			Connections: s.Connections(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dump); err != nil {
+			s.logger.Error("failed to encode connection dump", "error", err)
+		}
+	})
+}
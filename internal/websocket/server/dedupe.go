@@ -0,0 +1,180 @@
+package server
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// SendClassAnnouncement deduplicates announcements by ID, e.g. one replayed on connect and delivered at its
+// start. The other send classes are the channel types labelling publications in metrics (e.g. margin, rate,
+// raw), deduplicated as they are written to the client.
+const SendClassAnnouncement = "announcement"
+
+// sendDedupe remembers the hashes of the last messages of each class sent to every client, so a message
+// reaching a client through two paths is sent once
+type sendDedupe struct {
+	// windows is the number of messages remembered per client by class; classes without one aren't deduplicated
+	windows map[string]int
+
+	// publications is set when a channel class has a window, so writes skip the lookup otherwise
+	publications bool
+
+	clients sync.Map
+}
+
+// clientSends holds the recent messages of one client by class
+type clientSends struct {
+	mu    sync.Mutex
+	rings map[string]*sendRing
+}
+
+// sendRing holds a client's most recent messages of one class, oldest first from next once full
+type sendRing struct {
+	entries []sendEntry
+	next    int
+}
+
+// sendEntry is the hash of a message and of the stream it was sent on, e.g. its channel
+type sendEntry struct {
+	stream  uint64
+	message uint64
+}
+
+// SetSendDedupe remembers the given number of recent messages per client for each send class (see
+// SendClassAnnouncement), skipping repeated sends of the same message. Zero windows disable a class.
+func (s *CentrifugeServer) SetSendDedupe(windows map[string]int) error {
+	for class, window := range windows {
+		if !validSendClass(class) {
+			return fmt.Errorf("unknown send dedupe class %q", class)
+		}
+		if window < 0 {
+			return fmt.Errorf("send dedupe window of %q must not be negative", class)
+		}
+	}
+	s.dedupe = newSendDedupe(windows)
+	return nil
+}
+
+// validSendClass reports whether a dedupe window can be set for a class: announcements, or the publications
+// of a user channel type, a registered family or the raw variants
+func validSendClass(class string) bool {
+	return class == SendClassAnnouncement || class == "raw" ||
+		channel.ValidUserChannel(class) || channel.IsRegistered(class+":")
+}
+
+func newSendDedupe(windows map[string]int) *sendDedupe {
+	d := &sendDedupe{windows: windows}
+	for class, window := range windows {
+		if class != SendClassAnnouncement && window > 0 {
+			d.publications = true
+		}
+	}
+	return d
+}
+
+// seen records a message sent to a client on a stream, reporting whether it is the last message of that
+// stream among the client's recent messages of the class. A message repeating an older one of its stream
+// is sent again, as a state published A, B then A again must end on A. A nil dedupe remembers nothing.
+func (d *sendDedupe) seen(clientID, class, stream string, message []byte) bool {
+	if d == nil || d.windows[class] <= 0 {
+		return false
+	}
+
+	entry := sendEntry{stream: hashSend([]byte(stream)), message: hashSend(message)}
+
+	v, ok := d.clients.Load(clientID)
+	if !ok {
+		v, _ = d.clients.LoadOrStore(clientID, &clientSends{rings: make(map[string]*sendRing)})
+	}
+	sends := v.(*clientSends)
+
+	sends.mu.Lock()
+	defer sends.mu.Unlock()
+
+	ring := sends.rings[class]
+	if ring == nil {
+		ring = &sendRing{}
+		sends.rings[class] = ring
+	}
+
+	// Walk back from the newest message to the last one of the stream
+	for i := 1; i <= len(ring.entries); i++ {
+		last := ring.entries[(ring.next-i+len(ring.entries))%len(ring.entries)]
+		if last.stream == entry.stream {
+			if last.message == entry.message {
+				return true
+			}
+			break
+		}
+	}
+
+	if len(ring.entries) < d.windows[class] {
+		ring.entries = append(ring.entries, entry)
+		ring.next = len(ring.entries) % d.windows[class]
+		return false
+	}
+	ring.entries[ring.next] = entry
+	ring.next = (ring.next + 1) % len(ring.entries)
+	return false
+}
+
+// hashSend hashes a stream or message for the dedupe rings
+func hashSend(b []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(b)
+	return h.Sum64()
+}
+
+// forget drops the messages remembered for a disconnected client
+func (d *sendDedupe) forget(clientID string) {
+	if d == nil {
+		return
+	}
+	d.clients.Delete(clientID)
+}
+
+// duplicateSend reports whether a message of the class was already sent to the client on the stream,
+// counting it. Messages without a body, e.g. announcements keyed by ID, are deduplicated by stream alone.
+func (s *CentrifugeServer) duplicateSend(client *centrifuge.Client, class, stream string, message []byte) bool {
+	if !s.dedupe.seen(client.ID(), class, stream, message) {
+		return false
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordDuplicateSend(s.config.NodeName, class)
+	}
+	s.logger.Debug("duplicate send suppressed",
+		"client_id", client.ID(),
+		"class", class,
+		"stream", stream)
+	return true
+}
+
+// duplicatePublication reports whether a write bound to a channel repeats the last one written to the client
+// on that channel, within the window of the channel's class. Publications of channels with history carry
+// their offset, so only a publication enqueued for the client by two broadcasts is dropped.
+func (s *CentrifugeServer) duplicatePublication(client *centrifuge.Client, e centrifuge.TransportWriteEvent) bool {
+	if s.dedupe == nil || !s.dedupe.publications || e.Channel == "" {
+		return false
+	}
+	return s.duplicateSend(client, hubChannelType(e.Channel), e.Channel, e.Data)
+}
+
+// writeTransport drops the duplicate publications written to a client and records the others for the
+// running captures
+func (s *CentrifugeServer) writeTransport(client *centrifuge.Client, e centrifuge.TransportWriteEvent) bool {
+	if s.duplicatePublication(client, e) {
+		return false
+	}
+	return s.capturePublication(client, e)
+}
+
+// forgetSends drops the recent sends of a disconnected client
+func (s *CentrifugeServer) forgetSends(event HubEvent) {
+	s.dedupe.forget(event.Client.ID())
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Notification ops replicating force-revocations to every node
+const (
+	opRevokeEntitlement  = "entitlement.revoke"
+	opRestoreEntitlement = "entitlement.restore"
+)
+
+// EntitlementProvider checks and force-revokes users' futures entitlement (implemented by the coin-cfx-adapter client)
+type EntitlementProvider interface {
+	CheckEntitlement(ctx context.Context, ajaibID string) (bool, error)
+	Revoke(ajaibID string)
+	Restore(ajaibID string)
+	Revoked() []string
+}
+
+// SetEntitlementProvider sets the provider rejecting connections of users without futures entitlement
+func (s *CentrifugeServer) SetEntitlementProvider(provider EntitlementProvider) {
+	s.entitlements = provider
+}
+
+// checkEntitlement reports whether the user may connect or read snapshots. Lookup failures let the user in: entitlement
+// is checked again on delivery, and coin-cfx-adapter outages must not lock every user out.
+func (s *CentrifugeServer) checkEntitlement(ctx context.Context, clientID, ajaibID string) bool {
+	if s.entitlements == nil {
+		return true
+	}
+
+	entitled, err := s.entitlements.CheckEntitlement(ctx, ajaibID)
+	if err != nil {
+		s.logger.Warn("entitlement check failed, allowing connection",
+			"client_id", clientID,
+			"ajaib_id", ajaibID,
+			"error", err)
+		return true
+	}
+	return entitled
+}
+
+// RevokeEntitlement force-revokes the user's entitlement and disconnects their sessions on every node
+func (s *CentrifugeServer) RevokeEntitlement(ajaibID string) error {
+	if s.entitlements != nil {
+		if err := s.node.Notify(opRevokeEntitlement, []byte(ajaibID), ""); err != nil {
+			return err
+		}
+	}
+	return s.node.Disconnect(ajaibID, centrifuge.WithCustomDisconnect(protocol.ErrEntitlementRevoked().ToDisconnect()))
+}
+
+// RestoreEntitlement lifts the user's force-revocation on every node
+func (s *CentrifugeServer) RestoreEntitlement(ajaibID string) error {
+	if s.entitlements == nil {
+		return nil
+	}
+	return s.node.Notify(opRestoreEntitlement, []byte(ajaibID), "")
+}
+
+// handleEntitlementNotification applies a force-revocation replicated from any node, including this one
+func (s *CentrifugeServer) handleEntitlementNotification(op string, data []byte) {
+	switch op {
+	case opRevokeEntitlement:
+		s.entitlements.Revoke(string(data))
+	case opRestoreEntitlement:
+		s.entitlements.Restore(string(data))
+	}
+}
+
+// EntitlementsHandler returns the admin HTTP handler listing (GET), force-revoking (POST ?ajaib_id=)
+// and restoring (DELETE ?ajaib_id=) user entitlements
+func (s *CentrifugeServer) EntitlementsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.entitlements == nil {
+			http.Error(w, "entitlement checks are disabled", http.StatusNotFound)
+			return
+		}
+
+		ajaibID := r.URL.Query().Get("ajaib_id")
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(map[string][]string{"revoked": s.entitlements.Revoked()}); err != nil {
+				s.logger.Error("failed to encode revoked entitlements", "error", err)
+			}
+		case http.MethodPost:
+			if ajaibID == "" {
+				http.Error(w, "ajaib_id is required", http.StatusBadRequest)
+				return
+			}
+
+			if err := s.RevokeEntitlement(ajaibID); err != nil {
+				s.logger.Error("failed to revoke entitlement", "ajaib_id", ajaibID, "error", err)
+				http.Error(w, "failed to revoke entitlement on every node", http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			if ajaibID == "" {
+				http.Error(w, "ajaib_id is required", http.StatusBadRequest)
+				return
+			}
+
+			if err := s.RestoreEntitlement(ajaibID); err != nil {
+				s.logger.Error("failed to restore entitlement", "ajaib_id", ajaibID, "error", err)
+				http.Error(w, "failed to restore entitlement on every node", http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
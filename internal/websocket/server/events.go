@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ConnectionEventType identifies a client connection lifecycle event
+type ConnectionEventType string
+
+const (
+	EventConnected    ConnectionEventType = "connected"
+	EventSubscribed   ConnectionEventType = "subscribed"
+	EventUnsubscribed ConnectionEventType = "unsubscribed"
+	EventDisconnected ConnectionEventType = "disconnected"
+)
+
+// eventPublishTimeout bounds how long a handler may wait on the event publisher
+const eventPublishTimeout = time.Second
+
+// EventPublisher publishes serialized connection events (implemented by the Kafka producer)
+type EventPublisher interface {
+	Publish(ctx context.Context, key []byte, value []byte) error
+}
+
+// DisconnectListener is notified after a client disconnects and its subscriptions are released
+type DisconnectListener interface {
+	OnClientDisconnect(clientID string, info *ClientInfo)
+}
+
+// ConnectionEvent is the payload emitted for each connection lifecycle transition
+type ConnectionEvent struct {
+	Type              ConnectionEventType `json:"type"`
+	NodeName          string              `json:"node_name"`
+	ClientID          string              `json:"client_id"`
+	SessionID         string              `json:"session_id,omitempty"`
+	AjaibID           string              `json:"ajaib_id"`
+	ClientIP          string              `json:"client_ip,omitempty"`
+	Channel           string              `json:"channel,omitempty"`
+	DisconnectCode    uint32              `json:"disconnect_code,omitempty"`
+	DisconnectReason  string              `json:"disconnect_reason,omitempty"`
+	SessionDurationMs int64               `json:"session_duration_ms,omitempty"`
+	Timestamp         int64               `json:"timestamp"`
+}
+
+// SetEventPublisher sets the publisher used to emit connection lifecycle events
+func (s *CentrifugeServer) SetEventPublisher(publisher EventPublisher) {
+	s.eventPublisher = publisher
+}
+
+// AddDisconnectListener registers a listener notified on every client disconnect.
+// Listeners must be added before the server starts.
+func (s *CentrifugeServer) AddDisconnectListener(listener DisconnectListener) {
+	s.disconnectListeners = append(s.disconnectListeners, listener)
+}
+
+// notifyDisconnect calls the registered disconnect listeners; info is nil for unauthenticated clients
+func (s *CentrifugeServer) notifyDisconnect(clientID string, info *ClientInfo) {
+	for _, listener := range s.disconnectListeners {
+		listener.OnClientDisconnect(clientID, info)
+	}
+}
+
+// newConnectionEvent builds a connection event for the given client
+func (s *CentrifugeServer) newConnectionEvent(eventType ConnectionEventType, client *centrifuge.Client) ConnectionEvent {
+	event := ConnectionEvent{
+		Type:      eventType,
+		NodeName:  s.config.NodeName,
+		ClientID:  client.ID(),
+		AjaibID:   client.UserID(),
+		Timestamp: time.Now().UnixMilli(),
+	}
+	if info := s.getClientInfo(client); info != nil {
+		event.ClientIP = info.ClientIP
+		event.SessionID = info.SessionID
+	}
+	return event
+}
+
+// emitEvent publishes a connection event keyed by ajaib_id so a user's events stay ordered
+func (s *CentrifugeServer) emitEvent(event ConnectionEvent) {
+	if s.eventPublisher == nil {
+		return
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("failed to marshal connection event",
+			"type", event.Type,
+			"client_id", event.ClientID,
+			"error", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), eventPublishTimeout)
+	defer cancel()
+
+	if err := s.eventPublisher.Publish(ctx, []byte(event.AjaibID), data); err != nil {
+		s.logger.Warn("failed to publish connection event",
+			"type", event.Type,
+			"client_id", event.ClientID,
+			"error", err)
+	}
+}
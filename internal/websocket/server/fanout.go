@@ -0,0 +1,70 @@
+package server
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// minFanOutShard is the smallest shard worth a goroutine; smaller fan-outs run serially
+const minFanOutShard = 1000
+
+// SetFanOutWorkers sets how many goroutines deliver server-side sends (announcements, disconnects) to
+// large client lists. Zero or one delivers serially.
+func (s *CentrifugeServer) SetFanOutWorkers(workers int) {
+	s.fanOutWorkers = workers
+}
+
+// fanOut calls fn for every client, clients of low-latency profiles first, splitting the list into
+// contiguous shards handled concurrently. Each client is handled by exactly one worker and fanOut
+// returns only when all are done, so consecutive fan-outs reach every client in order.
+func (s *CentrifugeServer) fanOut(clients []*centrifuge.Client, fn func(client *centrifuge.Client)) {
+	priority, rest := s.lowLatencyFirst(clients)
+	s.fanOutShards(priority, fn)
+	s.fanOutShards(rest, fn)
+}
+
+// lowLatencyFirst splits clients into those of low-latency profiles and the others
+func (s *CentrifugeServer) lowLatencyFirst(clients []*centrifuge.Client) ([]*centrifuge.Client, []*centrifuge.Client) {
+	if !slices.ContainsFunc(s.profiles, func(p profileHandler) bool { return p.profile.LowLatency }) &&
+		!s.defaultProfile.profile.LowLatency {
+		return nil, clients
+	}
+
+	var priority, rest []*centrifuge.Client
+	for _, client := range clients {
+		if s.clientProfile(client.Context()).LowLatency {
+			priority = append(priority, client)
+		} else {
+			rest = append(rest, client)
+		}
+	}
+	return priority, rest
+}
+
+// fanOutShards calls fn for every client, in concurrent shards when the list is large enough
+func (s *CentrifugeServer) fanOutShards(clients []*centrifuge.Client, fn func(client *centrifuge.Client)) {
+	workers := min(s.fanOutWorkers, len(clients)/minFanOutShard)
+	if workers <= 1 {
+		for _, client := range clients {
+			fn(client)
+		}
+		return
+	}
+
+	shardSize := (len(clients) + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < len(clients); start += shardSize {
+		shard := clients[start:min(start+shardSize, len(clients))]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, client := range shard {
+				fn(client)
+			}
+		}()
+	}
+	wg.Wait()
+}
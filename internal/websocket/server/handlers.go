@@ -5,10 +5,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"coin-futures-websocket/internal/auth"
+	"coin-futures-websocket/internal/clientip"
+	"coin-futures-websocket/internal/featureflag"
 	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/protocol"
 
 	"github.com/centrifugal/centrifuge"
 )
@@ -23,13 +27,38 @@ func (s *CentrifugeServer) SetupHandlers() {
 	// Connect handler - called when client connects and is ready to communicate
 	// We set up per-client handlers here.
 	s.node.OnConnect(func(client *centrifuge.Client) {
-		// Track successful connection in metrics
-		if s.metrics != nil {
-			s.metrics.RecordConnection(s.config.NodeName)
-		}
+		s.bus.Publish(HubEvent{
+			Type:   HubClientRegistered,
+			Client: client,
+			Info:   s.getClientInfo(client),
+		})
 		s.setupClientHandlers(client)
+		s.replayAnnouncements(client)
+		s.replayCriticals(client)
 	})
 
+	// Command read handler - rejects client messages over the connection profile's size limit
+	s.node.OnCommandRead(s.checkMessageSize)
+
+	// Transport write handler - drops duplicate publications and records the others for the capture endpoint
+	s.node.OnTransportWrite(s.writeTransport)
+
+	// Notification handler - replicates scheduled announcements, delivery receipts and entitlement
+	// revocations across nodes
+	if s.announcements != nil || s.receipts != nil || s.entitlements != nil {
+		s.node.OnNotification(func(e centrifuge.NotificationEvent) {
+			if s.announcements != nil {
+				s.announcements.HandleNotification(e.Op, e.Data)
+			}
+			if s.receipts != nil {
+				s.receipts.HandleNotification(e.Op, e.Data)
+			}
+			if s.entitlements != nil {
+				s.handleEntitlementNotification(e.Op, e.Data)
+			}
+		})
+	}
+
 	s.logger.Info("centrifuge handlers configured")
 }
 
@@ -37,6 +66,12 @@ func (s *CentrifugeServer) SetupHandlers() {
 func (s *CentrifugeServer) handleConnect(ctx context.Context, e centrifuge.ConnectEvent) (centrifuge.ConnectReply, error) {
 	reply := centrifuge.ConnectReply{}
 
+	// The connect command ends the handshake deadline of the upgrade
+	handshakeFrom(ctx).connect()
+
+	// Real client IP resolved by the HTTP middleware (behind trusted load balancers)
+	clientIP, _ := clientip.ClientIPFrom(ctx)
+
 	// Extract JWT from the token field in ConnectEvent
 	// In Centrifuge, clients typically send a connection token in the Connect command
 	token := e.Token
@@ -50,32 +85,102 @@ func (s *CentrifugeServer) handleConnect(ctx context.Context, e centrifuge.Conne
 		if err != nil {
 			s.logger.Warn("unauthorized, failed to extract JWT",
 				"client_id", e.ClientID,
+				"client_ip", clientIP,
 				"error", err)
-			return reply, NewError(CodeUnauthorized, DisconnectReasons.Unauthorized())
+			return reply, protocol.ErrUnauthorized("missing token").ToCentrifuge()
 		}
 	}
 
-	ajaibID, err := s.parseAjaibIDFromToken(token)
+	claims, err := auth.NewParser().Parse(token)
 	if err != nil {
 		s.logger.Warn("unauthorized, failed to parse ajaib_id from token",
 			"client_id", e.ClientID,
+			"client_ip", clientIP,
 			"error", err)
-		return reply, NewError(CodeUnauthorized, DisconnectReasons.Unauthorized())
+		return reply, protocol.ErrUnauthorized("malformed token").ToCentrifuge()
+	}
+
+	// A support agent's impersonation token reads another user's channels
+	ajaibID, agent, perr := sessionUser(claims)
+	if perr != nil {
+		s.logger.Warn("impersonation rejected, missing scope",
+			"client_id", e.ClientID,
+			"client_ip", clientIP,
+			"agent", claims.Sub,
+			"ajaib_id", claims.Impersonate)
+		return reply, perr.ToCentrifuge()
+	}
+
+	// Device identity lets a reconnecting device replace its own stale session
+	deviceID := claims.DeviceID
+	if deviceID == "" {
+		deviceID, _ = auth.DeviceIDFrom(ctx)
+	}
+
+	// Binary (protobuf) protocol is rolled out behind a feature flag
+	if e.Transport.Protocol() == centrifuge.ProtocolTypeProtobuf && !s.featureEnabled(featureflag.FlagBinaryProtocol, ajaibID) {
+		s.logger.Warn("binary protocol rejected, feature disabled",
+			"client_id", e.ClientID,
+			"client_ip", clientIP,
+			"ajaib_id", ajaibID)
+		return reply, protocol.ErrBadRequest("binary protocol is not enabled").ToCentrifuge()
+	}
+
+	// Revoked accounts must not reconnect to receive data
+	if !s.checkEntitlement(ctx, e.ClientID, ajaibID) {
+		s.logger.Warn("connection rejected, futures entitlement revoked",
+			"client_id", e.ClientID,
+			"client_ip", clientIP,
+			"ajaib_id", ajaibID)
+		return reply, protocol.ErrEntitlementRevoked().ToCentrifuge()
 	}
 
-	// Enforce per-user connection limit
-	if s.maxConnectionsPerUser > 0 {
+	// Users held by another region's CFX cluster reconnect to that region rather than receive relayed data
+	if perr := s.regionRedirect(ctx, e.ClientID, ajaibID); perr != nil {
+		s.logger.Info("connection redirected to user's region",
+			"client_id", e.ClientID,
+			"client_ip", clientIP,
+			"ajaib_id", ajaibID,
+			"region", perr.Details["region"])
+		return reply, perr.ToCentrifuge()
+	}
+
+	// Enforce per-user connection limit; impersonation sessions are not the user's connections
+	var stale *centrifuge.Client
+	var superseded []*centrifuge.Client
+	if s.maxConnectionsPerUser > 0 && agent == "" {
 		existingConns := s.node.Hub().UserConnections(ajaibID)
+
+		// A reconnecting device replaces its own stale session first; otherwise the supersede
+		// policy makes room by disconnecting the oldest sessions
 		if len(existingConns) >= s.maxConnectionsPerUser {
+			stale = s.staleDeviceSession(existingConns, deviceID)
+			if stale == nil && s.connectionLimitPolicy == LimitSupersede {
+				superseded = s.oldestSessions(existingConns)
+			}
+		}
+
+		if len(existingConns) >= s.maxConnectionsPerUser && stale == nil && len(superseded) == 0 {
 			s.logger.Warn("connection limit reached",
 				"client_id", e.ClientID,
+				"client_ip", clientIP,
 				"ajaib_id", ajaibID,
 				"current_connections", len(existingConns),
 				"max_connections", s.maxConnectionsPerUser)
-			return reply, NewError(CodeConnectionLimit, DisconnectReasons.ConnectionLimit())
+			return reply, s.withBackoff(protocol.ErrConnectionLimit(len(existingConns), s.maxConnectionsPerUser)).ToCentrifuge()
 		}
 	}
 
+	// A session ID correlates the client's connections across reconnects
+	sessionID, perr := s.resolveSessionID(e.Data)
+	if perr != nil {
+		s.logger.Warn("invalid session_id",
+			"client_id", e.ClientID,
+			"client_ip", clientIP,
+			"ajaib_id", ajaibID)
+		return reply, perr.ToCentrifuge()
+	}
+
 	// Resolve CFX user ID
 	cfxUserID, err := s.resolveCfxUserID(ctx, ajaibID)
 	if err != nil {
@@ -83,7 +188,7 @@ func (s *CentrifugeServer) handleConnect(ctx context.Context, e centrifuge.Conne
 			"client_id", e.ClientID,
 			"ajaib_id", ajaibID,
 			"error", err)
-		return reply, NewError(CodeCfxUserResolution, DisconnectReasons.CfxUserResolutionError())
+		return reply, s.withBackoff(protocol.ErrCfxUserResolution()).ToCentrifuge()
 	}
 
 	// Fetch user quote preference
@@ -93,29 +198,72 @@ func (s *CentrifugeServer) handleConnect(ctx context.Context, e centrifuge.Conne
 			"client_id", e.ClientID,
 			"ajaib_id", ajaibID,
 			"error", err)
-		return reply, NewError(CodeUserPreference, DisconnectReasons.UserPreferenceError())
+		return reply, s.withBackoff(protocol.ErrUserPreference()).ToCentrifuge()
 	}
 
 	// Create connection info with user data
+	now := time.Now()
 	connInfo := ClientInfo{
 		AjaibID:         ajaibID,
 		CfxUserID:       cfxUserID,
 		QuotePreference: quotePreference,
-		ConnectedAt:     time.Now().UnixMilli(),
+		ConnectedAt:     now.UnixMilli(),
+		ClientIP:        clientIP,
+		DeviceID:        deviceID,
+		SessionID:       sessionID,
+		Scope:           claims.Scope,
+		ImpersonatedBy:  agent,
+	}
+
+	// Limited sessions must re-authenticate with a new token before their maximum duration ends
+	var expireAt int64
+	if s.maxSession() > 0 {
+		expiry := s.sessionExpiry(now)
+		expireAt = expiry.Unix()
+		connInfo.SessionExpiresAt = expiry.UnixMilli()
+		connInfo.TokenHash = tokenHash(token)
+		reply.ClientSideRefresh = true
 	}
 	infoData, _ := json.Marshal(connInfo)
 
+	// Impersonation sessions belong to the agent, so the user's limits and presence never count them
+	userID := ajaibID
+	if agent != "" {
+		userID = agent
+	}
+
 	// Create connection credentials
 	reply.Credentials = &centrifuge.Credentials{
-		UserID: ajaibID,
-		Info:   infoData,
+		UserID:   userID,
+		ExpireAt: expireAt,
+		Info:     infoData,
 	}
 
+	// Tell the client which replica it is attached to for support and LB debugging, and how to keep
+	// its connection alive
+	reply.Data, _ = json.Marshal(ConnectReplyData{
+		Instance:  s.Instance(),
+		Keepalive: s.clientProfile(ctx).keepaliveInfo(),
+		SessionID: sessionID,
+	})
+
+	// The connection profile sizes the send queue of its lane and how writes are batched
+	s.clientProfile(ctx).applySendQueue(&reply)
+
+	// Sessions the new connection replaces or supersedes are only disconnected once it passed every check
+	if stale != nil {
+		s.replaceDeviceSession(stale, deviceID, e.ClientID)
+	}
+	s.supersedeSessions(superseded, e.ClientID)
+
 	s.logger.Info("client connected via centrifuge",
 		"client_id", e.ClientID,
+		"session_id", sessionID,
+		"client_ip", clientIP,
 		"ajaib_id", ajaibID,
 		"cfx_user_id", cfxUserID,
-		"quote_preference", quotePreference)
+		"quote_preference", quotePreference,
+		"impersonated_by", agent)
 
 	return reply, nil
 }
@@ -124,7 +272,7 @@ func (s *CentrifugeServer) handleConnect(ctx context.Context, e centrifuge.Conne
 func (s *CentrifugeServer) setupClientHandlers(client *centrifuge.Client) {
 	// Refresh handler - for token expiration
 	client.OnRefresh(func(e centrifuge.RefreshEvent, callback centrifuge.RefreshCallback) {
-		s.handleRefresh(e, callback)
+		s.handleRefresh(client, e, callback)
 	})
 
 	// Subscribe handler - for channel subscription validation
@@ -132,14 +280,19 @@ func (s *CentrifugeServer) setupClientHandlers(client *centrifuge.Client) {
 		s.handleSubscribe(client, e, callback)
 	})
 
+	// Unsubscribe handler - for connection event tracking
+	client.OnUnsubscribe(func(e centrifuge.UnsubscribeEvent) {
+		s.handleUnsubscribe(client, e)
+	})
+
 	// Publish handler - for client publish validation
 	client.OnPublish(func(e centrifuge.PublishEvent, callback centrifuge.PublishCallback) {
 		s.handlePublish(e, callback)
 	})
 
-	// RPC handler - for future extensibility
+	// RPC handler - for bulk subscribe and client keepalive pings
 	client.OnRPC(func(e centrifuge.RPCEvent, callback centrifuge.RPCCallback) {
-		s.handleRPC(e, callback)
+		s.handleRPC(client, e, callback)
 	})
 
 	// Disconnect handler - for cleanup
@@ -148,61 +301,164 @@ func (s *CentrifugeServer) setupClientHandlers(client *centrifuge.Client) {
 	})
 }
 
-// handleRefresh handles client token refresh requests
-func (s *CentrifugeServer) handleRefresh(e centrifuge.RefreshEvent, callback centrifuge.RefreshCallback) {
-	// For now, we don't have token expiration, so just allow refresh without changes
-	reply := centrifuge.RefreshReply{
-		ExpireAt: 0, // No expiration
+// handleSubscribe handles channel subscription requests
+func (s *CentrifugeServer) handleSubscribe(client *centrifuge.Client, e centrifuge.SubscribeEvent, callback centrifuge.SubscribeCallback) {
+	reply := centrifuge.SubscribeReply{}
+
+	clientInfo := s.getClientInfo(client)
+	channelInfo, perr := s.authorizeChannel(client, clientInfo, e.Channel)
+	if perr != nil {
+		callback(reply, perr.ToCentrifuge())
+		return
+	}
+
+	// Let the client negotiate delta compression when delta mode is on for the user
+	if s.featureEnabled(featureflag.FlagDeltaMode, channelInfo.AjaibID) {
+		reply.Options.AllowedDeltaTypes = []centrifuge.DeltaType{centrifuge.DeltaTypeFossil}
 	}
+
+	// Send the current state with the acknowledgment instead of waiting for the first Kafka update
+	reply.Options.Data = s.subscribeSnapshotData(e.Channel)
+
+	s.trackSubscription(client, clientInfo, channelInfo)
+
 	callback(reply, nil)
 }
 
-// handleSubscribe handles channel subscription requests
-func (s *CentrifugeServer) handleSubscribe(client *centrifuge.Client, e centrifuge.SubscribeEvent, callback centrifuge.SubscribeCallback) {
-	reply := centrifuge.SubscribeReply{}
+// authorizeChannel validates the channel format and that it belongs to the connected user
+func (s *CentrifugeServer) authorizeChannel(client *centrifuge.Client, clientInfo *ClientInfo, ch string) (*channel.ChannelInfo, *protocol.Error) {
+	// Channel policies require scopes and client types, including the built-in internal and raw scopes
+	if err := s.policies.Authorize(ch, clientInfo.HasScope, s.clientProfile(client.Context()).Name); err != nil {
+		s.logger.Warn("subscription rejected by channel policy",
+			"client_id", client.ID(),
+			"channel", ch,
+			"error", err)
+		return nil, protocol.ErrChannelNotFound(ch, err.Error())
+	}
+
+	if channel.IsRaw(ch) {
+		return s.authorizeRawChannel(client, clientInfo, ch)
+	}
+
+	if channel.IsProjected(ch) {
+		return s.authorizeProjectedChannel(client, clientInfo, ch)
+	}
 
 	// Parse and validate channel format
-	channelInfo, err := channel.ParseChannel(e.Channel)
+	channelInfo, err := channel.ParseChannel(ch)
 	if err != nil {
 		s.logger.Warn("subscription validation failed",
 			"client_id", client.ID(),
-			"channel", e.Channel,
+			"channel", ch,
 			"error", err)
-		callback(reply, NewError(CodeChannelNotFound, err.Error()))
-		return
+		return nil, protocol.ErrChannelNotFound(ch, err.Error())
 	}
 
-	// Get user info from client credentials to validate channel ownership
-	clientInfo := s.getClientInfo(client)
-	if clientInfo != nil && clientInfo.AjaibID != "" {
-		// Verify user can only subscribe to their own channels
-		if clientInfo.AjaibID != channelInfo.AjaibID {
-			s.logger.Warn("subscription ajaib_id mismatch",
-				"client_id", client.ID(),
-				"client_ajaib_id", clientInfo.AjaibID,
-				"channel_ajaib_id", channelInfo.AjaibID,
-				"channel", e.Channel)
-			callback(reply, NewError(CodeChannelNotFound, DisconnectReasons.ChannelNotFound()))
-			return
-		}
+	// Channels without an owner carry no user data, e.g. rate: and status: channels, gated by the channel
+	// policies only
+	if channelInfo.AjaibID == "" {
+		return channelInfo, nil
 	}
 
+	if channelInfo.Instrument != "" && !s.subChannelsEnabled && !s.featureEnabled(featureflag.FlagSubChannels, channelInfo.AjaibID) {
+		s.logger.Warn("sub-channel subscription rejected, sub-channels disabled",
+			"client_id", client.ID(),
+			"channel", ch)
+		return nil, protocol.ErrChannelNotFound(ch, "sub-channels are disabled")
+	}
+
+	// Verify user can only subscribe to their own channels
+	if clientInfo != nil && clientInfo.AjaibID != "" && clientInfo.AjaibID != channelInfo.AjaibID {
+		s.logger.Warn("subscription ajaib_id mismatch",
+			"client_id", client.ID(),
+			"client_ajaib_id", clientInfo.AjaibID,
+			"channel_ajaib_id", channelInfo.AjaibID,
+			"channel", ch)
+		return nil, protocol.ErrChannelNotFound(ch, "channel belongs to another user")
+	}
+
+	return channelInfo, nil
+}
+
+// authorizeRawChannel validates a raw channel variant, whose raw scope the channel policies checked: the
+// underlying user channel must be one the user may subscribe to. Raw variants exist for full user channels only.
+func (s *CentrifugeServer) authorizeRawChannel(client *centrifuge.Client, clientInfo *ClientInfo, ch string) (*channel.ChannelInfo, *protocol.Error) {
+	channelInfo, perr := s.authorizeChannel(client, clientInfo, strings.TrimPrefix(ch, channel.PrefixRaw))
+	if perr != nil {
+		// Report the requested raw channel rather than the underlying one
+		return nil, perr.WithDetail("channel", ch)
+	}
+	if channelInfo.AjaibID == "" || channelInfo.Instrument != "" {
+		return nil, protocol.ErrChannelNotFound(ch, "raw variants exist for user channels only")
+	}
+
+	raw := *channelInfo
+	raw.Name = ch
+	return &raw, nil
+}
+
+// authorizeProjectedChannel validates a projected channel variant: its spec must be canonical and the
+// underlying channel a user channel or sub-channel the user may subscribe to
+func (s *CentrifugeServer) authorizeProjectedChannel(client *centrifuge.Client, clientInfo *ClientInfo, ch string) (*channel.ChannelInfo, *protocol.Error) {
+	_, base, err := channel.ParseProjected(ch)
+	if err != nil {
+		return nil, protocol.ErrChannelNotFound(ch, err.Error())
+	}
+	if channel.IsRaw(base) || channel.IsProjected(base) {
+		return nil, protocol.ErrChannelNotFound(ch, "projected variants exist for user channels only")
+	}
+
+	channelInfo, perr := s.authorizeChannel(client, clientInfo, base)
+	if perr != nil {
+		// Report the requested projected channel rather than the underlying one
+		return nil, perr.WithDetail("channel", ch)
+	}
+	if channelInfo.AjaibID == "" {
+		return nil, protocol.ErrChannelNotFound(ch, "projected variants exist for user channels only")
+	}
+
+	projected := *channelInfo
+	projected.Name = ch
+	return &projected, nil
+}
+
+// trackSubscription records an accepted subscription on the hub event bus
+func (s *CentrifugeServer) trackSubscription(client *centrifuge.Client, clientInfo *ClientInfo, channelInfo *channel.ChannelInfo) {
 	s.logger.Info("client subscribed to channel",
 		"client_id", client.ID(),
-		"channel", e.Channel,
+		"session_id", clientInfo.GetSessionID(),
+		"channel", channelInfo.Name,
 		"ajaib_id", channelInfo.AjaibID)
 
-	// Track subscription in metrics
-	if s.metrics != nil {
-		s.metrics.RecordSubscription(s.config.NodeName, e.Channel)
-	}
+	s.bus.Publish(HubEvent{
+		Type:    HubSubscribed,
+		Client:  client,
+		Info:    clientInfo,
+		Channel: channelInfo.Name,
+	})
+}
 
-	// Register subscription with Kafka broadcaster
-	if s.broadcaster != nil && clientInfo != nil && clientInfo.CfxUserID != "" {
-		s.broadcaster.RegisterSubscription(clientInfo.CfxUserID, clientInfo.AjaibID, clientInfo.QuotePreference)
+// handleUnsubscribe handles channel unsubscription
+func (s *CentrifugeServer) handleUnsubscribe(client *centrifuge.Client, e centrifuge.UnsubscribeEvent) {
+	clientInfo := s.getClientInfo(client)
+
+	s.logger.Info("client unsubscribed from channel",
+		"client_id", client.ID(),
+		"session_id", clientInfo.GetSessionID(),
+		"channel", e.Channel,
+		"unsubscribe_code", e.Code,
+		"unsubscribe_reason", e.Reason)
+
+	if isSlowDisconnect(e.Disconnect) {
+		s.overflows.note(client.ID(), e.Channel)
 	}
 
-	callback(reply, nil)
+	s.bus.Publish(HubEvent{
+		Type:    HubUnsubscribed,
+		Client:  client,
+		Info:    clientInfo,
+		Channel: e.Channel,
+	})
 }
 
 // handlePublish handles client publish requests
@@ -211,38 +467,35 @@ func (s *CentrifugeServer) handlePublish(e centrifuge.PublishEvent, callback cen
 
 	// For now, clients are not allowed to publish to channels
 	// All publications come from the Kafka broadcaster
-	callback(reply, NewError(CodeBadRequest, "client publishing not allowed"))
+	callback(reply, protocol.ErrBadRequest("client publishing not allowed").ToCentrifuge())
 }
 
-// handleRPC handles client RPC requests
-func (s *CentrifugeServer) handleRPC(e centrifuge.RPCEvent, callback centrifuge.RPCCallback) {
-	reply := centrifuge.RPCReply{}
-
-	// For now, RPC is not implemented
-	// This can be used for future extensibility (e.g., querying state)
-	callback(reply, NewError(CodeBadRequest, "RPC not implemented"))
+// handleRPC dispatches client RPC requests by method
+func (s *CentrifugeServer) handleRPC(client *centrifuge.Client, e centrifuge.RPCEvent, callback centrifuge.RPCCallback) {
+	switch e.Method {
+	case RPCMethodSubscribe:
+		s.handleBulkSubscribe(client, e, callback)
+	case RPCMethodPing:
+		s.handlePing(client, e, callback)
+	case RPCMethodAck:
+		s.handleAck(client, e, callback)
+	default:
+		callback(centrifuge.RPCReply{}, protocol.ErrBadRequest("RPC method not implemented").ToCentrifuge())
+	}
 }
 
 // handleDisconnect handles client disconnection
 func (s *CentrifugeServer) handleDisconnect(client *centrifuge.Client, e centrifuge.DisconnectEvent) {
-	// Track disconnection in metrics
-	if s.metrics != nil {
-		s.metrics.RecordDisconnection(s.config.NodeName)
-	}
-
 	clientInfo := s.getClientInfo(client)
+
 	if clientInfo != nil {
 		s.logger.Info("client disconnected",
 			"client_id", client.ID(),
+			"session_id", clientInfo.SessionID,
 			"ajaib_id", clientInfo.AjaibID,
 			"user_id", client.UserID(),
 			"disconnect_code", e.Code,
 			"disconnect_reason", e.Reason)
-
-		// Unregister subscription with Kafka broadcaster
-		if s.broadcaster != nil && clientInfo.CfxUserID != "" {
-			s.broadcaster.UnregisterSubscription(clientInfo.CfxUserID)
-		}
 	} else {
 		s.logger.Info("client disconnected",
 			"client_id", client.ID(),
@@ -250,6 +503,19 @@ func (s *CentrifugeServer) handleDisconnect(client *centrifuge.Client, e centrif
 			"disconnect_code", e.Code,
 			"disconnect_reason", e.Reason)
 	}
+
+	overflowed := s.overflows.take(client.ID())
+	if isSlowDisconnect(&e.Disconnect) {
+		s.recordOverflow(client, clientInfo, overflowed)
+	}
+
+	s.bus.Publish(HubEvent{
+		Type:             HubClientUnregistered,
+		Client:           client,
+		Info:             clientInfo,
+		DisconnectCode:   e.Code,
+		DisconnectReason: e.Reason,
+	})
 }
 
 // getClientInfo extracts connection info from client
@@ -266,10 +532,29 @@ func (s *CentrifugeServer) getClientInfo(client *centrifuge.Client) *ClientInfo
 	return &clientInfo
 }
 
-// parseAjaibIDFromToken extracts ajaib_id from a JWT token using the auth package
-func (s *CentrifugeServer) parseAjaibIDFromToken(token string) (string, error) {
-	parser := auth.NewParser()
-	return parser.ParseSubject(token)
+// staleDeviceSession returns the user's existing session from the same device, so a device reconnecting
+// during a network flap isn't rejected by its own stale connection, or nil if there is none
+func (s *CentrifugeServer) staleDeviceSession(existing map[string]*centrifuge.Client, deviceID string) *centrifuge.Client {
+	if deviceID == "" {
+		return nil
+	}
+
+	for _, client := range existing {
+		info := s.getClientInfo(client)
+		if info != nil && info.DeviceID == deviceID {
+			return client
+		}
+	}
+	return nil
+}
+
+// replaceDeviceSession disconnects a device's stale session replaced by its new connection
+func (s *CentrifugeServer) replaceDeviceSession(stale *centrifuge.Client, deviceID, newClientID string) {
+	s.logger.Info("disconnecting stale device session",
+		"client_id", stale.ID(),
+		"replaced_by", newClientID,
+		"device_id", deviceID)
+	stale.Disconnect(protocol.ErrSessionReplaced().ToDisconnect())
 }
 
 // extractTokenFromContext extracts JWT token from context or HTTP headers
@@ -325,6 +610,23 @@ type ClientInfo struct {
 	CfxUserID       string `json:"cfx_user_id,omitempty"`
 	QuotePreference string `json:"quote_preference"`
 	ConnectedAt     int64  `json:"connected_at"`
+	ClientIP        string `json:"client_ip,omitempty"`
+	DeviceID        string `json:"device_id,omitempty"`
+
+	// SessionID correlates the user's connections across reconnects; unlike client_id it is not unique
+	SessionID string `json:"session_id,omitempty"`
+
+	// Scope holds the space-separated scopes granted to the connection token
+	Scope string `json:"scope,omitempty"`
+
+	// ImpersonatedBy is the support agent reading AjaibID's channels in an impersonation session
+	ImpersonatedBy string `json:"impersonated_by,omitempty"`
+
+	// SessionExpiresAt is when a limited session must have re-authenticated, in Unix milliseconds
+	SessionExpiresAt int64 `json:"session_expires_at,omitempty"`
+
+	// TokenHash fingerprints the token the session was last authenticated with
+	TokenHash string `json:"token_hash,omitempty"`
 }
 
 // GetAjaibID returns the Ajaib user ID
@@ -346,3 +648,24 @@ func (ci *ClientInfo) GetQuotePreference() string {
 func (ci *ClientInfo) GetConnectedAt() int64 {
 	return ci.ConnectedAt
 }
+
+// GetSessionID returns the session ID correlating the user's connections; nil info has none
+func (ci *ClientInfo) GetSessionID() string {
+	if ci == nil {
+		return ""
+	}
+	return ci.SessionID
+}
+
+// HasScope reports whether the connection token was granted the given scope; nil info has no scopes
+func (ci *ClientInfo) HasScope(scope string) bool {
+	if ci == nil {
+		return false
+	}
+	for _, s := range strings.Fields(ci.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
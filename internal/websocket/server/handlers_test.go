@@ -1,14 +1,36 @@
 package server
 
 import (
+	"bufio"
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"io"
 	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"coin-futures-websocket/config"
+	"coin-futures-websocket/internal/auth"
+	"coin-futures-websocket/internal/cache"
+	"coin-futures-websocket/internal/featureflag"
+	"coin-futures-websocket/internal/receipt"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/policy"
+	"coin-futures-websocket/internal/websocket/protocol"
 
+	"github.com/centrifugal/centrifuge"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -51,15 +73,48 @@ func newMockKafkaBroadcaster() *mockKafkaBroadcaster {
 	}
 }
 
-func (m *mockKafkaBroadcaster) RegisterSubscription(cfxUserID, ajaibID, quotePreference string) {
+func (m *mockKafkaBroadcaster) RegisterSubscription(cfxUserID, clientID, channel, ajaibID, quotePreference string) bool {
+	_, exists := m.registered[cfxUserID]
 	m.registered[cfxUserID] = ajaibID
+	return !exists
 }
 
-func (m *mockKafkaBroadcaster) UnregisterSubscription(cfxUserID string) {
+func (m *mockKafkaBroadcaster) UnregisterSubscription(cfxUserID, clientID, channel string) {}
+
+func (m *mockKafkaBroadcaster) UnregisterClient(cfxUserID, clientID string) {
 	m.unregistered = append(m.unregistered, cfxUserID)
 	delete(m.registered, cfxUserID)
 }
 
+func (m *mockKafkaBroadcaster) Subscribers() map[string]string {
+	subscribers := make(map[string]string)
+	for cfxUserID := range m.registered {
+		subscribers["client_"+cfxUserID] = cfxUserID
+	}
+	return subscribers
+}
+
+// mockEventPublisher is a mock implementation of EventPublisher
+type mockEventPublisher struct {
+	keys   []string
+	values [][]byte
+}
+
+func (m *mockEventPublisher) Publish(ctx context.Context, key []byte, value []byte) error {
+	m.keys = append(m.keys, string(key))
+	m.values = append(m.values, value)
+	return nil
+}
+
+// mockDisconnectListener is a mock implementation of DisconnectListener
+type mockDisconnectListener struct {
+	clientIDs []string
+}
+
+func (m *mockDisconnectListener) OnClientDisconnect(clientID string, info *ClientInfo) {
+	m.clientIDs = append(m.clientIDs, clientID)
+}
+
 // TestNewCentrifugeServer tests creating a new Centrifuge server
 func TestNewCentrifugeServer(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
@@ -73,7 +128,7 @@ func TestNewCentrifugeServer(t *testing.T) {
 
 	assert.NotNil(t, server)
 	assert.NotNil(t, server.node)
-	assert.NotNil(t, server.wsHandler)
+	assert.NotNil(t, server.defaultProfile.handler)
 	assert.Equal(t, cfg, server.config)
 	assert.Equal(t, logger, server.logger)
 }
@@ -309,3 +364,2238 @@ func TestGetClientCount(t *testing.T) {
 	assert.NotNil(t, server)
 	assert.NotNil(t, server.node)
 }
+
+// TestEmitEvent tests that connection events are published keyed by ajaib_id
+func TestEmitEvent(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+
+	// Without a publisher, emitting is a no-op
+	server.emitEvent(ConnectionEvent{Type: EventConnected, AjaibID: "12345"})
+
+	publisher := &mockEventPublisher{}
+	server.SetEventPublisher(publisher)
+
+	server.emitEvent(ConnectionEvent{
+		Type:              EventDisconnected,
+		NodeName:          "test-node",
+		ClientID:          "client-1",
+		AjaibID:           "12345",
+		DisconnectCode:    3000,
+		DisconnectReason:  "transport closed",
+		SessionDurationMs: 60000,
+		Timestamp:         1700000060000,
+	})
+
+	require.Len(t, publisher.values, 1)
+	assert.Equal(t, "12345", publisher.keys[0])
+
+	var event ConnectionEvent
+	require.NoError(t, json.Unmarshal(publisher.values[0], &event))
+	assert.Equal(t, EventDisconnected, event.Type)
+	assert.Equal(t, uint32(3000), event.DisconnectCode)
+	assert.Equal(t, int64(60000), event.SessionDurationMs)
+}
+
+// testToken builds an unsigned JWT with the given subject
+func testToken(sub string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + sub + `"}`))
+	return header + "." + payload + ".sig"
+}
+
+// runNode runs the server's node until the test ends, so publications reach its broker
+func runNode(t *testing.T, server *CentrifugeServer) {
+	t.Helper()
+	require.NoError(t, server.node.Run())
+	t.Cleanup(func() {
+		_ = server.node.Shutdown(context.Background())
+	})
+}
+
+// testTransport is a bidirectional JSON transport discarding what is written to it
+type testTransport struct{}
+
+func (testTransport) Name() string                                { return "test" }
+func (testTransport) AcceptProtocol() string                      { return "" }
+func (testTransport) Protocol() centrifuge.ProtocolType           { return centrifuge.ProtocolTypeJSON }
+func (testTransport) ProtocolVersion() centrifuge.ProtocolVersion { return centrifuge.ProtocolVersion2 }
+func (testTransport) Unidirectional() bool                        { return false }
+func (testTransport) Emulation() bool                             { return false }
+func (testTransport) DisabledPushFlags() uint64                   { return 0 }
+func (testTransport) PingPongConfig() centrifuge.PingPongConfig   { return centrifuge.PingPongConfig{} }
+func (testTransport) Write([]byte) error                          { return nil }
+func (testTransport) WriteMany(...[]byte) error                   { return nil }
+func (testTransport) Close(centrifuge.Disconnect) error           { return nil }
+
+// recordingTransport is a unidirectional JSON transport keeping the pushes written to it, so clients connect
+// without a command reply
+type recordingTransport struct {
+	testTransport
+
+	mu     sync.Mutex
+	frames [][]byte
+}
+
+func (*recordingTransport) Unidirectional() bool { return true }
+
+func (t *recordingTransport) Write(data []byte) error {
+	return t.WriteMany(data)
+}
+
+func (t *recordingTransport) WriteMany(data ...[]byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, frame := range data {
+		t.frames = append(t.frames, append([]byte(nil), frame...))
+	}
+	return nil
+}
+
+// publications returns the publications written, as "{channel} {data}"
+func (t *recordingTransport) publications() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var pubs []string
+	for _, frame := range t.frames {
+		var push struct {
+			Channel string `json:"channel"`
+			Pub     *struct {
+				Data json.RawMessage `json:"data"`
+			} `json:"pub"`
+		}
+		if json.Unmarshal(frame, &push) == nil && push.Pub != nil {
+			pubs = append(pubs, push.Channel+" "+string(push.Pub.Data))
+		}
+	}
+	return pubs
+}
+
+// newTestClient creates a client of the server's node over a test transport, closed when the test ends
+func newTestClient(t *testing.T, server *CentrifugeServer) *centrifuge.Client {
+	t.Helper()
+	client, closeClient, err := centrifuge.NewClient(context.Background(), server.node, testTransport{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = closeClient()
+	})
+	return client
+}
+
+// TestSnapshotHandler tests authentication and ownership checks of the snapshot endpoint
+func TestSnapshotHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+
+	mux := http.NewServeMux()
+	mux.Handle(SnapshotPath, server.SnapshotHandler())
+
+	tests := []struct {
+		name       string
+		channel    string
+		token      string
+		wantStatus int
+		wantCode   uint32
+	}{
+		{"missing token", "user:12345:margin", "", http.StatusUnauthorized, 4100},
+		{"invalid channel", "user:12345:orders", testToken("12345"), http.StatusBadRequest, 4001},
+		{"other user's channel", "user:99999:margin", testToken("12345"), http.StatusForbidden, 4001},
+		{"no snapshot yet", "user:12345:position", testToken("12345"), http.StatusNotFound, 4001},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/snapshot/"+tt.channel, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+
+			var body struct {
+				Code uint32 `json:"code"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, tt.wantCode, body.Code)
+		})
+	}
+}
+
+// TestSnapshotLastValues tests that snapshots fall back to the last-value cache when history has none
+func TestSnapshotLastValues(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+
+	pub, _, err := server.latestPublication("user:12345:margin")
+	require.NoError(t, err)
+	assert.Nil(t, pub)
+
+	lastValues := cache.NewLastValues(cache.NewMemoryStore(), time.Minute)
+	require.NoError(t, lastValues.Put(context.Background(), "user:12345:margin", cache.LastValue{
+		Offset: 7,
+		Epoch:  "abc",
+		Time:   1700000000000,
+		Data:   json.RawMessage(`{"asset":"USDT"}`),
+	}))
+	server.SetLastValues(lastValues)
+
+	pub, epoch, err := server.latestPublication("user:12345:margin")
+	require.NoError(t, err)
+	require.NotNil(t, pub)
+	assert.Equal(t, "abc", epoch)
+	assert.EqualValues(t, 7, pub.Offset)
+	assert.JSONEq(t, `{"asset":"USDT"}`, string(pub.Data))
+}
+
+// TestSnapshotExpiry tests that snapshots past the TTL of their channel policy are not served
+func TestSnapshotExpiry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+
+	policies, err := policy.NewSet([]policy.Policy{{Pattern: "user:*:margin", TTL: 5 * time.Second}})
+	require.NoError(t, err)
+	server.SetChannelPolicies(policies)
+
+	lastValues := cache.NewLastValues(cache.NewMemoryStore(), time.Minute)
+	server.SetLastValues(lastValues)
+	for ch, age := range map[string]time.Duration{"user:12345:margin": 10 * time.Second, "user:12345:position": time.Hour} {
+		require.NoError(t, lastValues.Put(context.Background(), ch, cache.LastValue{
+			Time: time.Now().Add(-age).UnixMilli(),
+			Data: json.RawMessage(`{}`),
+		}))
+	}
+
+	pub, _, err := server.latestPublication("user:12345:margin")
+	require.NoError(t, err)
+	assert.Nil(t, pub)
+
+	pub, _, err = server.latestPublication("user:12345:position")
+	require.NoError(t, err)
+	assert.NotNil(t, pub, "position channel has no TTL")
+}
+
+// TestNotifyDisconnect tests that every registered disconnect listener is notified
+func TestNotifyDisconnect(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+
+	// Without listeners, notifying is a no-op
+	server.notifyDisconnect("client-1", nil)
+
+	first := &mockDisconnectListener{}
+	second := &mockDisconnectListener{}
+	server.AddDisconnectListener(first)
+	server.AddDisconnectListener(second)
+
+	server.notifyDisconnect("client-1", &ClientInfo{AjaibID: "12345"})
+	server.notifyDisconnect("client-2", nil)
+
+	assert.Equal(t, []string{"client-1", "client-2"}, first.clientIDs)
+	assert.Equal(t, []string{"client-1", "client-2"}, second.clientIDs)
+}
+
+// staticFlags enables a fixed set of feature flags for every user
+type staticFlags map[string]bool
+
+func (f staticFlags) Enabled(name, ajaibID string) bool {
+	return f[name]
+}
+
+// TestFeatureEnabled tests that features are off until a flag provider enables them
+func TestFeatureEnabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	assert.False(t, server.featureEnabled(featureflag.FlagDeltaMode, "12345"))
+
+	server.SetFeatureFlags(staticFlags{featureflag.FlagDeltaMode: true})
+	assert.True(t, server.featureEnabled(featureflag.FlagDeltaMode, "12345"))
+	assert.False(t, server.featureEnabled(featureflag.FlagSubChannels, "12345"))
+}
+
+// TestBulkSubscribe tests payload validation and per-channel results of the bulk subscribe RPC
+func TestBulkSubscribe(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	client := &centrifuge.Client{}
+
+	call := func(data string) (centrifuge.RPCReply, error) {
+		var reply centrifuge.RPCReply
+		var replyErr error
+		server.handleRPC(client, centrifuge.RPCEvent{Method: RPCMethodSubscribe, Data: []byte(data)}, func(r centrifuge.RPCReply, err error) {
+			reply, replyErr = r, err
+		})
+		return reply, replyErr
+	}
+
+	_, err := call(`not json`)
+	assert.Error(t, err)
+
+	_, err = call(`{"channels":[]}`)
+	assert.Error(t, err)
+
+	reply, err := call(`{"channels":["user:12345:orders","user:abc:margin"]}`)
+	require.NoError(t, err)
+
+	var resp BulkSubscribeResponse
+	require.NoError(t, json.Unmarshal(reply.Data, &resp))
+	assert.Equal(t, "subscribed", resp.Type)
+	require.Len(t, resp.Results, 2)
+	for _, result := range resp.Results {
+		assert.False(t, result.Subscribed)
+		require.NotNil(t, result.Error)
+		assert.Equal(t, uint32(4001), result.Error.Code)
+	}
+}
+
+// TestSubscribeSnapshotData tests that no data is attached when disabled or when the channel has no history
+func TestSubscribeSnapshotData(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	assert.Nil(t, server.subscribeSnapshotData("user:12345:margin"))
+
+	server.SetSubscribeSnapshot(true)
+	assert.Nil(t, server.subscribeSnapshotData("user:12345:margin"))
+}
+
+// TestRunJanitor tests that subscriptions of clients no longer connected are reclaimed
+func TestRunJanitor(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+
+	// Without a broadcaster there is nothing to reclaim
+	assert.Equal(t, JanitorResult{}, server.runJanitor())
+
+	broadcaster := newMockKafkaBroadcaster()
+	broadcaster.registered["cfx_1"] = "12345"
+	broadcaster.registered["cfx_2"] = "67890"
+	server.SetBroadcaster(broadcaster)
+
+	// No client is connected to the node, so every subscription is stale
+	result := server.runJanitor()
+	assert.Equal(t, JanitorResult{Clients: 2, Users: 2}, result)
+	assert.ElementsMatch(t, []string{"cfx_1", "cfx_2"}, broadcaster.unregistered)
+	assert.Empty(t, broadcaster.registered)
+}
+
+// TestRestoreSubscriptions tests that setting a broadcaster registers the hub's current subscriptions
+func TestRestoreSubscriptions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+	require.NoError(t, server.Node().Run())
+
+	// Without a broadcaster there is nothing to restore
+	assert.Zero(t, server.restoreSubscriptions())
+	assert.Empty(t, server.SnapshotSubscriptions())
+
+	// No client is connected to the node, so the broadcaster starts empty
+	broadcaster := newMockKafkaBroadcaster()
+	server.SetBroadcaster(broadcaster)
+	assert.Empty(t, broadcaster.registered)
+	assert.Zero(t, server.restoreSubscriptions())
+}
+
+// TestHandshakeLimits tests rejecting upgrade bodies and counting connections slow to send headers
+func TestHandshakeLimits(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+	server.SetMetrics(NewMetrics(server.Node()))
+	failed := func(reason string) float64 {
+		return counterValue(t, server.metrics.connectionsFailed.WithLabelValues("test-node", reason))
+	}
+
+	server.SetHandshakeLimits(HandshakeLimits{})
+	httpServer := &http.Server{}
+	server.ApplyHandshakeLimits(httpServer)
+	assert.Equal(t, defaultReadHeaderTimeout, httpServer.ReadHeaderTimeout)
+	assert.Equal(t, defaultMaxHeaderBytes, httpServer.MaxHeaderBytes)
+	assert.NotNil(t, httpServer.ConnState)
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/connection", strings.NewReader("payload")))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, float64(1), failed(FailedRequestTooLarge))
+
+	server.SetHandshakeLimits(HandshakeLimits{ReadHeaderTimeout: 20 * time.Millisecond})
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	defer peer.Close()
+
+	// Headers read in time are not counted
+	server.trackConnState(conn, http.StateNew)
+	server.trackConnState(conn, http.StateActive)
+	assert.Zero(t, failed(FailedHeaderTimeout))
+
+	// Headers hitting the timeout are counted once, as are connections closed without sending any
+	for _, state := range []http.ConnState{http.StateActive, http.StateClosed} {
+		server.trackConnState(conn, http.StateNew)
+		time.Sleep(30 * time.Millisecond)
+		server.trackConnState(conn, state)
+		server.trackConnState(conn, http.StateClosed)
+	}
+	assert.Equal(t, float64(2), failed(FailedHeaderTimeout))
+}
+
+// TestHandshakeTimeout tests closing upgraded connections that send no connect command in time
+func TestHandshakeTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+	server.SetMetrics(NewMetrics(server.Node()))
+	server.SetHandshakeLimits(HandshakeLimits{HandshakeTimeout: 50 * time.Millisecond})
+
+	// Stand in for the WebSocket upgrade, which hijacks the connection and returns
+	upgraded := make(chan *handshake, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.serveHandshake(w, r, func(w http.ResponseWriter, r *http.Request) {
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+			upgraded <- handshakeFrom(r.Context())
+		})
+	}))
+	defer httpServer.Close()
+
+	upgrade := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", httpServer.Listener.Addr().String())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("GET /connection HTTP/1.1\r\nHost: test\r\n\r\n"))
+		require.NoError(t, err)
+
+		reader := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(reader, nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+		return conn, reader
+	}
+
+	// The client never sends its connect command, so the connection is closed
+	conn, reader := upgrade()
+	defer conn.Close()
+	<-upgraded
+	_, err := reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, float64(1), counterValue(t, server.metrics.connectionsFailed.WithLabelValues("test-node", FailedHandshakeTimeout)))
+
+	// A client connecting in time keeps its connection
+	conn, reader = upgrade()
+	defer conn.Close()
+	(<-upgraded).connect()
+	_, err = reader.ReadByte()
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+	assert.Equal(t, float64(1), counterValue(t, server.metrics.connectionsFailed.WithLabelValues("test-node", FailedHandshakeTimeout)))
+
+	// Without a connect command handshake, handshakeFrom finds nothing to stop
+	handshakeFrom(context.Background()).connect()
+}
+
+// counterValue returns the current value of a Prometheus counter
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	var m dto.Metric
+	require.NoError(t, counter.Write(&m))
+	return m.GetCounter().GetValue()
+}
+
+// TestLoadShedding tests shedding upgrades and reporting readiness against the connection limit
+func TestLoadShedding(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusSwitchingProtocols)
+	})
+
+	// Without a limit, upgrades pass and no remaining capacity is reported
+	rec := httptest.NewRecorder()
+	server.LoadSheddingMiddleware(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/connection", nil))
+	assert.Equal(t, http.StatusSwitchingProtocols, rec.Code)
+	assert.Nil(t, server.capacity(1000).Remaining)
+
+	server.SetMaxConnections(2, 5*time.Second)
+
+	rec = httptest.NewRecorder()
+	server.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var readiness Readiness
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &readiness))
+	assert.Equal(t, "ready", readiness.Status)
+	assert.Equal(t, 2, readiness.MaxConnections)
+	require.NotNil(t, readiness.Remaining)
+	assert.Equal(t, 2, *readiness.Remaining)
+
+	// At the limit the instance reports full with no remaining capacity
+	full := server.capacity(2)
+	assert.Equal(t, "full", full.Status)
+	assert.Equal(t, 0, *full.Remaining)
+	assert.Equal(t, 0, *server.capacity(3).Remaining)
+}
+
+// TestPublishHandler tests validating and publishing internal service-to-service messages
+func TestPublishHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	runNode(t, server)
+	handler := server.PublishHandler()
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "valid publish",
+			body:           `{"channel":"user:12345:margin","payload":{"type":"promo","message":"hello"}}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid json",
+			body:           `{"channel":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid channel",
+			body:           `{"channel":"public:news","payload":{"type":"promo"}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "missing payload",
+			body:           `{"channel":"user:12345:margin"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/internal/publish", strings.NewReader(tt.body))
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var resp PublishResponse
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+				assert.Equal(t, "user:12345:margin", resp.Channel)
+			}
+		})
+	}
+}
+
+// recordingReceipts records tracked and acknowledged critical publications
+type recordingReceipts struct {
+	tracked []receipt.Critical
+	acked   []string
+}
+
+func (r *recordingReceipts) Track(c receipt.Critical) (receipt.Critical, error) {
+	c.AckID = "ack-" + strconv.Itoa(len(r.tracked)+1)
+	r.tracked = append(r.tracked, c)
+	return c, nil
+}
+
+func (r *recordingReceipts) Ack(ajaibID string, ackIDs []string) error {
+	r.acked = append(r.acked, ackIDs...)
+	return nil
+}
+
+func (r *recordingReceipts) Unacked(ajaibID string, now time.Time) []receipt.Critical {
+	return r.tracked
+}
+
+func (r *recordingReceipts) HandleNotification(op string, data []byte) {}
+
+// TestCriticalPublish tests that critical publications are tracked and answered with their ack ID
+func TestCriticalPublish(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+	server := NewCentrifugeServer(cfg, logger)
+	require.NoError(t, server.Node().Run())
+	body := `{"channel":"user:12345:margin","payload":{"type":"liquidation_warning"},"critical":true}`
+
+	rec := httptest.NewRecorder()
+	server.PublishHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/publish", strings.NewReader(body)))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	receipts := &recordingReceipts{}
+	server.SetReceipts(receipts)
+	rec = httptest.NewRecorder()
+	server.PublishHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/internal/publish", strings.NewReader(body)))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var resp PublishResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Equal(t, "ack-1", resp.AckID)
+	require.Len(t, receipts.tracked, 1)
+	assert.Equal(t, "12345", receipts.tracked[0].AjaibID)
+	assert.Equal(t, "user:12345:margin", receipts.tracked[0].Channel)
+	assert.Empty(t, receipts.acked)
+
+	assert.NotNil(t, AckRequest{}.Validate())
+	assert.NotNil(t, AckRequest{AckIDs: []string{""}}.Validate())
+	assert.Nil(t, AckRequest{AckIDs: []string{"ack-1"}}.Validate())
+}
+
+// TestSendDedupe tests that repeated sends to a client are suppressed within the class window
+func TestSendDedupe(t *testing.T) {
+	dedupe := newSendDedupe(map[string]int{SendClassAnnouncement: 2, "margin": 2})
+
+	assert.False(t, dedupe.seen("client-1", SendClassAnnouncement, "a", nil))
+	assert.True(t, dedupe.seen("client-1", SendClassAnnouncement, "a", nil))
+	assert.False(t, dedupe.seen("client-2", SendClassAnnouncement, "a", nil), "clients are deduplicated separately")
+
+	// The oldest message leaves the window
+	assert.False(t, dedupe.seen("client-1", SendClassAnnouncement, "b", nil))
+	assert.False(t, dedupe.seen("client-1", SendClassAnnouncement, "c", nil))
+	assert.True(t, dedupe.seen("client-1", SendClassAnnouncement, "c", nil))
+	assert.False(t, dedupe.seen("client-1", SendClassAnnouncement, "a", nil))
+
+	// Only the last message of a stream is a duplicate, so a state published A, B, then A again ends on A
+	assert.False(t, dedupe.seen("client-1", "margin", "user:1:margin", []byte("A")))
+	assert.True(t, dedupe.seen("client-1", "margin", "user:1:margin", []byte("A")))
+	assert.False(t, dedupe.seen("client-1", "margin", "user:1:margin", []byte("B")))
+	assert.False(t, dedupe.seen("client-1", "margin", "user:1:margin", []byte("A")))
+
+	// Classes without a window are never deduplicated
+	assert.False(t, dedupe.seen("client-1", "position", "user:1:position", []byte("A")))
+	assert.False(t, dedupe.seen("client-1", "position", "user:1:position", []byte("A")))
+
+	dedupe.forget("client-1")
+	assert.False(t, dedupe.seen("client-1", SendClassAnnouncement, "c", nil))
+	assert.False(t, (*sendDedupe)(nil).seen("client-1", SendClassAnnouncement, "c", nil))
+	assert.False(t, newSendDedupe(map[string]int{SendClassAnnouncement: 2}).publications)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node", Namespace: "test-ns"}, logger)
+	server.SetMetrics(NewMetrics(server.Node()))
+	assert.Error(t, server.SetSendDedupe(map[string]int{"critical": 10}))
+	assert.Error(t, server.SetSendDedupe(map[string]int{"other": 10}))
+	assert.Error(t, server.SetSendDedupe(map[string]int{"margin": -1}))
+	require.NoError(t, server.SetSendDedupe(map[string]int{"margin": 4, "raw": 4, "rate": 0}))
+	server.SetCfxUserMapper(&mockCfxUserMapper{cfxUserID: "cfx_123"})
+	require.NoError(t, server.Start())
+	t.Cleanup(func() {
+		_ = server.node.Shutdown(context.Background())
+	})
+
+	// A publication enqueued twice by the node's broadcast is written once; rate has no window
+	transport := &recordingTransport{}
+	client, closeClient, err := centrifuge.NewClient(context.Background(), server.node, transport)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = closeClient()
+	})
+	require.NoError(t, client.ConnectNoErrorToDisconnect(centrifuge.ConnectRequest{Token: testToken("12345")}))
+	require.NoError(t, client.Subscribe("user:12345:margin"))
+	require.NoError(t, client.Subscribe(channel.RateUSDTIDR))
+
+	for _, data := range []string{`{"v":"A"}`, `{"v":"A"}`, `{"v":"B"}`, `{"v":"A"}`} {
+		_, err := server.node.Publish("user:12345:margin", []byte(data))
+		require.NoError(t, err)
+	}
+	for range 2 {
+		_, err := server.node.Publish(channel.RateUSDTIDR, []byte(`{"rate":16000}`))
+		require.NoError(t, err)
+	}
+
+	require.Eventually(t, func() bool {
+		return len(transport.publications()) == 5
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{
+		`user:12345:margin {"v":"A"}`,
+		`user:12345:margin {"v":"B"}`,
+		`user:12345:margin {"v":"A"}`,
+		`rate:USDT:IDR {"rate":16000}`,
+		`rate:USDT:IDR {"rate":16000}`,
+	}, transport.publications())
+	assert.Equal(t, float64(1), counterValue(t, server.metrics.duplicateSends.WithLabelValues("test-node", "margin")))
+}
+
+// TestBackoffHint tests the reconnect guidance advertised to clients
+func TestBackoffHint(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	server.SetMaxConnections(100, 5*time.Second)
+
+	retryAfter, jitter := server.backoffHint()
+	assert.Equal(t, minReconnectDelay, retryAfter)
+	assert.Equal(t, minReconnectDelay, jitter)
+
+	perr := server.withBackoff(protocol.ErrCfxUserResolution())
+	assert.EqualValues(t, minReconnectDelay.Milliseconds(), perr.Details["retry_after_ms"])
+	assert.EqualValues(t, minReconnectDelay.Milliseconds(), perr.Details["jitter_ms"])
+}
+
+// TestReplaceDeviceSession tests that only sessions from the same device are replaced
+func TestReplaceDeviceSession(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	existing := map[string]*centrifuge.Client{"client_1": {}}
+
+	// Without a device ID there is nothing to match
+	assert.Nil(t, server.staleDeviceSession(existing, ""))
+
+	// Sessions without client info never match a device
+	assert.Nil(t, server.staleDeviceSession(existing, "ios-abc"))
+}
+
+// TestConnectionLimitPolicy tests parsing the policy and superseding the oldest sessions beyond the limit
+func TestConnectionLimitPolicy(t *testing.T) {
+	for name, want := range map[string]ConnectionLimitPolicy{
+		"":          LimitReject,
+		"reject":    LimitReject,
+		"Supersede": LimitSupersede,
+	} {
+		policy, err := ParseConnectionLimitPolicy(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, want, policy, name)
+	}
+	_, err := ParseConnectionLimitPolicy("oldest")
+	assert.Error(t, err)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	server.SetMaxConnectionsPerUser(2)
+	server.SetConnectionLimitPolicy(LimitSupersede)
+
+	// Superseded sessions are disconnected asynchronously, so they must be clients of the server's node
+	clients := func(n int) map[string]*centrifuge.Client {
+		existing := make(map[string]*centrifuge.Client, n)
+		for range n {
+			client := newTestClient(t, server)
+			existing[client.ID()] = client
+		}
+		return existing
+	}
+
+	assert.Empty(t, server.oldestSessions(clients(1)))
+	assert.Len(t, server.oldestSessions(clients(2)), 1)
+
+	// A lowered limit supersedes every session beyond it
+	oldest := server.oldestSessions(clients(4))
+	assert.Len(t, oldest, 3)
+	server.supersedeSessions(oldest, "client_5")
+}
+
+// TestEventBus tests delivering hub events to typed and catch-all subscribers in order
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+
+	var received []string
+	bus.Subscribe(func(event HubEvent) {
+		received = append(received, "subscribed:"+event.Channel)
+	}, HubSubscribed)
+	bus.Subscribe(func(event HubEvent) {
+		received = append(received, "all:"+string(event.Type))
+		assert.False(t, event.Time.IsZero())
+	})
+
+	bus.Publish(HubEvent{Type: HubSubscribed, Channel: "user:12345:margin"})
+	bus.Publish(HubEvent{Type: HubMessageDropped, Reason: "send buffer full"})
+
+	assert.Equal(t, []string{
+		"subscribed:user:12345:margin",
+		"all:subscribed",
+		"all:message_dropped",
+	}, received)
+}
+
+type recordingPresence struct {
+	events []string
+}
+
+func (r *recordingPresence) UserOnline(ajaibID string) {
+	r.events = append(r.events, "+"+ajaibID)
+}
+
+func (r *recordingPresence) UserOffline(ajaibID string) {
+	r.events = append(r.events, "-"+ajaibID)
+}
+
+// TestTrackPresence tests that presence is signalled on a user's first connection and released with the last
+func TestTrackPresence(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	runNode(t, server)
+	presence := &recordingPresence{}
+	server.SetPresenceListener(presence)
+
+	alice := &ClientInfo{AjaibID: "12345"}
+	bob := &ClientInfo{AjaibID: "67890"}
+
+	server.trackPresence(HubEvent{Type: HubClientUnregistered, Info: &ClientInfo{AjaibID: "11111"}})
+	server.trackPresence(HubEvent{Type: HubClientRegistered})
+	server.trackPresence(HubEvent{Type: HubClientRegistered, Info: alice})
+	server.trackPresence(HubEvent{Type: HubClientRegistered, Info: alice})
+	server.trackPresence(HubEvent{Type: HubClientRegistered, Info: bob})
+	server.trackPresence(HubEvent{Type: HubSubscribed, Info: bob, Channel: "user:67890:margin"})
+
+	assert.Equal(t, []OnlineUser{
+		{AjaibID: "12345", Connections: 2},
+		{AjaibID: "67890", Connections: 1},
+	}, server.OnlineUsers())
+
+	server.trackPresence(HubEvent{Type: HubClientUnregistered, Info: alice})
+	server.trackPresence(HubEvent{Type: HubClientUnregistered, Info: bob})
+	server.trackPresence(HubEvent{Type: HubClientUnregistered, Info: alice})
+
+	assert.Equal(t, []string{"+12345", "+67890", "-67890", "-12345"}, presence.events)
+	assert.Empty(t, server.OnlineUsers())
+}
+
+// TestImpersonation tests that impersonation tokens need their scope and that sessions are audited, not counted as presence
+func TestImpersonation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	ajaibID, agent, perr := sessionUser(&auth.Claims{Sub: "12345"})
+	require.Nil(t, perr)
+	assert.Equal(t, "12345", ajaibID)
+	assert.Empty(t, agent)
+
+	_, _, perr = sessionUser(&auth.Claims{Sub: "agent-7", Impersonate: "12345"})
+	require.NotNil(t, perr)
+	assert.Equal(t, uint32(protocol.CodeUnauthorized), perr.Code)
+
+	ajaibID, agent, perr = sessionUser(&auth.Claims{Sub: "agent-7", Impersonate: "12345", Scope: channel.ScopeImpersonate})
+	require.Nil(t, perr)
+	assert.Equal(t, "12345", ajaibID)
+	assert.Equal(t, "agent-7", agent)
+
+	server := NewCentrifugeServer(cfg, logger)
+	runNode(t, server)
+	var audit strings.Builder
+	server.SetAuditLogger(slog.New(slog.NewJSONHandler(&audit, nil)))
+
+	session := &ClientInfo{AjaibID: "12345", ImpersonatedBy: "agent-7"}
+	agentClient := newTestClient(t, server)
+	server.bus.Publish(HubEvent{Type: HubClientRegistered, Client: agentClient, Info: session})
+	server.bus.Publish(HubEvent{Type: HubSubscribed, Client: agentClient, Info: session, Channel: "user:12345:margin"})
+	server.bus.Publish(HubEvent{Type: HubClientRegistered, Client: newTestClient(t, server), Info: &ClientInfo{AjaibID: "67890"}})
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"event":"client_registered"`)
+	assert.Contains(t, lines[1], `"agent":"agent-7"`)
+	assert.Contains(t, lines[1], `"channel":"user:12345:margin"`)
+	assert.Equal(t, []OnlineUser{{AjaibID: "67890", Connections: 1}}, server.OnlineUsers())
+
+	// Snapshots accept impersonation tokens for the impersonated user's channels
+	mux := http.NewServeMux()
+	mux.Handle(SnapshotPath, server.SnapshotHandler())
+	for token, want := range map[string]int{
+		`{"sub":"agent-7","impersonate":"12345"}`:                                http.StatusUnauthorized,
+		`{"sub":"agent-7","impersonate":"12345","scope":"internal:impersonate"}`: http.StatusNotFound,
+		`{"sub":"agent-7","impersonate":"67890","scope":"internal:impersonate"}`: http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/snapshot/user:12345:position", nil)
+		req.Header.Set("Authorization", "Bearer x."+base64.RawURLEncoding.EncodeToString([]byte(token))+".sig")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Code, token)
+	}
+}
+
+// TestPresenceHandler tests listing the users online on the instance, optionally for a single user
+func TestPresenceHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	runNode(t, server)
+	server.trackPresence(HubEvent{Type: HubClientRegistered, Info: &ClientInfo{AjaibID: "12345"}})
+	server.trackPresence(HubEvent{Type: HubClientRegistered, Info: &ClientInfo{AjaibID: "67890"}})
+
+	rec := httptest.NewRecorder()
+	server.PresenceHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/presence", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var dump PresenceDump
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dump))
+	assert.Equal(t, 2, dump.Users)
+	assert.Len(t, dump.Online, 2)
+
+	rec = httptest.NewRecorder()
+	server.PresenceHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/presence?ajaib_id=67890", nil))
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dump))
+	assert.Equal(t, 2, dump.Users)
+	assert.Equal(t, []OnlineUser{{AjaibID: "67890", Connections: 1}}, dump.Online)
+}
+
+// TestPresenceChannel tests that only clients granted the presence scope may subscribe to the presence channel
+func TestPresenceChannel(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	broadcaster := newMockKafkaBroadcaster()
+	server.SetBroadcaster(broadcaster)
+	client := &centrifuge.Client{}
+
+	_, perr := server.authorizeChannel(client, &ClientInfo{AjaibID: "12345"}, channel.PresenceFutures)
+	require.NotNil(t, perr)
+	assert.Equal(t, uint32(protocol.CodeChannelNotFound), perr.Code)
+
+	_, perr = server.authorizeChannel(client, &ClientInfo{AjaibID: "12345", Scope: "internal:firehose"}, channel.PresenceFutures)
+	require.NotNil(t, perr)
+
+	agent := &ClientInfo{AjaibID: "12345", CfxUserID: "cfx_1", Scope: "internal:firehose " + channel.ScopePresence}
+	info, perr := server.authorizeChannel(client, agent, channel.PresenceFutures)
+	require.Nil(t, perr)
+	assert.Equal(t, channel.PresenceFutures, info.Name)
+
+	// Presence subscriptions are not routed from Kafka
+	server.trackSubscription(client, agent, info)
+	assert.Empty(t, broadcaster.Subscribers())
+}
+
+// TestChannelPolicies tests that configured channel policies gate subscriptions and snapshots
+func TestChannelPolicies(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	policies, err := policy.NewSet([]policy.Policy{
+		{Pattern: "user:*:position", Scopes: []string{"futures:positions"}},
+		{Pattern: "user:*:margin", ClientTypes: []string{"firehose"}},
+	})
+	require.NoError(t, err)
+	server.SetChannelPolicies(policies)
+	client := &centrifuge.Client{}
+
+	_, perr := server.authorizeChannel(client, &ClientInfo{AjaibID: "12345"}, "user:12345:position")
+	require.NotNil(t, perr)
+	assert.Equal(t, uint32(protocol.CodeChannelNotFound), perr.Code)
+
+	info, perr := server.authorizeChannel(client, &ClientInfo{AjaibID: "12345", Scope: "futures:positions"}, "user:12345:position")
+	require.Nil(t, perr)
+	assert.Equal(t, "12345", info.AjaibID)
+
+	// Clients served by the default profile are not allowed on margin channels
+	_, perr = server.authorizeChannel(client, &ClientInfo{AjaibID: "12345"}, "user:12345:margin")
+	require.NotNil(t, perr)
+
+	// The built-in raw scope still applies
+	_, perr = server.authorizeChannel(client, &ClientInfo{AjaibID: "12345", Scope: "futures:positions"}, "raw:user:12345:position")
+	require.NotNil(t, perr)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/snapshot/user:12345:position", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken("12345"))
+	rec := httptest.NewRecorder()
+	mux := http.NewServeMux()
+	mux.Handle(SnapshotPath, server.SnapshotHandler())
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+// TestRegisteredFamilyChannel tests that channels of a registered family without an owner can be subscribed
+// by any user the channel policies allow, and are not routed from Kafka
+func TestRegisteredFamilyChannel(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	if !channel.IsRegistered("notice:") {
+		channel.RegisterFamily(channel.Family{
+			Prefix: "notice:",
+			Parse: func(name string) (*channel.ChannelInfo, error) {
+				return &channel.ChannelInfo{ChannelSub: strings.TrimPrefix(name, "notice:")}, nil
+			},
+			Build: func(info *channel.ChannelInfo) string {
+				return "notice:" + info.ChannelSub
+			},
+		})
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	broadcaster := newMockKafkaBroadcaster()
+	server.SetBroadcaster(broadcaster)
+	policies, err := policy.NewSet([]policy.Policy{
+		{Pattern: "notice:*", Scopes: []string{"futures:notices"}},
+	})
+	require.NoError(t, err)
+	server.SetChannelPolicies(policies)
+	client := &centrifuge.Client{}
+
+	_, perr := server.authorizeChannel(client, &ClientInfo{AjaibID: "12345"}, "notice:maintenance")
+	require.NotNil(t, perr)
+	assert.Equal(t, uint32(protocol.CodeChannelNotFound), perr.Code)
+
+	clientInfo := &ClientInfo{AjaibID: "12345", CfxUserID: "cfx_1", Scope: "futures:notices"}
+	info, perr := server.authorizeChannel(client, clientInfo, "notice:maintenance")
+	require.Nil(t, perr)
+	assert.Equal(t, "notice:", info.Prefix)
+	assert.Empty(t, info.AjaibID)
+
+	server.trackSubscription(client, clientInfo, info)
+	assert.Empty(t, broadcaster.Subscribers())
+}
+
+// TestRawChannel tests that raw channel variants require the raw scope and the user's own channel
+func TestRawChannel(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	broadcaster := newMockKafkaBroadcaster()
+	server.SetBroadcaster(broadcaster)
+	client := &centrifuge.Client{}
+	raw := channel.RawChannel("user:12345:margin")
+
+	_, perr := server.authorizeChannel(client, &ClientInfo{AjaibID: "12345", CfxUserID: "cfx_1"}, raw)
+	require.NotNil(t, perr)
+	assert.Equal(t, uint32(protocol.CodeChannelNotFound), perr.Code)
+
+	risk := &ClientInfo{AjaibID: "12345", CfxUserID: "cfx_1", Scope: channel.ScopeRaw}
+	_, perr = server.authorizeChannel(client, risk, channel.RawChannel("user:67890:margin"))
+	require.NotNil(t, perr)
+	assert.Equal(t, channel.RawChannel("user:67890:margin"), perr.Details["channel"])
+
+	_, perr = server.authorizeChannel(client, risk, channel.RawChannel(channel.RateUSDTIDR))
+	require.NotNil(t, perr)
+
+	info, perr := server.authorizeChannel(client, risk, raw)
+	require.Nil(t, perr)
+	assert.Equal(t, raw, info.Name)
+	assert.Equal(t, "12345", info.AjaibID)
+
+	// Raw subscriptions are routed from Kafka
+	server.trackSubscription(client, risk, info)
+	assert.Len(t, broadcaster.Subscribers(), 1)
+}
+
+// TestProjectedChannel tests that projected channel variants follow the authorization of their underlying channel
+func TestProjectedChannel(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+	client := &centrifuge.Client{}
+	user := &ClientInfo{AjaibID: "12345", CfxUserID: "cfx_1"}
+	projected := channel.ProjectedChannel("mark_price", "user:12345:position")
+
+	info, perr := server.authorizeChannel(client, user, projected)
+	require.Nil(t, perr)
+	assert.Equal(t, projected, info.Name)
+	assert.Equal(t, "12345", info.AjaibID)
+
+	for _, ch := range []string{
+		channel.ProjectedChannel("mark_price", "user:67890:position"),
+		channel.ProjectedChannel("mark_price", channel.RateUSDTIDR),
+		channel.ProjectedChannel("mark_price", channel.RawChannel("user:12345:position")),
+		"fields:symbol.mark_price:user:12345:position",
+	} {
+		_, perr := server.authorizeChannel(client, user, ch)
+		require.NotNil(t, perr, ch)
+		assert.Equal(t, uint32(protocol.CodeChannelNotFound), perr.Code, ch)
+	}
+}
+
+// TestRateChannel tests that any client may subscribe to the rate channel and that unchanged rates are not republished
+func TestRateChannel(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	runNode(t, server)
+	broadcaster := newMockKafkaBroadcaster()
+	server.SetBroadcaster(broadcaster)
+	client := &centrifuge.Client{}
+
+	info, perr := server.authorizeChannel(client, &ClientInfo{AjaibID: "12345", CfxUserID: "cfx_1"}, channel.RateUSDTIDR)
+	require.Nil(t, perr)
+	assert.Equal(t, channel.RateUSDTIDR, info.Name)
+
+	// Rate subscriptions are not routed from Kafka
+	server.trackSubscription(client, &ClientInfo{AjaibID: "12345", CfxUserID: "cfx_1"}, info)
+	assert.Empty(t, broadcaster.Subscribers())
+
+	server.PublishRate(16000, time.Now())
+	assert.Equal(t, 16000.0, server.publishedRate)
+
+	server.PublishRate(16250, time.Now())
+	assert.Equal(t, 16250.0, server.publishedRate)
+}
+
+// stubUpstream is an upstream feed with fixed state
+type stubUpstream struct {
+	healthy      bool
+	lastActivity time.Time
+	reconnects   int
+}
+
+func (u *stubUpstream) IsHealthy() bool         { return u.healthy }
+func (u *stubUpstream) LastActivity() time.Time { return u.lastActivity }
+func (u *stubUpstream) Reconnect()              { u.reconnects++ }
+
+// TestUpstreamHealth tests reporting the upstream feed age and stall state
+func TestUpstreamHealth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	now := time.Now()
+	assert.Nil(t, server.upstreamHealth(now))
+
+	upstream := &stubUpstream{healthy: true, lastActivity: now.Add(-30 * time.Second)}
+	server.SetUpstream(upstream, time.Minute)
+	assert.Equal(t, &UpstreamHealth{Connected: true, LastMessageAgeMs: 30000}, server.upstreamHealth(now))
+	assert.False(t, server.checkUpstream(now, false))
+
+	upstream.lastActivity = now.Add(-2 * time.Minute)
+	assert.True(t, server.upstreamHealth(now).Stalled)
+	assert.True(t, server.checkUpstream(now, false))
+
+	// A stalled feed is reported but does not fail readiness
+	rec := httptest.NewRecorder()
+	server.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"stalled":true`)
+}
+
+// stubGroupMember is a consumer whose group membership is set by tests
+type stubGroupMember struct {
+	joined bool
+}
+
+func (m *stubGroupMember) Joined() bool { return m.joined }
+
+// TestHandoffReadiness tests failing readiness and shedding upgrades until the consumer joined its group
+// and once the instance drains
+func TestHandoffReadiness(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusSwitchingProtocols)
+	})
+	readiness := func() (int, Readiness) {
+		rec := httptest.NewRecorder()
+		server.ReadyHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var r Readiness
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &r))
+		return rec.Code, r
+	}
+
+	member := &stubGroupMember{}
+	server.SetJoinGate(member)
+	code, r := readiness()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "joining", r.Status)
+
+	rec := httptest.NewRecorder()
+	server.LoadSheddingMiddleware(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/connection", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	member.joined = true
+	code, r = readiness()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", r.Status)
+
+	// Draining overrides every other status
+	server.SetMaxConnections(1, time.Second)
+	server.Drain()
+	code, r = readiness()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "draining", r.Status)
+
+	rec = httptest.NewRecorder()
+	server.LoadSheddingMiddleware(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/connection", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+// TestUpstreamReconnect tests forcing an upstream reconnect at most once per threshold
+func TestUpstreamReconnect(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	now := time.Now()
+	upstream := &stubUpstream{healthy: true, lastActivity: now.Add(-4 * time.Minute)}
+	server.SetUpstream(upstream, time.Minute)
+
+	// Disabled by default
+	server.checkUpstream(now, false)
+	assert.Equal(t, 0, upstream.reconnects)
+
+	server.SetUpstreamReconnect(5 * time.Minute)
+	server.checkUpstream(now, false)
+	assert.Equal(t, 0, upstream.reconnects)
+
+	server.checkUpstream(now.Add(2*time.Minute), true)
+	assert.Equal(t, 1, upstream.reconnects)
+
+	// Still silent right after the reconnect: wait a full threshold before the next one
+	server.checkUpstream(now.Add(3*time.Minute), true)
+	assert.Equal(t, 1, upstream.reconnects)
+
+	server.checkUpstream(now.Add(8*time.Minute), true)
+	assert.Equal(t, 2, upstream.reconnects)
+}
+
+// stubOverload is an overload source with a fixed fetch delay
+type stubOverload struct {
+	delay time.Duration
+}
+
+func (o *stubOverload) FetchDelay() time.Duration { return o.delay }
+
+// TestOverload tests degrading channels to their overload rate past the delay budget and restoring them
+// once the delay falls below the recovery threshold
+func TestOverload(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+	runNode(t, server)
+	policies, err := policy.NewSet([]policy.Policy{{Pattern: "user:*:position", OverloadRate: 1}})
+	require.NoError(t, err)
+	server.SetChannelPolicies(policies)
+
+	source := &stubOverload{delay: time.Second}
+	server.SetOverload(source, OverloadLimits{DelayBudget: 5 * time.Second})
+	assert.Equal(t, 2500*time.Millisecond, server.overloadLimits.RecoverBelow)
+
+	now := time.Now()
+	assert.False(t, server.checkOverload(now))
+
+	source.delay = 6 * time.Second
+	assert.True(t, server.checkOverload(now))
+	rate, conflate := policies.Limit("user:12345:position")
+	assert.Equal(t, 1.0, rate)
+	assert.True(t, conflate)
+
+	// Delays between the recovery threshold and the budget keep delivery degraded
+	source.delay = 3 * time.Second
+	assert.True(t, server.checkOverload(now))
+
+	source.delay = 2 * time.Second
+	assert.False(t, server.checkOverload(now))
+	rate, _ = policies.Limit("user:12345:position")
+	assert.Zero(t, rate)
+}
+
+// TestFanOut tests that every client is visited once, serially or across workers
+func TestFanOut(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	clients := make([]*centrifuge.Client, 10*minFanOutShard+7)
+	for i := range clients {
+		clients[i] = &centrifuge.Client{}
+	}
+
+	for _, workers := range []int{0, 4, 64} {
+		server.SetFanOutWorkers(workers)
+
+		var visited atomic.Int64
+		server.fanOut(clients, func(client *centrifuge.Client) {
+			visited.Add(1)
+		})
+		assert.Equal(t, int64(len(clients)), visited.Load(), "workers=%d", workers)
+	}
+}
+
+// TestConnectionProfiles tests profile validation and selection by the upgrade token scope
+func TestConnectionProfiles(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	def := ConnectionProfile{MessageSizeLimit: 64 << 10}
+	firehose := ConnectionProfile{Name: "firehose", Scope: "internal:firehose", MessageSizeLimit: 512 << 10}
+
+	assert.Error(t, server.SetConnectionProfiles(ConnectionProfile{MessageSizeLimit: -1}, nil))
+	assert.Error(t, server.SetConnectionProfiles(def, []ConnectionProfile{{Name: "unscoped"}}))
+	assert.Error(t, server.SetConnectionProfiles(def, []ConnectionProfile{firehose, {Name: "copy", Scope: "internal:firehose"}}))
+	require.NoError(t, server.SetConnectionProfiles(def, []ConnectionProfile{firehose}))
+
+	request := func(token string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/connection/websocket", nil)
+		if token != "" {
+			r = r.WithContext(auth.WithToken(r.Context(), token))
+		}
+		return r
+	}
+	scoped := func(scope string) string {
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+		payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"12345","scope":"` + scope + `"}`))
+		return header + "." + payload + ".sig"
+	}
+
+	assert.Equal(t, "default", server.profileFor(request("")).profile.Name)
+	assert.Equal(t, "default", server.profileFor(request(testToken("12345"))).profile.Name)
+	assert.Equal(t, "default", server.profileFor(request("malformed")).profile.Name)
+	assert.Equal(t, "firehose", server.profileFor(request(scoped("read internal:firehose"))).profile.Name)
+	assert.Equal(t, 512<<10, server.profileFor(request(scoped("internal:firehose"))).profile.MessageSizeLimit)
+}
+
+// TestConnectionLanes tests the send queue settings of connection profiles and the lanes users are connected in
+func TestConnectionLanes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	assert.Error(t, server.SetConnectionProfiles(ConnectionProfile{QueueInitialCap: -1}, nil))
+	assert.Error(t, server.SetConnectionProfiles(ConnectionProfile{LowLatency: true, WriteDelay: time.Millisecond}, nil))
+
+	var reply centrifuge.ConnectReply
+	ConnectionProfile{QueueInitialCap: 64, LowLatency: true}.applySendQueue(&reply)
+	assert.Equal(t, 64, reply.QueueInitialCap)
+	assert.True(t, reply.ReplyWithoutQueue)
+	ConnectionProfile{WriteDelay: 100 * time.Millisecond, MaxMessagesInFrame: 4}.applySendQueue(&reply)
+	assert.Equal(t, 100*time.Millisecond, reply.WriteDelay)
+	assert.Equal(t, 4, reply.MaxMessagesInFrame)
+	assert.False(t, reply.ReplyWithoutQueue)
+
+	// Test clients carry no profile context, so they connect with the default profile
+	require.NoError(t, server.SetConnectionProfiles(ConnectionProfile{Name: "premium", LowLatency: true}, nil))
+	policies, err := policy.NewSet([]policy.Policy{{Pattern: "user:*:margin", MaxRate: 1, Conflate: true, ExemptClientTypes: []string{"premium"}}})
+	require.NoError(t, err)
+	server.SetChannelPolicies(policies)
+
+	client := &centrifuge.Client{}
+	stats := server.pongStats([]string{"user:12345:margin"}, "12345")
+	assert.Len(t, stats.Conflation, 1)
+
+	server.trackLane(HubEvent{Type: HubClientRegistered, Client: client, Info: &ClientInfo{AjaibID: "12345"}})
+	server.trackLane(HubEvent{Type: HubClientRegistered, Client: client, Info: &ClientInfo{AjaibID: "67890", ImpersonatedBy: "agent"}})
+	assert.True(t, server.UserConnectedAs("12345", "premium"))
+	assert.False(t, server.UserConnectedAs("12345", "default"))
+	assert.False(t, server.UserConnectedAs("67890", "premium"), "impersonation sessions are the agent's")
+	assert.Empty(t, server.pongStats([]string{"user:12345:margin"}, "12345").Conflation)
+
+	priority, rest := server.lowLatencyFirst([]*centrifuge.Client{client})
+	assert.Len(t, priority, 1)
+	assert.Empty(t, rest)
+
+	server.trackLane(HubEvent{Type: HubClientUnregistered, Client: client, Info: &ClientInfo{AjaibID: "12345"}})
+	assert.False(t, server.UserConnectedAs("12345", "premium"))
+	assert.Empty(t, server.lanes.connections)
+}
+
+// TestKeepaliveModes tests the transport ping configuration, the advertised keepalive and the ping RPC of each keepalive mode
+func TestKeepaliveModes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	assert.Error(t, server.SetConnectionProfiles(ConnectionProfile{KeepaliveMode: "frames"}, nil))
+	assert.Error(t, server.SetConnectionProfiles(ConnectionProfile{PingInterval: -time.Second}, nil))
+
+	// Server mode keeps protocol pings every 2s unless configured
+	def := ConnectionProfile{}
+	assert.Equal(t, centrifuge.PingPongConfig{PingInterval: 2 * time.Second}, websocketConfig(def).PingPongConfig)
+	assert.Equal(t, KeepaliveInfo{Mode: KeepaliveServer, PingIntervalMs: 2000}, def.keepaliveInfo())
+
+	client := ConnectionProfile{KeepaliveMode: KeepaliveClient, PingInterval: 20 * time.Second}
+	assert.Equal(t, centrifuge.PingPongConfig{PingInterval: -1, PongTimeout: -1}, client.pingPongConfig())
+	assert.Equal(t, KeepaliveInfo{Mode: KeepaliveClient, PingIntervalMs: 20000}, client.keepaliveInfo())
+
+	hybrid := ConnectionProfile{Name: "firehose", Scope: "internal:firehose", KeepaliveMode: KeepaliveHybrid, PongTimeout: 30 * time.Second}
+	assert.Equal(t, centrifuge.PingPongConfig{PingInterval: 2 * time.Second, PongTimeout: 30 * time.Second}, hybrid.pingPongConfig())
+	assert.Equal(t, KeepaliveInfo{Mode: KeepaliveHybrid, PingIntervalMs: 2000, PongTimeoutMs: 30000}, hybrid.keepaliveInfo())
+	require.NoError(t, server.SetConnectionProfiles(def, []ConnectionProfile{hybrid}))
+
+	// Hybrid upgrades ask the transport for control-frame pings without touching the original request
+	r := httptest.NewRequest(http.MethodGet, "/connection/websocket?cf_protocol=json", nil)
+	framed := withFramePingPong(r.WithContext(r.Context()))
+	assert.Equal(t, "true", framed.URL.Query().Get(framePingPongParam))
+	assert.Equal(t, "json", framed.URL.Query().Get("cf_protocol"))
+	assert.Empty(t, r.URL.Query().Get(framePingPongParam))
+
+	var pong PongResponse
+	server.handleRPC(&centrifuge.Client{}, centrifuge.RPCEvent{Method: RPCMethodPing}, func(r centrifuge.RPCReply, err error) {
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(r.Data, &pong))
+	})
+	assert.Equal(t, "pong", pong.Type)
+	assert.InDelta(t, time.Now().UnixMilli(), pong.Time, 1000)
+}
+
+// TestPongStats tests the load hints of pongs asking for them
+func TestPongStats(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	policies, err := policy.NewSet([]policy.Policy{
+		{Pattern: "user:*:position", MaxRate: 5, Conflate: true},
+		{Pattern: "user:*:margin", MaxRate: 10},
+	})
+	require.NoError(t, err)
+	server.SetChannelPolicies(policies)
+	throttle := policy.NewThrottle(policies)
+	server.SetThrottle(throttle)
+
+	ping := func(data string) (PongResponse, error) {
+		var pong PongResponse
+		var pingErr error
+		server.handleRPC(&centrifuge.Client{}, centrifuge.RPCEvent{Method: RPCMethodPing, Data: []byte(data)}, func(r centrifuge.RPCReply, err error) {
+			pingErr = err
+			if err == nil {
+				require.NoError(t, json.Unmarshal(r.Data, &pong))
+			}
+		})
+		return pong, pingErr
+	}
+
+	pong, err := ping(`{}`)
+	require.NoError(t, err)
+	assert.Nil(t, pong.Stats)
+
+	pong, err = ping(`{"stats":true}`)
+	require.NoError(t, err)
+	require.NotNil(t, pong.Stats)
+	assert.Empty(t, pong.Stats.Conflation)
+
+	_, err = ping(`not json`)
+	assert.Error(t, err)
+
+	// Only conflated channels are reported, held while a newer publication waits
+	deliver := func([]byte) {}
+	throttle.Admit("user:12345:position", []byte("1"), deliver)
+	throttle.Admit("user:12345:position", []byte("2"), deliver)
+	stats := server.pongStats([]string{"user:12345:position", "user:12345:margin", "rate:USDT:IDR"}, "12345")
+	assert.Equal(t, []ConflationState{{Channel: "user:12345:position", MaxRate: 5, Held: true}}, stats.Conflation)
+}
+
+// TestCheckMessageSize tests the 4006 disconnect of messages over the connection profile's size limit
+func TestCheckMessageSize(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	firehose := ConnectionProfile{Name: "firehose", Scope: "internal:firehose", MessageSizeLimit: 512 << 10}
+	require.NoError(t, server.SetConnectionProfiles(ConnectionProfile{}, []ConnectionProfile{firehose}))
+
+	assert.Equal(t, 2*defaultMessageSizeLimit, websocketConfig(ConnectionProfile{}).MessageSizeLimit)
+	assert.Equal(t, firehose, server.clientProfile(withProfile(context.Background(), firehose)))
+	assert.Equal(t, "default", server.clientProfile(context.Background()).Name)
+
+	client := &centrifuge.Client{}
+	assert.NoError(t, server.checkMessageSize(client, centrifuge.CommandReadEvent{CommandSize: defaultMessageSizeLimit}))
+
+	err := server.checkMessageSize(client, centrifuge.CommandReadEvent{CommandSize: defaultMessageSizeLimit + 1})
+	var disconnect centrifuge.Disconnect
+	require.ErrorAs(t, err, &disconnect)
+	assert.Equal(t, uint32(protocol.CodeMessageTooLarge), disconnect.Code)
+	assert.Contains(t, disconnect.Reason, `"limit_bytes":65536`)
+}
+
+// TestResolveSessionID tests that client session IDs are validated, assigned when missing and ignored when disabled
+func TestResolveSessionID(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	sessionID, perr := server.resolveSessionID([]byte(`{"session_id":"app-session_1"}`))
+	require.Nil(t, perr)
+	assert.Empty(t, sessionID, "disabled session IDs are not echoed")
+
+	server.SetClientSessionIDs(true)
+	sessionID, perr = server.resolveSessionID([]byte(`{"session_id":"app-session_1"}`))
+	require.Nil(t, perr)
+	assert.Equal(t, "app-session_1", sessionID)
+
+	for _, data := range []string{"", "{}", "not json"} {
+		sessionID, perr = server.resolveSessionID([]byte(data))
+		require.Nil(t, perr, data)
+		assert.Regexp(t, sessionIDPattern, sessionID, "a session ID is assigned for %q", data)
+	}
+	assert.NotEqual(t, newSessionID(), newSessionID())
+
+	for _, invalid := range []string{"short", "has space in it", "../../etc/passwd", strings.Repeat("a", 65)} {
+		_, perr = server.resolveSessionID([]byte(`{"session_id":"` + invalid + `"}`))
+		require.NotNil(t, perr, invalid)
+		assert.Equal(t, uint32(protocol.CodeBadRequest), perr.Code)
+	}
+
+	info := &ClientInfo{AjaibID: "12345", SessionID: "app-session_1"}
+	assert.Equal(t, "app-session_1", info.GetSessionID())
+	assert.Empty(t, (*ClientInfo)(nil).GetSessionID())
+}
+
+// TestDecodeRPC tests typed decoding and validation of RPC payloads
+func TestDecodeRPC(t *testing.T) {
+	req, perr := decodeRPC[BulkSubscribeRequest]([]byte(`{"channels":["user:12345:margin","rate:USDT:IDR"]}`), "subscribe")
+	require.Nil(t, perr)
+	assert.Equal(t, []string{"user:12345:margin", "rate:USDT:IDR"}, req.Channels)
+	assert.False(t, req.Raw)
+
+	req, perr = decodeRPC[BulkSubscribeRequest]([]byte(`{"channels":["user:12345:margin"],"raw":true}`), "subscribe")
+	require.Nil(t, perr)
+	assert.True(t, req.Raw)
+
+	req, perr = decodeRPC[BulkSubscribeRequest]([]byte(`{"channels":["user:12345:position"],"fields":["mark_price"]}`), "subscribe")
+	require.Nil(t, perr)
+	assert.Equal(t, []string{"mark_price"}, req.Fields)
+
+	for _, data := range []string{
+		`not json`,
+		`null`,
+		`{"channels":"user:12345:margin"}`,
+		`{"channels":["user:12345:margin",""]}`,
+		`{"channels":["user:12345:margin\u0000"]}`,
+		`{"channels":["` + strings.Repeat("a", channel.MaxLength+1) + `"]}`,
+		`{"channels":["a","b","c","d","e","f","g","h","i","j","k"]}`,
+		`{"channels":["user:12345:margin"],"fields":[]}`,
+		`{"channels":["user:12345:margin"],"fields":["Margin"]}`,
+		`{"channels":["user:12345:margin"],"fields":["margin"],"raw":true}`,
+	} {
+		_, perr := decodeRPC[BulkSubscribeRequest]([]byte(data), "subscribe")
+		require.NotNil(t, perr, data)
+		assert.Equal(t, uint32(protocol.CodeBadRequest), perr.Code, data)
+	}
+}
+
+// FuzzDecodeBulkSubscribe checks that decoding never panics and only accepts valid requests
+func FuzzDecodeBulkSubscribe(f *testing.F) {
+	for _, seed := range []string{
+		`{"channels":["user:12345:margin"]}`,
+		`{"channels":[]}`,
+		`{"channels":[null]}`,
+		`{"channels":["user:12345:margin"],"extra":{"nested":[1,2,3]}}`,
+		`[]`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		req, perr := decodeRPC[BulkSubscribeRequest](data, "subscribe")
+		if perr != nil {
+			return
+		}
+
+		require.NotEmpty(t, req.Channels)
+		require.LessOrEqual(t, len(req.Channels), maxBulkSubscribeChannels)
+		for _, ch := range req.Channels {
+			require.True(t, channel.ValidName(ch))
+		}
+	})
+}
+
+// BenchmarkFanOut measures delivering a server-side send to 1, 100 and 10k clients, serially and sharded
+func BenchmarkFanOut(b *testing.B) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "bench-node", LogLevel: "error"}, logger)
+
+	for _, workers := range []int{1, 8} {
+		for _, n := range []int{1, 100, 10000} {
+			clients := make([]*centrifuge.Client, n)
+			for i := range clients {
+				clients[i] = &centrifuge.Client{}
+			}
+
+			b.Run(strconv.Itoa(n)+"_clients_"+strconv.Itoa(workers)+"_workers", func(b *testing.B) {
+				server.SetFanOutWorkers(workers)
+
+				var delivered atomic.Int64
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					server.fanOut(clients, func(client *centrifuge.Client) {
+						delivered.Add(1)
+					})
+				}
+			})
+		}
+	}
+}
+
+// stubEntitlements is an entitlement provider with fixed answers
+type stubEntitlements struct {
+	revoked map[string]bool
+	err     error
+}
+
+func (e *stubEntitlements) CheckEntitlement(ctx context.Context, ajaibID string) (bool, error) {
+	return !e.revoked[ajaibID], e.err
+}
+func (e *stubEntitlements) Revoke(ajaibID string)  { e.revoked[ajaibID] = true }
+func (e *stubEntitlements) Restore(ajaibID string) { delete(e.revoked, ajaibID) }
+func (e *stubEntitlements) Revoked() []string {
+	var revoked []string
+	for ajaibID := range e.revoked {
+		revoked = append(revoked, ajaibID)
+	}
+	return revoked
+}
+
+// TestEntitlements tests connect-time entitlement checks and the force-revoke admin endpoint
+func TestEntitlements(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+
+	// Disabled: everyone connects and the endpoint is absent
+	assert.True(t, server.checkEntitlement(context.Background(), "client_1", "12345"))
+	rec := httptest.NewRecorder()
+	server.EntitlementsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/entitlements", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Revocations are replicated through the running node's notifications
+	entitlements := &stubEntitlements{revoked: map[string]bool{}}
+	server.SetEntitlementProvider(entitlements)
+	require.NoError(t, server.Start())
+	t.Cleanup(func() {
+		_ = server.node.Shutdown(context.Background())
+	})
+
+	rec = httptest.NewRecorder()
+	server.EntitlementsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/entitlements?ajaib_id=12345", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.False(t, server.checkEntitlement(context.Background(), "client_1", "12345"))
+	assert.True(t, server.checkEntitlement(context.Background(), "client_1", "67890"))
+
+	rec = httptest.NewRecorder()
+	server.EntitlementsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/entitlements", nil))
+	assert.JSONEq(t, `{"revoked":["12345"]}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	server.EntitlementsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/entitlements", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.EntitlementsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/entitlements?ajaib_id=12345", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.True(t, server.checkEntitlement(context.Background(), "client_1", "12345"))
+
+	// Lookup failures let users in
+	entitlements.revoked["12345"] = true
+	entitlements.err = assert.AnError
+	assert.True(t, server.checkEntitlement(context.Background(), "client_1", "12345"))
+}
+
+// sharedController relays control messages between the nodes of a test cluster
+type sharedController struct {
+	mu       sync.Mutex
+	handlers []centrifuge.ControlEventHandler
+}
+
+func (c *sharedController) RegisterControlEventHandler(h centrifuge.ControlEventHandler) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers = append(c.handlers, h)
+	return nil
+}
+
+func (c *sharedController) PublishControl(data []byte, nodeID, shardKey string) error {
+	c.mu.Lock()
+	handlers := slices.Clone(c.handlers)
+	c.mu.Unlock()
+	for _, h := range handlers {
+		if err := h.HandleControl(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TestEntitlementReplication tests that force-revocations reach every node and close the snapshot endpoint
+func TestEntitlementReplication(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	controller := &sharedController{}
+
+	newNode := func(name string) (*CentrifugeServer, *stubEntitlements) {
+		server := NewCentrifugeServer(&config.CentrifugeConfiguration{
+			NodeName:  name,
+			Namespace: "test-ns",
+			LogLevel:  "info",
+		}, logger)
+		entitlements := &stubEntitlements{revoked: map[string]bool{}}
+		server.SetEntitlementProvider(entitlements)
+		server.node.SetController(controller)
+		require.NoError(t, server.Start())
+		t.Cleanup(func() {
+			_ = server.node.Shutdown(context.Background())
+		})
+		return server, entitlements
+	}
+	first, _ := newNode("node-1")
+	second, secondEntitlements := newNode("node-2")
+
+	rec := httptest.NewRecorder()
+	first.EntitlementsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/entitlements?ajaib_id=12345", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.True(t, secondEntitlements.revoked["12345"])
+	assert.False(t, second.checkEntitlement(context.Background(), "client_1", "12345"))
+
+	// The revoked user cannot read balances from the other node's snapshot endpoint
+	mux := http.NewServeMux()
+	mux.Handle(SnapshotPath, second.SnapshotHandler())
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/snapshot/user:12345:margin", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken("12345"))
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), strconv.Itoa(CodeEntitlementRevoked))
+
+	rec = httptest.NewRecorder()
+	first.EntitlementsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/entitlements?ajaib_id=12345", nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.True(t, second.checkEntitlement(context.Background(), "client_1", "12345"))
+}
+
+// claimsToken returns an unsigned JWT carrying the given claims
+func claimsToken(claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	return header + "." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + ".sig"
+}
+
+// TestSessionReauth tests refreshing limited sessions and their reauth schedule
+func TestSessionReauth(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:           "test-node",
+		Namespace:          "test-ns",
+		LogLevel:           "info",
+		MaxSessionSeconds:  86400,
+		ReauthGraceSeconds: 60,
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	metrics := NewMetrics(server.Node())
+	server.SetMetrics(metrics)
+
+	now := time.Now()
+	token := testToken("12345")
+	info := &ClientInfo{AjaibID: "12345", TokenHash: tokenHash(token), SessionExpiresAt: now.UnixMilli()}
+
+	// A new token of the same user starts a new maximum duration
+	refreshed, perr := server.reauthenticate(info, claimsToken(`{"sub":"12345","device_id":"d1"}`), now)
+	require.Nil(t, perr)
+	assert.Equal(t, now.Add(24*time.Hour).Truncate(time.Second).UnixMilli(), refreshed.SessionExpiresAt)
+	assert.NotEqual(t, info.TokenHash, refreshed.TokenHash)
+
+	// The session's own token, another user's token and impersonation without scope are rejected
+	_, perr = server.reauthenticate(info, token, now)
+	assert.Equal(t, uint32(CodeUnauthorized), perr.Code)
+	_, perr = server.reauthenticate(info, testToken("67890"), now)
+	assert.Equal(t, uint32(CodeUnauthorized), perr.Code)
+	_, perr = server.reauthenticate(info, claimsToken(`{"sub":"agent-7","impersonate":"12345"}`), now)
+	assert.Equal(t, uint32(CodeUnauthorized), perr.Code)
+	_, perr = server.reauthenticate(nil, token, now)
+	assert.Equal(t, uint32(CodeUnauthorized), perr.Code)
+
+	// A session past its maximum duration is notified once, then disconnected after the grace window
+	client := &recordingSessionClient{}
+	sess := &reauthSession{client: client, expireAt: now.Add(-time.Second)}
+	sess.timer = time.AfterFunc(time.Hour, func() {})
+	defer sess.timer.Stop()
+
+	server.checkSession(sess)
+	server.checkSession(sess)
+	assert.True(t, sess.notified)
+	require.Len(t, client.sent, 1)
+	var notice ReauthMessage
+	require.NoError(t, json.Unmarshal(client.sent[0], &notice))
+	assert.Equal(t, "reauth_required", notice.Type)
+	assert.Equal(t, sess.expireAt.UnixMilli(), notice.ExpiredAt)
+	assert.Equal(t, sess.expireAt.Add(time.Minute).UnixMilli(), notice.DisconnectAt)
+	assert.Empty(t, client.disconnects)
+	assert.Zero(t, counterValue(t, metrics.sessionReauths.WithLabelValues("test-node", ReauthExpired)))
+
+	sess.expireAt = now.Add(-2 * time.Minute)
+	server.checkSession(sess)
+	require.Len(t, client.disconnects, 1)
+	assert.Equal(t, uint32(CodeReauthRequired), client.disconnects[0].Code)
+	assert.Equal(t, 1.0, counterValue(t, metrics.sessionReauths.WithLabelValues("test-node", ReauthExpired)))
+
+	// Unlimited sessions are not scheduled
+	runNode(t, server)
+	unlimited := newTestClient(t, server)
+	server.startSession(HubEvent{Client: unlimited, Info: &ClientInfo{AjaibID: "12345"}})
+	_, ok := server.sessions.Load(unlimited.ID())
+	assert.False(t, ok)
+}
+
+// recordingSessionClient records the pushes and disconnects of a session's client
+type recordingSessionClient struct {
+	sent        [][]byte
+	disconnects []centrifuge.Disconnect
+}
+
+func (c *recordingSessionClient) ID() string     { return "client-1" }
+func (c *recordingSessionClient) UserID() string { return "12345" }
+
+func (c *recordingSessionClient) Send(data []byte) error {
+	c.sent = append(c.sent, data)
+	return nil
+}
+
+func (c *recordingSessionClient) Disconnect(disconnect ...centrifuge.Disconnect) {
+	c.disconnects = append(c.disconnects, disconnect...)
+}
+
+// stubRegions is a region resolver with fixed answers
+type stubRegions struct {
+	regions map[int64]string
+	err     error
+}
+
+func (r *stubRegions) GetCfxUserRegion(ctx context.Context, ajaibID int64) (string, error) {
+	return r.regions[ajaibID], r.err
+}
+
+// TestRegionRedirect tests redirecting users held by another region to its endpoint
+func TestRegionRedirect(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	server.SetInstanceMetadata("pod-0", "ap-southeast-3")
+
+	// Disabled: everyone is served here
+	assert.Nil(t, server.regionRedirect(context.Background(), "client_1", "12345"))
+
+	regions := &stubRegions{regions: map[int64]string{
+		12345: "ap-southeast-1",
+		23456: "ap-southeast-3",
+		34567: "us-east-1",
+	}}
+	server.SetRegionAffinity(regions, map[string]string{"ap-southeast-1": "wss://sg.example.com/connection"})
+
+	perr := server.regionRedirect(context.Background(), "client_1", "12345")
+	require.NotNil(t, perr)
+	assert.Equal(t, uint32(CodeRegionRedirect), perr.Code)
+	assert.Equal(t, "ap-southeast-1", perr.Details["region"])
+	assert.Equal(t, "wss://sg.example.com/connection", perr.Details["endpoint"])
+
+	// Local users, users without a region and regions without an endpoint are served here
+	assert.Nil(t, server.regionRedirect(context.Background(), "client_1", "23456"))
+	assert.Nil(t, server.regionRedirect(context.Background(), "client_1", "45678"))
+	assert.Nil(t, server.regionRedirect(context.Background(), "client_1", "34567"))
+
+	// Lookup failures let users in
+	regions.err = assert.AnError
+	assert.Nil(t, server.regionRedirect(context.Background(), "client_1", "12345"))
+}
+
+// TestHubStats tests channel cardinality by type, the memory estimate and the debug endpoint
+func TestHubStats(t *testing.T) {
+	now := time.Now()
+	stats := newHubStats(now, 2, 1, map[string]int{
+		"user:12345:margin":       2,
+		"user:12345:position":     1,
+		"raw:user:12345:position": 1,
+		"rate:USDT:IDR":           4,
+	})
+
+	assert.Equal(t, 4, stats.Channels)
+	assert.Equal(t, 8, stats.Subscriptions)
+	assert.Equal(t, 2.0, stats.AvgSubscribersPerChannel)
+	assert.Equal(t, HubChannelTypeStats{Channels: 1, Subscriptions: 1}, stats.ChannelTypes["raw"])
+	assert.Equal(t, HubChannelTypeStats{Channels: 1, Subscriptions: 2}, stats.ChannelTypes["margin"])
+	nameBytes := len("user:12345:margin") + len("user:12345:position") + len("raw:user:12345:position") + len("rate:USDT:IDR")
+	assert.EqualValues(t, 2*hubClientBytes+4*hubChannelBytes+nameBytes+8*hubSubscriptionBytes, stats.EstimatedBytes)
+
+	empty := newHubStats(now, 0, 0, nil)
+	assert.Zero(t, empty.AvgSubscribersPerChannel)
+	assert.Zero(t, empty.EstimatedBytes)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+
+	rec := httptest.NewRecorder()
+	server.HubStatsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/hub", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body HubStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.False(t, body.CollectedAt.IsZero())
+	assert.NotNil(t, server.hubStats.Load(), "the first request collects a snapshot")
+}
+
+// TestQueueOverflow tests that slow client disconnects are reported with the channels they dropped
+func TestQueueOverflow(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	cfg := &config.CentrifugeConfiguration{
+		NodeName:  "test-node",
+		Namespace: "test-ns",
+		LogLevel:  "info",
+	}
+
+	server := NewCentrifugeServer(cfg, logger)
+	client := &centrifuge.Client{}
+	slow := centrifuge.DisconnectSlow
+
+	// A normal disconnect is not reported and forgets the noted channels
+	server.handleUnsubscribe(client, centrifuge.UnsubscribeEvent{Channel: channel.RateUSDTIDR, Disconnect: &centrifuge.DisconnectConnectionClosed})
+	server.handleDisconnect(client, centrifuge.DisconnectEvent{Disconnect: centrifuge.DisconnectConnectionClosed})
+	assert.Equal(t, int64(0), server.overflows.report().Total)
+
+	server.handleUnsubscribe(client, centrifuge.UnsubscribeEvent{Channel: channel.UserChannel("12345", "margin"), Disconnect: &slow})
+	server.handleUnsubscribe(client, centrifuge.UnsubscribeEvent{Channel: channel.UserChannel("12345", "position"), Disconnect: &slow})
+	server.handleDisconnect(client, centrifuge.DisconnectEvent{Disconnect: slow})
+
+	rec := httptest.NewRecorder()
+	server.OverflowsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/overflows", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var report OverflowReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, int64(1), report.Total)
+	assert.Equal(t, map[string]int64{"margin": 1, "position": 1}, report.ByChannelType)
+	require.Len(t, report.Recent, 1)
+	assert.Equal(t, []string{"user:12345:margin", "user:12345:position"}, report.Recent[0].Channels)
+	assert.Equal(t, 1048576, report.Recent[0].QueueLimitBytes)
+	assert.Empty(t, server.overflows.pending)
+}
+
+// TestLiveness tests timing socket writes, scoring connection responsiveness and the liveness endpoint
+func TestLiveness(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+
+	// Connections are not tracked until liveness is set
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/connection", nil)
+	w, r := server.trackLiveness(rec, req)
+	assert.Same(t, rec, w)
+	assert.Nil(t, livenessFrom(r.Context()))
+	assert.Zero(t, server.checkLiveness(time.Now()))
+
+	server.SetLiveness(LivenessLimits{SlowWrite: 10 * time.Millisecond, MaxWriteStall: time.Second})
+	assert.Equal(t, defaultLivenessCheckInterval, server.liveness.CheckInterval)
+
+	// The upgrade hijacks a connection timing its writes, and the client context carries its liveness
+	hijacked := make(chan *connLiveness, 1)
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r = server.trackLiveness(w, r)
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if sc, ok := conn.(*stallConn); ok && sc.liveness == livenessFrom(r.Context()) {
+			hijacked <- sc.liveness
+		}
+		close(hijacked)
+	}))
+	defer httpServer.Close()
+	conn, err := net.Dial("tcp", httpServer.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /connection HTTP/1.1\r\nHost: test\r\n\r\n"))
+	require.NoError(t, err)
+	assert.NotNil(t, <-hijacked)
+
+	// A write blocked on a peer not reading is a stall, counted while in flight and once done
+	local, peer := net.Pipe()
+	defer local.Close()
+	defer peer.Close()
+	l := &connLiveness{slowWrite: 10 * time.Millisecond}
+	sc := &stallConn{Conn: local, liveness: l}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = io.ReadAll(peer)
+	}()
+	_, err = sc.Write([]byte("x"))
+	require.NoError(t, err)
+	_, err = sc.Write(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), l.stalls, "fast writes are not stalls")
+	assert.GreaterOrEqual(t, l.stalled(time.Now()), 40*time.Millisecond)
+
+	now := time.Now()
+	l.resetWindow(now.Add(-5 * time.Second))
+	assert.Zero(t, l.stalled(now))
+	l.writingSince.Store(now.Add(-3 * time.Second).UnixNano())
+	assert.Equal(t, 3*time.Second, l.stalled(now))
+	l.resetWindow(now)
+	assert.Equal(t, 2*time.Second, l.stalled(now.Add(2*time.Second)), "only the stall since the last check counts")
+	l.writingSince.Store(0)
+	l.recordWrite(now.Add(-3*time.Second), now.Add(2*time.Second))
+	assert.Equal(t, 2*time.Second, l.stalled(now.Add(2*time.Second)))
+	assert.Equal(t, 5*time.Second, l.maxStall)
+
+	// The score is the lowest of the pong latency, ping and write stall scores
+	l = &connLiveness{slowWrite: 10 * time.Millisecond, windowStart: now}
+	def := ConnectionProfile{Name: "default"}
+	snapshot := server.livenessSnapshot(l, def, 0, false, now, now)
+	assert.Equal(t, 100, snapshot.Score)
+	assert.Nil(t, snapshot.PongLatencyMs)
+
+	snapshot = server.livenessSnapshot(l, def, 5*time.Second, true, now, now)
+	assert.Equal(t, 50, snapshot.Score, "half the pong timeout")
+	require.NotNil(t, snapshot.PongLatencyMs)
+	assert.Equal(t, int64(5000), *snapshot.PongLatencyMs)
+
+	l.recordWrite(now, now.Add(750*time.Millisecond))
+	snapshot = server.livenessSnapshot(l, def, 0, false, now, now)
+	assert.Equal(t, 25, snapshot.Score, "three quarters of the maximum write stall")
+	assert.Equal(t, int64(1), snapshot.WriteStalls)
+	assert.Equal(t, int64(750), snapshot.StalledMs)
+
+	client := ConnectionProfile{Name: "sdk", KeepaliveMode: KeepaliveClient, PingInterval: time.Second}
+	l = &connLiveness{slowWrite: 10 * time.Millisecond}
+	assert.Equal(t, 100, server.livenessSnapshot(l, client, 0, false, now, now.Add(time.Second)).Score)
+	assert.Equal(t, 50, server.livenessSnapshot(l, client, 0, false, now, now.Add(1500*time.Millisecond)).Score)
+	l.recordPing(now.Add(time.Second))
+	snapshot = server.livenessSnapshot(l, client, 0, false, now, now.Add(1500*time.Millisecond))
+	assert.Equal(t, 100, snapshot.Score)
+	assert.Equal(t, int64(1), snapshot.Pings)
+	require.NotNil(t, snapshot.LastPingMs)
+	assert.Equal(t, int64(500), *snapshot.LastPingMs)
+	assert.Equal(t, 0, server.livenessSnapshot(l, client, 0, false, now, now.Add(4*time.Second)).Score)
+
+	rec = httptest.NewRecorder()
+	server.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/liveness?limit=10", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report LivenessReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Empty(t, report.Clients)
+	assert.Zero(t, report.Disconnected)
+
+	rec = httptest.NewRecorder()
+	server.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/liveness?limit=x", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// TestCaptures tests capturing sampled publications written to a channel's clients through the admin endpoint
+func TestCaptures(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelError}))
+	server := NewCentrifugeServer(&config.CentrifugeConfiguration{NodeName: "test-node"}, logger)
+	handler := server.CapturesHandler()
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	for _, target := range []string{"/debug/captures", "/debug/captures?channel=user:12345:margin&count=0", "/debug/captures?channel=user:12345:margin&count=1001", "/debug/captures?channel=user:12345:margin&sample=x"} {
+		assert.Equal(t, http.StatusBadRequest, serve(http.MethodPost, target).Code, target)
+	}
+
+	rec := serve(http.MethodPost, "/debug/captures?channel=user:12345:margin&count=2&sample=2")
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var capture Capture
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &capture))
+	assert.Equal(t, 2, capture.Count)
+	assert.Equal(t, 2, capture.Sample)
+
+	client := &centrifuge.Client{}
+	write := func(ch, data string) bool {
+		return server.capturePublication(client, centrifuge.TransportWriteEvent{Channel: ch, Data: []byte(data)})
+	}
+	assert.True(t, write("user:12345:margin", `{"push":{"channel":"user:12345:margin","join":{"info":{}}}}`), "writes are never held back")
+	assert.True(t, write("user:67890:margin", `{"push":{"channel":"user:67890:margin","pub":{"data":{"n":0}}}}`))
+	for i := 1; i <= 5; i++ {
+		write("user:12345:margin", `{"push":{"channel":"user:12345:margin","pub":{"data":{"n":`+strconv.Itoa(i)+`},"offset":`+strconv.Itoa(i)+`,"tags":{"stale":"true"}}}}`)
+	}
+
+	rec = serve(http.MethodGet, "/debug/captures?id="+capture.ID)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &capture))
+	assert.True(t, capture.Done)
+	assert.Equal(t, int64(3), capture.Seen, "publications after the capture finished are not seen")
+	require.Len(t, capture.Publications, 2)
+	assert.JSONEq(t, `{"n":1}`, string(capture.Publications[0].Data))
+	assert.Equal(t, uint64(3), capture.Publications[1].Offset)
+	assert.Equal(t, map[string]string{"stale": "true"}, capture.Publications[1].Tags)
+	assert.Zero(t, server.captures.active.Load())
+
+	// Protobuf replies are kept encoded
+	pub := decodeCapture([]byte{0x0a, 0x01})
+	require.NotNil(t, pub)
+	assert.Equal(t, []byte{0x0a, 0x01}, pub.Raw)
+
+	// Captures are bounded, listed without their publications and expire
+	for i := 1; i < maxCaptures; i++ {
+		_, ok := server.StartCapture(channel.RateUSDTIDR, "", 1, 1)
+		require.True(t, ok)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/debug/captures?channel="+channel.RateUSDTIDR).Code)
+
+	rec = serve(http.MethodGet, "/debug/captures")
+	var list map[string][]Capture
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list["captures"], maxCaptures)
+	assert.Nil(t, list["captures"][maxCaptures-1].Publications)
+
+	assert.Equal(t, http.StatusNoContent, serve(http.MethodDelete, "/debug/captures?id="+capture.ID).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodDelete, "/debug/captures?id="+capture.ID).Code)
+	assert.Equal(t, http.StatusNotFound, serve(http.MethodGet, "/debug/captures?id="+capture.ID).Code)
+	assert.Equal(t, int32(maxCaptures-1), server.captures.active.Load())
+
+	assert.Empty(t, server.captures.list(time.Now().Add(captureRetention)))
+	assert.Zero(t, server.captures.active.Load())
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(http.MethodPut, "/debug/captures").Code)
+}
+
+// TestOverflowLogBounded tests that the overflow log keeps only the newest events
+func TestOverflowLogBounded(t *testing.T) {
+	log := newOverflowLog()
+	for i := 0; i < overflowLogSize+5; i++ {
+		log.record(OverflowEvent{ClientID: strconv.Itoa(i), Channels: []string{channel.RateUSDTIDR}})
+	}
+
+	report := log.report()
+	assert.Equal(t, int64(overflowLogSize+5), report.Total)
+	assert.Equal(t, int64(overflowLogSize+5), report.ByChannelType["rate"])
+	require.Len(t, report.Recent, overflowLogSize)
+	assert.Equal(t, strconv.Itoa(overflowLogSize+4), report.Recent[0].ClientID)
+	assert.Equal(t, "5", report.Recent[overflowLogSize-1].ClientID)
+}
@@ -0,0 +1,36 @@
+package server
+
+// Readiness statuses of an instance handing its consumer group share over on deploys
+const (
+	readinessJoining  = "joining"
+	readinessDraining = "draining"
+)
+
+// GroupMember is an upstream consumer sharing its partitions with the other replicas (implemented by the Kafka consumer)
+type GroupMember interface {
+	Joined() bool
+}
+
+// SetJoinGate holds readiness at "joining" until member has joined its consumer group, so a rolling
+// deploy only replaces the next replica once this one consumes its share of the partitions
+func (s *CentrifugeServer) SetJoinGate(member GroupMember) {
+	s.joinGate = member
+}
+
+// Drain fails readiness and sheds new upgrades while the open connections are kept until Shutdown.
+// Called when the instance hands its partitions over, so the load balancer moves traffic to the other replicas.
+func (s *CentrifugeServer) Drain() {
+	s.draining.Store(true)
+	s.logger.Info("draining connections", "connections", s.GetClientCount())
+}
+
+// handoffStatus returns the readiness status while joining the consumer group or draining, empty otherwise
+func (s *CentrifugeServer) handoffStatus() string {
+	if s.draining.Load() {
+		return readinessDraining
+	}
+	if s.joinGate != nil && !s.joinGate.Joined() {
+		return readinessJoining
+	}
+	return ""
+}
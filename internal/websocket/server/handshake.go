@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Reasons of connections rejected before the client connected, as counted by centrifuge_connections_failed_total
+const (
+	// FailedHeaderTimeout counts connections whose request headers took the read header timeout
+	FailedHeaderTimeout = "header_timeout"
+
+	// FailedHandshakeTimeout counts upgraded connections closed for sending no connect command in time
+	FailedHandshakeTimeout = "handshake_timeout"
+
+	// FailedRequestTooLarge counts upgrade requests rejected for carrying a body
+	FailedRequestTooLarge = "request_too_large"
+)
+
+// Handshake limits used when none are configured
+const (
+	defaultReadHeaderTimeout = 5 * time.Second
+	defaultHandshakeTimeout  = 10 * time.Second
+	defaultMaxHeaderBytes    = 16 << 10
+)
+
+// handshakeContextKey stores the handshake of an upgrade in the request context
+type handshakeContextKey struct{}
+
+// HandshakeLimits bound the time and size of a client's handshake, so slow-loris clients cannot hold
+// connections open without connecting. Zero values keep the defaults.
+type HandshakeLimits struct {
+	// ReadHeaderTimeout bounds reading the upgrade request headers (5s when zero)
+	ReadHeaderTimeout time.Duration
+
+	// HandshakeTimeout bounds the time from the upgrade request to the client's connect command (10s when zero)
+	HandshakeTimeout time.Duration
+
+	// MaxHeaderBytes bounds the request line and headers of the upgrade request (16KB when zero)
+	MaxHeaderBytes int
+}
+
+// SetHandshakeLimits bounds the upgrade requests and connect handshakes of clients
+func (s *CentrifugeServer) SetHandshakeLimits(limits HandshakeLimits) {
+	if limits.ReadHeaderTimeout <= 0 {
+		limits.ReadHeaderTimeout = defaultReadHeaderTimeout
+	}
+	if limits.HandshakeTimeout <= 0 {
+		limits.HandshakeTimeout = defaultHandshakeTimeout
+	}
+	if limits.MaxHeaderBytes <= 0 {
+		limits.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+	s.handshakeLimits = limits
+}
+
+// ApplyHandshakeLimits sets the header timeout and size of the HTTP server serving upgrades, counting the
+// connections whose headers hit the timeout
+func (s *CentrifugeServer) ApplyHandshakeLimits(httpServer *http.Server) {
+	httpServer.ReadHeaderTimeout = s.handshakeLimits.ReadHeaderTimeout
+	httpServer.MaxHeaderBytes = s.handshakeLimits.MaxHeaderBytes
+	httpServer.ConnState = s.trackConnState
+}
+
+// trackConnState counts new connections that took the read header timeout to send their request headers,
+// or sent none. Keep-alive connections are only tracked for their first request.
+func (s *CentrifugeServer) trackConnState(conn net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		s.acceptedConns.Store(conn, time.Now())
+	case http.StateActive, http.StateClosed, http.StateHijacked:
+		acceptedAt, ok := s.acceptedConns.LoadAndDelete(conn)
+		if ok && state != http.StateHijacked && time.Since(acceptedAt.(time.Time)) >= s.handshakeLimits.ReadHeaderTimeout {
+			s.recordFailedHandshake(FailedHeaderTimeout, conn.RemoteAddr().String())
+		}
+	}
+}
+
+// recordFailedHandshake counts a connection rejected before the client connected
+func (s *CentrifugeServer) recordFailedHandshake(reason, remoteAddr string) {
+	if s.metrics != nil {
+		s.metrics.RecordFailedConnection(s.config.NodeName, reason)
+	}
+	// Slow-loris floods would flood the logs at a higher level
+	s.logger.Debug("connection rejected during handshake",
+		"reason", reason,
+		"remote_addr", remoteAddr)
+}
+
+// handshake is an upgrade waiting for the client's connect command. Its connection is closed when the
+// command doesn't arrive within the handshake timeout.
+type handshake struct {
+	timer *time.Timer
+
+	// conn is the hijacked connection until the client connects
+	conn       net.Conn
+	remoteAddr string
+	connected  bool
+	mu         sync.Mutex
+}
+
+// startHandshake starts the handshake deadline of an upgrade request, or returns nil without a timeout
+func (s *CentrifugeServer) startHandshake(r *http.Request) *handshake {
+	if s.handshakeLimits.HandshakeTimeout <= 0 {
+		return nil
+	}
+
+	h := &handshake{remoteAddr: r.RemoteAddr}
+	h.timer = time.AfterFunc(s.handshakeLimits.HandshakeTimeout, func() {
+		if h.expire() {
+			s.recordFailedHandshake(FailedHandshakeTimeout, h.remoteAddr)
+		}
+	})
+	return h
+}
+
+// expire closes the upgraded connection unless the client connected, reporting whether it closed it
+func (h *handshake) expire() bool {
+	h.mu.Lock()
+	conn := h.conn
+	h.conn = nil
+	connected := h.connected
+	h.mu.Unlock()
+
+	if connected || conn == nil {
+		return false
+	}
+	_ = conn.Close()
+	return true
+}
+
+// connect stops the handshake deadline once the client sent its connect command; nil handshakes are ignored
+func (h *handshake) connect() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	h.connected = true
+	h.conn = nil
+	h.mu.Unlock()
+	h.timer.Stop()
+}
+
+// hijacked reports whether the upgrade took over the connection
+func (h *handshake) hijacked() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.conn != nil || h.connected
+}
+
+// handshakeWriter records the connection hijacked by the WebSocket upgrade
+type handshakeWriter struct {
+	http.ResponseWriter
+	handshake *handshake
+}
+
+// Hijack takes over the connection for the WebSocket upgrade
+func (w *handshakeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.handshake.mu.Lock()
+		w.handshake.conn = conn
+		w.handshake.mu.Unlock()
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController
+func (w *handshakeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serveHandshake serves an upgrade request under the handshake limits
+func (s *CentrifugeServer) serveHandshake(w http.ResponseWriter, r *http.Request, serve func(http.ResponseWriter, *http.Request)) {
+	// Upgrade requests carry no body; ContentLength is -1 for chunked bodies
+	if r.ContentLength != 0 {
+		s.recordFailedHandshake(FailedRequestTooLarge, r.RemoteAddr)
+		http.Error(w, "upgrade requests must not have a body", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	h := s.startHandshake(r)
+	if h == nil {
+		serve(w, r)
+		return
+	}
+
+	serve(&handshakeWriter{ResponseWriter: w, handshake: h}, r.WithContext(context.WithValue(r.Context(), handshakeContextKey{}, h)))
+
+	// HTTP/1.1 upgrades return once the connection is hijacked; a failed upgrade has nothing to close
+	if !h.hijacked() {
+		h.timer.Stop()
+	}
+}
+
+// handshakeFrom returns the handshake of the upgrade request a connect command arrived on
+func handshakeFrom(ctx context.Context) *handshake {
+	h, _ := ctx.Value(handshakeContextKey{}).(*handshake)
+	return h
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Rough per-entry costs of Centrifuge's hub maps, including map overhead. They only need to be right
+// within a factor of two to plan capacity.
+const (
+	hubClientBytes       = 160 // client, user and session index entries of a connection
+	hubChannelBytes      = 120 // subscriber map of a channel, excluding its name
+	hubSubscriptionBytes = 80  // subscriber entry of a client in a channel
+)
+
+// HubChannelTypeStats is the cardinality of one channel type
+type HubChannelTypeStats struct {
+	Channels      int `json:"channels"`
+	Subscriptions int `json:"subscriptions"`
+}
+
+// HubStats is the channel cardinality of this instance's hub and an estimate of the memory it holds
+type HubStats struct {
+	CollectedAt              time.Time                      `json:"collected_at"`
+	Clients                  int                            `json:"clients"`
+	Users                    int                            `json:"users"`
+	Channels                 int                            `json:"channels"`
+	Subscriptions            int                            `json:"subscriptions"`
+	AvgSubscribersPerChannel float64                        `json:"avg_subscribers_per_channel"`
+	EstimatedBytes           int64                          `json:"estimated_bytes"`
+	ChannelTypes             map[string]HubChannelTypeStats `json:"channel_types"`
+}
+
+// HubStats computes the hub cardinality. It walks every channel, so metrics collect it periodically
+// rather than on every scrape.
+func (s *CentrifugeServer) HubStats() HubStats {
+	hub := s.node.Hub()
+
+	subscribers := make(map[string]int)
+	for _, ch := range hub.Channels() {
+		subscribers[ch] = hub.NumSubscribers(ch)
+	}
+	return newHubStats(time.Now(), hub.NumClients(), hub.NumUsers(), subscribers)
+}
+
+// newHubStats aggregates the subscriber count of each channel
+func newHubStats(now time.Time, clients, users int, subscribers map[string]int) HubStats {
+	stats := HubStats{
+		CollectedAt:  now,
+		Clients:      clients,
+		Users:        users,
+		Channels:     len(subscribers),
+		ChannelTypes: make(map[string]HubChannelTypeStats),
+	}
+
+	var nameBytes int
+	for ch, n := range subscribers {
+		stats.Subscriptions += n
+		nameBytes += len(ch)
+
+		channelType := hubChannelType(ch)
+		typeStats := stats.ChannelTypes[channelType]
+		typeStats.Channels++
+		typeStats.Subscriptions += n
+		stats.ChannelTypes[channelType] = typeStats
+	}
+
+	if stats.Channels > 0 {
+		stats.AvgSubscribersPerChannel = float64(stats.Subscriptions) / float64(stats.Channels)
+	}
+	stats.EstimatedBytes = int64(clients*hubClientBytes + stats.Channels*hubChannelBytes + nameBytes +
+		stats.Subscriptions*hubSubscriptionBytes)
+	return stats
+}
+
+// HubSubscription is a subscription of a connected client to a channel routed from Kafka
+type HubSubscription struct {
+	ClientID        string `json:"client_id"`
+	CfxUserID       string `json:"cfx_user_id"`
+	AjaibID         string `json:"ajaib_id"`
+	QuotePreference string `json:"quote_preference"`
+	Channel         string `json:"channel"`
+
+	client *centrifuge.Client
+}
+
+// SnapshotSubscriptions returns the subscriptions of this instance's connected clients to channels routed
+// from Kafka, so a routing table can be rebuilt from the hub instead of starting empty
+func (s *CentrifugeServer) SnapshotSubscriptions() []HubSubscription {
+	var subscriptions []HubSubscription
+	for _, client := range s.node.Hub().Connections() {
+		info := s.getClientInfo(client)
+		if info == nil || info.CfxUserID == "" {
+			continue
+		}
+		for _, ch := range client.Channels() {
+			// Channels of families other than the user family are published by the server itself, not routed from Kafka
+			if channel.IsRegistered(ch) {
+				continue
+			}
+			subscriptions = append(subscriptions, HubSubscription{
+				ClientID:        client.ID(),
+				CfxUserID:       info.CfxUserID,
+				AjaibID:         info.AjaibID,
+				QuotePreference: info.QuotePreference,
+				Channel:         ch,
+				client:          client,
+			})
+		}
+	}
+	return subscriptions
+}
+
+// hubChannelType labels a channel for cardinality metrics; raw variants are counted apart from user channels
+func hubChannelType(ch string) string {
+	if channel.IsRaw(ch) {
+		return "raw"
+	}
+	if channelType := channel.ChannelType(ch); channelType != "" {
+		return channelType
+	}
+	return "other"
+}
+
+// collectHubStats computes the hub stats and keeps them for the debug endpoint
+func (s *CentrifugeServer) collectHubStats() HubStats {
+	stats := s.HubStats()
+	s.hubStats.Store(&stats)
+	return stats
+}
+
+// HubStatsHandler returns the admin HTTP handler dumping the hub stats of the last metrics collection,
+// or fresh ones with ?fresh=true or before the first collection
+func (s *CentrifugeServer) HubStatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stats := s.hubStats.Load()
+		if stats == nil || r.URL.Query().Get("fresh") == "true" {
+			fresh := s.collectHubStats()
+			stats = &fresh
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stats); err != nil {
+			s.logger.Error("failed to encode hub stats", "error", err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+
+	"coin-futures-websocket/internal/auth"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/protocol"
+)
+
+// ImpersonationSession is a support agent's read-only session on another user's channels
+type ImpersonationSession struct {
+	ClientID    string   `json:"client_id"`
+	Agent       string   `json:"agent"`
+	AjaibID     string   `json:"ajaib_id"`
+	ClientIP    string   `json:"client_ip,omitempty"`
+	ConnectedAt int64    `json:"connected_at"`
+	Channels    []string `json:"channels"`
+}
+
+// ImpersonationDump is the response body of the impersonation endpoint
+type ImpersonationDump struct {
+	Instance InstanceInfo           `json:"instance"`
+	Sessions []ImpersonationSession `json:"sessions"`
+}
+
+// sessionUser returns the user whose channels a token reads. A token with the impersonate claim reads the
+// impersonated user's channels and needs the impersonate scope; the agent is its subject.
+func sessionUser(claims *auth.Claims) (ajaibID, agent string, perr *protocol.Error) {
+	if claims.Impersonate == "" {
+		return claims.Sub, "", nil
+	}
+	if !claims.HasScope(channel.ScopeImpersonate) {
+		return "", "", protocol.ErrUnauthorized("impersonation requires the " + channel.ScopeImpersonate + " scope")
+	}
+	return claims.Impersonate, claims.Sub, nil
+}
+
+// SetAuditLogger sets the logger recording impersonation sessions
+func (s *CentrifugeServer) SetAuditLogger(logger *slog.Logger) {
+	s.audit = logger
+}
+
+// auditImpersonation records every connect, subscription and disconnect of impersonation sessions
+func (s *CentrifugeServer) auditImpersonation(event HubEvent) {
+	if event.Info == nil || event.Info.ImpersonatedBy == "" {
+		return
+	}
+
+	attrs := []any{
+		"event", string(event.Type),
+		"agent", event.Info.ImpersonatedBy,
+		"ajaib_id", event.Info.AjaibID,
+		"client_id", event.Client.ID(),
+		"client_ip", event.Info.ClientIP,
+	}
+	if event.Channel != "" {
+		attrs = append(attrs, "channel", event.Channel)
+	}
+	if event.Type == HubClientUnregistered {
+		attrs = append(attrs,
+			"disconnect_code", event.DisconnectCode,
+			"session_duration_ms", event.Time.UnixMilli()-event.Info.ConnectedAt)
+	}
+	s.audit.Info("impersonation session", attrs...)
+}
+
+// Impersonations returns the impersonation sessions connected to this instance, oldest first
+func (s *CentrifugeServer) Impersonations() []ImpersonationSession {
+	sessions := []ImpersonationSession{}
+	for _, client := range s.node.Hub().Connections() {
+		info := s.getClientInfo(client)
+		if info == nil || info.ImpersonatedBy == "" {
+			continue
+		}
+		sessions = append(sessions, ImpersonationSession{
+			ClientID:    client.ID(),
+			Agent:       info.ImpersonatedBy,
+			AjaibID:     info.AjaibID,
+			ClientIP:    info.ClientIP,
+			ConnectedAt: info.ConnectedAt,
+			Channels:    client.Channels(),
+		})
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].ConnectedAt < sessions[j].ConnectedAt
+	})
+	return sessions
+}
+
+// ImpersonationsHandler returns the admin HTTP handler listing the impersonation sessions on this instance
+func (s *CentrifugeServer) ImpersonationsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dump := ImpersonationDump{
+			Instance: s.Instance(),
+			Sessions: s.Impersonations(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dump); err != nil {
+			s.logger.Error("failed to encode impersonation sessions", "error", err)
+		}
+	})
+}
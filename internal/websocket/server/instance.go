@@ -0,0 +1,52 @@
+package server
+
+import (
+	"os"
+
+	"coin-futures-websocket/internal/version"
+)
+
+// InstanceInfo identifies the replica serving a connection so support can
+// correlate a user's session with that instance's logs and metrics
+type InstanceInfo struct {
+	InstanceID string `json:"instance_id"`
+	PodName    string `json:"pod_name,omitempty"`
+	Region     string `json:"region,omitempty"`
+
+	// Version is the build running on the replica, to follow rollouts across replicas
+	Version string `json:"version"`
+}
+
+// ConnectReplyData is sent to clients in the connected message
+type ConnectReplyData struct {
+	Instance InstanceInfo `json:"instance"`
+
+	// Keepalive tells the client whether to answer pings or send its own
+	Keepalive KeepaliveInfo `json:"keepalive"`
+
+	// SessionID is the session to send back in the connect data when reconnecting
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// SetInstanceMetadata sets the pod name and region reported to clients and admin listings.
+// An empty pod name falls back to POD_NAME and then the hostname.
+func (s *CentrifugeServer) SetInstanceMetadata(podName, region string) {
+	if podName == "" {
+		podName = os.Getenv("POD_NAME")
+	}
+	if podName == "" {
+		podName, _ = os.Hostname()
+	}
+	s.podName = podName
+	s.region = region
+}
+
+// Instance returns the identity of this replica
+func (s *CentrifugeServer) Instance() InstanceInfo {
+	return InstanceInfo{
+		InstanceID: s.node.ID(),
+		PodName:    s.podName,
+		Region:     s.region,
+		Version:    version.Version,
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// JanitorResult reports the stale broadcaster entries removed by one janitor run
+type JanitorResult struct {
+	Clients int
+	Users   int
+}
+
+// StartJanitor periodically removes broadcaster subscriptions of clients no longer connected to this node.
+// Centrifuge already drops hub channels without subscribers; the janitor guards the broadcaster's
+// routing table against entries leaked by missed unsubscribe or disconnect events.
+func (s *CentrifugeServer) StartJanitor(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.runJanitor()
+			}
+		}
+	}()
+}
+
+// runJanitor removes subscriptions of disconnected clients and reports the reclaimed counts
+func (s *CentrifugeServer) runJanitor() JanitorResult {
+	var result JanitorResult
+	if s.broadcaster == nil {
+		return result
+	}
+
+	// Read subscribers before connections: a client registers only after connecting,
+	// so any subscriber still connected is guaranteed to be in the later snapshot
+	subscribers := s.broadcaster.Subscribers()
+	connections := s.node.Hub().Connections()
+
+	staleUsers := make(map[string]struct{})
+	liveUsers := make(map[string]struct{})
+	for clientID, cfxUserID := range subscribers {
+		if _, ok := connections[clientID]; ok {
+			liveUsers[cfxUserID] = struct{}{}
+			continue
+		}
+
+		s.broadcaster.UnregisterClient(cfxUserID, clientID)
+		staleUsers[cfxUserID] = struct{}{}
+		result.Clients++
+	}
+
+	for cfxUserID := range staleUsers {
+		if _, ok := liveUsers[cfxUserID]; !ok {
+			result.Users++
+		}
+	}
+
+	if result.Clients > 0 {
+		s.logger.Info("janitor reclaimed stale subscriptions",
+			"clients", result.Clients,
+			"users", result.Users,
+			"subscribers", len(subscribers)-result.Clients)
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordJanitorReclaimed(s.config.NodeName, result.Clients, result.Users)
+	}
+
+	return result
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/policy"
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Keepalive modes of a connection profile
+const (
+	// KeepaliveServer sends protocol-level pings the client must answer with a pong
+	KeepaliveServer = "server"
+
+	// KeepaliveClient sends no pings and requires no pongs; clients keep the connection alive with the ping RPC
+	KeepaliveClient = "client"
+
+	// KeepaliveHybrid sends WebSocket control-frame pings, answered by the client's WebSocket stack,
+	// and answers the ping RPC
+	KeepaliveHybrid = "hybrid"
+)
+
+// RPCMethodPing is the RPC method answering client-driven keepalive pings
+const RPCMethodPing = "ping"
+
+// Ping interval and control-frame pong timeout of profiles without one
+const (
+	defaultPingInterval = 2 * time.Second
+	defaultPongTimeout  = 10 * time.Second
+)
+
+// framePingPongParam makes the Centrifuge WebSocket transport use control-frame pings instead of protocol pings
+const framePingPongParam = "cf_ws_frame_ping_pong"
+
+// KeepaliveInfo tells clients in the connected reply how their connection is kept alive
+type KeepaliveInfo struct {
+	Mode string `json:"mode"`
+
+	// PingIntervalMs is how often the server pings, or in client mode how often the client should
+	PingIntervalMs int64 `json:"ping_interval_ms"`
+
+	// PongTimeoutMs is how long the server waits for a control-frame pong in hybrid mode
+	PongTimeoutMs int64 `json:"pong_timeout_ms,omitempty"`
+}
+
+// PingRequest is the optional RPC payload of a client ping
+type PingRequest struct {
+	// Stats asks for the connection's load hints in the pong
+	Stats bool `json:"stats,omitempty"`
+}
+
+// Validate accepts every ping
+func (r PingRequest) Validate() *protocol.Error {
+	return nil
+}
+
+// PongResponse is the RPC reply to a client ping
+type PongResponse struct {
+	Type string `json:"type"`
+	Time int64  `json:"time"`
+
+	// Stats is included when the ping asks for it
+	Stats *PongStats `json:"stats,omitempty"`
+}
+
+// PongStats are load hints letting clients adapt their rendering rate
+type PongStats struct {
+	// Conflation lists the client's channels whose publications are conflated by a channel policy
+	Conflation []ConflationState `json:"conflation"`
+}
+
+// ConflationState is the conflation of one of the client's channels
+type ConflationState struct {
+	Channel string  `json:"channel"`
+	MaxRate float64 `json:"max_rate"`
+
+	// Held is set while a newer publication waits for the channel to publish again
+	Held bool `json:"held"`
+}
+
+// validKeepaliveMode reports whether mode is a keepalive mode; empty selects server mode
+func validKeepaliveMode(mode string) bool {
+	switch mode {
+	case "", KeepaliveServer, KeepaliveClient, KeepaliveHybrid:
+		return true
+	}
+	return false
+}
+
+// keepaliveMode returns the keepalive mode of the profile
+func (p ConnectionProfile) keepaliveMode() string {
+	if p.KeepaliveMode == "" {
+		return KeepaliveServer
+	}
+	return p.KeepaliveMode
+}
+
+// pingInterval returns the ping interval of the profile
+func (p ConnectionProfile) pingInterval() time.Duration {
+	if p.PingInterval > 0 {
+		return p.PingInterval
+	}
+	return defaultPingInterval
+}
+
+// pongTimeout returns the control-frame pong timeout of the profile
+func (p ConnectionProfile) pongTimeout() time.Duration {
+	if p.PongTimeout > 0 {
+		return p.PongTimeout
+	}
+	return defaultPongTimeout
+}
+
+// validateKeepalive checks the keepalive settings of the profile
+func (p ConnectionProfile) validateKeepalive() error {
+	if !validKeepaliveMode(p.KeepaliveMode) {
+		return fmt.Errorf("profile %q: unknown keepalive mode %q", p.Name, p.KeepaliveMode)
+	}
+	if p.PingInterval < 0 || p.PongTimeout < 0 {
+		return fmt.Errorf("profile %q: ping interval and pong timeout must not be negative", p.Name)
+	}
+	return nil
+}
+
+// pingPongConfig returns the Centrifuge ping configuration of the profile's transport. In hybrid mode
+// the transport sends control frames, so its protocol-level pings are disabled by the frame parameter.
+func (p ConnectionProfile) pingPongConfig() centrifuge.PingPongConfig {
+	switch p.keepaliveMode() {
+	case KeepaliveClient:
+		return centrifuge.PingPongConfig{PingInterval: -1, PongTimeout: -1}
+	case KeepaliveHybrid:
+		return centrifuge.PingPongConfig{PingInterval: p.pingInterval(), PongTimeout: p.pongTimeout()}
+	default:
+		return centrifuge.PingPongConfig{PingInterval: p.pingInterval()}
+	}
+}
+
+// keepaliveInfo describes the profile's keepalive to its clients
+func (p ConnectionProfile) keepaliveInfo() KeepaliveInfo {
+	info := KeepaliveInfo{
+		Mode:           p.keepaliveMode(),
+		PingIntervalMs: p.pingInterval().Milliseconds(),
+	}
+	if info.Mode == KeepaliveHybrid {
+		info.PongTimeoutMs = p.pongTimeout().Milliseconds()
+	}
+	return info
+}
+
+// withFramePingPong returns the upgrade request asking the transport for control-frame pings
+func withFramePingPong(r *http.Request) *http.Request {
+	u := *r.URL
+	query := u.Query()
+	query.Set(framePingPongParam, "true")
+	u.RawQuery = query.Encode()
+	r.URL = &u
+	return r
+}
+
+// SetThrottle sets the channel policy throttle whose held publications are reported in pongs
+func (s *CentrifugeServer) SetThrottle(throttle *policy.Throttle) {
+	s.throttle = throttle
+}
+
+// handlePing answers a client ping in every keepalive mode, with the client's load hints when asked
+func (s *CentrifugeServer) handlePing(client *centrifuge.Client, e centrifuge.RPCEvent, callback centrifuge.RPCCallback) {
+	var req PingRequest
+	if len(e.Data) > 0 {
+		var perr *protocol.Error
+		if req, perr = decodeRPC[PingRequest](e.Data, "ping"); perr != nil {
+			callback(centrifuge.RPCReply{}, perr.ToCentrifuge())
+			return
+		}
+	}
+
+	now := time.Now()
+	livenessFrom(client.Context()).recordPing(now)
+
+	resp := PongResponse{Type: "pong", Time: now.UnixMilli()}
+	if req.Stats {
+		var ajaibID string
+		if info := s.getClientInfo(client); info != nil {
+			ajaibID = info.AjaibID
+		}
+		resp.Stats = s.pongStats(client.Channels(), ajaibID)
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		callback(centrifuge.RPCReply{}, protocol.NewError(protocol.CodeInternalError, "failed to encode pong").ToCentrifuge())
+		return
+	}
+	callback(centrifuge.RPCReply{Data: data}, nil)
+}
+
+// pongStats returns the load hints of a client of a user subscribed to channels. Channels the user's
+// connection profiles exempt from policy rates are not conflated.
+func (s *CentrifugeServer) pongStats(channels []string, ajaibID string) *PongStats {
+	connected := func(profile string) bool { return s.UserConnectedAs(ajaibID, profile) }
+	stats := &PongStats{Conflation: []ConflationState{}}
+	for _, ch := range channels {
+		rate, conflate := s.policies.LimitFor(ch, connected)
+		if !conflate {
+			continue
+		}
+		stats.Conflation = append(stats.Conflation, ConflationState{
+			Channel: ch,
+			MaxRate: rate,
+			Held:    s.throttle.Held(ch),
+		})
+	}
+	sort.Slice(stats.Conflation, func(i, j int) bool {
+		return stats.Conflation[i].Channel < stats.Conflation[j].Channel
+	})
+	return stats
+}
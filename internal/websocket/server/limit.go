@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// ConnectionLimitPolicy decides what happens when a user opens more than max_connections_per_user connections
+type ConnectionLimitPolicy string
+
+const (
+	// LimitReject rejects the new connection with a connection limit error
+	LimitReject ConnectionLimitPolicy = "reject"
+
+	// LimitSupersede accepts the new connection and disconnects the user's oldest ones, so the last login wins
+	LimitSupersede ConnectionLimitPolicy = "supersede"
+)
+
+// ParseConnectionLimitPolicy parses a policy name, defaulting to reject
+func ParseConnectionLimitPolicy(name string) (ConnectionLimitPolicy, error) {
+	switch policy := ConnectionLimitPolicy(strings.ToLower(name)); policy {
+	case "", LimitReject:
+		return LimitReject, nil
+	case LimitSupersede:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown connection limit policy %q, want reject or supersede", name)
+	}
+}
+
+// SetConnectionLimitPolicy sets what happens to connections beyond the per-user limit
+func (s *CentrifugeServer) SetConnectionLimitPolicy(policy ConnectionLimitPolicy) {
+	s.connectionLimitPolicy = policy
+}
+
+// oldestSessions returns the user's oldest connections to supersede so a new one fits within the per-user
+// limit, or none when it already fits
+func (s *CentrifugeServer) oldestSessions(existing map[string]*centrifuge.Client) []*centrifuge.Client {
+	excess := len(existing) - s.maxConnectionsPerUser + 1
+	if excess <= 0 {
+		return nil
+	}
+
+	clients := make([]*centrifuge.Client, 0, len(existing))
+	for _, client := range existing {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAtMS() < clients[j].ConnectedAtMS()
+	})
+
+	return clients[:excess]
+}
+
+// supersedeSessions disconnects the sessions superseded by a new connection
+func (s *CentrifugeServer) supersedeSessions(clients []*centrifuge.Client, newClientID string) {
+	for _, client := range clients {
+		s.logger.Info("disconnecting superseded session",
+			"client_id", client.ID(),
+			"user_id", client.UserID(),
+			"superseded_by", newClientID)
+		client.Disconnect(protocol.ErrSessionSuperseded().ToDisconnect())
+	}
+}
@@ -0,0 +1,383 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Liveness defaults used when none are configured
+const (
+	defaultSlowWrite             = 100 * time.Millisecond
+	defaultLivenessCheckInterval = 10 * time.Second
+)
+
+// livenessContextKey stores the liveness of a connection in its request context, which Centrifuge keeps
+// as the client context
+type livenessContextKey struct{}
+
+// LivenessLimits set when a socket write counts as stalled and when stalls disconnect a client
+type LivenessLimits struct {
+	// SlowWrite is the duration from which a socket write counts as a stall (100ms when zero)
+	SlowWrite time.Duration
+
+	// MaxWriteStall disconnects clients whose writes stalled for longer than it within one check interval,
+	// including a write still in flight; zero never disconnects
+	MaxWriteStall time.Duration
+
+	// CheckInterval is the window stalls are summed over and how often clients are checked (10s when zero)
+	CheckInterval time.Duration
+}
+
+// LivenessSnapshot is the responsiveness of a connection
+type LivenessSnapshot struct {
+	// Score is 0 (unresponsive) to 100, the lowest of the pong latency, ping and write stall scores
+	Score int `json:"score"`
+
+	// PongLatencyMs is the latency of the last protocol ping, omitted until the client answered one
+	PongLatencyMs *int64 `json:"pong_latency_ms,omitempty"`
+
+	// Pings counts the client's ping RPCs; LastPingMs is how long ago the last arrived
+	Pings      int64  `json:"pings"`
+	LastPingMs *int64 `json:"last_ping_ms,omitempty"`
+
+	// WriteStalls counts socket writes slower than the slow write threshold, taking WriteStallMs in total
+	// and MaxWriteStallMs at most
+	WriteStalls     int64 `json:"write_stalls"`
+	WriteStallMs    int64 `json:"write_stall_ms"`
+	MaxWriteStallMs int64 `json:"max_write_stall_ms"`
+
+	// StalledMs is the stalled write time of the current check interval, including a write in flight
+	StalledMs int64 `json:"stalled_ms"`
+}
+
+// LivenessEntry is the liveness of one client in the liveness report
+type LivenessEntry struct {
+	ClientID string `json:"client_id"`
+	UserID   string `json:"user_id"`
+	Profile  string `json:"profile"`
+	LivenessSnapshot
+}
+
+// LivenessReport is the response body of the liveness endpoint
+type LivenessReport struct {
+	Instance InstanceInfo `json:"instance"`
+
+	// Disconnected counts the clients this instance disconnected for write stalls
+	Disconnected int64           `json:"disconnected"`
+	Clients      []LivenessEntry `json:"clients"`
+}
+
+// connLiveness tracks the responsiveness of one connection
+type connLiveness struct {
+	slowWrite time.Duration
+
+	// writingSince is when the socket write in flight started, in Unix nanoseconds; zero while idle
+	writingSince atomic.Int64
+
+	mu           sync.Mutex
+	pings        int64
+	lastPing     time.Time
+	stalls       int64
+	stalledTotal time.Duration
+	maxStall     time.Duration
+
+	// windowStall is the stalled write time since windowStart, the last check
+	windowStall time.Duration
+	windowStart time.Time
+}
+
+// livenessFrom returns the liveness of a client, nil when liveness tracking is off
+func livenessFrom(ctx context.Context) *connLiveness {
+	if ctx == nil {
+		return nil
+	}
+	l, _ := ctx.Value(livenessContextKey{}).(*connLiveness)
+	return l
+}
+
+// recordWrite counts a socket write from start to end. Only the part of a stall after the last check counts
+// towards the current check interval.
+func (l *connLiveness) recordWrite(start, end time.Time) {
+	d := end.Sub(start)
+	if d < l.slowWrite {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stalls++
+	l.stalledTotal += d
+	l.maxStall = max(l.maxStall, d)
+	if start.Before(l.windowStart) {
+		start = l.windowStart
+	}
+	l.windowStall += end.Sub(start)
+}
+
+// recordPing counts a ping RPC of the client; nil liveness records nothing
+func (l *connLiveness) recordPing(now time.Time) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pings++
+	l.lastPing = now
+}
+
+// stalled returns the stalled write time since the last check, including a slow write still in flight
+func (l *connLiveness) stalled(now time.Time) time.Duration {
+	l.mu.Lock()
+	stalled := l.windowStall
+	windowStart := l.windowStart
+	l.mu.Unlock()
+
+	if since := l.writingSince.Load(); since > 0 {
+		start := time.Unix(0, since)
+		if now.Sub(start) >= l.slowWrite {
+			if start.Before(windowStart) {
+				start = windowStart
+			}
+			stalled += now.Sub(start)
+		}
+	}
+	return stalled
+}
+
+// resetWindow starts a new check interval at now
+func (l *connLiveness) resetWindow(now time.Time) {
+	l.mu.Lock()
+	l.windowStall = 0
+	l.windowStart = now
+	l.mu.Unlock()
+}
+
+// stallConn times the socket writes of a connection
+type stallConn struct {
+	net.Conn
+	liveness *connLiveness
+}
+
+// Write writes to the socket, recording how long the write took
+func (c *stallConn) Write(p []byte) (int, error) {
+	start := time.Now()
+	c.liveness.writingSince.Store(start.UnixNano())
+	n, err := c.Conn.Write(p)
+	c.liveness.writingSince.Store(0)
+	c.liveness.recordWrite(start, time.Now())
+	return n, err
+}
+
+// livenessWriter wraps the connection hijacked by the WebSocket upgrade to time its writes
+type livenessWriter struct {
+	http.ResponseWriter
+	liveness *connLiveness
+}
+
+// Hijack takes over the connection for the WebSocket upgrade
+func (w *livenessWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return conn, brw, err
+	}
+	return &stallConn{Conn: conn, liveness: w.liveness}, brw, nil
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController
+func (w *livenessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// SetLiveness tracks the responsiveness of every connection: pong latency, ping RPCs and socket write
+// stalls. Clients whose writes stall longer than the limits allow are disconnected by the liveness monitor,
+// sooner than TCP keepalive would notice a dead peer.
+func (s *CentrifugeServer) SetLiveness(limits LivenessLimits) {
+	if limits.SlowWrite <= 0 {
+		limits.SlowWrite = defaultSlowWrite
+	}
+	if limits.CheckInterval <= 0 {
+		limits.CheckInterval = defaultLivenessCheckInterval
+	}
+	s.liveness = &limits
+}
+
+// trackLiveness returns the upgrade request and response writer timing the connection's writes
+func (s *CentrifugeServer) trackLiveness(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	if s.liveness == nil {
+		return w, r
+	}
+	l := &connLiveness{slowWrite: s.liveness.SlowWrite}
+	return &livenessWriter{ResponseWriter: w, liveness: l}, r.WithContext(context.WithValue(r.Context(), livenessContextKey{}, l))
+}
+
+// StartLivenessMonitor checks the write stalls of every client each check interval
+func (s *CentrifugeServer) StartLivenessMonitor(ctx context.Context) {
+	if s.liveness == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.liveness.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.checkLiveness(now)
+			}
+		}
+	}()
+}
+
+// checkLiveness disconnects the clients whose writes stalled longer than allowed since the last check,
+// and starts a new check interval. It returns the number of clients disconnected.
+func (s *CentrifugeServer) checkLiveness(now time.Time) int {
+	disconnected := 0
+	for _, client := range s.node.Hub().Connections() {
+		l := livenessFrom(client.Context())
+		if l == nil {
+			continue
+		}
+
+		stalled := l.stalled(now)
+		l.resetWindow(now)
+		if s.liveness.MaxWriteStall <= 0 || stalled <= s.liveness.MaxWriteStall {
+			continue
+		}
+
+		disconnected++
+		s.stallDisconnects.Add(1)
+		if s.metrics != nil {
+			s.metrics.RecordWriteStallDisconnect(s.config.NodeName)
+		}
+		s.logger.Warn("disconnecting client with stalled writes",
+			"client_id", client.ID(),
+			"user_id", client.UserID(),
+			"stalled_ms", stalled.Milliseconds(),
+			"max_write_stall_ms", s.liveness.MaxWriteStall.Milliseconds())
+		// Closing the transport also unblocks a write still in flight
+		go client.Disconnect(centrifuge.DisconnectWriteError)
+	}
+	return disconnected
+}
+
+// livenessSnapshot scores the responsiveness of a client of the connection profile. The pong latency is
+// scored against the profile's pong timeout, the time since the last ping RPC against its ping interval
+// in client keepalive mode, and the stalled write time against the maximum write stall.
+func (s *CentrifugeServer) livenessSnapshot(l *connLiveness, profile ConnectionProfile, latency time.Duration, hasLatency bool, connectedAt, now time.Time) LivenessSnapshot {
+	stalled := l.stalled(now)
+
+	l.mu.Lock()
+	snapshot := LivenessSnapshot{
+		Pings:           l.pings,
+		WriteStalls:     l.stalls,
+		WriteStallMs:    l.stalledTotal.Milliseconds(),
+		MaxWriteStallMs: l.maxStall.Milliseconds(),
+		StalledMs:       stalled.Milliseconds(),
+	}
+	lastPing := l.lastPing
+	l.mu.Unlock()
+
+	score := 1.0
+	if hasLatency {
+		ms := latency.Milliseconds()
+		snapshot.PongLatencyMs = &ms
+		score = min(score, 1-latency.Seconds()/profile.pongTimeout().Seconds())
+	}
+
+	if !lastPing.IsZero() {
+		ms := now.Sub(lastPing).Milliseconds()
+		snapshot.LastPingMs = &ms
+	}
+	if profile.keepaliveMode() == KeepaliveClient {
+		// Clients ping every interval; score drops over the following interval and reaches 0 after two
+		since := now.Sub(connectedAt)
+		if !lastPing.IsZero() {
+			since = now.Sub(lastPing)
+		}
+		interval := profile.pingInterval()
+		score = min(score, 1-(since-interval).Seconds()/interval.Seconds())
+	}
+
+	budget := s.liveness.MaxWriteStall
+	if budget <= 0 {
+		budget = s.liveness.CheckInterval
+	}
+	score = min(score, 1-stalled.Seconds()/budget.Seconds())
+
+	snapshot.Score = int(100 * max(0, min(score, 1)))
+	return snapshot
+}
+
+// Liveness returns the liveness of every tracked client connected to this node, least responsive first
+func (s *CentrifugeServer) Liveness() []LivenessEntry {
+	entries := []LivenessEntry{}
+	if s.liveness == nil {
+		return entries
+	}
+
+	now := time.Now()
+	for _, client := range s.node.Hub().Connections() {
+		l := livenessFrom(client.Context())
+		if l == nil {
+			continue
+		}
+
+		profile := s.clientProfile(client.Context())
+		latency, ok := client.LatestPingPongLatency()
+		entries = append(entries, LivenessEntry{
+			ClientID:         client.ID(),
+			UserID:           client.UserID(),
+			Profile:          profile.Name,
+			LivenessSnapshot: s.livenessSnapshot(l, profile, latency, ok, time.UnixMilli(client.ConnectedAtMS()), now),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Score != entries[j].Score {
+			return entries[i].Score < entries[j].Score
+		}
+		return entries[i].ClientID < entries[j].ClientID
+	})
+	return entries
+}
+
+// LivenessHandler returns the admin HTTP handler listing the liveness of connected clients, least
+// responsive first; ?limit= keeps the first entries
+func (s *CentrifugeServer) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := LivenessReport{
+			Instance:     s.Instance(),
+			Disconnected: s.stallDisconnects.Load(),
+			Clients:      s.Liveness(),
+		}
+		if v := r.URL.Query().Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+				return
+			}
+			if limit < len(report.Clients) {
+				report.Clients = report.Clients[:limit]
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			s.logger.Error("failed to encode liveness report", "error", err)
+		}
+	})
+}
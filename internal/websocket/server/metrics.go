@@ -24,6 +24,29 @@ type Metrics struct {
 	// Message metrics
 	messagesPublished *prometheus.CounterVec
 	messagesReceived  *prometheus.CounterVec
+	messagesTooLarge  *prometheus.CounterVec
+	queueOverflows    *prometheus.CounterVec
+	duplicateSends    *prometheus.CounterVec
+	regionRedirects   *prometheus.CounterVec
+	sessionReauths    *prometheus.CounterVec
+	stallDisconnects  *prometheus.CounterVec
+
+	// Hub metrics
+	hubChannels              *prometheus.GaugeVec
+	hubSubscriptions         prometheus.Gauge
+	hubSubscribersPerChannel prometheus.Gauge
+	hubMemoryEstimate        prometheus.Gauge
+
+	// Janitor metrics
+	janitorReclaimed *prometheus.CounterVec
+
+	// Upstream metrics
+	upstreamConnected      prometheus.Gauge
+	upstreamLastMessageAge prometheus.Gauge
+	upstreamStalled        prometheus.Gauge
+	upstreamReconnects     *prometheus.CounterVec
+	upstreamFetchDelay     prometheus.Gauge
+	deliveryDegraded       prometheus.Gauge
 
 	// Server metrics
 	nodeInfo *prometheus.GaugeVec
@@ -90,6 +113,123 @@ func NewMetrics(node *centrifuge.Node) *Metrics {
 			},
 			[]string{"node"},
 		),
+		messagesTooLarge: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "centrifuge_messages_too_large_total",
+				Help: "Total number of clients disconnected for sending a message over the size limit",
+			},
+			[]string{"node", "profile"},
+		),
+		queueOverflows: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "centrifuge_client_queue_overflows_total",
+				Help: "Total number of channel subscriptions dropped by clients disconnected for overflowing their queue",
+			},
+			[]string{"node", "channel_type"},
+		),
+		duplicateSends: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "centrifuge_duplicate_sends_suppressed_total",
+				Help: "Total number of server-side sends skipped because the client already received the message",
+			},
+			[]string{"node", "class"},
+		),
+		regionRedirects: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "centrifuge_region_redirects_total",
+				Help: "Total number of connections redirected to the region serving the user's CFX account",
+			},
+			[]string{"node", "target_region"},
+		),
+		sessionReauths: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "centrifuge_session_reauths_total",
+				Help: "Total number of limited sessions refreshed, rejected or expired at their maximum duration",
+			},
+			[]string{"node", "result"},
+		),
+		stallDisconnects: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "centrifuge_write_stall_disconnects_total",
+				Help: "Total number of clients disconnected for socket writes stalled beyond the liveness limit",
+			},
+			[]string{"node"},
+		),
+
+		// Janitor metrics
+		// Hub metrics
+		hubChannels: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "centrifuge_hub_channels",
+				Help: "Number of channels with subscribers on this node, by channel type",
+			},
+			[]string{"type"},
+		),
+		hubSubscriptions: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "centrifuge_hub_subscriptions",
+				Help: "Number of client subscription entries in the hub",
+			},
+		),
+		hubSubscribersPerChannel: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "centrifuge_hub_subscribers_per_channel",
+				Help: "Average number of subscribers per channel",
+			},
+		),
+		hubMemoryEstimate: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "centrifuge_hub_memory_estimate_bytes",
+				Help: "Rough estimate of the memory held by the hub's client, channel and subscription maps",
+			},
+		),
+
+		janitorReclaimed: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "centrifuge_janitor_reclaimed_total",
+				Help: "Total number of stale broadcaster entries removed by the janitor",
+			},
+			[]string{"node", "kind"},
+		),
+
+		// Upstream metrics
+		upstreamConnected: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "upstream_connected",
+				Help: "Whether the upstream data feed is connected",
+			},
+		),
+		upstreamLastMessageAge: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "upstream_last_message_age_seconds",
+				Help: "Seconds since the upstream data feed last delivered a message",
+			},
+		),
+		upstreamStalled: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "upstream_stalled",
+				Help: "Whether the upstream data feed delivered no message within the stall threshold",
+			},
+		),
+		upstreamReconnects: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "upstream_reconnects_total",
+				Help: "Total number of upstream reconnects forced because no message arrived",
+			},
+			[]string{"node"},
+		),
+		upstreamFetchDelay: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "upstream_fetch_delay_seconds",
+				Help: "Age of the last upstream message when it was fetched",
+			},
+		),
+		deliveryDegraded: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "delivery_degraded",
+				Help: "Whether channels are conflated to their overload rate because the upstream fell behind",
+			},
+		),
 
 		// Server metrics
 		nodeInfo: prometheus.NewGaugeVec(
@@ -120,6 +260,23 @@ func (m *Metrics) Register() error {
 		m.subscriptionsActive,
 		m.messagesPublished,
 		m.messagesReceived,
+		m.messagesTooLarge,
+		m.queueOverflows,
+		m.duplicateSends,
+		m.regionRedirects,
+		m.sessionReauths,
+		m.stallDisconnects,
+		m.hubChannels,
+		m.hubSubscriptions,
+		m.hubSubscribersPerChannel,
+		m.hubMemoryEstimate,
+		m.janitorReclaimed,
+		m.upstreamConnected,
+		m.upstreamLastMessageAge,
+		m.upstreamStalled,
+		m.upstreamReconnects,
+		m.upstreamFetchDelay,
+		m.deliveryDegraded,
 		m.nodeInfo,
 	)
 
@@ -142,6 +299,26 @@ func (m *Metrics) RecordFailedConnection(nodeName, reason string) {
 	m.connectionsFailed.WithLabelValues(nodeName, reason).Inc()
 }
 
+// RecordDuplicateSend records a server-side send skipped as a duplicate, by message class
+func (m *Metrics) RecordDuplicateSend(nodeName, class string) {
+	m.duplicateSends.WithLabelValues(nodeName, class).Inc()
+}
+
+// RecordRegionRedirect records a connection redirected to another region's endpoint
+func (m *Metrics) RecordRegionRedirect(nodeName, targetRegion string) {
+	m.regionRedirects.WithLabelValues(nodeName, targetRegion).Inc()
+}
+
+// RecordSessionReauth records the re-authentication result of a limited session
+func (m *Metrics) RecordSessionReauth(nodeName, result string) {
+	m.sessionReauths.WithLabelValues(nodeName, result).Inc()
+}
+
+// RecordWriteStallDisconnect records a client disconnected for stalled writes
+func (m *Metrics) RecordWriteStallDisconnect(nodeName string) {
+	m.stallDisconnects.WithLabelValues(nodeName).Inc()
+}
+
 // RecordSubscription records a new subscription
 func (m *Metrics) RecordSubscription(nodeName, channel string) {
 	m.subscriptionsTotal.WithLabelValues(nodeName, channel).Inc()
@@ -158,6 +335,48 @@ func (m *Metrics) RecordPublication(nodeName, channel string) {
 	m.messagesPublished.WithLabelValues(nodeName, channel).Inc()
 }
 
+// RecordMessageTooLarge records a client disconnected for an oversized message
+func (m *Metrics) RecordMessageTooLarge(nodeName, profile string) {
+	m.messagesTooLarge.WithLabelValues(nodeName, profile).Inc()
+}
+
+// RecordQueueOverflow records a channel of a client disconnected for overflowing its queue
+func (m *Metrics) RecordQueueOverflow(nodeName, channelType string) {
+	m.queueOverflows.WithLabelValues(nodeName, channelType).Inc()
+}
+
+// RecordJanitorReclaimed records stale clients and users removed by the janitor
+func (m *Metrics) RecordJanitorReclaimed(nodeName string, clients, users int) {
+	m.janitorReclaimed.WithLabelValues(nodeName, "clients").Add(float64(clients))
+	m.janitorReclaimed.WithLabelValues(nodeName, "users").Add(float64(users))
+}
+
+// UpdateUpstream records the state of the upstream data feed
+func (m *Metrics) UpdateUpstream(h UpstreamHealth) {
+	m.upstreamConnected.Set(boolGauge(h.Connected))
+	m.upstreamLastMessageAge.Set(float64(h.LastMessageAgeMs) / 1000)
+	m.upstreamStalled.Set(boolGauge(h.Stalled))
+}
+
+// UpdateOverload sets the upstream fetch delay and whether delivery is degraded by it
+func (m *Metrics) UpdateOverload(fetchDelay time.Duration, degraded bool) {
+	m.upstreamFetchDelay.Set(fetchDelay.Seconds())
+	m.deliveryDegraded.Set(boolGauge(degraded))
+}
+
+// RecordUpstreamReconnect records a forced upstream reconnect
+func (m *Metrics) RecordUpstreamReconnect(nodeName string) {
+	m.upstreamReconnects.WithLabelValues(nodeName).Inc()
+}
+
+// boolGauge converts a boolean to a gauge value
+func boolGauge(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
 // UpdateMetrics updates metrics from the current node state
 func (m *Metrics) UpdateMetrics(node *centrifuge.Node, nodeName string) {
 	if node == nil {
@@ -171,6 +390,18 @@ func (m *Metrics) UpdateMetrics(node *centrifuge.Node, nodeName string) {
 	m.subscriptionsActive.Set(float64(node.Hub().NumClients()))
 }
 
+// UpdateHub records the hub cardinality
+func (m *Metrics) UpdateHub(stats HubStats) {
+	m.channelsTotal.Set(float64(stats.Channels))
+	m.hubChannels.Reset()
+	for channelType, typeStats := range stats.ChannelTypes {
+		m.hubChannels.WithLabelValues(channelType).Set(float64(typeStats.Channels))
+	}
+	m.hubSubscriptions.Set(float64(stats.Subscriptions))
+	m.hubSubscribersPerChannel.Set(stats.AvgSubscribersPerChannel)
+	m.hubMemoryEstimate.Set(float64(stats.EstimatedBytes))
+}
+
 // MetricsHandler returns an HTTP handler for the metrics endpoint
 func (s *CentrifugeServer) MetricsHandler() http.Handler {
 	return promhttp.Handler()
@@ -184,6 +415,7 @@ func (s *CentrifugeServer) StartMetricsCollector(metrics *Metrics, interval time
 
 		for range ticker.C {
 			metrics.UpdateMetrics(s.node, s.config.NodeName)
+			metrics.UpdateHub(s.collectHubStats())
 		}
 	}()
 }
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// overflowLogSize is the number of recent overflow events kept for the admin API
+const overflowLogSize = 100
+
+// OverflowEvent describes a client disconnected because its outgoing queue overflowed
+type OverflowEvent struct {
+	Time            time.Time `json:"time"`
+	ClientID        string    `json:"client_id"`
+	AjaibID         string    `json:"ajaib_id,omitempty"`
+	Channels        []string  `json:"channels"`
+	ConnectedMS     int64     `json:"connected_ms"`
+	QueueLimitBytes int       `json:"queue_limit_bytes"`
+}
+
+// OverflowReport is the response body of the overflow endpoint
+type OverflowReport struct {
+	Instance      InstanceInfo     `json:"instance"`
+	Total         int64            `json:"total"`
+	ByChannelType map[string]int64 `json:"by_channel_type"`
+	Recent        []OverflowEvent  `json:"recent"`
+}
+
+// overflowLog collects the channels of clients being disconnected as slow and keeps the latest overflows.
+// Centrifuge unsubscribes every channel before calling the disconnect handler, so channels are
+// noted per client until the disconnect arrives.
+type overflowLog struct {
+	mu            sync.Mutex
+	pending       map[string][]string
+	recent        []OverflowEvent
+	next          int
+	total         int64
+	byChannelType map[string]int64
+}
+
+func newOverflowLog() *overflowLog {
+	return &overflowLog{
+		pending:       make(map[string][]string),
+		byChannelType: make(map[string]int64),
+	}
+}
+
+// note remembers a channel a slow client is being unsubscribed from
+func (l *overflowLog) note(clientID, ch string) {
+	l.mu.Lock()
+	l.pending[clientID] = append(l.pending[clientID], ch)
+	l.mu.Unlock()
+}
+
+// take returns and forgets the channels noted for a client
+func (l *overflowLog) take(clientID string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	channels := l.pending[clientID]
+	delete(l.pending, clientID)
+	return channels
+}
+
+// record adds an overflow, overwriting the oldest once overflowLogSize events are kept
+func (l *overflowLog) record(event OverflowEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total++
+	for _, ch := range event.Channels {
+		l.byChannelType[hubChannelType(ch)]++
+	}
+
+	if len(l.recent) < overflowLogSize {
+		l.recent = append(l.recent, event)
+		return
+	}
+	l.recent[l.next] = event
+	l.next = (l.next + 1) % overflowLogSize
+}
+
+// report returns the overflow totals and the recent events, newest first
+func (l *overflowLog) report() OverflowReport {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	report := OverflowReport{
+		Total:         l.total,
+		ByChannelType: make(map[string]int64, len(l.byChannelType)),
+		Recent:        make([]OverflowEvent, 0, len(l.recent)),
+	}
+	for channelType, n := range l.byChannelType {
+		report.ByChannelType[channelType] = n
+	}
+	for i := len(l.recent) - 1; i >= 0; i-- {
+		report.Recent = append(report.Recent, l.recent[(l.next+i)%len(l.recent)])
+	}
+	return report
+}
+
+// isSlowDisconnect reports whether a disconnect was caused by the client's queue overflowing
+func isSlowDisconnect(d *centrifuge.Disconnect) bool {
+	return d != nil && d.Code == centrifuge.DisconnectSlow.Code
+}
+
+// recordOverflow logs and counts a client disconnected because its queue exceeded client_queue_max_size
+func (s *CentrifugeServer) recordOverflow(client *centrifuge.Client, info *ClientInfo, channels []string) {
+	event := OverflowEvent{
+		Time:            time.Now(),
+		ClientID:        client.ID(),
+		Channels:        channels,
+		ConnectedMS:     time.Now().UnixMilli() - client.ConnectedAtMS(),
+		QueueLimitBytes: s.node.Config().ClientQueueMaxSize,
+	}
+	if info != nil {
+		event.AjaibID = info.AjaibID
+	}
+	if event.Channels == nil {
+		event.Channels = []string{}
+	}
+
+	s.overflows.record(event)
+	if s.metrics != nil {
+		for _, ch := range channels {
+			s.metrics.RecordQueueOverflow(s.config.NodeName, hubChannelType(ch))
+		}
+	}
+
+	s.logger.Warn("client queue overflowed",
+		"client_id", event.ClientID,
+		"ajaib_id", event.AjaibID,
+		"channels", event.Channels,
+		"connected_ms", event.ConnectedMS,
+		"queue_limit_bytes", event.QueueLimitBytes)
+}
+
+// OverflowsHandler returns the admin HTTP handler listing the clients disconnected for a queue overflow
+func (s *CentrifugeServer) OverflowsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := s.overflows.report()
+		report.Instance = s.Instance()
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			s.logger.Error("failed to encode overflow report", "error", err)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Delivery statuses published to the status channel
+const (
+	StatusNormal   = "normal"
+	StatusDegraded = "degraded"
+)
+
+// statusReasonUpstreamDelay explains a degradation caused by the upstream falling behind
+const statusReasonUpstreamDelay = "upstream_delay"
+
+// statusHistoryTTL keeps the latest status in history so new subscribers receive it with the acknowledgment
+const statusHistoryTTL = 24 * time.Hour
+
+// OverloadSource reports how far the data feed is behind (implemented by the Kafka consumer)
+type OverloadSource interface {
+	FetchDelay() time.Duration
+}
+
+// OverloadLimits set when delivery degrades to the overload rates of the channel policies and recovers
+type OverloadLimits struct {
+	// DelayBudget degrades delivery once fetched messages are older than it; zero disables degrading
+	DelayBudget time.Duration
+
+	// RecoverBelow restores delivery once fetched messages are younger than it (half the budget when zero)
+	RecoverBelow time.Duration
+}
+
+// StatusMessage is the publication of the status channel
+type StatusMessage struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+
+	// Reason explains a degraded status, e.g. upstream_delay
+	Reason  string `json:"reason,omitempty"`
+	DelayMs int64  `json:"delay_ms"`
+
+	// Node is the node whose upstream fell behind or recovered
+	Node string `json:"node"`
+	Time int64  `json:"time"`
+}
+
+// SetOverload degrades delivery when the source falls behind the limits: channels with an overload rate
+// are conflated to it and the status channel announces the degradation until the backlog clears
+func (s *CentrifugeServer) SetOverload(source OverloadSource, limits OverloadLimits) {
+	if limits.RecoverBelow <= 0 || limits.RecoverBelow > limits.DelayBudget {
+		limits.RecoverBelow = limits.DelayBudget / 2
+	}
+	s.overload = source
+	s.overloadLimits = limits
+}
+
+// StartOverloadMonitor periodically checks the overload source, degrading and restoring delivery
+func (s *CentrifugeServer) StartOverloadMonitor(ctx context.Context, interval time.Duration) {
+	if s.overload == nil || s.overloadLimits.DelayBudget <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.checkOverload(now)
+			}
+		}
+	}()
+}
+
+// checkOverload degrades delivery when the source's delay exceeds the budget and restores it once the
+// delay falls below the recovery threshold, returning whether delivery is degraded
+func (s *CentrifugeServer) checkOverload(now time.Time) bool {
+	delay := s.overload.FetchDelay()
+	degraded := s.policies.Degraded()
+
+	switch {
+	case !degraded && delay > s.overloadLimits.DelayBudget:
+		degraded = true
+		s.policies.SetDegraded(true)
+		s.logger.Warn("delivery degraded, upstream behind its delay budget",
+			"delay", delay.String(),
+			"delay_budget", s.overloadLimits.DelayBudget.String())
+		s.publishStatus(StatusMessage{Status: StatusDegraded, Reason: statusReasonUpstreamDelay, DelayMs: delay.Milliseconds()}, now)
+	case degraded && delay < s.overloadLimits.RecoverBelow:
+		degraded = false
+		s.policies.SetDegraded(false)
+		s.logger.Info("delivery recovered", "delay", delay.String())
+		s.publishStatus(StatusMessage{Status: StatusNormal, DelayMs: delay.Milliseconds()}, now)
+	}
+
+	if s.metrics != nil {
+		s.metrics.UpdateOverload(delay, degraded)
+	}
+	return degraded
+}
+
+// publishStatus pushes a delivery status to the public status channel
+func (s *CentrifugeServer) publishStatus(msg StatusMessage, now time.Time) {
+	msg.Type = "status"
+	msg.Node = s.config.NodeName
+	msg.Time = now.UnixMilli()
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Error("failed to encode status message", "error", err)
+		return
+	}
+
+	if _, err := s.node.Publish(channel.StatusFutures, data, centrifuge.WithHistory(1, statusHistoryTTL)); err != nil {
+		s.logger.Error("failed to publish status", "channel", channel.StatusFutures, "status", msg.Status, "error", err)
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordPublication(s.config.NodeName, channel.ChannelType(channel.StatusFutures))
+	}
+}
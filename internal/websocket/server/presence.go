@@ -0,0 +1,170 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/channel"
+)
+
+// Presence message types published on the presence channel
+const (
+	PresenceJoin  = "join"
+	PresenceLeave = "leave"
+)
+
+// PresenceListener is notified when a user opens their first connection to this instance and when their
+// last one closes. It is called with the presence table locked, so it must not block.
+type PresenceListener interface {
+	UserOnline(ajaibID string)
+	UserOffline(ajaibID string)
+}
+
+// PresenceMessage is the publication of the presence channel
+type PresenceMessage struct {
+	Type      string `json:"type"`
+	AjaibID   string `json:"ajaib_id"`
+	Node      string `json:"node"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// OnlineUser is a user with at least one connection to this instance
+type OnlineUser struct {
+	AjaibID     string `json:"ajaib_id"`
+	Connections int    `json:"connections"`
+}
+
+// PresenceDump is the response body of the presence endpoint
+type PresenceDump struct {
+	Instance InstanceInfo `json:"instance"`
+	Users    int          `json:"users"`
+	Online   []OnlineUser `json:"online"`
+}
+
+// presence counts the connections of each authenticated user on this instance
+type presence struct {
+	mu          sync.Mutex
+	connections map[string]int
+	listener    PresenceListener
+}
+
+// SetPresenceListener sets the listener notified of users' first connection and last disconnect.
+// It must be set before the server starts.
+func (s *CentrifugeServer) SetPresenceListener(listener PresenceListener) {
+	s.presence.listener = listener
+}
+
+// OnlineUsers returns the users connected to this instance, sorted by ajaib_id
+func (s *CentrifugeServer) OnlineUsers() []OnlineUser {
+	s.presence.mu.Lock()
+	users := make([]OnlineUser, 0, len(s.presence.connections))
+	for ajaibID, count := range s.presence.connections {
+		users = append(users, OnlineUser{AjaibID: ajaibID, Connections: count})
+	}
+	s.presence.mu.Unlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].AjaibID < users[j].AjaibID
+	})
+	return users
+}
+
+// PresenceHandler returns an HTTP handler listing the users connected to this instance.
+// The ajaib_id query parameter narrows the list to a single user.
+func (s *CentrifugeServer) PresenceHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		online := s.OnlineUsers()
+		dump := PresenceDump{
+			Instance: s.Instance(),
+			Users:    len(online),
+			Online:   online,
+		}
+
+		if ajaibID := r.URL.Query().Get("ajaib_id"); ajaibID != "" {
+			dump.Online = []OnlineUser{}
+			for _, user := range online {
+				if user.AjaibID == ajaibID {
+					dump.Online = append(dump.Online, user)
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(dump); err != nil {
+			s.logger.Error("failed to encode presence dump", "error", err)
+		}
+	})
+}
+
+// trackPresence counts user connections and reports the transitions to and from zero to the
+// presence listener and the presence channel
+func (s *CentrifugeServer) trackPresence(event HubEvent) {
+	// Impersonation sessions are a support agent's, not the user's
+	if event.Info == nil || event.Info.AjaibID == "" || event.Info.ImpersonatedBy != "" {
+		return
+	}
+	ajaibID := event.Info.AjaibID
+
+	p := &s.presence
+	p.mu.Lock()
+	var transition string
+	switch event.Type {
+	case HubClientRegistered:
+		p.connections[ajaibID]++
+		if p.connections[ajaibID] == 1 {
+			transition = PresenceJoin
+			if p.listener != nil {
+				p.listener.UserOnline(ajaibID)
+			}
+		}
+	case HubClientUnregistered:
+		count, ok := p.connections[ajaibID]
+		switch {
+		case !ok:
+			// Never registered, e.g. rejected before the connect completed
+		case count > 1:
+			p.connections[ajaibID] = count - 1
+		default:
+			delete(p.connections, ajaibID)
+			transition = PresenceLeave
+			if p.listener != nil {
+				p.listener.UserOffline(ajaibID)
+			}
+		}
+	}
+	p.mu.Unlock()
+
+	if transition != "" {
+		s.publishPresence(transition, ajaibID, event.Time)
+	}
+}
+
+// publishPresence pushes a join or leave message to the internal presence channel
+func (s *CentrifugeServer) publishPresence(messageType, ajaibID string, at time.Time) {
+	data, err := json.Marshal(PresenceMessage{
+		Type:      messageType,
+		AjaibID:   ajaibID,
+		Node:      s.config.NodeName,
+		Timestamp: at.UnixMilli(),
+	})
+	if err != nil {
+		s.logger.Error("failed to encode presence message", "error", err)
+		return
+	}
+
+	if _, err := s.node.Publish(channel.PresenceFutures, data); err != nil {
+		s.logger.Warn("failed to publish presence",
+			"channel", channel.PresenceFutures,
+			"type", messageType,
+			"ajaib_id", ajaibID,
+			"error", err)
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordPublication(s.config.NodeName, channel.ChannelType(channel.PresenceFutures))
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"coin-futures-websocket/internal/auth"
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// defaultMessageSizeLimit is the client message size limit of profiles without one (the Centrifuge default)
+const defaultMessageSizeLimit = 65536
+
+// profileContextKey stores the connection profile selected for an upgrade in the request context
+type profileContextKey struct{}
+
+// ConnectionProfile sizes the WebSocket transport of one class of connections.
+// Zero sizes keep the Centrifuge defaults.
+type ConnectionProfile struct {
+	Name string
+
+	// Scope selects the profile for upgrade requests whose token carries it; the default profile has none
+	Scope string
+
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// MessageSizeLimit is the largest client message accepted. Larger messages are answered with a 4006
+	// disconnect; frames over twice the limit are cut off by the transport without one.
+	MessageSizeLimit int
+
+	WriteTimeout time.Duration
+
+	// KeepaliveMode is server, client or hybrid (see KeepaliveServer); empty selects server.
+	// PingInterval is how often pings are sent (2s when zero), PongTimeout how long hybrid
+	// connections wait for a control-frame pong (10s when zero).
+	KeepaliveMode string
+	PingInterval  time.Duration
+	PongTimeout   time.Duration
+
+	// QueueInitialCap presizes the send queue of each connection (2 messages when zero), so bursts don't
+	// grow it message by message
+	QueueInitialCap int
+
+	// WriteDelay collects messages for this long before writing them, up to MaxMessagesInFrame per write
+	// (16 when zero). It throttles delivery to at most MaxMessagesInFrame messages per WriteDelay.
+	WriteDelay         time.Duration
+	MaxMessagesInFrame int
+
+	// LowLatency writes command replies directly to the connection instead of through the send queue
+	LowLatency bool
+}
+
+// lanes counts the connections of each user by connection profile, so the broadcaster can tell the lane a
+// user is connected in without scanning the hub
+type lanes struct {
+	connections map[string]map[string]int
+	mu          sync.RWMutex
+}
+
+// Validate checks that the profile sizes are usable
+func (p ConnectionProfile) Validate() error {
+	if p.ReadBufferSize < 0 || p.WriteBufferSize < 0 {
+		return fmt.Errorf("profile %q: buffer sizes must not be negative", p.Name)
+	}
+	if p.MessageSizeLimit < 0 {
+		return fmt.Errorf("profile %q: message size limit must not be negative", p.Name)
+	}
+	if p.WriteTimeout < 0 {
+		return fmt.Errorf("profile %q: write timeout must not be negative", p.Name)
+	}
+	if p.QueueInitialCap < 0 || p.MaxMessagesInFrame < 0 || p.WriteDelay < 0 {
+		return fmt.Errorf("profile %q: send queue settings must not be negative", p.Name)
+	}
+	if p.LowLatency && p.WriteDelay > 0 {
+		return fmt.Errorf("profile %q: low latency profiles cannot delay writes", p.Name)
+	}
+	return p.validateKeepalive()
+}
+
+// applySendQueue sets the send queue settings of the profile on the reply of a connecting client
+func (p ConnectionProfile) applySendQueue(reply *centrifuge.ConnectReply) {
+	reply.QueueInitialCap = p.QueueInitialCap
+	reply.WriteDelay = p.WriteDelay
+	reply.MaxMessagesInFrame = p.MaxMessagesInFrame
+	reply.ReplyWithoutQueue = p.LowLatency
+}
+
+// messageSizeLimit returns the client message size limit of the profile
+func (p ConnectionProfile) messageSizeLimit() int {
+	if p.MessageSizeLimit > 0 {
+		return p.MessageSizeLimit
+	}
+	return defaultMessageSizeLimit
+}
+
+// profileHandler is the WebSocket handler serving one connection profile
+type profileHandler struct {
+	profile ConnectionProfile
+	handler *centrifuge.WebsocketHandler
+}
+
+// SetConnectionProfiles serves upgrades with the first profile whose scope the request token carries,
+// falling back to the default profile. Only the token of the upgrade request (header, query,
+// subprotocol or cookie) selects a profile; a token sent in the connect command cannot.
+func (s *CentrifugeServer) SetConnectionProfiles(def ConnectionProfile, profiles []ConnectionProfile) error {
+	if err := def.Validate(); err != nil {
+		return err
+	}
+
+	scopes := make(map[string]string, len(profiles))
+	handlers := make([]profileHandler, 0, len(profiles))
+	for _, p := range profiles {
+		if p.Name == "" || p.Scope == "" {
+			return fmt.Errorf("connection profiles require a name and a scope")
+		}
+		if other, ok := scopes[p.Scope]; ok {
+			return fmt.Errorf("profiles %q and %q both select scope %q", other, p.Name, p.Scope)
+		}
+		if err := p.Validate(); err != nil {
+			return err
+		}
+
+		scopes[p.Scope] = p.Name
+		handlers = append(handlers, profileHandler{
+			profile: p,
+			handler: centrifuge.NewWebsocketHandler(s.node, websocketConfig(p)),
+		})
+	}
+
+	if def.Name == "" {
+		def.Name = "default"
+	}
+	s.defaultProfile = profileHandler{
+		profile: def,
+		handler: centrifuge.NewWebsocketHandler(s.node, websocketConfig(def)),
+	}
+	s.profiles = handlers
+	return nil
+}
+
+// profileFor returns the handler of the connection profile selected by the upgrade request
+func (s *CentrifugeServer) profileFor(r *http.Request) profileHandler {
+	if len(s.profiles) == 0 {
+		return s.defaultProfile
+	}
+
+	token, ok := auth.TokenFrom(r.Context())
+	if !ok {
+		return s.defaultProfile
+	}
+	claims, err := auth.NewParser().Parse(token)
+	if err != nil {
+		// Connect rejects the malformed token; the default profile is enough to send the error
+		return s.defaultProfile
+	}
+	return s.profileForClaims(claims)
+}
+
+// profileForClaims returns the handler of the first connection profile whose scope the token carries
+func (s *CentrifugeServer) profileForClaims(claims *auth.Claims) profileHandler {
+	for _, p := range s.profiles {
+		if claims.HasScope(p.profile.Scope) {
+			return p
+		}
+	}
+	return s.defaultProfile
+}
+
+// websocketConfig builds the Centrifuge WebSocket transport configuration of a profile
+func websocketConfig(p ConnectionProfile) centrifuge.WebsocketConfig {
+	return centrifuge.WebsocketConfig{
+		CheckOrigin: func(r *http.Request) bool {
+			return true // Allow all origins for now
+		},
+		PingPongConfig:  p.pingPongConfig(),
+		ReadBufferSize:  p.ReadBufferSize,
+		WriteBufferSize: p.WriteBufferSize,
+		// Leave headroom above the limit so oversized messages are read and rejected with an explanation
+		MessageSizeLimit: 2 * p.messageSizeLimit(),
+		WriteTimeout:     p.WriteTimeout,
+	}
+}
+
+// withProfile stores the connection profile serving an upgrade in its request context,
+// which Centrifuge keeps as the client context
+func withProfile(ctx context.Context, p ConnectionProfile) context.Context {
+	return context.WithValue(ctx, profileContextKey{}, p)
+}
+
+// clientProfile returns the connection profile of a client, or the default profile when unknown
+func (s *CentrifugeServer) clientProfile(ctx context.Context) ConnectionProfile {
+	if ctx == nil {
+		return s.defaultProfile.profile
+	}
+	if p, ok := ctx.Value(profileContextKey{}).(ConnectionProfile); ok {
+		return p
+	}
+	return s.defaultProfile.profile
+}
+
+// checkMessageSize disconnects clients sending a message over their profile's size limit with a 4006
+// explaining the limit, instead of letting the transport close the connection without a reason
+func (s *CentrifugeServer) checkMessageSize(client *centrifuge.Client, e centrifuge.CommandReadEvent) error {
+	profile := s.clientProfile(client.Context())
+	limit := profile.messageSizeLimit()
+	if e.CommandSize <= limit {
+		return nil
+	}
+
+	s.logger.Warn("client message too large",
+		"client_id", client.ID(),
+		"ajaib_id", client.UserID(),
+		"profile", profile.Name,
+		"size", e.CommandSize,
+		"limit", limit)
+	if s.metrics != nil {
+		s.metrics.RecordMessageTooLarge(s.config.NodeName, profile.Name)
+	}
+	return protocol.ErrMessageTooLarge(e.CommandSize, limit).ToDisconnect()
+}
+
+// trackLane counts a client under its user's connection profile. Impersonation sessions are a support
+// agent's, so they never move the user into a lane.
+func (s *CentrifugeServer) trackLane(event HubEvent) {
+	if event.Info == nil || event.Info.AjaibID == "" || event.Info.ImpersonatedBy != "" {
+		return
+	}
+	ajaibID := event.Info.AjaibID
+	profile := s.clientProfile(event.Client.Context()).Name
+
+	l := &s.lanes
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	counts := l.connections[ajaibID]
+	switch event.Type {
+	case HubClientRegistered:
+		if counts == nil {
+			counts = make(map[string]int)
+			l.connections[ajaibID] = counts
+		}
+		counts[profile]++
+	case HubClientUnregistered:
+		if counts[profile] > 1 {
+			counts[profile]--
+			return
+		}
+		delete(counts, profile)
+		if len(counts) == 0 {
+			delete(l.connections, ajaibID)
+		}
+	}
+}
+
+// UserConnectedAs reports whether a user has a connection of the connection profile on this instance
+func (s *CentrifugeServer) UserConnectedAs(ajaibID, profile string) bool {
+	s.lanes.mu.RLock()
+	defer s.lanes.mu.RUnlock()
+	return s.lanes.connections[ajaibID][profile] > 0
+}
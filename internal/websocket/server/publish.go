@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"coin-futures-websocket/internal/receipt"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// PublishPath is the route pattern of the internal service-to-service publish endpoint
+const PublishPath = "POST /internal/publish"
+
+// maxPublishBodyBytes bounds the request body of the publish endpoint
+const maxPublishBodyBytes = 64 << 10
+
+// PublishRequest is the request body of the publish endpoint
+type PublishRequest struct {
+	Channel string          `json:"channel"`
+	Payload json.RawMessage `json:"payload"`
+
+	// Critical tags the publication with an ack_id and redelivers it on reconnect until the user acknowledges it
+	Critical bool `json:"critical,omitempty"`
+}
+
+// PublishResponse is the response body of a successful publish
+type PublishResponse struct {
+	Channel string `json:"channel"`
+	Offset  uint64 `json:"offset"`
+	Epoch   string `json:"epoch"`
+
+	// AckID is set for critical publications
+	AckID string `json:"ack_id,omitempty"`
+}
+
+// PublishHandler returns an HTTP handler letting backend services push one-off messages to a user
+// channel without producing to Kafka. It is served on the admin listener, behind the admin token.
+// Publications bypass the broadcaster and channel history, so snapshots keep the latest Kafka state.
+func (s *CentrifugeServer) PublishHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PublishRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPublishBodyBytes)).Decode(&req); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, protocol.ErrBadRequest("invalid publish payload"))
+			return
+		}
+
+		info, err := channel.ParseChannel(req.Channel)
+		if err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, protocol.ErrChannelNotFound(req.Channel, err.Error()))
+			return
+		}
+		if info.AjaibID == "" {
+			s.writeJSONError(w, http.StatusBadRequest, protocol.ErrChannelNotFound(req.Channel, "only user channels can be published to"))
+			return
+		}
+
+		if len(req.Payload) == 0 || string(req.Payload) == "null" {
+			s.writeJSONError(w, http.StatusBadRequest, protocol.ErrBadRequest("payload is required"))
+			return
+		}
+
+		if req.Critical && s.receipts == nil {
+			s.writeJSONError(w, http.StatusBadRequest, protocol.ErrBadRequest("delivery receipts are disabled"))
+			return
+		}
+
+		// Critical publications are tracked before they are published, so an ack never precedes its tracking
+		var opts []centrifuge.PublishOption
+		var critical receipt.Critical
+		if req.Critical {
+			critical, err = s.receipts.Track(receipt.Critical{AjaibID: info.AjaibID, Channel: req.Channel, Payload: req.Payload})
+			if err != nil {
+				s.logger.Error("failed to track critical publication", "channel", req.Channel, "error", err)
+				s.writeJSONError(w, http.StatusServiceUnavailable, protocol.NewError(protocol.CodeServiceUnavailable, protocol.MessageServiceUnavailable))
+				return
+			}
+			opts = append(opts, centrifuge.WithTags(map[string]string{receipt.TagAckID: critical.AckID}))
+		}
+
+		result, err := s.node.Publish(req.Channel, req.Payload, opts...)
+		if err != nil {
+			s.logger.Error("internal publish failed", "channel", req.Channel, "error", err)
+			if req.Critical {
+				// The caller retries a failed publish, which is tracked again
+				_ = s.receipts.Ack(info.AjaibID, []string{critical.AckID})
+			}
+			s.writeJSONError(w, http.StatusServiceUnavailable, protocol.NewError(protocol.CodeServiceUnavailable, protocol.MessageServiceUnavailable))
+			return
+		}
+
+		s.logger.Info("internal publish",
+			"channel", req.Channel,
+			"bytes", len(req.Payload),
+			"critical", req.Critical,
+			"remote_addr", r.RemoteAddr)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(PublishResponse{
+			Channel: req.Channel,
+			Offset:  result.Offset,
+			Epoch:   result.Epoch,
+			AckID:   critical.AckID,
+		}); err != nil {
+			s.logger.Error("failed to encode publish response", "channel", req.Channel, "error", err)
+		}
+	})
+}
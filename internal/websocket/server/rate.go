@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"coin-futures-websocket/internal/websocket/channel"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+const (
+	// rateHistoryTTL keeps the latest rate in history so new subscribers receive it with the acknowledgment
+	rateHistoryTTL = 24 * time.Hour
+
+	// rateIdempotencyTTL deduplicates the same rate published by several nodes refreshing independently
+	rateIdempotencyTTL = 30 * time.Second
+)
+
+// RateMessage is the publication of the rate channel
+type RateMessage struct {
+	Type      string  `json:"type"`
+	Base      string  `json:"base"`
+	Quote     string  `json:"quote"`
+	Rate      float64 `json:"rate"`
+	UpdatedAt int64   `json:"updated_at"`
+}
+
+// PublishRate pushes the refreshed USDT/IDR rate to the public rate channel when it changed
+func (s *CentrifugeServer) PublishRate(rate float64, updatedAt time.Time) {
+	s.rateMu.Lock()
+	if rate == s.publishedRate {
+		s.rateMu.Unlock()
+		return
+	}
+	s.publishedRate = rate
+	s.rateMu.Unlock()
+
+	data, err := json.Marshal(RateMessage{
+		Type:      "rate",
+		Base:      "USDT",
+		Quote:     "IDR",
+		Rate:      rate,
+		UpdatedAt: updatedAt.UnixMilli(),
+	})
+	if err != nil {
+		s.logger.Error("failed to encode rate message", "error", err)
+		return
+	}
+
+	_, err = s.node.Publish(channel.RateUSDTIDR, data,
+		centrifuge.WithHistory(1, rateHistoryTTL),
+		centrifuge.WithIdempotencyKey(channel.RateUSDTIDR+":"+strconv.FormatFloat(rate, 'f', -1, 64)),
+		centrifuge.WithIdempotentResultTTL(rateIdempotencyTTL),
+	)
+	if err != nil {
+		s.logger.Error("failed to publish rate", "channel", channel.RateUSDTIDR, "rate", rate, "error", err)
+
+		// Retry on the next refresh
+		s.rateMu.Lock()
+		s.publishedRate = 0
+		s.rateMu.Unlock()
+		return
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordPublication(s.config.NodeName, channel.ChannelType(channel.RateUSDTIDR))
+	}
+	s.logger.Debug("published rate", "channel", channel.RateUSDTIDR, "rate", rate)
+}
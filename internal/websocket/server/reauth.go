@@ -0,0 +1,231 @@
+package server
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"coin-futures-websocket/internal/auth"
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// Results of session re-authentication, as counted by centrifuge_session_reauths_total
+const (
+	ReauthRefreshed = "refreshed"
+	ReauthRejected  = "rejected"
+	ReauthExpired   = "expired"
+)
+
+// reauthCloseSlack delays Centrifuge's own expiry disconnect past the grace window, so sessions that
+// don't re-authenticate are closed with CodeReauthRequired rather than Centrifuge's expired code
+const reauthCloseSlack = 5 * time.Second
+
+// ReauthMessage is the async message pushed to a client whose session reached its maximum duration
+type ReauthMessage struct {
+	Type string `json:"type"`
+
+	// ExpiredAt is when the session reached its maximum duration, in Unix milliseconds
+	ExpiredAt int64 `json:"expired_at"`
+
+	// DisconnectAt is when the session is closed unless the client sends a refresh command with a new token
+	DisconnectAt int64 `json:"disconnect_at"`
+}
+
+// sessionClient is the part of a centrifuge.Client that session re-authentication uses
+type sessionClient interface {
+	ID() string
+	UserID() string
+	Send(data []byte) error
+	Disconnect(disconnect ...centrifuge.Disconnect)
+}
+
+// reauthSession tracks when a client's session must re-authenticate
+type reauthSession struct {
+	client   sessionClient
+	timer    *time.Timer
+	expireAt time.Time
+	notified bool
+	mu       sync.Mutex
+}
+
+// maxSession returns the maximum duration of a session between re-authentications, zero when unlimited
+func (s *CentrifugeServer) maxSession() time.Duration {
+	return time.Duration(s.config.MaxSessionSeconds) * time.Second
+}
+
+// reauthGrace returns how long a session past its maximum duration may still re-authenticate
+func (s *CentrifugeServer) reauthGrace() time.Duration {
+	return time.Duration(s.config.ReauthGraceSeconds) * time.Second
+}
+
+// sessionExpiry returns when a session authenticated at now must re-authenticate, truncated to the second
+// like Centrifuge's expiry
+func (s *CentrifugeServer) sessionExpiry(now time.Time) time.Time {
+	return now.Add(s.maxSession()).Truncate(time.Second)
+}
+
+// tokenHash fingerprints a connection token, so a refresh cannot reuse the token the session holds
+func tokenHash(token string) string {
+	h := fnv.New64a()
+	h.Write([]byte(token))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// startSession schedules the re-authentication of a connected client with a limited session
+func (s *CentrifugeServer) startSession(event HubEvent) {
+	if event.Info == nil || event.Info.SessionExpiresAt == 0 {
+		return
+	}
+
+	sess := &reauthSession{
+		client:   event.Client,
+		expireAt: time.UnixMilli(event.Info.SessionExpiresAt),
+	}
+	sess.mu.Lock()
+	sess.timer = time.AfterFunc(time.Until(sess.expireAt), func() { s.checkSession(sess) })
+	sess.mu.Unlock()
+	s.sessions.Store(event.Client.ID(), sess)
+}
+
+// endSession stops the re-authentication schedule of a disconnected client
+func (s *CentrifugeServer) endSession(event HubEvent) {
+	if v, ok := s.sessions.LoadAndDelete(event.Client.ID()); ok {
+		sess := v.(*reauthSession)
+		sess.mu.Lock()
+		sess.timer.Stop()
+		sess.mu.Unlock()
+	}
+}
+
+// checkSession asks a client whose session reached its maximum duration to re-authenticate, and
+// disconnects it once the grace window passed without a refresh
+func (s *CentrifugeServer) checkSession(sess *reauthSession) {
+	now := time.Now()
+
+	sess.mu.Lock()
+	expireAt := sess.expireAt
+	disconnectAt := expireAt.Add(s.reauthGrace())
+	switch {
+	case now.Before(expireAt):
+		// Refreshed since the timer was set
+		sess.timer.Reset(expireAt.Sub(now))
+		sess.mu.Unlock()
+		return
+	case now.Before(disconnectAt):
+		notify := !sess.notified
+		sess.notified = true
+		sess.timer.Reset(disconnectAt.Sub(now))
+		sess.mu.Unlock()
+		if notify {
+			s.sendReauthRequired(sess.client, expireAt, disconnectAt)
+		}
+		return
+	}
+	sess.mu.Unlock()
+
+	if s.metrics != nil {
+		s.metrics.RecordSessionReauth(s.config.NodeName, ReauthExpired)
+	}
+	s.logger.Info("session expired without re-authentication",
+		"client_id", sess.client.ID(),
+		"user_id", sess.client.UserID())
+	sess.client.Disconnect(protocol.ErrReauthRequired().ToDisconnect())
+}
+
+// sendReauthRequired pushes the reauth_required notice to a client
+func (s *CentrifugeServer) sendReauthRequired(client sessionClient, expiredAt, disconnectAt time.Time) {
+	data, err := json.Marshal(ReauthMessage{
+		Type:         "reauth_required",
+		ExpiredAt:    expiredAt.UnixMilli(),
+		DisconnectAt: disconnectAt.UnixMilli(),
+	})
+	if err != nil {
+		s.logger.Error("failed to encode reauth notice", "error", err)
+		return
+	}
+
+	if err := client.Send(data); err != nil {
+		s.logger.Warn("failed to send reauth notice", "client_id", client.ID(), "error", err)
+	}
+}
+
+// reauthenticate validates the new token of a session's refresh command: it must be a different token for
+// the same session user. It returns the session info carrying the new session expiry.
+func (s *CentrifugeServer) reauthenticate(info *ClientInfo, token string, now time.Time) (*ClientInfo, *protocol.Error) {
+	if info == nil {
+		return nil, protocol.ErrUnauthorized("unknown session")
+	}
+
+	claims, err := auth.NewParser().Parse(token)
+	if err != nil {
+		return nil, protocol.ErrUnauthorized("malformed token")
+	}
+	ajaibID, agent, perr := sessionUser(claims)
+	if perr != nil {
+		return nil, perr
+	}
+	if ajaibID != info.AjaibID || agent != info.ImpersonatedBy {
+		return nil, protocol.ErrUnauthorized("token belongs to another user")
+	}
+
+	hash := tokenHash(token)
+	if hash == info.TokenHash {
+		return nil, protocol.ErrUnauthorized("refresh requires a new token")
+	}
+
+	refreshed := *info
+	refreshed.TokenHash = hash
+	refreshed.SessionExpiresAt = s.sessionExpiry(now).UnixMilli()
+	return &refreshed, nil
+}
+
+// handleRefresh handles client token refresh requests. Sessions without a maximum duration never expire;
+// limited sessions start a new maximum duration with every new token.
+func (s *CentrifugeServer) handleRefresh(client *centrifuge.Client, e centrifuge.RefreshEvent, callback centrifuge.RefreshCallback) {
+	if s.maxSession() <= 0 || !e.ClientSideRefresh {
+		callback(centrifuge.RefreshReply{}, nil)
+		return
+	}
+
+	now := time.Now()
+	info, perr := s.reauthenticate(s.getClientInfo(client), e.Token, now)
+	if perr != nil {
+		if s.metrics != nil {
+			s.metrics.RecordSessionReauth(s.config.NodeName, ReauthRejected)
+		}
+		s.logger.Warn("session re-authentication rejected",
+			"client_id", client.ID(),
+			"user_id", client.UserID(),
+			"error", perr.Error())
+		callback(centrifuge.RefreshReply{}, perr.ToCentrifuge())
+		return
+	}
+
+	expireAt := time.UnixMilli(info.SessionExpiresAt)
+	if v, ok := s.sessions.Load(client.ID()); ok {
+		sess := v.(*reauthSession)
+		sess.mu.Lock()
+		sess.expireAt = expireAt
+		sess.notified = false
+		sess.timer.Reset(expireAt.Sub(now))
+		sess.mu.Unlock()
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordSessionReauth(s.config.NodeName, ReauthRefreshed)
+	}
+	s.logger.Info("session re-authenticated",
+		"client_id", client.ID(),
+		"user_id", client.UserID(),
+		"session_expires_at", info.SessionExpiresAt)
+
+	infoData, _ := json.Marshal(info)
+	callback(centrifuge.RefreshReply{
+		ExpireAt: expireAt.Unix(),
+		Info:     infoData,
+	}, nil)
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"coin-futures-websocket/internal/receipt"
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// RPCMethodAck is the RPC method acknowledging critical publications
+const RPCMethodAck = "ack"
+
+// maxAckIDs bounds the ack IDs of a single ack
+const maxAckIDs = 100
+
+// Receipts tracks critical publications until the owners of their channels acknowledge them
+// (implemented by receipt.Tracker)
+type Receipts interface {
+	Track(c receipt.Critical) (receipt.Critical, error)
+	Ack(ajaibID string, ackIDs []string) error
+	Unacked(ajaibID string, now time.Time) []receipt.Critical
+	HandleNotification(op string, data []byte)
+}
+
+// AckRequest is the RPC payload acknowledging critical publications by the ack_id tag they carried
+type AckRequest struct {
+	AckIDs []string `json:"ack_ids"`
+}
+
+// Validate checks the ack ID count and that no ack ID is empty
+func (r AckRequest) Validate() *protocol.Error {
+	if len(r.AckIDs) == 0 || len(r.AckIDs) > maxAckIDs {
+		return protocol.ErrBadRequest(fmt.Sprintf("ack_ids must contain 1 to %d entries", maxAckIDs))
+	}
+	for i, id := range r.AckIDs {
+		if id == "" {
+			return protocol.ErrBadRequest(fmt.Sprintf("ack_ids[%d] is empty", i))
+		}
+	}
+	return nil
+}
+
+// AckResponse is the RPC reply to an ack
+type AckResponse struct {
+	Type   string   `json:"type"`
+	AckIDs []string `json:"ack_ids"`
+}
+
+// CriticalMessage is the async message redelivering an unacknowledged critical publication on connect
+type CriticalMessage struct {
+	Type        string          `json:"type"`
+	AckID       string          `json:"ack_id"`
+	Channel     string          `json:"channel"`
+	Payload     json.RawMessage `json:"payload"`
+	PublishedAt int64           `json:"published_at"`
+}
+
+// SetReceipts enables critical publications, which are tracked until acknowledged and redelivered on connect
+func (s *CentrifugeServer) SetReceipts(receipts Receipts) {
+	s.receipts = receipts
+}
+
+// handleAck acknowledges critical publications of the client's user on every node
+func (s *CentrifugeServer) handleAck(client *centrifuge.Client, e centrifuge.RPCEvent, callback centrifuge.RPCCallback) {
+	if s.receipts == nil {
+		callback(centrifuge.RPCReply{}, protocol.ErrBadRequest("delivery receipts are disabled").ToCentrifuge())
+		return
+	}
+
+	req, perr := decodeRPC[AckRequest](e.Data, "ack")
+	if perr != nil {
+		callback(centrifuge.RPCReply{}, perr.ToCentrifuge())
+		return
+	}
+
+	// Support agents must not acknowledge on behalf of the user they impersonate
+	clientInfo := s.getClientInfo(client)
+	if clientInfo == nil || clientInfo.ImpersonatedBy != "" {
+		callback(centrifuge.RPCReply{}, protocol.ErrUnauthorized("impersonation sessions cannot acknowledge publications").ToCentrifuge())
+		return
+	}
+
+	if err := s.receipts.Ack(clientInfo.AjaibID, req.AckIDs); err != nil {
+		s.logger.Error("failed to acknowledge critical publications", "ajaib_id", clientInfo.AjaibID, "error", err)
+		callback(centrifuge.RPCReply{}, protocol.NewError(protocol.CodeServiceUnavailable, protocol.MessageServiceUnavailable).ToCentrifuge())
+		return
+	}
+
+	data, err := json.Marshal(AckResponse{Type: "acked", AckIDs: req.AckIDs})
+	if err != nil {
+		callback(centrifuge.RPCReply{}, protocol.NewError(protocol.CodeInternalError, "failed to encode ack").ToCentrifuge())
+		return
+	}
+	callback(centrifuge.RPCReply{Data: data}, nil)
+}
+
+// replayCriticals redelivers the unacknowledged critical publications of a newly connected client's user
+func (s *CentrifugeServer) replayCriticals(client *centrifuge.Client) {
+	if s.receipts == nil {
+		return
+	}
+
+	clientInfo := s.getClientInfo(client)
+	if clientInfo == nil {
+		return
+	}
+
+	for _, c := range s.receipts.Unacked(clientInfo.AjaibID, time.Now()) {
+		data, err := json.Marshal(CriticalMessage{
+			Type:        "critical",
+			AckID:       c.AckID,
+			Channel:     c.Channel,
+			Payload:     c.Payload,
+			PublishedAt: c.PublishedAt.UnixMilli(),
+		})
+		if err != nil {
+			s.logger.Error("failed to encode critical publication", "ack_id", c.AckID, "error", err)
+			continue
+		}
+
+		if err := client.Send(data); err != nil {
+			s.logger.Warn("failed to redeliver critical publication",
+				"ack_id", c.AckID,
+				"client_id", client.ID(),
+				"error", err)
+			s.bus.Publish(HubEvent{
+				Type:   HubMessageDropped,
+				Client: client,
+				Reason: "critical " + c.AckID + ": " + err.Error(),
+			})
+		}
+	}
+}
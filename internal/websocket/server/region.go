@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"coin-futures-websocket/internal/websocket/protocol"
+)
+
+// RegionResolver returns the region of the CFX cluster holding a user's account (implemented by the
+// coin-cfx-adapter client)
+type RegionResolver interface {
+	GetCfxUserRegion(ctx context.Context, ajaibID int64) (string, error)
+}
+
+// SetRegionAffinity redirects users whose CFX account is held by another region to that region's
+// endpoint, keyed by region, instead of serving them data relayed across regions
+func (s *CentrifugeServer) SetRegionAffinity(resolver RegionResolver, endpoints map[string]string) {
+	s.regionResolver = resolver
+	s.regionEndpoints = endpoints
+}
+
+// regionRedirect returns the redirect of a user served by another region, or nil when this region serves
+// them. Users whose region is unknown, failed to resolve, or has no endpoint are served here rather than
+// locked out.
+func (s *CentrifugeServer) regionRedirect(ctx context.Context, clientID, ajaibID string) *protocol.Error {
+	if s.regionResolver == nil || s.region == "" {
+		return nil
+	}
+
+	id, err := strconv.ParseInt(ajaibID, 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	region, err := s.regionResolver.GetCfxUserRegion(ctx, id)
+	if err != nil {
+		s.logger.Warn("region lookup failed, serving connection",
+			"client_id", clientID,
+			"ajaib_id", ajaibID,
+			"error", err)
+		return nil
+	}
+	if region == "" || region == s.region {
+		return nil
+	}
+
+	endpoint, ok := s.regionEndpoints[region]
+	if !ok {
+		s.logger.Warn("no endpoint for user's region, serving connection",
+			"client_id", clientID,
+			"ajaib_id", ajaibID,
+			"user_region", region)
+		return nil
+	}
+
+	if s.metrics != nil {
+		s.metrics.RecordRegionRedirect(s.config.NodeName, region)
+	}
+	return protocol.ErrRegionRedirect(region, endpoint)
+}
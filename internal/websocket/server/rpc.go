@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// RPCMethodSubscribe is the RPC method subscribing to several channels in one round trip
+const RPCMethodSubscribe = "subscribe"
+
+// maxBulkSubscribeChannels bounds the number of channels in a single bulk subscribe
+const maxBulkSubscribeChannels = 10
+
+// rpcRequest is an RPC payload validated after decoding
+type rpcRequest interface {
+	Validate() *protocol.Error
+}
+
+// decodeRPC decodes and validates an RPC payload, so handlers only see well-formed requests
+func decodeRPC[T rpcRequest](data []byte, what string) (T, *protocol.Error) {
+	var req T
+	if err := json.Unmarshal(data, &req); err != nil {
+		return req, protocol.ErrBadRequest(fmt.Sprintf("invalid %s payload", what))
+	}
+	return req, req.Validate()
+}
+
+// BulkSubscribeRequest is the RPC payload of a bulk subscribe
+type BulkSubscribeRequest struct {
+	Channels []string `json:"channels"`
+	// Raw subscribes to the untransformed variant of each user channel
+	Raw bool `json:"raw"`
+	// Fields subscribes to the variant of each user channel projected to these payload fields
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Validate checks the channel count and that every channel name is well formed.
+// Well-formed channels the client may not subscribe are reported per channel instead.
+func (r BulkSubscribeRequest) Validate() *protocol.Error {
+	if len(r.Channels) == 0 || len(r.Channels) > maxBulkSubscribeChannels {
+		return protocol.ErrBadRequest(fmt.Sprintf("channels must contain 1 to %d entries", maxBulkSubscribeChannels))
+	}
+
+	var spec string
+	if r.Fields != nil {
+		if r.Raw {
+			return protocol.ErrBadRequest("fields cannot be combined with raw")
+		}
+		var err error
+		if spec, err = channel.ProjectionSpec(r.Fields); err != nil {
+			return protocol.ErrBadRequest(fmt.Sprintf("fields must contain 1 to %d lowercase field names", channel.MaxProjectionFields))
+		}
+	}
+
+	for i, ch := range r.Channels {
+		if !channel.ValidName(ch) || (spec != "" && !channel.IsProjected(ch) && !channel.ValidName(channel.ProjectedChannel(spec, ch))) {
+			return protocol.ErrBadRequest(fmt.Sprintf("channels[%d] is not a valid channel name", i))
+		}
+	}
+	return nil
+}
+
+// ChannelResult is the outcome of subscribing to a single channel
+type ChannelResult struct {
+	Channel    string          `json:"channel"`
+	Subscribed bool            `json:"subscribed"`
+	Error      *protocol.Error `json:"error,omitempty"`
+}
+
+// BulkSubscribeResponse is the RPC reply of a bulk subscribe
+type BulkSubscribeResponse struct {
+	Type    string          `json:"type"`
+	Results []ChannelResult `json:"results"`
+}
+
+// handleBulkSubscribe validates each requested channel and subscribes the client server-side.
+// Channels failing validation are reported in the results without failing the others.
+func (s *CentrifugeServer) handleBulkSubscribe(client *centrifuge.Client, e centrifuge.RPCEvent, callback centrifuge.RPCCallback) {
+	req, perr := decodeRPC[BulkSubscribeRequest](e.Data, "subscribe")
+	if perr != nil {
+		callback(centrifuge.RPCReply{}, perr.ToCentrifuge())
+		return
+	}
+
+	clientInfo := s.getClientInfo(client)
+	resp := BulkSubscribeResponse{
+		Type:    "subscribed",
+		Results: make([]ChannelResult, 0, len(req.Channels)),
+	}
+
+	var spec string
+	if req.Fields != nil {
+		spec, _ = channel.ProjectionSpec(req.Fields)
+	}
+
+	for _, ch := range req.Channels {
+		if req.Raw && !channel.IsRaw(ch) {
+			ch = channel.RawChannel(ch)
+		}
+		if spec != "" && !channel.IsProjected(ch) {
+			ch = channel.ProjectedChannel(spec, ch)
+		}
+		resp.Results = append(resp.Results, s.subscribeServerSide(client, clientInfo, ch))
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		callback(centrifuge.RPCReply{}, protocol.NewError(protocol.CodeInternalError, "failed to encode results").ToCentrifuge())
+		return
+	}
+
+	callback(centrifuge.RPCReply{Data: data}, nil)
+}
+
+// subscribeServerSide subscribes the client to one channel of a bulk subscribe
+func (s *CentrifugeServer) subscribeServerSide(client *centrifuge.Client, clientInfo *ClientInfo, ch string) ChannelResult {
+	result := ChannelResult{Channel: ch}
+
+	channelInfo, perr := s.authorizeChannel(client, clientInfo, ch)
+	if perr != nil {
+		result.Error = perr
+		return result
+	}
+
+	// Already subscribed channels are reported as successful so retries are idempotent
+	if client.IsSubscribed(ch) {
+		result.Subscribed = true
+		return result
+	}
+
+	var opts []centrifuge.SubscribeOption
+	if data := s.subscribeSnapshotData(ch); data != nil {
+		opts = append(opts, centrifuge.WithSubscribeData(data))
+	}
+
+	if err := client.Subscribe(ch, opts...); err != nil {
+		s.logger.Error("server-side subscribe failed",
+			"client_id", client.ID(),
+			"channel", ch,
+			"error", err)
+		result.Error = protocol.NewError(protocol.CodeInternalError, "subscribe failed")
+		return result
+	}
+
+	s.trackSubscription(client, clientInfo, channelInfo)
+	result.Subscribed = true
+	return result
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+
+	"coin-futures-websocket/internal/websocket/protocol"
+)
+
+// Session ID pattern: URL-safe characters, long enough not to collide within a user's sessions
+var sessionIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+// ConnectRequest is the data a client may send with its connect command
+type ConnectRequest struct {
+	// SessionID identifies the client's session across reconnects. It is scoped to the user: support
+	// correlates logs by ajaib_id and session_id, while client_id stays unique per connection.
+	SessionID string `json:"session_id,omitempty"`
+}
+
+// SetClientSessionIDs lets clients carry a session ID across reconnects; clients sending none are
+// assigned one in the connected message to send back when they reconnect
+func (s *CentrifugeServer) SetClientSessionIDs(enabled bool) {
+	s.clientSessionIDs = enabled
+}
+
+// resolveSessionID returns the session ID of a connecting client: the one in its connect data, or a new
+// one when it sent none. Connect data that isn't a ConnectRequest carries no session ID.
+func (s *CentrifugeServer) resolveSessionID(data []byte) (string, *protocol.Error) {
+	if !s.clientSessionIDs {
+		return "", nil
+	}
+
+	var req ConnectRequest
+	if len(data) > 0 {
+		_ = json.Unmarshal(data, &req)
+	}
+	if req.SessionID == "" {
+		return newSessionID(), nil
+	}
+	if !sessionIDPattern.MatchString(req.SessionID) {
+		return "", protocol.ErrBadRequest("session_id must be 8 to 64 letters, digits, '-' or '_'")
+	}
+	return req.SessionID, nil
+}
+
+// newSessionID returns a random session ID
+func newSessionID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"coin-futures-websocket/internal/auth"
+	"coin-futures-websocket/internal/websocket/channel"
+	"coin-futures-websocket/internal/websocket/policy"
+	"coin-futures-websocket/internal/websocket/protocol"
+
+	"github.com/centrifugal/centrifuge"
+)
+
+// SnapshotPath is the route pattern of the channel snapshot endpoint
+const SnapshotPath = "GET /api/v1/snapshot/{channel}"
+
+// Snapshot is the response body of the channel snapshot endpoint
+type Snapshot struct {
+	Channel string          `json:"channel"`
+	Offset  uint64          `json:"offset"`
+	Epoch   string          `json:"epoch"`
+	Time    int64           `json:"time"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// SnapshotHandler returns an HTTP handler serving the last publication of a user channel.
+// Publications are read from channel history, so history must be enabled on the broadcaster.
+func (s *CentrifugeServer) SnapshotHandler() http.Handler {
+	extractor := auth.NewTokenExtractor()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ch := r.PathValue("channel")
+
+		token, err := extractor.Extract(r.Header.Get("Authorization"), r.URL.Query().Get("token"))
+		if err != nil {
+			s.writeJSONError(w, http.StatusUnauthorized, protocol.ErrUnauthorized(err.Error()))
+			return
+		}
+
+		claims, err := auth.NewParser().Parse(token)
+		if err != nil {
+			s.writeJSONError(w, http.StatusUnauthorized, protocol.ErrUnauthorized(err.Error()))
+			return
+		}
+		ajaibID, agent, perr := sessionUser(claims)
+		if perr != nil {
+			s.writeJSONError(w, http.StatusUnauthorized, perr)
+			return
+		}
+
+		// Revoked accounts must not read balances over HTTP either
+		if !s.checkEntitlement(r.Context(), "", ajaibID) {
+			s.logger.Warn("snapshot rejected, futures entitlement revoked", "ajaib_id", ajaibID)
+			s.writeJSONError(w, http.StatusForbidden, protocol.ErrEntitlementRevoked())
+			return
+		}
+
+		channelInfo, err := channel.ParseChannel(ch)
+		if err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, protocol.ErrChannelNotFound(ch, err.Error()))
+			return
+		}
+		if channelInfo.AjaibID == "" {
+			s.writeJSONError(w, http.StatusBadRequest, protocol.ErrChannelNotFound(ch, "snapshots exist for user channels only"))
+			return
+		}
+
+		if channelInfo.AjaibID != ajaibID {
+			s.logger.Warn("snapshot ajaib_id mismatch",
+				"ajaib_id", ajaibID,
+				"channel_ajaib_id", channelInfo.AjaibID,
+				"channel", ch)
+			s.writeJSONError(w, http.StatusForbidden, protocol.ErrChannelNotFound(ch, "channel belongs to another user"))
+			return
+		}
+
+		// Snapshots follow the channel policies of the profile the token would connect with
+		if err := s.policies.Authorize(ch, claims.HasScope, s.profileForClaims(claims).profile.Name); err != nil {
+			s.writeJSONError(w, http.StatusForbidden, protocol.ErrChannelNotFound(ch, err.Error()))
+			return
+		}
+
+		if agent != "" {
+			s.audit.Info("impersonation snapshot", "agent", agent, "ajaib_id", ajaibID, "channel", ch)
+		}
+
+		pub, epoch, err := s.latestPublication(ch)
+		if err != nil {
+			s.logger.Error("failed to read channel history", "channel", ch, "error", err)
+			s.writeJSONError(w, http.StatusServiceUnavailable, protocol.NewError(protocol.CodeServiceUnavailable, protocol.MessageServiceUnavailable))
+			return
+		}
+
+		if pub == nil {
+			s.writeJSONError(w, http.StatusNotFound, protocol.ErrChannelNotFound(ch, "no snapshot available"))
+			return
+		}
+
+		snapshot := Snapshot{
+			Channel: ch,
+			Offset:  pub.Offset,
+			Epoch:   epoch,
+			Time:    pub.Time,
+			Data:    pub.Data,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+			s.logger.Error("failed to encode snapshot", "channel", ch, "error", err)
+		}
+	})
+}
+
+// latestPublication returns the last publication in the channel history and the stream epoch,
+// falling back to the last-value cache. The publication is nil when neither has one, or when it is
+// past the TTL of the channel's policies.
+func (s *CentrifugeServer) latestPublication(ch string) (*centrifuge.Publication, string, error) {
+	result, err := s.node.History(ch, centrifuge.WithLimit(1), centrifuge.WithReverse(true))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(result.Publications) > 0 {
+		return s.unexpired(ch, result.Publications[0]), result.Epoch, nil
+	}
+	if s.lastValues == nil {
+		return nil, result.Epoch, nil
+	}
+
+	value, err := s.lastValues.Get(context.Background(), ch)
+	if err != nil || value == nil {
+		return nil, result.Epoch, err
+	}
+	pub := &centrifuge.Publication{Offset: value.Offset, Data: value.Data, Time: value.Time}
+	return s.unexpired(ch, pub), value.Epoch, nil
+}
+
+// unexpired returns the publication, or nil when it is past the TTL of the channel's policies
+func (s *CentrifugeServer) unexpired(ch string, pub *centrifuge.Publication) *centrifuge.Publication {
+	if pub.Time == 0 || !s.policies.Expired(ch, time.UnixMilli(pub.Time), time.Now()) {
+		return pub
+	}
+	s.expiryMetrics.Record(ch, policy.StageSnapshot)
+	return nil
+}
+
+// subscribeSnapshotData returns the latest channel state to attach to a subscribe acknowledgment,
+// or nil when attaching is disabled or no state is available. Public channels always attach it.
+func (s *CentrifugeServer) subscribeSnapshotData(ch string) []byte {
+	if !s.subscribeSnapshot && !channel.IsPublic(ch) {
+		return nil
+	}
+
+	pub, _, err := s.latestPublication(ch)
+	if err != nil {
+		s.logger.Warn("failed to read snapshot for subscribe acknowledgment", "channel", ch, "error", err)
+		return nil
+	}
+
+	if pub == nil {
+		return nil
+	}
+	return pub.Data
+}
+
+// writeJSONError writes a protocol error as the JSON response body of an HTTP endpoint
+func (s *CentrifugeServer) writeJSONError(w http.ResponseWriter, status int, perr *protocol.Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(perr); err != nil {
+		s.logger.Error("failed to encode error response", "error", err)
+	}
+}
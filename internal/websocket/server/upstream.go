@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// UpstreamSource is the feed delivering CFX margin and position data (implemented by the Kafka consumer)
+type UpstreamSource interface {
+	IsHealthy() bool
+	LastActivity() time.Time
+
+	// Reconnect drops the feed's connections and reconnects
+	Reconnect()
+}
+
+// UpstreamHealth reports the state of the upstream data feed
+type UpstreamHealth struct {
+	Connected        bool  `json:"connected"`
+	LastMessageAgeMs int64 `json:"last_message_age_ms"`
+	Stalled          bool  `json:"stalled"`
+}
+
+// SetUpstream sets the data feed reported by readiness and metrics. The feed is stalled when no message
+// arrives for stallAfter; zero disables the stall check.
+func (s *CentrifugeServer) SetUpstream(source UpstreamSource, stallAfter time.Duration) {
+	s.upstream = source
+	s.upstreamStallAfter = stallAfter
+}
+
+// SetUpstreamReconnect forces the upstream to reconnect when no message arrives for after, at most
+// once per after, so silently dead connections recover without waiting for TCP timeouts. Zero disables it.
+func (s *CentrifugeServer) SetUpstreamReconnect(after time.Duration) {
+	s.upstreamReconnectAfter = after
+}
+
+// upstreamHealth returns the upstream state at now, or nil without an upstream
+func (s *CentrifugeServer) upstreamHealth(now time.Time) *UpstreamHealth {
+	if s.upstream == nil {
+		return nil
+	}
+
+	h := &UpstreamHealth{Connected: s.upstream.IsHealthy()}
+	if last := s.upstream.LastActivity(); !last.IsZero() {
+		h.LastMessageAgeMs = now.Sub(last).Milliseconds()
+	}
+	h.Stalled = h.Connected && s.upstreamStallAfter > 0 && h.LastMessageAgeMs > s.upstreamStallAfter.Milliseconds()
+	return h
+}
+
+// StartUpstreamMonitor periodically records the upstream state in metrics and logs stall transitions
+func (s *CentrifugeServer) StartUpstreamMonitor(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		stalled := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				stalled = s.checkUpstream(now, stalled)
+			}
+		}
+	}()
+}
+
+// checkUpstream records the upstream state and logs when it stalls or recovers, returning whether it is stalled
+func (s *CentrifugeServer) checkUpstream(now time.Time, wasStalled bool) bool {
+	h := s.upstreamHealth(now)
+	if h == nil {
+		return false
+	}
+
+	if s.metrics != nil {
+		s.metrics.UpdateUpstream(*h)
+	}
+
+	s.maybeReconnectUpstream(now, h)
+
+	switch {
+	case h.Stalled && !wasStalled:
+		s.logger.Error("upstream data feed stalled",
+			"last_message_age_ms", h.LastMessageAgeMs,
+			"stall_after", s.upstreamStallAfter.String())
+	case !h.Stalled && wasStalled:
+		s.logger.Info("upstream data feed recovered", "last_message_age_ms", h.LastMessageAgeMs)
+	}
+	return h.Stalled
+}
+
+// maybeReconnectUpstream forces a reconnect when the feed has been silent beyond the reconnect threshold
+func (s *CentrifugeServer) maybeReconnectUpstream(now time.Time, h *UpstreamHealth) bool {
+	after := s.upstreamReconnectAfter
+	if after <= 0 || !h.Connected || h.LastMessageAgeMs <= after.Milliseconds() {
+		return false
+	}
+	if !s.upstreamReconnectedAt.IsZero() && now.Sub(s.upstreamReconnectedAt) < after {
+		return false
+	}
+
+	s.logger.Warn("forcing upstream reconnect, no message received",
+		"last_message_age_ms", h.LastMessageAgeMs,
+		"reconnect_after", after.String())
+
+	s.upstreamReconnectedAt = now
+	s.upstream.Reconnect()
+	if s.metrics != nil {
+		s.metrics.RecordUpstreamReconnect(s.config.NodeName)
+	}
+	return true
+}
@@ -61,26 +61,34 @@ func (m *mockUserPreferenceProvider) GetQuotePreference(_ context.Context, _ str
 type mockKafkaBroadcaster struct {
 	mu           sync.Mutex
 	registered   map[string]string // cfxUserID → ajaibID
-	unregistered []string          // cfxUserIDs passed to UnregisterSubscription
+	unregistered []string          // cfxUserIDs passed to UnregisterClient
 }
 
 func newMockKafkaBroadcaster() *mockKafkaBroadcaster {
 	return &mockKafkaBroadcaster{registered: make(map[string]string)}
 }
 
-func (m *mockKafkaBroadcaster) RegisterSubscription(cfxUserID, ajaibID, _ string) {
+func (m *mockKafkaBroadcaster) RegisterSubscription(cfxUserID, _, _, ajaibID, _ string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	_, exists := m.registered[cfxUserID]
 	m.registered[cfxUserID] = ajaibID
+	return !exists
 }
 
-func (m *mockKafkaBroadcaster) UnregisterSubscription(cfxUserID string) {
+func (m *mockKafkaBroadcaster) UnregisterSubscription(_, _, _ string) {}
+
+func (m *mockKafkaBroadcaster) UnregisterClient(cfxUserID, _ string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.unregistered = append(m.unregistered, cfxUserID)
 	delete(m.registered, cfxUserID)
 }
 
+func (m *mockKafkaBroadcaster) Subscribers() map[string]string {
+	return map[string]string{}
+}
+
 func (m *mockKafkaBroadcaster) isRegistered(cfxUserID string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -405,7 +405,7 @@ func TestDisconnect_CleanClose(t *testing.T) {
 	// Ensure broadcaster has the registration before closing.
 	waitFor(t, eventTimeout, func() bool { return bc.isRegistered(testCfxID) })
 
-	// Close the client — the server's disconnect handler should call UnregisterSubscription.
+	// Close the client — the server's disconnect handler should call UnregisterClient.
 	client.Close()
 
 	waitFor(t, eventTimeout, func() bool { return bc.wasUnregistered(testCfxID) })